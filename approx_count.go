@@ -0,0 +1,20 @@
+package keyvaluestore
+
+// ApproximateCounter is implemented by backends that can estimate the number of sorted set members
+// in a score range more cheaply than ZCount. It's intended for dashboards and other displays of huge
+// sets where an exact count isn't worth reading every member in the range.
+type ApproximateCounter interface {
+	// ZCountApprox estimates the number of members with scores between min and max, inclusive.
+	// Implementations document their error bounds. Small ranges should generally be counted
+	// exactly.
+	ZCountApprox(key string, min, max float64) (int, error)
+}
+
+// ZCountApprox estimates the number of members with scores between min and max, inclusive. If the
+// backend doesn't implement ApproximateCounter, the exact count is returned via ZCount.
+func ZCountApprox(b Backend, key string, min, max float64) (int, error) {
+	if c, ok := b.(ApproximateCounter); ok {
+		return c.ZCountApprox(key, min, max)
+	}
+	return b.ZCount(key, min, max)
+}
@@ -1,16 +1,48 @@
 package keyvaluestore
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 type AtomicWriteResult interface {
 	// Returns true if the transaction failed due to this operation's conditional failing.
 	ConditionalFailed() bool
 }
 
+// AtomicWriteIntResult is implemented by the results of NIncrBy in the atomic writes of backends
+// that can return the new value without an additional read, such as memorystore and redisstore.
+type AtomicWriteIntResult interface {
+	AtomicWriteResult
+
+	// Value returns the key's value after the write. It returns false if the atomic write hasn't
+	// been executed successfully or the value isn't known, e.g. because the write was skipped due
+	// to its idempotency token.
+	Value() (int64, bool)
+}
+
+// NIncrByValue returns the value of a key after an atomic write's NIncrBy, given the operation's
+// result. If the backend can't return the value or it isn't known, false is returned and the value
+// must be read separately.
+func NIncrByValue(r AtomicWriteResult) (int64, bool) {
+	if r, ok := r.(AtomicWriteIntResult); ok {
+		return r.Value()
+	}
+	return 0, false
+}
+
 // DynamoDB can't do more than 25 operations in an atomic write so all backends should enforce this
 // limit.
 const MaxAtomicWriteOperations = 25
 
+// DynamoDB remembers client request tokens for 10 minutes, so all backends should remember
+// idempotency tokens for at least this long.
+const IdempotencyWindow = 10 * time.Minute
+
+// DynamoDB limits client request tokens to 36 characters, so all backends should enforce this
+// limit.
+const MaxIdempotencyTokenLength = 36
+
 // AtomicWriteConflictError happens when an atomic write fails due to contention (but not due to a
 // failed conditional). For example, in DynamoDB this error happens when a transaction fails due to
 // a TransactionConflict.
@@ -78,9 +110,21 @@ type AtomicWriteOperation interface {
 	// No conditionals are applied.
 	ZHAdd(key, field string, member interface{}, score float64) AtomicWriteResult
 
+	// Adds multiple members to a sorted hash as if by ZHAdd. Each entry counts as a separate
+	// operation towards MaxAtomicWriteOperations. No conditionals are applied.
+	ZHMAdd(key string, entries []ZHEntry) AtomicWriteResult
+
+	// Sets the member and score of a sorted hash's field. The atomic write operation will be
+	// aborted if the field does not exist or its member is not equal to oldMember.
+	ZHSetEQ(key, field string, member, oldMember interface{}, score float64) AtomicWriteResult
+
 	// Removes a member from a sorted hash. No conditionals are applied.
 	ZHRem(key, field string) AtomicWriteResult
 
+	// Removes a member from a sorted hash. The atomic write operation will be aborted if the field
+	// does not exist or its member is not equal to the given one.
+	ZHRemEQ(key, field string, member interface{}) AtomicWriteResult
+
 	// Adds a member to a set. No conditionals are applied.
 	SAdd(key string, member interface{}, members ...interface{}) AtomicWriteResult
 
@@ -97,6 +141,41 @@ type AtomicWriteOperation interface {
 	// Deletes one or more fields of the hash at the given key. No conditionals are applied.
 	HDel(key, field string, fields ...string) AtomicWriteResult
 
+	// Makes the operation idempotent: if an atomic write with the same token succeeded within the
+	// last IdempotencyWindow, Exec reports success again without re-applying the operations. This
+	// allows applications to safely retry writes after ambiguous failures such as timeouts. Tokens
+	// should be unique to each logical write, and some backends return an error if a token is
+	// reused for different operations. Returns the operation.
+	WithIdempotencyToken(token string) AtomicWriteOperation
+
+	// Validate checks the operation against the backend's structural limits without executing it.
+	// These include MaxAtomicWriteOperations, MaxIdempotencyTokenLength, and backend-specific
+	// limits such as key sizes. Exec performs the same checks, so callers only need Validate to fail
+	// fast before taking actions that depend on the write. A nil error doesn't guarantee that Exec
+	// will succeed.
+	Validate() error
+
 	// Executes the operation. If a condition failed, returns false.
 	Exec() (bool, error)
 }
+
+type zhmAddResult []AtomicWriteResult
+
+func (r zhmAddResult) ConditionalFailed() bool {
+	for _, result := range r {
+		if result.ConditionalFailed() {
+			return true
+		}
+	}
+	return false
+}
+
+// ZHMAddEach implements AtomicWriteOperation.ZHMAdd by invoking op.ZHAdd for each entry. Backends
+// and wrappers that don't have a more efficient way to add multiple entries can use it.
+func ZHMAddEach(op AtomicWriteOperation, key string, entries []ZHEntry) AtomicWriteResult {
+	results := make(zhmAddResult, len(entries))
+	for i, entry := range entries {
+		results[i] = op.ZHAdd(key, entry.Field, entry.Member, entry.Score)
+	}
+	return results
+}
@@ -5,6 +5,13 @@ type KeyValue struct {
 	Value interface{}
 }
 
+// ZHEntry is a member of a sorted hash. See ZHAdd.
+type ZHEntry struct {
+	Field  string
+	Member interface{}
+	Score  float64
+}
+
 type Backend interface {
 	// Batch allows you to batch up simple operations for better performance potential. Use this
 	// only for possible performance benefits. Read isolation is implementation-defined and other
@@ -15,6 +22,15 @@ type Backend interface {
 	// conditional operations (e.g. SetNX) are not executed.
 	AtomicWrite() AtomicWriteOperation
 
+	// Ping checks that the backend is reachable and able to serve requests, e.g. for readiness
+	// probes. It doesn't modify any data.
+	Ping() error
+
+	// Close releases any resources held by the backend, such as connections and background
+	// goroutines. Backends that wrap other backends generally close them as well. The backend must
+	// not be used after it's closed.
+	Close() error
+
 	Delete(key string) (success bool, err error)
 	Get(key string) (*string, error)
 	Set(key string, value interface{}) error
@@ -25,7 +41,9 @@ type Backend interface {
 	// Set if the key doesn't exist.
 	SetNX(key string, value interface{}) (bool, error)
 
-	// Set if the key exists and its value is equal to the given one.
+	// Set if the key exists and its value is equal to the given one. The old value may be of any
+	// type that ToString supports, and values are compared via their canonical encodings, so a
+	// value set as 10 is equal to "10".
 	SetEQ(key string, value, oldValue interface{}) (success bool, err error)
 
 	// Increments the number with the given key by some number. If the key doesn't exist, it's set
@@ -39,7 +57,8 @@ type Backend interface {
 	// Remove from a set.
 	SRem(key string, member interface{}, members ...interface{}) error
 
-	// Get members of a set.
+	// Get members of a set. Sets with no members don't exist, so if the set doesn't exist, nil is
+	// returned rather than an empty slice.
 	SMembers(key string) ([]string, error)
 
 	// Sets one or more fields of the hash at the given key. If no hash exists at the key, a new one
@@ -53,7 +72,8 @@ type Backend interface {
 	// Gets a field of the hash at the given key or nil if the hash or field does not exist.
 	HGet(key, field string) (*string, error)
 
-	// Gets all fields of the hash at the given key.
+	// Gets all fields of the hash at the given key. Hashes with no fields don't exist, so if the
+	// hash doesn't exist, nil is returned rather than an empty map.
 	HGetAll(key string) (map[string]string, error)
 
 	// Add to or create a sorted set. The size of the member may be limited by some backends (for
@@ -106,12 +126,26 @@ type Backend interface {
 	// It uses a field name instead of the member for the purposes of identifying and
 	// lexicographically sorting members.
 	//
+	// Sorted sets and sorted hashes share a key space: a member added via ZAdd must behave exactly
+	// like one added via ZHAdd with the member as both the field and the value. This allows sorted
+	// sets to be migrated to sorted hashes without rewriting them. Backends must encode the field
+	// the same way for both, so that the sorted hash functions return and remove ZAdd members.
+	//
 	// With DynamoDB, the field is limited to approximately 1024 bytes while the member is not.
 	ZHAdd(key, field string, member interface{}, score float64) error
 
+	// Adds multiple members to a sorted hash as if by ZHAdd, but in as few round trips as the
+	// backend allows. This is useful for building or rebuilding large indexes. The entries aren't
+	// necessarily added atomically.
+	ZHMAdd(key string, entries []ZHEntry) error
+
 	// Remove from a sorted hash.
 	ZHRem(key, field string) error
 
+	// Removes a field from a sorted hash only if its member is equal to the given one. This
+	// prevents races where an index entry is removed after another writer has repointed it.
+	ZHRemEQ(key, field string, member interface{}) (success bool, err error)
+
 	// Get members of a sorted hash by ascending score.
 	ZHRangeByScore(key string, min, max float64, limit int) ([]string, error)
 
@@ -161,6 +195,54 @@ func (m ScoredMembers) Values() []string {
 	return result
 }
 
+func (m ScoredMembers) Scores() []float64 {
+	result := make([]float64, len(m))
+
+	for i, member := range m {
+		result[i] = member.Score
+	}
+
+	return result
+}
+
+// Map returns the members' scores keyed by value.
+func (m ScoredMembers) Map() map[string]float64 {
+	result := make(map[string]float64, len(m))
+
+	for _, member := range m {
+		result[member.Value] = member.Score
+	}
+
+	return result
+}
+
+// Reverse returns a copy of the members in reverse order. The receiver is not modified.
+func (m ScoredMembers) Reverse() ScoredMembers {
+	result := make(ScoredMembers, len(m))
+
+	for i, member := range m {
+		result[len(m)-1-i] = member
+	}
+
+	return result
+}
+
+// Paginate returns up to limit members starting at offset. As with the range methods, a limit of
+// zero or less means no limit. The result shares the receiver's backing array.
+func (m ScoredMembers) Paginate(offset, limit int) ScoredMembers {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(m) {
+		return ScoredMembers{}
+	}
+	m = m[offset:]
+	if limit > 0 && limit < len(m) {
+		m = m[:limit]
+	}
+	return m
+}
+
 type ScoredMember struct {
 	Score float64
 	Value string
@@ -19,3 +19,48 @@ func TestScoredMembers_Values(t *testing.T) {
 		assert.Equal(t, []string{}, members.Values())
 	})
 }
+
+func TestScoredMembers_Scores(t *testing.T) {
+	members := ScoredMembers{{Value: "foo", Score: 3}, {Value: "bar", Score: 1.5}}
+	assert.Equal(t, []float64{3, 1.5}, members.Scores())
+
+	var empty ScoredMembers
+	assert.Equal(t, []float64{}, empty.Scores())
+}
+
+func TestScoredMembers_Map(t *testing.T) {
+	members := ScoredMembers{{Value: "foo", Score: 3}, {Value: "bar", Score: 1.5}}
+	assert.Equal(t, map[string]float64{"foo": 3, "bar": 1.5}, members.Map())
+
+	var empty ScoredMembers
+	assert.Equal(t, map[string]float64{}, empty.Map())
+}
+
+func TestScoredMembers_Reverse(t *testing.T) {
+	members := ScoredMembers{{Value: "a", Score: 1}, {Value: "b", Score: 2}, {Value: "c", Score: 3}}
+	assert.Equal(t, []string{"c", "b", "a"}, members.Reverse().Values())
+	assert.Equal(t, []string{"a", "b", "c"}, members.Values())
+
+	var empty ScoredMembers
+	assert.Empty(t, empty.Reverse())
+}
+
+func TestScoredMembers_Paginate(t *testing.T) {
+	members := ScoredMembers{{Value: "a"}, {Value: "b"}, {Value: "c"}, {Value: "d"}}
+
+	for _, tc := range []struct {
+		Offset   int
+		Limit    int
+		Expected []string
+	}{
+		{0, 2, []string{"a", "b"}},
+		{2, 2, []string{"c", "d"}},
+		{3, 2, []string{"d"}},
+		{4, 2, []string{}},
+		{10, 2, []string{}},
+		{1, 0, []string{"b", "c", "d"}},
+		{-1, 1, []string{"a"}},
+	} {
+		assert.Equal(t, tc.Expected, members.Paginate(tc.Offset, tc.Limit).Values(), "offset = %v, limit = %v", tc.Offset, tc.Limit)
+	}
+}
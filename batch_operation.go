@@ -1,5 +1,10 @@
 package keyvaluestore
 
+import (
+	"errors"
+	"fmt"
+)
+
 type GetResult interface {
 	Result() (*string, error)
 }
@@ -16,6 +21,23 @@ type ErrorResult interface {
 	Result() error
 }
 
+type ZRangeResult interface {
+	Result() ([]string, error)
+}
+
+// MaxBatchConcurrency is the maximum number of concurrent round trips a backend makes when it splits
+// a large batch into multiple requests.
+const MaxBatchConcurrency = 8
+
+// BatchOperation queues up operations to be executed together. Backends split batches that are too
+// large for a single request into multiple round trips, so callers can enqueue any number of
+// operations. Because those round trips may be executed concurrently, the order in which operations
+// are executed isn't guaranteed.
+//
+// Exec attempts every operation, even if some of them fail. Each operation's result reports
+// whether that operation succeeded, and if any failed, Exec returns a *BatchError describing the
+// failures. If Exec returns any other error, the batch couldn't be executed at all and its results
+// are undefined.
 type BatchOperation interface {
 	Get(key string) GetResult
 	Delete(key string) ErrorResult
@@ -27,16 +49,82 @@ type BatchOperation interface {
 	ZRem(key string, member interface{}) ErrorResult
 	ZScore(key string, member interface{}) ZScoreResult
 
+	// ZHMAdd behaves like its counterpart in Backend. It fails if any of the entries can't be
+	// added.
+	ZHMAdd(key string, entries []ZHEntry) ErrorResult
+
+	// Sorted hash range reads behave like their counterparts in Backend.
+	ZHRangeByScore(key string, min, max float64, limit int) ZRangeResult
+	ZHRevRangeByScore(key string, min, max float64, limit int) ZRangeResult
+	ZHRangeByLex(key string, min, max string, limit int) ZRangeResult
+	ZHRevRangeByLex(key string, min, max string, limit int) ZRangeResult
+
+	// Len returns the number of operations that have been added to the batch.
+	Len() int
+
 	Exec() error
 }
 
+// BatchError is returned by BatchOperation.Exec when some of the batch's operations fail. The other
+// operations are still executed. errors.Is and errors.As match any of the errors.
+type BatchError struct {
+	// Errors contains the failures that occurred, in no particular order. A single failure, such as
+	// a failed request, may affect multiple operations, so there may be fewer errors than failed
+	// operations.
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more batch errors)", e.Errors[0], len(e.Errors)-1)
+}
+
+func (e *BatchError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *BatchError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinBatchErrors returns a *BatchError containing the non-nil errors, or nil if there are none.
+// The errors of any *BatchErrors given are included individually.
+func JoinBatchErrors(errs ...error) error {
+	var ret []error
+	for _, err := range errs {
+		if batchErr, ok := err.(*BatchError); ok {
+			ret = append(ret, batchErr.Errors...)
+		} else if err != nil {
+			ret = append(ret, err)
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return &BatchError{
+		Errors: ret,
+	}
+}
+
 // FallbackBatchOperation provides a suitable fallback for stores that don't supported optimized
 // batching.
 type FallbackBatchOperation struct {
 	Backend Backend
 
-	fs         []func()
-	firstError error
+	fs   []func()
+	errs []error
 }
 
 type fboGetResult struct {
@@ -52,8 +140,8 @@ func (op *FallbackBatchOperation) Get(key string) GetResult {
 	result := &fboGetResult{}
 	op.fs = append(op.fs, func() {
 		result.value, result.err = op.Backend.Get(key)
-		if result.err != nil && op.firstError == nil {
-			op.firstError = result.err
+		if result.err != nil {
+			op.errs = append(op.errs, result.err)
 		}
 	})
 	return result
@@ -71,8 +159,8 @@ func (op *FallbackBatchOperation) Set(key string, value interface{}) ErrorResult
 	result := &fboErrorResult{}
 	op.fs = append(op.fs, func() {
 		result.err = op.Backend.Set(key, value)
-		if result.err != nil && op.firstError == nil {
-			op.firstError = result.err
+		if result.err != nil {
+			op.errs = append(op.errs, result.err)
 		}
 	})
 	return result
@@ -82,8 +170,8 @@ func (op *FallbackBatchOperation) Delete(key string) ErrorResult {
 	result := &fboErrorResult{}
 	op.fs = append(op.fs, func() {
 		_, result.err = op.Backend.Delete(key)
-		if result.err != nil && op.firstError == nil {
-			op.firstError = result.err
+		if result.err != nil {
+			op.errs = append(op.errs, result.err)
 		}
 	})
 	return result
@@ -102,8 +190,8 @@ func (op *FallbackBatchOperation) SMembers(key string) SMembersResult {
 	result := &fboSMembersResult{}
 	op.fs = append(op.fs, func() {
 		result.value, result.err = op.Backend.SMembers(key)
-		if result.err != nil && op.firstError == nil {
-			op.firstError = result.err
+		if result.err != nil {
+			op.errs = append(op.errs, result.err)
 		}
 	})
 	return result
@@ -113,8 +201,8 @@ func (op *FallbackBatchOperation) SAdd(key string, member interface{}, members .
 	result := &fboErrorResult{}
 	op.fs = append(op.fs, func() {
 		result.err = op.Backend.SAdd(key, member, members...)
-		if result.err != nil && op.firstError == nil {
-			op.firstError = result.err
+		if result.err != nil {
+			op.errs = append(op.errs, result.err)
 		}
 	})
 	return result
@@ -124,8 +212,8 @@ func (op *FallbackBatchOperation) SRem(key string, member interface{}, members .
 	result := &fboErrorResult{}
 	op.fs = append(op.fs, func() {
 		result.err = op.Backend.SRem(key, member, members...)
-		if result.err != nil && op.firstError == nil {
-			op.firstError = result.err
+		if result.err != nil {
+			op.errs = append(op.errs, result.err)
 		}
 	})
 	return result
@@ -135,8 +223,8 @@ func (op *FallbackBatchOperation) ZAdd(key string, member interface{}, score flo
 	result := &fboErrorResult{}
 	op.fs = append(op.fs, func() {
 		result.err = op.Backend.ZAdd(key, member, score)
-		if result.err != nil && op.firstError == nil {
-			op.firstError = result.err
+		if result.err != nil {
+			op.errs = append(op.errs, result.err)
 		}
 	})
 	return result
@@ -146,8 +234,19 @@ func (op *FallbackBatchOperation) ZRem(key string, member interface{}) ErrorResu
 	result := &fboErrorResult{}
 	op.fs = append(op.fs, func() {
 		result.err = op.Backend.ZRem(key, member)
-		if result.err != nil && op.firstError == nil {
-			op.firstError = result.err
+		if result.err != nil {
+			op.errs = append(op.errs, result.err)
+		}
+	})
+	return result
+}
+
+func (op *FallbackBatchOperation) ZHMAdd(key string, entries []ZHEntry) ErrorResult {
+	result := &fboErrorResult{}
+	op.fs = append(op.fs, func() {
+		result.err = op.Backend.ZHMAdd(key, entries)
+		if result.err != nil {
+			op.errs = append(op.errs, result.err)
 		}
 	})
 	return result
@@ -166,16 +265,65 @@ func (op *FallbackBatchOperation) ZScore(key string, member interface{}) ZScoreR
 	result := &fboZScoreResult{}
 	op.fs = append(op.fs, func() {
 		result.value, result.err = op.Backend.ZScore(key, member)
-		if result.err != nil && op.firstError == nil {
-			op.firstError = result.err
+		if result.err != nil {
+			op.errs = append(op.errs, result.err)
+		}
+	})
+	return result
+}
+
+type fboZRangeResult struct {
+	value []string
+	err   error
+}
+
+func (r *fboZRangeResult) Result() ([]string, error) {
+	return r.value, r.err
+}
+
+func (op *FallbackBatchOperation) zRange(f func() ([]string, error)) ZRangeResult {
+	result := &fboZRangeResult{}
+	op.fs = append(op.fs, func() {
+		result.value, result.err = f()
+		if result.err != nil {
+			op.errs = append(op.errs, result.err)
 		}
 	})
 	return result
 }
 
+func (op *FallbackBatchOperation) ZHRangeByScore(key string, min, max float64, limit int) ZRangeResult {
+	return op.zRange(func() ([]string, error) {
+		return op.Backend.ZHRangeByScore(key, min, max, limit)
+	})
+}
+
+func (op *FallbackBatchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) ZRangeResult {
+	return op.zRange(func() ([]string, error) {
+		return op.Backend.ZHRevRangeByScore(key, min, max, limit)
+	})
+}
+
+func (op *FallbackBatchOperation) ZHRangeByLex(key string, min, max string, limit int) ZRangeResult {
+	return op.zRange(func() ([]string, error) {
+		return op.Backend.ZHRangeByLex(key, min, max, limit)
+	})
+}
+
+func (op *FallbackBatchOperation) ZHRevRangeByLex(key string, min, max string, limit int) ZRangeResult {
+	return op.zRange(func() ([]string, error) {
+		return op.Backend.ZHRevRangeByLex(key, min, max, limit)
+	})
+}
+
+func (op *FallbackBatchOperation) Len() int {
+	return len(op.fs)
+}
+
 func (op *FallbackBatchOperation) Exec() error {
+	op.errs = nil
 	for _, f := range op.fs {
 		f()
 	}
-	return op.firstError
+	return JoinBatchErrors(op.errs...)
 }
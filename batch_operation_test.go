@@ -0,0 +1,33 @@
+package keyvaluestore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinBatchErrors(t *testing.T) {
+	assert.NoError(t, JoinBatchErrors())
+	assert.NoError(t, JoinBatchErrors(nil, nil))
+
+	errFoo := errors.New("foo")
+	errBar := &Error{Kind: ErrWrongType, Err: errors.New("bar")}
+
+	err := JoinBatchErrors(nil, errFoo)
+	assert.Equal(t, &BatchError{Errors: []error{errFoo}}, err)
+	assert.Equal(t, "foo", err.Error())
+
+	// Nested batch errors are flattened.
+	err = JoinBatchErrors(err, errBar)
+	assert.Equal(t, &BatchError{Errors: []error{errFoo, errBar}}, err)
+	assert.Equal(t, "foo (and 1 more batch errors)", err.Error())
+
+	assert.True(t, errors.Is(err, errFoo))
+	assert.True(t, errors.Is(err, ErrWrongType))
+	assert.False(t, errors.Is(err, ErrNotSupported))
+
+	var kvsErr *Error
+	assert.True(t, errors.As(err, &kvsErr))
+	assert.Equal(t, errBar, kvsErr)
+}
@@ -0,0 +1,36 @@
+package keyvaluestore
+
+import "fmt"
+
+// BatchOptions modify how a batch is executed.
+type BatchOptions struct {
+	// If Snapshot is true, all of the batch's reads observe a single, consistent snapshot of the
+	// backend, as if they were all performed at the same instant. Without it, a batch's reads may
+	// be split across round trips that each observe different writes.
+	//
+	// The batch's writes are applied after its reads, so the reads never observe them.
+	Snapshot bool
+}
+
+// SnapshotBatcher is implemented by backends that can guarantee snapshot consistency for batch
+// reads. Implementing it is how a backend advertises the capability.
+type SnapshotBatcher interface {
+	// SnapshotBatch returns a batch whose reads observe a single, consistent snapshot.
+	SnapshotBatch() BatchOperation
+}
+
+// BatchWithOptions returns a batch that's executed according to the given options:
+//
+//	batch, err := keyvaluestore.BatchWithOptions(backend, keyvaluestore.BatchOptions{
+//		Snapshot: true,
+//	})
+//
+// If the backend can't honor the options, an error that matches ErrNotSupported is returned.
+func BatchWithOptions(b Backend, opts BatchOptions) (BatchOperation, error) {
+	if !opts.Snapshot {
+		return b.Batch(), nil
+	} else if sb, ok := b.(SnapshotBatcher); ok {
+		return sb.SnapshotBatch(), nil
+	}
+	return nil, fmt.Errorf("backend does not support snapshot batches: %T: %w", b, ErrNotSupported)
+}
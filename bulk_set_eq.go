@@ -0,0 +1,103 @@
+package keyvaluestore
+
+import "sync"
+
+// ConditionalWrite is a single compare-and-swap performed by BulkSetEQ.
+type ConditionalWrite struct {
+	Key   string
+	Value interface{}
+
+	// OldValue is the value the key must have for the write to be applied. If nil, the key must not
+	// exist.
+	OldValue interface{}
+}
+
+// ConditionalWriteResult is the outcome of a ConditionalWrite.
+type ConditionalWriteResult struct {
+	// Applied is true if the write's conditional passed and the value was written.
+	Applied bool
+
+	// Err is set if the write's transaction failed for a reason other than a failed conditional.
+	// The write may or may not have been applied.
+	Err error
+}
+
+// BulkSetEQ performs many conditional writes, reporting the outcome of each one. The writes are
+// grouped into atomic writes of up to MaxAtomicWriteOperations, and up to MaxBatchConcurrency of
+// them are executed concurrently. The writes aren't atomic as a whole, and each key should appear at
+// most once.
+//
+// If some of an atomic write's conditionals fail, the writes whose conditionals passed are retried
+// without them, so each write is applied if and only if its own conditional passes.
+func BulkSetEQ(b Backend, writes []ConditionalWrite) []ConditionalWriteResult {
+	results := make([]ConditionalWriteResult, len(writes))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, MaxBatchConcurrency)
+
+	for start := 0; start < len(writes); start += MaxAtomicWriteOperations {
+		end := start + MaxAtomicWriteOperations
+		if end > len(writes) {
+			end = len(writes)
+		}
+		indices := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			indices = append(indices, i)
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			bulkSetEQ(b, writes, indices, results)
+		}()
+	}
+
+	wg.Wait()
+	return results
+}
+
+// bulkSetEQ performs the writes at the given indices atomically, removing writes whose conditionals
+// fail until the remaining writes succeed.
+func bulkSetEQ(b Backend, writes []ConditionalWrite, indices []int, results []ConditionalWriteResult) {
+	for len(indices) > 0 {
+		tx := b.AtomicWrite()
+		conditionals := make([]AtomicWriteResult, len(indices))
+		for i, index := range indices {
+			w := writes[index]
+			if w.OldValue == nil {
+				conditionals[i] = tx.SetNX(w.Key, w.Value)
+			} else {
+				conditionals[i] = tx.SetEQ(w.Key, w.Value, w.OldValue)
+			}
+		}
+
+		ok, err := tx.Exec()
+		if err != nil {
+			for _, index := range indices {
+				results[index].Err = err
+			}
+			return
+		} else if ok {
+			for _, index := range indices {
+				results[index].Applied = true
+			}
+			return
+		}
+
+		remaining := indices[:0]
+		for i, index := range indices {
+			if !conditionals[i].ConditionalFailed() {
+				remaining = append(remaining, index)
+			}
+		}
+		if len(remaining) == len(indices) {
+			// The backend didn't tell us which conditional failed, so we can't make progress.
+			return
+		}
+		indices = remaining
+	}
+}
@@ -0,0 +1,58 @@
+package keyvaluestore_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBulkSetEQ(t *testing.T) {
+	b := memorystore.NewBackend()
+
+	var writes []keyvaluestore.ConditionalWrite
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		require.NoError(t, b.Set(key, "a"))
+		w := keyvaluestore.ConditionalWrite{
+			Key:      key,
+			Value:    "b",
+			OldValue: "a",
+		}
+		if i%10 == 0 {
+			// These conditionals will fail.
+			w.OldValue = "x"
+		}
+		writes = append(writes, w)
+	}
+	writes = append(writes, keyvaluestore.ConditionalWrite{
+		Key:   "new",
+		Value: "b",
+	})
+
+	results := keyvaluestore.BulkSetEQ(b, writes)
+	require.Len(t, results, len(writes))
+	for i, w := range writes {
+		require.NoError(t, results[i].Err)
+
+		expected := "b"
+		if w.OldValue == "x" {
+			expected = "a"
+		}
+		assert.Equal(t, expected == "b", results[i].Applied, w.Key)
+
+		v, err := b.Get(w.Key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, *v, w.Key)
+	}
+
+	// Running the same writes again should fail everywhere.
+	for _, r := range keyvaluestore.BulkSetEQ(b, writes[:50]) {
+		assert.NoError(t, r.Err)
+		assert.False(t, r.Applied)
+	}
+}
@@ -0,0 +1,144 @@
+// Package backendflags provides the command line flags used by the commands in this repository to
+// connect to a backend.
+package backendflags
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kms"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/dynamodbstore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreexport"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+	"github.com/ccbrown/keyvaluestore/redisstore"
+)
+
+type Flags struct {
+	memory               *bool
+	redisAddress         *string
+	redisDB              *int
+	dynamoDBTable        *string
+	dynamoDBEndpoint     *string
+	dynamoDBScanCapacity *float64
+	dump                 *string
+	dumpFormat           *string
+}
+
+// Add adds the flags for a backend. The prefix is prepended to each flag's name so that commands
+// can accept multiple backends.
+func Add(fs *flag.FlagSet, prefix string) *Flags {
+	return &Flags{
+		memory:               fs.Bool(prefix+"memory", false, "use an empty in-memory backend"),
+		redisAddress:         fs.String(prefix+"redis", "", "the address of a redis server to connect to"),
+		redisDB:              fs.Int(prefix+"redis-db", 0, "the redis database to select"),
+		dynamoDBTable:        fs.String(prefix+"dynamodb-table", "", "the dynamodb table to use. credentials and region are taken from the standard aws environment variables and config files"),
+		dynamoDBEndpoint:     fs.String(prefix+"dynamodb-endpoint", "", "overrides the dynamodb endpoint, e.g. for dynamodb local"),
+		dynamoDBScanCapacity: fs.Float64(prefix+"dynamodb-scan-capacity", 0, "if given, scans such as those of exports consume at most this many read capacity units per second, backing off further if throttled"),
+		dump:                 fs.String(prefix+"dump", "", "a file created by kvsctl export to load into memory and use as the backend"),
+		dumpFormat:           fs.String(prefix+"dump-format", "jsonl", "the format of the dump (jsonl or binary)"),
+	}
+}
+
+// Backend connects to the backend specified by the flags.
+func (f *Flags) Backend() (keyvaluestore.Backend, error) {
+	if *f.redisAddress != "" {
+		b := redisstore.New(redisstore.Config{
+			Addr: *f.redisAddress,
+			DB:   *f.redisDB,
+		})
+		if err := b.Ping(); err != nil {
+			b.Close()
+			return nil, fmt.Errorf("unable to connect to redis: %v", err)
+		}
+		return b, nil
+	}
+	if *f.dynamoDBTable != "" {
+		config := &aws.Config{}
+		if *f.dynamoDBEndpoint != "" {
+			config.Endpoint = f.dynamoDBEndpoint
+		}
+		sess, err := session.NewSession(config)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create aws session: %v", err)
+		}
+		b := &dynamodbstore.Backend{
+			Client:    dynamodb.New(sess),
+			TableName: *f.dynamoDBTable,
+		}
+		if *f.dynamoDBScanCapacity > 0 {
+			b.ScanLimiter = &dynamodbstore.ScanLimiter{
+				CapacityUnitsPerSecond: *f.dynamoDBScanCapacity,
+			}
+		}
+		return b, nil
+	}
+	if *f.dump != "" {
+		return loadDump(*f.dump, *f.dumpFormat)
+	}
+	if *f.memory {
+		return memorystore.NewBackend(), nil
+	}
+	return nil, fmt.Errorf("no backend specified")
+}
+
+func loadDump(path, format string) (keyvaluestore.Backend, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file, format)
+	if err != nil {
+		return nil, err
+	}
+	b := memorystore.NewBackend()
+	if _, err := keyvaluestoreexport.Import(b, reader, keyvaluestoreexport.ImportOptions{}); err != nil {
+		return nil, fmt.Errorf("unable to load dump: %v", err)
+	}
+	return b, nil
+}
+
+// NewKMSKeyManager returns a key manager for encrypted dumps. Credentials and region are taken from
+// the standard AWS environment variables and config files. The key id is only needed for
+// encryption.
+func NewKMSKeyManager(keyID string) (*keyvaluestoreexport.KMSKeyManager, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create aws session: %v", err)
+	}
+	return &keyvaluestoreexport.KMSKeyManager{
+		Client: kms.New(sess),
+		KeyID:  keyID,
+	}, nil
+}
+
+// NewReader returns a reader for dumps of the given format. Dumps encrypted via KMS are detected and
+// decrypted.
+func NewReader(r io.Reader, format string) (keyvaluestoreexport.Reader, error) {
+	br := bufio.NewReader(r)
+	if header, _ := br.Peek(8); keyvaluestoreexport.IsEncrypted(header) {
+		keys, err := NewKMSKeyManager("")
+		if err != nil {
+			return nil, err
+		}
+		r = keyvaluestoreexport.NewEncryptedReader(br, keys)
+	} else {
+		r = br
+	}
+	switch format {
+	case "jsonl":
+		return keyvaluestoreexport.NewJSONReader(r), nil
+	case "binary":
+		return keyvaluestoreexport.NewBinaryReader(r), nil
+	}
+	return nil, fmt.Errorf("unknown format: %v", format)
+}
@@ -0,0 +1,68 @@
+// Command kvsbench drives configurable workloads against a backend and reports throughput and
+// latency percentiles.
+//
+// For example, to run a read-heavy workload with batched reads against Redis for a minute:
+//
+//	kvsbench -redis 127.0.0.1:6379 -read-ratio 0.9 -batch-size 10 -concurrency 16 -duration 1m
+//
+// Keys are prefixed with "kvsbench:", but benchmarks should still be run against dedicated
+// databases since they overwrite data.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore/cmd/internal/backendflags"
+)
+
+func main() {
+	fs := flag.NewFlagSet("kvsbench", flag.ExitOnError)
+	backendFlags := backendflags.Add(fs, "")
+	w := &Workload{}
+	fs.IntVar(&w.Keys, "keys", 1000, "the number of distinct keys to operate on")
+	fs.Float64Var(&w.ReadRatio, "read-ratio", 0.5, "the fraction of operations that are reads")
+	fs.Float64Var(&w.SortedSetRatio, "sorted-set-ratio", 0, "the fraction of operations that target sorted sets")
+	fs.IntVar(&w.SortedSetFanOut, "sorted-set-fan-out", 100, "the number of members in each sorted set")
+	fs.IntVar(&w.ValueSize, "value-size", 100, "the size of written values in bytes")
+	fs.IntVar(&w.BatchSize, "batch-size", 1, "the number of keys to get per batch")
+	fs.IntVar(&w.Concurrency, "concurrency", 1, "the number of concurrent clients")
+	fs.DurationVar(&w.Duration, "duration", 10*time.Second, "how long to run the benchmark for")
+	fs.IntVar(&w.Operations, "operations", 0, "if given, the benchmark stops after this many operations")
+	populate := fs.Bool("populate", true, "write every key before starting the benchmark")
+	fs.Parse(os.Args[1:])
+
+	if err := run(backendFlags, w, *populate); err != nil {
+		fmt.Fprintf(os.Stderr, "kvsbench: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(backendFlags *backendflags.Flags, w *Workload, populate bool) error {
+	if w.Keys <= 0 {
+		return fmt.Errorf("at least one key is required")
+	} else if w.SortedSetRatio > 0 && w.SortedSetFanOut <= 0 {
+		return fmt.Errorf("sorted set fan-out must be positive")
+	}
+
+	b, err := backendFlags.Backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	if populate {
+		fmt.Fprintf(os.Stderr, "populating %v keys...\n", w.Keys)
+		if err := w.Populate(b); err != nil {
+			return err
+		}
+	}
+
+	results, err := w.Run(b)
+	if err != nil {
+		return err
+	}
+	return results.Write(os.Stdout)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Results holds the latencies recorded during a benchmark.
+type Results struct {
+	Elapsed    time.Duration
+	Operations map[string]*OperationResults
+}
+
+type OperationResults struct {
+	Latencies []time.Duration
+	Errors    int
+	LastError error
+}
+
+func newResults() *Results {
+	return &Results{
+		Operations: map[string]*OperationResults{},
+	}
+}
+
+func (r *Results) operation(name string) *OperationResults {
+	op, ok := r.Operations[name]
+	if !ok {
+		op = &OperationResults{}
+		r.Operations[name] = op
+	}
+	return op
+}
+
+func (r *Results) add(name string, latency time.Duration, err error) {
+	op := r.operation(name)
+	op.Latencies = append(op.Latencies, latency)
+	if err != nil {
+		op.Errors++
+		op.LastError = err
+	}
+}
+
+func (r *Results) merge(other *Results) {
+	for name, otherOp := range other.Operations {
+		op := r.operation(name)
+		op.Latencies = append(op.Latencies, otherOp.Latencies...)
+		op.Errors += otherOp.Errors
+		if otherOp.LastError != nil {
+			op.LastError = otherOp.LastError
+		}
+	}
+}
+
+// Percentile returns the latency below which the given fraction of operations completed.
+func (op *OperationResults) Percentile(p float64) time.Duration {
+	if len(op.Latencies) == 0 {
+		return 0
+	}
+	sort.Slice(op.Latencies, func(i, j int) bool { return op.Latencies[i] < op.Latencies[j] })
+	i := int(p * float64(len(op.Latencies)))
+	if i >= len(op.Latencies) {
+		i = len(op.Latencies) - 1
+	}
+	return op.Latencies[i]
+}
+
+// Write writes a table of throughput and latency percentiles for each operation.
+func (r *Results) Write(w io.Writer) error {
+	names := make([]string, 0, len(r.Operations))
+	total := 0
+	for name, op := range r.Operations {
+		names = append(names, name)
+		total += len(op.Latencies)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "operation\tcount\terrors\tops/sec\tp50\tp90\tp99\tp99.9\tmax\t")
+	for _, name := range names {
+		op := r.Operations[name]
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%.1f\t%v\t%v\t%v\t%v\t%v\t\n", name, len(op.Latencies), op.Errors,
+			float64(len(op.Latencies))/r.Elapsed.Seconds(),
+			op.Percentile(0.5), op.Percentile(0.9), op.Percentile(0.99), op.Percentile(0.999), op.Percentile(1))
+	}
+	fmt.Fprintf(tw, "total\t%v\t\t%.1f\t\t\t\t\t\t\n", total, float64(total)/r.Elapsed.Seconds())
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := r.Operations[name].LastError; err != nil {
+			fmt.Fprintf(w, "last %v error: %v\n", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Workload describes the operations to drive against a backend.
+type Workload struct {
+	// The number of distinct string keys and sorted set keys.
+	Keys int
+
+	// The fraction of operations that are reads, between 0 and 1.
+	ReadRatio float64
+
+	// The fraction of operations that target sorted sets instead of strings, between 0 and 1.
+	SortedSetRatio float64
+
+	// The number of members in each sorted set. Sorted set reads fetch all of them.
+	SortedSetFanOut int
+
+	// The size of written values in bytes.
+	ValueSize int
+
+	// If greater than 1, string reads are done in batches of this size.
+	BatchSize int
+
+	// The number of goroutines issuing operations.
+	Concurrency int
+
+	// The benchmark stops after Duration or Operations, whichever comes first. Zero values are
+	// ignored.
+	Duration   time.Duration
+	Operations int
+}
+
+func (w *Workload) stringKey(i int) string {
+	return "kvsbench:s:" + strconv.Itoa(i)
+}
+
+func (w *Workload) sortedSetKey(i int) string {
+	return "kvsbench:z:" + strconv.Itoa(i)
+}
+
+// Populate writes every key so that reads hit existing data.
+func (w *Workload) Populate(b keyvaluestore.Backend) error {
+	value := strings.Repeat("x", w.ValueSize)
+	for i := 0; i < w.Keys; i++ {
+		if err := b.Set(w.stringKey(i), value); err != nil {
+			return err
+		}
+		if w.SortedSetRatio > 0 {
+			for j := 0; j < w.SortedSetFanOut; j++ {
+				if err := b.ZAdd(w.sortedSetKey(i), strconv.Itoa(j), float64(j)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Run drives the workload against the backend and returns the latencies of each operation.
+func (w *Workload) Run(b keyvaluestore.Backend) (*Results, error) {
+	if w.Duration <= 0 && w.Operations <= 0 {
+		return nil, fmt.Errorf("either a duration or a number of operations is required")
+	}
+	concurrency := w.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var deadline time.Time
+	start := time.Now()
+	if w.Duration > 0 {
+		deadline = start.Add(w.Duration)
+	}
+
+	var mutex sync.Mutex
+	remaining := w.Operations
+	next := func() bool {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return false
+		} else if w.Operations <= 0 {
+			return true
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if remaining == 0 {
+			return false
+		}
+		remaining--
+		return true
+	}
+
+	workerResults := make([]*Results, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			results := newResults()
+			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(worker)))
+			value := strings.Repeat("x", w.ValueSize)
+			for next() {
+				name, f := w.operation(b, rng, value)
+				opStart := time.Now()
+				err := f()
+				results.add(name, time.Since(opStart), err)
+			}
+			workerResults[worker] = results
+		}(i)
+	}
+	wg.Wait()
+
+	ret := newResults()
+	for _, results := range workerResults {
+		ret.merge(results)
+	}
+	ret.Elapsed = time.Since(start)
+	return ret, nil
+}
+
+// operation picks the next operation to perform.
+func (w *Workload) operation(b keyvaluestore.Backend, rng *rand.Rand, value string) (string, func() error) {
+	read := rng.Float64() < w.ReadRatio
+	key := rng.Intn(w.Keys)
+
+	if rng.Float64() < w.SortedSetRatio {
+		if read {
+			return "ZRangeByScore", func() error {
+				_, err := b.ZRangeByScore(w.sortedSetKey(key), 0, float64(w.SortedSetFanOut), 0)
+				return err
+			}
+		}
+		member := strconv.Itoa(rng.Intn(w.SortedSetFanOut))
+		return "ZAdd", func() error {
+			return b.ZAdd(w.sortedSetKey(key), member, rng.Float64()*float64(w.SortedSetFanOut))
+		}
+	}
+
+	if !read {
+		return "Set", func() error {
+			return b.Set(w.stringKey(key), value)
+		}
+	} else if w.BatchSize <= 1 {
+		return "Get", func() error {
+			_, err := b.Get(w.stringKey(key))
+			return err
+		}
+	}
+
+	keys := make([]string, w.BatchSize)
+	for i := range keys {
+		keys[i] = w.stringKey(rng.Intn(w.Keys))
+	}
+	return "BatchGet", func() error {
+		batch := b.Batch()
+		results := make([]keyvaluestore.GetResult, len(keys))
+		for i, key := range keys {
+			results[i] = batch.Get(key)
+		}
+		if err := batch.Exec(); err != nil {
+			return err
+		}
+		for _, result := range results {
+			if _, err := result.Result(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
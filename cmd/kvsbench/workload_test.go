@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestWorkload(t *testing.T) {
+	b := memorystore.NewBackend()
+	w := &Workload{
+		Keys:            10,
+		ReadRatio:       0.5,
+		SortedSetRatio:  0.5,
+		SortedSetFanOut: 5,
+		ValueSize:       10,
+		BatchSize:       3,
+		Concurrency:     4,
+		Operations:      1000,
+	}
+	require.NoError(t, w.Populate(b))
+
+	results, err := w.Run(b)
+	require.NoError(t, err)
+
+	total := 0
+	for name, op := range results.Operations {
+		assert.Contains(t, []string{"BatchGet", "Set", "ZAdd", "ZRangeByScore"}, name)
+		assert.Zero(t, op.Errors)
+		total += len(op.Latencies)
+		assert.True(t, op.Percentile(0.5) <= op.Percentile(0.99))
+	}
+	assert.Equal(t, 1000, total)
+}
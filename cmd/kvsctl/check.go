@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ccbrown/keyvaluestore/cmd/internal/backendflags"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorecheck"
+)
+
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	aFlags := backendflags.Add(fs, "a-")
+	bFlags := backendflags.Add(fs, "b-")
+	pageSize := fs.Int("page-size", keyvaluestorecheck.DefaultPageSize, "the number of entries to scan at a time")
+	fs.Parse(args)
+
+	a, err := aFlags.Backend()
+	if err != nil {
+		return fmt.Errorf("a: %v", err)
+	}
+	defer a.Close()
+	b, err := bFlags.Backend()
+	if err != nil {
+		return fmt.Errorf("b: %v", err)
+	}
+	defer b.Close()
+
+	result, err := (&keyvaluestorecheck.Checker{
+		A:        a,
+		B:        b,
+		PageSize: *pageSize,
+	}).Check()
+	if err != nil {
+		return err
+	}
+	for _, diff := range result.Differences {
+		fmt.Println(diff)
+	}
+	fmt.Fprintf(os.Stderr, "checked %v keys, found %v differences\n", result.Checked, len(result.Differences))
+	if len(result.Differences) > 0 {
+		return fmt.Errorf("backends differ")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ccbrown/keyvaluestore/cmd/internal/backendflags"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreexport"
+)
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	backendFlags := backendflags.Add(fs, "")
+	format := fs.String("format", "jsonl", "the output format (jsonl or binary)")
+	output := fs.String("o", "", "the file to write to (defaults to stdout)")
+	pageSize := fs.Int("page-size", keyvaluestoreexport.DefaultPageSize, "the number of entries to scan at a time")
+	segments := fs.Int("segments", 1, "the number of segments to scan concurrently, for backends that support parallel scans such as dynamodb")
+	checkpoint := fs.String("checkpoint", "", "a file to record the cursor in after each page. if the file already exists, the export resumes from its cursor and appends to the output. checkpointed exports aren't read from a snapshot, so they aren't point-in-time consistent")
+	kmsKeyID := fs.String("kms-key-id", "", "if given, the output is encrypted with a data key generated by this aws kms key. imports decrypt it automatically")
+	fs.Parse(args)
+
+	var cursor string
+	if *checkpoint != "" {
+		if buf, err := ioutil.ReadFile(*checkpoint); err == nil {
+			cursor = strings.TrimSpace(string(buf))
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	b, err := backendFlags.Backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if cursor != "" {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(*output, flags, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var encrypted *keyvaluestoreexport.EncryptedWriter
+	if *kmsKeyID != "" {
+		keys, err := backendflags.NewKMSKeyManager(*kmsKeyID)
+		if err != nil {
+			return err
+		}
+		if encrypted, err = keyvaluestoreexport.NewEncryptedWriter(w, keys); err != nil {
+			return err
+		}
+		w = encrypted
+	}
+
+	var writer keyvaluestoreexport.Writer
+	switch *format {
+	case "jsonl":
+		writer = keyvaluestoreexport.NewJSONWriter(w)
+	case "binary":
+		writer = keyvaluestoreexport.NewBinaryWriter(w)
+	default:
+		return fmt.Errorf("unknown format: %v", *format)
+	}
+
+	opts := keyvaluestoreexport.Options{
+		Cursor:   cursor,
+		PageSize: *pageSize,
+		Segments: *segments,
+		Metadata: true,
+	}
+	if *checkpoint != "" {
+		opts.Checkpoint = func(cursor string) error {
+			return ioutil.WriteFile(*checkpoint, []byte(cursor+"\n"), 0644)
+		}
+	}
+
+	n, err := keyvaluestoreexport.Export(b, writer, opts)
+	fmt.Fprintf(os.Stderr, "exported %v entries\n", n)
+	if err != nil {
+		return err
+	}
+	if encrypted != nil {
+		if err := encrypted.Close(); err != nil {
+			return err
+		}
+	}
+	if *checkpoint != "" {
+		// The export is complete, so there's nothing left to resume.
+		if err := os.Remove(*checkpoint); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
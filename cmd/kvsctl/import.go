@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ccbrown/keyvaluestore/cmd/internal/backendflags"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreexport"
+)
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	backendFlags := backendflags.Add(fs, "")
+	format := fs.String("format", "jsonl", "the input format (jsonl or binary)")
+	input := fs.String("i", "", "the file to read from (defaults to stdin)")
+	concurrency := fs.Int("concurrency", 1, "the number of entries to write concurrently")
+	onConflict := fs.String("on-conflict", "overwrite", "what to do when a key already exists (overwrite, skip, or fail)")
+	fs.Parse(args)
+
+	var policy keyvaluestoreexport.ConflictPolicy
+	switch *onConflict {
+	case "overwrite":
+		policy = keyvaluestoreexport.ConflictPolicyOverwrite
+	case "skip":
+		policy = keyvaluestoreexport.ConflictPolicySkip
+	case "fail":
+		policy = keyvaluestoreexport.ConflictPolicyFail
+	default:
+		return fmt.Errorf("unknown conflict policy: %v", *onConflict)
+	}
+
+	b, err := backendFlags.Backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	reader, err := backendflags.NewReader(r, *format)
+	if err != nil {
+		return err
+	}
+
+	result, err := keyvaluestoreexport.Import(b, reader, keyvaluestoreexport.ImportOptions{
+		Concurrency:    *concurrency,
+		ConflictPolicy: policy,
+	})
+	if result != nil {
+		fmt.Fprintf(os.Stderr, "imported %v entries, skipped %v\n", result.Imported, result.Skipped)
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+// Command kvsctl is a utility for operating on keyvaluestore backends.
+//
+// Usage:
+//
+//	kvsctl <command> [flags]
+//
+// Run "kvsctl <command> -h" for the flags accepted by each command.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	Description string
+	Run         func(args []string) error
+}
+
+var commands = map[string]command{
+	"export": {
+		Description: "write a backend's contents to a portable format",
+		Run:         runExport,
+	},
+	"import": {
+		Description: "write the contents of an export to a backend",
+		Run:         runImport,
+	},
+	"check": {
+		Description: "report the differences between two backends or dumps",
+		Run:         runCheck,
+	},
+	"migrate": {
+		Description: "copy one backend's contents to another and verify the result",
+		Run:         runMigrate,
+	},
+	"shell": {
+		Description: "run commands against a backend interactively",
+		Run:         runShell,
+	},
+	"sortkey": {
+		Description: "decode the sort keys of sorted set members",
+		Run:         runSortKey,
+	},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: kvsctl <command> [flags]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10v %v\n", name, commands[name].Description)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.Run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
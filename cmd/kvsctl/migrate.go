@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ccbrown/keyvaluestore/cmd/internal/backendflags"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreexport"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoremigrate"
+)
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	sourceFlags := backendflags.Add(fs, "source-")
+	destFlags := backendflags.Add(fs, "dest-")
+	concurrency := fs.Int("concurrency", 1, "the number of keys to write concurrently")
+	pageSize := fs.Int("page-size", keyvaluestoreexport.DefaultPageSize, "the number of entries to scan at a time")
+	verifyOnly := fs.Bool("verify-only", false, "skip the copy and only verify the destination")
+	fs.Parse(args)
+
+	source, err := sourceFlags.Backend()
+	if err != nil {
+		return fmt.Errorf("source: %v", err)
+	}
+	defer source.Close()
+	dest, err := destFlags.Backend()
+	if err != nil {
+		return fmt.Errorf("destination: %v", err)
+	}
+	defer dest.Close()
+
+	// Writes made by other processes can't be tracked from here, so live migrations need to use
+	// the keyvaluestoremigrate package directly.
+	m := &keyvaluestoremigrate.Migration{
+		Source:      source,
+		Destination: dest,
+		Concurrency: *concurrency,
+		PageSize:    *pageSize,
+	}
+
+	if !*verifyOnly {
+		n, err := m.Copy()
+		fmt.Fprintf(os.Stderr, "copied %v entries\n", n)
+		if err != nil {
+			return err
+		}
+	}
+
+	verification, err := m.Verify()
+	if err != nil {
+		return err
+	}
+	for _, mismatch := range verification.Mismatches {
+		fmt.Println(mismatch)
+	}
+	fmt.Fprintf(os.Stderr, "verified %v keys, found %v mismatches\n", verification.Checked, len(verification.Mismatches))
+	if len(verification.Mismatches) > 0 {
+		return fmt.Errorf("verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/cmd/internal/backendflags"
+)
+
+func runShell(args []string) error {
+	fs := flag.NewFlagSet("shell", flag.ExitOnError)
+	backendFlags := backendflags.Add(fs, "")
+	fs.Parse(args)
+
+	b, err := backendFlags.Backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		// Read commands from a script or pipe.
+		s := newShell(b, os.Stdout)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if s.exec(scanner.Text()) {
+				break
+			}
+		}
+		return scanner.Err()
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "kvs> ")
+	if width, height, err := term.GetSize(fd); err == nil {
+		t.SetSize(width, height)
+	}
+
+	s := newShell(b, t)
+	t.AutoCompleteCallback = s.complete
+	fmt.Fprintln(t, `type "help" for a list of commands`)
+	for {
+		line, err := t.ReadLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if s.exec(line) {
+			return nil
+		}
+	}
+}
+
+// shellExcludedMethods are the backend methods that can't be invoked from the shell.
+var shellExcludedMethods = map[string]bool{
+	"AtomicWrite":                   true,
+	"Batch":                         true,
+	"Unwrap":                        true,
+	"WithEventuallyConsistentReads": true,
+	"WithProfiler":                  true,
+}
+
+var shellBuiltins = []string{"exit", "help", "history"}
+
+// shell executes commands against a backend. Each command is the name of a backend method,
+// case-insensitive, followed by its arguments.
+type shell struct {
+	backend    keyvaluestore.Backend
+	out        io.Writer
+	history    []string
+	operations map[string]reflect.Method
+}
+
+func newShell(b keyvaluestore.Backend, out io.Writer) *shell {
+	s := &shell{
+		backend:    b,
+		out:        out,
+		operations: map[string]reflect.Method{},
+	}
+	backendType := reflect.TypeOf((*keyvaluestore.Backend)(nil)).Elem()
+	for i := 0; i < backendType.NumMethod(); i++ {
+		if method := backendType.Method(i); !shellExcludedMethods[method.Name] {
+			s.operations[strings.ToLower(method.Name)] = method
+		}
+	}
+	return s
+}
+
+// commands returns the names of all operations and builtins in sorted order.
+func (s *shell) commands() []string {
+	var ret []string
+	for _, method := range s.operations {
+		ret = append(ret, method.Name)
+	}
+	ret = append(ret, shellBuiltins...)
+	sort.Strings(ret)
+	return ret
+}
+
+// complete completes command names when tab is pressed.
+func (s *shell) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || strings.ContainsAny(line[:pos], " \t") {
+		return "", 0, false
+	}
+	prefix := strings.ToLower(line[:pos])
+	var matches []string
+	for _, command := range s.commands() {
+		if strings.HasPrefix(strings.ToLower(command), prefix) {
+			matches = append(matches, command)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	} else if len(matches) == 1 {
+		completion := matches[0] + " "
+		return completion + line[pos:], len(completion), true
+	}
+
+	// Complete as much as the matches have in common.
+	common := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(strings.ToLower(match), strings.ToLower(common)) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(common) <= pos {
+		return "", 0, false
+	}
+	return common + line[pos:], len(common), true
+}
+
+// exec executes a line and writes its output. It returns true if the shell should exit.
+func (s *shell) exec(line string) bool {
+	args, err := splitShellArgs(line)
+	if err != nil {
+		fmt.Fprintf(s.out, "error: %v\n", err)
+		return false
+	} else if len(args) == 0 {
+		return false
+	}
+	s.history = append(s.history, line)
+
+	switch name := strings.ToLower(args[0]); name {
+	case "exit", "quit":
+		return true
+	case "help":
+		for _, command := range s.commands() {
+			if method, ok := s.operations[strings.ToLower(command)]; ok {
+				fmt.Fprintf(s.out, "%v %v\n", command, shellUsage(method.Type))
+			} else {
+				fmt.Fprintln(s.out, command)
+			}
+		}
+	case "history":
+		for i, line := range s.history {
+			fmt.Fprintf(s.out, "%5d  %v\n", i+1, line)
+		}
+	default:
+		method, ok := s.operations[name]
+		if !ok {
+			fmt.Fprintf(s.out, "error: unknown command: %v\n", args[0])
+			return false
+		}
+		results, err := s.call(method, args[1:])
+		if err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+			return false
+		}
+		if name == "smembers" && len(results) == 1 {
+			// Sets are unordered, so they're sorted to make the output stable.
+			members := append([]string(nil), results[0].Interface().([]string)...)
+			sort.Strings(members)
+			results[0] = reflect.ValueOf(members)
+		}
+		for _, result := range results {
+			fmt.Fprintln(s.out, formatShellResult(result))
+		}
+	}
+	return false
+}
+
+func (s *shell) call(method reflect.Method, args []string) ([]reflect.Value, error) {
+	methodType := method.Type
+	numFixed := methodType.NumIn()
+	if methodType.IsVariadic() {
+		numFixed--
+	}
+	if len(args) < numFixed || (!methodType.IsVariadic() && len(args) > numFixed) {
+		return nil, fmt.Errorf("usage: %v %v", method.Name, shellUsage(methodType))
+	}
+
+	var in []reflect.Value
+	for i := 0; i < numFixed; i++ {
+		v, err := parseShellArg(args[i], methodType.In(i))
+		if err != nil {
+			return nil, fmt.Errorf("argument %v: %v", i+1, err)
+		}
+		in = append(in, v)
+	}
+	if methodType.IsVariadic() {
+		elemType := methodType.In(numFixed).Elem()
+		rest := args[numFixed:]
+		if elemType == reflect.TypeOf(keyvaluestore.KeyValue{}) {
+			if len(rest)%2 != 0 {
+				return nil, fmt.Errorf("additional fields must be given as field value pairs")
+			}
+			for i := 0; i < len(rest); i += 2 {
+				in = append(in, reflect.ValueOf(keyvaluestore.KeyValue{Key: rest[i], Value: rest[i+1]}))
+			}
+		} else {
+			for i, arg := range rest {
+				v, err := parseShellArg(arg, elemType)
+				if err != nil {
+					return nil, fmt.Errorf("argument %v: %v", numFixed+i+1, err)
+				}
+				in = append(in, v)
+			}
+		}
+	}
+
+	results := reflect.ValueOf(s.backend).MethodByName(method.Name).Call(in)
+	if err, _ := results[len(results)-1].Interface().(error); err != nil {
+		return nil, err
+	}
+	return results[:len(results)-1], nil
+}
+
+func shellUsage(methodType reflect.Type) string {
+	var params []string
+	for i := 0; i < methodType.NumIn(); i++ {
+		t := methodType.In(i)
+		variadic := methodType.IsVariadic() && i == methodType.NumIn()-1
+		if variadic {
+			t = t.Elem()
+		}
+		var param string
+		switch {
+		case t == reflect.TypeOf(keyvaluestore.KeyValue{}):
+			param = "<field> <value>"
+		case t.Kind() == reflect.Float64:
+			param = "<number>"
+		case t.Kind() == reflect.Int || t.Kind() == reflect.Int64:
+			param = "<integer>"
+		default:
+			param = "<string>"
+		}
+		if variadic {
+			param = "[" + param + "...]"
+		}
+		params = append(params, param)
+	}
+	return strings.Join(params, " ")
+}
+
+func parseShellArg(arg string, t reflect.Type) (reflect.Value, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(arg).Convert(t), nil
+	case reflect.Interface:
+		v := reflect.New(t).Elem()
+		v.Set(reflect.ValueOf(arg))
+		return v, nil
+	case reflect.Float64:
+		// ParseFloat accepts "inf", "+inf", and "-inf".
+		f, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid number: %v", arg)
+		}
+		return reflect.ValueOf(f), nil
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid integer: %v", arg)
+		}
+		return reflect.ValueOf(n).Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported argument type: %v", t)
+}
+
+func formatShellResult(v reflect.Value) string {
+	switch v := v.Interface().(type) {
+	case *string:
+		if v == nil {
+			return "(nil)"
+		}
+		return strconv.Quote(*v)
+	case *float64:
+		if v == nil {
+			return "(nil)"
+		}
+		return strconv.FormatFloat(*v, 'g', -1, 64)
+	case []string:
+		if len(v) == 0 {
+			return "(empty)"
+		}
+		lines := make([]string, len(v))
+		for i, s := range v {
+			lines[i] = fmt.Sprintf("%v) %q", i+1, s)
+		}
+		return strings.Join(lines, "\n")
+	case map[string]string:
+		if len(v) == 0 {
+			return "(empty)"
+		}
+		fields := make([]string, 0, len(v))
+		for field := range v {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		lines := make([]string, len(fields))
+		for i, field := range fields {
+			lines[i] = fmt.Sprintf("%q: %q", field, v[field])
+		}
+		return strings.Join(lines, "\n")
+	case keyvaluestore.ScoredMembers:
+		if len(v) == 0 {
+			return "(empty)"
+		}
+		lines := make([]string, len(v))
+		for i, member := range v {
+			lines[i] = fmt.Sprintf("%v) %q (%v)", i+1, member.Value, strconv.FormatFloat(member.Score, 'g', -1, 64))
+		}
+		return strings.Join(lines, "\n")
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// splitShellArgs splits a line into whitespace-separated arguments. Arguments may be given as
+// double-quoted Go string literals to include whitespace or escape sequences.
+func splitShellArgs(line string) ([]string, error) {
+	var args []string
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return args, nil
+		}
+
+		if line[0] != '"' {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			args = append(args, line[:end])
+			line = line[end:]
+			continue
+		}
+
+		end := 1
+		for ; end < len(line) && line[end] != '"'; end++ {
+			if line[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(line) {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		arg, err := strconv.Unquote(line[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid string: %v", line[:end+1])
+		}
+		args = append(args, arg)
+		line = line[end+1:]
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestShell(t *testing.T) {
+	var out bytes.Buffer
+	s := newShell(memorystore.NewBackend(), &out)
+
+	for _, tc := range []struct {
+		Line   string
+		Output string
+	}{
+		{`set foo "bar baz"`, ""},
+		{`GET foo`, "\"bar baz\"\n"},
+		{`get missing`, "(nil)\n"},
+		{`zadd z a 1`, ""},
+		{`zadd z b +inf`, ""},
+		{`zrangebyscorewithscores z -inf inf 0`, "1) \"a\" (1)\n2) \"b\" (+Inf)\n"},
+		{`hset h a 1 b 2`, ""},
+		{`hgetall h`, "\"a\": \"1\"\n\"b\": \"2\"\n"},
+		{`sadd s x y`, ""},
+		{`smembers s`, "1) \"x\"\n2) \"y\"\n"},
+		{`nincrby n 5`, "5\n"},
+		{`setnx foo x`, "false\n"},
+		{`get`, "error: usage: Get <string>\n"},
+		{`zadd z a x`, "error: argument 3: invalid number: x\n"},
+		{`nope`, "error: unknown command: nope\n"},
+		{`get "foo`, "error: unterminated string\n"},
+	} {
+		out.Reset()
+		assert.False(t, s.exec(tc.Line))
+		assert.Equal(t, tc.Output, out.String(), tc.Line)
+	}
+
+	out.Reset()
+	s.exec("history")
+	assert.Contains(t, out.String(), "    1  set foo \"bar baz\"\n")
+
+	assert.True(t, s.exec("exit"))
+}
+
+func TestShellComplete(t *testing.T) {
+	s := newShell(memorystore.NewBackend(), &bytes.Buffer{})
+
+	line, pos, ok := s.complete("hgeta", 5, '\t')
+	require.True(t, ok)
+	assert.Equal(t, "HGetAll ", line)
+	assert.Equal(t, 8, pos)
+
+	line, pos, ok = s.complete("zrevrangebyl", 12, '\t')
+	require.True(t, ok)
+	assert.Equal(t, "ZRevRangeByLex ", line)
+	assert.Equal(t, 15, pos)
+
+	// Ambiguous prefixes are completed as far as possible.
+	line, pos, ok = s.complete("zhrev", 5, '\t')
+	require.True(t, ok)
+	assert.Equal(t, "ZHRevRangeBy", line)
+	assert.Equal(t, 12, pos)
+	_, _, ok = s.complete("zhr", 3, '\t')
+	assert.False(t, ok)
+
+	_, _, ok = s.complete("get foo", 7, '\t')
+	assert.False(t, ok)
+	_, _, ok = s.complete("g", 1, 'x')
+	assert.False(t, ok)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/ccbrown/keyvaluestore/internal/sortkey"
+)
+
+// decodeSortKeyArg decodes a sort key given on the command line in the given format.
+func decodeSortKeyArg(arg, format string) (string, error) {
+	switch format {
+	case "base64":
+		buf, err := base64.StdEncoding.DecodeString(arg)
+		return string(buf), err
+	case "hex":
+		buf, err := hex.DecodeString(arg)
+		return string(buf), err
+	case "raw":
+		return arg, nil
+	}
+	return "", fmt.Errorf("unknown format: %v", format)
+}
+
+func runSortKey(args []string) error {
+	fs := flag.NewFlagSet("sortkey", flag.ExitOnError)
+	format := fs.String("format", "base64", "the format of the arguments: base64, hex, or raw")
+	encode := fs.Bool("encode", false, "encode the given scores instead of decoding sort keys")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: kvsctl sortkey [flags] <rk2>...\n\nDecodes DynamoDB rk2 values into scores and fields.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	for _, arg := range fs.Args() {
+		if *encode {
+			score, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return err
+			}
+			key := sortkey.Float(score)
+			switch *format {
+			case "base64":
+				fmt.Println(base64.StdEncoding.EncodeToString([]byte(key)))
+			case "hex":
+				fmt.Println(hex.EncodeToString([]byte(key)))
+			default:
+				return fmt.Errorf("unsupported format for encoding: %v", *format)
+			}
+			continue
+		}
+
+		key, err := decodeSortKeyArg(arg, *format)
+		if err != nil {
+			return fmt.Errorf("%v: %v", arg, err)
+		} else if len(key) < sortkey.FloatSize {
+			return fmt.Errorf("%v: sort key is too short", arg)
+		}
+		fmt.Printf("%v\t%q\n", sortkey.ParseFloat(key), key[sortkey.FloatSize:])
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package dynamodbstore
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/internal/sortkey"
+)
+
+// ApproximateCountSegments is the number of segments that ZCountApprox divides a score range into.
+const ApproximateCountSegments = 8
+
+// ApproximateCountSampleSize is the number of members that ZCountApprox reads from each segment
+// before extrapolating.
+const ApproximateCountSampleSize = 250
+
+var _ keyvaluestore.ApproximateCounter = &Backend{}
+
+// ZCountApprox estimates the number of members with scores between min and max by sampling.
+//
+// The range between the lowest and highest scores actually in the set is divided into
+// ApproximateCountSegments segments of equal width. Up to ApproximateCountSampleSize members are
+// counted in each segment, and if a segment has more, its count is extrapolated from the portion of
+// its scores that were covered. So the result is exact when no segment has more than
+// ApproximateCountSampleSize members, and the cost is bounded by roughly ApproximateCountSegments *
+// ApproximateCountSampleSize reads regardless of the size of the range. Beyond that, the error
+// depends on how evenly scores are distributed within each segment. Uniform scores like timestamps
+// of steady traffic estimate well. Heavily clustered scores may be off by a large factor.
+//
+// If all of the members in the range have the same score, or the range contains infinite scores,
+// the members are counted exactly.
+func (b *Backend) ZCountApprox(key string, min, max float64) (int, error) {
+	first, err := b.zRangeByScoreWithScores(key, min, max, 1)
+	if err != nil || len(first) == 0 {
+		return 0, err
+	}
+	last, err := b.zRevRangeByScoreWithScores(key, min, max, 1)
+	if err != nil || len(last) == 0 {
+		return 0, err
+	}
+
+	lo, hi := first[0].Score, last[0].Score
+	if lo >= hi || math.IsInf(lo, 0) || math.IsInf(hi, 0) || math.IsInf(hi-lo, 0) {
+		return b.ZCount(key, min, max)
+	}
+
+	width := (hi - lo) / ApproximateCountSegments
+	total := 0.0
+	for i := 0; i < ApproximateCountSegments; i++ {
+		segmentMin := lo + width*float64(i)
+		segmentMax := lo + width*float64(i+1)
+		maxSortKey := "[" + sortkey.Float(segmentMax)
+		if i == ApproximateCountSegments-1 {
+			segmentMax = hi
+			maxSortKey = "[" + sortkey.FloatAfter(hi)
+		}
+		n, err := b.zCountSample(key, segmentMin, segmentMax, "["+sortkey.Float(segmentMin), maxSortKey)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return int(math.Round(total)), nil
+}
+
+// zCountSample counts the members between the given sort keys, which span the scores between min and
+// max. Once ApproximateCountSampleSize members have been read, the count is extrapolated.
+func (b *Backend) zCountSample(key string, min, max float64, minSortKey, maxSortKey string) (float64, error) {
+	condition, attributeValues := queryCondition(key, minSortKey, maxSortKey, true)
+	if condition == "" {
+		return 0, nil
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                 b.tableName(),
+		IndexName:                 aws.String("rk2"),
+		ConsistentRead:            b.consistentRead(),
+		KeyConditionExpression:    aws.String(condition),
+		ExpressionAttributeValues: attributeValues,
+		Select:                    aws.String(dynamodb.SelectCount),
+		Limit:                     aws.Int64(ApproximateCountSampleSize),
+	}
+
+	count := 0
+	for {
+		result, err := b.Client.Query(input)
+		if err != nil {
+			return 0, wrapError(err, "dynamodb query request error")
+		}
+		if result.Count == nil {
+			return 0, fmt.Errorf("no count returned by dynamodb query")
+		}
+		count += int(*result.Count)
+		if len(result.LastEvaluatedKey) == 0 {
+			return float64(count), nil
+		}
+		if rk2 := attributeStringValue(result.LastEvaluatedKey["rk2"]); rk2 != nil {
+			// If every member read so far has the segment's minimum score, there's nothing to
+			// extrapolate from yet, so keep reading.
+			if score := sortkey.ParseFloat(*rk2); score > min {
+				return float64(count) * (max - min) / (score - min), nil
+			}
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
@@ -13,13 +13,15 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/internal/sortkey"
 )
 
 type AtomicWriteOperation struct {
 	Backend *Backend
 
-	items   []*dynamodb.TransactWriteItem
-	results []*atomicWriteResult
+	items            []*dynamodb.TransactWriteItem
+	results          []*atomicWriteResult
+	idempotencyToken string
 }
 
 type atomicWriteResult struct {
@@ -73,12 +75,11 @@ func (op *AtomicWriteOperation) SetXX(key string, value interface{}) keyvaluesto
 }
 
 func (op *AtomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
+	condition, values := valueEqualsCondition(oldValue)
 	return op.write(dynamodb.TransactWriteItem{
 		Put: &dynamodb.Put{
-			ConditionExpression: aws.String("v = :v"),
-			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-				":v": attributeValue(oldValue),
-			},
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeValues: values,
 			Item: newItem(key, "_", map[string]*dynamodb.AttributeValue{
 				"v": attributeValue(value),
 			}),
@@ -131,12 +132,16 @@ func (op *AtomicWriteOperation) ZHAdd(key, field string, member interface{}, sco
 			TableName: &op.Backend.TableName,
 			Item: newItem(key, field, map[string]*dynamodb.AttributeValue{
 				"v":   attributeValue(s),
-				"rk2": attributeValue(floatSortKey(score) + field),
+				"rk2": attributeValue(sortkey.Float(score) + field),
 			}),
 		},
 	})
 }
 
+func (op *AtomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	return keyvaluestore.ZHMAddEach(op, key, entries)
+}
+
 func (op *AtomicWriteOperation) ZAddNX(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
 	s := *keyvaluestore.ToString(member)
 	return op.write(dynamodb.TransactWriteItem{
@@ -145,7 +150,24 @@ func (op *AtomicWriteOperation) ZAddNX(key string, member interface{}, score flo
 			ConditionExpression: aws.String("attribute_not_exists(v)"),
 			Item: newItem(key, s, map[string]*dynamodb.AttributeValue{
 				"v":   attributeValue(s),
-				"rk2": attributeValue(floatSortKey(score) + s),
+				"rk2": attributeValue(sortkey.Float(score) + s),
+			}),
+		},
+	})
+}
+
+func (op *AtomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	s := *keyvaluestore.ToString(member)
+	return op.write(dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName:           &op.Backend.TableName,
+			ConditionExpression: aws.String("v = :v"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":v": attributeValue(*keyvaluestore.ToString(oldMember)),
+			},
+			Item: newItem(key, field, map[string]*dynamodb.AttributeValue{
+				"v":   attributeValue(s),
+				"rk2": attributeValue(sortkey.Float(score) + field),
 			}),
 		},
 	})
@@ -165,6 +187,19 @@ func (op *AtomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWri
 	})
 }
 
+func (op *AtomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	return op.write(dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			TableName:           &op.Backend.TableName,
+			Key:                 compositeKey(key, field),
+			ConditionExpression: aws.String("v = :v"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":v": attributeValue(*keyvaluestore.ToString(member)),
+			},
+		},
+	})
+}
+
 func (op *AtomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
 	return op.write(dynamodb.TransactWriteItem{
 		Update: &dynamodb.Update{
@@ -263,15 +298,78 @@ func (op *AtomicWriteOperation) HDel(key, field string, fields ...string) keyval
 	})
 }
 
+// WithIdempotencyToken uses the token as the transaction's client request token. DynamoDB returns an
+// error if the token is reused for a different transaction.
+func (op *AtomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.idempotencyToken = token
+	return op
+}
+
+// DynamoDB limits the sizes of partition and sort keys.
+const (
+	maxHashKeySize  = MaxKeySize
+	maxRangeKeySize = 1024
+)
+
+func transactWriteItemKey(item *dynamodb.TransactWriteItem) map[string]*dynamodb.AttributeValue {
+	switch {
+	case item.Put != nil:
+		return item.Put.Item
+	case item.Update != nil:
+		return item.Update.Key
+	case item.Delete != nil:
+		return item.Delete.Key
+	case item.ConditionCheck != nil:
+		return item.ConditionCheck.Key
+	}
+	return nil
+}
+
+// Validate checks the operation count, token length, and key sizes. It also verifies that no two
+// operations target the same item since DynamoDB rejects such transactions. For example, ZAdd and
+// ZRem of the same member can't be combined.
+func (op *AtomicWriteOperation) Validate() error {
+	if len(op.items) > keyvaluestore.MaxAtomicWriteOperations {
+		return errors.New("max operation count exceeded")
+	} else if len(op.idempotencyToken) > keyvaluestore.MaxIdempotencyTokenLength {
+		return errors.New("idempotency token too long")
+	}
+	items := make(map[string]struct{}, len(op.items))
+	for _, item := range op.items {
+		key := transactWriteItemKey(item)
+		if len(key["hk"].B) > maxHashKeySize || len(key["rk"].B) > maxRangeKeySize {
+			return &keyvaluestore.Error{
+				Kind: keyvaluestore.ErrValueTooLarge,
+				Err:  errors.New("key too large"),
+			}
+		}
+		combined := combineItemKeys(key)
+		if _, ok := items[combined]; ok {
+			return errors.New("multiple operations on the same item")
+		}
+		items[combined] = struct{}{}
+	}
+	return nil
+}
+
 func (op *AtomicWriteOperation) Exec() (bool, error) {
-	token := make([]byte, 20)
-	if _, err := rand.Read(token); err != nil {
-		return false, errors.Wrap(err, "unable to generate request token")
+	if err := op.Validate(); err != nil {
+		return false, err
+	}
+
+	token := op.idempotencyToken
+	if token == "" {
+		// Even without a token from the application, we can make our own retries idempotent.
+		b := make([]byte, 20)
+		if _, err := rand.Read(b); err != nil {
+			return false, errors.Wrap(err, "unable to generate request token")
+		}
+		token = base64.RawURLEncoding.EncodeToString(b)
 	}
 
 	input := &dynamodb.TransactWriteItemsInput{
 		TransactItems:      op.items,
-		ClientRequestToken: aws.String(base64.RawURLEncoding.EncodeToString(token)),
+		ClientRequestToken: aws.String(token),
 	}
 
 	attempts := 0
@@ -285,7 +383,10 @@ func (op *AtomicWriteOperation) Exec() (bool, error) {
 			// Internal errors tend to happen if the database was recently recreated. We should
 			// retry the request a few times.
 			attempts++
-			time.Sleep(time.Duration(attempts*attempts) * 100 * time.Millisecond)
+			op.Backend.warn("retrying dynamodb transaction after internal server error", "attempt", attempts, "error", err)
+			if err := op.Backend.sleep(time.Duration(attempts*attempts) * 100 * time.Millisecond); err != nil {
+				return false, err
+			}
 			continue
 		}
 
@@ -306,14 +407,16 @@ func (op *AtomicWriteOperation) Exec() (bool, error) {
 			}
 
 			if hasErr || !hasConditionalCheckFailed {
-				return false, &keyvaluestore.AtomicWriteConflictError{
-					Err: err,
+				conflict := &keyvaluestore.AtomicWriteConflictError{
+					Err: translateError(err),
 				}
+				op.Backend.profileConflict("AtomicWrite", "", conflict)
+				return false, conflict
 			}
 
 			return false, nil
 		default:
-			return false, err
+			return false, translateError(err)
 		}
 	}
 }
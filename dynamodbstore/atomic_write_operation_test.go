@@ -0,0 +1,37 @@
+package dynamodbstore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+func TestAtomicWriteValidate(t *testing.T) {
+	backend := &Backend{
+		Client:    nopBackendClient{},
+		TableName: "TestAtomicWriteValidate",
+	}
+
+	tx := backend.AtomicWrite()
+	tx.ZAdd("foo", "a", 1)
+	tx.ZAdd("foo", "b", 1)
+	tx.Set("foo", "bar")
+	assert.NoError(t, tx.Validate())
+
+	tx.ZRem("foo", "a")
+	assert.Error(t, tx.Validate())
+	_, err := tx.Exec()
+	assert.Error(t, err)
+
+	tx = backend.AtomicWrite()
+	tx.Set(strings.Repeat("x", maxHashKeySize+1), "bar")
+	assert.True(t, errors.Is(tx.Validate(), keyvaluestore.ErrValueTooLarge))
+
+	tx = backend.AtomicWrite()
+	tx.ZAdd("foo", strings.Repeat("x", maxRangeKeySize+1), 1)
+	assert.True(t, errors.Is(tx.Validate(), keyvaluestore.ErrValueTooLarge))
+}
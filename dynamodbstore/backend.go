@@ -1,13 +1,17 @@
 package dynamodbstore
 
 import (
+	"context"
 	"encoding"
 	"encoding/base64"
-	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"math"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -15,20 +19,98 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/internal/sortkey"
 )
 
+// MaxKeySize is the maximum size of a key in bytes. Longer keys can be hashed via
+// keyvaluestorenamespace.Backend's MaxKeyLength.
+const MaxKeySize = 2048
+
 type Backend struct {
 	Client                         BackendClient
 	TableName                      string
 	AllowEventuallyConsistentReads bool
+
+	// MaxQueryPages limits the number of pages a single range query such as ZRangeByLex may read.
+	// Unlimited ranges over huge keys can otherwise consume large amounts of read capacity. If
+	// zero, there's no limit.
+	MaxQueryPages int
+
+	// QueryTimeout limits the total time a single range query may take, including all of its
+	// pages. If zero, there's no limit. Individual requests are only canceled if the client
+	// supports contexts, as *dynamodb.DynamoDB does.
+	QueryTimeout time.Duration
+
+	// If PartialQueryResults is true, range queries that exceed MaxQueryPages or QueryTimeout
+	// return the members read so far along with the *QueryLimitError. Otherwise they only return
+	// the error.
+	PartialQueryResults bool
+
+	// ContentionRetryPolicy determines how operations such as ZIncrBy are retried when they fail
+	// due to contention. If nil, DefaultRetryPolicy is used.
+	ContentionRetryPolicy *RetryPolicy
+
+	// If non-nil, Logger is warned about conditions such as operations that exhaust their
+	// contention retries and batches whose items are repeatedly left unprocessed.
+	Logger keyvaluestore.Logger
+
+	// If ItemCollectionMetrics is true, writes made via WithProfiler request item collection
+	// metrics. The table's local secondary index limits the items of each key to 10GB, and writes
+	// to keys that exceed it fail, so large sorted sets should be monitored. The estimated sizes are
+	// reported via the profiler, and Logger is warned about keys that may have reached
+	// ItemCollectionSizeWarningGB, or DefaultItemCollectionSizeWarningGB if it's zero.
+	ItemCollectionMetrics       bool
+	ItemCollectionSizeWarningGB float64
+
+	// If non-nil, ScanLimiter paces scans, such as those of exports, so that they leave enough of
+	// the table's read capacity for the application.
+	ScanLimiter *ScanLimiter
+
+	// continuation is where the next range query starts. See WithContinuationToken.
+	continuation *continuation
+
+	// deadline is the time by which operations must complete. See keyvaluestore.RequestOptions.
+	deadline time.Time
+}
+
+func (b *Backend) warn(msg string, args ...interface{}) {
+	if b.Logger != nil {
+		b.Logger.Warn(msg, args...)
+	}
+}
+
+// checkDeadline returns an error if the backend's deadline has passed.
+func (b *Backend) checkDeadline() error {
+	if !b.deadline.IsZero() && !time.Now().Before(b.deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// sleep waits before a retry. If the backend's deadline would pass first, it returns an error
+// immediately instead.
+func (b *Backend) sleep(d time.Duration) error {
+	if !b.deadline.IsZero() && time.Now().Add(d).After(b.deadline) {
+		return context.DeadlineExceeded
+	}
+	time.Sleep(d)
+	return nil
 }
 
 func (b *Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	if p, ok := profiler.(keyvaluestore.Profiler); ok {
+		profiler = &unifiedProfiler{
+			profiler: p,
+		}
+	}
 	if p, ok := profiler.(Profiler); ok {
 		ret := *b
 		ret.Client = &ProfilingBackendClient{
-			Client:   b.Client,
-			Profiler: p,
+			Client:                      b.Client,
+			Profiler:                    p,
+			ItemCollectionMetrics:       b.ItemCollectionMetrics,
+			Logger:                      b.Logger,
+			ItemCollectionSizeWarningGB: b.ItemCollectionSizeWarningGB,
 		}
 		return &ret
 	}
@@ -44,6 +126,28 @@ func (b *Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
 	return &ret
 }
 
+// WithOptions supports consistency, timeouts, and deadlines. Timeouts and deadlines are only
+// enforced on individual requests if the client supports the SDK's WithContext methods, as
+// *dynamodb.DynamoDB does, but deadlines are always enforced between the requests and retries of an
+// operation.
+func (b *Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	ret := *b
+	switch opts.Consistency {
+	case keyvaluestore.EventualConsistency:
+		ret.AllowEventuallyConsistentReads = true
+	case keyvaluestore.StrongConsistency:
+		ret.AllowEventuallyConsistentReads = false
+	}
+	if opts.Timeout > 0 {
+		ret.Client = withTimeout(ret.Client, opts.Timeout)
+	}
+	if !opts.Deadline.IsZero() {
+		ret.Client = withDeadline(ret.Client, opts.Deadline)
+		ret.deadline = opts.Deadline
+	}
+	return &ret
+}
+
 func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
 	return &AtomicWriteOperation{
 		Backend: b,
@@ -66,13 +170,22 @@ func attributeValue(v interface{}) *dynamodb.AttributeValue {
 			B: []byte(v),
 		}
 	case string:
-		return attributeValue([]byte(v))
+		// This is the most common case, so it avoids boxing the converted value.
+		return &dynamodb.AttributeValue{
+			B: []byte(v),
+		}
 	case int:
 		return attributeValue(int64(v))
 	case int64:
 		return &dynamodb.AttributeValue{
 			N: aws.String(strconv.FormatInt(v, 10)),
 		}
+	case uint:
+		return attributeValue(uint64(v))
+	case uint64:
+		return &dynamodb.AttributeValue{
+			N: aws.String(strconv.FormatUint(v, 10)),
+		}
 	case encoding.BinaryMarshaler:
 		b, err := v.MarshalBinary()
 		if err != nil {
@@ -80,13 +193,17 @@ func attributeValue(v interface{}) *dynamodb.AttributeValue {
 		}
 		return attributeValue(b)
 	}
+	// Everything else is stored using the canonical string encoding.
+	if s := keyvaluestore.ToString(v); s != nil {
+		return attributeValue(*s)
+	}
 	panic(fmt.Sprintf("unsupported value type: %T", v))
 }
 
 func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
 	result, err := b.Client.UpdateItem(&dynamodb.UpdateItemInput{
 		Key:              compositeKey(key, "_"),
-		TableName:        aws.String(b.TableName),
+		TableName:        b.tableName(),
 		UpdateExpression: aws.String("ADD v :n"),
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":n": attributeValue(n),
@@ -94,7 +211,7 @@ func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
 		ReturnValues: aws.String(dynamodb.ReturnValueAllNew),
 	})
 	if err != nil {
-		return 0, errors.Wrap(err, "dynamodb update item request error")
+		return 0, wrapError(err, "dynamodb update item request error")
 	}
 	if v := result.Attributes["v"].N; v != nil {
 		return strconv.ParseInt(*v, 10, 64)
@@ -105,15 +222,49 @@ func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
 func (b *Backend) Delete(key string) (bool, error) {
 	result, err := b.Client.DeleteItem(&dynamodb.DeleteItemInput{
 		Key:          compositeKey(key, "_"),
-		TableName:    aws.String(b.TableName),
+		TableName:    b.tableName(),
 		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
 	})
 	if err != nil {
-		return false, errors.Wrap(err, "dynamodb delete item request error")
+		return false, wrapError(err, "dynamodb delete item request error")
 	}
 	return result.Attributes != nil, nil
 }
 
+// valueEqualsCondition returns a condition expression that's true if the "v" attribute holds the
+// given value. Integers are stored as numbers while everything else is stored as binary, so values
+// are compared via their canonical encodings, and an encoding that's also a canonical integer
+// matches either representation. This makes comparisons consistent with the other backends, e.g.
+// a value set as 10 is equal to "10".
+func valueEqualsCondition(v interface{}) (string, map[string]*dynamodb.AttributeValue) {
+	s := keyvaluestore.ToString(v)
+	if s == nil {
+		panic(fmt.Sprintf("unsupported value type: %T", v))
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":v": attributeValue(*s),
+	}
+	if !isCanonicalInteger(*s) {
+		return "v = :v", values
+	}
+	values[":vn"] = &dynamodb.AttributeValue{
+		N: aws.String(*s),
+	}
+	return "(v = :v OR v = :vn)", values
+}
+
+// isCanonicalInteger returns true if s is an integer in the form that ToString produces, which is
+// how integers are stored as numbers.
+func isCanonicalInteger(s string) bool {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return strconv.FormatInt(n, 10) == s
+	}
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return strconv.FormatUint(n, 10) == s
+	}
+	return false
+}
+
 func attributeStringValue(v *dynamodb.AttributeValue) *string {
 	if v != nil {
 		switch {
@@ -143,13 +294,15 @@ func attributeStringSliceValue(v *dynamodb.AttributeValue) []string {
 }
 
 func (b *Backend) Get(key string) (*string, error) {
+	k := acquireKey(key, "_")
+	defer k.release()
 	result, err := b.Client.GetItem(&dynamodb.GetItemInput{
-		Key:            compositeKey(key, "_"),
-		TableName:      aws.String(b.TableName),
-		ConsistentRead: aws.Bool(!b.AllowEventuallyConsistentReads),
+		Key:            k.attributes,
+		TableName:      b.tableName(),
+		ConsistentRead: b.consistentRead(),
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "dynamodb get item request error")
+		return nil, wrapError(err, "dynamodb get item request error")
 	}
 	if result.Item == nil || result.Item["v"] == nil {
 		return nil, nil
@@ -157,6 +310,54 @@ func (b *Backend) Get(key string) (*string, error) {
 	return attributeStringValue(result.Item["v"]), nil
 }
 
+// These are shared by requests instead of being allocated for each one.
+var (
+	trueValue  = aws.Bool(true)
+	falseValue = aws.Bool(false)
+)
+
+func (b *Backend) consistentRead() *bool {
+	if b.AllowEventuallyConsistentReads {
+		return falseValue
+	}
+	return trueValue
+}
+
+func (b *Backend) tableName() *string {
+	return &b.TableName
+}
+
+// pooledKey is a composite key that can be reused once the request it was given to has completed.
+// Reusing the map and buffers avoids several allocations per request.
+type pooledKey struct {
+	attributes map[string]*dynamodb.AttributeValue
+	hash, sort dynamodb.AttributeValue
+}
+
+var keyPool = sync.Pool{
+	New: func() interface{} {
+		k := &pooledKey{}
+		k.attributes = map[string]*dynamodb.AttributeValue{
+			"hk": &k.hash,
+			"rk": &k.sort,
+		}
+		return k
+	},
+}
+
+// acquireKey returns a composite key from the pool. It must only be used for requests that don't
+// retain it, and it should be released once the request completes.
+func acquireKey(hash, sort string) *pooledKey {
+	k := keyPool.Get().(*pooledKey)
+	k.hash.B = append(k.hash.B[:0], hash...)
+	k.sort.B = append(k.sort.B[:0], sort...)
+	return k
+}
+
+func (k *pooledKey) release() {
+	keyPool.Put(k)
+}
+
 func compositeKey(hash, sort string) map[string]*dynamodb.AttributeValue {
 	return map[string]*dynamodb.AttributeValue{
 		"hk": &dynamodb.AttributeValue{
@@ -169,21 +370,38 @@ func compositeKey(hash, sort string) map[string]*dynamodb.AttributeValue {
 }
 
 func newItem(key, sort string, attrs map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
-	item := compositeKey(key, sort)
+	item := make(map[string]*dynamodb.AttributeValue, 2+len(attrs))
+	item["hk"] = &dynamodb.AttributeValue{
+		B: []byte(key),
+	}
+	item["rk"] = &dynamodb.AttributeValue{
+		B: []byte(sort),
+	}
 	for name, attr := range attrs {
 		item[name] = attr
 	}
 	return item
 }
 
+// newValueItem is like newItem, but is cheaper for the common case of items with just a "v"
+// attribute. Additional attributes can be added to the result, such as "rk2" for sorted sets.
+func newValueItem(key, sort string, v *dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	attributes := make([]dynamodb.AttributeValue, 2)
+	attributes[0].B = []byte(key)
+	attributes[1].B = []byte(sort)
+	return map[string]*dynamodb.AttributeValue{
+		"hk": &attributes[0],
+		"rk": &attributes[1],
+		"v":  v,
+	}
+}
+
 func (b *Backend) Set(key string, value interface{}) error {
 	if _, err := b.Client.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String(b.TableName),
-		Item: newItem(key, "_", map[string]*dynamodb.AttributeValue{
-			"v": attributeValue(value),
-		}),
+		TableName: b.tableName(),
+		Item:      newValueItem(key, "_", attributeValue(value)),
 	}); err != nil {
-		return errors.Wrap(err, "dynamodb put item request error")
+		return wrapError(err, "dynamodb put item request error")
 	}
 	return nil
 }
@@ -200,21 +418,21 @@ func (b *Backend) setNX(key string, sortKey string, valueMap map[string]*dynamod
 	}
 
 	if _, err := b.Client.PutItem(&dynamodb.PutItemInput{
-		TableName:           aws.String(b.TableName),
+		TableName:           b.tableName(),
 		Item:                newItem(key, sortKey, valueMap),
 		ConditionExpression: aws.String(strings.Join(conditions, " and ")),
 	}); err != nil {
 		if err := err.(awserr.Error); err != nil && err.Code() == "ConditionalCheckFailedException" {
 			return false, nil
 		}
-		return false, errors.Wrap(err, "dynamodb put item request error")
+		return false, wrapError(err, "dynamodb put item request error")
 	}
 	return true, nil
 }
 
 func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
 	if _, err := b.Client.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String(b.TableName),
+		TableName: b.tableName(),
 		Item: newItem(key, "_", map[string]*dynamodb.AttributeValue{
 			"v": attributeValue(value),
 		}),
@@ -223,26 +441,25 @@ func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
 		if err := err.(awserr.Error); err != nil && err.Code() == "ConditionalCheckFailedException" {
 			return false, nil
 		}
-		return false, errors.Wrap(err, "dynamodb put item request error")
+		return false, wrapError(err, "dynamodb put item request error")
 	}
 	return true, nil
 }
 
 func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	condition, values := valueEqualsCondition(oldValue)
 	if _, err := b.Client.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String(b.TableName),
+		TableName: b.tableName(),
 		Item: newItem(key, "_", map[string]*dynamodb.AttributeValue{
 			"v": attributeValue(value),
 		}),
-		ConditionExpression: aws.String("v = :v"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":v": attributeValue(oldValue),
-		},
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
 	}); err != nil {
 		if err := err.(awserr.Error); err != nil && err.Code() == "ConditionalCheckFailedException" {
 			return false, nil
 		}
-		return false, errors.Wrap(err, "dynamodb put item request error")
+		return false, wrapError(err, "dynamodb put item request error")
 	}
 	return true, nil
 }
@@ -259,7 +476,7 @@ func serializeSMembers(member interface{}, members ...interface{}) [][]byte {
 func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
 	if _, err := b.Client.UpdateItem(&dynamodb.UpdateItemInput{
 		Key:              compositeKey(key, "_"),
-		TableName:        aws.String(b.TableName),
+		TableName:        b.tableName(),
 		UpdateExpression: aws.String("ADD v :v"),
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":v": &dynamodb.AttributeValue{
@@ -267,7 +484,7 @@ func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) e
 			},
 		},
 	}); err != nil {
-		return errors.Wrap(err, "dynamodb update item request error")
+		return wrapError(err, "dynamodb update item request error")
 	}
 	return nil
 }
@@ -275,7 +492,7 @@ func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) e
 func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
 	if _, err := b.Client.UpdateItem(&dynamodb.UpdateItemInput{
 		Key:              compositeKey(key, "_"),
-		TableName:        aws.String(b.TableName),
+		TableName:        b.tableName(),
 		UpdateExpression: aws.String("DELETE v :v"),
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":v": &dynamodb.AttributeValue{
@@ -283,7 +500,7 @@ func (b *Backend) SRem(key string, member interface{}, members ...interface{}) e
 			},
 		},
 	}); err != nil {
-		return errors.Wrap(err, "dynamodb update item request error")
+		return wrapError(err, "dynamodb update item request error")
 	}
 	return nil
 }
@@ -291,11 +508,11 @@ func (b *Backend) SRem(key string, member interface{}, members ...interface{}) e
 func (b *Backend) SMembers(key string) ([]string, error) {
 	result, err := b.Client.GetItem(&dynamodb.GetItemInput{
 		Key:            compositeKey(key, "_"),
-		TableName:      aws.String(b.TableName),
-		ConsistentRead: aws.Bool(!b.AllowEventuallyConsistentReads),
+		TableName:      b.tableName(),
+		ConsistentRead: b.consistentRead(),
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "dynamodb get item request error")
+		return nil, wrapError(err, "dynamodb get item request error")
 	}
 	if result.Item == nil || result.Item["v"] == nil {
 		return nil, nil
@@ -335,12 +552,12 @@ func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvalues
 	}
 	if _, err := b.Client.UpdateItem(&dynamodb.UpdateItemInput{
 		Key:                       compositeKey(key, "_"),
-		TableName:                 aws.String(b.TableName),
+		TableName:                 b.tableName(),
 		UpdateExpression:          aws.String("SET " + strings.Join(assignments, ", ")),
 		ExpressionAttributeNames:  names,
 		ExpressionAttributeValues: values,
 	}); err != nil {
-		return errors.Wrap(err, "dynamodb update item request error")
+		return wrapError(err, "dynamodb update item request error")
 	}
 	return nil
 }
@@ -357,28 +574,30 @@ func (b *Backend) HDel(key, field string, fields ...string) error {
 	}
 	if _, err := b.Client.UpdateItem(&dynamodb.UpdateItemInput{
 		Key:                      compositeKey(key, "_"),
-		TableName:                aws.String(b.TableName),
+		TableName:                b.tableName(),
 		UpdateExpression:         aws.String("REMOVE " + strings.Join(placeholders, ", ")),
 		ExpressionAttributeNames: names,
 	}); err != nil {
-		return errors.Wrap(err, "dynamodb update item request error")
+		return wrapError(err, "dynamodb update item request error")
 	}
 	return nil
 }
 
 func (b *Backend) HGet(key, field string) (*string, error) {
 	attributeName := encodeHashFieldName(field)
+	k := acquireKey(key, "_")
+	defer k.release()
 	result, err := b.Client.GetItem(&dynamodb.GetItemInput{
-		Key:                  compositeKey(key, "_"),
-		TableName:            aws.String(b.TableName),
+		Key:                  k.attributes,
+		TableName:            b.tableName(),
 		ProjectionExpression: aws.String("#n"),
 		ExpressionAttributeNames: map[string]*string{
 			"#n": &attributeName,
 		},
-		ConsistentRead: aws.Bool(!b.AllowEventuallyConsistentReads),
+		ConsistentRead: b.consistentRead(),
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "dynamodb get item request error")
+		return nil, wrapError(err, "dynamodb get item request error")
 	}
 	if result.Item == nil || result.Item[attributeName] == nil {
 		return nil, nil
@@ -387,13 +606,15 @@ func (b *Backend) HGet(key, field string) (*string, error) {
 }
 
 func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	k := acquireKey(key, "_")
+	defer k.release()
 	result, err := b.Client.GetItem(&dynamodb.GetItemInput{
-		Key:            compositeKey(key, "_"),
-		TableName:      aws.String(b.TableName),
-		ConsistentRead: aws.Bool(!b.AllowEventuallyConsistentReads),
+		Key:            k.attributes,
+		TableName:      b.tableName(),
+		ConsistentRead: b.consistentRead(),
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "dynamodb get item request error")
+		return nil, wrapError(err, "dynamodb get item request error")
 	}
 	if result.Item == nil {
 		return nil, nil
@@ -406,50 +627,22 @@ func (b *Backend) HGetAll(key string) (map[string]string, error) {
 			}
 		}
 	}
-	return ret, nil
-}
-
-const floatSortKeyNumBytes = 8
-
-func floatSortKey(f float64) string {
-	n := math.Float64bits(f)
-	if (n & (1 << 63)) != 0 {
-		n ^= 0xffffffffffffffff
-	} else {
-		n ^= 0x8000000000000000
-	}
-	buf := make([]byte, floatSortKeyNumBytes)
-	binary.BigEndian.PutUint64(buf, n)
-	return string(buf)
-}
-
-func sortKeyFloat(key string) float64 {
-	if len(key) < floatSortKeyNumBytes {
-		return 0
-	}
-	n := binary.BigEndian.Uint64([]byte(key))
-	if (n & (1 << 63)) == 0 {
-		n ^= 0xffffffffffffffff
-	} else {
-		n ^= 0x8000000000000000
+	if len(ret) == 0 {
+		// The item remains after all of its fields are deleted.
+		return nil, nil
 	}
-	return math.Float64frombits(n)
+	return ret, nil
 }
 
-func floatSortKeyAfter(f float64) string {
-	n := math.Float64bits(f)
-	if (n & (1 << 63)) != 0 {
-		n ^= 0xffffffffffffffff
-	} else {
-		n ^= 0x8000000000000000
-	}
-	n++
-	if n == 0 {
-		return ""
+// newSortedItem returns the item for a sorted hash member.
+func newSortedItem(key, field, member string, score float64) map[string]*dynamodb.AttributeValue {
+	item := newValueItem(key, field, attributeValue(member))
+	rk2 := make([]byte, sortkey.FloatSize, sortkey.FloatSize+len(field))
+	sortkey.PutFloat(rk2, score)
+	item["rk2"] = &dynamodb.AttributeValue{
+		B: append(rk2, field...),
 	}
-	buf := make([]byte, 8)
-	binary.BigEndian.PutUint64(buf, n)
-	return string(buf)
+	return item
 }
 
 func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
@@ -458,32 +651,42 @@ func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
 }
 
 func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
-	s := *keyvaluestore.ToString(member)
 	if _, err := b.Client.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String(b.TableName),
-		Item: newItem(key, field, map[string]*dynamodb.AttributeValue{
-			"v":   attributeValue(s),
-			"rk2": attributeValue(floatSortKey(score) + field),
-		}),
+		TableName: b.tableName(),
+		Item:      newSortedItem(key, field, *keyvaluestore.ToString(member), score),
 	}); err != nil {
-		return errors.Wrap(err, "dynamodb put item request error")
+		return wrapError(err, "dynamodb put item request error")
+	}
+	return nil
+}
+
+// ZHMAdd writes the entries using batch writes, which can each contain up to 25 entries.
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	batch := b.Batch()
+	result := batch.ZHMAdd(key, entries)
+	if err := batch.Exec(); err != nil {
+		if err := result.Result(); err != nil {
+			return err
+		}
+		return err
 	}
 	return nil
 }
 
 func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
-	s := *keyvaluestore.ToString(member)
+	k := acquireKey(key, *keyvaluestore.ToString(member))
+	defer k.release()
 	result, err := b.Client.GetItem(&dynamodb.GetItemInput{
-		Key:            compositeKey(key, s),
-		TableName:      aws.String(b.TableName),
-		ConsistentRead: aws.Bool(!b.AllowEventuallyConsistentReads),
+		Key:            k.attributes,
+		TableName:      b.tableName(),
+		ConsistentRead: b.consistentRead(),
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "dynamodb get item request error")
+		return nil, wrapError(err, "dynamodb get item request error")
 	}
 	if result.Item != nil {
 		if rk2 := attributeStringValue(result.Item["rk2"]); rk2 != nil {
-			score := sortKeyFloat(*rk2)
+			score := sortkey.ParseFloat(*rk2)
 			return &score, nil
 		}
 	}
@@ -493,26 +696,24 @@ func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
 func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
 	var retValue float64
 
-	err := runContentiousMethod(func() (bool, error) {
-		var newValue float64
+	s := *keyvaluestore.ToString(member)
 
-		s := *keyvaluestore.ToString(member)
+	err := b.runContentiousMethod("ZIncrBy", key, func() (bool, error) {
+		var newValue float64
 
 		success, err := b.checkAndSet(key, s, "rk2", func(prev *string) (interface{}, error) {
 			if prev != nil {
-				floatValue := sortKeyFloat(*prev)
+				floatValue := sortkey.ParseFloat(*prev)
 				newValue = floatValue + n
 			} else {
 				newValue = n
 			}
 
-			return floatSortKey(newValue) + s, nil
+			return sortkey.Float(newValue) + s, nil
 		}, map[string]interface{}{"v": s})
 
-		if err != nil {
+		if !success || err != nil {
 			return false, err
-		} else if !success {
-			return false, fmt.Errorf("unable to increment due to contention")
 		}
 
 		retValue = newValue
@@ -533,20 +734,37 @@ func (b *Backend) ZRem(key string, member interface{}) error {
 
 func (b *Backend) ZHRem(key, field string) error {
 	if _, err := b.Client.DeleteItem(&dynamodb.DeleteItemInput{
-		TableName: aws.String(b.TableName),
+		TableName: b.tableName(),
 		Key:       compositeKey(key, field),
 	}); err != nil {
-		return errors.Wrap(err, "dynamodb delete item request error")
+		return wrapError(err, "dynamodb delete item request error")
 	}
 	return nil
 }
 
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	if _, err := b.Client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:           b.tableName(),
+		Key:                 compositeKey(key, field),
+		ConditionExpression: aws.String("v = :v"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":v": attributeValue(*keyvaluestore.ToString(member)),
+		},
+	}); err != nil {
+		if err := err.(awserr.Error); err != nil && err.Code() == "ConditionalCheckFailedException" {
+			return false, nil
+		}
+		return false, wrapError(err, "dynamodb delete item request error")
+	}
+	return true, nil
+}
+
 func minMaxFloatSortKeys(min, max float64) (string, string) {
-	minSortKey := "[" + floatSortKey(min)
+	minSortKey := "[" + sortkey.Float(min)
 	if min == math.Inf(-1) {
 		minSortKey = "-"
 	}
-	maxSortKey := "(" + floatSortKeyAfter(max)
+	maxSortKey := "(" + sortkey.FloatAfter(max)
 	if maxSortKey == "(" {
 		maxSortKey = "+"
 	}
@@ -589,8 +807,8 @@ func (b *Backend) zCount(key string, min, max string, secondaryIndex bool) (int,
 		return 0, nil
 	}
 	input := &dynamodb.QueryInput{
-		TableName:                 aws.String(b.TableName),
-		ConsistentRead:            aws.Bool(!b.AllowEventuallyConsistentReads),
+		TableName:                 b.tableName(),
+		ConsistentRead:            b.consistentRead(),
 		KeyConditionExpression:    aws.String(condition),
 		ExpressionAttributeValues: attributeValues,
 		Select:                    aws.String(dynamodb.SelectCount),
@@ -603,7 +821,7 @@ func (b *Backend) zCount(key string, min, max string, secondaryIndex bool) (int,
 	for {
 		result, err := b.Client.Query(input)
 		if err != nil {
-			return 0, errors.Wrap(err, "dynamodb query request error")
+			return 0, wrapError(err, "dynamodb query request error")
 		}
 		if result.Count == nil {
 			return 0, fmt.Errorf("no count returned by dynamodb query")
@@ -680,13 +898,32 @@ func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]str
 	return members.Values(), err
 }
 
+var _ keyvaluestore.SortedHashFieldRanger = &Backend{}
+
+func (b *Backend) ZHRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	minSortKey, maxSortKey := minMaxFloatSortKeys(min, max)
+	return b.zRangeWithFields(key, minSortKey, maxSortKey, limit, false, true)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	minSortKey, maxSortKey := minMaxFloatSortKeys(min, max)
+	return b.zRangeWithFields(key, minSortKey, maxSortKey, limit, true, true)
+}
+
+func (b *Backend) ZHRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return b.zRangeWithFields(key, min, max, limit, false, false)
+}
+
+func (b *Backend) ZHRevRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return b.zRangeWithFields(key, min, max, limit, true, false)
+}
+
 func queryCondition(key, min, max string, secondaryIndex bool) (string, map[string]*dynamodb.AttributeValue) {
 	minSort := min[1:]
 	maxSort := max[1:]
 
-	attributeValues := map[string]*dynamodb.AttributeValue{
-		":hash": attributeValue(key),
-	}
+	attributeValues := make(map[string]*dynamodb.AttributeValue, 3)
+	attributeValues[":hash"] = attributeValue(key)
 	if min != "-" {
 		attributeValues[":minSort"] = attributeValue(minSort)
 	}
@@ -714,11 +951,110 @@ func queryCondition(key, min, max string, secondaryIndex bool) (string, map[stri
 }
 
 func (b *Backend) zRangeByLex(key, min, max string, limit int, reverse, secondaryIndex bool) (members keyvaluestore.ScoredMembers, err error) {
+	err = b.zQuery(key, min, max, limit, reverse, secondaryIndex, func(field, value string, score float64) {
+		members = append(members, &keyvaluestore.ScoredMember{
+			Score: score,
+			Value: value,
+		})
+	})
+	if err != nil && !b.isPartialResult(err) {
+		return nil, err
+	}
+	return members, err
+}
+
+func (b *Backend) zRangeWithFields(key, min, max string, limit int, reverse, secondaryIndex bool) (members keyvaluestore.FieldScoredMembers, err error) {
+	err = b.zQuery(key, min, max, limit, reverse, secondaryIndex, func(field, value string, score float64) {
+		members = append(members, &keyvaluestore.FieldScoredMember{
+			Field: field,
+			Value: value,
+			Score: score,
+		})
+	})
+	if err != nil && !b.isPartialResult(err) {
+		return nil, err
+	}
+	return members, err
+}
+
+// isPartialResult returns true if results should be returned along with the given error.
+func (b *Backend) isPartialResult(err error) bool {
+	_, ok := err.(*QueryLimitError)
+	return ok && b.PartialQueryResults
+}
+
+// WithContinuationToken returns a backend whose range queries start where the query that returned
+// the token left off. The token comes from a *QueryLimitError, and the returned backend should only
+// be used to repeat the query that produced it, with the same key and range:
+//
+//	members, err := backend.ZRangeByLex("foo", "-", "+", 0)
+//	if err, ok := err.(*dynamodbstore.QueryLimitError); ok {
+//		next, _ := backend.WithContinuationToken(err.ContinuationToken)
+//		more, err := next.ZRangeByLex("foo", "-", "+", 0)
+//		...
+//	}
+//
+// Range queries made with the returned backend that don't match the token's query, including
+// those made with backends derived from it via methods such as WithProfiler, fail with
+// ErrContinuationTokenMismatch.
+func (b *Backend) WithContinuationToken(token string) (*Backend, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid continuation token")
+	}
+	var c continuation
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, errors.Wrap(err, "invalid continuation token")
+	} else if c.Query == "" || c.StartKey == nil {
+		return nil, fmt.Errorf("invalid continuation token")
+	}
+	ret := *b
+	ret.continuation = &c
+	return &ret, nil
+}
+
+// continuation is the content of a continuation token.
+type continuation struct {
+	// Query identifies the query that the token continues. See queryId.
+	Query string `json:"q"`
+
+	StartKey map[string]*dynamodb.AttributeValue `json:"k"`
+}
+
+// queryId identifies a range query so that continuation tokens can't be used to continue other
+// queries.
+func queryId(key, min, max string, reverse, secondaryIndex bool) string {
+	h := fnv.New64a()
+	h.Write([]byte(fmt.Sprintf("%q %q %q %v %v", key, min, max, reverse, secondaryIndex)))
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+func continuationToken(query string, startKey map[string]*dynamodb.AttributeValue) string {
+	buf, err := json.Marshal(&continuation{
+		Query:    query,
+		StartKey: startKey,
+	})
+	if err != nil {
+		// Attribute values only contain strings, byte slices, and other JSON-friendly types.
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// zQuery invokes f for up to limit members of the sorted set between min and max.
+func (b *Backend) zQuery(key, min, max string, limit int, reverse, secondaryIndex bool, f func(field, value string, score float64)) error {
+	query := queryId(key, min, max, reverse, secondaryIndex)
 	var startKey map[string]*dynamodb.AttributeValue
+	if b.continuation != nil {
+		if b.continuation.Query != query {
+			return ErrContinuationTokenMismatch
+		}
+		startKey = b.continuation.StartKey
+	}
 
 	condition, attributeValues := queryCondition(key, min, max, secondaryIndex)
 	if condition == "" {
-		return nil, nil
+		return nil
 	}
 
 	rangeKey := "rk"
@@ -726,10 +1062,31 @@ func (b *Backend) zRangeByLex(key, min, max string, limit int, reverse, secondar
 		rangeKey = "rk2"
 	}
 
-	for limit == 0 || len(members) < limit {
+	var deadline time.Time
+	if b.QueryTimeout > 0 {
+		deadline = time.Now().Add(b.QueryTimeout)
+	}
+
+	n := 0
+	for pages := 0; limit == 0 || n < limit; pages++ {
+		if err := b.checkDeadline(); err != nil {
+			return err
+		}
+		client := b.Client
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return newQueryLimitError(query, startKey, "query timeout exceeded")
+			}
+			client = withTimeout(client, remaining)
+		}
+		if b.MaxQueryPages > 0 && pages >= b.MaxQueryPages {
+			return newQueryLimitError(query, startKey, "query page limit exceeded")
+		}
+
 		input := &dynamodb.QueryInput{
-			TableName:                 aws.String(b.TableName),
-			ConsistentRead:            aws.Bool(!b.AllowEventuallyConsistentReads),
+			TableName:                 b.tableName(),
+			ConsistentRead:            b.consistentRead(),
 			KeyConditionExpression:    aws.String(condition),
 			ExpressionAttributeValues: attributeValues,
 			ExclusiveStartKey:         startKey,
@@ -739,11 +1096,15 @@ func (b *Backend) zRangeByLex(key, min, max string, limit int, reverse, secondar
 			input.IndexName = aws.String("rk2")
 		}
 		if limit > 0 {
-			input.Limit = aws.Int64(int64(limit - len(members)))
+			input.Limit = aws.Int64(int64(limit - n))
 		}
-		result, err := b.Client.Query(input)
+		result, err := client.Query(input)
 		if err != nil {
-			return nil, errors.Wrap(err, "dynamodb query request error")
+			if !deadline.IsZero() && !time.Now().Before(deadline) && isCanceled(err) {
+				// The timeout expired during the request, so the query can be continued from here.
+				return newQueryLimitError(query, startKey, "query timeout exceeded")
+			}
+			return wrapError(err, "dynamodb query request error")
 		}
 		for _, item := range result.Items {
 			sort := *attributeStringValue(item[rangeKey])
@@ -754,20 +1115,18 @@ func (b *Backend) zRangeByLex(key, min, max string, limit int, reverse, secondar
 			var score float64
 
 			if v, ok := item["rk2"]; ok {
-				score = sortKeyFloat(*attributeStringValue(v))
+				score = sortkey.ParseFloat(*attributeStringValue(v))
 			}
 
-			members = append(members, &keyvaluestore.ScoredMember{
-				Score: score,
-				Value: *attributeStringValue(item["v"]),
-			})
+			f(*attributeStringValue(item["rk"]), *attributeStringValue(item["v"]), score)
+			n++
 		}
 		if result.LastEvaluatedKey == nil {
 			break
 		}
 		startKey = result.LastEvaluatedKey
 	}
-	return members, nil
+	return nil
 }
 
 func (b *Backend) checkAndSet(key string, sortKey string, attributeToChange string, transform func(prev *string) (interface{}, error), otherValues map[string]interface{}) (bool, error) {
@@ -775,11 +1134,11 @@ func (b *Backend) checkAndSet(key string, sortKey string, attributeToChange stri
 
 	getResult, err := b.Client.GetItem(&dynamodb.GetItemInput{
 		Key:            compKey,
-		TableName:      aws.String(b.TableName),
+		TableName:      b.tableName(),
 		ConsistentRead: aws.Bool(true),
 	})
 	if err != nil {
-		return false, errors.Wrap(err, "dynamodb get item request error")
+		return false, wrapError(err, "dynamodb get item request error")
 	}
 
 	var prev *string
@@ -807,7 +1166,7 @@ func (b *Backend) checkAndSet(key string, sortKey string, attributeToChange stri
 	}
 
 	if _, err := b.Client.PutItem(&dynamodb.PutItemInput{
-		TableName:           aws.String(b.TableName),
+		TableName:           b.tableName(),
 		Item:                newItem(key, sortKey, attributeValues),
 		ConditionExpression: aws.String(fmt.Sprintf("%s = :v", attributeToChange)),
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
@@ -817,25 +1176,11 @@ func (b *Backend) checkAndSet(key string, sortKey string, attributeToChange stri
 		if err := err.(awserr.Error); err != nil && err.Code() == "ConditionalCheckFailedException" {
 			return false, nil
 		}
-		return false, errors.Wrap(err, "dynamodb put item request error")
+		return false, wrapError(err, "dynamodb put item request error")
 	}
 	return true, nil
 }
 
-const contentiousMethodRetries = 3
-
-func runContentiousMethod(f func() (bool, error)) error {
-	for i := 0; i < contentiousMethodRetries; i++ {
-		success, err := f()
-		if err != nil {
-			return err
-		} else if success {
-			return nil
-		}
-	}
-	return fmt.Errorf("unable to run method due to contention, tried %d times", contentiousMethodRetries)
-}
-
 func CreateDefaultTable(client *dynamodb.DynamoDB, tableName string) error {
 	return createDefaultTable(client, tableName, true)
 }
@@ -898,6 +1243,24 @@ func createDefaultTable(client *dynamodb.DynamoDB, tableName string, tryPayPerRe
 	return err
 }
 
+// Ping does an eventually consistent read of an arbitrary item. This is cheaper than DescribeTable,
+// which is subject to much lower rate limits.
+func (b *Backend) Ping() error {
+	if _, err := b.Client.GetItem(&dynamodb.GetItemInput{
+		Key:            compositeKey("_ping", "_"),
+		TableName:      b.tableName(),
+		ConsistentRead: falseValue,
+	}); err != nil {
+		return wrapError(err, "dynamodb get item request error")
+	}
+	return nil
+}
+
+// Close does nothing since DynamoDB requests don't hold any resources open.
+func (b *Backend) Close() error {
+	return nil
+}
+
 func (b *Backend) Unwrap() keyvaluestore.Backend {
 	return nil
 }
@@ -1,9 +1,19 @@
 package dynamodbstore
 
 import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
+// BackendClient is the subset of the DynamoDB API used by Backend. It's implemented by
+// *dynamodb.DynamoDB.
+//
+// Inputs may share memory with other requests and may be reused once a method returns, so
+// implementations must not modify them or retain them after returning.
 type BackendClient interface {
 	BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error)
 	BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
@@ -11,6 +21,135 @@ type BackendClient interface {
 	GetItem(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
 	PutItem(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
 	Query(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+	Scan(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error)
 	UpdateItem(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error)
 	TransactWriteItems(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error)
 }
+
+// contextBackendClient is implemented by clients that support cancellation via contexts, such as
+// *dynamodb.DynamoDB.
+type contextBackendClient interface {
+	BatchGetItemWithContext(aws.Context, *dynamodb.BatchGetItemInput, ...request.Option) (*dynamodb.BatchGetItemOutput, error)
+	BatchWriteItemWithContext(aws.Context, *dynamodb.BatchWriteItemInput, ...request.Option) (*dynamodb.BatchWriteItemOutput, error)
+	DeleteItemWithContext(aws.Context, *dynamodb.DeleteItemInput, ...request.Option) (*dynamodb.DeleteItemOutput, error)
+	GetItemWithContext(aws.Context, *dynamodb.GetItemInput, ...request.Option) (*dynamodb.GetItemOutput, error)
+	PutItemWithContext(aws.Context, *dynamodb.PutItemInput, ...request.Option) (*dynamodb.PutItemOutput, error)
+	QueryWithContext(aws.Context, *dynamodb.QueryInput, ...request.Option) (*dynamodb.QueryOutput, error)
+	ScanWithContext(aws.Context, *dynamodb.ScanInput, ...request.Option) (*dynamodb.ScanOutput, error)
+	UpdateItemWithContext(aws.Context, *dynamodb.UpdateItemInput, ...request.Option) (*dynamodb.UpdateItemOutput, error)
+	TransactWriteItemsWithContext(aws.Context, *dynamodb.TransactWriteItemsInput, ...request.Option) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// timeoutBackendClient limits the duration of each request made by the client it wraps.
+type timeoutBackendClient struct {
+	Client  contextBackendClient
+	Timeout time.Duration
+
+	// Deadline is the time by which every request must complete.
+	Deadline time.Time
+}
+
+// withTimeout returns a client that limits the duration of each request. If the client doesn't
+// support contexts, it's returned unchanged.
+func withTimeout(client BackendClient, timeout time.Duration) BackendClient {
+	switch c := client.(type) {
+	case *ProfilingBackendClient:
+		ret := *c
+		ret.Client = withTimeout(c.Client, timeout)
+		return &ret
+	case *timeoutBackendClient:
+		ret := *c
+		ret.Timeout = timeout
+		return &ret
+	case contextBackendClient:
+		return &timeoutBackendClient{
+			Client:  c,
+			Timeout: timeout,
+		}
+	}
+	return client
+}
+
+// withDeadline returns a client whose requests must complete by the given time. If the client
+// doesn't support contexts, it's returned unchanged.
+func withDeadline(client BackendClient, deadline time.Time) BackendClient {
+	switch c := client.(type) {
+	case *ProfilingBackendClient:
+		ret := *c
+		ret.Client = withDeadline(c.Client, deadline)
+		return &ret
+	case *timeoutBackendClient:
+		ret := *c
+		ret.Deadline = deadline
+		return &ret
+	case contextBackendClient:
+		return &timeoutBackendClient{
+			Client:   c,
+			Deadline: deadline,
+		}
+	}
+	return client
+}
+
+func (c *timeoutBackendClient) context() (context.Context, context.CancelFunc) {
+	if c.Deadline.IsZero() {
+		return context.WithTimeout(context.Background(), c.Timeout)
+	} else if c.Timeout > 0 && time.Now().Add(c.Timeout).Before(c.Deadline) {
+		return context.WithTimeout(context.Background(), c.Timeout)
+	}
+	return context.WithDeadline(context.Background(), c.Deadline)
+}
+
+func (c *timeoutBackendClient) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.Client.BatchGetItemWithContext(ctx, input)
+}
+
+func (c *timeoutBackendClient) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.Client.BatchWriteItemWithContext(ctx, input)
+}
+
+func (c *timeoutBackendClient) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.Client.DeleteItemWithContext(ctx, input)
+}
+
+func (c *timeoutBackendClient) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.Client.GetItemWithContext(ctx, input)
+}
+
+func (c *timeoutBackendClient) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.Client.PutItemWithContext(ctx, input)
+}
+
+func (c *timeoutBackendClient) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.Client.QueryWithContext(ctx, input)
+}
+
+func (c *timeoutBackendClient) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.Client.ScanWithContext(ctx, input)
+}
+
+func (c *timeoutBackendClient) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.Client.UpdateItemWithContext(ctx, input)
+}
+
+func (c *timeoutBackendClient) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.Client.TransactWriteItemsWithContext(ctx, input)
+}
@@ -0,0 +1,83 @@
+package dynamodbstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+type deadlineRecordingClient struct {
+	*dynamodb.DynamoDB
+	deadline time.Time
+}
+
+func (c *deadlineRecordingClient) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	c.deadline, _ = ctx.Deadline()
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+func TestBackendWithOptions(t *testing.T) {
+	client := &deadlineRecordingClient{}
+	b := &Backend{
+		Client:    client,
+		TableName: "test",
+	}
+
+	for name, backend := range map[string]keyvaluestore.Backend{
+		"Direct":    b,
+		"Profiling": b.WithProfiler(&BasicProfiler{}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			client.deadline = time.Time{}
+			withTimeout := keyvaluestore.WithOptions(backend, keyvaluestore.RequestOptions{
+				Timeout: time.Minute,
+			})
+			_, err := withTimeout.Get("foo")
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(time.Minute), client.deadline, 10*time.Second)
+
+			deadline := time.Now().Add(time.Hour)
+			withDeadline := keyvaluestore.WithOptions(backend, keyvaluestore.RequestOptions{
+				Timeout:  time.Minute,
+				Deadline: deadline,
+			})
+			_, err = withDeadline.Get("foo")
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(time.Minute), client.deadline, 10*time.Second)
+
+			withDeadline = keyvaluestore.WithOptions(backend, keyvaluestore.RequestOptions{
+				Deadline: deadline,
+			})
+			_, err = withDeadline.Get("foo")
+			require.NoError(t, err)
+			assert.Equal(t, deadline, client.deadline)
+		})
+	}
+
+	expired := b.WithOptions(keyvaluestore.RequestOptions{
+		Deadline: time.Now().Add(-time.Second),
+	})
+	batch := expired.Batch()
+	get := batch.Get("foo")
+	assert.True(t, errors.Is(batch.Exec(), context.DeadlineExceeded))
+	_, err := get.Result()
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	eventual := b.WithOptions(keyvaluestore.RequestOptions{
+		Consistency: keyvaluestore.EventualConsistency,
+	}).(*Backend)
+	assert.True(t, eventual.AllowEventuallyConsistentReads)
+	assert.False(t, b.AllowEventuallyConsistentReads)
+	assert.False(t, eventual.WithOptions(keyvaluestore.RequestOptions{
+		Consistency: keyvaluestore.StrongConsistency,
+	}).(*Backend).AllowEventuallyConsistentReads)
+}
@@ -4,14 +4,19 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"os"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ccbrown/keyvaluestore"
 	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
@@ -92,7 +97,219 @@ func TestBackend(t *testing.T) {
 		t.Skip("no dynamodb server available. to start one: docker run -p 8000:8000 --rm -it amazon/dynamodb-local")
 	}
 
-	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+	keyvaluestoretest.TestBackendWithOptions(t, func() keyvaluestore.Backend {
 		return newTestBackend(client, "TestBackend")
+	}, keyvaluestoretest.Options{
+		Parallel: true,
 	})
 }
+
+// nopBackendClient succeeds without doing anything so that the backend's own overhead can be
+// measured.
+type nopBackendClient struct{}
+
+func (nopBackendClient) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	return &dynamodb.BatchGetItemOutput{}, nil
+}
+
+func (nopBackendClient) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func (nopBackendClient) DeleteItem(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (nopBackendClient) GetItem(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+func (nopBackendClient) PutItem(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (nopBackendClient) Query(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	return &dynamodb.QueryOutput{}, nil
+}
+
+func (nopBackendClient) Scan(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	return &dynamodb.ScanOutput{}, nil
+}
+
+func (nopBackendClient) UpdateItem(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (nopBackendClient) TransactWriteItems(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+// endlessQueryBackendClient returns one item per page and always indicates that there are more.
+type endlessQueryBackendClient struct {
+	nopBackendClient
+}
+
+func (endlessQueryBackendClient) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	n := 0
+	if input.ExclusiveStartKey != nil {
+		n, _ = strconv.Atoi(string(input.ExclusiveStartKey["rk"].B))
+		n++
+	}
+	item := map[string]*dynamodb.AttributeValue{
+		"hk": {B: []byte("foo")},
+		"rk": {B: []byte(strconv.Itoa(n))},
+		"v":  {B: []byte(strconv.Itoa(n))},
+	}
+	return &dynamodb.QueryOutput{
+		Items:            []map[string]*dynamodb.AttributeValue{item},
+		LastEvaluatedKey: item,
+	}, nil
+}
+
+func TestQueryLimits(t *testing.T) {
+	backend := &Backend{
+		Client:        endlessQueryBackendClient{},
+		TableName:     "TestQueryLimits",
+		MaxQueryPages: 3,
+	}
+
+	members, err := backend.ZRangeByLex("foo", "-", "+", 0)
+	assert.Empty(t, members)
+	require.IsType(t, &QueryLimitError{}, err)
+
+	backend.PartialQueryResults = true
+	members, err = backend.ZRangeByLex("foo", "-", "+", 0)
+	assert.Equal(t, []string{"0", "1", "2"}, members)
+	require.IsType(t, &QueryLimitError{}, err)
+
+	next, err := backend.WithContinuationToken(err.(*QueryLimitError).ContinuationToken)
+	require.NoError(t, err)
+	members, err = next.ZRangeByLex("foo", "-", "+", 0)
+	assert.Equal(t, []string{"3", "4", "5"}, members)
+	assert.Error(t, err)
+
+	// The token can't be used to continue other queries.
+	_, err = next.ZRangeByLex("bar", "-", "+", 0)
+	assert.Equal(t, ErrContinuationTokenMismatch, err)
+	_, err = next.ZRevRangeByLex("foo", "-", "+", 0)
+	assert.Equal(t, ErrContinuationTokenMismatch, err)
+	_, err = next.WithEventuallyConsistentReads().ZRangeByLex("foo", "[a", "+", 0)
+	assert.Equal(t, ErrContinuationTokenMismatch, err)
+
+	_, err = backend.WithContinuationToken("!")
+	assert.Error(t, err)
+
+	backend = &Backend{
+		Client:       endlessQueryBackendClient{},
+		TableName:    "TestQueryLimits",
+		QueryTimeout: 10 * time.Millisecond,
+	}
+	_, err = backend.ZRangeByLex("foo", "-", "+", 0)
+	assert.IsType(t, &QueryLimitError{}, err)
+}
+
+// slowQueryBackendClient is like endlessQueryBackendClient, but pages starting at or after Block
+// don't complete until their context is done, like requests made by *dynamodb.DynamoDB.
+type slowQueryBackendClient struct {
+	*dynamodb.DynamoDB
+	Block int
+}
+
+func (c *slowQueryBackendClient) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	result, _ := endlessQueryBackendClient{}.Query(input)
+	if n, _ := strconv.Atoi(string(result.Items[0]["rk"].B)); n >= c.Block {
+		<-ctx.Done()
+		return nil, awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+	}
+	return result, nil
+}
+
+func TestQueryTimeoutDuringRequest(t *testing.T) {
+	client := &slowQueryBackendClient{
+		Block: 2,
+	}
+	backend := &Backend{
+		Client:              client,
+		TableName:           "TestQueryTimeoutDuringRequest",
+		QueryTimeout:        10 * time.Millisecond,
+		PartialQueryResults: true,
+	}
+
+	members, err := backend.ZRangeByLex("foo", "-", "+", 0)
+	assert.Equal(t, []string{"0", "1"}, members)
+	require.IsType(t, &QueryLimitError{}, err)
+
+	client.Block = 4
+	next, err := backend.WithContinuationToken(err.(*QueryLimitError).ContinuationToken)
+	require.NoError(t, err)
+	members, err = next.ZRangeByLex("foo", "-", "+", 0)
+	assert.Equal(t, []string{"2", "3"}, members)
+	assert.IsType(t, &QueryLimitError{}, err)
+}
+
+func newNopBenchmarkBackend() *Backend {
+	return &Backend{
+		Client:    nopBackendClient{},
+		TableName: "BenchmarkBackend",
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	backend := newNopBenchmarkBackend()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		backend.Get("foo")
+	}
+}
+
+func BenchmarkSet(b *testing.B) {
+	backend := newNopBenchmarkBackend()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		backend.Set("foo", "bar")
+	}
+}
+
+func BenchmarkZAdd(b *testing.B) {
+	backend := newNopBenchmarkBackend()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		backend.ZAdd("foo", "bar", 1)
+	}
+}
+
+func BenchmarkBatch(b *testing.B) {
+	backend := newNopBenchmarkBackend()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		batch := backend.Batch()
+		batch.Get("foo")
+		batch.Get("bar")
+		batch.Set("baz", "qux")
+		batch.ZAdd("quux", "corge", 1)
+		batch.Exec()
+	}
+}
+
+func TestValueEqualsCondition(t *testing.T) {
+	condition, values := valueEqualsCondition("bar")
+	assert.Equal(t, "v = :v", condition)
+	assert.Equal(t, map[string]*dynamodb.AttributeValue{
+		":v": {B: []byte("bar")},
+	}, values)
+
+	// Integers may have been stored as numbers or as binary.
+	for _, v := range []interface{}{10, int64(10), uint64(10), "10", []byte("10")} {
+		condition, values = valueEqualsCondition(v)
+		assert.Equal(t, "(v = :v OR v = :vn)", condition)
+		assert.Equal(t, map[string]*dynamodb.AttributeValue{
+			":v":  {B: []byte("10")},
+			":vn": {N: aws.String("10")},
+		}, values)
+	}
+
+	for _, s := range []string{"010", "+10", "1.0", "-0", "18446744073709551616"} {
+		condition, _ = valueEqualsCondition(s)
+		assert.Equal(t, "v = :v", condition, s)
+	}
+}
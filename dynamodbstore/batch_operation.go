@@ -2,13 +2,13 @@ package dynamodbstore
 
 import (
 	"encoding/binary"
+	"sync"
 
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/internal/sortkey"
 )
 
 type batchedRead struct {
@@ -48,7 +48,7 @@ func (r zScoreResult) Result() (*float64, error) {
 		return nil, r.read.err
 	}
 	if rk2 := attributeStringValue(r.read.item["rk2"]); rk2 != nil {
-		score := sortKeyFloat(*rk2)
+		score := sortkey.ParseFloat(*rk2)
 		return &score, nil
 	}
 	return nil, nil
@@ -69,6 +69,10 @@ type BatchOperation struct {
 
 	reads  map[string]*batchedRead
 	writes map[string]*batchedWrite
+
+	// n is the number of reads and writes that have been added. Operations on the same item are
+	// combined, so it may be larger than len(reads) + len(writes).
+	n int
 }
 
 func combineKeys(hashKey, rangeKey string) string {
@@ -77,11 +81,20 @@ func combineKeys(hashKey, rangeKey string) string {
 	return string(encodedHashKeyLength[:]) + hashKey + rangeKey
 }
 
+// combineItemKeys is equivalent to combineKeys, but takes the key attributes of an item.
+func combineItemKeys(item map[string]*dynamodb.AttributeValue) string {
+	hashKey, rangeKey := item["hk"].B, item["rk"].B
+	buf := make([]byte, 8, 8+len(hashKey)+len(rangeKey))
+	binary.BigEndian.PutUint64(buf, uint64(len(hashKey)))
+	return string(append(append(buf, hashKey...), rangeKey...))
+}
+
 func (op *BatchOperation) batchRead(hashKey, rangeKey string) *batchedRead {
 	if op.reads == nil {
 		op.reads = make(map[string]*batchedRead)
 	}
 
+	op.n++
 	mapKey := combineKeys(hashKey, rangeKey)
 	if read, ok := op.reads[mapKey]; ok {
 		return read
@@ -116,6 +129,7 @@ func (op *BatchOperation) batchWrite(hashKey, rangeKey string, request *dynamodb
 		op.writes = make(map[string]*batchedWrite)
 	}
 
+	op.n++
 	mapKey := combineKeys(hashKey, rangeKey)
 	if write, ok := op.writes[mapKey]; ok {
 		write.request = request
@@ -131,9 +145,7 @@ func (op *BatchOperation) batchWrite(hashKey, rangeKey string, request *dynamodb
 func (op *BatchOperation) Set(key string, value interface{}) keyvaluestore.ErrorResult {
 	return op.batchWrite(key, "_", &dynamodb.WriteRequest{
 		PutRequest: &dynamodb.PutRequest{
-			Item: newItem(key, "_", map[string]*dynamodb.AttributeValue{
-				"v": attributeValue(value),
-			}),
+			Item: newValueItem(key, "_", attributeValue(value)),
 		},
 	})
 }
@@ -150,14 +162,34 @@ func (op *BatchOperation) ZAdd(key string, member interface{}, score float64) ke
 	s := *keyvaluestore.ToString(member)
 	return op.batchWrite(key, s, &dynamodb.WriteRequest{
 		PutRequest: &dynamodb.PutRequest{
-			Item: newItem(key, s, map[string]*dynamodb.AttributeValue{
-				"v":   attributeValue(s),
-				"rk2": attributeValue(floatSortKey(score) + s),
-			}),
+			Item: newSortedItem(key, s, s, score),
 		},
 	})
 }
 
+type zhmAddResult []keyvaluestore.ErrorResult
+
+func (r zhmAddResult) Result() error {
+	for _, result := range r {
+		if err := result.Result(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (op *BatchOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.ErrorResult {
+	results := make(zhmAddResult, len(entries))
+	for i, entry := range entries {
+		results[i] = op.batchWrite(key, entry.Field, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{
+				Item: newSortedItem(key, entry.Field, *keyvaluestore.ToString(entry.Member), entry.Score),
+			},
+		})
+	}
+	return results
+}
+
 func (op *BatchOperation) execReads() error {
 	keys := make([]map[string]*dynamodb.AttributeValue, len(op.reads))
 	i := 0
@@ -171,6 +203,11 @@ func (op *BatchOperation) execReads() error {
 	}
 
 	var g errgroup.Group
+	sem := make(chan struct{}, keyvaluestore.MaxBatchConcurrency)
+
+	// Failed requests are reported via their items' results, so the other requests continue.
+	var errs []error
+	var errsMutex sync.Mutex
 
 	for len(keys) > 0 {
 		batch := keys
@@ -180,49 +217,58 @@ func (op *BatchOperation) execReads() error {
 		}
 		keys = keys[len(batch):]
 
+		sem <- struct{}{}
 		g.Go(func() error {
+			defer func() { <-sem }()
+
 			unprocessed := map[string]*dynamodb.KeysAndAttributes{
 				op.Backend.TableName: &dynamodb.KeysAndAttributes{
-					ConsistentRead: aws.Bool(!op.Backend.AllowEventuallyConsistentReads),
+					ConsistentRead: op.Backend.consistentRead(),
 					Keys:           batch,
 				},
 			}
 
-			var ret error
-
 			for len(unprocessed) > 0 {
-				result, err := op.Backend.Client.BatchGetItem(&dynamodb.BatchGetItemInput{
-					RequestItems: unprocessed,
-				})
+				var result *dynamodb.BatchGetItemOutput
+				err := op.Backend.checkDeadline()
+				if err == nil {
+					result, err = op.Backend.Client.BatchGetItem(&dynamodb.BatchGetItemInput{
+						RequestItems: unprocessed,
+					})
+				}
 				if err != nil {
+					err = wrapError(err, "dynamodb batch get item request error")
 					for _, key := range batch {
-						mapKey := combineKeys(*attributeStringValue(key["hk"]), *attributeStringValue(key["rk"]))
+						mapKey := combineItemKeys(key)
 						if read, ok := op.reads[mapKey]; ok {
 							read.err = err
 						}
 					}
-					return errors.Wrap(err, "dynamodb batch get item request error")
+					errsMutex.Lock()
+					errs = append(errs, err)
+					errsMutex.Unlock()
+					return nil
 				}
 
 				for _, item := range result.Responses[op.Backend.TableName] {
-					mapKey := combineKeys(*attributeStringValue(item["hk"]), *attributeStringValue(item["rk"]))
+					mapKey := combineItemKeys(item)
 					if read, ok := op.reads[mapKey]; ok {
 						read.item = item
 					}
 				}
 
 				unprocessed = result.UnprocessedKeys
+				if len(unprocessed) > 0 {
+					op.Backend.warn("dynamodb batch get left keys unprocessed", "keys", len(unprocessed[op.Backend.TableName].Keys))
+				}
 			}
 
-			return ret
+			return nil
 		})
 	}
 
-	if err := g.Wait(); err != nil {
-		return err
-	}
-
-	return nil
+	g.Wait()
+	return keyvaluestore.JoinBatchErrors(errs...)
 }
 
 func (op *BatchOperation) execWrites() error {
@@ -233,45 +279,70 @@ func (op *BatchOperation) execWrites() error {
 		i++
 	}
 
+	// Each item is written at most once, so the batches can safely be written concurrently.
+	var g errgroup.Group
+	sem := make(chan struct{}, keyvaluestore.MaxBatchConcurrency)
+
+	// Failed requests are reported via their items' results, so the other requests continue.
+	var errs []error
+	var errsMutex sync.Mutex
+
 	for len(remainingWrites) > 0 {
 		batch := remainingWrites
 		const maxBatchSize = 25
 		if len(batch) > maxBatchSize {
 			batch = remainingWrites[:maxBatchSize]
 		}
+		remainingWrites = remainingWrites[len(batch):]
 
-		writeRequests := make([]*dynamodb.WriteRequest, len(batch))
-		for i, w := range batch {
-			writeRequests[i] = w.request
-		}
-		unprocessed := map[string][]*dynamodb.WriteRequest{
-			op.Backend.TableName: writeRequests,
-		}
+		sem <- struct{}{}
+		g.Go(func() error {
+			defer func() { <-sem }()
 
-		for len(unprocessed) > 0 {
-			result, err := op.Backend.Client.BatchWriteItem(&dynamodb.BatchWriteItemInput{
-				RequestItems: unprocessed,
-			})
-			if err != nil {
-				for _, w := range remainingWrites {
-					w.err = err
+			writeRequests := make([]*dynamodb.WriteRequest, len(batch))
+			for i, w := range batch {
+				writeRequests[i] = w.request
+			}
+			unprocessed := map[string][]*dynamodb.WriteRequest{
+				op.Backend.TableName: writeRequests,
+			}
+
+			for len(unprocessed) > 0 {
+				var result *dynamodb.BatchWriteItemOutput
+				err := op.Backend.checkDeadline()
+				if err == nil {
+					result, err = op.Backend.Client.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+						RequestItems: unprocessed,
+					})
+				}
+				if err != nil {
+					err = wrapError(err, "dynamodb batch write item request error")
+					for _, w := range batch {
+						w.err = err
+					}
+					errsMutex.Lock()
+					errs = append(errs, err)
+					errsMutex.Unlock()
+					return nil
+				}
+				unprocessed = result.UnprocessedItems
+				if len(unprocessed) > 0 {
+					op.Backend.warn("dynamodb batch write left items unprocessed", "items", len(unprocessed[op.Backend.TableName]))
 				}
-				return errors.Wrap(err, "dynamodb batch write item request error")
 			}
-			unprocessed = result.UnprocessedItems
-		}
 
-		remainingWrites = remainingWrites[len(batch):]
+			return nil
+		})
 	}
 
-	return nil
+	g.Wait()
+	return keyvaluestore.JoinBatchErrors(errs...)
+}
+
+func (op *BatchOperation) Len() int {
+	return op.n + op.FallbackBatchOperation.Len()
 }
 
 func (op *BatchOperation) Exec() error {
-	if err := op.execReads(); err != nil {
-		return err
-	} else if err := op.execWrites(); err != nil {
-		return err
-	}
-	return op.FallbackBatchOperation.Exec()
+	return keyvaluestore.JoinBatchErrors(op.execReads(), op.execWrites(), op.FallbackBatchOperation.Exec())
 }
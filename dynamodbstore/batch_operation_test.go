@@ -0,0 +1,55 @@
+package dynamodbstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// failingWritesBackendClient reads "foo" as "bar", but fails all batch writes.
+type failingWritesBackendClient struct {
+	nopBackendClient
+}
+
+var errBatchWrite = errors.New("batch write error")
+
+func (failingWritesBackendClient) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	return &dynamodb.BatchGetItemOutput{
+		Responses: map[string][]map[string]*dynamodb.AttributeValue{
+			"TestBatchErrors": {newValueItem("foo", "_", attributeValue("bar"))},
+		},
+	}, nil
+}
+
+func (failingWritesBackendClient) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	return nil, errBatchWrite
+}
+
+func TestBatchErrors(t *testing.T) {
+	backend := &Backend{
+		Client:    failingWritesBackendClient{},
+		TableName: "TestBatchErrors",
+	}
+
+	batch := backend.Batch()
+	set := batch.Set("baz", "qux")
+	get := batch.Get("foo")
+	err := batch.Exec()
+
+	var batchErr *keyvaluestore.BatchError
+	require.True(t, errors.As(err, &batchErr))
+	assert.Len(t, batchErr.Errors, 1)
+	assert.True(t, errors.Is(err, errBatchWrite))
+	assert.True(t, errors.Is(set.Result(), errBatchWrite))
+
+	// The reads are unaffected by the failed writes.
+	v, err := get.Result()
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, "bar", *v)
+}
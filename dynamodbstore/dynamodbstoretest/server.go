@@ -0,0 +1,226 @@
+// Package dynamodbstoretest provides a DynamoDB Local server for tests so that the DynamoDB suite can
+// be run without any manual setup.
+//
+// Start looks for a server in the following order:
+//
+//   - If DYNAMODB_ENDPOINT is set, that endpoint is used.
+//   - If a server is already listening on localhost:8000, it's used.
+//   - If docker is installed, an amazon/dynamodb-local container is started.
+//   - If java is installed and DYNAMODB_LOCAL_PATH is set to a directory containing DynamoDBLocal.jar,
+//     the server is started from there.
+//
+// If none of these work, Start returns an error wrapping ErrUnavailable, and tests should be skipped.
+package dynamodbstoretest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/dynamodbstore"
+)
+
+// DefaultEndpoint is the endpoint checked for an already running server.
+const DefaultEndpoint = "http://localhost:8000"
+
+// DockerImage is the image used to start a server via docker.
+const DockerImage = "amazon/dynamodb-local"
+
+// StartTimeout is how long Start waits for a server it started to accept requests.
+const StartTimeout = 30 * time.Second
+
+// ErrUnavailable is returned by Start if no server could be found or started.
+var ErrUnavailable = errors.New("no dynamodb server available. install docker or java, or set DYNAMODB_ENDPOINT")
+
+// Server is a DynamoDB Local server.
+type Server struct {
+	Endpoint string
+
+	client *dynamodb.DynamoDB
+	stop   func() error
+}
+
+// Start finds or starts a server. Close must be invoked once it's no longer needed so that any
+// container or process started for it is stopped.
+func Start() (*Server, error) {
+	if endpoint := os.Getenv("DYNAMODB_ENDPOINT"); endpoint != "" {
+		return newServer(endpoint, nil), nil
+	}
+
+	if s := newServer(DefaultEndpoint, nil); s.ping() == nil {
+		return s, nil
+	}
+
+	// If docker is installed but the daemon isn't running, we can still fall back to java.
+	var dockerErr error
+	if _, err := exec.LookPath("docker"); err == nil {
+		s, err := startDocker()
+		if err == nil {
+			return s, nil
+		}
+		dockerErr = err
+	}
+
+	if dir := os.Getenv("DYNAMODB_LOCAL_PATH"); dir != "" {
+		if _, err := exec.LookPath("java"); err == nil {
+			return startJava(dir)
+		}
+	}
+
+	if dockerErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, dockerErr)
+	}
+	return nil, ErrUnavailable
+}
+
+func newServer(endpoint string, stop func() error) *Server {
+	// DynamoDB Local keeps a separate database for each access key, so static credentials are used
+	// to ensure that every client sees the same tables.
+	config := &aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(endpoint),
+		Credentials: credentials.NewStaticCredentials("dynamodbstoretest", "dynamodbstoretest", ""),
+		MaxRetries:  aws.Int(0),
+	}
+	return &Server{
+		Endpoint: endpoint,
+		client:   dynamodb.New(session.Must(session.NewSession(config))),
+		stop:     stop,
+	}
+}
+
+func startDocker() (*Server, error) {
+	out, err := exec.Command("docker", "run", "-d", "--rm", "-p", "127.0.0.1::8000", DockerImage).Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to start dynamodb container: %w", err)
+	}
+	container := strings.TrimSpace(string(out))
+	stop := func() error {
+		return exec.Command("docker", "stop", container).Run()
+	}
+
+	out, err = exec.Command("docker", "port", container, "8000").Output()
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("unable to get dynamodb container port: %w", err)
+	}
+	// There may be one line per address family. We only bound IPv4, so the first will do.
+	addr := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+
+	return waitForServer("http://"+addr, stop)
+}
+
+func startJava(dir string) (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	cmd := exec.Command("java",
+		"-Djava.library.path="+filepath.Join(dir, "DynamoDBLocal_lib"),
+		"-jar", filepath.Join(dir, "DynamoDBLocal.jar"),
+		"-inMemory",
+		"-port", fmt.Sprint(port),
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("unable to start dynamodb local: %w", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	stop := func() error {
+		select {
+		case <-exited:
+			return fmt.Errorf("dynamodb local exited: %v", strings.TrimSpace(stderr.String()))
+		default:
+		}
+		if err := cmd.Process.Kill(); err != nil {
+			return err
+		}
+		<-exited
+		return nil
+	}
+
+	return waitForServer(fmt.Sprintf("http://127.0.0.1:%d", port), stop)
+}
+
+func waitForServer(endpoint string, stop func() error) (*Server, error) {
+	s := newServer(endpoint, stop)
+	deadline := time.Now().Add(StartTimeout)
+	for {
+		err := s.ping()
+		if err == nil {
+			return s, nil
+		} else if time.Now().After(deadline) {
+			if stopErr := stop(); stopErr != nil {
+				err = stopErr
+			}
+			return nil, fmt.Errorf("dynamodb server didn't become ready: %w", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (s *Server) ping() error {
+	_, err := s.client.ListTables(&dynamodb.ListTablesInput{})
+	return err
+}
+
+// Client returns a client for the server.
+func (s *Server) Client() *dynamodb.DynamoDB {
+	return s.client
+}
+
+// RecreateTable deletes the table if it exists, then creates it with the default schema.
+func (s *Server) RecreateTable(tableName string) error {
+	if _, err := s.client.DeleteTable(&dynamodb.DeleteTableInput{
+		TableName: aws.String(tableName),
+	}); err == nil {
+		if err := s.client.WaitUntilTableNotExists(&dynamodb.DescribeTableInput{
+			TableName: aws.String(tableName),
+		}); err != nil {
+			return err
+		}
+	}
+	return dynamodbstore.CreateDefaultTable(s.client, tableName)
+}
+
+// NewBackend returns a function suitable for keyvaluestoretest that recreates the given table and
+// returns a backend for it each time it's invoked. It panics if the table can't be recreated.
+func (s *Server) NewBackend(tableName string) func() keyvaluestore.Backend {
+	return func() keyvaluestore.Backend {
+		if err := s.RecreateTable(tableName); err != nil {
+			panic(err)
+		}
+		return &dynamodbstore.Backend{
+			Client:    s.client,
+			TableName: tableName,
+		}
+	}
+}
+
+// Close stops the server if it was started by Start.
+func (s *Server) Close() error {
+	if s.stop == nil {
+		return nil
+	}
+	return s.stop()
+}
@@ -0,0 +1,31 @@
+package dynamodbstoretest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	s, err := Start()
+	if errors.Is(err, ErrUnavailable) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	defer s.Close()
+
+	b := s.NewBackend("TestServer")()
+	require.NoError(t, b.Set("foo", "bar"))
+	v, err := b.Get("foo")
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, "bar", *v)
+
+	// Each backend starts with an empty table.
+	b = s.NewBackend("TestServer")()
+	v, err = b.Get("foo")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
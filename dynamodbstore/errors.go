@@ -0,0 +1,114 @@
+package dynamodbstore
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// wrapError annotates an error returned by the DynamoDB client and translates it into one of the
+// keyvaluestore error kinds if possible.
+func wrapError(err error, message string) error {
+	return translateError(errors.Wrap(err, message))
+}
+
+// translateError wraps err in a *keyvaluestore.Error if it corresponds to one of the keyvaluestore
+// error kinds. Otherwise err is returned as-is.
+func translateError(err error) error {
+	if kind := errorKind(err); kind != nil {
+		return &keyvaluestore.Error{
+			Kind: kind,
+			Err:  err,
+		}
+	}
+	return err
+}
+
+func errorKind(err error) error {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return nil
+	}
+	switch aerr.Code() {
+	case "ProvisionedThroughputExceededException", "RequestLimitExceeded", "ThrottlingException":
+		return keyvaluestore.ErrThrottled
+	case "ConditionalCheckFailedException":
+		return keyvaluestore.ErrConditionFailed
+	case "ItemCollectionSizeLimitExceededException":
+		return keyvaluestore.ErrValueTooLarge
+	case "ValidationException":
+		message := aerr.Message()
+		if strings.Contains(message, "size has exceeded") || strings.Contains(message, "Item size") {
+			return keyvaluestore.ErrValueTooLarge
+		} else if strings.Contains(message, "incorrect data type") || strings.Contains(message, "Type mismatch") {
+			return keyvaluestore.ErrWrongType
+		}
+	case "TransactionCanceledException":
+		if err, ok := aerr.(*dynamodb.TransactionCanceledException); ok {
+			return cancellationReasonsKind(err.CancellationReasons)
+		}
+	}
+	return nil
+}
+
+// cancellationReasonsKind returns the error kind corresponding to the reasons a transaction was
+// canceled, if any.
+func cancellationReasonsKind(reasons []*dynamodb.CancellationReason) error {
+	for _, reason := range reasons {
+		if reason == nil || reason.Code == nil {
+			continue
+		}
+		switch *reason.Code {
+		case "ThrottlingError", "ProvisionedThroughputExceeded":
+			return keyvaluestore.ErrThrottled
+		case "ItemCollectionSizeLimitExceeded":
+			return keyvaluestore.ErrValueTooLarge
+		case "ValidationError":
+			if reason.Message != nil && strings.Contains(*reason.Message, "size") {
+				return keyvaluestore.ErrValueTooLarge
+			}
+		}
+	}
+	return nil
+}
+
+// QueryLimitError is returned by range queries that exceed the backend's MaxQueryPages or
+// QueryTimeout. If PartialQueryResults is enabled, it's returned along with the members read so
+// far.
+type QueryLimitError struct {
+	// ContinuationToken can be passed to WithContinuationToken to resume the query.
+	ContinuationToken string
+
+	message string
+}
+
+func newQueryLimitError(query string, startKey map[string]*dynamodb.AttributeValue, message string) *QueryLimitError {
+	return &QueryLimitError{
+		ContinuationToken: continuationToken(query, startKey),
+		message:           message,
+	}
+}
+
+func (e *QueryLimitError) Error() string {
+	return e.message
+}
+
+// ErrContinuationTokenMismatch is returned by range queries made with a backend returned by
+// WithContinuationToken if they aren't the query that the token continues.
+var ErrContinuationTokenMismatch = errors.New("continuation token is for a different query")
+
+// isCanceled returns true if err resulted from a request's context being canceled or its deadline
+// passing.
+func isCanceled(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == request.CanceledErrorCode
+}
@@ -0,0 +1,42 @@
+package dynamodbstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+func TestWrapError(t *testing.T) {
+	for _, tc := range []struct {
+		Err  error
+		Kind error
+	}{
+		{awserr.New("ProvisionedThroughputExceededException", "The level of configured provisioned throughput for the table was exceeded.", nil), keyvaluestore.ErrThrottled},
+		{awserr.New("ThrottlingException", "Rate of requests exceeds the allowed throughput.", nil), keyvaluestore.ErrThrottled},
+		{awserr.New("ValidationException", "Item size has exceeded the maximum allowed size", nil), keyvaluestore.ErrValueTooLarge},
+		{awserr.New("ValidationException", "An operand in the update expression has an incorrect data type", nil), keyvaluestore.ErrWrongType},
+		{awserr.New("ConditionalCheckFailedException", "The conditional request failed", nil), keyvaluestore.ErrConditionFailed},
+		{&dynamodb.TransactionCanceledException{
+			CancellationReasons: []*dynamodb.CancellationReason{
+				{Code: aws.String("None")},
+				{Code: aws.String("ThrottlingError")},
+			},
+		}, keyvaluestore.ErrThrottled},
+	} {
+		err := wrapError(tc.Err, "dynamodb request error")
+		assert.True(t, errors.Is(err, tc.Kind), tc.Err.Error())
+
+		var aerr awserr.Error
+		assert.True(t, errors.As(err, &aerr))
+	}
+
+	err := wrapError(awserr.New("ResourceNotFoundException", "Requested resource not found", nil), "dynamodb request error")
+	var kindErr *keyvaluestore.Error
+	assert.False(t, errors.As(err, &kindErr))
+}
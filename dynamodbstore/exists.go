@@ -0,0 +1,64 @@
+package dynamodbstore
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+var _ keyvaluestore.MultiExister = &Backend{}
+
+// ExistsMulti uses BatchGetItem requests that only project the items' keys, so values aren't
+// read.
+//
+// Strings, sets, and hashes are stored in a single item, but the members of sorted sets and sorted
+// hashes are stored in items of their own, so ExistsMulti doesn't detect them. Hashes whose fields
+// have all been deleted may still be reported as existing.
+func (b *Backend) ExistsMulti(keys ...string) (map[string]bool, error) {
+	ret := make(map[string]bool, len(keys))
+
+	// BatchGetItem doesn't allow duplicate keys.
+	var itemKeys []map[string]*dynamodb.AttributeValue
+	for _, key := range keys {
+		if _, ok := ret[key]; !ok {
+			ret[key] = false
+			itemKeys = append(itemKeys, compositeKey(key, "_"))
+		}
+	}
+
+	for len(itemKeys) > 0 {
+		batch := itemKeys
+		const maxBatchSize = 100
+		if len(batch) > maxBatchSize {
+			batch = itemKeys[:maxBatchSize]
+		}
+		itemKeys = itemKeys[len(batch):]
+
+		unprocessed := map[string]*dynamodb.KeysAndAttributes{
+			b.TableName: &dynamodb.KeysAndAttributes{
+				ConsistentRead:       b.consistentRead(),
+				Keys:                 batch,
+				ProjectionExpression: aws.String("hk"),
+			},
+		}
+
+		for len(unprocessed) > 0 {
+			if err := b.checkDeadline(); err != nil {
+				return nil, err
+			}
+			result, err := b.Client.BatchGetItem(&dynamodb.BatchGetItemInput{
+				RequestItems: unprocessed,
+			})
+			if err != nil {
+				return nil, wrapError(err, "dynamodb batch get item request error")
+			}
+			for _, item := range result.Responses[b.TableName] {
+				ret[string(item["hk"].B)] = true
+			}
+			unprocessed = result.UnprocessedKeys
+		}
+	}
+
+	return ret, nil
+}
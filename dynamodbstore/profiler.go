@@ -6,8 +6,13 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/ccbrown/keyvaluestore"
 )
 
+// Profiler is the DynamoDB-specific profiler interface.
+//
+// Deprecated: Pass a keyvaluestore.Profiler to WithProfiler instead.
 type Profiler interface {
 	ConsumeDynamoDBReadCapacity(capacity float64)
 	ConsumeDynamoDBWriteCapacity(capacity float64)
@@ -19,6 +24,7 @@ type BasicProfiler struct {
 	requestNanoseconds      int64
 	readCapacityConsumedX4  int64
 	writeCapacityConsumedX4 int64
+	contentionRetryCount    int64
 }
 
 func (p *BasicProfiler) ConsumeDynamoDBReadCapacity(capacity float64) {
@@ -34,6 +40,10 @@ func (p *BasicProfiler) AddDynamoDBRequestProfile(operationName string, duration
 	atomic.AddInt64(&p.requestNanoseconds, int64(duration/time.Nanosecond))
 }
 
+func (p *BasicProfiler) AddDynamoDBContentionRetries(operationName, key string, retries int, err error) {
+	atomic.AddInt64(&p.contentionRetryCount, int64(retries))
+}
+
 func (p *BasicProfiler) DynamoDBRequestCount() int {
 	return int(atomic.LoadInt64(&p.requestCount))
 }
@@ -50,23 +60,261 @@ func (p *BasicProfiler) DynamoDBWriteCapacityConsumed() float64 {
 	return float64(atomic.LoadInt64(&p.writeCapacityConsumedX4)) / 4.0
 }
 
+// DynamoDBContentionRetryCount returns the number of times operations have been retried due to
+// contention.
+func (p *BasicProfiler) DynamoDBContentionRetryCount() int {
+	return int(atomic.LoadInt64(&p.contentionRetryCount))
+}
+
+// requestProfiler is implemented by profilers that want more detail than Profiler provides.
+type requestProfiler interface {
+	addRequestProfile(operation, key string, duration time.Duration, err error, size payloadSize, readCapacity, writeCapacity float64, itemCollectionSizes map[string]float64)
+}
+
+// payloadSize describes the approximate sizes of a request's items and its response's items.
+type payloadSize struct {
+	requestBytes  int
+	responseBytes int
+	responseItems int
+}
+
+// unifiedProfiler adapts a keyvaluestore.Profiler to the DynamoDB-specific interface.
+type unifiedProfiler struct {
+	profiler keyvaluestore.Profiler
+}
+
+func (p *unifiedProfiler) ConsumeDynamoDBReadCapacity(capacity float64) {
+	p.addRequestProfile("", "", 0, nil, payloadSize{}, capacity, 0, nil)
+}
+
+func (p *unifiedProfiler) ConsumeDynamoDBWriteCapacity(capacity float64) {
+	p.addRequestProfile("", "", 0, nil, payloadSize{}, 0, capacity, nil)
+}
+
+func (p *unifiedProfiler) AddDynamoDBRequestProfile(operationName string, duration time.Duration) {
+	p.addRequestProfile(operationName, "", duration, nil, payloadSize{}, 0, 0, nil)
+}
+
+func (p *unifiedProfiler) AddDynamoDBContentionRetries(operationName, key string, retries int, err error) {
+	if !keyvaluestore.ShouldProfile(p.profiler) {
+		return
+	}
+	p.profiler.AddProfile(&keyvaluestore.Profile{
+		Operation: operationName,
+		Key:       key,
+		Err:       err,
+		Retries:   retries,
+	})
+}
+
+func (p *unifiedProfiler) addConflictProfile(operation, key string, err error) {
+	if !keyvaluestore.ShouldProfile(p.profiler) {
+		return
+	}
+	p.profiler.AddProfile(&keyvaluestore.Profile{
+		Operation: operation,
+		Key:       key,
+		Err:       err,
+		Conflicts: 1,
+	})
+}
+
+func (p *unifiedProfiler) addRequestProfile(operation, key string, duration time.Duration, err error, size payloadSize, readCapacity, writeCapacity float64, itemCollectionSizes map[string]float64) {
+	metadata := map[string]interface{}{
+		"ConsumedReadCapacity":  readCapacity,
+		"ConsumedWriteCapacity": writeCapacity,
+	}
+	if len(itemCollectionSizes) > 0 {
+		metadata["ItemCollectionSizeGB"] = itemCollectionSizes
+	}
+	p.profiler.AddProfile(&keyvaluestore.Profile{
+		Operation:     operation,
+		Key:           key,
+		Duration:      duration,
+		Err:           err,
+		ReadCapacity:  readCapacity,
+		WriteCapacity: writeCapacity,
+		RequestBytes:  size.requestBytes,
+		ResponseBytes: size.responseBytes,
+		ResponseItems: size.responseItems,
+		Metadata:      metadata,
+	})
+}
+
+// DefaultItemCollectionSizeWarningGB is the item collection size at which ProfilingBackendClient
+// warns if no other threshold is given. DynamoDB limits item collections to 10GB.
+const DefaultItemCollectionSizeWarningGB = 8.0
+
 type ProfilingBackendClient struct {
 	Client   BackendClient
 	Profiler Profiler
+
+	// If ItemCollectionMetrics is true, writes request item collection metrics. The upper bound of
+	// the estimated size of each written key's item collection is reported via the profile's
+	// "ItemCollectionSizeGB" metadata, which maps keys to sizes. DynamoDB only returns the metrics
+	// for tables with local secondary indexes.
+	ItemCollectionMetrics bool
+
+	// If non-nil, Logger is warned about keys whose item collections may have reached
+	// ItemCollectionSizeWarningGB. If it's zero, DefaultItemCollectionSizeWarningGB is used.
+	Logger                      keyvaluestore.Logger
+	ItemCollectionSizeWarningGB float64
 }
 
-func (c *ProfilingBackendClient) profileConsumedReadCapacity(capacity *dynamodb.ConsumedCapacity) {
-	if capacity == nil || capacity.CapacityUnits == nil {
-		return
+func (c *ProfilingBackendClient) returnItemCollectionMetrics() *string {
+	if c.ItemCollectionMetrics {
+		return aws.String(dynamodb.ReturnItemCollectionMetricsSize)
+	}
+	return nil
+}
+
+// itemCollectionSizes returns the upper bounds of the given collections' estimated sizes, warning
+// about any that may be approaching the limit.
+func (c *ProfilingBackendClient) itemCollectionSizes(collections ...*dynamodb.ItemCollectionMetrics) map[string]float64 {
+	var ret map[string]float64
+	for _, collection := range collections {
+		if collection == nil || len(collection.SizeEstimateRangeGB) == 0 {
+			continue
+		}
+		upperBound := collection.SizeEstimateRangeGB[len(collection.SizeEstimateRangeGB)-1]
+		if upperBound == nil {
+			continue
+		}
+		if ret == nil {
+			ret = map[string]float64{}
+		}
+		key := hashKey(collection.ItemCollectionKey)
+		ret[key] = *upperBound
+
+		threshold := c.ItemCollectionSizeWarningGB
+		if threshold == 0 {
+			threshold = DefaultItemCollectionSizeWarningGB
+		}
+		if *upperBound >= threshold && c.Logger != nil {
+			c.Logger.Warn("dynamodb item collection is approaching its size limit", "key", key, "sizeGB", *upperBound)
+		}
 	}
-	c.Profiler.ConsumeDynamoDBReadCapacity(*capacity.CapacityUnits)
+	return ret
 }
 
-func (c *ProfilingBackendClient) profileConsumedWriteCapacity(capacity *dynamodb.ConsumedCapacity) {
-	if capacity == nil || capacity.CapacityUnits == nil {
+func tableItemCollectionMetrics(metrics map[string][]*dynamodb.ItemCollectionMetrics) []*dynamodb.ItemCollectionMetrics {
+	var ret []*dynamodb.ItemCollectionMetrics
+	for _, tableMetrics := range metrics {
+		ret = append(ret, tableMetrics...)
+	}
+	return ret
+}
+
+func totalCapacity(capacities []*dynamodb.ConsumedCapacity) float64 {
+	total := 0.0
+	for _, capacity := range capacities {
+		if capacity != nil && capacity.CapacityUnits != nil {
+			total += *capacity.CapacityUnits
+		}
+	}
+	return total
+}
+
+func hashKey(key map[string]*dynamodb.AttributeValue) string {
+	if hk, ok := key["hk"]; ok && hk != nil {
+		return string(hk.B)
+	}
+	return ""
+}
+
+// queryHashKey returns the key that a query targets.
+func queryHashKey(input *dynamodb.QueryInput) string {
+	if hash, ok := input.ExpressionAttributeValues[":hash"]; ok && hash != nil {
+		return string(hash.B)
+	}
+	return ""
+}
+
+// itemSize approximates an item's size the way DynamoDB does: the sum of its attribute names'
+// lengths and its values' sizes.
+func itemSize(item map[string]*dynamodb.AttributeValue) int {
+	n := 0
+	for name, value := range item {
+		n += len(name) + attributeValueSize(value)
+	}
+	return n
+}
+
+func itemsSize(items []map[string]*dynamodb.AttributeValue) int {
+	n := 0
+	for _, item := range items {
+		n += itemSize(item)
+	}
+	return n
+}
+
+// attributeValueSize approximates an attribute value's size. Numbers are counted by the length of
+// their string representations, and lists and maps have 3 bytes of overhead plus 1 byte per
+// element.
+func attributeValueSize(v *dynamodb.AttributeValue) int {
+	if v == nil {
+		return 0
+	}
+	switch {
+	case v.S != nil:
+		return len(*v.S)
+	case v.N != nil:
+		return len(*v.N)
+	case v.B != nil:
+		return len(v.B)
+	case v.BOOL != nil || v.NULL != nil:
+		return 1
+	case v.SS != nil:
+		n := 0
+		for _, s := range v.SS {
+			n += len(aws.StringValue(s))
+		}
+		return n
+	case v.NS != nil:
+		n := 0
+		for _, s := range v.NS {
+			n += len(aws.StringValue(s))
+		}
+		return n
+	case v.BS != nil:
+		n := 0
+		for _, b := range v.BS {
+			n += len(b)
+		}
+		return n
+	case v.L != nil:
+		n := 3 + len(v.L)
+		for _, e := range v.L {
+			n += attributeValueSize(e)
+		}
+		return n
+	case v.M != nil:
+		return 3 + len(v.M) + itemSize(v.M)
+	}
+	return 0
+}
+
+func (c *ProfilingBackendClient) profile(operation, key string, duration time.Duration, err error, size payloadSize, readCapacity, writeCapacity []*dynamodb.ConsumedCapacity, itemCollections ...*dynamodb.ItemCollectionMetrics) {
+	// Sizes are checked even if the request isn't sampled so that no warnings are missed.
+	itemCollectionSizes := c.itemCollectionSizes(itemCollections...)
+	if p, ok := c.Profiler.(*unifiedProfiler); ok && !keyvaluestore.ShouldProfile(p.profiler) {
+		return
+	}
+	if p, ok := c.Profiler.(requestProfiler); ok {
+		p.addRequestProfile(operation, key, duration, err, size, totalCapacity(readCapacity), totalCapacity(writeCapacity), itemCollectionSizes)
 		return
 	}
-	c.Profiler.ConsumeDynamoDBWriteCapacity(*capacity.CapacityUnits)
+	c.Profiler.AddDynamoDBRequestProfile(operation, duration)
+	for _, capacity := range readCapacity {
+		if capacity != nil && capacity.CapacityUnits != nil {
+			c.Profiler.ConsumeDynamoDBReadCapacity(*capacity.CapacityUnits)
+		}
+	}
+	for _, capacity := range writeCapacity {
+		if capacity != nil && capacity.CapacityUnits != nil {
+			c.Profiler.ConsumeDynamoDBWriteCapacity(*capacity.CapacityUnits)
+		}
+	}
 }
 
 func (c *ProfilingBackendClient) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
@@ -74,38 +322,74 @@ func (c *ProfilingBackendClient) BatchGetItem(input *dynamodb.BatchGetItemInput)
 	copy.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
 	startTime := time.Now()
 	output, err := c.Client.BatchGetItem(&copy)
-	c.Profiler.AddDynamoDBRequestProfile("BatchGetItem", time.Since(startTime))
+	var capacity []*dynamodb.ConsumedCapacity
+	if err == nil {
+		capacity = output.ConsumedCapacity
+	}
+	size := payloadSize{}
+	for _, keysAndAttributes := range input.RequestItems {
+		size.requestBytes += itemsSize(keysAndAttributes.Keys)
+	}
 	if err == nil {
-		for _, capacity := range output.ConsumedCapacity {
-			c.profileConsumedReadCapacity(capacity)
+		for _, items := range output.Responses {
+			size.responseBytes += itemsSize(items)
+			size.responseItems += len(items)
 		}
 	}
+	c.profile("BatchGetItem", "", time.Since(startTime), err, size, capacity, nil)
 	return output, err
 }
 
 func (c *ProfilingBackendClient) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
 	copy := *input
 	copy.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+	if copy.ReturnItemCollectionMetrics == nil {
+		copy.ReturnItemCollectionMetrics = c.returnItemCollectionMetrics()
+	}
 	startTime := time.Now()
 	output, err := c.Client.BatchWriteItem(&copy)
-	c.Profiler.AddDynamoDBRequestProfile("BatchWriteItem", time.Since(startTime))
+	var capacity []*dynamodb.ConsumedCapacity
+	var itemCollections []*dynamodb.ItemCollectionMetrics
 	if err == nil {
-		for _, capacity := range output.ConsumedCapacity {
-			c.profileConsumedWriteCapacity(capacity)
+		capacity = output.ConsumedCapacity
+		itemCollections = tableItemCollectionMetrics(output.ItemCollectionMetrics)
+	}
+	size := payloadSize{}
+	for _, requests := range input.RequestItems {
+		for _, request := range requests {
+			if request.PutRequest != nil {
+				size.requestBytes += itemSize(request.PutRequest.Item)
+			}
+			if request.DeleteRequest != nil {
+				size.requestBytes += itemSize(request.DeleteRequest.Key)
+			}
 		}
 	}
+	c.profile("BatchWriteItem", "", time.Since(startTime), err, size, nil, capacity, itemCollections...)
 	return output, err
 }
 
 func (c *ProfilingBackendClient) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
 	copy := *input
 	copy.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+	if copy.ReturnItemCollectionMetrics == nil {
+		copy.ReturnItemCollectionMetrics = c.returnItemCollectionMetrics()
+	}
 	startTime := time.Now()
 	output, err := c.Client.DeleteItem(&copy)
-	c.Profiler.AddDynamoDBRequestProfile("DeleteItem", time.Since(startTime))
+	var capacity []*dynamodb.ConsumedCapacity
+	var itemCollection *dynamodb.ItemCollectionMetrics
+	if err == nil {
+		capacity = []*dynamodb.ConsumedCapacity{output.ConsumedCapacity}
+		itemCollection = output.ItemCollectionMetrics
+	}
+	size := payloadSize{
+		requestBytes: itemSize(input.Key) + itemSize(input.ExpressionAttributeValues),
+	}
 	if err == nil {
-		c.profileConsumedWriteCapacity(output.ConsumedCapacity)
+		size.responseBytes = itemSize(output.Attributes)
 	}
+	c.profile("DeleteItem", hashKey(input.Key), time.Since(startTime), err, size, nil, capacity, itemCollection)
 	return output, err
 }
 
@@ -114,22 +398,41 @@ func (c *ProfilingBackendClient) GetItem(input *dynamodb.GetItemInput) (*dynamod
 	copy.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
 	startTime := time.Now()
 	output, err := c.Client.GetItem(&copy)
-	c.Profiler.AddDynamoDBRequestProfile("GetItem", time.Since(startTime))
+	var capacity []*dynamodb.ConsumedCapacity
 	if err == nil {
-		c.profileConsumedReadCapacity(output.ConsumedCapacity)
+		capacity = []*dynamodb.ConsumedCapacity{output.ConsumedCapacity}
 	}
+	size := payloadSize{
+		requestBytes: itemSize(input.Key),
+	}
+	if err == nil {
+		size.responseBytes = itemSize(output.Item)
+	}
+	c.profile("GetItem", hashKey(input.Key), time.Since(startTime), err, size, capacity, nil)
 	return output, err
 }
 
 func (c *ProfilingBackendClient) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
 	copy := *input
 	copy.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+	if copy.ReturnItemCollectionMetrics == nil {
+		copy.ReturnItemCollectionMetrics = c.returnItemCollectionMetrics()
+	}
 	startTime := time.Now()
 	output, err := c.Client.PutItem(&copy)
-	c.Profiler.AddDynamoDBRequestProfile("PutItem", time.Since(startTime))
+	var capacity []*dynamodb.ConsumedCapacity
+	var itemCollection *dynamodb.ItemCollectionMetrics
+	if err == nil {
+		capacity = []*dynamodb.ConsumedCapacity{output.ConsumedCapacity}
+		itemCollection = output.ItemCollectionMetrics
+	}
+	size := payloadSize{
+		requestBytes: itemSize(input.Item) + itemSize(input.ExpressionAttributeValues),
+	}
 	if err == nil {
-		c.profileConsumedWriteCapacity(output.ConsumedCapacity)
+		size.responseBytes = itemSize(output.Attributes)
 	}
+	c.profile("PutItem", hashKey(input.Item), time.Since(startTime), err, size, nil, capacity, itemCollection)
 	return output, err
 }
 
@@ -138,35 +441,93 @@ func (c *ProfilingBackendClient) Query(input *dynamodb.QueryInput) (*dynamodb.Qu
 	copy.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
 	startTime := time.Now()
 	output, err := c.Client.Query(&copy)
-	c.Profiler.AddDynamoDBRequestProfile("Query", time.Since(startTime))
+	var capacity []*dynamodb.ConsumedCapacity
 	if err == nil {
-		c.profileConsumedReadCapacity(output.ConsumedCapacity)
+		capacity = []*dynamodb.ConsumedCapacity{output.ConsumedCapacity}
 	}
+	size := payloadSize{
+		requestBytes: itemSize(input.ExclusiveStartKey) + itemSize(input.ExpressionAttributeValues),
+	}
+	if err == nil {
+		size.responseBytes = itemsSize(output.Items)
+		// Count is also given for queries that only select the count.
+		size.responseItems = int(aws.Int64Value(output.Count))
+	}
+	c.profile("Query", queryHashKey(input), time.Since(startTime), err, size, capacity, nil)
+	return output, err
+}
+
+func (c *ProfilingBackendClient) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	copy := *input
+	copy.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+	startTime := time.Now()
+	output, err := c.Client.Scan(&copy)
+	var capacity []*dynamodb.ConsumedCapacity
+	if err == nil {
+		capacity = []*dynamodb.ConsumedCapacity{output.ConsumedCapacity}
+	}
+	size := payloadSize{
+		requestBytes: itemSize(input.ExclusiveStartKey) + itemSize(input.ExpressionAttributeValues),
+	}
+	if err == nil {
+		size.responseBytes = itemsSize(output.Items)
+		size.responseItems = len(output.Items)
+	}
+	c.profile("Scan", "", time.Since(startTime), err, size, capacity, nil)
 	return output, err
 }
 
 func (c *ProfilingBackendClient) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
 	copy := *input
 	copy.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+	if copy.ReturnItemCollectionMetrics == nil {
+		copy.ReturnItemCollectionMetrics = c.returnItemCollectionMetrics()
+	}
 	startTime := time.Now()
 	output, err := c.Client.UpdateItem(&copy)
-	c.Profiler.AddDynamoDBRequestProfile("UpdateItem", time.Since(startTime))
+	var capacity []*dynamodb.ConsumedCapacity
+	var itemCollection *dynamodb.ItemCollectionMetrics
+	if err == nil {
+		capacity = []*dynamodb.ConsumedCapacity{output.ConsumedCapacity}
+		itemCollection = output.ItemCollectionMetrics
+	}
+	size := payloadSize{
+		requestBytes: itemSize(input.Key) + itemSize(input.ExpressionAttributeValues),
+	}
 	if err == nil {
-		c.profileConsumedWriteCapacity(output.ConsumedCapacity)
+		size.responseBytes = itemSize(output.Attributes)
 	}
+	c.profile("UpdateItem", hashKey(input.Key), time.Since(startTime), err, size, nil, capacity, itemCollection)
 	return output, err
 }
 
 func (c *ProfilingBackendClient) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
 	copy := *input
 	copy.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+	if copy.ReturnItemCollectionMetrics == nil {
+		copy.ReturnItemCollectionMetrics = c.returnItemCollectionMetrics()
+	}
 	startTime := time.Now()
 	output, err := c.Client.TransactWriteItems(&copy)
-	c.Profiler.AddDynamoDBRequestProfile("TransactWriteItem", time.Since(startTime))
+	var capacity []*dynamodb.ConsumedCapacity
+	var itemCollections []*dynamodb.ItemCollectionMetrics
 	if err == nil {
-		for _, capacity := range output.ConsumedCapacity {
-			c.profileConsumedWriteCapacity(capacity)
+		capacity = output.ConsumedCapacity
+		itemCollections = tableItemCollectionMetrics(output.ItemCollectionMetrics)
+	}
+	size := payloadSize{}
+	for _, item := range input.TransactItems {
+		switch {
+		case item.Put != nil:
+			size.requestBytes += itemSize(item.Put.Item) + itemSize(item.Put.ExpressionAttributeValues)
+		case item.Update != nil:
+			size.requestBytes += itemSize(item.Update.Key) + itemSize(item.Update.ExpressionAttributeValues)
+		case item.Delete != nil:
+			size.requestBytes += itemSize(item.Delete.Key) + itemSize(item.Delete.ExpressionAttributeValues)
+		case item.ConditionCheck != nil:
+			size.requestBytes += itemSize(item.ConditionCheck.Key) + itemSize(item.ConditionCheck.ExpressionAttributeValues)
 		}
 	}
+	c.profile("TransactWriteItems", "", time.Since(startTime), err, size, nil, capacity, itemCollections...)
 	return output, err
 }
@@ -3,7 +3,12 @@ package dynamodbstore
 import (
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
 )
 
 func TestProfiler(t *testing.T) {
@@ -33,3 +38,109 @@ func TestProfiler(t *testing.T) {
 	assert.Equal(t, 3, profiler.DynamoDBRequestCount())
 	assert.Equal(t, 1, profiler2.DynamoDBRequestCount())
 }
+
+type profilerTestClient struct {
+	BackendClient
+}
+
+func (c *profilerTestClient) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{
+		ConsumedCapacity: &dynamodb.ConsumedCapacity{
+			CapacityUnits: aws.Float64(0.5),
+		},
+		Item: newValueItem("foo", "_", attributeValue("barbaz")),
+	}, nil
+}
+
+type profilesRecorder struct {
+	profiles []*keyvaluestore.Profile
+}
+
+func (r *profilesRecorder) AddProfile(profile *keyvaluestore.Profile) {
+	r.profiles = append(r.profiles, profile)
+}
+
+func TestUnifiedProfiler(t *testing.T) {
+	backend := &Backend{
+		Client:    &profilerTestClient{},
+		TableName: "TestUnifiedProfiler",
+	}
+
+	profiler := &profilesRecorder{}
+	_, err := backend.WithProfiler(profiler).Get("foo")
+	require.NoError(t, err)
+
+	require.Len(t, profiler.profiles, 1)
+	profile := profiler.profiles[0]
+	assert.Equal(t, "GetItem", profile.Operation)
+	assert.Equal(t, "foo", profile.Key)
+	assert.NoError(t, profile.Err)
+	assert.Equal(t, 0.5, profile.Metadata["ConsumedReadCapacity"])
+	assert.Equal(t, 0.5, profile.ReadCapacity)
+	assert.Equal(t, len("hkfoo")+len("rk_"), profile.RequestBytes)
+	assert.Equal(t, len("hkfoo")+len("rk_")+len("vbarbaz"), profile.ResponseBytes)
+
+	sampled := &keyvaluestore.SampledProfiler{
+		Profiler: profiler,
+		Rate:     0.5,
+	}
+	for i := 0; i < 4; i++ {
+		_, err = backend.WithProfiler(sampled).Get("foo")
+		require.NoError(t, err)
+	}
+	assert.Len(t, profiler.profiles, 3)
+
+	basicProfiler := &keyvaluestore.BasicProfiler{}
+	_, err = backend.WithProfiler(basicProfiler).Get("foo")
+	require.NoError(t, err)
+	assert.Equal(t, 1, basicProfiler.RequestCount())
+	assert.Equal(t, 0, basicProfiler.ErrorCount())
+}
+
+type itemCollectionTestClient struct {
+	BackendClient
+	sizeGB float64
+	input  *dynamodb.PutItemInput
+}
+
+func (c *itemCollectionTestClient) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	c.input = input
+	output := &dynamodb.PutItemOutput{}
+	if input.ReturnItemCollectionMetrics != nil {
+		output.ItemCollectionMetrics = &dynamodb.ItemCollectionMetrics{
+			ItemCollectionKey:   map[string]*dynamodb.AttributeValue{"hk": input.Item["hk"]},
+			SizeEstimateRangeGB: []*float64{aws.Float64(c.sizeGB - 1), aws.Float64(c.sizeGB)},
+		}
+	}
+	return output, nil
+}
+
+func TestItemCollectionMetrics(t *testing.T) {
+	client := &itemCollectionTestClient{
+		sizeGB: 2,
+	}
+	logger := &testLogger{}
+	backend := &Backend{
+		Client:                client,
+		TableName:             "TestItemCollectionMetrics",
+		ItemCollectionMetrics: true,
+		Logger:                logger,
+	}
+
+	profiler := &profilesRecorder{}
+	require.NoError(t, backend.WithProfiler(profiler).Set("foo", "bar"))
+	assert.Equal(t, dynamodb.ReturnItemCollectionMetricsSize, *client.input.ReturnItemCollectionMetrics)
+	require.Len(t, profiler.profiles, 1)
+	assert.Equal(t, map[string]float64{"foo": 2}, profiler.profiles[0].Metadata["ItemCollectionSizeGB"])
+	assert.Empty(t, logger.warnings)
+
+	client.sizeGB = 9
+	require.NoError(t, backend.WithProfiler(profiler).Set("foo", "bar"))
+	assert.Len(t, logger.warnings, 1)
+
+	// Without the option, the metrics aren't requested.
+	backend.ItemCollectionMetrics = false
+	require.NoError(t, backend.WithProfiler(profiler).Set("foo", "bar"))
+	assert.Nil(t, client.input.ReturnItemCollectionMetrics)
+	assert.Nil(t, profiler.profiles[2].Metadata["ItemCollectionSizeGB"])
+}
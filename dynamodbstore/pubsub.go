@@ -0,0 +1,288 @@
+package dynamodbstore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// StreamsClient is the subset of the DynamoDB Streams API used by PubSub. It's implemented by
+// *dynamodbstreams.DynamoDBStreams.
+type StreamsClient interface {
+	DescribeStream(*dynamodbstreams.DescribeStreamInput) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(*dynamodbstreams.GetShardIteratorInput) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(*dynamodbstreams.GetRecordsInput) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
+// DefaultPubSubPollInterval is the poll interval used by PubSub if none is given.
+const DefaultPubSubPollInterval = time.Second
+
+// PubSub implements keyvaluestore.PubSub using DynamoDB Streams. Messages are published by writing
+// them to an item in the backend's table, and subscribers poll the table's stream for changes to
+// that item. The stream must be enabled with a view type that includes new images.
+//
+// Each channel is stored at the key "_pubsub:" followed by the channel name, so applications
+// shouldn't use keys with that prefix.
+//
+// Each subscription polls every shard of the stream. DynamoDB limits the rate at which streams can
+// be read, so subscriptions should be shared rather than created per request.
+type PubSub struct {
+	Backend   *Backend
+	Streams   StreamsClient
+	StreamARN string
+
+	// PollInterval is how often subscriptions poll the stream. If zero, DefaultPubSubPollInterval
+	// is used.
+	PollInterval time.Duration
+}
+
+var _ keyvaluestore.PubSub = (*PubSub)(nil)
+
+func pubSubKey(channel string) string {
+	return "_pubsub:" + channel
+}
+
+// Publish implements keyvaluestore.Publisher.
+func (p *PubSub) Publish(channel, message string) error {
+	// DynamoDB doesn't emit stream records for writes that don't change the item, so each message
+	// is given a nonce to ensure that repeated messages are delivered.
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	if _, err := p.Backend.Client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(p.Backend.TableName),
+		Item: newItem(pubSubKey(channel), "_", map[string]*dynamodb.AttributeValue{
+			"v": attributeValue(message),
+			"n": &dynamodb.AttributeValue{
+				B: nonce,
+			},
+		}),
+	}); err != nil {
+		return wrapError(err, "dynamodb put item request error")
+	}
+	return nil
+}
+
+// Subscribe implements keyvaluestore.Subscriber. Errors encountered while polling the stream are
+// retried at the next poll.
+func (p *PubSub) Subscribe(channel string) (<-chan string, func(), error) {
+	s := &streamSubscription{
+		pubsub: p,
+		key:    []byte(pubSubKey(channel)),
+		known:  map[string]bool{},
+		shards: map[string]*streamShard{},
+	}
+
+	// Start at the end of every open shard so that only messages published from now on are
+	// received.
+	if err := s.refreshShards(dynamodbstreams.ShardIteratorTypeLatest); err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan string)
+	done := make(chan struct{})
+	go s.run(ch, done)
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			close(done)
+		})
+	}, nil
+}
+
+type streamSubscription struct {
+	pubsub *PubSub
+	key    []byte
+
+	// known contains the ids of all shards that have been seen, including closed ones.
+	known map[string]bool
+
+	// shards contains the shards that are still being read.
+	shards map[string]*streamShard
+}
+
+type streamShard struct {
+	parentId           string
+	iterator           *string
+	lastSequenceNumber *string
+}
+
+func (s *streamSubscription) run(ch chan<- string, done <-chan struct{}) {
+	defer close(ch)
+
+	interval := s.pubsub.PollInterval
+	if interval == 0 {
+		interval = DefaultPubSubPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+
+		messages, needsRefresh := s.poll()
+		for _, message := range messages {
+			select {
+			case ch <- message:
+			case <-done:
+				return
+			}
+		}
+
+		if needsRefresh || len(s.shards) == 0 {
+			// Shards that appear after the subscription started only contain new records, so
+			// they're read from the beginning.
+			s.refreshShards(dynamodbstreams.ShardIteratorTypeTrimHorizon)
+		}
+	}
+}
+
+// poll reads new records from every shard. It returns the messages found and whether any shards
+// were closed, in which case new shards should be discovered.
+func (s *streamSubscription) poll() ([]string, bool) {
+	var messages []string
+	needsRefresh := false
+
+	for id, shard := range s.shards {
+		if _, ok := s.shards[shard.parentId]; ok {
+			// Records for the same item are only ordered if parents are read before children.
+			continue
+		}
+
+		if shard.iterator == nil {
+			if err := s.resume(id, shard); err != nil {
+				continue
+			}
+		}
+
+		output, err := s.pubsub.Streams.GetRecords(&dynamodbstreams.GetRecordsInput{
+			ShardIterator: shard.iterator,
+		})
+		if err != nil {
+			var awsErr awserr.Error
+			if errors.As(err, &awsErr) && awsErr.Code() == dynamodbstreams.ErrCodeExpiredIteratorException {
+				shard.iterator = nil
+			}
+			continue
+		}
+
+		for _, record := range output.Records {
+			if record.Dynamodb == nil {
+				continue
+			}
+			shard.lastSequenceNumber = record.Dynamodb.SequenceNumber
+			if message, ok := s.message(record); ok {
+				messages = append(messages, message)
+			}
+		}
+
+		if output.NextShardIterator == nil {
+			delete(s.shards, id)
+			needsRefresh = true
+		} else {
+			shard.iterator = output.NextShardIterator
+		}
+	}
+
+	return messages, needsRefresh
+}
+
+// resume gets a new iterator for a shard whose iterator has expired.
+func (s *streamSubscription) resume(id string, shard *streamShard) error {
+	input := &dynamodbstreams.GetShardIteratorInput{
+		ShardId:           aws.String(id),
+		ShardIteratorType: aws.String(dynamodbstreams.ShardIteratorTypeLatest),
+		StreamArn:         aws.String(s.pubsub.StreamARN),
+	}
+	if shard.lastSequenceNumber != nil {
+		input.ShardIteratorType = aws.String(dynamodbstreams.ShardIteratorTypeAfterSequenceNumber)
+		input.SequenceNumber = shard.lastSequenceNumber
+	}
+	output, err := s.pubsub.Streams.GetShardIterator(input)
+	if err != nil {
+		return wrapError(err, "dynamodb streams get shard iterator request error")
+	}
+	shard.iterator = output.ShardIterator
+	return nil
+}
+
+func (s *streamSubscription) message(record *dynamodbstreams.Record) (string, bool) {
+	switch aws.StringValue(record.EventName) {
+	case dynamodbstreams.OperationTypeInsert, dynamodbstreams.OperationTypeModify:
+	default:
+		return "", false
+	}
+	if hk := record.Dynamodb.Keys["hk"]; hk == nil || !bytes.Equal(hk.B, s.key) {
+		return "", false
+	}
+	v := record.Dynamodb.NewImage["v"]
+	if v == nil {
+		return "", false
+	}
+	return string(v.B), true
+}
+
+// refreshShards discovers shards that haven't been seen before and starts reading the open ones
+// using the given iterator type.
+func (s *streamSubscription) refreshShards(iteratorType string) error {
+	var exclusiveStartShardId *string
+	for {
+		output, err := s.pubsub.Streams.DescribeStream(&dynamodbstreams.DescribeStreamInput{
+			ExclusiveStartShardId: exclusiveStartShardId,
+			StreamArn:             aws.String(s.pubsub.StreamARN),
+		})
+		if err != nil {
+			return wrapError(err, "dynamodb streams describe stream request error")
+		}
+		description := output.StreamDescription
+		if description == nil {
+			return nil
+		}
+
+		for _, shard := range description.Shards {
+			id := aws.StringValue(shard.ShardId)
+			if s.known[id] {
+				continue
+			}
+			closed := shard.SequenceNumberRange != nil && shard.SequenceNumberRange.EndingSequenceNumber != nil
+			if closed && iteratorType == dynamodbstreams.ShardIteratorTypeLatest {
+				// There will never be anything after the end of a closed shard.
+				s.known[id] = true
+				continue
+			}
+			iterator, err := s.pubsub.Streams.GetShardIterator(&dynamodbstreams.GetShardIteratorInput{
+				ShardId:           shard.ShardId,
+				ShardIteratorType: aws.String(iteratorType),
+				StreamArn:         aws.String(s.pubsub.StreamARN),
+			})
+			if err != nil {
+				return wrapError(err, "dynamodb streams get shard iterator request error")
+			}
+			s.known[id] = true
+			s.shards[id] = &streamShard{
+				parentId: aws.StringValue(shard.ParentShardId),
+				iterator: iterator.ShardIterator,
+			}
+		}
+
+		if description.LastEvaluatedShardId == nil {
+			return nil
+		}
+		exclusiveStartShardId = description.LastEvaluatedShardId
+	}
+}
@@ -0,0 +1,163 @@
+package dynamodbstore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+)
+
+type fakeStreamShard struct {
+	records []*dynamodbstreams.Record
+	closed  bool
+}
+
+// fakeStream writes items to an in-memory stream, which can be read via the streams API.
+type fakeStream struct {
+	*dynamodb.DynamoDB
+
+	mutex  sync.Mutex
+	shards []*fakeStreamShard
+}
+
+func newFakeStream() *fakeStream {
+	return &fakeStream{
+		shards: []*fakeStreamShard{{}},
+	}
+}
+
+// rollOver closes the current shard and opens a new one.
+func (s *fakeStream) rollOver() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.shards[len(s.shards)-1].closed = true
+	s.shards = append(s.shards, &fakeStreamShard{})
+}
+
+func (s *fakeStream) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	shard := s.shards[len(s.shards)-1]
+	shard.records = append(shard.records, &dynamodbstreams.Record{
+		EventName: aws.String(dynamodbstreams.OperationTypeModify),
+		Dynamodb: &dynamodbstreams.StreamRecord{
+			Keys: map[string]*dynamodb.AttributeValue{
+				"hk": input.Item["hk"],
+				"rk": input.Item["rk"],
+			},
+			NewImage:       input.Item,
+			SequenceNumber: aws.String(strconv.Itoa(len(shard.records))),
+		},
+	})
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (s *fakeStream) DescribeStream(input *dynamodbstreams.DescribeStreamInput) (*dynamodbstreams.DescribeStreamOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	description := &dynamodbstreams.StreamDescription{}
+	for i, shard := range s.shards {
+		r := &dynamodbstreams.SequenceNumberRange{}
+		if shard.closed {
+			r.EndingSequenceNumber = aws.String(strconv.Itoa(len(shard.records)))
+		}
+		description.Shards = append(description.Shards, &dynamodbstreams.Shard{
+			ShardId:             aws.String(strconv.Itoa(i)),
+			SequenceNumberRange: r,
+		})
+		if i > 0 {
+			description.Shards[i].ParentShardId = aws.String(strconv.Itoa(i - 1))
+		}
+	}
+	return &dynamodbstreams.DescribeStreamOutput{
+		StreamDescription: description,
+	}, nil
+}
+
+func (s *fakeStream) GetShardIterator(input *dynamodbstreams.GetShardIteratorInput) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := aws.StringValue(input.ShardId)
+	i, _ := strconv.Atoi(id)
+	position := 0
+	switch aws.StringValue(input.ShardIteratorType) {
+	case dynamodbstreams.ShardIteratorTypeLatest:
+		position = len(s.shards[i].records)
+	case dynamodbstreams.ShardIteratorTypeAfterSequenceNumber:
+		position, _ = strconv.Atoi(aws.StringValue(input.SequenceNumber))
+		position++
+	}
+	return &dynamodbstreams.GetShardIteratorOutput{
+		ShardIterator: aws.String(fmt.Sprintf("%v:%v", i, position)),
+	}, nil
+}
+
+func (s *fakeStream) GetRecords(input *dynamodbstreams.GetRecordsInput) (*dynamodbstreams.GetRecordsOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	parts := strings.Split(aws.StringValue(input.ShardIterator), ":")
+	i, _ := strconv.Atoi(parts[0])
+	position, _ := strconv.Atoi(parts[1])
+	shard := s.shards[i]
+	ret := &dynamodbstreams.GetRecordsOutput{
+		Records: shard.records[position:],
+	}
+	if !shard.closed {
+		ret.NextShardIterator = aws.String(fmt.Sprintf("%v:%v", i, len(shard.records)))
+	}
+	return ret, nil
+}
+
+func TestPubSub(t *testing.T) {
+	newPubSub := func() (*PubSub, *fakeStream) {
+		stream := newFakeStream()
+		return &PubSub{
+			Backend: &Backend{
+				Client:    stream,
+				TableName: "test",
+			},
+			Streams:      stream,
+			StreamARN:    "arn",
+			PollInterval: 10 * time.Millisecond,
+		}, stream
+	}
+
+	keyvaluestoretest.TestPubSub(t, func() keyvaluestore.PubSub {
+		ps, _ := newPubSub()
+		return ps
+	})
+
+	t.Run("ShardRollover", func(t *testing.T) {
+		ps, stream := newPubSub()
+		stream.rollOver()
+
+		ch, cancel, err := ps.Subscribe("foo")
+		require.NoError(t, err)
+		defer cancel()
+
+		for _, message := range []string{"a", "b", "c"} {
+			require.NoError(t, ps.Publish("foo", message))
+			stream.rollOver()
+		}
+
+		for _, expected := range []string{"a", "b", "c"} {
+			select {
+			case message := <-ch:
+				assert.Equal(t, expected, message)
+			case <-time.After(10 * time.Second):
+				t.Fatal("timed out waiting for message")
+			}
+		}
+	})
+}
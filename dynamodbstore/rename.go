@@ -0,0 +1,188 @@
+package dynamodbstore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+var _ keyvaluestore.Renamer = &Backend{}
+
+// RenameLockTTL is how long a rename holds its locks. If a process dies mid-rename, the keys can be
+// renamed again once the locks expire.
+const RenameLockTTL = 10 * time.Minute
+
+func renameLockKey(key string) string {
+	return "_rename:" + key
+}
+
+// RenameCollection copies the source's items to the destination in chunks, removes any of the
+// destination's items that weren't overwritten, and then deletes the source's items. Since DynamoDB
+// transactions are limited to 100 items, the rename isn't atomic: readers may see members of both
+// collections at the destination while it's in progress, and a rename that fails partway through
+// may leave members at both keys. Readers never see the destination empty, which makes renames
+// suitable for cutting over to a rebuilt index.
+//
+// Both keys are locked for the duration of the rename, so concurrent renames involving either key
+// fail with a *keyvaluestore.AtomicWriteConflictError. Other writes aren't blocked, so writes to
+// the source during the rename may be lost.
+func (b *Backend) RenameCollection(src, dst string) (bool, error) {
+	if src == dst {
+		return false, fmt.Errorf("unable to rename %v to itself", src)
+	}
+	if err := b.lockForRename(src); err != nil {
+		return false, err
+	}
+	defer b.unlockForRename(src)
+	if err := b.lockForRename(dst); err != nil {
+		return false, err
+	}
+	defer b.unlockForRename(dst)
+
+	srcItems, err := b.queryItems(src, nil)
+	if err != nil || len(srcItems) == 0 {
+		return false, err
+	}
+	dstKeys, err := b.queryItems(dst, aws.String("hk, rk"))
+	if err != nil {
+		return false, err
+	}
+
+	var requests []*dynamodb.WriteRequest
+	overwritten := make(map[string]struct{}, len(srcItems))
+	for _, item := range srcItems {
+		moved := make(map[string]*dynamodb.AttributeValue, len(item))
+		for name, attr := range item {
+			moved[name] = attr
+		}
+		moved["hk"] = attributeValue(dst)
+		requests = append(requests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{
+				Item: moved,
+			},
+		})
+		overwritten[string(item["rk"].B)] = struct{}{}
+	}
+	if err := b.batchWrite(requests); err != nil {
+		return false, err
+	}
+
+	requests = requests[:0]
+	for _, item := range dstKeys {
+		if _, ok := overwritten[string(item["rk"].B)]; !ok {
+			requests = append(requests, &dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{
+					Key: compositeKey(dst, string(item["rk"].B)),
+				},
+			})
+		}
+	}
+	for _, item := range srcItems {
+		requests = append(requests, &dynamodb.WriteRequest{
+			DeleteRequest: &dynamodb.DeleteRequest{
+				Key: compositeKey(src, string(item["rk"].B)),
+			},
+		})
+	}
+	if err := b.batchWrite(requests); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *Backend) lockForRename(key string) error {
+	now := time.Now()
+	if _, err := b.Client.PutItem(&dynamodb.PutItemInput{
+		TableName:           b.tableName(),
+		Item:                newValueItem(renameLockKey(key), "_", attributeValue(now.Add(RenameLockTTL).UnixNano())),
+		ConditionExpression: aws.String("attribute_not_exists(v) or v < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": attributeValue(now.UnixNano()),
+		},
+	}); err != nil {
+		if err, ok := err.(awserr.Error); ok && err.Code() == "ConditionalCheckFailedException" {
+			conflict := &keyvaluestore.AtomicWriteConflictError{
+				Err: fmt.Errorf("%v is already being renamed", key),
+			}
+			b.profileConflict("RenameCollection", key, conflict)
+			return conflict
+		}
+		return wrapError(err, "dynamodb put item request error")
+	}
+	return nil
+}
+
+// unlockForRename is best-effort. If it fails, the lock expires after RenameLockTTL.
+func (b *Backend) unlockForRename(key string) {
+	b.Client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: b.tableName(),
+		Key:       compositeKey(renameLockKey(key), "_"),
+	})
+}
+
+// queryItems reads all of a key's items with strong consistency. If projection is given, only
+// those attributes are read.
+func (b *Backend) queryItems(key string, projection *string) ([]map[string]*dynamodb.AttributeValue, error) {
+	var items []map[string]*dynamodb.AttributeValue
+	var startKey map[string]*dynamodb.AttributeValue
+	for {
+		if err := b.checkDeadline(); err != nil {
+			return nil, err
+		}
+		result, err := b.Client.Query(&dynamodb.QueryInput{
+			TableName:              b.tableName(),
+			ConsistentRead:         aws.Bool(true),
+			KeyConditionExpression: aws.String("hk = :hk"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":hk": attributeValue(key),
+			},
+			ProjectionExpression: projection,
+			ExclusiveStartKey:    startKey,
+		})
+		if err != nil {
+			return nil, wrapError(err, "dynamodb query request error")
+		}
+		items = append(items, result.Items...)
+		if result.LastEvaluatedKey == nil {
+			return items, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// batchWrite performs the requests in chunks of 25, retrying any unprocessed items.
+func (b *Backend) batchWrite(requests []*dynamodb.WriteRequest) error {
+	for len(requests) > 0 {
+		batch := requests
+		const maxBatchSize = 25
+		if len(batch) > maxBatchSize {
+			batch = requests[:maxBatchSize]
+		}
+		requests = requests[len(batch):]
+
+		unprocessed := map[string][]*dynamodb.WriteRequest{
+			b.TableName: batch,
+		}
+		for len(unprocessed) > 0 {
+			if err := b.checkDeadline(); err != nil {
+				return err
+			}
+			result, err := b.Client.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+				RequestItems: unprocessed,
+			})
+			if err != nil {
+				return wrapError(err, "dynamodb batch write item request error")
+			}
+			unprocessed = result.UnprocessedItems
+			if len(unprocessed) > 0 {
+				b.warn("dynamodb batch write left items unprocessed", "items", len(unprocessed[b.TableName]))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package dynamodbstore
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy determines how operations that are implemented via optimistic concurrency, such as
+// ZIncrBy, are retried when they fail due to contention.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the operation is attempted.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry. It doubles with each subsequent retry, up to
+	// MaxBackoff if it's non-zero.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction of each delay that's randomized, between 0 and 1. Randomizing the
+	// delays prevents contending processes from retrying in lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used by backends that don't specify a ContentionRetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	Backoff:     10 * time.Millisecond,
+	MaxBackoff:  200 * time.Millisecond,
+	Jitter:      0.5,
+}
+
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.Backoff
+	for i := 0; i < retry && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d - time.Duration(rand.Float64()*p.Jitter*float64(d))
+}
+
+func (b *Backend) retryPolicy() RetryPolicy {
+	if b.ContentionRetryPolicy != nil {
+		return *b.ContentionRetryPolicy
+	}
+	return DefaultRetryPolicy
+}
+
+// ContentionProfiler can be implemented by profilers that want to know how often operations are
+// retried due to contention. BasicProfiler and keyvaluestore.Profiler adapters implement it.
+type ContentionProfiler interface {
+	AddDynamoDBContentionRetries(operationName, key string, retries int, err error)
+}
+
+// runContentiousMethod invokes f until it succeeds, returns an error, or the retry policy's
+// attempts are exhausted. f should return false if it failed due to contention.
+func (b *Backend) runContentiousMethod(operation, key string, f func() (bool, error)) error {
+	policy := b.retryPolicy()
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	retries := 0
+	err := func() error {
+		for ; ; retries++ {
+			if retries > 0 {
+				if err := b.sleep(policy.delay(retries - 1)); err != nil {
+					return err
+				}
+			}
+			success, err := f()
+			if err != nil {
+				return err
+			} else if success {
+				return nil
+			} else if retries+1 >= attempts {
+				return fmt.Errorf("unable to run method due to contention, tried %d times", attempts)
+			}
+		}
+	}()
+	if retries > 0 && err != nil {
+		b.warn("dynamodb operation failed after contention retries", "operation", operation, "key", key, "retries", retries, "error", err)
+	}
+	if retries > 0 {
+		if c, ok := b.Client.(*ProfilingBackendClient); ok {
+			if p, ok := c.Profiler.(ContentionProfiler); ok {
+				p.AddDynamoDBContentionRetries(operation, key, retries, err)
+			}
+		}
+	}
+	return err
+}
+
+// conflictProfiler is implemented by profilers that want to know how often operations fail with
+// keyvaluestore.AtomicWriteConflictError.
+type conflictProfiler interface {
+	addConflictProfile(operation, key string, err error)
+}
+
+// profileConflict reports an AtomicWriteConflictError to the backend's profiler, if it has one.
+func (b *Backend) profileConflict(operation, key string, err error) {
+	if c, ok := b.Client.(*ProfilingBackendClient); ok {
+		if p, ok := c.Profiler.(conflictProfiler); ok {
+			p.addConflictProfile(operation, key, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package dynamodbstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/internal/sortkey"
+)
+
+// contendedBackendClient fails conditional puts as if another process had modified the item until
+// failures reaches zero.
+type contendedBackendClient struct {
+	nopBackendClient
+	failures int
+}
+
+func (c *contendedBackendClient) GetItem(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{
+		Item: map[string]*dynamodb.AttributeValue{
+			"rk2": {B: []byte(sortkey.Float(1) + "bar")},
+		},
+	}, nil
+}
+
+func (c *contendedBackendClient) PutItem(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	if c.failures > 0 {
+		c.failures--
+		return nil, awserr.New("ConditionalCheckFailedException", "the conditional request failed", nil)
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+type testLogger struct {
+	warnings []string
+}
+
+func (l *testLogger) Warn(msg string, args ...interface{}) {
+	l.warnings = append(l.warnings, msg)
+}
+
+func TestContentionRetryPolicy(t *testing.T) {
+	client := &contendedBackendClient{
+		failures: 2,
+	}
+	logger := &testLogger{}
+	backend := &Backend{
+		Client:    client,
+		TableName: "TestContentionRetryPolicy",
+		ContentionRetryPolicy: &RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     time.Millisecond,
+			Jitter:      0.5,
+		},
+		Logger: logger,
+	}
+	profiler := &BasicProfiler{}
+
+	n, err := backend.WithProfiler(profiler).ZIncrBy("foo", "bar", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, n)
+	assert.Equal(t, 2, profiler.DynamoDBContentionRetryCount())
+	assert.Empty(t, logger.warnings)
+
+	client.failures = 3
+	_, err = backend.WithProfiler(profiler).ZIncrBy("foo", "bar", 1)
+	assert.Error(t, err)
+	assert.Equal(t, 4, profiler.DynamoDBContentionRetryCount())
+	assert.Len(t, logger.warnings, 1)
+}
+
+func TestContentionProfiling(t *testing.T) {
+	client := &contendedBackendClient{
+		failures: 1,
+	}
+	backend := &Backend{
+		Client:    client,
+		TableName: "TestContentionProfiling",
+		ContentionRetryPolicy: &RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     time.Millisecond,
+		},
+	}
+	profiler := &keyvaluestore.BasicProfiler{}
+	profiled := backend.WithProfiler(profiler)
+
+	_, err := profiled.ZIncrBy("foo", "bar", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, profiler.RetryCount())
+	assert.Equal(t, 0, profiler.ConflictCount())
+
+	client.failures = 1
+	_, err = keyvaluestore.RenameCollection(profiled, "foo", "bar")
+	var conflict *keyvaluestore.AtomicWriteConflictError
+	assert.True(t, errors.As(err, &conflict))
+	assert.Equal(t, 1, profiler.ConflictCount())
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{
+		Backoff:    10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+	}
+	assert.Equal(t, 10*time.Millisecond, policy.delay(0))
+	assert.Equal(t, 20*time.Millisecond, policy.delay(1))
+	assert.Equal(t, 50*time.Millisecond, policy.delay(3))
+	assert.Equal(t, 50*time.Millisecond, policy.delay(100))
+
+	policy.Jitter = 1
+	for i := 0; i < 10; i++ {
+		assert.True(t, policy.delay(0) <= 10*time.Millisecond)
+	}
+}
@@ -0,0 +1,276 @@
+package dynamodbstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+var _ keyvaluestore.Scanner = &Backend{}
+var _ keyvaluestore.SegmentedScanner = &Backend{}
+
+// Scan is equivalent to ScanSegment with a single segment.
+func (b *Backend) Scan(cursor string, limit int) ([]*keyvaluestore.Entry, string, error) {
+	return b.ScanSegment(0, 1, cursor, limit)
+}
+
+// ScanSegment is implemented via DynamoDB's parallel Scan API, so each segment can be scanned by a
+// different goroutine or process. Each request reads up to limit items. Sorted sets are read in
+// their entirety via additional queries when they're first encountered, so pages containing them
+// may be much larger than limit.
+//
+// If the backend has a ScanLimiter, requests are paced by it and throttled requests are retried.
+func (b *Backend) ScanSegment(segment, totalSegments int, cursor string, limit int) ([]*keyvaluestore.Entry, string, error) {
+	var c scanCursor
+	if cursor != "" {
+		buf, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || json.Unmarshal(buf, &c) != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %v", cursor)
+		}
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName:              b.tableName(),
+		ConsistentRead:         b.consistentRead(),
+		ExclusiveStartKey:      c.StartKey,
+		Segment:                aws.Int64(int64(segment)),
+		TotalSegments:          aws.Int64(int64(totalSegments)),
+		ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	}
+	if limit > 0 {
+		input.Limit = aws.Int64(int64(limit))
+	}
+	result, err := b.scan(input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var entries []*keyvaluestore.Entry
+	for _, item := range result.Items {
+		hk, rk := item["hk"], item["rk"]
+		if hk == nil || rk == nil || bytes.Equal(hk.B, c.SkipKey) {
+			continue
+		}
+		key := string(hk.B)
+		if strings.HasPrefix(key, pubSubKey("")) || strings.HasPrefix(key, renameLockKey("")) {
+			continue
+		}
+
+		if string(rk.B) == "_" {
+			if entry := scanEntry(key, item); entry != nil {
+				entries = append(entries, entry)
+			}
+			continue
+		}
+
+		// This is the first member of a sorted set. A key's items are contiguous within its
+		// segment, so the rest of them can be skipped once the whole set has been read.
+		members, err := b.ZHRangeByScoreWithFields(key, math.Inf(-1), math.Inf(1), 0)
+		if err != nil {
+			return nil, "", err
+		}
+		c.SkipKey = hk.B
+		if len(members) == 0 {
+			continue
+		}
+		entry := &keyvaluestore.Entry{
+			Key:              key,
+			Type:             keyvaluestore.EntryTypeSortedSet,
+			SortedSetMembers: make([]keyvaluestore.SortedSetEntryMember, len(members)),
+		}
+		for i, member := range members {
+			entry.SortedSetMembers[i] = keyvaluestore.SortedSetEntryMember{
+				Field: member.Field,
+				Value: member.Value,
+				Score: member.Score,
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	if result.LastEvaluatedKey == nil {
+		return entries, "", nil
+	}
+	c.StartKey = result.LastEvaluatedKey
+	buf, err := json.Marshal(c)
+	if err != nil {
+		// Attribute values only contain strings, byte slices, and other JSON-friendly types.
+		panic(err)
+	}
+	return entries, base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// scanCursor is the decoded form of the cursors returned by ScanSegment.
+type scanCursor struct {
+	// StartKey is the key after which the next request starts.
+	StartKey map[string]*dynamodb.AttributeValue `json:",omitempty"`
+
+	// SkipKey is the sorted set that was most recently read. Any of its items that remain in the
+	// segment are skipped.
+	SkipKey []byte `json:",omitempty"`
+}
+
+// scanEntry returns the entry for an item with the sort key "_", or nil if the item is empty.
+func scanEntry(key string, item map[string]*dynamodb.AttributeValue) *keyvaluestore.Entry {
+	entry := &keyvaluestore.Entry{
+		Key: key,
+	}
+	if v := item["v"]; v != nil {
+		if members := attributeStringSliceValue(v); members != nil {
+			sort.Strings(members)
+			entry.Type = keyvaluestore.EntryTypeSet
+			entry.Members = members
+			return entry
+		} else if value := attributeStringValue(v); value != nil {
+			entry.Type = keyvaluestore.EntryTypeString
+			entry.Value = *value
+			return entry
+		}
+	}
+	for k, v := range item {
+		if name := decodeHashFieldName(k); name != "" {
+			if v := attributeStringValue(v); v != nil {
+				if entry.Fields == nil {
+					entry.Fields = map[string]string{}
+				}
+				entry.Fields[name] = *v
+			}
+		}
+	}
+	if entry.Fields == nil {
+		// Sets and hashes leave their items behind once they're emptied.
+		return nil
+	}
+	entry.Type = keyvaluestore.EntryTypeHash
+	return entry
+}
+
+// maxScanAttempts is the number of times a throttled scan request is attempted before giving up.
+const maxScanAttempts = 10
+
+// scan makes a scan request, pacing it via the backend's ScanLimiter if it has one.
+func (b *Backend) scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	l := b.ScanLimiter
+	if l == nil {
+		result, err := b.Client.Scan(input)
+		if err != nil {
+			return nil, wrapError(err, "dynamodb scan request error")
+		}
+		return result, nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		delay, estimate := l.reserve()
+		if err := b.sleep(delay); err != nil {
+			return nil, err
+		}
+		result, err := b.Client.Scan(input)
+		if err == nil {
+			units := 0.0
+			if result.ConsumedCapacity != nil && result.ConsumedCapacity.CapacityUnits != nil {
+				units = *result.ConsumedCapacity.CapacityUnits
+			}
+			l.consumed(units, estimate)
+			return result, nil
+		}
+		err = wrapError(err, "dynamodb scan request error")
+		if !errors.Is(err, keyvaluestore.ErrThrottled) || attempt >= maxScanAttempts {
+			return nil, err
+		}
+		l.throttled()
+	}
+}
+
+// ScanLimiter paces scans so that they consume read capacity at a steady rate. Unpaced scans of
+// large tables, especially parallel ones, can consume all of a table's provisioned throughput and
+// cause the application's requests to be throttled.
+//
+// The limiter adapts to throttling: whenever a scan request is throttled, the rate is halved and the
+// request is retried. The rate then recovers gradually. A limiter is safe for concurrent use, and
+// all segments of a parallel scan should share one.
+type ScanLimiter struct {
+	// CapacityUnitsPerSecond is the maximum rate at which scans consume read capacity units. It
+	// should be the table's provisioned read capacity minus what the application needs. Strongly
+	// consistent reads consume twice as much capacity as eventually consistent ones. It must be
+	// positive.
+	CapacityUnitsPerSecond float64
+
+	mutex sync.Mutex
+
+	// rate is the current rate, which is lower than CapacityUnitsPerSecond after throttling.
+	rate float64
+
+	// next is when the next request may be made.
+	next time.Time
+
+	// estimate is the expected cost of the next request, which is the cost of the last one.
+	estimate float64
+}
+
+func (l *ScanLimiter) duration(units float64) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+	return time.Duration(units / l.rate * float64(time.Second))
+}
+
+// reserve returns how long to wait before making a request. Capacity is reserved for the request
+// based on the cost of the previous one, and the estimate is returned so that the reservation can be
+// corrected once the actual cost is known.
+func (l *ScanLimiter) reserve() (time.Duration, float64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.rate == 0 {
+		l.rate = l.CapacityUnitsPerSecond
+	}
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.duration(l.estimate))
+	return start.Sub(now), l.estimate
+}
+
+// consumed corrects the reservation of a successful request and gradually restores the rate.
+func (l *ScanLimiter) consumed(units, estimate float64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.next = l.next.Add(l.duration(units - estimate))
+	l.estimate = units
+	l.rate = math.Min(l.rate+l.CapacityUnitsPerSecond/20, l.CapacityUnitsPerSecond)
+}
+
+// throttled halves the rate, down to a minimum of 1/64th of CapacityUnitsPerSecond, and delays
+// the next request by at least the time it takes to accrue one capacity unit.
+func (l *ScanLimiter) throttled() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.rate = math.Max(l.rate/2, l.CapacityUnitsPerSecond/64)
+	if now := time.Now(); l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(l.duration(math.Max(l.estimate, 1)))
+}
+
+// Rate returns the rate at which the limiter currently allows capacity to be consumed.
+func (l *ScanLimiter) Rate() float64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.rate == 0 {
+		return l.CapacityUnitsPerSecond
+	}
+	return l.rate
+}
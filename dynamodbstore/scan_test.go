@@ -0,0 +1,162 @@
+package dynamodbstore
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+func TestScanSegment(t *testing.T) {
+	client, err := newDynamoDBTestClient()
+	if err != nil {
+		t.Fatal(err)
+	} else if client == nil {
+		t.Skip("no dynamodb server available. to start one: docker run -p 8000:8000 --rm -it amazon/dynamodb-local")
+	}
+
+	b := newTestBackend(client, "TestScanSegment")
+	b.ScanLimiter = &ScanLimiter{
+		CapacityUnitsPerSecond: 1000,
+	}
+	require.NoError(t, b.Set("string", "foo"))
+	require.NoError(t, b.SAdd("set", "b", "a"))
+	require.NoError(t, b.HSet("hash", "field", "value"))
+	require.NoError(t, b.SAdd("emptyset", "a"))
+	require.NoError(t, b.SRem("emptyset", "a"))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, b.ZAdd("zset", string(rune('a'+i)), float64(-i)))
+	}
+	require.NoError(t, b.ZHAdd("zset", "foo", "bar", 10))
+
+	const totalSegments = 3
+	var entries []*keyvaluestore.Entry
+	for segment := 0; segment < totalSegments; segment++ {
+		cursor := ""
+		for {
+			page, next, err := b.ScanSegment(segment, totalSegments, cursor, 2)
+			require.NoError(t, err)
+			entries = append(entries, page...)
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	assert.Equal(t, []*keyvaluestore.Entry{
+		{
+			Key:    "hash",
+			Type:   keyvaluestore.EntryTypeHash,
+			Fields: map[string]string{"field": "value"},
+		},
+		{
+			Key:     "set",
+			Type:    keyvaluestore.EntryTypeSet,
+			Members: []string{"a", "b"},
+		},
+		{
+			Key:   "string",
+			Type:  keyvaluestore.EntryTypeString,
+			Value: "foo",
+		},
+		{
+			Key:  "zset",
+			Type: keyvaluestore.EntryTypeSortedSet,
+			SortedSetMembers: []keyvaluestore.SortedSetEntryMember{
+				{Field: "e", Value: "e", Score: -4},
+				{Field: "d", Value: "d", Score: -3},
+				{Field: "c", Value: "c", Score: -2},
+				{Field: "b", Value: "b", Score: -1},
+				{Field: "a", Value: "a", Score: 0},
+				{Field: "foo", Value: "bar", Score: 10},
+			},
+		},
+	}, entries)
+}
+
+// throttledScanBackendClient throttles the first scan request, then returns a single string.
+type throttledScanBackendClient struct {
+	nopBackendClient
+	requests int
+}
+
+func (c *throttledScanBackendClient) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	c.requests++
+	if c.requests == 1 {
+		return nil, awserr.New("ProvisionedThroughputExceededException", "The level of configured provisioned throughput for the table was exceeded.", nil)
+	}
+	return &dynamodb.ScanOutput{
+		ConsumedCapacity: &dynamodb.ConsumedCapacity{
+			CapacityUnits: aws.Float64(1),
+		},
+		Items: []map[string]*dynamodb.AttributeValue{
+			newValueItem("foo", "_", attributeValue("bar")),
+		},
+	}, nil
+}
+
+func TestScanThrottling(t *testing.T) {
+	client := &throttledScanBackendClient{}
+	b := &Backend{
+		Client:    client,
+		TableName: "TestScanThrottling",
+		ScanLimiter: &ScanLimiter{
+			CapacityUnitsPerSecond: 1000,
+		},
+	}
+
+	entries, cursor, err := b.Scan("", 100)
+	require.NoError(t, err)
+	assert.Empty(t, cursor)
+	assert.Equal(t, []*keyvaluestore.Entry{
+		{
+			Key:   "foo",
+			Type:  keyvaluestore.EntryTypeString,
+			Value: "bar",
+		},
+	}, entries)
+	assert.Equal(t, 2, client.requests)
+
+	// The rate is halved by the throttling, then partially restored by the successful request.
+	assert.Equal(t, 550.0, b.ScanLimiter.Rate())
+
+	// Without a limiter, throttling errors are returned.
+	b.ScanLimiter = nil
+	client.requests = 0
+	_, _, err = b.Scan("", 100)
+	assert.True(t, errors.Is(err, keyvaluestore.ErrThrottled))
+}
+
+func TestScanLimiter(t *testing.T) {
+	l := &ScanLimiter{
+		CapacityUnitsPerSecond: 100,
+	}
+
+	// The first request's cost isn't known, so it doesn't wait.
+	delay, estimate := l.reserve()
+	assert.Equal(t, time.Duration(0), delay)
+	l.consumed(10, estimate)
+
+	// The next requests are expected to cost the same, so they're spaced 100ms apart.
+	delay, _ = l.reserve()
+	assert.InDelta(t, 100*time.Millisecond, delay, float64(10*time.Millisecond))
+	delay, _ = l.reserve()
+	assert.InDelta(t, 200*time.Millisecond, delay, float64(10*time.Millisecond))
+
+	for i := 0; i < 10; i++ {
+		l.throttled()
+	}
+	assert.Equal(t, 100.0/64, l.Rate())
+}
@@ -0,0 +1,49 @@
+package keyvaluestore
+
+import "errors"
+
+// Backends translate their native errors into these so that callers can handle common failures
+// using errors.Is without knowing which backend they're talking to.
+var (
+	// ErrNotSupported indicates that the backend doesn't support the requested operation.
+	ErrNotSupported = errors.New("operation not supported")
+
+	// ErrWrongType indicates that an operation was run against a key holding the wrong kind of
+	// value, e.g. NIncrBy on a non-integer or SAdd on a hash.
+	ErrWrongType = errors.New("wrong type")
+
+	// ErrValueTooLarge indicates that a key, value, or write exceeds one of the backend's size
+	// limits.
+	ErrValueTooLarge = errors.New("value too large")
+
+	// ErrConditionFailed indicates that a conditional failed in a context where it can't be
+	// reported via a return value. Conditional operations such as SetNX or AtomicWrite report
+	// failed conditionals via their boolean return values, not via this error.
+	ErrConditionFailed = errors.New("condition failed")
+
+	// ErrThrottled indicates that the backend rejected the request due to rate limits or
+	// insufficient capacity. These errors are generally safe to retry after backing off.
+	ErrThrottled = errors.New("throttled")
+)
+
+// Error associates a backend's native error with one of the error kinds above. errors.Is reports
+// whether it matches the kind, and errors.As can still be used to get the native error.
+type Error struct {
+	// Kind is one of the Err variables in this package.
+	Kind error
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
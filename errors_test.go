@@ -0,0 +1,29 @@
+package keyvaluestore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nativeError struct{}
+
+func (nativeError) Error() string {
+	return "native"
+}
+
+func TestError(t *testing.T) {
+	err := fmt.Errorf("request failed: %w", &Error{
+		Kind: ErrThrottled,
+		Err:  nativeError{},
+	})
+	assert.EqualError(t, err, "request failed: throttled: native")
+
+	assert.True(t, errors.Is(err, ErrThrottled))
+	assert.False(t, errors.Is(err, ErrWrongType))
+
+	var native nativeError
+	assert.True(t, errors.As(err, &native))
+}
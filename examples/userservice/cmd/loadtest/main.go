@@ -0,0 +1,104 @@
+// Command loadtest runs userservice.LoadTest against several instances of the example service that
+// share a backend, then verifies the resulting data.
+//
+// For example, to run eight instances against Redis for a minute:
+//
+//	loadtest -redis 127.0.0.1:6379 -instances 8 -concurrency 32 -duration 1m
+//
+// Without -redis, an in-memory backend is used. Keys are prefixed with "loadtest:", but load tests
+// should still be run against dedicated databases.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/examples/userservice"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+	"github.com/ccbrown/keyvaluestore/redisstore"
+)
+
+func main() {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	redisAddress := fs.String("redis", "", "the address of a redis server to connect to")
+	redisDB := fs.Int("redis-db", 0, "the redis database to select")
+	instances := fs.Int("instances", 4, "the number of service instances")
+	maxStaleness := fs.Duration("max-staleness", time.Second, "how old cached profiles can be")
+	t := &userservice.LoadTest{}
+	fs.IntVar(&t.Usernames, "usernames", 100, "the number of distinct usernames")
+	fs.IntVar(&t.Concurrency, "concurrency", 16, "the number of concurrent clients")
+	fs.DurationVar(&t.Duration, "duration", 10*time.Second, "how long to run the load test for")
+	fs.IntVar(&t.Operations, "operations", 0, "if given, the load test stops after this many operations")
+	fs.Parse(os.Args[1:])
+
+	var backend interface {
+		keyvaluestore.Backend
+		keyvaluestore.PubSub
+	}
+	if *redisAddress != "" {
+		b := redisstore.New(redisstore.Config{
+			Addr: *redisAddress,
+			DB:   *redisDB,
+		})
+		if err := b.Ping(); err != nil {
+			fmt.Fprintf(os.Stderr, "loadtest: unable to connect to redis: %v\n", err)
+			os.Exit(1)
+		}
+		backend = b
+	} else {
+		backend = memorystore.NewBackend()
+	}
+	defer backend.Close()
+
+	if err := run(backend, backend, *instances, *maxStaleness, t); err != nil {
+		fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(backend keyvaluestore.Backend, pubsub keyvaluestore.PubSub, instances int, maxStaleness time.Duration, t *userservice.LoadTest) error {
+	if instances <= 0 {
+		return fmt.Errorf("at least one instance is required")
+	}
+	for i := 0; i < instances; i++ {
+		s, err := userservice.New(userservice.Config{
+			Backend:      backend,
+			PubSub:       pubsub,
+			Prefix:       "loadtest:",
+			MaxStaleness: maxStaleness,
+		})
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		t.Services = append(t.Services, s)
+	}
+
+	results, err := t.Run()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	total := 0
+	for name, n := range results.Operations {
+		names = append(names, name)
+		total += n
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%-12v %v\n", name, results.Operations[name])
+	}
+	fmt.Printf("%v operations in %v (%.0f/s), %v username conflicts\n", total, results.Elapsed, float64(total)/results.Elapsed.Seconds(), results.UsernameConflicts)
+
+	fmt.Fprintf(os.Stderr, "verifying...\n")
+	if err := t.Verify(); err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	fmt.Println("ok")
+	return nil
+}
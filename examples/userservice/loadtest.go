@@ -0,0 +1,327 @@
+package userservice
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// LoadTest drives concurrent traffic against several instances of the service and checks that
+// every response is consistent with the operations that preceded it. Verify can then check that
+// the stored data is consistent and that every instance's cache has converged.
+type LoadTest struct {
+	// Services are the instances that operations are distributed among. They must share a backend
+	// and prefix.
+	Services []*Service
+
+	// The number of distinct usernames that users are created with or renamed to. Smaller pools
+	// cause more conflicts. Defaults to 100.
+	Usernames int
+
+	// The number of goroutines issuing operations.
+	Concurrency int
+
+	// The load test stops after Duration or Operations, whichever comes first. Zero values are
+	// ignored.
+	Duration   time.Duration
+	Operations int
+
+	mutex  sync.Mutex
+	users  []string
+	scores map[string]float64
+}
+
+// LoadTestResults summarizes a load test.
+type LoadTestResults struct {
+	Elapsed time.Duration
+
+	// Operations counts the operations performed by name, including those that failed due to
+	// username conflicts.
+	Operations map[string]int
+
+	// UsernameConflicts counts the creations and renames that failed because the username was
+	// taken.
+	UsernameConflicts int
+}
+
+func (t *LoadTest) username(rng *rand.Rand) string {
+	n := t.Usernames
+	if n <= 0 {
+		n = 100
+	}
+	return "user" + strconv.Itoa(rng.Intn(n))
+}
+
+// randomUsers returns up to n distinct ids of users that have been created.
+func (t *LoadTest) randomUsers(rng *rand.Rand, n int) []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if n > len(t.users) {
+		n = len(t.users)
+	}
+	ret := make([]string, n)
+	for i, j := range rng.Perm(len(t.users))[:n] {
+		ret[i] = t.users[j]
+	}
+	return ret
+}
+
+// Run runs the load test. If any response is inconsistent, the test stops and an error is
+// returned.
+func (t *LoadTest) Run() (*LoadTestResults, error) {
+	if len(t.Services) == 0 {
+		return nil, fmt.Errorf("at least one service is required")
+	} else if t.Duration <= 0 && t.Operations <= 0 {
+		return nil, fmt.Errorf("either a duration or a number of operations is required")
+	}
+	concurrency := t.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	t.mutex.Lock()
+	if t.scores == nil {
+		t.scores = map[string]float64{}
+	}
+	t.mutex.Unlock()
+
+	var deadline time.Time
+	start := time.Now()
+	if t.Duration > 0 {
+		deadline = start.Add(t.Duration)
+	}
+
+	var mutex sync.Mutex
+	var firstErr error
+	remaining := t.Operations
+	results := &LoadTestResults{
+		Operations: map[string]int{},
+	}
+	next := func() bool {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return false
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if firstErr != nil || (t.Operations > 0 && remaining == 0) {
+			return false
+		}
+		remaining--
+		return true
+	}
+	record := func(name string, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err == errUsernameConflict {
+			results.UsernameConflicts++
+		} else if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%v: %w", name, err)
+			}
+			return
+		}
+		results.Operations[name]++
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(worker)))
+			for next() {
+				s := t.Services[rng.Intn(len(t.Services))]
+				name, f := t.operation(s, rng)
+				record(name, f())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	results.Elapsed = time.Since(start)
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// errUsernameConflict is returned by operations that expectedly failed with ErrUsernameTaken.
+var errUsernameConflict = fmt.Errorf("username conflict")
+
+// operation picks the next operation to perform. Operations that need existing users create one
+// instead until there are some.
+func (t *LoadTest) operation(s *Service, rng *rand.Rand) (string, func() error) {
+	p := rng.Float64()
+	ids := t.randomUsers(rng, 1+rng.Intn(10))
+	if len(ids) == 0 || p < 0.1 {
+		return "CreateUser", func() error {
+			user, err := s.CreateUser(t.username(rng), "Load Test")
+			if err == ErrUsernameTaken {
+				return errUsernameConflict
+			} else if err != nil {
+				return err
+			}
+			t.mutex.Lock()
+			t.users = append(t.users, user.Id)
+			t.mutex.Unlock()
+			return nil
+		}
+	}
+
+	switch {
+	case p < 0.2:
+		return "RenameUser", func() error {
+			username := t.username(rng)
+			user, err := s.RenameUser(ids[0], username)
+			if err == ErrUsernameTaken {
+				return errUsernameConflict
+			} else if err != nil {
+				return err
+			} else if user.Id != ids[0] || user.Username != username {
+				return fmt.Errorf("renamed the wrong user")
+			}
+			return nil
+		}
+	case p < 0.45:
+		return "AddScore", func() error {
+			n := float64(1 + rng.Intn(10))
+			if _, err := s.AddScore(ids[0], n); err != nil {
+				return err
+			}
+			t.mutex.Lock()
+			t.scores[ids[0]] += n
+			t.mutex.Unlock()
+			return nil
+		}
+	case p < 0.75:
+		return "GetUsers", func() error {
+			users, err := s.GetUsers(ids...)
+			if err != nil {
+				return err
+			}
+			for i, user := range users {
+				// Users are never deleted, so every user that has been created must be found.
+				if user == nil || user.Id != ids[i] {
+					return fmt.Errorf("user %v not found", ids[i])
+				}
+			}
+			return nil
+		}
+	case p < 0.85:
+		return "TopUsers", func() error {
+			users, err := s.TopUsers(10)
+			if err != nil {
+				return err
+			}
+			for i := 1; i < len(users); i++ {
+				if users[i].Score > users[i-1].Score || users[i].Rank < users[i-1].Rank {
+					return fmt.Errorf("leaderboard out of order")
+				}
+			}
+			return nil
+		}
+	}
+
+	return "Session", func() error {
+		users, err := s.GetUsers(ids[0])
+		if err != nil {
+			return err
+		} else if users[0] == nil {
+			return fmt.Errorf("user %v not found", ids[0])
+		}
+		sessionId, err := s.Login(users[0].Username)
+		if err == ErrUserNotFound {
+			// The user was renamed after we looked them up.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		// Sessions are never cached, so they must be visible to every instance immediately.
+		other := t.Services[rng.Intn(len(t.Services))]
+		if user, err := other.Authenticate(sessionId); err != nil {
+			return err
+		} else if user == nil {
+			return fmt.Errorf("new session not found")
+		}
+		if err := s.Logout(sessionId); err != nil {
+			return err
+		}
+		if user, err := other.Authenticate(sessionId); err != nil {
+			return err
+		} else if user != nil {
+			return fmt.Errorf("session still valid after logout")
+		}
+		return nil
+	}
+}
+
+// Verify checks the data written by the load test. Every username must belong to the user whose
+// profile has it, every score must equal the sum of the successful increments, and once the
+// services' MaxStaleness has elapsed, every instance must return the stored profiles. It must not
+// be invoked while the load test is running.
+func (t *LoadTest) Verify() error {
+	if len(t.Services) == 0 {
+		return fmt.Errorf("at least one service is required")
+	}
+	s := t.Services[0]
+	backend := s.config.Backend
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	profiles := map[string]string{}
+	for _, id := range t.users {
+		var user User
+		if found, err := keyvaluestore.GetJSON(backend, s.userKey(id), &user); err != nil {
+			return err
+		} else if !found {
+			return fmt.Errorf("user %v not found", id)
+		}
+		profiles[id] = user.Username
+
+		owner, err := backend.Get(s.usernameKey(user.Username))
+		if err != nil {
+			return err
+		} else if owner == nil || *owner != id {
+			return fmt.Errorf("username %v doesn't belong to user %v", user.Username, id)
+		}
+
+		score, err := backend.ZScore(s.leaderboard.Key, id)
+		if err != nil {
+			return err
+		} else if score == nil || *score != t.scores[id] {
+			return fmt.Errorf("user %v has score %v, expected %v", id, score, t.scores[id])
+		}
+	}
+
+	if n, err := s.leaderboard.Len(); err != nil {
+		return err
+	} else if n != len(t.users) {
+		return fmt.Errorf("leaderboard has %v users, expected %v", n, len(t.users))
+	}
+
+	var maxStaleness time.Duration
+	for _, s := range t.Services {
+		if s.config.MaxStaleness > maxStaleness {
+			maxStaleness = s.config.MaxStaleness
+		}
+	}
+	time.Sleep(maxStaleness)
+
+	for i, s := range t.Services {
+		users, err := s.GetUsers(t.users...)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if user.Username != profiles[user.Id] {
+				return fmt.Errorf("service %v has stale username %v for user %v", i, user.Username, user.Id)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+// Package userservice is a small but complete example application built on keyvaluestore. It
+// stores user profiles with unique usernames, ranks users on a leaderboard, and authenticates them
+// via sessions.
+//
+// Any number of Service instances can share a backend, as if they were replicas of a web service.
+// Each one caches profiles in a keyvaluestorecache.ReadCache and, if given a keyvaluestore.PubSub,
+// broadcasts invalidations to the others via keyvaluestoreinvalidator. LoadTest drives concurrent
+// traffic against several instances and verifies that the data remains consistent, so the package
+// doubles as an integration test of those packages working together.
+package userservice
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorecache"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreinvalidator"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreleaderboard"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoresession"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrUsernameTaken = errors.New("username taken")
+)
+
+type User struct {
+	Id          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+}
+
+// RankedUser is a user's position on the leaderboard.
+type RankedUser struct {
+	*User
+	Score float64
+	Rank  int
+}
+
+type Config struct {
+	Backend keyvaluestore.Backend
+
+	// If given, cache invalidations are broadcast to other instances via this. Otherwise other
+	// instances only see changes once their cached values are older than MaxStaleness.
+	PubSub keyvaluestore.PubSub
+
+	// Prefix is prepended to every key, allowing multiple services to share a backend.
+	Prefix string
+
+	// MaxStaleness bounds how old cached profiles can be. Writes made via the same instance are
+	// always visible immediately. Defaults to one second.
+	MaxStaleness time.Duration
+
+	// SessionTTL is how long sessions last. Defaults to one day.
+	SessionTTL time.Duration
+}
+
+// Service implements the application's operations. It's safe for concurrent use.
+type Service struct {
+	config Config
+
+	// backend is the shared backend wrapped to publish invalidations. Leaderboards and sessions
+	// are read from it directly since they must never be stale, e.g. after a logout.
+	backend keyvaluestore.Backend
+
+	// cache serves profiles and username lookups.
+	cache *keyvaluestorecache.ReadCache
+
+	leaderboard *keyvaluestoreleaderboard.Leaderboard
+	sessions    *keyvaluestoresession.Store
+	unsubscribe func()
+}
+
+// New creates a new service instance. Close should be invoked when it's no longer needed.
+func New(config Config) (*Service, error) {
+	if config.MaxStaleness <= 0 {
+		config.MaxStaleness = time.Second
+	}
+	if config.SessionTTL <= 0 {
+		config.SessionTTL = 24 * time.Hour
+	}
+
+	s := &Service{
+		config:  config,
+		backend: config.Backend,
+	}
+	if config.PubSub != nil {
+		s.backend = &keyvaluestoreinvalidator.Invalidator{
+			Backend:    config.Backend,
+			Invalidate: keyvaluestoreinvalidator.PublishInvalidations(config.PubSub, s.invalidationChannel(), nil),
+		}
+	}
+	s.cache = keyvaluestorecache.NewReadCache(s.backend)
+	if config.PubSub != nil {
+		unsubscribe, err := keyvaluestoreinvalidator.InvalidateOnMessage(config.PubSub, s.invalidationChannel(), s.cache.Invalidate)
+		if err != nil {
+			return nil, err
+		}
+		s.unsubscribe = unsubscribe
+	}
+	s.leaderboard = &keyvaluestoreleaderboard.Leaderboard{
+		Backend: s.backend,
+		Key:     config.Prefix + "leaderboard",
+	}
+	s.sessions = &keyvaluestoresession.Store{
+		Backend: s.backend,
+		Prefix:  config.Prefix + "session:",
+	}
+	return s, nil
+}
+
+// Close stops receiving invalidations from other instances. It doesn't close the backend.
+func (s *Service) Close() {
+	if s.unsubscribe != nil {
+		s.unsubscribe()
+	}
+}
+
+func (s *Service) invalidationChannel() string {
+	return s.config.Prefix + "invalidations"
+}
+
+func (s *Service) userKey(id string) string {
+	return s.config.Prefix + "user:" + id
+}
+
+func (s *Service) usernameKey(username string) string {
+	return s.config.Prefix + "username:" + username
+}
+
+func newUserId() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// CreateUser creates a user with a score of zero. If the username is already taken,
+// ErrUsernameTaken is returned.
+func (s *Service) CreateUser(username, displayName string) (*User, error) {
+	id, err := newUserId()
+	if err != nil {
+		return nil, err
+	}
+	user := &User{
+		Id:          id,
+		Username:    username,
+		DisplayName: displayName,
+	}
+	serialized, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := s.cache.AtomicWrite()
+	tx.SetNX(s.userKey(id), serialized)
+	usernameResult := tx.SetNX(s.usernameKey(username), id)
+	tx.ZAdd(s.leaderboard.Key, id, 0)
+	if ok, err := tx.Exec(); err != nil {
+		return nil, err
+	} else if !ok {
+		if usernameResult.ConditionalFailed() {
+			return nil, ErrUsernameTaken
+		}
+		return nil, errors.New("user id collision")
+	}
+	return user, nil
+}
+
+// RenameUser changes a user's username. If the new username is already taken, ErrUsernameTaken is
+// returned.
+func (s *Service) RenameUser(id, username string) (*User, error) {
+	for {
+		// The profile is read from the backend rather than the cache since it's the condition of
+		// the atomic write.
+		serialized, err := s.backend.Get(s.userKey(id))
+		if err != nil {
+			return nil, err
+		} else if serialized == nil {
+			return nil, ErrUserNotFound
+		}
+		var user User
+		if err := json.Unmarshal([]byte(*serialized), &user); err != nil {
+			return nil, &keyvaluestore.JSONError{Key: s.userKey(id), Err: err}
+		}
+		if user.Username == username {
+			return &user, nil
+		}
+		oldUsername := user.Username
+		user.Username = username
+		renamed, err := json.Marshal(&user)
+		if err != nil {
+			return nil, err
+		}
+
+		tx := s.cache.AtomicWrite()
+		tx.SetEQ(s.userKey(id), renamed, *serialized)
+		usernameResult := tx.SetNX(s.usernameKey(username), id)
+		tx.Delete(s.usernameKey(oldUsername))
+		if ok, err := tx.Exec(); err != nil {
+			return nil, err
+		} else if ok {
+			return &user, nil
+		} else if usernameResult.ConditionalFailed() {
+			return nil, ErrUsernameTaken
+		}
+		// The profile was changed concurrently, so try again.
+	}
+}
+
+// GetUsers gets multiple users in a single batch, using cached profiles that are newer than
+// MaxStaleness. The returned slice has an entry for each id, which is nil if the user doesn't
+// exist.
+func (s *Service) GetUsers(ids ...string) ([]*User, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.userKey(id)
+	}
+	values, err := s.cache.GetMulti(keys, s.config.MaxStaleness)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*User, len(ids))
+	for i, key := range keys {
+		if values[key] == nil {
+			continue
+		}
+		var user User
+		if err := json.Unmarshal([]byte(*values[key]), &user); err != nil {
+			return nil, &keyvaluestore.JSONError{Key: key, Err: err}
+		}
+		ret[i] = &user
+	}
+	return ret, nil
+}
+
+// GetUserByUsername gets a user by their username, returning nil if there's no such user. Like
+// GetUsers, it may use cached values newer than MaxStaleness.
+func (s *Service) GetUserByUsername(username string) (*User, error) {
+	key := s.usernameKey(username)
+	values, err := s.cache.GetMulti([]string{key}, s.config.MaxStaleness)
+	if err != nil || values[key] == nil {
+		return nil, err
+	}
+	users, err := s.GetUsers(*values[key])
+	if err != nil {
+		return nil, err
+	}
+	return users[0], nil
+}
+
+// AddScore adds to the user's score and returns the new score.
+func (s *Service) AddScore(id string, n float64) (float64, error) {
+	return s.leaderboard.AddScore(id, n)
+}
+
+// TopUsers returns the n highest ranked users.
+func (s *Service) TopUsers(n int) ([]*RankedUser, error) {
+	entries, err := s.leaderboard.Top(n)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.Member
+	}
+	users, err := s.GetUsers(ids...)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*RankedUser, 0, len(entries))
+	for i, entry := range entries {
+		if users[i] == nil {
+			continue
+		}
+		ret = append(ret, &RankedUser{
+			User:  users[i],
+			Score: entry.Score,
+			Rank:  entry.Rank,
+		})
+	}
+	return ret, nil
+}
+
+type session struct {
+	UserId string `json:"userId"`
+}
+
+// Login creates a session for the user with the given username and returns its id.
+func (s *Service) Login(username string) (string, error) {
+	user, err := s.GetUserByUsername(username)
+	if err != nil {
+		return "", err
+	} else if user == nil {
+		return "", ErrUserNotFound
+	}
+	return s.sessions.Create(s.config.SessionTTL, &session{
+		UserId: user.Id,
+	})
+}
+
+// Authenticate returns the user that the session belongs to, or nil if the session doesn't exist
+// or has expired.
+func (s *Service) Authenticate(sessionId string) (*User, error) {
+	var session session
+	if ok, err := s.sessions.Get(sessionId, &session); err != nil || !ok {
+		return nil, err
+	}
+	users, err := s.GetUsers(session.UserId)
+	if err != nil {
+		return nil, err
+	}
+	return users[0], nil
+}
+
+// Logout destroys the session.
+func (s *Service) Logout(sessionId string) error {
+	return s.sessions.Destroy(sessionId)
+}
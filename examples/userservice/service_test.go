@@ -0,0 +1,160 @@
+package userservice
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/memorystore"
+	"github.com/ccbrown/keyvaluestore/redisstore"
+)
+
+func newServices(t *testing.T, n int, config Config) []*Service {
+	ret := make([]*Service, n)
+	for i := range ret {
+		s, err := New(config)
+		require.NoError(t, err)
+		ret[i] = s
+	}
+	return ret
+}
+
+func closeServices(services []*Service) {
+	for _, s := range services {
+		s.Close()
+	}
+}
+
+func TestService(t *testing.T) {
+	backend := memorystore.NewBackend()
+	services := newServices(t, 2, Config{
+		Backend:      backend,
+		PubSub:       backend,
+		Prefix:       "test:",
+		MaxStaleness: time.Hour,
+	})
+	defer closeServices(services)
+	a, b := services[0], services[1]
+
+	alice, err := a.CreateUser("alice", "Alice")
+	require.NoError(t, err)
+	_, err = b.CreateUser("alice", "Other Alice")
+	assert.Equal(t, ErrUsernameTaken, err)
+	bob, err := b.CreateUser("bob", "Bob")
+	require.NoError(t, err)
+
+	users, err := b.GetUsers(alice.Id, bob.Id, "nobody")
+	require.NoError(t, err)
+	assert.Equal(t, []*User{alice, bob, nil}, users)
+
+	_, err = a.RenameUser(alice.Id, "bob")
+	assert.Equal(t, ErrUsernameTaken, err)
+	_, err = a.RenameUser("nobody", "carol")
+	assert.Equal(t, ErrUserNotFound, err)
+	renamed, err := a.RenameUser(alice.Id, "alicia")
+	require.NoError(t, err)
+	assert.Equal(t, "alicia", renamed.Username)
+
+	// b cached alice's profile, but the invalidation from a eventually evicts it.
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		users, err := b.GetUsers(alice.Id)
+		require.NoError(t, err)
+		if users[0].Username == "alicia" {
+			break
+		}
+		require.True(t, time.Now().Before(deadline), "invalidation not received")
+	}
+
+	user, err := b.GetUserByUsername("alice")
+	require.NoError(t, err)
+	assert.Nil(t, user)
+	user, err = b.GetUserByUsername("alicia")
+	require.NoError(t, err)
+	assert.Equal(t, renamed, user)
+
+	_, err = a.CreateUser("alice", "New Alice")
+	require.NoError(t, err)
+
+	score, err := a.AddScore(bob.Id, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, score)
+	_, err = b.AddScore(alice.Id, 5)
+	require.NoError(t, err)
+
+	top, err := b.TopUsers(2)
+	require.NoError(t, err)
+	require.Len(t, top, 2)
+	assert.Equal(t, &RankedUser{User: bob, Score: 10, Rank: 1}, top[0])
+	assert.Equal(t, &RankedUser{User: renamed, Score: 5, Rank: 2}, top[1])
+
+	_, err = a.Login("nobody")
+	assert.Equal(t, ErrUserNotFound, err)
+	session, err := a.Login("bob")
+	require.NoError(t, err)
+	user, err = b.Authenticate(session)
+	require.NoError(t, err)
+	assert.Equal(t, bob, user)
+	require.NoError(t, b.Logout(session))
+	user, err = a.Authenticate(session)
+	require.NoError(t, err)
+	assert.Nil(t, user)
+}
+
+func TestLoadTest(t *testing.T) {
+	for name, newConfig := range map[string]func(t *testing.T) Config{
+		"Memory": func(t *testing.T) Config {
+			backend := memorystore.NewBackend()
+			return Config{
+				Backend: backend,
+				PubSub:  backend,
+			}
+		},
+		"MemoryWithoutPubSub": func(t *testing.T) Config {
+			return Config{
+				Backend: memorystore.NewBackend(),
+			}
+		},
+		"Redis": func(t *testing.T) Config {
+			addr := os.Getenv("REDIS_ADDRESS")
+			if addr == "" {
+				t.Skip("no redis server available")
+			}
+			backend := redisstore.New(redisstore.Config{
+				Addr: addr,
+				DB:   1,
+			})
+			require.NoError(t, backend.Client.FlushDB().Err())
+			return Config{
+				Backend: backend,
+				PubSub:  backend,
+			}
+		},
+	} {
+		newConfig := newConfig
+		t.Run(name, func(t *testing.T) {
+			config := newConfig(t)
+			defer config.Backend.Close()
+			config.Prefix = "loadtest:"
+			config.MaxStaleness = 100 * time.Millisecond
+			services := newServices(t, 4, config)
+			defer closeServices(services)
+			test := &LoadTest{
+				Services:    services,
+				Usernames:   50,
+				Concurrency: 8,
+				Operations:  2000,
+			}
+			results, err := test.Run()
+			require.NoError(t, err)
+			total := 0
+			for _, n := range results.Operations {
+				total += n
+			}
+			assert.Equal(t, 2000, total)
+			assert.NoError(t, test.Verify())
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package keyvaluestore
+
+import "fmt"
+
+// MultiExister is implemented by backends that can check whether many keys exist without reading
+// their values. It's useful for things like deduplication, where fetching full values just to test
+// their presence would be wasteful.
+type MultiExister interface {
+	// ExistsMulti returns a map with an entry for each of the given keys, which is true if the key
+	// exists.
+	ExistsMulti(keys ...string) (map[string]bool, error)
+}
+
+// ExistsMulti checks whether each of the given keys exists. If the backend doesn't implement
+// MultiExister, an error wrapping ErrNotSupported is returned.
+func ExistsMulti(b Backend, keys ...string) (map[string]bool, error) {
+	e, ok := b.(MultiExister)
+	if !ok {
+		return nil, fmt.Errorf("backend does not support existence checks: %T: %w", b, ErrNotSupported)
+	}
+	return e.ExistsMulti(keys...)
+}
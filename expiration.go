@@ -0,0 +1,42 @@
+package keyvaluestore
+
+import "time"
+
+// Expirer is implemented by backends that can expire keys, such as memorystore.Backend. Helpers
+// that store temporary data use it when available to avoid leaving expired data behind.
+type Expirer interface {
+	// ExpireAt sets a deadline after which the key will be deleted. It returns false if the key
+	// doesn't exist.
+	ExpireAt(key string, deadline time.Time) (bool, error)
+}
+
+// TTLGetter is implemented by backends that can report the remaining time to live of keys. Caches
+// use it when available so that they never return values that have expired.
+type TTLGetter interface {
+	// TTL returns the remaining time to live of the key. It returns nil if the key doesn't exist or
+	// doesn't have a timeout.
+	TTL(key string) (*time.Duration, error)
+}
+
+// Clock is a source of the current time. It's implemented by backends that have their own notion of
+// the current time for expirations. For example, memorystore.Backend's clock can be fast-forwarded
+// in tests. Helpers with time-dependent logic, such as leases, TTLs, and rate limits, accept a Clock
+// so that tests can control time deterministically instead of sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to the Clock interface.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// Now returns the current time according to the given clock, or the wall clock time if it's nil.
+func Now(clock Clock) time.Time {
+	if clock != nil {
+		return clock.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,121 @@
+package keyvaluestore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Feature identifies an optional capability that backends advertise by implementing one of the
+// optional interfaces in this package.
+//
+// Helpers degrade differently when a feature is missing: some return errors that match
+// ErrNotSupported, but others silently do less, e.g. temporary data isn't expired without
+// FeatureExpiration and request options other than eventual consistency are ignored without
+// FeatureRequestOptions. Wrappers only advertise the features that they forward, so an
+// application's fully wrapped backend may support fewer features than the underlying one.
+// RequireFeatures can be used to catch such problems when the backend is constructed rather than
+// in production.
+type Feature string
+
+const (
+	FeatureExpiration       Feature = "expiration"
+	FeatureTTL              Feature = "ttl"
+	FeatureScan             Feature = "scan"
+	FeatureSegmentedScan    Feature = "segmented scan"
+	FeatureSnapshotScan     Feature = "snapshot scan"
+	FeatureEntries          Feature = "entries"
+	FeatureSortedHashFields Feature = "sorted hash fields"
+	FeatureSnapshotBatches  Feature = "snapshot batches"
+	FeatureMultiExists      Feature = "multi exists"
+	FeatureWatch            Feature = "watch"
+	FeaturePubSub           Feature = "pubsub"
+	FeatureRequestOptions   Feature = "request options"
+	FeatureRename           Feature = "rename"
+	FeatureApproximateCount Feature = "approximate count"
+)
+
+// AllFeatures lists every feature.
+var AllFeatures = []Feature{
+	FeatureExpiration,
+	FeatureTTL,
+	FeatureScan,
+	FeatureSegmentedScan,
+	FeatureSnapshotScan,
+	FeatureEntries,
+	FeatureSortedHashFields,
+	FeatureSnapshotBatches,
+	FeatureMultiExists,
+	FeatureWatch,
+	FeaturePubSub,
+	FeatureRequestOptions,
+	FeatureRename,
+	FeatureApproximateCount,
+}
+
+// Supports returns true if the backend supports the given feature. Unknown features are never
+// supported.
+func Supports(b Backend, f Feature) bool {
+	var ok bool
+	switch f {
+	case FeatureExpiration:
+		_, ok = b.(Expirer)
+	case FeatureTTL:
+		_, ok = b.(TTLGetter)
+	case FeatureScan:
+		_, ok = b.(Scanner)
+	case FeatureSegmentedScan:
+		_, ok = b.(SegmentedScanner)
+	case FeatureSnapshotScan:
+		_, ok = b.(SnapshotScanner)
+	case FeatureEntries:
+		_, ok = b.(EntryGetter)
+	case FeatureSortedHashFields:
+		_, ok = b.(SortedHashFieldRanger)
+	case FeatureSnapshotBatches:
+		_, ok = b.(SnapshotBatcher)
+	case FeatureMultiExists:
+		_, ok = b.(MultiExister)
+	case FeatureWatch:
+		_, ok = b.(ObservableBackend)
+	case FeaturePubSub:
+		_, ok = b.(PubSub)
+	case FeatureRequestOptions:
+		_, ok = b.(OptionsBackend)
+	case FeatureRename:
+		_, ok = b.(Renamer)
+	case FeatureApproximateCount:
+		_, ok = b.(ApproximateCounter)
+	}
+	return ok
+}
+
+// Features returns the features that the backend supports.
+func Features(b Backend) []Feature {
+	var ret []Feature
+	for _, f := range AllFeatures {
+		if Supports(b, f) {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// RequireFeatures returns an error that matches ErrNotSupported and lists the missing features if
+// the backend doesn't support all of the given ones. Applications can invoke it at startup, after
+// wrapping their backend, to fail fast:
+//
+//	if err := keyvaluestore.RequireFeatures(backend, keyvaluestore.FeatureExpiration); err != nil {
+//		log.Fatal(err)
+//	}
+func RequireFeatures(b Backend, features ...Feature) error {
+	var missing []string
+	for _, f := range features {
+		if !Supports(b, f) {
+			missing = append(missing, string(f))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("backend does not support %v: %T: %w", strings.Join(missing, ", "), b, ErrNotSupported)
+	}
+	return nil
+}
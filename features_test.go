@@ -0,0 +1,30 @@
+package keyvaluestore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type expiringBackend struct {
+	Backend
+}
+
+func (b *expiringBackend) ExpireAt(key string, deadline time.Time) (bool, error) {
+	return false, nil
+}
+
+func TestRequireFeatures(t *testing.T) {
+	b := &expiringBackend{}
+	assert.Equal(t, []Feature{FeatureExpiration}, Features(b))
+	assert.True(t, Supports(b, FeatureExpiration))
+	assert.False(t, Supports(b, Feature("unknown")))
+
+	assert.NoError(t, RequireFeatures(b, FeatureExpiration))
+
+	err := RequireFeatures(b, FeatureExpiration, FeatureScan, FeatureWatch)
+	assert.True(t, errors.Is(err, ErrNotSupported))
+	assert.Contains(t, err.Error(), "scan, watch")
+}
@@ -0,0 +1,97 @@
+package foundationdbstore
+
+import (
+	"math"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Ranges that span fewer shard boundaries than this are counted exactly. Estimates are only as fine
+// as FoundationDB's shards, so they'd be too coarse to be useful, and such ranges are also the
+// cheapest to count.
+const approximateCountMinShardBoundaries = 16
+
+// The system keys that map each shard's first key to the servers storing it.
+const keyServersPrefix = "\xff/keyServers/"
+
+var _ keyvaluestore.ApproximateCounter = &Backend{}
+
+// ZCountApprox estimates the number of members with scores between min and max. Counting the entire
+// set is exact and O(1), as with ZCount.
+//
+// Otherwise the set's exact cardinality is scaled by the fraction of the set's shard boundaries
+// that fall within the range. FoundationDB keeps shards roughly the same size, so the estimate is
+// usually within a couple of shards' worth of members, but it isn't strictly bounded if members
+// vary greatly in size. Ranges that span fewer than 16 shard boundaries, which includes every
+// range of a set that fits in a handful of shards, are counted exactly.
+func (b *Backend) ZCountApprox(key string, min, max float64) (int, error) {
+	if min == math.Inf(-1) && max == math.Inf(1) {
+		return b.zCard(key)
+	} else if min > max {
+		return 0, nil
+	}
+
+	r, err := b.readTransact(func(rtx fdb.ReadTransaction) (interface{}, error) {
+		tx, ok := rtx.(fdb.Transaction)
+		if !ok {
+			return -1, nil
+		}
+		if err := tx.Options().SetReadSystemKeys(); err != nil {
+			return nil, err
+		}
+		n, err := countShardBoundaries(tx, b.scoreKeyRange(key, min, max))
+		if err != nil {
+			return nil, err
+		} else if n < approximateCountMinShardBoundaries {
+			return -1, nil
+		}
+		total, err := countShardBoundaries(tx, b.scoreKeyRange(key, math.Inf(-1), math.Inf(1)))
+		if err != nil {
+			return nil, err
+		}
+		card, err := b.readZCount(tx, key)
+		if err != nil {
+			return nil, err
+		} else if card < 0 || total <= 0 {
+			// Uninitialized counters are initialized by ZCount.
+			return -1, nil
+		}
+		count := float64(card)
+		if n >= total {
+			return int(count), nil
+		}
+		return int(math.Round(count * float64(n) / float64(total))), nil
+	})
+	if err != nil {
+		return 0, err
+	} else if n := r.(int); n >= 0 {
+		return n, nil
+	}
+	return b.ZCount(key, min, max)
+}
+
+// countShardBoundaries counts the shard boundaries within r in the same way as
+// fdb.Database.LocalityGetBoundaryKeys, but within the given transaction, which must be allowed to
+// read system keys.
+func countShardBoundaries(tx fdb.Transaction, r fdb.KeyRange) (int, error) {
+	return countRange(tx.Snapshot(), fdb.KeyRange{
+		Begin: fdb.Key(append([]byte(keyServersPrefix), r.Begin.FDBKey()...)),
+		End:   fdb.Key(append([]byte(keyServersPrefix), r.End.FDBKey()...)),
+	})
+}
+
+// scoreKeyRange is like scoreRange, but returns an exact range for APIs that require one.
+func (b *Backend) scoreKeyRange(key string, min, max float64) fdb.KeyRange {
+	begin := b.Subspace.Pack(tuple.Tuple{key, "s"})
+	if min != math.Inf(-1) {
+		begin = b.Subspace.Pack(tuple.Tuple{key, "s", min})
+	}
+	end := b.Subspace.Pack(tuple.Tuple{key, "t"})
+	if max != math.Inf(1) {
+		end = b.Subspace.Pack(tuple.Tuple{key, "s", math.Nextafter(max, math.Inf(1))})
+	}
+	return fdb.KeyRange{Begin: begin, End: end}
+}
@@ -3,6 +3,8 @@ package foundationdbstore
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 
@@ -12,7 +14,8 @@ import (
 type AtomicWriteOperation struct {
 	Backend *Backend
 
-	ops []*atomicWriteOp
+	ops              []*atomicWriteOp
+	idempotencyToken string
 }
 
 type atomicWriteOp struct {
@@ -32,7 +35,7 @@ func (op *atomicWriteOp) ConditionalFailed() bool {
 func (op *AtomicWriteOperation) Set(key string, value interface{}) keyvaluestore.AtomicWriteResult {
 	subOp := &atomicWriteOp{
 		p1: func(tx fdb.Transaction) error {
-			tx.Set(op.Backend.key(key), toBytes(value))
+			op.Backend.setValue(tx, key, toBytes(value))
 			return nil
 		},
 	}
@@ -53,7 +56,7 @@ func (op *AtomicWriteOperation) SetNX(key string, value interface{}) keyvaluesto
 			if err != nil || v != nil {
 				return false, err
 			}
-			tx.Set(k, toBytes(value))
+			op.Backend.setValue(tx, key, toBytes(value))
 			return true, nil
 		},
 	}
@@ -74,7 +77,7 @@ func (op *AtomicWriteOperation) SetXX(key string, value interface{}) keyvaluesto
 			if err != nil || v == nil {
 				return false, err
 			}
-			tx.Set(k, toBytes(value))
+			op.Backend.setValue(tx, key, toBytes(value))
 			return true, nil
 		},
 	}
@@ -83,11 +86,10 @@ func (op *AtomicWriteOperation) SetXX(key string, value interface{}) keyvaluesto
 }
 
 func (op *AtomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
-	k := op.Backend.key(key)
-	var get fdb.FutureByteSlice
+	var get futureValue
 	subOp := &atomicWriteOp{
 		p1: func(tx fdb.Transaction) error {
-			get = tx.Get(k)
+			get = op.Backend.getValue(tx, key)
 			return nil
 		},
 		p2: func(tx fdb.Transaction) (bool, error) {
@@ -95,7 +97,7 @@ func (op *AtomicWriteOperation) SetEQ(key string, value, oldValue interface{}) k
 			if err != nil || !bytes.Equal(v, toBytes(oldValue)) {
 				return false, err
 			}
-			tx.Set(k, toBytes(value))
+			op.Backend.setValue(tx, key, toBytes(value))
 			return true, nil
 		},
 	}
@@ -106,7 +108,7 @@ func (op *AtomicWriteOperation) SetEQ(key string, value, oldValue interface{}) k
 func (op *AtomicWriteOperation) Delete(key string) keyvaluestore.AtomicWriteResult {
 	subOp := &atomicWriteOp{
 		p1: func(tx fdb.Transaction) error {
-			tx.Clear(op.Backend.key(key))
+			op.Backend.clearValue(tx, key)
 			return nil
 		},
 	}
@@ -126,7 +128,7 @@ func (op *AtomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteRe
 			if existing, err := get.Get(); existing == nil || err != nil {
 				return false, err
 			}
-			tx.Clear(k)
+			op.Backend.clearValue(tx, key)
 			return true, nil
 		},
 	}
@@ -152,6 +154,10 @@ func (op *AtomicWriteOperation) ZAdd(key string, member interface{}, score float
 	return op.ZHAdd(key, s, s, score)
 }
 
+func (op *AtomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	return keyvaluestore.ZHMAddEach(op, key, entries)
+}
+
 func (op *AtomicWriteOperation) ZHAdd(key, field string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
 	impl := zHAdd{B: op.Backend}
 	subOp := &atomicWriteOp{
@@ -183,6 +189,21 @@ func (op *AtomicWriteOperation) ZAddNX(key string, member interface{}, score flo
 	return subOp
 }
 
+func (op *AtomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	impl := zHAdd{B: op.Backend}
+	subOp := &atomicWriteOp{
+		p1: func(tx fdb.Transaction) error {
+			impl.InitNonBlocking(tx, key, field)
+			return nil
+		},
+		p2: func(tx fdb.Transaction) (bool, error) {
+			return impl.CompleteEQ(tx, key, field, member, oldMember, score)
+		},
+	}
+	op.ops = append(op.ops, subOp)
+	return subOp
+}
+
 func (op *AtomicWriteOperation) ZRem(key string, member interface{}) keyvaluestore.AtomicWriteResult {
 	s := *keyvaluestore.ToString(member)
 	return op.ZHRem(key, s)
@@ -203,6 +224,21 @@ func (op *AtomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWri
 	return subOp
 }
 
+func (op *AtomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	impl := zHRem{B: op.Backend}
+	subOp := &atomicWriteOp{
+		p1: func(tx fdb.Transaction) error {
+			impl.InitNonBlockingEQ(tx, key, field)
+			return nil
+		},
+		p2: func(tx fdb.Transaction) (bool, error) {
+			return impl.CompleteEQ(tx, key, field, member)
+		},
+	}
+	op.ops = append(op.ops, subOp)
+	return subOp
+}
+
 func (op *AtomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
 	toAdd := make(map[string]struct{}, 1+len(members))
 	toAdd[string(toBytes(member))] = struct{}{}
@@ -298,8 +334,40 @@ func (op *AtomicWriteOperation) HDel(key, field string, fields ...string) keyval
 	return subOp
 }
 
+// WithIdempotencyToken remembers the token within the backend's subspace. Expirations are based on
+// the local clock.
+func (op *AtomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.idempotencyToken = token
+	return op
+}
+
+func (op *AtomicWriteOperation) Validate() error {
+	if len(op.ops) > keyvaluestore.MaxAtomicWriteOperations {
+		return fmt.Errorf("max operation count exceeded")
+	} else if len(op.idempotencyToken) > keyvaluestore.MaxIdempotencyTokenLength {
+		return fmt.Errorf("idempotency token too long")
+	}
+	return nil
+}
+
 func (op *AtomicWriteOperation) Exec() (bool, error) {
-	if r, err := op.Backend.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	if err := op.Validate(); err != nil {
+		return false, err
+	}
+
+	if r, err := op.Backend.transact(func(tx fdb.Transaction) (interface{}, error) {
+		now := time.Now()
+		var previousExpiration *int64
+		if op.idempotencyToken != "" {
+			expiration, err := op.Backend.idempotencyTokenExpiration(tx, op.idempotencyToken)
+			if err != nil {
+				return nil, err
+			} else if expiration != nil && *expiration > now.UnixNano() {
+				return true, nil
+			}
+			previousExpiration = expiration
+		}
+
 		for _, op := range op.ops {
 			if err := op.p1(tx); err != nil {
 				return nil, err
@@ -316,14 +384,21 @@ func (op *AtomicWriteOperation) Exec() (bool, error) {
 				}
 			}
 		}
+		if op.idempotencyToken != "" {
+			if err := op.Backend.rememberIdempotencyToken(tx, op.idempotencyToken, previousExpiration, now); err != nil {
+				return nil, err
+			}
+		}
 		return true, nil
 	}); err != nil {
 		if err, ok := err.(fdb.Error); ok {
 			switch err.Code {
 			case 1010: // not_committed, Transaction not committed due to conflict with another transaction
-				return false, &keyvaluestore.AtomicWriteConflictError{
+				conflict := &keyvaluestore.AtomicWriteConflictError{
 					Err: err,
 				}
+				op.Backend.profileConflict("AtomicWrite", conflict)
+				return false, conflict
 			case 1025: // transaction_cancelled, Operation aborted because the transaction was cancelled
 				return false, nil
 			}
@@ -9,6 +9,7 @@ import (
 	"strconv"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
 
@@ -23,6 +24,36 @@ type Database interface {
 type Backend struct {
 	Database Database
 	Subspace subspace.Subspace
+
+	// TransactionOptions are applied to every transaction the backend creates.
+	TransactionOptions TransactionOptions
+
+	// If GroupBatchReads is true, batches combine reads of neighboring keys into range reads. This
+	// reduces the number of futures and improves throughput when batches read many contiguous
+	// keys, e.g. when bulk loading objects with sequential ids. Each range read returns at most a
+	// couple of extra key-value pairs per key, and any keys that it doesn't cover are read
+	// individually, so batches of scattered keys remain correct but may make extra reads.
+	GroupBatchReads bool
+
+	// If non-zero, readVersion is the version that all of the backend's transactions read at. It's
+	// only set for the backends that snapshot batches use internally.
+	readVersion int64
+}
+
+// NewBackendWithDirectory creates a backend whose keys live in the directory at the given path,
+// creating the directory via FoundationDB's directory layer if it doesn't already exist. This lets
+// multiple applications share a cluster without coordinating raw key prefixes. Directories don't
+// isolate applications the way FoundationDB tenants do, and tenants aren't supported since they
+// require API version 710.
+func NewBackendWithDirectory(db Database, path []string) (*Backend, error) {
+	dir, err := directory.CreateOrOpen(db, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{
+		Database: db,
+		Subspace: dir,
+	}, nil
 }
 
 func (b *Backend) key(key string) fdb.Key {
@@ -30,6 +61,11 @@ func (b *Backend) key(key string) fdb.Key {
 }
 
 func (b *Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	if p, ok := profiler.(keyvaluestore.Profiler); ok {
+		profiler = &unifiedProfiler{
+			profiler: p,
+		}
+	}
 	if p, ok := profiler.(Profiler); ok {
 		ret := *b
 		ret.Database = &ProfilingDatabase{
@@ -45,6 +81,22 @@ func (b *Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
 	return b
 }
 
+// WithOptions supports timeouts and deadlines, which are applied via TransactionOptions. Reads are
+// always strongly consistent.
+func (b *Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	if opts.Timeout <= 0 && opts.Deadline.IsZero() {
+		return b
+	}
+	ret := *b
+	if opts.Timeout > 0 {
+		ret.TransactionOptions.Timeout = opts.Timeout
+	}
+	if !opts.Deadline.IsZero() {
+		ret.TransactionOptions.Deadline = opts.Deadline
+	}
+	return &ret
+}
+
 func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
 	return &AtomicWriteOperation{
 		Backend: b,
@@ -60,6 +112,18 @@ func (b *Backend) Batch() keyvaluestore.BatchOperation {
 	}
 }
 
+// SnapshotBatch returns a batch whose reads are all performed at the same read version. The batch
+// fails if its reads take longer than FoundationDB's five second transaction time limit.
+func (b *Backend) SnapshotBatch() keyvaluestore.BatchOperation {
+	return &BatchOperation{
+		FallbackBatchOperation: &keyvaluestore.FallbackBatchOperation{
+			Backend: b,
+		},
+		Backend:       b,
+		snapshotReads: &keyvaluestore.FallbackBatchOperation{},
+	}
+}
+
 func toBytes(v interface{}) []byte {
 	switch v := v.(type) {
 	case []byte:
@@ -77,11 +141,14 @@ func toBytes(v interface{}) []byte {
 		}
 		return b
 	}
+	if s := keyvaluestore.ToString(v); s != nil {
+		return []byte(*s)
+	}
 	panic(fmt.Sprintf("unsupported value type: %T", v))
 }
 
 func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
-	if r, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	if r, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		return b.nIncrBy(tx, key, n)
 	}); err != nil {
 		return 0, err
@@ -103,7 +170,7 @@ func (b *Backend) nIncrBy(tx fdb.Transaction, key string, n int64) (int64, error
 }
 
 func (b *Backend) Delete(key string) (bool, error) {
-	if didDelete, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	if didDelete, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		return b.delete(tx, key)
 	}); err != nil {
 		return false, err
@@ -113,18 +180,17 @@ func (b *Backend) Delete(key string) (bool, error) {
 }
 
 func (b *Backend) delete(tx fdb.Transaction, key string) (bool, error) {
-	k := b.key(key)
-	v, err := tx.Get(k).Get()
+	v, err := tx.Get(b.key(key)).Get()
 	if err != nil || v == nil {
 		return false, err
 	}
-	tx.Clear(k)
+	b.clearValue(tx, key)
 	return true, nil
 }
 
 func (b *Backend) Get(key string) (*string, error) {
-	if r, err := b.Database.ReadTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
-		return tx.Get(b.key(key)).Get()
+	if r, err := b.readTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
+		return b.getValue(tx, key).Get()
 	}); err != nil {
 		return nil, err
 	} else if b := r.([]byte); b != nil {
@@ -134,16 +200,64 @@ func (b *Backend) Get(key string) (*string, error) {
 	return nil, nil
 }
 
+var _ keyvaluestore.MultiExister = &Backend{}
+
+// ExistsMulti reads the keys concurrently in a single transaction.
+func (b *Backend) ExistsMulti(keys ...string) (map[string]bool, error) {
+	if r, err := b.readTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
+		futures := make([]fdb.FutureByteSlice, len(keys))
+		for i, key := range keys {
+			futures[i] = tx.Get(b.key(key))
+		}
+		ret := make(map[string]bool, len(keys))
+		for i, key := range keys {
+			v, err := futures[i].Get()
+			if err != nil {
+				return nil, err
+			}
+			ret[key] = v != nil
+		}
+		return ret, nil
+	}); err != nil {
+		return nil, err
+	} else {
+		return r.(map[string]bool), nil
+	}
+}
+
 func (b *Backend) Set(key string, value interface{}) error {
-	_, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
-		tx.Set(b.key(key), toBytes(value))
+	_, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
+		b.setValue(tx, key, toBytes(value))
+		return nil, nil
+	})
+	return err
+}
+
+// Update implements keyvaluestore.Updater using a single transaction. f is invoked again if the
+// transaction is retried.
+func (b *Backend) Update(key string, f func(prev *string) (*string, error)) error {
+	_, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
+		v, err := b.getValue(tx, key).Get()
+		if err != nil {
+			return nil, err
+		}
+		var prev *string
+		if v != nil {
+			s := string(v)
+			prev = &s
+		}
+		next, err := f(prev)
+		if err != nil || next == nil {
+			return nil, err
+		}
+		b.setValue(tx, key, []byte(*next))
 		return nil, nil
 	})
 	return err
 }
 
 func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
-	if didSet, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	if didSet, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		return b.setNX(tx, key, value)
 	}); err != nil {
 		return false, err
@@ -153,17 +267,16 @@ func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
 }
 
 func (b *Backend) setNX(tx fdb.Transaction, key string, value interface{}) (bool, error) {
-	k := b.key(key)
-	v, err := tx.Get(k).Get()
+	v, err := tx.Get(b.key(key)).Get()
 	if err != nil || v != nil {
 		return false, err
 	}
-	tx.Set(k, toBytes(value))
+	b.setValue(tx, key, toBytes(value))
 	return true, nil
 }
 
 func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
-	if didSet, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	if didSet, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		return b.setXX(tx, key, value)
 	}); err != nil {
 		return false, err
@@ -173,17 +286,16 @@ func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
 }
 
 func (b *Backend) setXX(tx fdb.Transaction, key string, value interface{}) (bool, error) {
-	k := b.key(key)
-	v, err := tx.Get(k).Get()
+	v, err := tx.Get(b.key(key)).Get()
 	if err != nil || v == nil {
 		return false, err
 	}
-	tx.Set(k, toBytes(value))
+	b.setValue(tx, key, toBytes(value))
 	return true, nil
 }
 
 func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
-	if didSet, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	if didSet, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		return b.setEQ(tx, key, value, oldValue)
 	}); err != nil {
 		return false, err
@@ -193,12 +305,11 @@ func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
 }
 
 func (b *Backend) setEQ(tx fdb.Transaction, key string, value, oldValue interface{}) (bool, error) {
-	k := b.key(key)
-	v, err := tx.Get(k).Get()
+	v, err := b.getValue(tx, key).Get()
 	if err != nil || !bytes.Equal(v, toBytes(oldValue)) {
 		return false, err
 	}
-	tx.Set(k, toBytes(value))
+	b.setValue(tx, key, toBytes(value))
 	return true, nil
 }
 
@@ -208,7 +319,7 @@ func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) e
 	for _, member := range members {
 		toAdd[string(toBytes(member))] = struct{}{}
 	}
-	_, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	_, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		op := sAdd{B: b}
 		op.InitNonBlocking(tx, key)
 		return nil, op.Complete(tx, key, toAdd)
@@ -218,11 +329,11 @@ func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) e
 
 type sAdd struct {
 	B   *Backend
-	get fdb.FutureByteSlice
+	get futureValue
 }
 
 func (op *sAdd) InitNonBlocking(tx fdb.Transaction, key string) {
-	op.get = tx.Get(op.B.key(key))
+	op.get = op.B.getValue(tx, key)
 }
 
 func (op *sAdd) Complete(tx fdb.Transaction, key string, toAdd map[string]struct{}) error {
@@ -234,7 +345,7 @@ func (op *sAdd) Complete(tx fdb.Transaction, key string, toAdd map[string]struct
 	for len(rem) > 0 {
 		l, n := binary.Uvarint(rem)
 		if n <= 0 || uint64(len(rem)) < uint64(n)+l {
-			return fmt.Errorf("unable to decode set")
+			return decodeError("set")
 		}
 		delete(toAdd, string(rem[n:n+int(l)]))
 		rem = rem[n+int(l):]
@@ -248,7 +359,7 @@ func (op *sAdd) Complete(tx fdb.Transaction, key string, toAdd map[string]struct
 			newValue = append(newValue, buf[:n]...)
 			newValue = append(newValue, b...)
 		}
-		tx.Set(op.B.key(key), newValue)
+		op.B.setValue(tx, key, newValue)
 	}
 	return nil
 }
@@ -259,7 +370,7 @@ func (b *Backend) SRem(key string, member interface{}, members ...interface{}) e
 	for _, member := range members {
 		toRem[string(toBytes(member))] = struct{}{}
 	}
-	_, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	_, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		op := sRem{B: b}
 		op.InitNonBlocking(tx, key)
 		return nil, op.Complete(tx, key, toRem)
@@ -269,11 +380,11 @@ func (b *Backend) SRem(key string, member interface{}, members ...interface{}) e
 
 type sRem struct {
 	B   *Backend
-	get fdb.FutureByteSlice
+	get futureValue
 }
 
 func (op *sRem) InitNonBlocking(tx fdb.Transaction, key string) {
-	op.get = tx.Get(op.B.key(key))
+	op.get = op.B.getValue(tx, key)
 }
 
 func (op *sRem) Complete(tx fdb.Transaction, key string, toRem map[string]struct{}) error {
@@ -286,7 +397,7 @@ func (op *sRem) Complete(tx fdb.Transaction, key string, toRem map[string]struct
 	for len(rem) > 0 {
 		l, n := binary.Uvarint(rem)
 		if n <= 0 || uint64(len(rem)) < uint64(n)+l {
-			return fmt.Errorf("unable to decode set")
+			return decodeError("set")
 		}
 		if _, ok := toRem[string(rem[n:n+int(l)])]; !ok {
 			newValue = append(newValue, rem[:n+int(l)]...)
@@ -294,14 +405,14 @@ func (op *sRem) Complete(tx fdb.Transaction, key string, toRem map[string]struct
 		rem = rem[n+int(l):]
 	}
 	if len(newValue) < len(v) {
-		tx.Set(op.B.key(key), newValue)
+		op.B.setValue(tx, key, newValue)
 	}
 	return nil
 }
 
 func (b *Backend) SMembers(key string) ([]string, error) {
-	if r, err := b.Database.ReadTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
-		return tx.Get(b.key(key)).Get()
+	if r, err := b.readTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
+		return b.getValue(tx, key).Get()
 	}); err != nil {
 		return nil, err
 	} else if b := r.([]byte); b != nil {
@@ -315,7 +426,7 @@ func parseSMembers(b []byte) ([]string, error) {
 	for len(b) > 0 {
 		l, n := binary.Uvarint(b)
 		if n <= 0 || uint64(len(b)) < uint64(n)+l {
-			return nil, fmt.Errorf("unable to decode set")
+			return nil, decodeError("set")
 		}
 		ret = append(ret, string(b[n:n+int(l)]))
 		b = b[n+int(l):]
@@ -329,7 +440,7 @@ func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvalues
 	for _, field := range fields {
 		toAdd[field.Key] = field.Value
 	}
-	_, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	_, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		impl := hSet{B: b}
 		impl.InitNonBlocking(tx, key)
 		return nil, impl.Complete(tx, key, toAdd)
@@ -339,11 +450,11 @@ func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvalues
 
 type hSet struct {
 	B   *Backend
-	get fdb.FutureByteSlice
+	get futureValue
 }
 
 func (op *hSet) InitNonBlocking(tx fdb.Transaction, key string) {
-	op.get = tx.Get(op.B.key(key))
+	op.get = op.B.getValue(tx, key)
 }
 
 func (op *hSet) Complete(tx fdb.Transaction, key string, toAdd map[string]interface{}) error {
@@ -356,11 +467,11 @@ func (op *hSet) Complete(tx fdb.Transaction, key string, toAdd map[string]interf
 	for len(rem) > 0 {
 		kl, kn := binary.Uvarint(rem)
 		if kn <= 0 || uint64(len(rem)) < uint64(kn)+kl {
-			return fmt.Errorf("unable to decode hash")
+			return decodeError("hash")
 		}
 		vl, vn := binary.Uvarint(rem[kn+int(kl):])
 		if vn <= 0 || uint64(len(rem)) < uint64(kn+vn)+kl+vl {
-			return fmt.Errorf("unable to decode hash")
+			return decodeError("hash")
 		}
 		if _, ok := toAdd[string(rem[kn:kn+int(kl)])]; !ok {
 			newValue = append(newValue, rem[:kn+vn+int(kl+vl)]...)
@@ -378,7 +489,7 @@ func (op *hSet) Complete(tx fdb.Transaction, key string, toAdd map[string]interf
 		newValue = append(newValue, buf[:n]...)
 		newValue = append(newValue, vb...)
 	}
-	tx.Set(op.B.key(key), newValue)
+	op.B.setValue(tx, key, newValue)
 	return nil
 }
 
@@ -391,11 +502,11 @@ func (op *hSet) CompleteNX(tx fdb.Transaction, key, field string, value interfac
 	for len(rem) > 0 {
 		kl, kn := binary.Uvarint(rem)
 		if kn <= 0 || uint64(len(rem)) < uint64(kn)+kl {
-			return false, fmt.Errorf("unable to decode hash")
+			return false, decodeError("hash")
 		}
 		vl, vn := binary.Uvarint(rem[kn+int(kl):])
 		if vn <= 0 || uint64(len(rem)) < uint64(kn+vn)+kl+vl {
-			return false, fmt.Errorf("unable to decode hash")
+			return false, decodeError("hash")
 		}
 		if string(rem[kn:kn+int(kl)]) == field {
 			return false, nil
@@ -415,7 +526,7 @@ func (op *hSet) CompleteNX(tx fdb.Transaction, key, field string, value interfac
 	newValue = append(newValue, buf[:n]...)
 	newValue = append(newValue, vb...)
 
-	tx.Set(op.B.key(key), newValue)
+	op.B.setValue(tx, key, newValue)
 	return true, nil
 }
 
@@ -425,7 +536,7 @@ func (b *Backend) HDel(key, field string, fields ...string) error {
 	for _, field := range fields {
 		toDel[field] = struct{}{}
 	}
-	_, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	_, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		impl := &hDel{B: b}
 		impl.InitNonBlocking(tx, key)
 		return nil, impl.Complete(tx, key, toDel)
@@ -435,11 +546,11 @@ func (b *Backend) HDel(key, field string, fields ...string) error {
 
 type hDel struct {
 	B   *Backend
-	get fdb.FutureByteSlice
+	get futureValue
 }
 
 func (op *hDel) InitNonBlocking(tx fdb.Transaction, key string) {
-	op.get = tx.Get(op.B.key(key))
+	op.get = op.B.getValue(tx, key)
 }
 
 func (op *hDel) Complete(tx fdb.Transaction, key string, toDel map[string]struct{}) error {
@@ -452,11 +563,11 @@ func (op *hDel) Complete(tx fdb.Transaction, key string, toDel map[string]struct
 	for len(rem) > 0 {
 		kl, kn := binary.Uvarint(rem)
 		if kn <= 0 || uint64(len(rem)) < uint64(kn)+kl {
-			return fmt.Errorf("unable to decode hash")
+			return decodeError("hash")
 		}
 		vl, vn := binary.Uvarint(rem[kn+int(kl):])
 		if vn <= 0 || uint64(len(rem)) < uint64(kn+vn)+kl+vl {
-			return fmt.Errorf("unable to decode hash")
+			return decodeError("hash")
 		}
 		if _, ok := toDel[string(rem[kn:kn+int(kl)])]; !ok {
 			newValue = append(newValue, rem[:kn+vn+int(kl+vl)]...)
@@ -464,7 +575,7 @@ func (op *hDel) Complete(tx fdb.Transaction, key string, toDel map[string]struct
 		rem = rem[kn+vn+int(kl+vl):]
 	}
 	if len(newValue) < len(v) {
-		tx.Set(op.B.key(key), newValue)
+		op.B.setValue(tx, key, newValue)
 	}
 	return nil
 }
@@ -479,22 +590,24 @@ func (b *Backend) HGet(key, field string) (*string, error) {
 }
 
 func (b *Backend) HGetAll(key string) (map[string]string, error) {
-	k := b.key(key)
-	if r, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
-		b, err := tx.Get(k).Get()
+	if r, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
+		b, err := b.getValue(tx, key).Get()
 		if err != nil {
 			return nil, err
 		}
+		if len(b) == 0 {
+			return map[string]string(nil), nil
+		}
 		rem := b
 		ret := map[string]string{}
 		for len(rem) > 0 {
 			kl, kn := binary.Uvarint(rem)
 			if kn <= 0 || uint64(len(rem)) < uint64(kn)+kl {
-				return nil, fmt.Errorf("unable to decode hash")
+				return nil, decodeError("hash")
 			}
 			vl, vn := binary.Uvarint(rem[kn+int(kl):])
 			if vn <= 0 || uint64(len(rem)) < uint64(kn+vn)+kl+vl {
-				return nil, fmt.Errorf("unable to decode hash")
+				return nil, decodeError("hash")
 			}
 			ret[string(rem[kn:kn+int(kl)])] = string(rem[kn+int(kl)+vn : kn+vn+int(kl+vl)])
 			rem = rem[kn+vn+int(kl+vl):]
@@ -520,6 +633,64 @@ func (b *Backend) zScoreKey(key, field string, score float64) fdb.Key {
 	return b.Subspace.Pack(tuple.Tuple{key, "s", score, field})
 }
 
+// zCountKey is the key of a little-endian counter that tracks the number of members in a sorted
+// set. It's maintained atomically by every operation that adds or removes a member.
+func (b *Backend) zCountKey(key string) fdb.Key {
+	return b.Subspace.Pack(tuple.Tuple{key, "c"})
+}
+
+// zCountInitializedKey marks a sorted set's counter as accurate. It's written along with the first
+// member of a new set. Sets written before counters were introduced have no counter, or one that
+// only reflects the writes made since, so their counters are only trusted once they've been
+// initialized by zCard.
+func (b *Backend) zCountInitializedKey(key string) fdb.Key {
+	return b.Subspace.Pack(tuple.Tuple{key, "ci"})
+}
+
+// readZCount returns the sorted set's counter, or -1 if it hasn't been initialized.
+func (b *Backend) readZCount(tx fdb.ReadTransaction, key string) (int, error) {
+	initialized := tx.Get(b.zCountInitializedKey(key))
+	count := tx.Get(b.zCountKey(key))
+	if v, err := initialized.Get(); err != nil || v == nil {
+		return -1, err
+	}
+	v, err := count.Get()
+	if err != nil || len(v) < 8 {
+		return 0, err
+	}
+	return int(int64(binary.LittleEndian.Uint64(v))), nil
+}
+
+func (b *Backend) zCountAdd(tx fdb.Transaction, key string, n int64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(n))
+	tx.Add(b.zCountKey(key), buf[:])
+}
+
+// zCountAddMember adds a new member to the sorted set's counter. It must be invoked before the
+// member is written. If the counter isn't initialized and the set is empty, the write creates the
+// set, so the counter is initialized here instead of by the first ZCount.
+func (b *Backend) zCountAddMember(tx fdb.Transaction, key string) error {
+	initialized, err := tx.Get(b.zCountInitializedKey(key)).Get()
+	if err != nil {
+		return err
+	} else if initialized == nil {
+		// Reading the members conflicts with any concurrent writes to the set, so the counter can
+		// be set rather than added to.
+		kvs, err := tx.GetRange(b.scoreRange(key, math.Inf(-1), math.Inf(1)), fdb.RangeOptions{
+			Limit: 1,
+		}).GetSliceWithError()
+		if err != nil {
+			return err
+		} else if len(kvs) == 0 {
+			tx.Set(b.zCountKey(key), make([]byte, 8))
+			tx.Set(b.zCountInitializedKey(key), []byte{})
+		}
+	}
+	b.zCountAdd(tx, key, 1)
+	return nil
+}
+
 func floatBytes(f float64) []byte {
 	n := math.Float64bits(f)
 	buf := make([]byte, 8)
@@ -536,7 +707,7 @@ func floatFromBytes(b []byte) float64 {
 }
 
 func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
-	_, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	_, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		op := zHAdd{B: b}
 		op.InitNonBlocking(tx, key, field)
 		return nil, op.Complete(tx, key, field, member, score)
@@ -544,6 +715,38 @@ func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) er
 	return err
 }
 
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// The existing fields are all read before any are written, so if a field is repeated, only its
+	// last entry is added.
+	last := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		last[entry.Field] = i
+	}
+
+	_, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
+		ops := make([]zHAdd, len(entries))
+		for i, entry := range entries {
+			if last[entry.Field] == i {
+				ops[i] = zHAdd{B: b}
+				ops[i].InitNonBlocking(tx, key, entry.Field)
+			}
+		}
+		for i, entry := range entries {
+			if last[entry.Field] == i {
+				if err := ops[i].Complete(tx, key, entry.Field, entry.Member, entry.Score); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
 type zHAdd struct {
 	B   *Backend
 	get fdb.FutureByteSlice
@@ -563,6 +766,8 @@ func (op *zHAdd) Complete(tx fdb.Transaction, key, field string, member interfac
 		if prevScore := floatFromBytes(existing[:8]); prevScore != score {
 			tx.Clear(op.B.zScoreKey(key, field, prevScore))
 		}
+	} else if err := op.B.zCountAddMember(tx, key); err != nil {
+		return err
 	}
 	tx.Set(op.B.zLexKey(key, field), append(floatBytes(score)))
 	tx.Set(op.B.zScoreKey(key, field, score), v)
@@ -575,13 +780,29 @@ func (op *zHAdd) CompleteNX(tx fdb.Transaction, key, field string, member interf
 	if err != nil || existing != nil {
 		return false, err
 	}
+	if err := op.B.zCountAddMember(tx, key); err != nil {
+		return false, err
+	}
 	tx.Set(op.B.zLexKey(key, field), append(floatBytes(score), v...))
 	tx.Set(op.B.zScoreKey(key, field, score), v)
-	return true, err
+	return true, nil
+}
+
+// CompleteEQ completes the add only if the field exists and its member is equal to oldMember.
+func (op *zHAdd) CompleteEQ(tx fdb.Transaction, key, field string, member, oldMember interface{}, score float64) (bool, error) {
+	existing, err := op.get.Get()
+	if err != nil || existing == nil {
+		return false, err
+	}
+	prev, err := tx.Get(op.B.zScoreKey(key, field, floatFromBytes(existing[:8]))).Get()
+	if err != nil || !bytes.Equal(prev, toBytes(oldMember)) {
+		return false, err
+	}
+	return true, op.Complete(tx, key, field, member, score)
 }
 
 func (b *Backend) zHAddNX(tx fdb.Transaction, key, field string, member interface{}, score float64) (bool, error) {
-	if r, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	if r, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		op := zHAdd{B: b}
 		op.InitNonBlocking(tx, key, field)
 		return op.CompleteNX(tx, key, field, member, score)
@@ -593,7 +814,7 @@ func (b *Backend) zHAddNX(tx fdb.Transaction, key, field string, member interfac
 }
 
 func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
-	if r, err := b.Database.ReadTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
+	if r, err := b.readTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
 		return b.zScore(tx, key, member)
 	}); err != nil {
 		return nil, err
@@ -616,7 +837,7 @@ func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, e
 	field := *keyvaluestore.ToString(member)
 	v := []byte(field)
 	k := b.zLexKey(key, field)
-	if score, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	if score, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		score := n
 		if existing, err := tx.Get(k).Get(); err != nil {
 			return nil, err
@@ -624,6 +845,8 @@ func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, e
 			prevScore := floatFromBytes(existing[:8])
 			score += prevScore
 			tx.Clear(b.zScoreKey(key, field, prevScore))
+		} else if err := b.zCountAddMember(tx, key); err != nil {
+			return nil, err
 		}
 		tx.Set(k, append(floatBytes(score), v...))
 		tx.Set(b.zScoreKey(key, field, score), v)
@@ -641,7 +864,7 @@ func (b *Backend) ZRem(key string, member interface{}) error {
 }
 
 func (b *Backend) ZHRem(key, field string) error {
-	_, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+	_, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
 		op := zHRem{B: b}
 		op.InitNonBlocking(tx, key, field)
 		return nil, op.Complete(tx, key, field)
@@ -649,6 +872,18 @@ func (b *Backend) ZHRem(key, field string) error {
 	return err
 }
 
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	if didRemove, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
+		op := zHRem{B: b}
+		op.InitNonBlockingEQ(tx, key, field)
+		return op.CompleteEQ(tx, key, field, member)
+	}); err != nil {
+		return false, err
+	} else {
+		return didRemove.(bool), nil
+	}
+}
+
 type zHRem struct {
 	B   *Backend
 	get fdb.FutureByteSlice
@@ -665,22 +900,113 @@ func (op *zHRem) Complete(tx fdb.Transaction, key, field string) error {
 	if err == nil && existing != nil {
 		score := floatFromBytes(existing[:8])
 		tx.Clear(op.B.zScoreKey(key, field, score))
+		op.B.zCountAdd(tx, key, -1)
 	}
 	return err
 }
 
+// InitNonBlockingEQ is like InitNonBlocking, but the field is only cleared by CompleteEQ.
+func (op *zHRem) InitNonBlockingEQ(tx fdb.Transaction, key, field string) {
+	op.get = tx.Get(op.B.zLexKey(key, field))
+}
+
+// CompleteEQ completes the removal only if the field exists and its member is equal to the given
+// one.
+func (op *zHRem) CompleteEQ(tx fdb.Transaction, key, field string, member interface{}) (bool, error) {
+	existing, err := op.get.Get()
+	if err != nil || existing == nil {
+		return false, err
+	}
+	scoreKey := op.B.zScoreKey(key, field, floatFromBytes(existing[:8]))
+	prev, err := tx.Get(scoreKey).Get()
+	if err != nil || !bytes.Equal(prev, toBytes(member)) {
+		return false, err
+	}
+	tx.Clear(op.B.zLexKey(key, field))
+	tx.Clear(scoreKey)
+	op.B.zCountAdd(tx, key, -1)
+	return true, nil
+}
+
+// ZCount returns the number of members with scores between min and max. Counting the entire set
+// is O(1) as it only reads the maintained counter, except for the first count of a set that existed
+// before counters were introduced, which initializes it. Counting a bounded range still has to read
+// each key in the range.
 func (b *Backend) ZCount(key string, min, max float64) (int, error) {
-	// TODO: use the (also iffy) approach here?:
-	// https://forums.foundationdb.org/t/getting-the-number-of-key-value-pairs/189/5
-	s, err := b.ZRangeByScore(key, min, max, 0)
-	return len(s), err
+	if min == math.Inf(-1) && max == math.Inf(1) {
+		return b.zCard(key)
+	}
+	return b.zCountRange(b.scoreRange(key, min, max))
 }
 
+// ZLexCount returns the number of members between min and max. Like ZCount, counting the entire
+// set is O(1).
 func (b *Backend) ZLexCount(key, min, max string) (int, error) {
-	// TODO: use the (also iffy) approach here?:
-	// https://forums.foundationdb.org/t/getting-the-number-of-key-value-pairs/189/5
-	s, err := b.ZRangeByLex(key, min, max, 0)
-	return len(s), err
+	if min == "-" && max == "+" {
+		return b.zCard(key)
+	}
+	return b.zCountRange(b.lexRange(key, min, max))
+}
+
+// zCard returns the number of members in a sorted set. If the set's counter hasn't been initialized,
+// e.g. because the set was written before counters were introduced, its members are counted once
+// and the counter is initialized in the same transaction.
+func (b *Backend) zCard(key string) (int, error) {
+	if r, err := b.readTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
+		return b.readZCount(tx, key)
+	}); err != nil {
+		return 0, err
+	} else if n := r.(int); n >= 0 {
+		return n, nil
+	} else if b.readVersion != 0 {
+		// Backends that read at a fixed version can't write, so the counter is left alone.
+		return b.zCountRange(b.scoreRange(key, math.Inf(-1), math.Inf(1)))
+	}
+
+	if r, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
+		if n, err := b.readZCount(tx, key); err != nil || n >= 0 {
+			return n, err
+		}
+		// Reading the members conflicts with any concurrent writes to the set, so the counter can
+		// be set rather than added to.
+		n, err := countRange(tx, b.scoreRange(key, math.Inf(-1), math.Inf(1)))
+		if err != nil {
+			return nil, err
+		}
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(n))
+		tx.Set(b.zCountKey(key), buf[:])
+		tx.Set(b.zCountInitializedKey(key), []byte{})
+		return n, nil
+	}); err != nil {
+		return 0, err
+	} else {
+		return r.(int), nil
+	}
+}
+
+func (b *Backend) zCountRange(r fdb.Range) (int, error) {
+	if n, err := b.readTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
+		return countRange(tx, r)
+	}); err != nil {
+		return 0, err
+	} else {
+		return n.(int), nil
+	}
+}
+
+func countRange(tx fdb.ReadTransaction, r fdb.Range) (int, error) {
+	it := tx.GetRange(r, fdb.RangeOptions{
+		Mode: fdb.StreamingModeWantAll,
+	}).Iterator()
+	n := 0
+	for it.Advance() {
+		if _, err := it.Get(); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
 }
 
 func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
@@ -718,7 +1044,7 @@ func (b *Backend) scoreRange(key string, min, max float64) fdb.Range {
 }
 
 func (b *Backend) zRangeByScoreWithScores(key string, min, max float64, limit int, reverse bool) (keyvaluestore.ScoredMembers, error) {
-	if r, err := b.Database.ReadTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
+	if r, err := b.readTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
 		it := tx.GetRange(
 			b.scoreRange(key, min, max),
 			fdb.RangeOptions{
@@ -805,7 +1131,7 @@ func (b *Backend) lexRange(key string, min, max string) fdb.Range {
 }
 
 func (b *Backend) zHRangeByLex(key string, min, max string, limit int, reverse bool) ([]string, error) {
-	if r, err := b.Database.ReadTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
+	if r, err := b.readTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
 		it := tx.GetRange(
 			b.lexRange(key, min, max),
 			fdb.RangeOptions{
@@ -838,6 +1164,72 @@ func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]str
 	return b.zHRangeByLex(key, min, max, limit, true)
 }
 
+var _ keyvaluestore.SortedHashFieldRanger = &Backend{}
+
+func (b *Backend) ZHRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return b.zRangeWithFields(b.scoreRange(key, min, max), limit, false)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return b.zRangeWithFields(b.scoreRange(key, min, max), limit, true)
+}
+
+func (b *Backend) ZHRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return b.zRangeWithFields(b.lexRange(key, min, max), limit, false)
+}
+
+func (b *Backend) ZHRevRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return b.zRangeWithFields(b.lexRange(key, min, max), limit, true)
+}
+
+func (b *Backend) zRangeWithFields(keys fdb.Range, limit int, reverse bool) (keyvaluestore.FieldScoredMembers, error) {
+	if r, err := b.readTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
+		it := tx.GetRange(keys, fdb.RangeOptions{
+			Mode:    fdb.StreamingModeWantAll,
+			Limit:   limit,
+			Reverse: reverse,
+		}).Iterator()
+		var ret keyvaluestore.FieldScoredMembers
+		for it.Advance() {
+			kv, err := it.Get()
+			if err != nil {
+				return nil, err
+			}
+			key, err := b.Subspace.Unpack(kv.Key)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, &keyvaluestore.FieldScoredMember{
+				Field: key[3].(string),
+				Value: string(kv.Value),
+				Score: key[2].(float64),
+			})
+		}
+		return ret, nil
+	}); err != nil {
+		return nil, err
+	} else {
+		return r.(keyvaluestore.FieldScoredMembers), nil
+	}
+}
+
+// Ping gets a read version, which requires the cluster to be available.
+func (b *Backend) Ping() error {
+	_, err := b.readTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
+		return tx.GetReadVersion().Get()
+	})
+	return err
+}
+
+// Close closes the database if it has a Close method, as fdb.Database does in newer versions of the
+// bindings. Otherwise it does nothing.
+func (b *Backend) Close() error {
+	if c, ok := b.Database.(interface{ Close() }); ok {
+		c.Close()
+	}
+	return nil
+}
+
 func (b *Backend) Unwrap() keyvaluestore.Backend {
 	return nil
 }
@@ -1,43 +1,53 @@
 package foundationdbstore
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
 	"github.com/stretchr/testify/require"
 
 	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreinvalidator"
 	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
 )
 
-func TestBackend(t *testing.T) {
-	var db fdb.Database
-	var ss subspace.Subspace
-
-	if subspaceStr := os.Getenv("FOUNDATIONDB_SUBSPACE"); subspaceStr == "" {
+func newTestDatabase(t *testing.T) (fdb.Database, string) {
+	subspaceStr := os.Getenv("FOUNDATIONDB_SUBSPACE")
+	if subspaceStr == "" {
 		t.Skip("no foundationdb subspace specified")
-	} else {
-		fdb.MustAPIVersion(620)
-
-		if content := os.Getenv("FOUNDATIONDB_CLUSTERFILE_CONTENT"); content == "" {
-			var err error
-			db, err = fdb.OpenDefault()
-			require.NoError(t, err)
-		} else {
-			f, err := ioutil.TempFile("", "*.cluster")
-			require.NoError(t, err)
-			_, err = f.Write([]byte(content))
-			require.NoError(t, err)
-			f.Close()
-			db, err = fdb.OpenDatabase(f.Name())
-			require.NoError(t, err)
-		}
+	}
+
+	fdb.MustAPIVersion(620)
 
-		ss = subspace.FromBytes([]byte(subspaceStr))
+	if content := os.Getenv("FOUNDATIONDB_CLUSTERFILE_CONTENT"); content == "" {
+		db, err := fdb.OpenDefault()
+		require.NoError(t, err)
+		return db, subspaceStr
+	} else {
+		f, err := ioutil.TempFile("", "*.cluster")
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+		f.Close()
+		db, err := fdb.OpenDatabase(f.Name())
+		require.NoError(t, err)
+		return db, subspaceStr
 	}
+}
+
+func TestBackend(t *testing.T) {
+	db, subspaceStr := newTestDatabase(t)
+	ss := subspace.FromBytes([]byte(subspaceStr))
 
 	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
 		_, err := db.Transact(func(tx fdb.Transaction) (interface{}, error) {
@@ -52,3 +62,252 @@ func TestBackend(t *testing.T) {
 		}
 	})
 }
+
+func TestGroupBatchReads(t *testing.T) {
+	db, subspaceStr := newTestDatabase(t)
+	ss := subspace.FromBytes([]byte(subspaceStr))
+
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		_, err := db.Transact(func(tx fdb.Transaction) (interface{}, error) {
+			tx.ClearRange(ss)
+			return nil, nil
+		})
+		require.NoError(t, err)
+
+		return &Backend{
+			Database:        db,
+			Subspace:        ss,
+			GroupBatchReads: true,
+		}
+	})
+}
+
+func TestNewBackendWithDirectory(t *testing.T) {
+	db, subspaceStr := newTestDatabase(t)
+	path := []string{subspaceStr, "directory"}
+
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		_, err := directory.Root().Remove(db, path)
+		require.NoError(t, err)
+
+		b, err := NewBackendWithDirectory(db, path)
+		require.NoError(t, err)
+		return b
+	})
+}
+
+var _ keyvaluestoreinvalidator.Watcher = &Backend{}
+
+func TestWatch(t *testing.T) {
+	db, subspaceStr := newTestDatabase(t)
+	b := &Backend{
+		Database: db,
+		Subspace: subspace.FromBytes([]byte(subspaceStr)),
+	}
+
+	ch, cancel := b.Watch("foo")
+	defer cancel()
+
+	// The watch is created asynchronously, so keep making changes until one is noticed.
+	for i := 0; ; i++ {
+		require.NoError(t, b.Set("foo", i))
+		select {
+		case <-ch:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+		require.Less(t, i, 100, "timed out waiting for watch")
+	}
+}
+
+func TestObservableBackend(t *testing.T) {
+	db, subspaceStr := newTestDatabase(t)
+	keyvaluestoretest.TestObservableBackend(t, func() keyvaluestore.Backend {
+		return &Backend{
+			Database: db,
+			Subspace: subspace.FromBytes([]byte(subspaceStr)),
+		}
+	})
+}
+
+func TestSnapshotBatch(t *testing.T) {
+	db, subspaceStr := newTestDatabase(t)
+	keyvaluestoretest.TestSnapshotBatch(t, func() keyvaluestore.Backend {
+		return &Backend{
+			Database: db,
+			Subspace: subspace.FromBytes([]byte(subspaceStr)),
+		}
+	})
+}
+
+func TestTransactionOptions(t *testing.T) {
+	db, subspaceStr := newTestDatabase(t)
+	b := &Backend{
+		Database: db,
+		Subspace: subspace.FromBytes([]byte(subspaceStr)),
+		TransactionOptions: TransactionOptions{
+			Timeout:    10 * time.Second,
+			RetryLimit: 5,
+			SizeLimit:  1000,
+		},
+	}
+
+	require.NoError(t, b.Set("foo", "bar"))
+
+	err := b.Set("foo", strings.Repeat("x", 2000))
+	var tooLarge *TransactionTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	require.True(t, errors.Is(err, ErrTransactionTooLarge))
+	require.False(t, errors.Is(err, keyvaluestore.ErrValueTooLarge))
+}
+
+func TestRenameCollectionTooLarge(t *testing.T) {
+	db, subspaceStr := newTestDatabase(t)
+	ss := subspace.FromBytes([]byte(subspaceStr))
+	_, err := db.Transact(func(tx fdb.Transaction) (interface{}, error) {
+		tx.ClearRange(ss)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	b := &Backend{
+		Database: db,
+		Subspace: ss,
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, b.ZAdd("src", strings.Repeat(strconv.Itoa(i), 100), float64(i)))
+	}
+
+	limited := *b
+	limited.TransactionOptions.SizeLimit = 1000
+	_, err = limited.RenameCollection("src", "dst")
+	require.True(t, errors.Is(err, ErrTransactionTooLarge))
+
+	// Nothing is moved.
+	n, err := b.ZCount("src", math.Inf(-1), math.Inf(1))
+	require.NoError(t, err)
+	require.Equal(t, 10, n)
+	n, err = b.ZCount("dst", math.Inf(-1), math.Inf(1))
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	ok, err := b.RenameCollection("src", "dst")
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestTransactionOptionsDeadline(t *testing.T) {
+	opts, err := TransactionOptions{
+		Timeout:  time.Hour,
+		Deadline: time.Now().Add(time.Minute),
+	}.resolve()
+	require.NoError(t, err)
+	require.True(t, opts.Timeout <= time.Minute)
+	require.True(t, opts.Deadline.IsZero())
+
+	opts, err = TransactionOptions{
+		Timeout:  time.Second,
+		Deadline: time.Now().Add(time.Minute),
+	}.resolve()
+	require.NoError(t, err)
+	require.Equal(t, time.Second, opts.Timeout)
+
+	_, err = TransactionOptions{
+		Deadline: time.Now().Add(-time.Second),
+	}.resolve()
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+// readOnlyDatabase fails any transaction that may write.
+type readOnlyDatabase struct {
+	Database
+}
+
+func (db readOnlyDatabase) Transact(f func(fdb.Transaction) (interface{}, error)) (interface{}, error) {
+	return nil, errors.New("unexpected write transaction")
+}
+
+func TestZCountInitializedOnCreate(t *testing.T) {
+	db, subspaceStr := newTestDatabase(t)
+	ss := subspace.FromBytes([]byte(subspaceStr))
+	_, err := db.Transact(func(tx fdb.Transaction) (interface{}, error) {
+		tx.ClearRange(ss)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	b := &Backend{
+		Database: db,
+		Subspace: ss,
+	}
+
+	require.NoError(t, b.ZAdd("zadd", "a", 1))
+	require.NoError(t, b.ZAdd("zadd", "b", 2))
+	require.NoError(t, b.ZHMAdd("zhmadd", []keyvaluestore.ZHEntry{
+		{Field: "a", Member: "a", Score: 1},
+		{Field: "b", Member: "b", Score: 2},
+	}))
+	_, err = b.ZIncrBy("zincrby", "a", 1)
+	require.NoError(t, err)
+	_, err = b.ZIncrBy("zincrby", "b", 1)
+	require.NoError(t, err)
+
+	// Sets created since counters were introduced are counted without initializing their counters.
+	readOnly := &Backend{
+		Database: readOnlyDatabase{db},
+		Subspace: ss,
+	}
+	for _, key := range []string{"zadd", "zhmadd", "zincrby"} {
+		n, err := readOnly.ZCount(key, math.Inf(-1), math.Inf(1))
+		require.NoError(t, err)
+		require.Equal(t, 2, n, key)
+	}
+
+	// Emptying a set keeps its counter initialized.
+	require.NoError(t, b.ZRem("zadd", "a"))
+	require.NoError(t, b.ZRem("zadd", "b"))
+	require.NoError(t, b.ZAdd("zadd", "c", 1))
+	n, err := readOnly.ZCount("zadd", math.Inf(-1), math.Inf(1))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
+
+func TestZCountWithoutCounter(t *testing.T) {
+	db, subspaceStr := newTestDatabase(t)
+	ss := subspace.FromBytes([]byte(subspaceStr))
+	_, err := db.Transact(func(tx fdb.Transaction) (interface{}, error) {
+		tx.ClearRange(ss)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	b := &Backend{
+		Database: db,
+		Subspace: ss,
+	}
+
+	for _, member := range []string{"a", "b", "c"} {
+		require.NoError(t, b.ZAdd("foo", member, 1))
+	}
+
+	// Simulate a set written before counters were introduced, then add to it so that its counter
+	// only reflects the new member.
+	_, err = db.Transact(func(tx fdb.Transaction) (interface{}, error) {
+		tx.Clear(b.zCountKey("foo"))
+		tx.Clear(b.zCountInitializedKey("foo"))
+		return nil, nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, b.ZAdd("foo", "d", 1))
+
+	n, err := b.ZCount("foo", math.Inf(-1), math.Inf(1))
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	// The counter is initialized now, so it's maintained from here on.
+	require.NoError(t, b.ZAdd("foo", "e", 1))
+	require.NoError(t, b.ZRem("foo", "a"))
+	n, err = b.ZLexCount("foo", "-", "+")
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	n, err = b.ZCount("foo", math.Inf(-1), math.Inf(1))
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+}
@@ -1,7 +1,10 @@
 package foundationdbstore
 
 import (
+	"sync"
+
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
+
 	"github.com/ccbrown/keyvaluestore"
 )
 
@@ -12,10 +15,17 @@ type BatchOperation struct {
 	Backend *Backend
 
 	// phase one: initiate reads and start non-blocking operations
-	p1 []func(tx fdb.Transaction) error
+	p1 []func(tx fdb.Transaction, reads *rangeReader) error
 
 	// phase two: wait for the reads and complete the operations
 	p2 []func(tx fdb.Transaction) error
+
+	// the result errors of the operations, used to report their failures from Exec
+	errs []*error
+
+	// For snapshot batches, reads that can't be done in the phases are queued here instead of in
+	// the fallback so that they can be performed at the batch's read version.
+	snapshotReads *keyvaluestore.FallbackBatchOperation
 }
 
 type getResult struct {
@@ -34,15 +44,16 @@ func (r *getResult) Result() (*string, error) {
 
 func (op *BatchOperation) Get(key string) keyvaluestore.GetResult {
 	r := &getResult{}
-	var get fdb.FutureByteSlice
-	op.p1 = append(op.p1, func(tx fdb.Transaction) error {
-		get = tx.Snapshot().Get(op.Backend.key(key))
+	var get futureValue
+	op.p1 = append(op.p1, func(tx fdb.Transaction, reads *rangeReader) error {
+		get = op.Backend.readValue(reads, key)
 		return nil
 	})
 	op.p2 = append(op.p2, func(tx fdb.Transaction) error {
 		r.v, r.err = get.Get()
 		return r.err
 	})
+	op.errs = append(op.errs, &r.err)
 	return r
 }
 
@@ -57,19 +68,21 @@ func (r *sMembersResult) Result() ([]string, error) {
 
 func (op *BatchOperation) SMembers(key string) keyvaluestore.SMembersResult {
 	r := &sMembersResult{}
-	var get fdb.FutureByteSlice
-	op.p1 = append(op.p1, func(tx fdb.Transaction) error {
-		get = tx.Snapshot().Get(op.Backend.key(key))
+	var get futureValue
+	op.p1 = append(op.p1, func(tx fdb.Transaction, reads *rangeReader) error {
+		get = op.Backend.readValue(reads, key)
 		return nil
 	})
 	op.p2 = append(op.p2, func(tx fdb.Transaction) error {
 		var b []byte
-		b, r.err = get.Get()
-		if r.err == nil {
-			r.members, r.err = parseSMembers(b)
+		if b, r.err = get.Get(); r.err != nil {
+			return r.err
 		}
-		return r.err
+		// Values that can't be parsed only fail this operation, not the whole transaction.
+		r.members, r.err = parseSMembers(b)
+		return nil
 	})
+	op.errs = append(op.errs, &r.err)
 	return r
 }
 
@@ -85,39 +98,133 @@ func (r *zScoreResult) Result() (*float64, error) {
 func (op *BatchOperation) ZScore(key string, member interface{}) keyvaluestore.ZScoreResult {
 	field := *keyvaluestore.ToString(member)
 	r := &zScoreResult{}
-	var get fdb.FutureByteSlice
-	op.p1 = append(op.p1, func(tx fdb.Transaction) error {
-		get = tx.Snapshot().Get(op.Backend.zLexKey(key, field))
+	var get *rangeRead
+	op.p1 = append(op.p1, func(tx fdb.Transaction, reads *rangeReader) error {
+		k := op.Backend.zLexKey(key, field)
+		get = reads.read(k, append(k, 0))
 		return nil
 	})
 	op.p2 = append(op.p2, func(tx fdb.Transaction) error {
-		var existing []byte
-		existing, r.err = get.Get()
-		if r.err != nil || len(existing) < 8 {
+		var kvs []fdb.KeyValue
+		kvs, r.err = get.GetSliceWithError()
+		if r.err != nil || len(kvs) == 0 || len(kvs[0].Value) < 8 {
 			return r.err
 		}
-		score := floatFromBytes(existing[:8])
+		score := floatFromBytes(kvs[0].Value[:8])
 		r.score = &score
 		return nil
 	})
+	op.errs = append(op.errs, &r.err)
 	return r
 }
 
+func (op *BatchOperation) reads() *keyvaluestore.FallbackBatchOperation {
+	if op.snapshotReads != nil {
+		return op.snapshotReads
+	}
+	return op.FallbackBatchOperation
+}
+
+func (op *BatchOperation) ZHRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.reads().ZHRangeByScore(key, min, max, limit)
+}
+
+func (op *BatchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.reads().ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (op *BatchOperation) ZHRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.reads().ZHRangeByLex(key, min, max, limit)
+}
+
+func (op *BatchOperation) ZHRevRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.reads().ZHRevRangeByLex(key, min, max, limit)
+}
+
+func (op *BatchOperation) Len() int {
+	n := len(op.p1) + op.FallbackBatchOperation.Len()
+	if op.snapshotReads != nil {
+		n += op.snapshotReads.Len()
+	}
+	return n
+}
+
+// maxTransactionBatchSize is the maximum number of snapshot reads performed in a single
+// transaction. Larger batches are split up so that they don't exceed FoundationDB's transaction
+// time limit.
+const maxTransactionBatchSize = 1000
+
 func (op *BatchOperation) Exec() error {
-	if _, err := op.Backend.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
-		for _, f := range op.p1 {
-			if err := f(tx); err != nil {
-				return nil, err
-			}
+	// Each operation appends exactly one function to each phase, so the phases can be split at
+	// the same indices.
+	backend := op.Backend
+	if op.snapshotReads != nil {
+		version, err := op.Backend.readTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
+			return tx.GetReadVersion().Get()
+		})
+		if err != nil {
+			return err
 		}
-		for _, f := range op.p2 {
-			if err := f(tx); err != nil {
-				return nil, err
-			}
+		backend = op.Backend.atReadVersion(version.(int64))
+		op.snapshotReads.Backend = backend
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, keyvaluestore.MaxBatchConcurrency)
+
+	var errs []error
+	var errsMutex sync.Mutex
+
+	for i := 0; i < len(op.p1); i += maxTransactionBatchSize {
+		end := i + maxTransactionBatchSize
+		if end > len(op.p1) {
+			end = len(op.p1)
 		}
-		return true, nil
-	}); err != nil {
-		return err
+		p1, p2, chunkErrs := op.p1[i:end], op.p2[i:end], op.errs[i:end]
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			_, err := backend.transact(func(tx fdb.Transaction) (interface{}, error) {
+				reads := newRangeReader(tx.Snapshot(), backend.GroupBatchReads)
+				for _, f := range p1 {
+					if err := f(tx, reads); err != nil {
+						return nil, err
+					}
+				}
+				reads.start()
+				for _, f := range p2 {
+					if err := f(tx); err != nil {
+						return nil, err
+					}
+				}
+				return true, nil
+			})
+
+			errsMutex.Lock()
+			defer errsMutex.Unlock()
+			if err != nil {
+				// If the transaction fails, so do all of its operations.
+				for _, opErr := range chunkErrs {
+					*opErr = err
+				}
+				errs = append(errs, err)
+				return
+			}
+			for _, opErr := range chunkErrs {
+				if *opErr != nil {
+					errs = append(errs, *opErr)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	if op.snapshotReads != nil {
+		errs = append(errs, op.snapshotReads.Exec())
 	}
-	return op.FallbackBatchOperation.Exec()
+	return keyvaluestore.JoinBatchErrors(append(errs, op.FallbackBatchOperation.Exec())...)
 }
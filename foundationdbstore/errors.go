@@ -0,0 +1,42 @@
+package foundationdbstore
+
+import (
+	"fmt"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// translateError wraps err in a *keyvaluestore.Error if it corresponds to one of the keyvaluestore
+// error kinds. Otherwise err is returned as-is.
+func translateError(err error) error {
+	if err, ok := err.(fdb.Error); ok {
+		var kind error
+		switch err.Code {
+		case 1037, // process_behind, Storage process does not have recent mutations
+			1051, // batch_transaction_throttled, Batch GRV request rate limit exceeded
+			1213: // tag_throttled, Transaction tag is being throttled
+			kind = keyvaluestore.ErrThrottled
+		case 2102, // key_too_large, Key length exceeds limit
+			2103: // value_too_large, Value length exceeds limit
+			kind = keyvaluestore.ErrValueTooLarge
+		}
+		if kind != nil {
+			return &keyvaluestore.Error{
+				Kind: kind,
+				Err:  err,
+			}
+		}
+	}
+	return err
+}
+
+// decodeError is returned when a key's value can't be decoded as the type an operation expects,
+// which typically means that the key holds a different type.
+func decodeError(what string) error {
+	return &keyvaluestore.Error{
+		Kind: keyvaluestore.ErrWrongType,
+		Err:  fmt.Errorf("unable to decode %v", what),
+	}
+}
@@ -0,0 +1,87 @@
+package foundationdbstore
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Idempotency tokens are stored under tuples that begin with an integer rather than a string, so
+// they can't collide with any of the backend's keys. Each token's key holds its expiration, and an
+// index ordered by expiration allows expired tokens to be cleaned up.
+const (
+	idempotencyTokenTag      = 0
+	idempotencyExpirationTag = 1
+)
+
+// maxExpiredIdempotencyTokenCleanup is the number of expired tokens each idempotent atomic write
+// cleans up. This just needs to be more than one to keep up with the rate at which tokens expire.
+const maxExpiredIdempotencyTokenCleanup = 10
+
+func (b *Backend) idempotencyTokenKey(token string) fdb.Key {
+	return b.Subspace.Pack(tuple.Tuple{idempotencyTokenTag, token})
+}
+
+func (b *Backend) idempotencyExpirationKey(expiration int64, token string) fdb.Key {
+	return b.Subspace.Pack(tuple.Tuple{idempotencyExpirationTag, expiration, token})
+}
+
+func decodeIdempotencyExpiration(v []byte) int64 {
+	if len(v) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(v))
+}
+
+// idempotencyTokenExpiration returns the expiration of the given token, or nil if it hasn't been
+// used.
+func (b *Backend) idempotencyTokenExpiration(tx fdb.Transaction, token string) (*int64, error) {
+	v, err := tx.Get(b.idempotencyTokenKey(token)).Get()
+	if err != nil || v == nil {
+		return nil, err
+	}
+	expiration := decodeIdempotencyExpiration(v)
+	return &expiration, nil
+}
+
+// rememberIdempotencyToken records a successful atomic write's token and cleans up some of the
+// tokens that have expired. If the token was used before, previousExpiration must be its old
+// expiration.
+func (b *Backend) rememberIdempotencyToken(tx fdb.Transaction, token string, previousExpiration *int64, now time.Time) error {
+	if previousExpiration != nil {
+		tx.Clear(b.idempotencyExpirationKey(*previousExpiration, token))
+	}
+
+	expiration := now.Add(keyvaluestore.IdempotencyWindow).UnixNano()
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(expiration))
+	tx.Set(b.idempotencyTokenKey(token), v)
+	tx.Set(b.idempotencyExpirationKey(expiration, token), nil)
+
+	// The cleanup uses a snapshot read so that concurrent writes don't conflict with each other
+	// just because they cleaned up the same tokens.
+	expired, err := tx.Snapshot().GetRange(fdb.KeyRange{
+		Begin: b.Subspace.Pack(tuple.Tuple{idempotencyExpirationTag}),
+		End:   b.Subspace.Pack(tuple.Tuple{idempotencyExpirationTag, now.UnixNano()}),
+	}, fdb.RangeOptions{
+		Limit: maxExpiredIdempotencyTokenCleanup,
+	}).GetSliceWithError()
+	if err != nil {
+		return err
+	}
+	for _, kv := range expired {
+		t, err := b.Subspace.Unpack(kv.Key)
+		if err != nil || len(t) != 3 {
+			continue
+		}
+		if expiredToken, ok := t[2].(string); ok && expiredToken != token {
+			tx.Clear(b.idempotencyTokenKey(expiredToken))
+		}
+		tx.Clear(kv.Key)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package foundationdbstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+// TransactionOptions are applied to every transaction created by a backend. Zero values leave
+// FoundationDB's defaults in place.
+type TransactionOptions struct {
+	// Timeout limits the total time a transaction may take, including retries.
+	Timeout time.Duration
+
+	// Deadline is the time by which transactions must complete, including retries. If both it and
+	// Timeout are given, whichever is sooner applies.
+	Deadline time.Time
+
+	// RetryLimit limits the number of times a transaction will be retried after retryable errors
+	// such as conflicts. Use a negative value to disable retries.
+	RetryLimit int
+
+	// SizeLimit limits the number of bytes a transaction may write. FoundationDB doesn't allow
+	// transactions larger than 10MB regardless.
+	SizeLimit int
+}
+
+// resolve converts the deadline into a timeout for a transaction that's about to begin. It returns
+// an error if the deadline has already passed.
+func (o TransactionOptions) resolve() (TransactionOptions, error) {
+	if o.Deadline.IsZero() {
+		return o, nil
+	}
+	remaining := time.Until(o.Deadline)
+	if remaining < time.Millisecond {
+		return o, context.DeadlineExceeded
+	} else if o.Timeout == 0 || remaining < o.Timeout {
+		o.Timeout = remaining
+	}
+	o.Deadline = time.Time{}
+	return o, nil
+}
+
+func (o *TransactionOptions) apply(tx fdb.Transaction) error {
+	opts := tx.Options()
+	if o.Timeout != 0 {
+		if err := opts.SetTimeout(int64(o.Timeout / time.Millisecond)); err != nil {
+			return err
+		}
+	}
+	if o.RetryLimit < 0 {
+		if err := opts.SetRetryLimit(0); err != nil {
+			return err
+		}
+	} else if o.RetryLimit > 0 {
+		if err := opts.SetRetryLimit(int64(o.RetryLimit)); err != nil {
+			return err
+		}
+	}
+	if o.SizeLimit != 0 {
+		if err := opts.SetSizeLimit(int64(o.SizeLimit)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrTransactionTooLarge is matched by TransactionTooLargeError via errors.Is. It's distinct from
+// keyvaluestore.ErrValueTooLarge because no single key or value is too large: the write as a whole
+// exceeds the transaction size limit.
+var ErrTransactionTooLarge = errors.New("transaction too large")
+
+// TransactionTooLargeError happens when a write exceeds the transaction size limit. Atomic writes
+// can't be split across multiple transactions without losing their atomicity, so the caller needs
+// to break the write up in whatever way is safe for their data.
+type TransactionTooLargeError struct {
+	Err error
+}
+
+func (e *TransactionTooLargeError) Error() string {
+	return "transaction too large: " + e.Err.Error()
+}
+
+func (e *TransactionTooLargeError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes TransactionTooLargeError match ErrTransactionTooLarge.
+func (e *TransactionTooLargeError) Is(target error) bool {
+	return target == ErrTransactionTooLarge
+}
+
+func (b *Backend) transact(f func(fdb.Transaction) (interface{}, error)) (interface{}, error) {
+	opts, err := b.TransactionOptions.resolve()
+	if err != nil {
+		return nil, err
+	}
+	r, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+		if err := opts.apply(tx); err != nil {
+			return nil, err
+		}
+		if b.readVersion != 0 {
+			tx.SetReadVersion(b.readVersion)
+		}
+		return f(tx)
+	})
+	if err, ok := err.(fdb.Error); ok && err.Code == 2101 { // transaction_too_large
+		return nil, &TransactionTooLargeError{
+			Err: err,
+		}
+	}
+	return r, translateError(err)
+}
+
+func (b *Backend) readTransact(f func(fdb.ReadTransaction) (interface{}, error)) (interface{}, error) {
+	opts, err := b.TransactionOptions.resolve()
+	if err != nil {
+		return nil, err
+	}
+	r, err := b.Database.ReadTransact(func(rtx fdb.ReadTransaction) (interface{}, error) {
+		if tx, ok := rtx.(fdb.Transaction); ok {
+			if err := opts.apply(tx); err != nil {
+				return nil, err
+			}
+			if b.readVersion != 0 {
+				tx.SetReadVersion(b.readVersion)
+			}
+		}
+		return f(rtx)
+	})
+	return r, translateError(err)
+}
+
+// atReadVersion returns a backend whose transactions all read at the given version. Once the
+// version is too old, retrying can't help, so retries are disabled.
+func (b *Backend) atReadVersion(version int64) *Backend {
+	ret := *b
+	ret.readVersion = version
+	ret.TransactionOptions.RetryLimit = -1
+	return &ret
+}
@@ -5,8 +5,13 @@ import (
 	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
+
+	"github.com/ccbrown/keyvaluestore"
 )
 
+// Profiler is the FoundationDB-specific profiler interface.
+//
+// Deprecated: Pass a keyvaluestore.Profiler to WithProfiler instead.
 type Profiler interface {
 	AddFoundationDBTransactionProfile(duration time.Duration)
 }
@@ -29,21 +34,93 @@ func (p *BasicProfiler) FoundationDBTransactionDuration() time.Duration {
 	return time.Duration(atomic.LoadInt64(&p.transactionNanoseconds)) * time.Nanosecond
 }
 
+// transactionProfiler is implemented by profilers that want more detail than Profiler provides.
+type transactionProfiler interface {
+	addTransactionProfile(operation string, duration time.Duration, retries int, err error)
+	addConflictProfile(operation string, err error)
+}
+
+// unifiedProfiler adapts a keyvaluestore.Profiler to the FoundationDB-specific interface.
+type unifiedProfiler struct {
+	profiler keyvaluestore.Profiler
+}
+
+func (p *unifiedProfiler) AddFoundationDBTransactionProfile(duration time.Duration) {
+	p.addTransactionProfile("Transact", duration, 0, nil)
+}
+
+func (p *unifiedProfiler) addTransactionProfile(operation string, duration time.Duration, retries int, err error) {
+	p.profiler.AddProfile(&keyvaluestore.Profile{
+		Operation: operation,
+		Duration:  duration,
+		Err:       err,
+		Retries:   retries,
+	})
+}
+
+func (p *unifiedProfiler) addConflictProfile(operation string, err error) {
+	if !keyvaluestore.ShouldProfile(p.profiler) {
+		return
+	}
+	p.profiler.AddProfile(&keyvaluestore.Profile{
+		Operation: operation,
+		Err:       err,
+		Conflicts: 1,
+	})
+}
+
 type ProfilingDatabase struct {
 	Database Database
 	Profiler Profiler
 }
 
+func (db *ProfilingDatabase) addProfile(operation string, duration time.Duration, retries int, err error) {
+	if p, ok := db.Profiler.(*unifiedProfiler); ok && !keyvaluestore.ShouldProfile(p.profiler) {
+		return
+	}
+	if p, ok := db.Profiler.(transactionProfiler); ok {
+		p.addTransactionProfile(operation, duration, retries, err)
+	} else {
+		db.Profiler.AddFoundationDBTransactionProfile(duration)
+	}
+}
+
+// Transact profiles the transaction. The bindings retry transactions by invoking f again, so the
+// number of retries is the number of additional invocations.
 func (db *ProfilingDatabase) Transact(f func(fdb.Transaction) (interface{}, error)) (interface{}, error) {
 	startTime := time.Now()
-	v, err := db.Database.Transact(f)
-	db.Profiler.AddFoundationDBTransactionProfile(time.Since(startTime))
+	attempts := 0
+	v, err := db.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+		attempts++
+		return f(tx)
+	})
+	db.addProfile("Transact", time.Since(startTime), retriesForAttempts(attempts), err)
 	return v, err
 }
 
 func (db *ProfilingDatabase) ReadTransact(f func(fdb.ReadTransaction) (interface{}, error)) (interface{}, error) {
 	startTime := time.Now()
-	v, err := db.Database.ReadTransact(f)
-	db.Profiler.AddFoundationDBTransactionProfile(time.Since(startTime))
+	attempts := 0
+	v, err := db.Database.ReadTransact(func(tx fdb.ReadTransaction) (interface{}, error) {
+		attempts++
+		return f(tx)
+	})
+	db.addProfile("ReadTransact", time.Since(startTime), retriesForAttempts(attempts), err)
 	return v, err
 }
+
+func retriesForAttempts(attempts int) int {
+	if attempts > 1 {
+		return attempts - 1
+	}
+	return 0
+}
+
+// profileConflict reports an AtomicWriteConflictError to the backend's profiler, if it has one.
+func (b *Backend) profileConflict(operation string, err error) {
+	if db, ok := b.Database.(*ProfilingDatabase); ok {
+		if p, ok := db.Profiler.(transactionProfiler); ok {
+			p.addConflictProfile(operation, err)
+		}
+	}
+}
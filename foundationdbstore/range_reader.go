@@ -0,0 +1,182 @@
+package foundationdbstore
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+// rangeFuture is implemented by fdb.RangeResult and by the reads of a rangeReader.
+type rangeFuture interface {
+	GetSliceWithError() ([]fdb.KeyValue, error)
+}
+
+// maxRangeReadGroupSize is the maximum number of reads combined into a single range read.
+const maxRangeReadGroupSize = 100
+
+// rangeReadOverscan determines how many key-value pairs a combined range read may return per read
+// it replaces. Anything stored between the requested ranges counts towards the limit, so this
+// bounds the amount of unrelated data read when the ranges aren't contiguous.
+const rangeReadOverscan = 2
+
+// rangeReader performs the reads of a batch. If grouping is disabled, each read is started
+// immediately. Otherwise reads are deferred until start is invoked, at which point reads of
+// neighboring ranges are combined into fewer, larger range reads. This reduces the number of
+// futures considerably when the keys are contiguous, e.g. for bulk loads of sequential ids.
+type rangeReader struct {
+	tx    fdb.ReadTransaction
+	group bool
+	reads map[string]*rangeRead
+}
+
+func newRangeReader(tx fdb.ReadTransaction, group bool) *rangeReader {
+	return &rangeReader{
+		tx:    tx,
+		group: group,
+		reads: map[string]*rangeRead{},
+	}
+}
+
+// rangeRead is a read of every key-value pair in [begin, end).
+type rangeRead struct {
+	begin fdb.Key
+	end   fdb.Key
+
+	// group is the combined read that includes this read, if any.
+	group *rangeReadGroup
+
+	// If covered is true, kvs holds the result. Otherwise future is used.
+	covered bool
+	kvs     []fdb.KeyValue
+	future  fdb.RangeResult
+}
+
+// read adds a read of [begin, end) to the reader. The ranges of the backend's values never
+// partially overlap, so reads of the same range are deduplicated based on where they begin.
+func (r *rangeReader) read(begin, end fdb.Key) *rangeRead {
+	if !r.group {
+		return &rangeRead{
+			begin:  begin,
+			end:    end,
+			future: r.getRange(begin, end, 0),
+		}
+	}
+	if read, ok := r.reads[string(begin)]; ok {
+		return read
+	}
+	read := &rangeRead{
+		begin: begin,
+		end:   end,
+	}
+	r.reads[string(begin)] = read
+	return read
+}
+
+func (r *rangeReader) getRange(begin, end fdb.Key, limit int) fdb.RangeResult {
+	return r.tx.GetRange(fdb.KeyRange{
+		Begin: begin,
+		End:   end,
+	}, fdb.RangeOptions{
+		Limit: limit,
+		Mode:  fdb.StreamingModeWantAll,
+	})
+}
+
+// start begins the reads that have been added. It doesn't block.
+func (r *rangeReader) start() {
+	reads := make([]*rangeRead, 0, len(r.reads))
+	for _, read := range r.reads {
+		reads = append(reads, read)
+	}
+	sort.Slice(reads, func(i, j int) bool {
+		return bytes.Compare(reads[i].begin, reads[j].begin) < 0
+	})
+
+	for len(reads) > 0 {
+		n := len(reads)
+		if n > maxRangeReadGroupSize {
+			n = maxRangeReadGroupSize
+		}
+		group := reads[:n]
+		reads = reads[n:]
+
+		if len(group) == 1 {
+			group[0].future = r.getRange(group[0].begin, group[0].end, 0)
+			continue
+		}
+
+		g := &rangeReadGroup{
+			reader: r,
+			reads:  group,
+			limit:  len(group) * rangeReadOverscan,
+		}
+		g.future = r.getRange(group[0].begin, group[len(group)-1].end, g.limit)
+		for _, read := range group {
+			read.group = g
+		}
+	}
+}
+
+func (r *rangeRead) GetSliceWithError() ([]fdb.KeyValue, error) {
+	if r.group != nil {
+		if err := r.group.resolve(); err != nil {
+			return nil, err
+		} else if r.covered {
+			return r.kvs, nil
+		}
+	}
+	return r.future.GetSliceWithError()
+}
+
+// rangeReadGroup is a single range read spanning several sorted, non-overlapping reads.
+type rangeReadGroup struct {
+	reader *rangeReader
+	reads  []*rangeRead
+	limit  int
+	future fdb.RangeResult
+
+	resolved bool
+	err      error
+}
+
+// resolve waits for the combined read and distributes its results. If the limit was reached, reads
+// that may not have been read in their entirety are started individually.
+func (g *rangeReadGroup) resolve() error {
+	if g.resolved {
+		return g.err
+	}
+	g.resolved = true
+
+	kvs, err := g.future.GetSliceWithError()
+	if err != nil {
+		g.err = err
+		return err
+	}
+
+	// If the limit was reached, only ranges that end at or before the key immediately following the
+	// last key read are complete.
+	var completeEnd fdb.Key
+	if len(kvs) >= g.limit {
+		completeEnd = append(append(fdb.Key{}, kvs[len(kvs)-1].Key...), 0)
+	}
+
+	i := 0
+	for _, read := range g.reads {
+		for i < len(kvs) && bytes.Compare(kvs[i].Key, read.begin) < 0 {
+			i++
+		}
+		j := i
+		for j < len(kvs) && bytes.Compare(kvs[j].Key, read.end) < 0 {
+			j++
+		}
+		if completeEnd == nil || bytes.Compare(read.end, completeEnd) <= 0 {
+			read.covered = true
+			read.kvs = kvs[i:j]
+		} else {
+			read.future = g.reader.getRange(read.begin, read.end, 0)
+		}
+		i = j
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package foundationdbstore
+
+import (
+	"fmt"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+var _ keyvaluestore.Renamer = &Backend{}
+
+// keyRange covers everything stored under the key: its value and chunks as well as any sorted set
+// members and counters.
+func (b *Backend) keyRange(key string) fdb.KeyRange {
+	_, end := b.Subspace.Sub(key).FDBRangeKeys()
+	return fdb.KeyRange{
+		Begin: b.key(key),
+		End:   end,
+	}
+}
+
+// FoundationDB doesn't allow transactions to write more than this many bytes.
+const maxTransactionSize = 10000000
+
+// RenameCollection copies the source's key range to the destination and clears it in a single
+// transaction, so it's atomic. The copied keys and values may total at most the transaction size
+// limit, which is TransactionOptions.SizeLimit if it's given and 10MB otherwise. Larger collections
+// fail with a *TransactionTooLargeError before anything is written. So do collections that can't be
+// read within FoundationDB's five second transaction lifetime, once the transaction's retries are
+// exhausted.
+func (b *Backend) RenameCollection(src, dst string) (bool, error) {
+	if src == dst {
+		return false, fmt.Errorf("unable to rename %v to itself", src)
+	}
+	limit := b.TransactionOptions.SizeLimit
+	if limit == 0 || limit > maxTransactionSize {
+		limit = maxTransactionSize
+	}
+	didRename, err := b.transact(func(tx fdb.Transaction) (interface{}, error) {
+		it := tx.GetRange(b.keyRange(src), fdb.RangeOptions{
+			Mode: fdb.StreamingModeWantAll,
+		}).Iterator()
+		var kvs []fdb.KeyValue
+		size := 0
+		for it.Advance() {
+			kv, err := it.Get()
+			if err != nil {
+				return false, err
+			}
+			// The key is rewritten with the destination's name in place of the source's.
+			if size += len(kv.Key) - len(src) + len(dst) + len(kv.Value); size > limit {
+				return false, &TransactionTooLargeError{
+					Err: fmt.Errorf("%v exceeds the %v byte size limit", src, limit),
+				}
+			}
+			kvs = append(kvs, kv)
+		}
+		if len(kvs) == 0 {
+			return false, nil
+		}
+		tx.ClearRange(b.keyRange(dst))
+		for _, kv := range kvs {
+			t, err := b.Subspace.Unpack(kv.Key)
+			if err != nil {
+				return false, err
+			}
+			t[0] = dst
+			tx.Set(b.Subspace.Pack(t), kv.Value)
+		}
+		tx.ClearRange(b.keyRange(src))
+		return true, nil
+	})
+	if fdbErr, ok := err.(fdb.Error); ok && fdbErr.Code == 1007 { // transaction_too_old
+		return false, &TransactionTooLargeError{
+			Err: fdbErr,
+		}
+	} else if err != nil {
+		return false, err
+	}
+	return didRename.(bool), nil
+}
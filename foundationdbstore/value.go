@@ -0,0 +1,109 @@
+package foundationdbstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// FoundationDB doesn't allow values larger than 100KB. Anything larger is split into chunks which
+// are stored under consecutive keys following the value's key. In that case the value's key holds
+// a header containing the total length instead of the value itself. The header also contains a
+// random nonce so that watches on the key fire even if the new value has the same length.
+const maxValueSize = 100000
+
+const valueChunkTag = "b"
+
+func (b *Backend) valueChunkKey(key string, i int) fdb.Key {
+	return b.Subspace.Pack(tuple.Tuple{key, valueChunkTag, i})
+}
+
+func (b *Backend) valueChunkRange(key string) fdb.ExactRange {
+	return b.Subspace.Sub(key, valueChunkTag)
+}
+
+// valueRange covers the value's key and all of its chunks, but nothing else stored under the key.
+func (b *Backend) valueRange(key string) fdb.KeyRange {
+	_, end := b.valueChunkRange(key).FDBRangeKeys()
+	return fdb.KeyRange{
+		Begin: b.key(key),
+		End:   end,
+	}
+}
+
+// setValue writes a value of any size, replacing any previous chunks.
+func (b *Backend) setValue(tx fdb.Transaction, key string, v []byte) {
+	tx.ClearRange(b.valueChunkRange(key))
+	if len(v) <= maxValueSize {
+		tx.Set(b.key(key), v)
+		return
+	}
+	var header [16]byte
+	binary.BigEndian.PutUint64(header[:], uint64(len(v)))
+	binary.BigEndian.PutUint64(header[8:], rand.Uint64())
+	tx.Set(b.key(key), header[:])
+	for i := 0; len(v) > 0; i++ {
+		n := len(v)
+		if n > maxValueSize {
+			n = maxValueSize
+		}
+		tx.Set(b.valueChunkKey(key, i), v[:n])
+		v = v[n:]
+	}
+}
+
+func (b *Backend) clearValue(tx fdb.Transaction, key string) {
+	tx.Clear(b.key(key))
+	tx.ClearRange(b.valueChunkRange(key))
+}
+
+type futureValue struct {
+	key   fdb.Key
+	chunk rangeFuture
+}
+
+// getValue begins reading a value and its chunks, if any. It doesn't block.
+func (b *Backend) getValue(tx fdb.ReadTransaction, key string) futureValue {
+	return futureValue{
+		key: b.key(key),
+		chunk: tx.GetRange(b.valueRange(key), fdb.RangeOptions{
+			Mode: fdb.StreamingModeWantAll,
+		}),
+	}
+}
+
+// readValue is like getValue, but adds the read to a batch's reader.
+func (b *Backend) readValue(r *rangeReader, key string) futureValue {
+	_, end := b.valueChunkRange(key).FDBRangeKeys()
+	return futureValue{
+		key:   b.key(key),
+		chunk: r.read(b.key(key), end.FDBKey()),
+	}
+}
+
+// Get waits for the read to complete and reassembles the value. It returns nil if the value
+// doesn't exist.
+func (f futureValue) Get() ([]byte, error) {
+	kvs, err := f.chunk.GetSliceWithError()
+	if err != nil || len(kvs) == 0 || !bytes.Equal(kvs[0].Key, f.key) {
+		return nil, err
+	} else if len(kvs) == 1 {
+		return kvs[0].Value, nil
+	}
+	header := kvs[0].Value
+	if len(header) != 16 {
+		return nil, fmt.Errorf("unable to decode chunked value header")
+	}
+	ret := make([]byte, 0, binary.BigEndian.Uint64(header[:8]))
+	for _, kv := range kvs[1:] {
+		ret = append(ret, kv.Value...)
+	}
+	if uint64(len(ret)) != binary.BigEndian.Uint64(header[:8]) {
+		return nil, fmt.Errorf("chunked value is incomplete")
+	}
+	return ret, nil
+}
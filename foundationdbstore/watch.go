@@ -0,0 +1,95 @@
+package foundationdbstore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+var _ keyvaluestore.ObservableBackend = (*Backend)(nil)
+
+// watchRetryDelay is how long Watch waits before re-creating a watch that failed.
+const watchRetryDelay = time.Second
+
+// Watch notifies the returned channel whenever the value at the given key changes, including
+// changes made by other processes. This works for plain values, hashes, and sets, but not sorted
+// sets.
+//
+// Notifications are coalesced: if several changes happen before the receiver gets around to
+// reading from the channel, it'll only be notified once. Notifications may also be spurious, e.g.
+// if the underlying FoundationDB watch fails and needs to be re-created.
+//
+// The returned function stops the watch and closes the channel. It must be called once the watch
+// is no longer needed, as FoundationDB limits the number of outstanding watches.
+func (b *Backend) Watch(key string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	done := make(chan struct{})
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+
+	notify := func() {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+
+	go func() {
+		defer close(ch)
+		for {
+			err := b.watch(key, done)
+			select {
+			case <-done:
+				return
+			default:
+			}
+			notify()
+			if err != nil {
+				select {
+				case <-done:
+					return
+				case <-time.After(watchRetryDelay):
+				}
+			}
+		}
+	}()
+
+	return ch, cancel
+}
+
+// watch blocks until the key changes or done is closed.
+func (b *Backend) watch(key string, done <-chan struct{}) error {
+	r, err := b.Database.Transact(func(tx fdb.Transaction) (interface{}, error) {
+		return tx.Watch(b.key(key)), nil
+	})
+	if err != nil {
+		return err
+	}
+	w := r.(fdb.FutureNil)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- w.Get()
+	}()
+
+	select {
+	case <-done:
+		w.Cancel()
+		return nil
+	case err := <-result:
+		return err
+	}
+}
+
+// WatchPrefix isn't supported since FoundationDB can only watch individual keys.
+func (b *Backend) WatchPrefix(prefix string) (<-chan string, func(), error) {
+	return nil, nil, fmt.Errorf("foundationdb can't watch prefixes: %w", keyvaluestore.ErrNotSupported)
+}
@@ -3,12 +3,14 @@ module github.com/ccbrown/keyvaluestore
 require (
 	github.com/apple/foundationdb/bindings/go v0.0.0-20210223001042-2ca173c4b9c5
 	github.com/aws/aws-sdk-go v1.29.17
-	github.com/ccbrown/go-immutable v0.0.0-20171011001311-e9015daa17c4
 	github.com/go-redis/redis v6.15.3+incompatible
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.4.0
 	golang.org/x/sync v0.0.0-20190227155943-e225da77a7e6
+	golang.org/x/sys v0.10.0 // indirect
+	golang.org/x/term v0.0.0-20201210144234-2321bbc49cbf
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+	google.golang.org/protobuf v1.27.1
 )
 
 go 1.13
@@ -0,0 +1,64 @@
+// Package sortkey implements the encoding that backends use to sort sorted set members by score.
+// For example, DynamoDB's "rk2" attribute is a score's sort key followed by the member's field.
+//
+// Scores are encoded as 8 bytes whose lexicographical order is the same as the numeric order of the
+// scores: the sign bit is flipped for positive numbers, and every bit is flipped for negative
+// numbers.
+package sortkey
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// FloatSize is the size of an encoded score.
+const FloatSize = 8
+
+func floatBits(f float64) uint64 {
+	n := math.Float64bits(f)
+	if (n & (1 << 63)) != 0 {
+		n ^= 0xffffffffffffffff
+	} else {
+		n ^= 0x8000000000000000
+	}
+	return n
+}
+
+// Float returns the sort key for the given score.
+func Float(f float64) string {
+	buf := make([]byte, FloatSize)
+	PutFloat(buf, f)
+	return string(buf)
+}
+
+// PutFloat writes the sort key for the given score to the first FloatSize bytes of buf.
+func PutFloat(buf []byte, f float64) {
+	binary.BigEndian.PutUint64(buf, floatBits(f))
+}
+
+// ParseFloat returns the score encoded at the beginning of the given key. Any bytes after the
+// first FloatSize are ignored. If the key is too short, it returns 0.
+func ParseFloat(key string) float64 {
+	if len(key) < FloatSize {
+		return 0
+	}
+	n := binary.BigEndian.Uint64([]byte(key))
+	if (n & (1 << 63)) == 0 {
+		n ^= 0xffffffffffffffff
+	} else {
+		n ^= 0x8000000000000000
+	}
+	return math.Float64frombits(n)
+}
+
+// FloatAfter returns the smallest sort key that's greater than the sort keys of the given score
+// and everything that follows them, or an empty string if there isn't one.
+func FloatAfter(f float64) string {
+	n := floatBits(f) + 1
+	if n == 0 {
+		return ""
+	}
+	buf := make([]byte, FloatSize)
+	binary.BigEndian.PutUint64(buf, n)
+	return string(buf)
+}
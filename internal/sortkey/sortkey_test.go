@@ -0,0 +1,30 @@
+package sortkey
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFloat(t *testing.T) {
+	scores := []float64{math.Inf(-1), -math.MaxFloat64, -1.5, -math.SmallestNonzeroFloat64, 0, math.SmallestNonzeroFloat64, 1, 1.5, math.MaxFloat64, math.Inf(1)}
+
+	keys := make([]string, len(scores))
+	for i, score := range scores {
+		keys[i] = Float(score)
+		assert.Len(t, keys[i], FloatSize)
+		assert.Equal(t, score, ParseFloat(keys[i]+"field"))
+	}
+	assert.True(t, sort.StringsAreSorted(keys))
+
+	for i, score := range scores[:len(scores)-1] {
+		after := FloatAfter(score)
+		assert.True(t, after > keys[i]+"\xff\xff\xff")
+		assert.True(t, after <= keys[i+1])
+	}
+	assert.Equal(t, "", FloatAfter(math.Float64frombits(0x7fffffffffffffff)))
+
+	assert.Equal(t, 0.0, ParseFloat("short"))
+}
@@ -0,0 +1,23 @@
+package keyvaluestore
+
+import "encoding"
+
+// GetInto gets the key and unmarshals its value into dst. This is the counterpart to setting a
+// value that implements encoding.BinaryMarshaler. If the key doesn't exist, false is returned and
+// dst is left untouched. Errors returned by dst are returned as-is.
+func GetInto(b Backend, key string, dst encoding.BinaryUnmarshaler) (bool, error) {
+	v, err := b.Get(key)
+	if err != nil || v == nil {
+		return false, err
+	}
+	return true, dst.UnmarshalBinary([]byte(*v))
+}
+
+// HGetInto is like GetInto, but for hash fields.
+func HGetInto(b Backend, key, field string, dst encoding.BinaryUnmarshaler) (bool, error) {
+	v, err := b.HGet(key, field)
+	if err != nil || v == nil {
+		return false, err
+	}
+	return true, dst.UnmarshalBinary([]byte(*v))
+}
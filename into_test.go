@@ -0,0 +1,43 @@
+package keyvaluestore_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestGetInto(t *testing.T) {
+	b := memorystore.NewBackend()
+	now := time.Now().Round(0)
+	require.NoError(t, b.Set("time", now))
+	require.NoError(t, b.HSet("hash", "time", now))
+	require.NoError(t, b.Set("invalid", "foo"))
+
+	var v time.Time
+	ok, err := keyvaluestore.GetInto(b, "time", &v)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, now.Equal(v))
+
+	v = time.Time{}
+	ok, err = keyvaluestore.HGetInto(b, "hash", "time", &v)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, now.Equal(v))
+
+	ok, err = keyvaluestore.GetInto(b, "missing", &v)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = keyvaluestore.HGetInto(b, "hash", "missing", &v)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = keyvaluestore.GetInto(b, "invalid", &v)
+	assert.Error(t, err)
+}
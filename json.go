@@ -0,0 +1,38 @@
+package keyvaluestore
+
+// JSONError happens when a value can't be marshaled or unmarshaled by SetJSON or GetJSON. Errors
+// returned by the backend itself are passed through unwrapped.
+type JSONError struct {
+	Key string
+	Err error
+}
+
+func (e *JSONError) Error() string {
+	return "json error for key " + e.Key + ": " + e.Err.Error()
+}
+
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// SetJSON marshals v as JSON and sets the key to the result.
+func SetJSON(b Backend, key string, v interface{}) error {
+	buf, err := JSONSerializer.Marshal(v)
+	if err != nil {
+		return &JSONError{Key: key, Err: err}
+	}
+	return b.Set(key, buf)
+}
+
+// GetJSON gets the key and unmarshals its value into v. If the key doesn't exist, false is returned
+// and v is left untouched.
+func GetJSON(b Backend, key string, v interface{}) (bool, error) {
+	s, err := b.Get(key)
+	if err != nil || s == nil {
+		return false, err
+	}
+	if err := JSONSerializer.Unmarshal([]byte(*s), v); err != nil {
+		return false, &JSONError{Key: key, Err: err}
+	}
+	return true, nil
+}
@@ -0,0 +1,49 @@
+package keyvaluestore_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestJSON(t *testing.T) {
+	type object struct {
+		Name  string
+		Count int
+	}
+
+	b := memorystore.NewBackend()
+	require.NoError(t, keyvaluestore.SetJSON(b, "foo", object{Name: "foo", Count: 2}))
+
+	var v object
+	ok, err := keyvaluestore.GetJSON(b, "foo", &v)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, object{Name: "foo", Count: 2}, v)
+
+	t.Run("Missing", func(t *testing.T) {
+		v := object{Name: "unchanged"}
+		ok, err := keyvaluestore.GetJSON(b, "missing", &v)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, "unchanged", v.Name)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		require.NoError(t, b.Set("invalid", "{"))
+		ok, err := keyvaluestore.GetJSON(b, "invalid", &v)
+		assert.False(t, ok)
+		var jsonErr *keyvaluestore.JSONError
+		require.True(t, errors.As(err, &jsonErr))
+		assert.Equal(t, "invalid", jsonErr.Key)
+
+		err = keyvaluestore.SetJSON(b, "foo", func() {})
+		require.True(t, errors.As(err, &jsonErr))
+		assert.Equal(t, "foo", jsonErr.Key)
+	})
+}
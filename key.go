@@ -0,0 +1,85 @@
+package keyvaluestore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeySeparator separates the components of keys built with Key.
+const KeySeparator = ":"
+
+// Key builds keys out of multiple components, such as a type name and an id. Components are
+// escaped so that distinct keys never collide, even if the components contain the separator:
+//
+//	keyvaluestore.Key{"user", id}.String()
+//
+// The empty key and a key with a single empty component are both encoded as the empty string.
+type Key []string
+
+// Join returns a new key with the given components appended.
+func (k Key) Join(components ...string) Key {
+	ret := make(Key, 0, len(k)+len(components))
+	return append(append(ret, k...), components...)
+}
+
+// WithPrefix returns a new key with the given components prepended.
+func (k Key) WithPrefix(components ...string) Key {
+	ret := make(Key, 0, len(k)+len(components))
+	return append(append(ret, components...), k...)
+}
+
+// String returns the escaped and joined components, suitable for passing to a backend.
+func (k Key) String() string {
+	escaped := make([]string, len(k))
+	for i, component := range k {
+		escaped[i] = EscapeKeyComponent(component)
+	}
+	return strings.Join(escaped, KeySeparator)
+}
+
+var keyComponentEscaper = strings.NewReplacer("%", "%25", KeySeparator, "%3A")
+
+// EscapeKeyComponent escapes the separator and escape characters within a key component.
+func EscapeKeyComponent(s string) string {
+	return keyComponentEscaper.Replace(s)
+}
+
+// ParseKey splits a key built with Key back into its components.
+func ParseKey(s string) (Key, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, KeySeparator)
+	ret := make(Key, len(parts))
+	for i, part := range parts {
+		component, err := unescapeKeyComponent(part)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = component
+	}
+	return ret, nil
+}
+
+func unescapeKeyComponent(s string) (string, error) {
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch {
+		case strings.HasPrefix(s[i:], "%25"):
+			b.WriteByte('%')
+		case strings.HasPrefix(s[i:], "%3A"):
+			b.WriteString(KeySeparator)
+		default:
+			return "", fmt.Errorf("invalid escape sequence in key component: %q", s)
+		}
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,51 @@
+package keyvaluestore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, "user:123", Key{"user", "123"}.String())
+	assert.Equal(t, "user:a%3Ab:c", Key{"user", "a:b", "c"}.String())
+	assert.Equal(t, "100%25", Key{"100%"}.String())
+
+	// Components containing the separator must not collide with additional components.
+	assert.NotEqual(t, Key{"a:b", "c"}.String(), Key{"a", "b:c"}.String())
+
+	user := Key{"user", "123"}
+	assert.Equal(t, Key{"user", "123", "friends"}, user.Join("friends"))
+	assert.Equal(t, Key{"app", "user", "123"}, user.WithPrefix("app"))
+	assert.Equal(t, Key{"user", "123"}, user, "the original key should be unmodified")
+
+	// Joining must not alias the original's backing array.
+	base := make(Key, 1, 4)
+	base[0] = "base"
+	a := base.Join("a")
+	b := base.Join("b")
+	assert.Equal(t, Key{"base", "a"}, a)
+	assert.Equal(t, Key{"base", "b"}, b)
+}
+
+func TestParseKey(t *testing.T) {
+	for _, k := range []Key{
+		{"user", "123"},
+		{"a:b", "c%3A", ""},
+		{"%", ":", "%25"},
+	} {
+		parsed, err := ParseKey(k.String())
+		require.NoError(t, err)
+		assert.Equal(t, k, parsed)
+	}
+
+	k, err := ParseKey("")
+	require.NoError(t, err)
+	assert.Empty(t, k)
+
+	_, err = ParseKey("a%2")
+	assert.Error(t, err)
+	_, err = ParseKey("a%zz")
+	assert.Error(t, err)
+}
@@ -5,6 +5,19 @@ import (
 	"strconv"
 )
 
+// ToString converts a value to the string that backends store for it. The following types are
+// supported, and every backend stores them using the same canonical encodings:
+//
+//   - string and []byte are stored as-is.
+//   - int, int64, uint, and uint64 are stored in base 10.
+//   - float64 is stored in the shortest decimal representation that parses back to the same value,
+//     without an exponent (e.g. "0.5" or "1000000").
+//   - bool is stored as "1" or "0".
+//   - encoding.BinaryMarshaler is stored as the result of MarshalBinary. This includes time.Time.
+//   - encoding.TextMarshaler is stored as the result of MarshalText, unless the value also
+//     implements encoding.BinaryMarshaler.
+//
+// If the value isn't supported or can't be marshaled, nil is returned.
 func ToString(v interface{}) *string {
 	switch v := v.(type) {
 	case int:
@@ -13,6 +26,21 @@ func ToString(v interface{}) *string {
 	case int64:
 		s := strconv.FormatInt(v, 10)
 		return &s
+	case uint:
+		s := strconv.FormatUint(uint64(v), 10)
+		return &s
+	case uint64:
+		s := strconv.FormatUint(v, 10)
+		return &s
+	case float64:
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		return &s
+	case bool:
+		s := "0"
+		if v {
+			s = "1"
+		}
+		return &s
 	case string:
 		return &v
 	case []byte:
@@ -22,6 +50,10 @@ func ToString(v interface{}) *string {
 		if b, err := v.MarshalBinary(); err == nil {
 			return ToString(b)
 		}
+	case encoding.TextMarshaler:
+		if b, err := v.MarshalText(); err == nil {
+			return ToString(b)
+		}
 	}
 	return nil
 }
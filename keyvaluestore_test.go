@@ -0,0 +1,43 @@
+package keyvaluestore
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToString(t *testing.T) {
+	now := time.Now()
+	nowBinary, err := now.MarshalBinary()
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		Value    interface{}
+		Expected string
+	}{
+		{"foo", "foo"},
+		{[]byte("foo"), "foo"},
+		{-1, "-1"},
+		{int64(math.MinInt64), "-9223372036854775808"},
+		{uint(1), "1"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{0.5, "0.5"},
+		{1e6, "1000000"},
+		{-2.25, "-2.25"},
+		{true, "1"},
+		{false, "0"},
+		{now, string(nowBinary)},
+		{net.ParseIP("127.0.0.1"), "127.0.0.1"},
+	} {
+		s := ToString(tc.Value)
+		if assert.NotNil(t, s, "%T", tc.Value) {
+			assert.Equal(t, tc.Expected, *s, "%T", tc.Value)
+		}
+	}
+
+	assert.Nil(t, ToString(struct{}{}))
+}
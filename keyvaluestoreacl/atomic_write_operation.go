@@ -0,0 +1,135 @@
+package keyvaluestoreacl
+
+import "github.com/ccbrown/keyvaluestore"
+
+type atomicWriteOperation struct {
+	backend     *Backend
+	atomicWrite keyvaluestore.AtomicWriteOperation
+	err         error
+}
+
+// check records the first operation that isn't permitted. Exec fails if there is one.
+func (op *atomicWriteOperation) check(name string, required Permission, key string) {
+	if op.err == nil {
+		op.err = op.backend.check(name, required, key)
+	}
+}
+
+func (op *atomicWriteOperation) Set(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	op.check("Set", PermissionReadWrite, key)
+	return op.atomicWrite.Set(key, value)
+}
+
+func (op *atomicWriteOperation) SetNX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	op.check("SetNX", PermissionReadWrite, key)
+	return op.atomicWrite.SetNX(key, value)
+}
+
+func (op *atomicWriteOperation) SetXX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	op.check("SetXX", PermissionReadWrite, key)
+	return op.atomicWrite.SetXX(key, value)
+}
+
+func (op *atomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
+	op.check("SetEQ", PermissionReadWrite, key)
+	return op.atomicWrite.SetEQ(key, value, oldValue)
+}
+
+func (op *atomicWriteOperation) Delete(key string) keyvaluestore.AtomicWriteResult {
+	op.check("Delete", PermissionReadWrite, key)
+	return op.atomicWrite.Delete(key)
+}
+
+func (op *atomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteResult {
+	op.check("DeleteXX", PermissionReadWrite, key)
+	return op.atomicWrite.DeleteXX(key)
+}
+
+func (op *atomicWriteOperation) NIncrBy(key string, n int64) keyvaluestore.AtomicWriteResult {
+	op.check("NIncrBy", PermissionReadWrite, key)
+	return op.atomicWrite.NIncrBy(key, n)
+}
+
+func (op *atomicWriteOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	op.check("ZAdd", PermissionReadWrite, key)
+	return op.atomicWrite.ZAdd(key, member, score)
+}
+
+func (op *atomicWriteOperation) ZHAdd(key, field string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	op.check("ZHAdd", PermissionReadWrite, key)
+	return op.atomicWrite.ZHAdd(key, field, member, score)
+}
+
+func (op *atomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	op.check("ZHMAdd", PermissionReadWrite, key)
+	return op.atomicWrite.ZHMAdd(key, entries)
+}
+
+func (op *atomicWriteOperation) ZAddNX(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	op.check("ZAddNX", PermissionReadWrite, key)
+	return op.atomicWrite.ZAddNX(key, member, score)
+}
+
+func (op *atomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	op.check("ZHSetEQ", PermissionReadWrite, key)
+	return op.atomicWrite.ZHSetEQ(key, field, member, oldMember, score)
+}
+
+func (op *atomicWriteOperation) ZRem(key string, member interface{}) keyvaluestore.AtomicWriteResult {
+	op.check("ZRem", PermissionReadWrite, key)
+	return op.atomicWrite.ZRem(key, member)
+}
+
+func (op *atomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWriteResult {
+	op.check("ZHRem", PermissionReadWrite, key)
+	return op.atomicWrite.ZHRem(key, field)
+}
+
+func (op *atomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	op.check("ZHRemEQ", PermissionReadWrite, key)
+	return op.atomicWrite.ZHRemEQ(key, field, member)
+}
+
+func (op *atomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	op.check("SAdd", PermissionReadWrite, key)
+	return op.atomicWrite.SAdd(key, member, members...)
+}
+
+func (op *atomicWriteOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	op.check("SRem", PermissionReadWrite, key)
+	return op.atomicWrite.SRem(key, member, members...)
+}
+
+func (op *atomicWriteOperation) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) keyvaluestore.AtomicWriteResult {
+	op.check("HSet", PermissionReadWrite, key)
+	return op.atomicWrite.HSet(key, field, value, fields...)
+}
+
+func (op *atomicWriteOperation) HSetNX(key, field string, value interface{}) keyvaluestore.AtomicWriteResult {
+	op.check("HSetNX", PermissionReadWrite, key)
+	return op.atomicWrite.HSetNX(key, field, value)
+}
+
+func (op *atomicWriteOperation) HDel(key, field string, fields ...string) keyvaluestore.AtomicWriteResult {
+	op.check("HDel", PermissionReadWrite, key)
+	return op.atomicWrite.HDel(key, field, fields...)
+}
+
+func (op *atomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.atomicWrite.WithIdempotencyToken(token)
+	return op
+}
+
+func (op *atomicWriteOperation) Validate() error {
+	if op.err != nil {
+		return op.err
+	}
+	return op.atomicWrite.Validate()
+}
+
+func (op *atomicWriteOperation) Exec() (bool, error) {
+	if op.err != nil {
+		return false, op.err
+	}
+	return op.atomicWrite.Exec()
+}
@@ -0,0 +1,430 @@
+package keyvaluestoreacl
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Rule grants a permission to keys beginning with a prefix.
+type Rule struct {
+	Prefix     string
+	Permission Permission
+}
+
+// Backend restricts access to an underlying backend according to per-prefix rules. It can be
+// given to semi-trusted plugins or jobs to provide them with a restricted view of a shared backend.
+//
+// Each key is governed by the rule with the longest matching prefix. Keys that don't match any
+// rule are denied, so a rule with an empty prefix can be used to grant a default permission.
+// Operations that aren't permitted fail with a *ForbiddenError without reaching the underlying
+// backend. Batches and atomic writes containing operations that aren't permitted fail as a whole
+// when they're executed.
+//
+// Backend doesn't implement keyvaluestore.Scanner, since scans aren't confined to any prefix, and
+// Unwrap returns nil so that the rules can't be bypassed.
+type Backend struct {
+	backend keyvaluestore.Backend
+
+	// rules are sorted by descending prefix length.
+	rules []Rule
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+
+// NewBackend creates a backend that enforces the given rules. If multiple rules have the same
+// prefix, the last one is used.
+func NewBackend(b keyvaluestore.Backend, rules ...Rule) *Backend {
+	byPrefix := map[string]Permission{}
+	for _, rule := range rules {
+		byPrefix[rule.Prefix] = rule.Permission
+	}
+	sorted := make([]Rule, 0, len(byPrefix))
+	for prefix, permission := range byPrefix {
+		sorted = append(sorted, Rule{
+			Prefix:     prefix,
+			Permission: permission,
+		})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+	return &Backend{
+		backend: b,
+		rules:   sorted,
+	}
+}
+
+// Permission returns the permission granted for the given key.
+func (b *Backend) Permission(key string) Permission {
+	for _, rule := range b.rules {
+		if strings.HasPrefix(key, rule.Prefix) {
+			return rule.Permission
+		}
+	}
+	return PermissionDenied
+}
+
+// check returns a *ForbiddenError if the key doesn't have the required permission.
+func (b *Backend) check(op string, required Permission, key string) error {
+	if b.Permission(key) < required {
+		return &ForbiddenError{
+			Operation: op,
+			Key:       key,
+			Required:  required,
+		}
+	}
+	return nil
+}
+
+func (b *Backend) checkKeys(op string, required Permission, keys ...string) error {
+	for _, key := range keys {
+		if err := b.check(op, required, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return &atomicWriteOperation{
+		backend:     b,
+		atomicWrite: b.backend.AtomicWrite(),
+	}
+}
+
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	return &batchOperation{
+		backend: b,
+		batch:   b.backend.Batch(),
+	}
+}
+
+func (b *Backend) Ping() error {
+	return b.backend.Ping()
+}
+
+func (b *Backend) Close() error {
+	return b.backend.Close()
+}
+
+func (b *Backend) Delete(key string) (bool, error) {
+	if err := b.check("Delete", PermissionReadWrite, key); err != nil {
+		return false, err
+	}
+	return b.backend.Delete(key)
+}
+
+func (b *Backend) Get(key string) (*string, error) {
+	if err := b.check("Get", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.Get(key)
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	if err := b.check("Set", PermissionReadWrite, key); err != nil {
+		return err
+	}
+	return b.backend.Set(key, value)
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	if err := b.check("NIncrBy", PermissionReadWrite, key); err != nil {
+		return 0, err
+	}
+	return b.backend.NIncrBy(key, n)
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	if err := b.check("SetXX", PermissionReadWrite, key); err != nil {
+		return false, err
+	}
+	return b.backend.SetXX(key, value)
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	if err := b.check("SetNX", PermissionReadWrite, key); err != nil {
+		return false, err
+	}
+	return b.backend.SetNX(key, value)
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	if err := b.check("SetEQ", PermissionReadWrite, key); err != nil {
+		return false, err
+	}
+	return b.backend.SetEQ(key, value, oldValue)
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	if err := b.check("SAdd", PermissionReadWrite, key); err != nil {
+		return err
+	}
+	return b.backend.SAdd(key, member, members...)
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	if err := b.check("SRem", PermissionReadWrite, key); err != nil {
+		return err
+	}
+	return b.backend.SRem(key, member, members...)
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	if err := b.check("HSet", PermissionReadWrite, key); err != nil {
+		return err
+	}
+	return b.backend.HSet(key, field, value, fields...)
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	if err := b.check("HDel", PermissionReadWrite, key); err != nil {
+		return err
+	}
+	return b.backend.HDel(key, field, fields...)
+}
+
+func (b *Backend) HGet(key, field string) (*string, error) {
+	if err := b.check("HGet", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.HGet(key, field)
+}
+
+func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	if err := b.check("HGetAll", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.HGetAll(key)
+}
+
+func (b *Backend) SMembers(key string) ([]string, error) {
+	if err := b.check("SMembers", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.SMembers(key)
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
+	if err := b.check("ZAdd", PermissionReadWrite, key); err != nil {
+		return err
+	}
+	return b.backend.ZAdd(key, member, score)
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	if err := b.check("ZHAdd", PermissionReadWrite, key); err != nil {
+		return err
+	}
+	return b.backend.ZHAdd(key, field, member, score)
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	if err := b.check("ZHMAdd", PermissionReadWrite, key); err != nil {
+		return err
+	}
+	return b.backend.ZHMAdd(key, entries)
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	if err := b.check("ZScore", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZScore(key, member)
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	if err := b.check("ZIncrBy", PermissionReadWrite, key); err != nil {
+		return 0, err
+	}
+	return b.backend.ZIncrBy(key, member, n)
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	if err := b.check("ZRem", PermissionReadWrite, key); err != nil {
+		return err
+	}
+	return b.backend.ZRem(key, member)
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	if err := b.check("ZHRem", PermissionReadWrite, key); err != nil {
+		return err
+	}
+	return b.backend.ZHRem(key, field)
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	if err := b.check("ZHRemEQ", PermissionReadWrite, key); err != nil {
+		return false, err
+	}
+	return b.backend.ZHRemEQ(key, field, member)
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	if err := b.check("ZCount", PermissionReadOnly, key); err != nil {
+		return 0, err
+	}
+	return b.backend.ZCount(key, min, max)
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
+	if err := b.check("ZLexCount", PermissionReadOnly, key); err != nil {
+		return 0, err
+	}
+	return b.backend.ZLexCount(key, min, max)
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	if err := b.check("ZRangeByScore", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	if err := b.check("ZHRangeByScore", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZHRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.check("ZRangeByScoreWithScores", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.check("ZHRangeByScoreWithScores", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZHRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	if err := b.check("ZRevRangeByScore", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	if err := b.check("ZHRevRangeByScore", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.check("ZRevRangeByScoreWithScores", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.check("ZHRevRangeByScoreWithScores", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZHRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	if err := b.check("ZRangeByLex", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	if err := b.check("ZHRangeByLex", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZHRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	if err := b.check("ZRevRangeByLex", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZRevRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	if err := b.check("ZHRevRangeByLex", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return b.backend.ZHRevRangeByLex(key, min, max, limit)
+}
+
+var _ keyvaluestore.SortedHashFieldRanger = &Backend{}
+
+func (b *Backend) ZHRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	if err := b.check("ZHRangeByScoreWithFields", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return keyvaluestore.ZHRangeByScoreWithFields(b.backend, key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	if err := b.check("ZHRevRangeByScoreWithFields", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return keyvaluestore.ZHRevRangeByScoreWithFields(b.backend, key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	if err := b.check("ZHRangeByLexWithFields", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return keyvaluestore.ZHRangeByLexWithFields(b.backend, key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	if err := b.check("ZHRevRangeByLexWithFields", PermissionReadOnly, key); err != nil {
+		return nil, err
+	}
+	return keyvaluestore.ZHRevRangeByLexWithFields(b.backend, key, min, max, limit)
+}
+
+var _ keyvaluestore.MultiExister = &Backend{}
+
+func (b *Backend) ExistsMulti(keys ...string) (map[string]bool, error) {
+	if err := b.checkKeys("ExistsMulti", PermissionReadOnly, keys...); err != nil {
+		return nil, err
+	}
+	return keyvaluestore.ExistsMulti(b.backend, keys...)
+}
+
+var _ keyvaluestore.MultiSortedSetRanger = &Backend{}
+
+func (b *Backend) ZRangeByScoreMulti(keys []string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.checkKeys("ZRangeByScoreMulti", PermissionReadOnly, keys...); err != nil {
+		return nil, err
+	}
+	return keyvaluestore.ZRangeByScoreMulti(b.backend, keys, min, max, limit)
+}
+
+func (b Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	b.backend = b.backend.WithProfiler(profiler)
+	return &b
+}
+
+func (b Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	b.backend = b.backend.WithEventuallyConsistentReads()
+	return &b
+}
+
+func (b Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	b.backend = keyvaluestore.WithOptions(b.backend, opts)
+	return &b
+}
+
+// Unwrap returns nil so that the underlying backend can't be used to bypass the rules.
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return nil
+}
@@ -0,0 +1,124 @@
+package keyvaluestoreacl_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreacl"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return keyvaluestoreacl.NewBackend(memorystore.NewBackend(), keyvaluestoreacl.Rule{
+			Permission: keyvaluestoreacl.PermissionReadWrite,
+		})
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return keyvaluestoreacl.NewBackend(b, keyvaluestoreacl.Rule{
+			Permission: keyvaluestoreacl.PermissionReadWrite,
+		})
+	}, keyvaluestoretest.WrapperOptions{
+		Opaque: true,
+	})
+}
+
+func assertForbidden(t *testing.T, err error) {
+	t.Helper()
+	assert.True(t, errors.Is(err, keyvaluestoreacl.ErrForbidden), "expected forbidden error, got %v", err)
+}
+
+func TestRules(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	require.NoError(t, underlying.Set("config:foo", "foo"))
+	require.NoError(t, underlying.Set("config:plugin:foo", "foo"))
+	require.NoError(t, underlying.Set("secrets:foo", "foo"))
+
+	b := keyvaluestoreacl.NewBackend(underlying,
+		keyvaluestoreacl.Rule{Prefix: "config:", Permission: keyvaluestoreacl.PermissionReadOnly},
+		keyvaluestoreacl.Rule{Prefix: "config:plugin:", Permission: keyvaluestoreacl.PermissionReadWrite},
+		keyvaluestoreacl.Rule{Prefix: "jobs:", Permission: keyvaluestoreacl.PermissionReadWrite},
+	)
+
+	assert.Equal(t, keyvaluestoreacl.PermissionReadOnly, b.Permission("config:foo"))
+	assert.Equal(t, keyvaluestoreacl.PermissionReadWrite, b.Permission("config:plugin:foo"))
+	assert.Equal(t, keyvaluestoreacl.PermissionDenied, b.Permission("secrets:foo"))
+
+	v, err := b.Get("config:foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", *v)
+	assertForbidden(t, b.Set("config:foo", "bar"))
+	_, err = b.Delete("config:foo")
+	assertForbidden(t, err)
+
+	require.NoError(t, b.Set("config:plugin:foo", "bar"))
+	require.NoError(t, b.SAdd("jobs:pending", "a"))
+
+	_, err = b.Get("secrets:foo")
+	assertForbidden(t, err)
+	var forbidden *keyvaluestoreacl.ForbiddenError
+	require.True(t, errors.As(err, &forbidden))
+	assert.Equal(t, "Get", forbidden.Operation)
+	assert.Equal(t, "secrets:foo", forbidden.Key)
+	assert.Equal(t, keyvaluestoreacl.PermissionReadOnly, forbidden.Required)
+
+	_, err = keyvaluestore.ExistsMulti(b, "config:foo", "secrets:foo")
+	assertForbidden(t, err)
+
+	assert.Nil(t, b.Unwrap())
+
+	// Restricted views stay restricted.
+	_, err = b.WithEventuallyConsistentReads().Get("secrets:foo")
+	assertForbidden(t, err)
+
+	v, err = underlying.Get("config:foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", *v)
+}
+
+func TestAtomicWriteAndBatch(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	b := keyvaluestoreacl.NewBackend(underlying,
+		keyvaluestoreacl.Rule{Prefix: "config:", Permission: keyvaluestoreacl.PermissionReadOnly},
+		keyvaluestoreacl.Rule{Prefix: "jobs:", Permission: keyvaluestoreacl.PermissionReadWrite},
+	)
+
+	tx := b.AtomicWrite()
+	tx.Set("jobs:foo", "foo")
+	tx.Set("config:foo", "foo")
+	assertForbidden(t, tx.Validate())
+	_, err := tx.Exec()
+	assertForbidden(t, err)
+
+	batch := b.Batch()
+	batch.Set("jobs:foo", "foo")
+	batch.Get("secrets:foo")
+	assertForbidden(t, batch.Exec())
+
+	// Nothing was written.
+	v, err := underlying.Get("jobs:foo")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	batch = b.Batch()
+	batch.Set("jobs:foo", "foo")
+	get := batch.Get("config:foo")
+	require.NoError(t, batch.Exec())
+	v, err = get.Result()
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	tx = b.AtomicWrite()
+	tx.Delete("jobs:foo")
+	ok, err := tx.Exec()
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,97 @@
+package keyvaluestoreacl
+
+import "github.com/ccbrown/keyvaluestore"
+
+type batchOperation struct {
+	backend *Backend
+	batch   keyvaluestore.BatchOperation
+	err     error
+}
+
+// check records the first operation that isn't permitted. Exec fails if there is one.
+func (op *batchOperation) check(name string, required Permission, key string) {
+	if op.err == nil {
+		op.err = op.backend.check(name, required, key)
+	}
+}
+
+func (op *batchOperation) Get(key string) keyvaluestore.GetResult {
+	op.check("Get", PermissionReadOnly, key)
+	return op.batch.Get(key)
+}
+
+func (op *batchOperation) Delete(key string) keyvaluestore.ErrorResult {
+	op.check("Delete", PermissionReadWrite, key)
+	return op.batch.Delete(key)
+}
+
+func (op *batchOperation) Set(key string, value interface{}) keyvaluestore.ErrorResult {
+	op.check("Set", PermissionReadWrite, key)
+	return op.batch.Set(key, value)
+}
+
+func (op *batchOperation) SMembers(key string) keyvaluestore.SMembersResult {
+	op.check("SMembers", PermissionReadOnly, key)
+	return op.batch.SMembers(key)
+}
+
+func (op *batchOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	op.check("SAdd", PermissionReadWrite, key)
+	return op.batch.SAdd(key, member, members...)
+}
+
+func (op *batchOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	op.check("SRem", PermissionReadWrite, key)
+	return op.batch.SRem(key, member, members...)
+}
+
+func (op *batchOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.ErrorResult {
+	op.check("ZAdd", PermissionReadWrite, key)
+	return op.batch.ZAdd(key, member, score)
+}
+
+func (op *batchOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.ErrorResult {
+	op.check("ZHMAdd", PermissionReadWrite, key)
+	return op.batch.ZHMAdd(key, entries)
+}
+
+func (op *batchOperation) ZRem(key string, member interface{}) keyvaluestore.ErrorResult {
+	op.check("ZRem", PermissionReadWrite, key)
+	return op.batch.ZRem(key, member)
+}
+
+func (op *batchOperation) ZScore(key string, member interface{}) keyvaluestore.ZScoreResult {
+	op.check("ZScore", PermissionReadOnly, key)
+	return op.batch.ZScore(key, member)
+}
+
+func (op *batchOperation) ZHRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	op.check("ZHRangeByScore", PermissionReadOnly, key)
+	return op.batch.ZHRangeByScore(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	op.check("ZHRevRangeByScore", PermissionReadOnly, key)
+	return op.batch.ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	op.check("ZHRangeByLex", PermissionReadOnly, key)
+	return op.batch.ZHRangeByLex(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	op.check("ZHRevRangeByLex", PermissionReadOnly, key)
+	return op.batch.ZHRevRangeByLex(key, min, max, limit)
+}
+
+func (op *batchOperation) Len() int {
+	return op.batch.Len()
+}
+
+func (op *batchOperation) Exec() error {
+	if op.err != nil {
+		return op.err
+	}
+	return op.batch.Exec()
+}
@@ -0,0 +1,52 @@
+package keyvaluestoreacl
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Permission is the level of access granted to keys.
+type Permission int
+
+const (
+	// PermissionDenied prevents keys from being read or written.
+	PermissionDenied Permission = iota
+
+	// PermissionReadOnly allows keys to be read, but not written.
+	PermissionReadOnly
+
+	// PermissionReadWrite allows keys to be read and written.
+	PermissionReadWrite
+)
+
+func (p Permission) String() string {
+	switch p {
+	case PermissionDenied:
+		return "denied"
+	case PermissionReadOnly:
+		return "read-only"
+	case PermissionReadWrite:
+		return "read-write"
+	}
+	return fmt.Sprintf("Permission(%d)", int(p))
+}
+
+// ErrForbidden is matched by every *ForbiddenError via errors.Is.
+var ErrForbidden = errors.New("forbidden")
+
+// ForbiddenError is returned when an operation isn't permitted by a Backend's rules.
+type ForbiddenError struct {
+	Operation string
+	Key       string
+
+	// Required is the permission that the operation requires.
+	Required Permission
+}
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("forbidden: %v of key %v requires %v access", e.Operation, e.Key, e.Required)
+}
+
+func (e *ForbiddenError) Is(target error) bool {
+	return target == ErrForbidden
+}
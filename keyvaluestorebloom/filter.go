@@ -0,0 +1,215 @@
+// Package keyvaluestorebloom implements Bloom filters on top of any backend.
+package keyvaluestorebloom
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// DefaultChunkSize is the chunk size used by filters that don't specify one.
+const DefaultChunkSize = 4096
+
+// Filter is a Bloom filter. MayContain never returns false for elements that have been added, but
+// may return true for elements that haven't.
+//
+// The filter's bits are split into chunks, each of which is stored as a binary string value at a
+// key derived from Key. Chunks are only created once bits in them are set. Each addition reads the
+// chunks it touches and conditionally writes the changed ones in a single atomic write, so
+// concurrent additions are never lost.
+//
+// Bits and Hashes can't be changed once elements have been added. Parameters can be used to pick
+// them.
+type Filter struct {
+	Backend keyvaluestore.Backend
+	Key     string
+
+	// Bits is the number of bits in the filter.
+	Bits uint64
+
+	// Hashes is the number of bits set per element. It can't exceed
+	// keyvaluestore.MaxAtomicWriteOperations.
+	Hashes int
+
+	// ChunkSize is the number of bytes per chunk. If zero, DefaultChunkSize is used.
+	ChunkSize int
+}
+
+// Parameters returns the number of bits and hashes needed for a filter containing n elements to
+// have the given false positive rate.
+func Parameters(n uint64, falsePositiveRate float64) (bits uint64, hashes int) {
+	bits = uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if bits == 0 {
+		bits = 1
+	}
+	hashes = int(math.Round(float64(bits) / float64(n) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	} else if hashes > keyvaluestore.MaxAtomicWriteOperations {
+		hashes = keyvaluestore.MaxAtomicWriteOperations
+	}
+	return bits, hashes
+}
+
+func (f *Filter) chunkBits() uint64 {
+	if f.ChunkSize > 0 {
+		return uint64(f.ChunkSize) * 8
+	}
+	return DefaultChunkSize * 8
+}
+
+// chunkLen returns the number of bytes in the given chunk. The last chunk may be shorter than the
+// others.
+func (f *Filter) chunkLen(chunk uint64) int {
+	chunkBits := f.chunkBits()
+	if remaining := f.Bits - chunk*chunkBits; remaining < chunkBits {
+		return int((remaining + 7) / 8)
+	}
+	return int(chunkBits / 8)
+}
+
+func (f *Filter) chunkKey(chunk uint64) string {
+	return keyvaluestore.Key{f.Key, strconv.FormatUint(chunk, 10)}.String()
+}
+
+func mix(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// bits returns the bits to set for the element, grouped by chunk.
+func (f *Filter) bits(element string) (map[uint64][]uint64, error) {
+	if f.Bits == 0 || f.Hashes < 1 || f.Hashes > keyvaluestore.MaxAtomicWriteOperations {
+		return nil, fmt.Errorf("invalid bloom filter parameters")
+	}
+
+	// The bits are derived from two hashes using double hashing.
+	h := fnv.New64a()
+	h.Write([]byte(element))
+	h1 := mix(h.Sum64())
+	h2 := mix(h1) | 1
+
+	chunkBits := f.chunkBits()
+	ret := map[uint64][]uint64{}
+	for i := 0; i < f.Hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % f.Bits
+		chunk := bit / chunkBits
+		ret[chunk] = append(ret[chunk], bit%chunkBits)
+	}
+	return ret, nil
+}
+
+// readChunks reads the given chunks. Chunks that don't exist are nil.
+func (f *Filter) readChunks(chunks []uint64) (map[uint64]*string, error) {
+	batch := f.Backend.Batch()
+	results := make([]keyvaluestore.GetResult, len(chunks))
+	for i, chunk := range chunks {
+		results[i] = batch.Get(f.chunkKey(chunk))
+	}
+	if err := batch.Exec(); err != nil {
+		return nil, err
+	}
+	ret := make(map[uint64]*string, len(chunks))
+	for i, chunk := range chunks {
+		v, err := results[i].Result()
+		if err != nil {
+			return nil, err
+		}
+		ret[chunk] = v
+	}
+	return ret, nil
+}
+
+func sortedChunks(bits map[uint64][]uint64) []uint64 {
+	ret := make([]uint64, 0, len(bits))
+	for chunk := range bits {
+		ret = append(ret, chunk)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i] < ret[j]
+	})
+	return ret
+}
+
+func isSet(chunk *string, bit uint64) bool {
+	return chunk != nil && bit/8 < uint64(len(*chunk)) && (*chunk)[bit/8]&(1<<(bit%8)) != 0
+}
+
+// Add adds the element to the filter.
+func (f *Filter) Add(element string) error {
+	bits, err := f.bits(element)
+	if err != nil {
+		return err
+	}
+	chunks := sortedChunks(bits)
+
+	for attempt := 0; attempt < keyvaluestore.MaxUpdateAttempts; attempt++ {
+		values, err := f.readChunks(chunks)
+		if err != nil {
+			return err
+		}
+
+		tx := f.Backend.AtomicWrite()
+		changed := false
+		for _, chunk := range chunks {
+			prev := values[chunk]
+			next := make([]byte, f.chunkLen(chunk))
+			if prev != nil {
+				copy(next, *prev)
+			}
+			chunkChanged := false
+			for _, bit := range bits[chunk] {
+				if !isSet(prev, bit) {
+					next[bit/8] |= 1 << (bit % 8)
+					chunkChanged = true
+				}
+			}
+			if !chunkChanged {
+				continue
+			}
+			changed = true
+			if prev == nil {
+				tx.SetNX(f.chunkKey(chunk), next)
+			} else {
+				tx.SetEQ(f.chunkKey(chunk), next, *prev)
+			}
+		}
+		if !changed {
+			return nil
+		}
+
+		if ok, err := tx.Exec(); err != nil && !keyvaluestore.IsAtomicWriteConflict(err) {
+			return err
+		} else if ok && err == nil {
+			return nil
+		}
+	}
+	return &keyvaluestore.AtomicWriteConflictError{
+		Err: fmt.Errorf("unable to update bloom filter %v after %v attempts", f.Key, keyvaluestore.MaxUpdateAttempts),
+	}
+}
+
+// MayContain returns false if the element has definitely not been added to the filter.
+func (f *Filter) MayContain(element string) (bool, error) {
+	bits, err := f.bits(element)
+	if err != nil {
+		return false, err
+	}
+	values, err := f.readChunks(sortedChunks(bits))
+	if err != nil {
+		return false, err
+	}
+	for chunk, chunkBits := range bits {
+		for _, bit := range chunkBits {
+			if !isSet(values[chunk], bit) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,77 @@
+package keyvaluestorebloom_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/keyvaluestorebloom"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestParameters(t *testing.T) {
+	bits, hashes := keyvaluestorebloom.Parameters(1000, 0.01)
+	assert.Equal(t, uint64(9586), bits)
+	assert.Equal(t, 7, hashes)
+}
+
+func TestFilter(t *testing.T) {
+	bits, hashes := keyvaluestorebloom.Parameters(1000, 0.01)
+	f := &keyvaluestorebloom.Filter{
+		Backend:   memorystore.NewBackend(),
+		Key:       "filter",
+		Bits:      bits,
+		Hashes:    hashes,
+		ChunkSize: 128,
+	}
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, f.Add(strconv.Itoa(i)))
+	}
+	for i := 0; i < 1000; i++ {
+		ok, err := f.MayContain(strconv.Itoa(i))
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	falsePositives := 0
+	for i := 1000; i < 11000; i++ {
+		ok, err := f.MayContain(strconv.Itoa(i))
+		require.NoError(t, err)
+		if ok {
+			falsePositives++
+		}
+	}
+	assert.InDelta(t, 0.01, float64(falsePositives)/10000, 0.01)
+}
+
+func TestFilterConcurrency(t *testing.T) {
+	f := &keyvaluestorebloom.Filter{
+		Backend:   memorystore.NewBackend(),
+		Key:       "filter",
+		Bits:      64,
+		Hashes:    3,
+		ChunkSize: 4,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 3; j++ {
+				assert.NoError(t, f.Add(strconv.Itoa(i*3+j)))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 30; i++ {
+		ok, err := f.MayContain(strconv.Itoa(i))
+		require.NoError(t, err)
+		assert.True(t, ok, "additions shouldn't be lost")
+	}
+}
@@ -0,0 +1,119 @@
+package keyvaluestorecache
+
+import "github.com/ccbrown/keyvaluestore"
+
+// readCacheAtomicWriteOperation checks conditions against cached values as operations are added.
+// If any condition is known to fail, the operation is aborted without a round trip.
+//
+// Idempotent operations are always sent to the backend since the conditions of a retried write may
+// have been invalidated by the write's own first attempt.
+type readCacheAtomicWriteOperation struct {
+	keyvaluestore.AtomicWriteOperation
+	ReadCache *ReadCache
+
+	conditionFailed bool
+	idempotent      bool
+}
+
+type readCacheAtomicWriteResult struct {
+	keyvaluestore.AtomicWriteResult
+	op              *readCacheAtomicWriteOperation
+	conditionFailed bool
+}
+
+func (r *readCacheAtomicWriteResult) ConditionalFailed() bool {
+	return (r.conditionFailed && !r.op.idempotent) || r.AtomicWriteResult.ConditionalFailed()
+}
+
+func (op *readCacheAtomicWriteOperation) result(result keyvaluestore.AtomicWriteResult, conditionFailed bool) keyvaluestore.AtomicWriteResult {
+	if conditionFailed {
+		op.conditionFailed = true
+	}
+	return &readCacheAtomicWriteResult{
+		AtomicWriteResult: result,
+		op:                op,
+		conditionFailed:   conditionFailed,
+	}
+}
+
+// cachedGet returns the cached value for the key, if there is one.
+func (op *readCacheAtomicWriteOperation) cachedGet(key string) (*string, bool) {
+	v, _ := op.ReadCache.load(key)
+	if entry, ok := v.(readCacheGetEntry); ok && entry.err == nil {
+		return entry.value, true
+	}
+	return nil, false
+}
+
+// cachedHGet returns the cached value for the hash field, if there is one.
+func (op *readCacheAtomicWriteOperation) cachedHGet(key, field string) (*string, bool) {
+	v, _ := op.ReadCache.load(key)
+	switch entry := v.(type) {
+	case readCacheHGetAllEntry:
+		if entry.err == nil {
+			if value, ok := entry.fields[field]; ok {
+				return &value, true
+			}
+			return nil, true
+		}
+	case readCacheHGetsEntry:
+		if r, ok := entry.fields[field]; ok && r.err == nil {
+			return r.value, true
+		}
+	}
+	return nil, false
+}
+
+// cachedZScore returns the cached score for the sorted set member, if there is one.
+func (op *readCacheAtomicWriteOperation) cachedZScore(key, member string) (*float64, bool) {
+	v, _ := op.ReadCache.load(key)
+	if zEntry, ok := v.(readCacheZEntry); ok {
+		if entry, ok := zEntry.subcache[concatKeys("zs", member)].(readCacheZScoreEntry); ok && entry.err == nil {
+			return entry.score, true
+		}
+	}
+	return nil, false
+}
+
+func (op *readCacheAtomicWriteOperation) SetNX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	v, ok := op.cachedGet(key)
+	return op.result(op.AtomicWriteOperation.SetNX(key, value), ok && v != nil)
+}
+
+func (op *readCacheAtomicWriteOperation) SetXX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	v, ok := op.cachedGet(key)
+	return op.result(op.AtomicWriteOperation.SetXX(key, value), ok && v == nil)
+}
+
+func (op *readCacheAtomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
+	v, ok := op.cachedGet(key)
+	return op.result(op.AtomicWriteOperation.SetEQ(key, value, oldValue), ok && (v == nil || *v != *keyvaluestore.ToString(oldValue)))
+}
+
+func (op *readCacheAtomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteResult {
+	v, ok := op.cachedGet(key)
+	return op.result(op.AtomicWriteOperation.DeleteXX(key), ok && v == nil)
+}
+
+func (op *readCacheAtomicWriteOperation) ZAddNX(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	v, ok := op.cachedZScore(key, *keyvaluestore.ToString(member))
+	return op.result(op.AtomicWriteOperation.ZAddNX(key, member, score), ok && v != nil)
+}
+
+func (op *readCacheAtomicWriteOperation) HSetNX(key, field string, value interface{}) keyvaluestore.AtomicWriteResult {
+	v, ok := op.cachedHGet(key, field)
+	return op.result(op.AtomicWriteOperation.HSetNX(key, field, value), ok && v != nil)
+}
+
+func (op *readCacheAtomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.AtomicWriteOperation.WithIdempotencyToken(token)
+	op.idempotent = true
+	return op
+}
+
+func (op *readCacheAtomicWriteOperation) Exec() (bool, error) {
+	if op.conditionFailed && !op.idempotent {
+		return false, nil
+	}
+	return op.AtomicWriteOperation.Exec()
+}
@@ -9,9 +9,12 @@ type readCacheBatchOperation struct {
 	getMisses      []boGetMiss
 	zscoreMisses   []boZScoreMiss
 	smembersMisses []boSMembersMiss
+	zrangeMisses   []boZRangeMiss
 	batch          keyvaluestore.BatchOperation
 	invalidations  []string
-	firstError     error
+
+	// errs are the cached errors of operations that didn't need to be executed.
+	errs []error
 }
 
 type boGetMiss struct {
@@ -33,6 +36,15 @@ type boSMembersMiss struct {
 	Source keyvaluestore.SMembersResult
 }
 
+type boZRangeMiss struct {
+	Key    string
+	Subkey string
+	Scores *readCacheScoreRange
+	Limit  int
+	Dest   *boZRangeResult
+	Source keyvaluestore.ZRangeResult
+}
+
 type boGetResult struct {
 	value *string
 	err   error
@@ -49,8 +61,8 @@ func (op *readCacheBatchOperation) Get(key string) keyvaluestore.GetResult {
 		entry, ok := v.(readCacheGetEntry)
 		if ok {
 			result.value, result.err = entry.value, entry.err
-			if result.err != nil && op.firstError == nil {
-				op.firstError = result.err
+			if result.err != nil {
+				op.errs = append(op.errs, result.err)
 			}
 		} else {
 			op.getMisses = append(op.getMisses, boGetMiss{
@@ -89,8 +101,8 @@ func (op *readCacheBatchOperation) SMembers(key string) keyvaluestore.SMembersRe
 		entry, ok := v.(readCacheSMembersEntry)
 		if ok {
 			result.members, result.err = entry.members, entry.err
-			if result.err != nil && op.firstError == nil {
-				op.firstError = result.err
+			if result.err != nil {
+				op.errs = append(op.errs, result.err)
 			}
 		} else {
 			op.smembersMisses = append(op.smembersMisses, boSMembersMiss{
@@ -118,6 +130,11 @@ func (op *readCacheBatchOperation) ZAdd(key string, member interface{}, score fl
 	return op.batch.ZAdd(key, member, score)
 }
 
+func (op *readCacheBatchOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.ErrorResult {
+	op.invalidations = append(op.invalidations, key)
+	return op.batch.ZHMAdd(key, entries)
+}
+
 func (op *readCacheBatchOperation) ZRem(key string, member interface{}) keyvaluestore.ErrorResult {
 	op.invalidations = append(op.invalidations, key)
 	return op.batch.ZRem(key, member)
@@ -141,8 +158,8 @@ func (op *readCacheBatchOperation) ZScore(key string, member interface{}) keyval
 		if zEntry, ok := v.(readCacheZEntry); ok {
 			if entry, ok := zEntry.subcache[subkey].(readCacheZScoreEntry); ok {
 				result.score, result.err = entry.score, entry.err
-				if result.err != nil && op.firstError == nil {
-					op.firstError = result.err
+				if result.err != nil {
+					op.errs = append(op.errs, result.err)
 				}
 				return
 			}
@@ -157,20 +174,98 @@ func (op *readCacheBatchOperation) ZScore(key string, member interface{}) keyval
 	return result
 }
 
+type boZRangeResult struct {
+	members []string
+	err     error
+}
+
+func (r *boZRangeResult) Result() ([]string, error) {
+	return r.members, r.err
+}
+
+// zRange looks up the first of the given subkeys that can satisfy the query. On a miss, the
+// result is cached under the last one. Batched score ranges don't return scores, so they're cached
+// separately from the entries of ZHRangeByScoreWithScores, but can still be satisfied by them.
+func (op *readCacheBatchOperation) zRange(key string, subkeys []string, scores *readCacheScoreRange, limit int, source func() keyvaluestore.ZRangeResult) keyvaluestore.ZRangeResult {
+	result := &boZRangeResult{}
+	op.tryCache = append(op.tryCache, func() {
+		v, _ := op.ReadCache.load(key)
+		if zEntry, ok := v.(readCacheZEntry); ok {
+			for _, subkey := range subkeys {
+				if entry, ok := zEntry.subcache[subkey].(readCacheZRangeEntry); ok {
+					if members, ok, err := entry.result(limit); ok {
+						result.members, result.err = members.Values(), err
+						if result.err != nil {
+							op.errs = append(op.errs, result.err)
+						}
+						return
+					}
+				}
+			}
+		}
+		op.zrangeMisses = append(op.zrangeMisses, boZRangeMiss{
+			Key:    key,
+			Subkey: subkeys[len(subkeys)-1],
+			Scores: scores,
+			Limit:  limit,
+			Dest:   result,
+			Source: source(),
+		})
+	})
+	return result
+}
+
+func (op *readCacheBatchOperation) ZHRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.zRange(key, []string{
+		concatKeys("zrbs", floatKey(min), floatKey(max)),
+		concatKeys("zrbsv", floatKey(min), floatKey(max)),
+	}, &readCacheScoreRange{min, max}, limit, func() keyvaluestore.ZRangeResult {
+		return op.batch.ZHRangeByScore(key, min, max, limit)
+	})
+}
+
+func (op *readCacheBatchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.zRange(key, []string{
+		concatKeys("zrrbs", floatKey(min), floatKey(max)),
+		concatKeys("zrrbsv", floatKey(min), floatKey(max)),
+	}, &readCacheScoreRange{min, max}, limit, func() keyvaluestore.ZRangeResult {
+		return op.batch.ZHRevRangeByScore(key, min, max, limit)
+	})
+}
+
+func (op *readCacheBatchOperation) ZHRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.zRange(key, []string{concatKeys("zrbl", min, max)}, nil, limit, func() keyvaluestore.ZRangeResult {
+		return op.batch.ZHRangeByLex(key, min, max, limit)
+	})
+}
+
+func (op *readCacheBatchOperation) ZHRevRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.zRange(key, []string{concatKeys("zrrbl", min, max)}, nil, limit, func() keyvaluestore.ZRangeResult {
+		return op.batch.ZHRevRangeByLex(key, min, max, limit)
+	})
+}
+
+func (op *readCacheBatchOperation) Len() int {
+	// Every read is queued in tryCache and every write is recorded as an invalidation.
+	return len(op.tryCache) + len(op.invalidations)
+}
+
 func (op *readCacheBatchOperation) Exec() error {
 	for _, f := range op.tryCache {
 		f()
 	}
-	if op.firstError != nil || len(op.getMisses)+len(op.smembersMisses)+len(op.zscoreMisses)+len(op.invalidations) == 0 {
-		return op.firstError
+	if len(op.getMisses)+len(op.smembersMisses)+len(op.zscoreMisses)+len(op.zrangeMisses)+len(op.invalidations) == 0 {
+		return keyvaluestore.JoinBatchErrors(op.errs...)
 	}
+	fetched := op.ReadCache.now()
 	err := op.batch.Exec()
 
 	for _, miss := range op.getMisses {
 		miss.Dest.value, miss.Dest.err = miss.Source.Result()
 		op.ReadCache.store(miss.Key, readCacheGetEntry{
-			value: miss.Dest.value,
-			err:   miss.Dest.err,
+			value:   miss.Dest.value,
+			err:     miss.Dest.err,
+			fetched: fetched,
 		})
 	}
 
@@ -184,21 +279,31 @@ func (op *readCacheBatchOperation) Exec() error {
 
 	for _, miss := range op.zscoreMisses {
 		miss.Dest.score, miss.Dest.err = miss.Source.Result()
-		subkey := concatKeys("zs", miss.Member)
-		v, _ := op.ReadCache.load(miss.Key)
-		zEntry, _ := v.(readCacheZEntry)
-		if zEntry.subcache == nil {
-			zEntry.subcache = make(map[string]interface{})
-		}
-		zEntry.subcache[subkey] = readCacheZScoreEntry{
+		op.ReadCache.storeZ(miss.Key, concatKeys("zs", miss.Member), readCacheZScoreEntry{
 			score: miss.Dest.score,
 			err:   miss.Dest.err,
+		})
+	}
+
+	for _, miss := range op.zrangeMisses {
+		miss.Dest.members, miss.Dest.err = miss.Source.Result()
+		members := make(keyvaluestore.ScoredMembers, len(miss.Dest.members))
+		for i, member := range miss.Dest.members {
+			members[i] = &keyvaluestore.ScoredMember{Value: member}
 		}
-		op.ReadCache.store(miss.Key, zEntry)
+		op.ReadCache.storeZ(miss.Key, miss.Subkey, readCacheZRangeEntry{
+			members: members,
+			limit:   miss.Limit,
+			err:     miss.Dest.err,
+			scores:  miss.Scores,
+		})
 	}
 
 	for _, key := range op.invalidations {
-		op.ReadCache.cache.Delete(key)
+		op.ReadCache.Invalidate(key)
+	}
+	if _, ok := err.(*keyvaluestore.BatchError); err != nil && !ok {
+		return err
 	}
-	return err
+	return keyvaluestore.JoinBatchErrors(append(op.errs, err)...)
 }
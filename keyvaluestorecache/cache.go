@@ -0,0 +1,175 @@
+package keyvaluestorecache
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorelock"
+)
+
+// DefaultRevalidationTimeout is the revalidation timeout used by caches that don't specify one.
+const DefaultRevalidationTimeout = 30 * time.Second
+
+// Cache implements read-through caching of expensive computations in a backend. Unlike ReadCache,
+// it's intended to be shared across requests and processes.
+//
+// Concurrent misses for the same key within a process only compute the value once. If
+// StaleWhileRevalidate is set, values that have recently expired continue to be returned while a
+// single process recomputes them in the background, which prevents stampedes for popular keys.
+type Cache struct {
+	Backend keyvaluestore.Backend
+
+	// StaleWhileRevalidate is how long values may be returned after they expire while they're
+	// recomputed in the background. Errors that happen in the background are only passed to
+	// Logger, so if recomputation keeps failing, values are eventually recomputed in the
+	// foreground.
+	StaleWhileRevalidate time.Duration
+
+	// RevalidationTimeout is how long other processes wait for a background recomputation before
+	// trying it themselves. If zero, DefaultRevalidationTimeout is used.
+	RevalidationTimeout time.Duration
+
+	// If non-nil, Logger is warned when background recomputations fail.
+	Logger keyvaluestore.Logger
+
+	// Clock is used to get the current time. If nil, the wall clock is used.
+	Clock keyvaluestore.Clock
+
+	group singleflight.Group
+}
+
+func (c *Cache) currentTime() time.Time {
+	return keyvaluestore.Now(c.Clock)
+}
+
+func (c *Cache) revalidationTimeout() time.Duration {
+	if c.RevalidationTimeout > 0 {
+		return c.RevalidationTimeout
+	}
+	return DefaultRevalidationTimeout
+}
+
+// Entries are stored along with the time at which they expire.
+func encodeCacheEntry(value string, expiresAt time.Time) string {
+	return keyvaluestore.Key{strconv.FormatInt(expiresAt.UnixNano(), 10), value}.String()
+}
+
+func decodeCacheEntry(s string) (string, time.Time, bool) {
+	k, err := keyvaluestore.ParseKey(s)
+	if err != nil || len(k) != 2 {
+		return "", time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(k[0], 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return k[1], time.Unix(0, nanos), true
+}
+
+// Do returns the value cached at the key. If there isn't one, f is invoked and its result is cached
+// for the given duration. Errors returned by f aren't cached. Values that weren't stored by Do are
+// treated as misses and overwritten.
+func (c *Cache) Do(key string, ttl time.Duration, f func() (string, error)) (string, error) {
+	v, err := c.Backend.Get(key)
+	if err != nil {
+		return "", err
+	}
+	if v != nil {
+		if value, expiresAt, ok := decodeCacheEntry(*v); ok {
+			now := c.currentTime()
+			if now.Before(expiresAt) {
+				return value, nil
+			} else if now.Before(expiresAt.Add(c.StaleWhileRevalidate)) {
+				go c.revalidate(key, ttl, f)
+				return value, nil
+			}
+		}
+	}
+
+	value, err, _ := c.group.Do(key, func() (interface{}, error) {
+		return c.fill(key, ttl, f)
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// DoJSON is like Do, but caches values marshaled as JSON. The cached value is unmarshaled into v.
+func (c *Cache) DoJSON(key string, ttl time.Duration, v interface{}, f func() (interface{}, error)) error {
+	s, err := c.Do(key, ttl, func() (string, error) {
+		value, err := f()
+		if err != nil {
+			return "", err
+		}
+		buf, err := json.Marshal(value)
+		if err != nil {
+			return "", &keyvaluestore.JSONError{Key: key, Err: err}
+		}
+		return string(buf), nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(s), v); err != nil {
+		return &keyvaluestore.JSONError{Key: key, Err: err}
+	}
+	return nil
+}
+
+// Invalidate deletes the cached value so that the next Do recomputes it.
+func (c *Cache) Invalidate(key string) error {
+	_, err := c.Backend.Delete(key)
+	return err
+}
+
+func (c *Cache) fill(key string, ttl time.Duration, f func() (string, error)) (string, error) {
+	value, err := f()
+	if err != nil {
+		return "", err
+	}
+	expiresAt := c.currentTime().Add(ttl)
+	if err := c.Backend.Set(key, encodeCacheEntry(value, expiresAt)); err != nil {
+		return "", err
+	}
+	if expirer, ok := c.Backend.(keyvaluestore.Expirer); ok {
+		if _, err := expirer.ExpireAt(key, expiresAt.Add(c.StaleWhileRevalidate)); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+// revalidate recomputes the value in the background. Only one process at a time does so, which is
+// coordinated via a lock stored alongside the value.
+func (c *Cache) revalidate(key string, ttl time.Duration, f func() (string, error)) {
+	lockKey := keyvaluestore.Key{key, "revalidation"}.String()
+	_, err, _ := c.group.Do(lockKey, func() (interface{}, error) {
+		mutex := &keyvaluestorelock.Mutex{
+			Backend: c.Backend,
+			Key:     lockKey,
+		}
+		if ok, err := mutex.Acquire(c.revalidationTimeout()); err != nil || !ok {
+			return nil, err
+		}
+		defer mutex.Release()
+
+		// Another process may have just finished revalidating.
+		if v, err := c.Backend.Get(key); err != nil {
+			return nil, err
+		} else if v != nil {
+			if _, expiresAt, ok := decodeCacheEntry(*v); ok && c.currentTime().Before(expiresAt) {
+				return nil, nil
+			}
+		}
+
+		return c.fill(key, ttl, f)
+	})
+	if err != nil && c.Logger != nil {
+		c.Logger.Warn("cache revalidation failed", "key", key, "error", err)
+	}
+}
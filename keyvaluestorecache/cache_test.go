@@ -0,0 +1,202 @@
+package keyvaluestorecache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	c := &Cache{
+		Backend: memorystore.NewBackend(),
+		Clock: keyvaluestore.ClockFunc(func() time.Time {
+			return now
+		}),
+	}
+
+	var calls int64
+	compute := func() (string, error) {
+		return "foo", nil
+	}
+	counted := func() (string, error) {
+		atomic.AddInt64(&calls, 1)
+		return compute()
+	}
+
+	for i := 0; i < 2; i++ {
+		v, err := c.Do("key", time.Minute, counted)
+		require.NoError(t, err)
+		assert.Equal(t, "foo", v)
+	}
+	assert.Equal(t, int64(1), calls)
+
+	// Once expired, the value is recomputed.
+	now = now.Add(2 * time.Minute)
+	compute = func() (string, error) {
+		return "bar", nil
+	}
+	v, err := c.Do("key", time.Minute, counted)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+	assert.Equal(t, int64(2), calls)
+
+	// Errors aren't cached.
+	failure := errors.New("failure")
+	_, err = c.Do("error", time.Minute, func() (string, error) {
+		return "", failure
+	})
+	assert.Equal(t, failure, err)
+	v, err = c.Do("error", time.Minute, compute)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+
+	require.NoError(t, c.Invalidate("key"))
+	v, err = c.Do("key", time.Minute, func() (string, error) {
+		return "baz", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "baz", v)
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	c := &Cache{
+		Backend: memorystore.NewBackend(),
+	}
+
+	var calls int64
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.Do("key", time.Minute, func() (string, error) {
+				atomic.AddInt64(&calls, 1)
+				<-release
+				return "foo", nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, "foo", v)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int64(1), calls)
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var nowMutex sync.Mutex
+	now := time.Now()
+	c := &Cache{
+		Backend:              memorystore.NewBackend(),
+		StaleWhileRevalidate: time.Minute,
+		Clock: keyvaluestore.ClockFunc(func() time.Time {
+			nowMutex.Lock()
+			defer nowMutex.Unlock()
+			return now
+		}),
+	}
+
+	v, err := c.Do("key", time.Minute, func() (string, error) {
+		return "foo", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "foo", v)
+
+	nowMutex.Lock()
+	now = now.Add(90 * time.Second)
+	nowMutex.Unlock()
+
+	revalidated := make(chan struct{})
+	v, err = c.Do("key", time.Minute, func() (string, error) {
+		defer close(revalidated)
+		return "bar", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "foo", v, "the stale value should be returned")
+
+	select {
+	case <-revalidated:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for revalidation")
+	}
+
+	// The revalidated value is stored shortly after it's computed.
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(time.Millisecond) {
+		v, err = c.Do("key", time.Minute, func() (string, error) {
+			return "baz", nil
+		})
+		require.NoError(t, err)
+		if v == "bar" {
+			break
+		}
+		require.True(t, time.Now().Before(deadline), "timed out waiting for the revalidated value")
+	}
+}
+
+// chanLogger sends the messages of warnings to a channel.
+type chanLogger chan string
+
+func (l chanLogger) Warn(msg string, args ...interface{}) {
+	l <- msg
+}
+
+func TestCacheRevalidationFailure(t *testing.T) {
+	now := time.Now()
+	logger := make(chanLogger, 1)
+	c := &Cache{
+		Backend:              memorystore.NewBackend(),
+		StaleWhileRevalidate: time.Minute,
+		Logger:               logger,
+		Clock: keyvaluestore.ClockFunc(func() time.Time {
+			return now
+		}),
+	}
+
+	_, err := c.Do("key", time.Minute, func() (string, error) {
+		return "foo", nil
+	})
+	require.NoError(t, err)
+
+	now = now.Add(90 * time.Second)
+
+	v, err := c.Do("key", time.Minute, func() (string, error) {
+		return "", errors.New("error")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "foo", v, "the stale value should be returned")
+
+	select {
+	case msg := <-logger:
+		assert.Equal(t, "cache revalidation failed", msg)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the revalidation failure")
+	}
+}
+
+func TestCacheDoJSON(t *testing.T) {
+	c := &Cache{
+		Backend: memorystore.NewBackend(),
+	}
+
+	type object struct {
+		Foo string
+	}
+	for i := 0; i < 2; i++ {
+		var v object
+		require.NoError(t, c.DoJSON("key", time.Minute, &v, func() (interface{}, error) {
+			return &object{Foo: "bar"}, nil
+		}))
+		assert.Equal(t, "bar", v.Foo)
+	}
+}
@@ -3,20 +3,40 @@ package keyvaluestorecache
 import (
 	"encoding/binary"
 	"math"
+	"math/rand"
 	"sync"
+	"time"
 
 	"github.com/ccbrown/keyvaluestore"
 	"github.com/ccbrown/keyvaluestore/keyvaluestoreinvalidator"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorelock"
 )
 
 // Read cache caches reads permanently, or until they're invalidated by a write operation on the
 // cache.
+//
+// Writes to sorted sets only invalidate the cached score ranges and counts that the written
+// members could have entered or left. For example, ZAdd with a score of 5 preserves a cached
+// ZCount from 0 to 4, provided that the member's previous score is cached.
+//
+// If the backend implements keyvaluestore.TTLGetter, the remaining time to live of each key is
+// fetched when it's first cached, and the cached values are discarded once it elapses. This costs
+// an additional request per cache miss. If the backend implements keyvaluestore.Clock, its clock is
+// used to determine when they've elapsed.
 type ReadCache struct {
 	backend keyvaluestore.Backend
 	cache   *sync.Map
 
+	// zMutex serializes updates to the cached entries of sorted sets, which are rebuilt from the
+	// current entry. Their subcaches are copied on write, so reads don't need to hold it.
+	zMutex *keyvaluestorelock.KeyedMutex
+
 	eventuallyConsistentCache *sync.Map
 	eventuallyConsistentReads bool
+
+	atomicWritePrechecks bool
+	ttlJitter            float64
+	hashFillThreshold    int
 }
 
 var _ keyvaluestore.Backend = &ReadCache{}
@@ -25,10 +45,18 @@ func NewReadCache(b keyvaluestore.Backend) *ReadCache {
 	return &ReadCache{
 		backend:                   b,
 		cache:                     &sync.Map{},
+		zMutex:                    &keyvaluestorelock.KeyedMutex{},
 		eventuallyConsistentCache: &sync.Map{},
 	}
 }
 
+// ReadCacheMiddleware returns a middleware that wraps backends with new read caches.
+func ReadCacheMiddleware() keyvaluestore.Middleware {
+	return keyvaluestore.MiddlewareFunc(func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return NewReadCache(b)
+	})
+}
+
 // Returns a new ReadCache that shares the receiver's underlying cache.
 func (c *ReadCache) WithBackend(b keyvaluestore.Backend) *ReadCache {
 	ret := *c
@@ -36,6 +64,42 @@ func (c *ReadCache) WithBackend(b keyvaluestore.Backend) *ReadCache {
 	return &ret
 }
 
+// Returns a new ReadCache whose atomic writes check their conditions against cached values as
+// operations are added. If a condition is known to fail, e.g. SetNX on a key that's cached as
+// existing, Exec returns false without making a request.
+//
+// This assumes that the cached values are current. If the keys may have been changed by anything
+// other than the cache since they were read, prechecks should be disabled so that conditions are
+// always verified by the backend. They're disabled by default. Eventually consistent caches never
+// use their cached values for prechecks.
+func (c *ReadCache) WithAtomicWritePrechecks(enabled bool) *ReadCache {
+	ret := *c
+	ret.atomicWritePrechecks = enabled
+	return &ret
+}
+
+// Returns a new ReadCache that shortens the time to live of each cached key by a random amount of up
+// to the given fraction, e.g. 0.1 for up to 10%. When many instances cache the same hot keys, this
+// spreads their refetches out instead of having every instance hit the backend the moment the keys
+// expire. Entries never outlive their keys, so jitter doesn't cause stale reads. It only has an
+// effect if the backend implements keyvaluestore.TTLGetter.
+func (c *ReadCache) WithTTLJitter(fraction float64) *ReadCache {
+	ret := *c
+	ret.ttlJitter = fraction
+	return &ret
+}
+
+// Returns a new ReadCache that reads entire hashes via HGetAll once HGet has missed the given number
+// of distinct fields of them. The hash's other fields are then served from the cache as well, so hot
+// hashes whose fields are read individually cost one request instead of one per field. Since the
+// whole hash is read, it's best suited to hashes with a modest number of fields. Zero, the default,
+// disables filling.
+func (c *ReadCache) WithHashFillThreshold(n int) *ReadCache {
+	ret := *c
+	ret.hashFillThreshold = n
+	return &ret
+}
+
 // Returns a new ReadCache suitable for eventually consistent reads. Reads on the returned cache
 // will not impact the reads of ancestors with strong consistency. Additionally, the cache will take
 // advantage of the fact that items that would have been invalidated by writes may still be returned
@@ -50,31 +114,119 @@ func (c *ReadCache) WithEventuallyConsistentReads() keyvaluestore.Backend {
 	return &ret
 }
 
+// WithOptions returns a new ReadCache that applies the given options to the underlying backend.
+// Like WithEventuallyConsistentReads, eventual consistency also lets the cache return items that
+// would have been invalidated by writes. The returned cache shares the receiver's underlying
+// cache.
+func (c ReadCache) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	switch opts.Consistency {
+	case keyvaluestore.EventualConsistency:
+		c.eventuallyConsistentReads = true
+	case keyvaluestore.StrongConsistency:
+		c.eventuallyConsistentReads = false
+	}
+	c.backend = keyvaluestore.WithOptions(c.backend, opts)
+	return &c
+}
+
 func (c ReadCache) WithProfiler(profiler interface{}) keyvaluestore.Backend {
 	c.backend = c.backend.WithProfiler(profiler)
 	return &c
 }
 
-func (c *ReadCache) load(key string) (interface{}, bool) {
+// Len returns the number of entries in the cache. It iterates over the entire cache, so it's
+// intended for monitoring rather than hot paths.
+func (c *ReadCache) Len() int {
+	n := 0
+	count := func(key, value interface{}) bool {
+		n++
+		return true
+	}
+	c.entries().Range(count)
+	return n
+}
+
+func (c *ReadCache) entries() *sync.Map {
 	if c.eventuallyConsistentReads {
-		return c.eventuallyConsistentCache.Load(key)
+		return c.eventuallyConsistentCache
+	}
+	return c.cache
+}
+
+// readCacheExpiringEntry wraps entries for keys of backends that implement TTLGetter. If deadline
+// is zero, the key doesn't have a timeout.
+type readCacheExpiringEntry struct {
+	entry    interface{}
+	deadline time.Time
+}
+
+func (c *ReadCache) now() time.Time {
+	if clock, ok := c.backend.(keyvaluestore.Clock); ok {
+		return clock.Now()
 	}
-	return c.cache.Load(key)
+	return time.Now()
+}
+
+func (e readCacheExpiringEntry) isExpired(now time.Time) bool {
+	return !e.deadline.IsZero() && !now.Before(e.deadline)
+}
+
+func (c *ReadCache) load(key string) (interface{}, bool) {
+	v, ok := c.entries().Load(key)
+	if e, isExpiring := v.(readCacheExpiringEntry); isExpiring {
+		if e.isExpired(c.now()) {
+			return nil, false
+		}
+		return e.entry, true
+	}
+	return v, ok
 }
 
 func (c *ReadCache) store(key string, value interface{}) {
-	if c.eventuallyConsistentReads {
-		c.eventuallyConsistentCache.Store(key, value)
-	} else {
-		c.cache.Store(key, value)
+	entries := c.entries()
+	ttlGetter, ok := c.backend.(keyvaluestore.TTLGetter)
+	if !ok {
+		entries.Store(key, value)
+		return
+	}
+
+	// Entries for the same key are often updated piecemeal, e.g. by HGet or ZScore, so the deadline
+	// only needs to be fetched if it isn't already known.
+	if prev, ok := entries.Load(key); ok {
+		if e, ok := prev.(readCacheExpiringEntry); ok && !e.isExpired(c.now()) {
+			e.entry = value
+			entries.Store(key, e)
+			return
+		}
+	}
+
+	ttl, err := ttlGetter.TTL(key)
+	if err != nil {
+		// Without the TTL, the value can't be safely cached.
+		return
 	}
+	e := readCacheExpiringEntry{
+		entry: value,
+	}
+	if ttl != nil {
+		jitter := time.Duration(rand.Float64() * c.ttlJitter * float64(*ttl))
+		e.deadline = c.now().Add(*ttl - jitter)
+	}
+	entries.Store(key, e)
 }
 
 func (c *ReadCache) AtomicWrite() keyvaluestore.AtomicWriteOperation {
-	return (&keyvaluestoreinvalidator.Invalidator{
+	op := (&keyvaluestoreinvalidator.Invalidator{
 		Backend:    c.backend,
 		Invalidate: c.Invalidate,
 	}).AtomicWrite()
+	if c.atomicWritePrechecks && !c.eventuallyConsistentReads {
+		return &readCacheAtomicWriteOperation{
+			AtomicWriteOperation: op,
+			ReadCache:            c,
+		}
+	}
+	return op
 }
 
 func (c *ReadCache) Batch() keyvaluestore.BatchOperation {
@@ -93,18 +245,68 @@ func (c *ReadCache) Delete(key string) (success bool, err error) {
 type readCacheGetEntry struct {
 	value *string
 	err   error
+
+	// fetched is the time at which the value was requested from the backend.
+	fetched time.Time
 }
 
 func (c *ReadCache) Get(key string) (*string, error) {
 	v, _ := c.load(key)
 	entry, ok := v.(readCacheGetEntry)
 	if !ok {
+		entry.fetched = c.now()
 		entry.value, entry.err = c.backend.Get(key)
 		c.store(key, entry)
 	}
 	return entry.value, entry.err
 }
 
+// GetMulti gets multiple keys. Cached values are used if they were fetched from the backend less
+// than maxStaleness ago, and the rest are read from the backend in a single batch and cached. This
+// suits read-heavy endpoints that can tolerate boundedly stale values written by other clients.
+// Writes made via the cache always invalidate the cached values, regardless of their staleness.
+//
+// The returned map has an entry for each key. Keys that don't exist have nil values.
+func (c *ReadCache) GetMulti(keys []string, maxStaleness time.Duration) (map[string]*string, error) {
+	ret := make(map[string]*string, len(keys))
+	now := c.now()
+	var batch keyvaluestore.BatchOperation
+	misses := map[string]keyvaluestore.GetResult{}
+	for _, key := range keys {
+		if _, ok := misses[key]; ok {
+			continue
+		}
+		v, _ := c.load(key)
+		if entry, ok := v.(readCacheGetEntry); ok && entry.err == nil && now.Sub(entry.fetched) < maxStaleness {
+			ret[key] = entry.value
+			continue
+		}
+		if batch == nil {
+			batch = c.backend.Batch()
+		}
+		misses[key] = batch.Get(key)
+	}
+	if batch == nil {
+		return ret, nil
+	}
+
+	if err := batch.Exec(); err != nil {
+		return nil, err
+	}
+	for key, result := range misses {
+		entry := readCacheGetEntry{
+			fetched: now,
+		}
+		entry.value, entry.err = result.Result()
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		c.store(key, entry)
+		ret[key] = entry.value
+	}
+	return ret, nil
+}
+
 func (c *ReadCache) Set(key string, value interface{}) error {
 	err := c.backend.Set(key, value)
 	c.Invalidate(key)
@@ -192,6 +394,9 @@ func (c *ReadCache) HGet(key, field string) (*string, error) {
 	} else {
 		entry.fields = map[string]hGetResult{}
 	}
+	if c.hashFillThreshold > 0 && len(entry.fields)+1 >= c.hashFillThreshold {
+		return c.hGetViaHGetAll(key, field)
+	}
 	v, err := c.backend.HGet(key, field)
 	entry.fields[field] = hGetResult{
 		value: v,
@@ -201,6 +406,17 @@ func (c *ReadCache) HGet(key, field string) (*string, error) {
 	return v, err
 }
 
+// hGetViaHGetAll reads and caches the entire hash, then returns the given field.
+func (c *ReadCache) hGetViaHGetAll(key, field string) (*string, error) {
+	fields, err := c.HGetAll(key)
+	if err != nil {
+		return nil, err
+	} else if v, ok := fields[field]; ok {
+		return &v, nil
+	}
+	return nil, nil
+}
+
 func (c *ReadCache) HGetAll(key string) (map[string]string, error) {
 	v, _ := c.load(key)
 	entry, ok := v.(readCacheHGetAllEntry)
@@ -228,13 +444,45 @@ func (c *ReadCache) SMembers(key string) ([]string, error) {
 
 func (c *ReadCache) ZAdd(key string, member interface{}, score float64) error {
 	err := c.backend.ZAdd(key, member, score)
-	c.Invalidate(key)
+	if err != nil {
+		c.Invalidate(key)
+	} else {
+		c.invalidateZ(key, readCacheZChange{
+			member: *keyvaluestore.ToString(member),
+			isSet:  true,
+			scores: []float64{score},
+		})
+	}
 	return err
 }
 
 func (c *ReadCache) ZHAdd(key, field string, member interface{}, score float64) error {
 	err := c.backend.ZHAdd(key, field, member, score)
-	c.Invalidate(key)
+	if err != nil {
+		c.Invalidate(key)
+	} else {
+		c.invalidateZ(key, readCacheZChange{
+			member: field,
+			scores: []float64{score},
+		})
+	}
+	return err
+}
+
+func (c *ReadCache) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	err := c.backend.ZHMAdd(key, entries)
+	if err != nil {
+		c.Invalidate(key)
+	} else {
+		changes := make([]readCacheZChange, len(entries))
+		for i, entry := range entries {
+			changes[i] = readCacheZChange{
+				member: entry.Field,
+				scores: []float64{entry.Score},
+			}
+		}
+		c.invalidateZ(key, changes...)
+	}
 	return err
 }
 
@@ -254,42 +502,231 @@ func (c *ReadCache) ZScore(key string, member interface{}) (*float64, error) {
 		}
 	}
 	score, err := c.backend.ZScore(key, member)
-	if zEntry.subcache == nil {
-		zEntry.subcache = make(map[string]interface{})
-	}
-	zEntry.subcache[subkey] = readCacheZScoreEntry{
+	c.storeZ(key, subkey, readCacheZScoreEntry{
 		score: score,
 		err:   err,
-	}
-	c.store(key, zEntry)
+	})
 	return score, err
 }
 
 func (c *ReadCache) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
 	val, err := c.backend.ZIncrBy(key, member, n)
-	c.Invalidate(key)
+	if err != nil {
+		c.Invalidate(key)
+	} else {
+		// The previous score isn't necessarily exactly val - n, so it's taken from the cache if
+		// possible.
+		c.invalidateZ(key, readCacheZChange{
+			member: *keyvaluestore.ToString(member),
+			isSet:  true,
+			scores: []float64{val},
+		})
+	}
 	return val, err
 }
 
 func (c *ReadCache) ZRem(key string, member interface{}) error {
 	err := c.backend.ZRem(key, member)
-	c.Invalidate(key)
+	if err != nil {
+		c.Invalidate(key)
+	} else {
+		c.invalidateZ(key, readCacheZChange{
+			member: *keyvaluestore.ToString(member),
+			isSet:  true,
+		})
+	}
 	return err
 }
 
 func (c *ReadCache) ZHRem(key, field string) error {
 	err := c.backend.ZHRem(key, field)
-	c.Invalidate(key)
+	if err != nil {
+		c.Invalidate(key)
+	} else {
+		c.invalidateZ(key, readCacheZChange{
+			member: field,
+		})
+	}
 	return err
 }
 
+func (c *ReadCache) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	ok, err := c.backend.ZHRemEQ(key, field, member)
+	if err != nil || !ok {
+		// The cached member may be stale, so it's better to discard it.
+		c.Invalidate(key)
+	} else {
+		c.invalidateZ(key, readCacheZChange{
+			member: field,
+		})
+	}
+	return ok, err
+}
+
 type readCacheZEntry struct {
 	subcache map[string]interface{}
 }
 
+// storeZ caches a sorted set result under the given subkey, preserving the key's other cached
+// results. Other goroutines may be reading the current subcache, so it's copied rather than
+// modified.
+func (c *ReadCache) storeZ(key, subkey string, entry interface{}) {
+	c.zMutex.Lock(key)
+	defer c.zMutex.Unlock(key)
+
+	v, _ := c.load(key)
+	zEntry, _ := v.(readCacheZEntry)
+	subcache := make(map[string]interface{}, len(zEntry.subcache)+1)
+	for k, e := range zEntry.subcache {
+		subcache[k] = e
+	}
+	subcache[subkey] = entry
+	c.store(key, readCacheZEntry{
+		subcache: subcache,
+	})
+}
+
+func scoredMembersContain(members keyvaluestore.ScoredMembers, value string) bool {
+	for _, member := range members {
+		if member.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// readCacheZChange describes a successful write to a single member of a sorted set or sorted hash.
+type readCacheZChange struct {
+	// member is the member of the sorted set, or the field of the sorted hash.
+	member string
+
+	// isSet is true if member is returned by ranges, i.e. the key is a sorted set rather than a
+	// sorted hash.
+	isSet bool
+
+	// scores are the member's new scores, if any.
+	scores []float64
+}
+
+// invalidateZ removes the cached results for a sorted set that may have been affected by the
+// given changes. Each member's previous score is taken from its cached ZScore result if there is
+// one. If it isn't known, the change could have removed the member from any range, so every range
+// that may have contained it is removed.
+//
+// Score ranges and counts that couldn't have contained the members before or after the changes
+// are preserved, as are the cached scores of other members. Lexicographical ranges and counts are
+// always removed.
+func (c *ReadCache) invalidateZ(key string, changes ...readCacheZChange) {
+	// The entry is rebuilt from the current one, so concurrent updates must not interleave.
+	// Otherwise one could store results that another just removed.
+	c.zMutex.Lock(key)
+	defer c.zMutex.Unlock(key)
+
+	v, ok := c.cache.Load(key)
+	if !ok {
+		return
+	}
+	expiring, isExpiring := v.(readCacheExpiringEntry)
+	if isExpiring {
+		v = expiring.entry
+	}
+	zEntry, ok := v.(readCacheZEntry)
+	if !ok {
+		c.cache.Delete(key)
+		return
+	}
+
+	scoreSubkeys := make(map[string]struct{}, len(changes))
+	var scores []float64
+	previousScoresKnown := true
+
+	// unknownMembers are the set members whose previous scores aren't known. If the previous score
+	// of a sorted hash field isn't known, there's no way to tell which ranges it was in.
+	var unknownMembers []string
+	unknownFields := false
+	for _, change := range changes {
+		scoreSubkey := concatKeys("zs", change.member)
+		scoreSubkeys[scoreSubkey] = struct{}{}
+		scores = append(scores, change.scores...)
+		if entry, ok := zEntry.subcache[scoreSubkey].(readCacheZScoreEntry); ok && entry.err == nil {
+			if entry.score != nil {
+				scores = append(scores, *entry.score)
+			}
+		} else {
+			previousScoresKnown = false
+			if change.isSet {
+				unknownMembers = append(unknownMembers, change.member)
+			} else {
+				unknownFields = true
+			}
+		}
+	}
+
+	affected := func(r *readCacheScoreRange) bool {
+		for _, score := range scores {
+			if r.contains(score) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Results that have already been returned may reference the old subcache, so it's copied.
+	subcache := make(map[string]interface{}, len(zEntry.subcache))
+	for subkey, entry := range zEntry.subcache {
+		keep := false
+		switch entry := entry.(type) {
+		case readCacheZScoreEntry:
+			_, changed := scoreSubkeys[subkey]
+			keep = !changed
+		case readCacheZCountEntry:
+			keep = entry.err == nil && entry.scores != nil && previousScoresKnown && !affected(entry.scores)
+		case readCacheZRangeEntry:
+			if scores := entry.effectiveScores(); entry.err == nil && scores != nil && !affected(scores) {
+				if previousScoresKnown {
+					keep = true
+				} else if !unknownFields {
+					// The members can only have been removed from the range if they were in it.
+					keep = true
+					for _, member := range unknownMembers {
+						if scoredMembersContain(entry.members, member) {
+							keep = false
+							break
+						}
+					}
+				}
+			}
+		}
+		if keep {
+			subcache[subkey] = entry
+		}
+	}
+	zEntry.subcache = subcache
+
+	if isExpiring {
+		expiring.entry = zEntry
+		c.cache.Store(key, expiring)
+	} else {
+		c.cache.Store(key, zEntry)
+	}
+}
+
 type readCacheZCountEntry struct {
 	count int
 	err   error
+
+	// scores is the range that was counted, or nil for lexicographical counts.
+	scores *readCacheScoreRange
+}
+
+// readCacheScoreRange is the range of a cached score query. Entries with score ranges are only
+// invalidated by writes that may change the membership of their range.
+type readCacheScoreRange struct {
+	min, max float64
+}
+
+func (r *readCacheScoreRange) contains(score float64) bool {
+	return r.min <= score && score <= r.max
 }
 
 func (c *ReadCache) ZCount(key string, min, max float64) (int, error) {
@@ -302,14 +739,11 @@ func (c *ReadCache) ZCount(key string, min, max float64) (int, error) {
 		}
 	}
 	count, err := c.backend.ZCount(key, min, max)
-	if zEntry.subcache == nil {
-		zEntry.subcache = make(map[string]interface{})
-	}
-	zEntry.subcache[subkey] = readCacheZCountEntry{
-		count: count,
-		err:   err,
-	}
-	c.store(key, zEntry)
+	c.storeZ(key, subkey, readCacheZCountEntry{
+		count:  count,
+		err:    err,
+		scores: &readCacheScoreRange{min, max},
+	})
 	return count, err
 }
 
@@ -323,14 +757,10 @@ func (c *ReadCache) ZLexCount(key string, min, max string) (int, error) {
 		}
 	}
 	count, err := c.backend.ZLexCount(key, min, max)
-	if zEntry.subcache == nil {
-		zEntry.subcache = make(map[string]interface{})
-	}
-	zEntry.subcache[subkey] = readCacheZCountEntry{
+	c.storeZ(key, subkey, readCacheZCountEntry{
 		count: count,
 		err:   err,
-	}
-	c.store(key, zEntry)
+	})
 	return count, err
 }
 
@@ -338,6 +768,44 @@ type readCacheZRangeEntry struct {
 	members keyvaluestore.ScoredMembers
 	limit   int
 	err     error
+
+	// scores is the range that was queried, or nil for lexicographical ranges.
+	scores *readCacheScoreRange
+
+	// scored is true if the members' scores are known, in which case reverse indicates whether
+	// they're in descending order.
+	scored  bool
+	reverse bool
+}
+
+// effectiveScores returns the range of scores that can affect the entry. If the result was
+// truncated by its limit and the members' scores are known, changes beyond the last member can't
+// affect it. Ties are ordered lexicographically, so changes at the last member's score can.
+func (e readCacheZRangeEntry) effectiveScores() *readCacheScoreRange {
+	if e.scores == nil || !e.scored || e.limit == 0 || len(e.members) < e.limit {
+		return e.scores
+	}
+	last := e.members[len(e.members)-1].Score
+	if e.reverse {
+		return &readCacheScoreRange{last, e.scores.max}
+	}
+	return &readCacheScoreRange{e.scores.min, last}
+}
+
+// result returns the cached result for a query with the given limit, or false if the entry can't
+// be used for it. A limit of zero means no limit.
+func (e readCacheZRangeEntry) result(limit int) (keyvaluestore.ScoredMembers, bool, error) {
+	if e.err != nil {
+		return nil, true, e.err
+	}
+	complete := e.limit == 0 || len(e.members) < e.limit
+	if !complete && (limit == 0 || limit > e.limit) {
+		return nil, false, nil
+	}
+	if limit > 0 && len(e.members) > limit {
+		return e.members[:limit], true, nil
+	}
+	return e.members, true, nil
 }
 
 func floatKey(f float64) string {
@@ -358,32 +826,33 @@ func (c *ReadCache) ZHRangeByScore(key string, min, max float64, limit int) ([]s
 }
 
 func (c *ReadCache) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
-	return c.zRangeByScoreWithScores("zrbs", c.backend.ZRangeByScoreWithScores, key, min, max, limit)
+	return c.zRangeByScoreWithScores("zrbs", false, c.backend.ZRangeByScoreWithScores, key, min, max, limit)
 }
 
 func (c *ReadCache) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
-	return c.zRangeByScoreWithScores("zrbs", c.backend.ZHRangeByScoreWithScores, key, min, max, limit)
+	return c.zRangeByScoreWithScores("zrbs", false, c.backend.ZHRangeByScoreWithScores, key, min, max, limit)
 }
 
-func (c *ReadCache) zRangeByScoreWithScores(cacheKey string, f func(string, float64, float64, int) (keyvaluestore.ScoredMembers, error), key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+func (c *ReadCache) zRangeByScoreWithScores(cacheKey string, reverse bool, f func(string, float64, float64, int) (keyvaluestore.ScoredMembers, error), key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
 	subkey := concatKeys(cacheKey, floatKey(min), floatKey(max))
 	v, _ := c.load(key)
 	zEntry, ok := v.(readCacheZEntry)
 	if ok {
-		if entry, ok := zEntry.subcache[subkey].(readCacheZRangeEntry); ok && limit <= entry.limit {
-			return entry.members, entry.err
+		if entry, ok := zEntry.subcache[subkey].(readCacheZRangeEntry); ok {
+			if members, ok, err := entry.result(limit); ok {
+				return members, err
+			}
 		}
 	}
 	members, err := f(key, min, max, limit)
-	if zEntry.subcache == nil {
-		zEntry.subcache = make(map[string]interface{})
-	}
-	zEntry.subcache[subkey] = readCacheZRangeEntry{
+	c.storeZ(key, subkey, readCacheZRangeEntry{
 		members: members,
 		limit:   limit,
 		err:     err,
-	}
-	c.store(key, zEntry)
+		scores:  &readCacheScoreRange{min, max},
+		scored:  true,
+		reverse: reverse,
+	})
 	return members, err
 }
 
@@ -398,11 +867,11 @@ func (c *ReadCache) ZHRevRangeByScore(key string, min, max float64, limit int) (
 }
 
 func (c *ReadCache) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
-	return c.zRangeByScoreWithScores("zrrbs", c.backend.ZRevRangeByScoreWithScores, key, min, max, limit)
+	return c.zRangeByScoreWithScores("zrrbs", true, c.backend.ZRevRangeByScoreWithScores, key, min, max, limit)
 }
 
 func (c *ReadCache) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
-	return c.zRangeByScoreWithScores("zrrbs", c.backend.ZHRevRangeByScoreWithScores, key, min, max, limit)
+	return c.zRangeByScoreWithScores("zrrbs", true, c.backend.ZHRevRangeByScoreWithScores, key, min, max, limit)
 }
 
 func (c *ReadCache) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
@@ -418,14 +887,13 @@ func (c *ReadCache) zRangeByLex(cacheKey string, f func(string, string, string,
 	v, _ := c.load(key)
 	zEntry, ok := v.(readCacheZEntry)
 	if ok {
-		if entry, ok := zEntry.subcache[subkey].(readCacheZRangeEntry); ok && limit <= entry.limit {
-			return entry.members.Values(), entry.err
+		if entry, ok := zEntry.subcache[subkey].(readCacheZRangeEntry); ok {
+			if members, ok, err := entry.result(limit); ok {
+				return members.Values(), err
+			}
 		}
 	}
 	members, err := f(key, min, max, limit)
-	if zEntry.subcache == nil {
-		zEntry.subcache = make(map[string]interface{})
-	}
 
 	scoredMembers := make([]*keyvaluestore.ScoredMember, len(members))
 
@@ -433,12 +901,11 @@ func (c *ReadCache) zRangeByLex(cacheKey string, f func(string, string, string,
 		scoredMembers[i] = &keyvaluestore.ScoredMember{Value: member}
 	}
 
-	zEntry.subcache[subkey] = readCacheZRangeEntry{
+	c.storeZ(key, subkey, readCacheZRangeEntry{
 		members: scoredMembers,
 		limit:   limit,
 		err:     err,
-	}
-	c.store(key, zEntry)
+	})
 	return members, err
 }
 
@@ -451,17 +918,22 @@ func (c *ReadCache) ZHRevRangeByLex(key string, min, max string, limit int) ([]s
 }
 
 func (c *ReadCache) HasKeyCached(key string) bool {
-	_, ok := c.cache.Load(key)
+	v, ok := c.cache.Load(key)
+	if e, isExpiring := v.(readCacheExpiringEntry); isExpiring {
+		return !e.isExpired(c.now())
+	}
 	return ok
 }
 
 func (c *ReadCache) Invalidate(key string) {
+	c.zMutex.Lock(key)
+	defer c.zMutex.Unlock(key)
 	c.cache.Delete(key)
 }
 
 func (c *ReadCache) InvalidateAll() {
 	c.cache.Range(func(key, value interface{}) bool {
-		c.cache.Delete(key)
+		c.Invalidate(key.(string))
 		return true
 	})
 }
@@ -483,6 +955,40 @@ func concatKeys(s ...string) string {
 	return string(ret)
 }
 
+var _ keyvaluestore.SortedHashFieldRanger = &ReadCache{}
+
+// Sorted hash ranges with fields aren't cached.
+func (c *ReadCache) ZHRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRangeByScoreWithFields(c.backend, key, min, max, limit)
+}
+
+func (c *ReadCache) ZHRevRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRevRangeByScoreWithFields(c.backend, key, min, max, limit)
+}
+
+func (c *ReadCache) ZHRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRangeByLexWithFields(c.backend, key, min, max, limit)
+}
+
+func (c *ReadCache) ZHRevRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRevRangeByLexWithFields(c.backend, key, min, max, limit)
+}
+
+var _ keyvaluestore.MultiExister = &ReadCache{}
+
+// Existence checks aren't cached.
+func (c *ReadCache) ExistsMulti(keys ...string) (map[string]bool, error) {
+	return keyvaluestore.ExistsMulti(c.backend, keys...)
+}
+
+func (c *ReadCache) Ping() error {
+	return c.backend.Ping()
+}
+
+func (c *ReadCache) Close() error {
+	return c.backend.Close()
+}
+
 func (c *ReadCache) Unwrap() keyvaluestore.Backend {
 	return c.backend
 }
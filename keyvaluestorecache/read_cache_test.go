@@ -1,10 +1,18 @@
 package keyvaluestorecache_test
 
 import (
+	"math"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ccbrown/keyvaluestore"
 	"github.com/ccbrown/keyvaluestore/keyvaluestorecache"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoremock"
 	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
 	"github.com/ccbrown/keyvaluestore/memorystore"
 )
@@ -14,3 +22,634 @@ func TestReadCache(t *testing.T) {
 		return keyvaluestorecache.NewReadCache(memorystore.NewBackend())
 	})
 }
+
+func TestReadCacheWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return keyvaluestorecache.NewReadCache(b)
+	}, keyvaluestoretest.WrapperOptions{})
+
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return keyvaluestorecache.NewReadCache(b).WithAtomicWritePrechecks(true)
+	}, keyvaluestoretest.WrapperOptions{
+		// Prechecks only apply to conditions that can be checked against cached values. Sorted hash
+		// members aren't cached by field, so ZHSetEQ and ZHRemEQ can't be prechecked.
+		Inherited: []string{
+			"AtomicWrite.Set", "AtomicWrite.Delete", "AtomicWrite.NIncrBy", "AtomicWrite.ZAdd",
+			"AtomicWrite.ZRem", "AtomicWrite.ZHAdd", "AtomicWrite.ZHMAdd", "AtomicWrite.ZHRem",
+			"AtomicWrite.SAdd", "AtomicWrite.SRem", "AtomicWrite.HSet", "AtomicWrite.HDel",
+			"AtomicWrite.ZHSetEQ", "AtomicWrite.ZHRemEQ",
+		},
+	})
+}
+
+func TestReadCacheAgainstReference(t *testing.T) {
+	keyvaluestoretest.TestBackendAgainstReference(t, func() keyvaluestore.Backend {
+		return keyvaluestorecache.NewReadCache(memorystore.NewBackend())
+	}, func() keyvaluestore.Backend {
+		return memorystore.NewBackend()
+	})
+}
+
+func TestReadCacheConcurrency(t *testing.T) {
+	keyvaluestoretest.TestBackendConcurrency(t, func() keyvaluestore.Backend {
+		return keyvaluestorecache.NewReadCache(memorystore.NewBackend())
+	})
+}
+
+func TestReadCacheLen(t *testing.T) {
+	cache := keyvaluestorecache.NewReadCache(memorystore.NewBackend())
+	assert.Equal(t, 0, cache.Len())
+
+	_, err := cache.Get("foo")
+	assert.NoError(t, err)
+	_, err = cache.Get("bar")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cache.Len())
+
+	assert.NoError(t, cache.Set("foo", "x"))
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestReadCacheWithOptions(t *testing.T) {
+	cache := keyvaluestorecache.NewReadCache(memorystore.NewBackend())
+
+	eventual := keyvaluestore.WithOptions(cache, keyvaluestore.RequestOptions{
+		Consistency: keyvaluestore.EventualConsistency,
+	}).(*keyvaluestorecache.ReadCache)
+	_, err := eventual.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, eventual.Len())
+	assert.Equal(t, 0, cache.Len())
+
+	strong := keyvaluestore.WithOptions(eventual, keyvaluestore.RequestOptions{
+		Consistency: keyvaluestore.StrongConsistency,
+	}).(*keyvaluestorecache.ReadCache)
+	assert.Equal(t, 0, strong.Len())
+}
+
+func TestReadCacheRangeLimits(t *testing.T) {
+	cache := keyvaluestorecache.NewReadCache(memorystore.NewBackend())
+	for i, member := range []string{"a", "b", "c"} {
+		assert.NoError(t, cache.ZAdd("z", member, float64(i)))
+	}
+
+	members, err := cache.ZRangeByScore("z", 0, 10, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, members)
+
+	// A limit of zero means no limit, so the above result can't be reused.
+	members, err = cache.ZRangeByScore("z", 0, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, members)
+
+	members, err = cache.ZRangeByScore("z", 0, 10, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, members)
+
+	for _, member := range []string{"a", "b", "c"} {
+		assert.NoError(t, cache.ZAdd("zlex", member, 0))
+	}
+	members, err = cache.ZRangeByLex("zlex", "-", "+", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, members)
+	members, err = cache.ZRangeByLex("zlex", "-", "+", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, members)
+}
+
+func TestReadCacheAtomicWritePrechecks(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return keyvaluestorecache.NewReadCache(memorystore.NewBackend()).WithAtomicWritePrechecks(true)
+	})
+
+	// Prechecks are detectable by changing the backend behind the cache's back.
+	backend := memorystore.NewBackend()
+	cache := keyvaluestorecache.NewReadCache(backend)
+	prechecked := cache.WithAtomicWritePrechecks(true)
+
+	_, err := prechecked.Get("foo")
+	assert.NoError(t, err)
+	_, err = prechecked.HGet("h", "f")
+	assert.NoError(t, err)
+	_, err = prechecked.ZScore("z", "m")
+	assert.NoError(t, err)
+	assert.NoError(t, backend.Set("foo", "x"))
+
+	tx := prechecked.AtomicWrite()
+	r := tx.SetXX("foo", "y")
+	ok, err := tx.Exec()
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.True(t, r.ConditionalFailed())
+
+	// Without prechecks, the backend decides.
+	tx = cache.WithAtomicWritePrechecks(false).AtomicWrite()
+	tx.SetXX("foo", "y")
+	ok, err = tx.Exec()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	t.Run("SetNX", func(t *testing.T) {
+		_, err := prechecked.Get("foo")
+		assert.NoError(t, err)
+		_, err = backend.Delete("foo")
+		assert.NoError(t, err)
+
+		tx := prechecked.AtomicWrite()
+		r := tx.SetNX("foo", "z")
+		ok, err := tx.Exec()
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.True(t, r.ConditionalFailed())
+	})
+
+	t.Run("SetEQ", func(t *testing.T) {
+		assert.NoError(t, prechecked.Set("foo", "a"))
+		_, err := prechecked.Get("foo")
+		assert.NoError(t, err)
+
+		tx := prechecked.AtomicWrite()
+		r := tx.SetEQ("foo", "c", "b")
+		ok, err := tx.Exec()
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.True(t, r.ConditionalFailed())
+
+		tx = prechecked.AtomicWrite()
+		r = tx.SetEQ("foo", "c", "a")
+		ok, err = tx.Exec()
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.False(t, r.ConditionalFailed())
+	})
+
+	t.Run("HSetNX", func(t *testing.T) {
+		assert.NoError(t, prechecked.HSet("h", "f", "x"))
+		_, err := prechecked.HGetAll("h")
+		assert.NoError(t, err)
+		assert.NoError(t, backend.HDel("h", "f"))
+
+		tx := prechecked.AtomicWrite()
+		r := tx.HSetNX("h", "f", "y")
+		ok, err := tx.Exec()
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.True(t, r.ConditionalFailed())
+	})
+
+	t.Run("ZAddNX", func(t *testing.T) {
+		assert.NoError(t, prechecked.ZAdd("z", "m", 1))
+		_, err := prechecked.ZScore("z", "m")
+		assert.NoError(t, err)
+		assert.NoError(t, backend.ZRem("z", "m"))
+
+		tx := prechecked.AtomicWrite()
+		r := tx.ZAddNX("z", "m", 2)
+		ok, err := tx.Exec()
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.True(t, r.ConditionalFailed())
+	})
+
+	t.Run("EventualConsistency", func(t *testing.T) {
+		eventual := keyvaluestore.WithOptions(prechecked, keyvaluestore.RequestOptions{
+			Consistency: keyvaluestore.EventualConsistency,
+		}).(*keyvaluestorecache.ReadCache)
+		_, err := eventual.Get("bar")
+		assert.NoError(t, err)
+		assert.NoError(t, backend.Set("bar", "x"))
+
+		tx := eventual.AtomicWrite()
+		tx.SetXX("bar", "y")
+		ok, err := tx.Exec()
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestReadCacheTTL(t *testing.T) {
+	backend := memorystore.NewBackend()
+	cache := keyvaluestorecache.NewReadCache(backend)
+
+	assert.NoError(t, backend.Set("foo", "bar"))
+	_, err := backend.Expire("foo", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, backend.Set("persistent", "bar"))
+
+	v, err := cache.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", *v)
+	v, err = cache.Get("persistent")
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", *v)
+	assert.True(t, cache.HasKeyCached("foo"))
+
+	backend.FastForward(time.Hour)
+	assert.False(t, cache.HasKeyCached("foo"))
+	assert.True(t, cache.HasKeyCached("persistent"))
+
+	v, err = cache.Get("foo")
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestReadCacheTTLJitter(t *testing.T) {
+	backend := memorystore.NewBackend()
+	cache := keyvaluestorecache.NewReadCache(backend).WithTTLJitter(0.5)
+
+	assert.NoError(t, backend.Set("foo", "bar"))
+	_, err := backend.Expire("foo", time.Minute)
+	assert.NoError(t, err)
+
+	_, err = cache.Get("foo")
+	assert.NoError(t, err)
+
+	// The entry expires somewhere between 30 seconds and a minute from now.
+	backend.FastForward(29 * time.Second)
+	assert.True(t, cache.HasKeyCached("foo"))
+	backend.FastForward(31 * time.Second)
+	assert.False(t, cache.HasKeyCached("foo"))
+}
+
+func TestReadCacheHashFill(t *testing.T) {
+	backend := &keyvaluestoremock.Backend{}
+	cache := keyvaluestorecache.NewReadCache(backend).WithHashFillThreshold(2)
+
+	assert.NoError(t, backend.HSet("foo", "a", "1", keyvaluestore.KeyValue{Key: "b", Value: "2"}, keyvaluestore.KeyValue{Key: "c", Value: "3"}))
+
+	hGet := func(field string) *string {
+		v, err := cache.HGet("foo", field)
+		assert.NoError(t, err)
+		return v
+	}
+
+	assert.Equal(t, "1", *hGet("a"))
+	assert.Equal(t, "1", *hGet("a"))
+	assert.Len(t, backend.CallsTo("HGet"), 1)
+
+	// The second distinct field fills the cache with the whole hash.
+	assert.Equal(t, "2", *hGet("b"))
+	assert.Equal(t, "3", *hGet("c"))
+	assert.Nil(t, hGet("d"))
+	assert.Len(t, backend.CallsTo("HGet"), 1)
+	assert.Len(t, backend.CallsTo("HGetAll"), 1)
+
+	// Writes invalidate the filled hash like any other.
+	assert.NoError(t, cache.HSet("foo", "d", "4"))
+	assert.Equal(t, "4", *hGet("d"))
+	assert.Len(t, backend.CallsTo("HGet"), 2)
+}
+
+func TestReadCacheGetMulti(t *testing.T) {
+	backend := &keyvaluestoremock.Backend{}
+	cache := keyvaluestorecache.NewReadCache(backend)
+
+	assert.NoError(t, backend.Set("a", "1"))
+	assert.NoError(t, backend.Set("b", "2"))
+
+	_, err := cache.Get("a")
+	assert.NoError(t, err)
+
+	// Only the keys that aren't cached are fetched, in a single batch.
+	values, err := cache.GetMulti([]string{"a", "b", "c", "b"}, time.Hour)
+	assert.NoError(t, err)
+	assert.Len(t, values, 3)
+	assert.Equal(t, "1", *values["a"])
+	assert.Equal(t, "2", *values["b"])
+	assert.Nil(t, values["c"])
+	assert.Len(t, backend.CallsTo("Batch"), 1)
+	assert.Len(t, backend.CallsTo("Get"), 3)
+
+	values, err = cache.GetMulti([]string{"a", "b"}, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", *values["b"])
+	assert.Len(t, backend.CallsTo("Batch"), 1)
+
+	// Values that are too stale are refetched.
+	assert.NoError(t, backend.Set("a", "changed"))
+	values, err = cache.GetMulti([]string{"a"}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "changed", *values["a"])
+	assert.Len(t, backend.CallsTo("Batch"), 2)
+
+	v, err := cache.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "changed", *v)
+	assert.Len(t, backend.CallsTo("Get"), 4)
+}
+
+func TestReadCacheBatchZHRange(t *testing.T) {
+	backend := memorystore.NewBackend()
+	cache := keyvaluestorecache.NewReadCache(backend)
+
+	assert.NoError(t, backend.ZHAdd("foo", "a", "av", 1.0))
+
+	// Ranges cached with scores can satisfy batched ranges.
+	_, err := cache.ZHRangeByScoreWithScores("foo", 0, 10, 0)
+	assert.NoError(t, err)
+
+	batch := cache.Batch()
+	batch.ZHRangeByLex("foo", "-", "+", 0)
+	assert.NoError(t, batch.Exec())
+
+	// Changes behind the cache's back aren't visible to cached ranges.
+	assert.NoError(t, backend.ZHAdd("foo", "b", "bv", 2.0))
+
+	batch = cache.Batch()
+	byScore := batch.ZHRangeByScore("foo", 0, 10, 0)
+	byLex := batch.ZHRangeByLex("foo", "-", "+", 0)
+	assert.NoError(t, batch.Exec())
+
+	members, err := byScore.Result()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"av"}, members)
+
+	members, err = byLex.Result()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"av"}, members)
+}
+
+func TestReadCacheZPartialInvalidation(t *testing.T) {
+	backend := memorystore.NewBackend()
+	cache := keyvaluestorecache.NewReadCache(backend)
+
+	assert.NoError(t, backend.ZAdd("foo", "a", 1.0))
+	assert.NoError(t, backend.ZAdd("foo", "b", 5.0))
+
+	zRangeByScore := func(min, max float64) []string {
+		members, err := cache.ZRangeByScore("foo", min, max, 0)
+		assert.NoError(t, err)
+		return members
+	}
+	zCount := func(min, max float64) int {
+		count, err := cache.ZCount("foo", min, max)
+		assert.NoError(t, err)
+		return count
+	}
+
+	assert.Equal(t, []string{"a"}, zRangeByScore(0, 2))
+	assert.Equal(t, []string{"b"}, zRangeByScore(4, 6))
+	assert.Equal(t, 1, zCount(4, 6))
+	score, err := cache.ZScore("foo", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, *score)
+
+	// Changes behind the cache's back are only visible to results that get invalidated.
+	assert.NoError(t, backend.ZAdd("foo", "c", 0.5))
+	assert.NoError(t, backend.ZAdd("foo", "d", 5.5))
+
+	// The previous score of "a" is cached, so only the first range is affected.
+	assert.NoError(t, cache.ZAdd("foo", "a", 1.5))
+	assert.Equal(t, []string{"c", "a"}, zRangeByScore(0, 2))
+	assert.Equal(t, []string{"b"}, zRangeByScore(4, 6))
+	assert.Equal(t, 1, zCount(4, 6))
+	score, err = cache.ZScore("foo", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, *score)
+
+	// The previous score of "b" isn't cached, but it's a member of the second range.
+	assert.NoError(t, cache.ZRem("foo", "b"))
+	assert.Equal(t, []string{"c", "a"}, zRangeByScore(0, 2))
+	assert.Equal(t, []string{"d"}, zRangeByScore(4, 6))
+	assert.Equal(t, 1, zCount(4, 6))
+}
+
+// slowZScoreBackend delays ZScore so that reads are in flight while writes invalidate the cache.
+type slowZScoreBackend struct {
+	keyvaluestore.Backend
+}
+
+func (b *slowZScoreBackend) ZScore(key string, member interface{}) (*float64, error) {
+	time.Sleep(time.Millisecond)
+	return b.Backend.ZScore(key, member)
+}
+
+// slowBatchBackend delays batches so that batched reads are in flight while writes invalidate the
+// cache.
+type slowBatchBackend struct {
+	keyvaluestore.Backend
+}
+
+func (b *slowBatchBackend) Batch() keyvaluestore.BatchOperation {
+	return &slowBatchOperation{
+		BatchOperation: b.Backend.Batch(),
+	}
+}
+
+type slowBatchOperation struct {
+	keyvaluestore.BatchOperation
+}
+
+func (op *slowBatchOperation) Exec() error {
+	time.Sleep(time.Millisecond)
+	return op.BatchOperation.Exec()
+}
+
+func TestReadCacheBatchZConcurrentInvalidation(t *testing.T) {
+	const n = 20
+
+	for i := 0; i < 10; i++ {
+		cache := keyvaluestorecache.NewReadCache(&slowBatchBackend{
+			Backend: memorystore.NewBackend(),
+		})
+
+		for j := 0; j < n; j++ {
+			members, err := cache.ZHRangeByScore("foo", float64(j), float64(j), 0)
+			require.NoError(t, err)
+			require.Empty(t, members)
+			_, err = cache.ZScore("foo", strconv.Itoa(j))
+			require.NoError(t, err)
+		}
+
+		var wg sync.WaitGroup
+		for j := 0; j < n; j++ {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				assert.NoError(t, cache.ZHAdd("foo", strconv.Itoa(j), strconv.Itoa(j), float64(j)))
+			}(j)
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				batch := cache.Batch()
+				score := batch.ZScore("foo", "x"+strconv.Itoa(j))
+				members := batch.ZHRangeByScore("foo", -float64(j+1), -float64(j+1), 0)
+				assert.NoError(t, batch.Exec())
+				_, err := score.Result()
+				assert.NoError(t, err)
+				_, err = members.Result()
+				assert.NoError(t, err)
+			}(j)
+		}
+		wg.Wait()
+
+		// No batch may restore a range that a concurrent write invalidated.
+		for j := 0; j < n; j++ {
+			members, err := cache.ZHRangeByScore("foo", float64(j), float64(j), 0)
+			require.NoError(t, err)
+			require.Equal(t, []string{strconv.Itoa(j)}, members)
+		}
+	}
+}
+
+func TestReadCacheZConcurrentInvalidation(t *testing.T) {
+	const n = 20
+
+	for i := 0; i < 10; i++ {
+		cache := keyvaluestorecache.NewReadCache(&slowZScoreBackend{
+			Backend: memorystore.NewBackend(),
+		})
+
+		// Each member's previous score is cached, so each write only invalidates its own range.
+		for j := 0; j < n; j++ {
+			members, err := cache.ZRangeByScore("foo", float64(j), float64(j), 0)
+			require.NoError(t, err)
+			require.Empty(t, members)
+			_, err = cache.ZScore("foo", strconv.Itoa(j))
+			require.NoError(t, err)
+		}
+
+		var wg sync.WaitGroup
+		for j := 0; j < n; j++ {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				assert.NoError(t, cache.ZAdd("foo", strconv.Itoa(j), float64(j)))
+			}(j)
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				_, err := cache.ZScore("foo", "x"+strconv.Itoa(j))
+				assert.NoError(t, err)
+			}(j)
+		}
+		wg.Wait()
+
+		// No write or read may restore a range that a concurrent write invalidated.
+		for j := 0; j < n; j++ {
+			members, err := cache.ZRangeByScore("foo", float64(j), float64(j), 0)
+			require.NoError(t, err)
+			require.Equal(t, []string{strconv.Itoa(j)}, members)
+		}
+	}
+}
+
+func TestReadCacheZBoundaryInvalidation(t *testing.T) {
+	backend := memorystore.NewBackend()
+	cache := keyvaluestorecache.NewReadCache(backend)
+
+	assert.NoError(t, backend.ZAdd("foo", "a", 1.0))
+	assert.NoError(t, backend.ZAdd("foo", "b", 2.0))
+
+	zCount := func(min, max float64) int {
+		count, err := cache.ZCount("foo", min, max)
+		assert.NoError(t, err)
+		return count
+	}
+	zScore := func(member string) {
+		_, err := cache.ZScore("foo", member)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, 2, zCount(1, 2))
+	assert.Equal(t, 2, zCount(math.Inf(-1), 2))
+	assert.Equal(t, 0, zCount(3, math.Inf(1)))
+	assert.Equal(t, 2, zCount(math.Inf(-1), math.Inf(1)))
+
+	// Cache the absence of the new members so that their previous scores are known.
+	zScore("c")
+	zScore("d")
+
+	// This change is visible only to results that get invalidated.
+	assert.NoError(t, backend.ZAdd("foo", "x", 1.5))
+
+	// Ranges are inclusive, so a score on the boundary invalidates the ranges on both sides.
+	assert.NoError(t, cache.ZAdd("foo", "c", 2.0))
+	assert.Equal(t, 4, zCount(1, 2))
+	assert.Equal(t, 4, zCount(math.Inf(-1), 2))
+	assert.Equal(t, 0, zCount(3, math.Inf(1)))
+	assert.Equal(t, 4, zCount(math.Inf(-1), math.Inf(1)))
+
+	assert.NoError(t, backend.ZAdd("foo", "y", 1.5))
+
+	// Infinite scores are only contained by ranges that extend to infinity.
+	assert.NoError(t, cache.ZAdd("foo", "d", math.Inf(1)))
+	assert.Equal(t, 4, zCount(1, 2))
+	assert.Equal(t, 4, zCount(math.Inf(-1), 2))
+	assert.Equal(t, 1, zCount(3, math.Inf(1)))
+	assert.Equal(t, 6, zCount(math.Inf(-1), math.Inf(1)))
+}
+
+func TestReadCacheZLimitedRangeInvalidation(t *testing.T) {
+	backend := memorystore.NewBackend()
+	cache := keyvaluestorecache.NewReadCache(backend)
+
+	for i, member := range []string{"a", "b", "c", "d"} {
+		assert.NoError(t, backend.ZAdd("foo", member, float64(i+1)))
+	}
+
+	zRange := func(limit int) []string {
+		members, err := cache.ZRangeByScore("foo", math.Inf(-1), math.Inf(1), limit)
+		assert.NoError(t, err)
+		return members
+	}
+	zRevRange := func(limit int) []string {
+		members, err := cache.ZRevRangeByScore("foo", math.Inf(-1), math.Inf(1), limit)
+		assert.NoError(t, err)
+		return members
+	}
+
+	assert.Equal(t, []string{"a", "b"}, zRange(2))
+	assert.Equal(t, []string{"d", "c"}, zRevRange(2))
+	for _, member := range []string{"e", "f", "g"} {
+		_, err := cache.ZScore("foo", member)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, backend.ZAdd("foo", "0", 0))
+
+	// Changes beyond the last member of a truncated range don't affect it.
+	assert.NoError(t, cache.ZAdd("foo", "e", 2.5))
+	assert.Equal(t, []string{"a", "b"}, zRange(2))
+	assert.Equal(t, []string{"d", "c"}, zRevRange(2))
+
+	// Ties are ordered by member, so changes at the last member's score do.
+	assert.NoError(t, cache.ZAdd("foo", "f", 3))
+	assert.Equal(t, []string{"a", "b"}, zRange(2))
+	assert.Equal(t, []string{"d", "f"}, zRevRange(2))
+
+	assert.NoError(t, cache.ZAdd("foo", "g", 2))
+	assert.Equal(t, []string{"0", "a"}, zRange(2))
+}
+
+func TestReadCacheZHMAddInvalidation(t *testing.T) {
+	backend := memorystore.NewBackend()
+	cache := keyvaluestorecache.NewReadCache(backend)
+
+	assert.NoError(t, backend.ZHAdd("foo", "a", "av", 1))
+	assert.NoError(t, backend.ZHAdd("foo", "b", "bv", 10))
+
+	zhRange := func(min, max float64) []string {
+		members, err := cache.ZHRangeByScore("foo", min, max, 0)
+		assert.NoError(t, err)
+		return members
+	}
+
+	assert.Equal(t, []string{"av"}, zhRange(0, 5))
+	assert.Equal(t, []string{"bv"}, zhRange(6, 20))
+
+	// The previous scores of sorted hash fields aren't known, so every range is invalidated.
+	assert.NoError(t, backend.ZHAdd("foo", "x", "xv", 2))
+	assert.NoError(t, cache.ZHMAdd("foo", []keyvaluestore.ZHEntry{
+		{Field: "c", Member: "cv", Score: 3},
+	}))
+	assert.Equal(t, []string{"av", "xv", "cv"}, zhRange(0, 5))
+	assert.Equal(t, []string{"bv"}, zhRange(6, 20))
+}
+
+func TestReadCacheInvalidation(t *testing.T) {
+	cache := keyvaluestorecache.NewReadCache(memorystore.NewBackend())
+	keyvaluestoretest.TestInvalidation(t, cache, func(key string) bool {
+		return !cache.HasKeyCached(key)
+	})
+}
@@ -0,0 +1,262 @@
+// Package keyvaluestorecheck compares the contents of two backends.
+package keyvaluestorecheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// DefaultPageSize is the number of entries scanned at a time if no page size is given.
+const DefaultPageSize = 1000
+
+// Difference describes a key whose contents differ between the two backends.
+type Difference struct {
+	Key string
+
+	// A and B are the key's entries in each backend. One of them is nil if the key only exists in
+	// the other backend.
+	A *keyvaluestore.Entry
+	B *keyvaluestore.Entry
+
+	// Details describes each difference, e.g. set members that only exist in one backend or sorted
+	// set members whose scores differ.
+	Details []string
+}
+
+func (d *Difference) String() string {
+	return fmt.Sprintf("%v: %v", d.Key, strings.Join(d.Details, ", "))
+}
+
+// Result is the result of a check.
+type Result struct {
+	// The number of keys compared.
+	Checked int
+
+	Differences []*Difference
+}
+
+// Checker compares two backends key-by-key.
+type Checker struct {
+	// A must implement keyvaluestore.Scanner.
+	A keyvaluestore.Backend
+
+	// If B implements keyvaluestore.Scanner, keys that only exist in B are reported. If either
+	// backend doesn't implement keyvaluestore.EntryGetter, sorted set members are compared by value
+	// and score only.
+	B keyvaluestore.Backend
+
+	// The number of entries to scan at a time. Defaults to DefaultPageSize.
+	PageSize int
+}
+
+// Check walks both backends and returns the differences between them.
+func (c *Checker) Check() (*Result, error) {
+	scannerA, ok := c.A.(keyvaluestore.Scanner)
+	if !ok {
+		return nil, fmt.Errorf("backend does not support scanning: %T: %w", c.A, keyvaluestore.ErrNotSupported)
+	}
+	_, exactA := c.A.(keyvaluestore.EntryGetter)
+	_, exactB := c.B.(keyvaluestore.EntryGetter)
+	exact := exactA && exactB
+
+	ret := &Result{}
+	if err := c.scan(scannerA, func(a *keyvaluestore.Entry) error {
+		b, err := GetEntry(c.B, a.Key, a.Type)
+		if err != nil {
+			return err
+		}
+		ret.Checked++
+		if diff := Compare(a, b, exact); diff != nil {
+			ret.Differences = append(ret.Differences, diff)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	scannerB, ok := c.B.(keyvaluestore.Scanner)
+	if !ok {
+		return ret, nil
+	}
+	if err := c.scan(scannerB, func(b *keyvaluestore.Entry) error {
+		a, err := GetEntry(c.A, b.Key, b.Type)
+		if err != nil {
+			return err
+		} else if a == nil {
+			ret.Checked++
+			ret.Differences = append(ret.Differences, Compare(nil, b, exact))
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (c *Checker) scan(scanner keyvaluestore.Scanner, f func(*keyvaluestore.Entry) error) error {
+	pageSize := c.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	cursor := ""
+	for {
+		entries, next, err := scanner.Scan(cursor, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := f(entry); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// Compare returns the differences between two entries for the same key, or nil if they're
+// equivalent. Either entry may be nil. If exact is false, the fields of sorted set members are
+// ignored.
+func Compare(a, b *keyvaluestore.Entry, exact bool) *Difference {
+	switch {
+	case a == nil && b == nil:
+		return nil
+	case a == nil:
+		return &Difference{Key: b.Key, B: b, Details: []string{"only in b"}}
+	case b == nil:
+		return &Difference{Key: a.Key, A: a, Details: []string{"only in a"}}
+	}
+
+	var details []string
+	if a.Type != b.Type {
+		details = append(details, fmt.Sprintf("type: %v != %v", a.Type, b.Type))
+	} else {
+		switch a.Type {
+		case keyvaluestore.EntryTypeString:
+			if a.Value != b.Value {
+				details = append(details, fmt.Sprintf("value: %q != %q", a.Value, b.Value))
+			}
+		case keyvaluestore.EntryTypeSet:
+			details = compareSets(a.Members, b.Members)
+		case keyvaluestore.EntryTypeHash:
+			details = compareHashes(a.Fields, b.Fields)
+		case keyvaluestore.EntryTypeSortedSet:
+			details = compareSortedSets(a.SortedSetMembers, b.SortedSetMembers, exact)
+		}
+	}
+
+	if len(details) == 0 {
+		return nil
+	}
+	return &Difference{
+		Key:     a.Key,
+		A:       a,
+		B:       b,
+		Details: details,
+	}
+}
+
+func compareSets(a, b []string) []string {
+	inA := make(map[string]struct{}, len(a))
+	for _, member := range a {
+		inA[member] = struct{}{}
+	}
+	inB := make(map[string]struct{}, len(b))
+	for _, member := range b {
+		inB[member] = struct{}{}
+	}
+
+	var details []string
+	for _, member := range sortedKeys(inA) {
+		if _, ok := inB[member]; !ok {
+			details = append(details, fmt.Sprintf("member %q only in a", member))
+		}
+	}
+	for _, member := range sortedKeys(inB) {
+		if _, ok := inA[member]; !ok {
+			details = append(details, fmt.Sprintf("member %q only in b", member))
+		}
+	}
+	return details
+}
+
+func compareHashes(a, b map[string]string) []string {
+	fields := map[string]struct{}{}
+	for field := range a {
+		fields[field] = struct{}{}
+	}
+	for field := range b {
+		fields[field] = struct{}{}
+	}
+
+	var details []string
+	for _, field := range sortedKeys(fields) {
+		va, inA := a[field]
+		vb, inB := b[field]
+		switch {
+		case !inB:
+			details = append(details, fmt.Sprintf("field %q only in a", field))
+		case !inA:
+			details = append(details, fmt.Sprintf("field %q only in b", field))
+		case va != vb:
+			details = append(details, fmt.Sprintf("field %q: %q != %q", field, va, vb))
+		}
+	}
+	return details
+}
+
+func compareSortedSets(a, b []keyvaluestore.SortedSetEntryMember, exact bool) []string {
+	index := func(members []keyvaluestore.SortedSetEntryMember) map[string]keyvaluestore.SortedSetEntryMember {
+		ret := make(map[string]keyvaluestore.SortedSetEntryMember, len(members))
+		for _, member := range members {
+			if !exact {
+				member.Field = member.Value
+			}
+			ret[member.Field] = member
+		}
+		return ret
+	}
+	inA, inB := index(a), index(b)
+
+	fields := map[string]struct{}{}
+	for field := range inA {
+		fields[field] = struct{}{}
+	}
+	for field := range inB {
+		fields[field] = struct{}{}
+	}
+
+	var details []string
+	for _, field := range sortedKeys(fields) {
+		ma, okA := inA[field]
+		mb, okB := inB[field]
+		switch {
+		case !okB:
+			details = append(details, fmt.Sprintf("member %q only in a", field))
+		case !okA:
+			details = append(details, fmt.Sprintf("member %q only in b", field))
+		default:
+			if ma.Score != mb.Score {
+				details = append(details, fmt.Sprintf("score of %q: %v != %v", field, ma.Score, mb.Score))
+			}
+			if ma.Value != mb.Value {
+				details = append(details, fmt.Sprintf("value of %q: %q != %q", field, ma.Value, mb.Value))
+			}
+		}
+	}
+	return details
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,89 @@
+package keyvaluestorecheck
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+// opaqueBackend hides the optional interfaces of a backend.
+type opaqueBackend struct {
+	keyvaluestore.Backend
+}
+
+func newBackends(t *testing.T) (*memorystore.Backend, *memorystore.Backend) {
+	a, b := memorystore.NewBackend(), memorystore.NewBackend()
+	for _, backend := range []*memorystore.Backend{a, b} {
+		require.NoError(t, backend.Set("same", "foo"))
+		require.NoError(t, backend.SAdd("set", "a", "b"))
+		require.NoError(t, backend.HSet("hash", "a", "1", keyvaluestore.KeyValue{Key: "b", Value: "2"}))
+		require.NoError(t, backend.ZAdd("zset", "a", 1))
+		require.NoError(t, backend.ZAdd("zset", "b", 2))
+	}
+	require.NoError(t, a.Set("string", "foo"))
+	require.NoError(t, b.Set("string", "bar"))
+	require.NoError(t, a.Set("onlya", "foo"))
+	require.NoError(t, b.Set("onlyb", "foo"))
+	require.NoError(t, b.SAdd("set", "c"))
+	require.NoError(t, b.HSet("hash", "a", "x"))
+	require.NoError(t, b.ZAdd("zset", "a", 3))
+	require.NoError(t, b.ZAdd("zset", "c", 1))
+	return a, b
+}
+
+func differences(result *Result) map[string]string {
+	ret := map[string]string{}
+	for _, diff := range result.Differences {
+		ret[diff.Key] = diff.String()
+	}
+	return ret
+}
+
+func TestChecker(t *testing.T) {
+	a, b := newBackends(t)
+	result, err := (&Checker{A: a, B: b, PageSize: 2}).Check()
+	require.NoError(t, err)
+	assert.Equal(t, 7, result.Checked)
+	assert.Equal(t, map[string]string{
+		"hash":   `hash: field "a": "1" != "x"`,
+		"onlya":  "onlya: only in a",
+		"onlyb":  "onlyb: only in b",
+		"set":    `set: member "c" only in b`,
+		"string": `string: value: "foo" != "bar"`,
+		"zset":   `zset: score of "a": 1 != 3, member "c" only in b`,
+	}, differences(result))
+}
+
+func TestCheckerOpaque(t *testing.T) {
+	a, b := newBackends(t)
+
+	// If B can't be scanned, keys that only exist in B can't be found.
+	result, err := (&Checker{A: a, B: opaqueBackend{b}}).Check()
+	require.NoError(t, err)
+	assert.Equal(t, 6, result.Checked)
+	assert.Len(t, result.Differences, 5)
+	assert.Equal(t, `zset: score of "a": 1 != 3, member "c" only in b`, differences(result)["zset"])
+}
+
+func TestCompareSortedHashes(t *testing.T) {
+	a := &keyvaluestore.Entry{
+		Key:  "foo",
+		Type: keyvaluestore.EntryTypeSortedSet,
+		SortedSetMembers: []keyvaluestore.SortedSetEntryMember{
+			{Field: "f", Value: "v", Score: 1},
+		},
+	}
+	b := &keyvaluestore.Entry{
+		Key:  "foo",
+		Type: keyvaluestore.EntryTypeSortedSet,
+		SortedSetMembers: []keyvaluestore.SortedSetEntryMember{
+			{Field: "v", Value: "v", Score: 1},
+		},
+	}
+	assert.Nil(t, Compare(a, b, false))
+	assert.Equal(t, []string{`member "f" only in a`, `member "v" only in b`}, Compare(a, b, true).Details)
+}
@@ -0,0 +1,58 @@
+package keyvaluestorecheck
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// GetEntry reads the entry of the given type at the given key. If the backend implements
+// keyvaluestore.EntryGetter, it's used and the type is only a hint. Otherwise the entry is read
+// via the backend's type-specific operations, and sorted set members' fields are assumed to be the
+// same as their values. If the key doesn't exist, nil is returned.
+func GetEntry(b keyvaluestore.Backend, key string, t keyvaluestore.EntryType) (*keyvaluestore.Entry, error) {
+	if getter, ok := b.(keyvaluestore.EntryGetter); ok {
+		return getter.GetEntry(key)
+	}
+
+	entry := &keyvaluestore.Entry{
+		Key:  key,
+		Type: t,
+	}
+	switch t {
+	case keyvaluestore.EntryTypeString:
+		v, err := b.Get(key)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		entry.Value = *v
+	case keyvaluestore.EntryTypeSet:
+		members, err := b.SMembers(key)
+		if err != nil || len(members) == 0 {
+			return nil, err
+		}
+		entry.Members = members
+	case keyvaluestore.EntryTypeHash:
+		fields, err := b.HGetAll(key)
+		if err != nil || len(fields) == 0 {
+			return nil, err
+		}
+		entry.Fields = fields
+	case keyvaluestore.EntryTypeSortedSet:
+		members, err := b.ZHRangeByScoreWithScores(key, math.Inf(-1), math.Inf(1), 0)
+		if err != nil || len(members) == 0 {
+			return nil, err
+		}
+		for _, member := range members {
+			entry.SortedSetMembers = append(entry.SortedSetMembers, keyvaluestore.SortedSetEntryMember{
+				Field: member.Value,
+				Value: member.Value,
+				Score: member.Score,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported entry type for key %v: %v", key, t)
+	}
+	return entry, nil
+}
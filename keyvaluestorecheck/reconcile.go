@@ -0,0 +1,174 @@
+package keyvaluestorecheck
+
+import (
+	"math"
+	"sort"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// SortedSetChange is a change to a single member of a sorted set or sorted hash.
+type SortedSetChange struct {
+	// Field identifies the member. For members added via ZAdd, it's the member itself.
+	Field string
+
+	// Remove is true if the member should be removed. Otherwise it should be added or updated.
+	Remove bool
+
+	// Member and Score are the member's desired value and score. For removals, they're those of
+	// the member being removed.
+	Member string
+	Score  float64
+}
+
+// DiffSortedSets returns the changes that make the sorted set or sorted hash at keyB in backend b
+// identical to the one at keyA in backend a, ordered by field. The backends may be the same. Members
+// are compared by field, value, and score, and only members that differ produce changes.
+//
+// If a backend implements keyvaluestore.SortedHashFieldRanger, its members are read with their
+// fields. Otherwise its fields are assumed to be the same as their values, so sorted hashes can only
+// be compared on backends that can read their fields.
+func DiffSortedSets(a keyvaluestore.Backend, keyA string, b keyvaluestore.Backend, keyB string) ([]*SortedSetChange, error) {
+	membersA, err := readSortedSet(a, keyA)
+	if err != nil {
+		return nil, err
+	}
+	membersB, err := readSortedSet(b, keyB)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*SortedSetChange
+	for field, ma := range membersA {
+		if mb, ok := membersB[field]; !ok || mb.Value != ma.Value || mb.Score != ma.Score {
+			ret = append(ret, &SortedSetChange{
+				Field:  field,
+				Member: ma.Value,
+				Score:  ma.Score,
+			})
+		}
+	}
+	for field, mb := range membersB {
+		if _, ok := membersA[field]; !ok {
+			ret = append(ret, &SortedSetChange{
+				Field:  field,
+				Remove: true,
+				Member: mb.Value,
+				Score:  mb.Score,
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Field < ret[j].Field
+	})
+	return ret, nil
+}
+
+// ApplySortedSetChanges applies changes to the sorted set or sorted hash at the given key. Members
+// whose field is the same as their value are added via ZAdd and removed via ZRem, and sorted hash
+// members are added via ZHMAdd. These are made in batches of up to DefaultPageSize changes.
+// Backends can't remove sorted hash members in batches, so they're removed individually via ZHRem.
+//
+// The changes aren't applied atomically. If an error is returned, some of them may have been
+// applied, and the sets can be diffed again to retry.
+func ApplySortedSetChanges(b keyvaluestore.Backend, key string, changes []*SortedSetChange) error {
+	for len(changes) > 0 {
+		n := len(changes)
+		if n > DefaultPageSize {
+			n = DefaultPageSize
+		}
+		if err := applySortedSetChanges(b, key, changes[:n]); err != nil {
+			return err
+		}
+		changes = changes[n:]
+	}
+	return nil
+}
+
+func applySortedSetChanges(b keyvaluestore.Backend, key string, changes []*SortedSetChange) error {
+	batch := b.Batch()
+	var entries []keyvaluestore.ZHEntry
+	var fieldRemovals []string
+	for _, change := range changes {
+		switch {
+		case change.Remove && change.Field == change.Member:
+			batch.ZRem(key, change.Field)
+		case change.Remove:
+			fieldRemovals = append(fieldRemovals, change.Field)
+		case change.Field == change.Member:
+			batch.ZAdd(key, change.Member, change.Score)
+		default:
+			entries = append(entries, keyvaluestore.ZHEntry{
+				Field:  change.Field,
+				Member: change.Member,
+				Score:  change.Score,
+			})
+		}
+	}
+	if len(entries) > 0 {
+		batch.ZHMAdd(key, entries)
+	}
+	if batch.Len() > 0 {
+		if err := batch.Exec(); err != nil {
+			return err
+		}
+	}
+	for _, field := range fieldRemovals {
+		if err := b.ZHRem(key, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReconcileSortedSets makes the sorted set or sorted hash at keyB in backend b identical to the one
+// at keyA in backend a via DiffSortedSets and ApplySortedSetChanges. It's intended for repairing
+// derived indexes. It returns the changes that were made.
+//
+// Writes made to either set while it's reconciled may be undone, so the sets shouldn't be modified
+// concurrently.
+func ReconcileSortedSets(a keyvaluestore.Backend, keyA string, b keyvaluestore.Backend, keyB string) ([]*SortedSetChange, error) {
+	changes, err := DiffSortedSets(a, keyA, b, keyB)
+	if err != nil {
+		return nil, err
+	}
+	return changes, ApplySortedSetChanges(b, keyB, changes)
+}
+
+// readSortedSet reads all of the members of a sorted set or sorted hash, indexed by field.
+func readSortedSet(b keyvaluestore.Backend, key string) (map[string]keyvaluestore.SortedSetEntryMember, error) {
+	ret := map[string]keyvaluestore.SortedSetEntryMember{}
+	add := func(field, value string, score float64) {
+		ret[field] = keyvaluestore.SortedSetEntryMember{
+			Field: field,
+			Value: value,
+			Score: score,
+		}
+	}
+
+	if _, ok := b.(keyvaluestore.SortedHashFieldRanger); ok {
+		page, err := keyvaluestore.ZHRangeByScoreWithFields(b, key, math.Inf(-1), math.Inf(1), DefaultPageSize)
+		for err == nil && len(page) > 0 {
+			for _, member := range page {
+				add(member.Field, member.Value, member.Score)
+			}
+			page, err = keyvaluestore.ZHRangeByScoreWithFieldsAfter(b, key, page[len(page)-1].PageToken(), math.Inf(1), DefaultPageSize)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+
+	page, err := b.ZRangeByScoreWithScores(key, math.Inf(-1), math.Inf(1), DefaultPageSize)
+	for err == nil && len(page) > 0 {
+		for _, member := range page {
+			add(member.Value, member.Value, member.Score)
+		}
+		page, err = keyvaluestore.ZRangeByScoreAfter(b, key, page[len(page)-1].PageToken(), math.Inf(1), DefaultPageSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,68 @@
+package keyvaluestorecheck
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestReconcileSortedSets(t *testing.T) {
+	a, b := memorystore.NewBackend(), memorystore.NewBackend()
+	require.NoError(t, a.ZAdd("index", "same", 1))
+	require.NoError(t, a.ZAdd("index", "rescored", 2))
+	require.NoError(t, a.ZAdd("index", "missing", 3))
+	require.NoError(t, a.ZHAdd("index", "f1", "v1", 4))
+	require.NoError(t, a.ZHAdd("index", "f2", "v2", 5))
+
+	require.NoError(t, b.ZAdd("broken", "same", 1))
+	require.NoError(t, b.ZAdd("broken", "rescored", 20))
+	require.NoError(t, b.ZAdd("broken", "extra", 6))
+	require.NoError(t, b.ZHAdd("broken", "f1", "stale", 4))
+	require.NoError(t, b.ZHAdd("broken", "f3", "v3", 7))
+
+	changes, err := DiffSortedSets(a, "index", b, "broken")
+	require.NoError(t, err)
+	assert.Equal(t, []*SortedSetChange{
+		{Field: "extra", Remove: true, Member: "extra", Score: 6},
+		{Field: "f1", Member: "v1", Score: 4},
+		{Field: "f2", Member: "v2", Score: 5},
+		{Field: "f3", Remove: true, Member: "v3", Score: 7},
+		{Field: "missing", Member: "missing", Score: 3},
+		{Field: "rescored", Member: "rescored", Score: 2},
+	}, changes)
+
+	applied, err := ReconcileSortedSets(a, "index", b, "broken")
+	require.NoError(t, err)
+	assert.Equal(t, changes, applied)
+
+	changes, err = DiffSortedSets(a, "index", b, "broken")
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	members, err := keyvaluestore.ZHRangeByScoreWithFields(b, "broken", 0, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"same", "rescored", "missing", "f1", "f2"}, members.Fields())
+	assert.Equal(t, []string{"same", "rescored", "missing", "v1", "v2"}, members.Values())
+}
+
+func TestReconcileSortedSetsOpaque(t *testing.T) {
+	a := memorystore.NewBackend()
+	b := memorystore.NewBackend()
+	for i, member := range []string{"a", "b", "c"} {
+		require.NoError(t, a.ZAdd("foo", member, float64(i)))
+	}
+	require.NoError(t, b.ZAdd("foo", "d", 0))
+
+	// Without fields, members are compared as sorted set members.
+	changes, err := ReconcileSortedSets(&opaqueBackend{a}, "foo", &opaqueBackend{b}, "foo")
+	require.NoError(t, err)
+	assert.Len(t, changes, 4)
+
+	members, err := b.ZRangeByScore("foo", 0, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, members)
+}
@@ -0,0 +1,337 @@
+// Package keyvaluestorechecksum provides a backend wrapper that detects corrupt values, e.g. values
+// that were silently truncated by a misbehaving proxy or client.
+package keyvaluestorechecksum
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Backend appends a CRC32C checksum to values and hash field values before passing them through to
+// the underlying backend, and verifies the checksum when they're read. Values that fail
+// verification result in a *CorruptionError.
+//
+// Integers are stored without checksums so that they can still be used with NIncrBy, and set and
+// sorted set members are stored as-is since they're used for comparisons and ordering. The backend
+// must only be used with data written via the wrapper: pre-existing values are reported as corrupt.
+type Backend struct {
+	Backend keyvaluestore.Backend
+
+	// If Replica is given, corrupt values are read from it instead. It must contain the same data
+	// as Backend, including checksums, e.g. because it's a replica of the same table. If the
+	// replica's value is valid, it's returned, and for plain values it's also written back to
+	// Backend if Backend's value hasn't changed in the meantime. Hash fields aren't written back
+	// since there's no way to do so without risking overwriting a concurrent write.
+	Replica keyvaluestore.Backend
+
+	// OnCorruption is invoked whenever a corrupt value is read, even if it's then repaired from
+	// the replica. It can be used to monitor the rate of corruption.
+	OnCorruption func(err *CorruptionError)
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+
+func (b *Backend) reportCorruption(err *CorruptionError) {
+	if b.OnCorruption != nil {
+		b.OnCorruption(err)
+	}
+}
+
+// verify decodes a value read from the backend, repairing it if necessary.
+func (b *Backend) verify(key string, v *string) (*string, error) {
+	if v == nil {
+		return nil, nil
+	} else if s, ok := decode(*v); ok {
+		return &s, nil
+	}
+
+	corruptionErr := &CorruptionError{
+		Key:   key,
+		Value: *v,
+	}
+	b.reportCorruption(corruptionErr)
+	if b.Replica == nil {
+		return nil, corruptionErr
+	}
+
+	replicaValue, err := b.Replica.Get(key)
+	if err != nil {
+		return nil, err
+	} else if replicaValue == nil {
+		return nil, corruptionErr
+	}
+	s, ok := decode(*replicaValue)
+	if !ok {
+		return nil, corruptionErr
+	}
+
+	// The repair is best-effort. The replica's value is returned either way.
+	b.Backend.SetEQ(key, *replicaValue, *v)
+	return &s, nil
+}
+
+// verifyField decodes a hash field value read from the backend, reading it from the replica if
+// necessary.
+func (b *Backend) verifyField(key, field string, v *string) (*string, error) {
+	if v == nil {
+		return nil, nil
+	} else if s, ok := decode(*v); ok {
+		return &s, nil
+	}
+
+	corruptionErr := &CorruptionError{
+		Key:   key,
+		Field: field,
+		Value: *v,
+	}
+	b.reportCorruption(corruptionErr)
+	if b.Replica == nil {
+		return nil, corruptionErr
+	}
+
+	replicaValue, err := b.Replica.HGet(key, field)
+	if err != nil {
+		return nil, err
+	} else if replicaValue == nil {
+		return nil, corruptionErr
+	}
+	s, ok := decode(*replicaValue)
+	if !ok {
+		return nil, corruptionErr
+	}
+	return &s, nil
+}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return &atomicWriteOperation{
+		atomicWrite: b.Backend.AtomicWrite(),
+	}
+}
+
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	return &batchOperation{
+		backend: b,
+		batch:   b.Backend.Batch(),
+	}
+}
+
+func (b *Backend) Ping() error {
+	return b.Backend.Ping()
+}
+
+// Close closes both the backend and the replica, if any. If both fail, the backend's error is
+// returned.
+func (b *Backend) Close() error {
+	err := b.Backend.Close()
+	if b.Replica != nil {
+		if replicaErr := b.Replica.Close(); err == nil {
+			err = replicaErr
+		}
+	}
+	return err
+}
+
+func (b *Backend) Delete(key string) (bool, error) {
+	return b.Backend.Delete(key)
+}
+
+func (b *Backend) Get(key string) (*string, error) {
+	v, err := b.Backend.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return b.verify(key, v)
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	return b.Backend.Set(key, encode(value))
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	return b.Backend.SetXX(key, encode(value))
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	return b.Backend.SetNX(key, encode(value))
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	return b.Backend.SetEQ(key, encode(value), encode(oldValue))
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	return b.Backend.NIncrBy(key, n)
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	return b.Backend.HSet(key, field, encode(value), encodeFields(fields)...)
+}
+
+func (b *Backend) HGet(key, field string) (*string, error) {
+	v, err := b.Backend.HGet(key, field)
+	if err != nil {
+		return nil, err
+	}
+	return b.verifyField(key, field, v)
+}
+
+func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	m, err := b.Backend.HGetAll(key)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	ret := make(map[string]string, len(m))
+	for field, v := range m {
+		s, err := b.verifyField(key, field, &v)
+		if err != nil {
+			return nil, err
+		}
+		ret[field] = *s
+	}
+	return ret, nil
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	return b.Backend.SAdd(key, member, members...)
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	return b.Backend.SRem(key, member, members...)
+}
+
+func (b *Backend) SMembers(key string) ([]string, error) {
+	return b.Backend.SMembers(key)
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	return b.Backend.HDel(key, field, fields...)
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
+	return b.Backend.ZAdd(key, member, score)
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	return b.Backend.ZScore(key, member)
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	return b.Backend.ZRem(key, member)
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	return b.Backend.ZIncrBy(key, member, n)
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	return b.Backend.ZCount(key, min, max)
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
+	return b.Backend.ZLexCount(key, min, max)
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	return b.Backend.ZHAdd(key, field, member, score)
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	return b.Backend.ZHMAdd(key, entries)
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	return b.Backend.ZHRem(key, field)
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	return b.Backend.ZHRemEQ(key, field, member)
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZHRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZHRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZHRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZHRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZHRevRangeByLex(key, min, max, limit)
+}
+
+func (b Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	b.Backend = b.Backend.WithProfiler(profiler)
+	if b.Replica != nil {
+		b.Replica = b.Replica.WithProfiler(profiler)
+	}
+	return &b
+}
+
+func (b Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	b.Backend = b.Backend.WithEventuallyConsistentReads()
+	if b.Replica != nil {
+		b.Replica = b.Replica.WithEventuallyConsistentReads()
+	}
+	return &b
+}
+
+func (b Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	b.Backend = keyvaluestore.WithOptions(b.Backend, opts)
+	if b.Replica != nil {
+		b.Replica = keyvaluestore.WithOptions(b.Replica, opts)
+	}
+	return &b
+}
+
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return b.Backend
+}
+
+func encodeFields(fields []keyvaluestore.KeyValue) []keyvaluestore.KeyValue {
+	if len(fields) == 0 {
+		return nil
+	}
+	ret := make([]keyvaluestore.KeyValue, len(fields))
+	for i, kv := range fields {
+		ret[i] = keyvaluestore.KeyValue{
+			Key:   kv.Key,
+			Value: encode(kv.Value),
+		}
+	}
+	return ret
+}
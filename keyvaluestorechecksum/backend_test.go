@@ -0,0 +1,130 @@
+package keyvaluestorechecksum
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return &Backend{
+			Backend: memorystore.NewBackend(),
+		}
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return &Backend{
+			Backend: b,
+		}
+	}, keyvaluestoretest.WrapperOptions{})
+}
+
+// truncate simulates corruption by removing the last byte of a stored value.
+func truncate(t *testing.T, b keyvaluestore.Backend, key string) {
+	v, err := b.Get(key)
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	require.NoError(t, b.Set(key, (*v)[:len(*v)-1]))
+}
+
+func TestCorruption(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	var reported []*CorruptionError
+	b := &Backend{
+		Backend: underlying,
+		OnCorruption: func(err *CorruptionError) {
+			reported = append(reported, err)
+		},
+	}
+
+	require.NoError(t, b.Set("foo", "bar"))
+	require.NoError(t, b.Set("n", 100))
+	truncate(t, underlying, "foo")
+
+	_, err := b.Get("foo")
+	var corruptionErr *CorruptionError
+	require.True(t, errors.As(err, &corruptionErr))
+	assert.Equal(t, "foo", corruptionErr.Key)
+	assert.Len(t, reported, 1)
+
+	batch := b.Batch()
+	get := batch.Get("foo")
+	require.NoError(t, batch.Exec())
+	_, err = get.Result()
+	assert.True(t, errors.As(err, &corruptionErr))
+
+	n, err := b.NIncrBy("n", 1)
+	require.NoError(t, err)
+	assert.EqualValues(t, 101, n)
+
+	v, err := b.Get("n")
+	require.NoError(t, err)
+	assert.Equal(t, "101", *v)
+
+	require.NoError(t, b.HSet("h", "a", "x", keyvaluestore.KeyValue{Key: "b", Value: "y"}))
+	require.NoError(t, underlying.HSet("h", "b", "y"))
+
+	v, err = b.HGet("h", "a")
+	require.NoError(t, err)
+	assert.Equal(t, "x", *v)
+
+	_, err = b.HGet("h", "b")
+	require.True(t, errors.As(err, &corruptionErr))
+	assert.Equal(t, "b", corruptionErr.Field)
+
+	_, err = b.HGetAll("h")
+	assert.True(t, errors.As(err, &corruptionErr))
+}
+
+func TestReadRepair(t *testing.T) {
+	primary := memorystore.NewBackend()
+	replica := memorystore.NewBackend()
+	b := &Backend{
+		Backend: primary,
+		Replica: replica,
+	}
+	replicated := &Backend{
+		Backend: replica,
+	}
+
+	for _, backend := range []keyvaluestore.Backend{b, replicated} {
+		require.NoError(t, backend.Set("foo", "bar"))
+		require.NoError(t, backend.HSet("h", "a", "x"))
+	}
+	truncate(t, primary, "foo")
+	require.NoError(t, primary.HSet("h", "a", "x"))
+
+	v, err := b.Get("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", *v)
+
+	v, err = b.Unwrap().Get("foo")
+	require.NoError(t, err)
+	s, ok := decode(*v)
+	assert.True(t, ok)
+	assert.Equal(t, "bar", s)
+
+	v, err = b.HGet("h", "a")
+	require.NoError(t, err)
+	assert.Equal(t, "x", *v)
+
+	m, err := b.HGetAll("h")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "x"}, m)
+
+	// If the replica is also corrupt, the error is returned.
+	truncate(t, primary, "foo")
+	truncate(t, replica, "foo")
+	_, err = b.Get("foo")
+	var corruptionErr *CorruptionError
+	assert.True(t, errors.As(err, &corruptionErr))
+}
@@ -0,0 +1,90 @@
+package keyvaluestorechecksum
+
+import "github.com/ccbrown/keyvaluestore"
+
+type batchOperation struct {
+	backend *Backend
+	batch   keyvaluestore.BatchOperation
+}
+
+type getResult struct {
+	backend *Backend
+	key     string
+	result  keyvaluestore.GetResult
+}
+
+func (r *getResult) Result() (*string, error) {
+	v, err := r.result.Result()
+	if err != nil {
+		return nil, err
+	}
+	return r.backend.verify(r.key, v)
+}
+
+func (op *batchOperation) Get(key string) keyvaluestore.GetResult {
+	return &getResult{
+		backend: op.backend,
+		key:     key,
+		result:  op.batch.Get(key),
+	}
+}
+
+func (op *batchOperation) Delete(key string) keyvaluestore.ErrorResult {
+	return op.batch.Delete(key)
+}
+
+func (op *batchOperation) Set(key string, value interface{}) keyvaluestore.ErrorResult {
+	return op.batch.Set(key, encode(value))
+}
+
+func (op *batchOperation) SMembers(key string) keyvaluestore.SMembersResult {
+	return op.batch.SMembers(key)
+}
+
+func (op *batchOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	return op.batch.SAdd(key, member, members...)
+}
+
+func (op *batchOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	return op.batch.SRem(key, member, members...)
+}
+
+func (op *batchOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.ErrorResult {
+	return op.batch.ZAdd(key, member, score)
+}
+
+func (op *batchOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.ErrorResult {
+	return op.batch.ZHMAdd(key, entries)
+}
+
+func (op *batchOperation) ZRem(key string, member interface{}) keyvaluestore.ErrorResult {
+	return op.batch.ZRem(key, member)
+}
+
+func (op *batchOperation) ZScore(key string, member interface{}) keyvaluestore.ZScoreResult {
+	return op.batch.ZScore(key, member)
+}
+
+func (op *batchOperation) ZHRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRangeByScore(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRangeByLex(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRevRangeByLex(key, min, max, limit)
+}
+
+func (op *batchOperation) Len() int {
+	return op.batch.Len()
+}
+
+func (op *batchOperation) Exec() error {
+	return op.batch.Exec()
+}
@@ -0,0 +1,70 @@
+package keyvaluestorechecksum
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strconv"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// checksumLength is the length of the hex-encoded CRC32C appended to each value.
+const checksumLength = 8
+
+func checksum(s string) string {
+	return fmt.Sprintf("%08x", crc32.Checksum([]byte(s), castagnoli))
+}
+
+// isInteger returns true if s is the canonical representation of an int64. Integers are stored
+// without checksums so that they remain usable as counters by NIncrBy.
+func isInteger(s string) bool {
+	n, err := strconv.ParseInt(s, 10, 64)
+	return err == nil && strconv.FormatInt(n, 10) == s
+}
+
+// encode converts a value to the string stored for it. Values that can't be converted are returned
+// as-is so that the underlying backend can reject them.
+func encode(v interface{}) interface{} {
+	s := keyvaluestore.ToString(v)
+	if s == nil {
+		return v
+	} else if isInteger(*s) {
+		return *s
+	}
+	return *s + checksum(*s)
+}
+
+// decode verifies a stored value and strips its checksum. It returns false if the value is corrupt.
+func decode(s string) (string, bool) {
+	if len(s) >= checksumLength {
+		value, sum := s[:len(s)-checksumLength], s[len(s)-checksumLength:]
+		if checksum(value) == sum {
+			return value, true
+		}
+	}
+	if isInteger(s) {
+		return s, true
+	}
+	return "", false
+}
+
+// CorruptionError is returned when a stored value doesn't match its checksum, e.g. because it was
+// truncated. It's only returned if the value couldn't be repaired from the replica.
+type CorruptionError struct {
+	Key string
+
+	// Field is the hash field that's corrupt, if any.
+	Field string
+
+	// Value is the corrupt value as it's stored, including the checksum if it's still present.
+	Value string
+}
+
+func (e *CorruptionError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("checksum mismatch for key %v field %v", e.Key, e.Field)
+	}
+	return fmt.Sprintf("checksum mismatch for key %v", e.Key)
+}
@@ -0,0 +1,147 @@
+// Package keyvaluestorecombine reduces the write load of hot counters by merging concurrent
+// increments of the same key.
+package keyvaluestorecombine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// DefaultInterval is the interval used by combiners that don't specify one.
+const DefaultInterval = 10 * time.Millisecond
+
+// Combiner merges concurrent NIncrBy and ZIncrBy calls for the same key (and member) into a single
+// backend operation. The first increment of a key waits for Interval, and any increments of the
+// key that arrive in the meantime are added to it. Once the combined increment is applied, all of
+// the calls return.
+//
+// This trades up to Interval of latency for far fewer writes to hot keys, which is especially
+// useful for backends such as DynamoDB that throttle frequently written items. Increments are
+// only combined within a process, so each process using the same key still makes its own writes.
+//
+// Each call returns the value the key would have had if the combined increments had been applied
+// one at a time in the order they arrived, so values returned by concurrent NIncrBy calls remain
+// unique. If the combined increment fails, all of its calls return the error.
+type Combiner struct {
+	Backend keyvaluestore.Backend
+
+	// Interval is how long increments are collected before they're applied. If zero,
+	// DefaultInterval is used.
+	Interval time.Duration
+
+	mutex   sync.Mutex
+	nIncrs  map[string]*nIncr
+	zIncrs  map[zIncrKey]*zIncr
+	sleepFn func(time.Duration)
+}
+
+type nIncr struct {
+	n      int64
+	result int64
+	err    error
+	done   chan struct{}
+}
+
+type zIncrKey struct {
+	key    string
+	member string
+}
+
+type zIncr struct {
+	n      float64
+	result float64
+	err    error
+	done   chan struct{}
+}
+
+func (c *Combiner) sleep() {
+	d := c.Interval
+	if d <= 0 {
+		d = DefaultInterval
+	}
+	if c.sleepFn != nil {
+		c.sleepFn(d)
+	} else {
+		time.Sleep(d)
+	}
+}
+
+// NIncrBy increments the integer at the given key. See Backend.NIncrBy.
+func (c *Combiner) NIncrBy(key string, n int64) (int64, error) {
+	c.mutex.Lock()
+	if c.nIncrs == nil {
+		c.nIncrs = make(map[string]*nIncr)
+	}
+	incr, ok := c.nIncrs[key]
+	if !ok {
+		incr = &nIncr{
+			done: make(chan struct{}),
+		}
+		c.nIncrs[key] = incr
+	}
+	incr.n += n
+	cumulative := incr.n
+	c.mutex.Unlock()
+
+	if ok {
+		<-incr.done
+	} else {
+		c.sleep()
+
+		// Once the increment is removed from the map, it can no longer be added to.
+		c.mutex.Lock()
+		delete(c.nIncrs, key)
+		c.mutex.Unlock()
+
+		incr.result, incr.err = c.Backend.NIncrBy(key, incr.n)
+		close(incr.done)
+	}
+
+	if incr.err != nil {
+		return 0, incr.err
+	}
+	return incr.result - (incr.n - cumulative), nil
+}
+
+// ZIncrBy increments the score of the given sorted set member. See Backend.ZIncrBy.
+func (c *Combiner) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	k := zIncrKey{
+		key:    key,
+		member: *keyvaluestore.ToString(member),
+	}
+
+	c.mutex.Lock()
+	if c.zIncrs == nil {
+		c.zIncrs = make(map[zIncrKey]*zIncr)
+	}
+	incr, ok := c.zIncrs[k]
+	if !ok {
+		incr = &zIncr{
+			done: make(chan struct{}),
+		}
+		c.zIncrs[k] = incr
+	}
+	incr.n += n
+	cumulative := incr.n
+	c.mutex.Unlock()
+
+	if ok {
+		<-incr.done
+	} else {
+		c.sleep()
+
+		c.mutex.Lock()
+		delete(c.zIncrs, k)
+		c.mutex.Unlock()
+
+		incr.result, incr.err = c.Backend.ZIncrBy(key, k.member, incr.n)
+		close(incr.done)
+	}
+
+	if incr.err != nil {
+		return 0, incr.err
+	}
+	return incr.result - (incr.n - cumulative), nil
+}
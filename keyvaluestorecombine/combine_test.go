@@ -0,0 +1,125 @@
+package keyvaluestorecombine
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/keyvaluestoremock"
+)
+
+// newTestCombiner returns a combiner whose intervals don't end until release is closed.
+func newTestCombiner(mock *keyvaluestoremock.Backend) (*Combiner, chan struct{}) {
+	release := make(chan struct{})
+	return &Combiner{
+		Backend: mock,
+		sleepFn: func(time.Duration) {
+			<-release
+		},
+	}, release
+}
+
+// pending returns the number of increments that are waiting to be applied.
+func (c *Combiner) pending() (n int64, z float64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, incr := range c.nIncrs {
+		n += incr.n
+	}
+	for _, incr := range c.zIncrs {
+		z += incr.n
+	}
+	return n, z
+}
+
+func waitForPending(t *testing.T, c *Combiner, n int64, z float64) {
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(time.Millisecond) {
+		if pn, pz := c.pending(); pn == n && pz == z {
+			return
+		}
+		require.True(t, time.Now().Before(deadline), "timed out waiting for increments")
+	}
+}
+
+func TestNIncrBy(t *testing.T) {
+	mock := &keyvaluestoremock.Backend{}
+	c, release := newTestCombiner(mock)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var results []int
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := c.NIncrBy("foo", 1)
+			assert.NoError(t, err)
+			mutex.Lock()
+			results = append(results, int(n))
+			mutex.Unlock()
+		}()
+	}
+	waitForPending(t, c, 10, 0)
+	close(release)
+	wg.Wait()
+
+	// Each caller gets a distinct value, as if the increments had been applied individually.
+	sort.Ints(results)
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, results)
+	assert.Len(t, mock.CallsTo("NIncrBy"), 1)
+
+	// Subsequent increments start a new interval.
+	n, err := c.NIncrBy("foo", 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), n)
+	assert.Len(t, mock.CallsTo("NIncrBy"), 2)
+}
+
+func TestZIncrBy(t *testing.T) {
+	mock := &keyvaluestoremock.Backend{}
+	c, release := newTestCombiner(mock)
+
+	var wg sync.WaitGroup
+	for _, member := range []string{"a", "a", "b"} {
+		member := member
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.ZIncrBy("foo", member, 1.5)
+			assert.NoError(t, err)
+		}()
+	}
+	waitForPending(t, c, 0, 4.5)
+	close(release)
+	wg.Wait()
+
+	assert.Len(t, mock.CallsTo("ZIncrBy"), 2)
+	score, err := mock.ZScore("foo", "a")
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, *score)
+}
+
+func TestErrors(t *testing.T) {
+	mock := &keyvaluestoremock.Backend{}
+	c, release := newTestCombiner(mock)
+	errFoo := errors.New("foo")
+	mock.SetError("NIncrBy", errFoo)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.NIncrBy("foo", 1)
+			assert.Equal(t, errFoo, err)
+		}()
+	}
+	waitForPending(t, c, 2, 0)
+	close(release)
+	wg.Wait()
+}
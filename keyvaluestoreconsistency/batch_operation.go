@@ -0,0 +1,125 @@
+package keyvaluestoreconsistency
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// batchOperation sends writes and reads of recently written keys to a strongly consistent batch and
+// all other reads to an eventually consistent batch. Each is only created if it's needed.
+type batchOperation struct {
+	session    *Session
+	consistent keyvaluestore.BatchOperation
+	eventual   keyvaluestore.BatchOperation
+
+	// written contains the keys written by the batch, which aren't recorded by the session until
+	// the batch is executed.
+	written map[string]struct{}
+}
+
+func (op *batchOperation) write(key string) keyvaluestore.BatchOperation {
+	if op.written == nil {
+		op.written = map[string]struct{}{}
+	}
+	op.written[key] = struct{}{}
+	return op.writer()
+}
+
+func (op *batchOperation) writer() keyvaluestore.BatchOperation {
+	if op.consistent == nil {
+		op.consistent = op.session.writer.Batch()
+	}
+	return op.consistent
+}
+
+func (op *batchOperation) reader(key string) keyvaluestore.BatchOperation {
+	if _, ok := op.written[key]; ok || op.session.recentlyWritten(key) {
+		return op.writer()
+	}
+	if op.eventual == nil {
+		op.eventual = op.session.eventual.Batch()
+	}
+	return op.eventual
+}
+
+func (op *batchOperation) Get(key string) keyvaluestore.GetResult {
+	return op.reader(key).Get(key)
+}
+
+func (op *batchOperation) Delete(key string) keyvaluestore.ErrorResult {
+	return op.write(key).Delete(key)
+}
+
+func (op *batchOperation) Set(key string, value interface{}) keyvaluestore.ErrorResult {
+	return op.write(key).Set(key, value)
+}
+
+func (op *batchOperation) SMembers(key string) keyvaluestore.SMembersResult {
+	return op.reader(key).SMembers(key)
+}
+
+func (op *batchOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	return op.write(key).SAdd(key, member, members...)
+}
+
+func (op *batchOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	return op.write(key).SRem(key, member, members...)
+}
+
+func (op *batchOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.ErrorResult {
+	return op.write(key).ZAdd(key, member, score)
+}
+
+func (op *batchOperation) ZRem(key string, member interface{}) keyvaluestore.ErrorResult {
+	return op.write(key).ZRem(key, member)
+}
+
+func (op *batchOperation) ZScore(key string, member interface{}) keyvaluestore.ZScoreResult {
+	return op.reader(key).ZScore(key, member)
+}
+
+func (op *batchOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.ErrorResult {
+	return op.write(key).ZHMAdd(key, entries)
+}
+
+func (op *batchOperation) ZHRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.reader(key).ZHRangeByScore(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.reader(key).ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.reader(key).ZHRangeByLex(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.reader(key).ZHRevRangeByLex(key, min, max, limit)
+}
+
+func (op *batchOperation) Len() int {
+	n := 0
+	if op.consistent != nil {
+		n += op.consistent.Len()
+	}
+	if op.eventual != nil {
+		n += op.eventual.Len()
+	}
+	return n
+}
+
+// Exec executes the strongly consistent batch before the eventually consistent one.
+func (op *batchOperation) Exec() error {
+	var errs []error
+	for _, batch := range []keyvaluestore.BatchOperation{op.consistent, op.eventual} {
+		if batch == nil {
+			continue
+		}
+		err := batch.Exec()
+		if _, ok := err.(*keyvaluestore.BatchError); err != nil && !ok {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	return keyvaluestore.JoinBatchErrors(errs...)
+}
@@ -0,0 +1,305 @@
+// Package keyvaluestoreconsistency provides read-your-writes consistency on top of eventually
+// consistent reads.
+package keyvaluestoreconsistency
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreinvalidator"
+)
+
+// DefaultWindow is the consistency window used by sessions that don't specify one.
+const DefaultWindow = 5 * time.Second
+
+// Session passes operations through to an underlying backend, making reads eventually consistent
+// unless they're for keys that the session wrote within the last Window. This gives most of the
+// cost savings of eventually consistent reads without read-your-writes anomalies.
+//
+// Writes are recorded in the session's WriteToken, which can be carried over to later sessions,
+// e.g. those of the same client's next request, via NewSession.
+type Session struct {
+	// Window is how long after a write the session's reads of the key remain strongly consistent.
+	// It should comfortably exceed the backend's replication lag. If zero, DefaultWindow is used.
+	Window time.Duration
+
+	// Clock is used to get the current time. If nil, the wall clock is used.
+	Clock keyvaluestore.Clock
+
+	backend  keyvaluestore.Backend
+	eventual keyvaluestore.Backend
+	writer   *keyvaluestoreinvalidator.Invalidator
+	log      *writeLog
+}
+
+type writeLog struct {
+	mutex  sync.Mutex
+	writes WriteToken
+}
+
+var _ keyvaluestore.Backend = &Session{}
+
+// NewSession creates a session for the given backend, which must support strongly consistent reads.
+// If token is non-nil, the session's reads also observe the writes recorded in it.
+func NewSession(backend keyvaluestore.Backend, token WriteToken) *Session {
+	s := &Session{
+		log: &writeLog{
+			writes: WriteToken{},
+		},
+	}
+	s.setBackend(backend)
+	s.AddWriteToken(token)
+	return s
+}
+
+func (s *Session) setBackend(backend keyvaluestore.Backend) {
+	s.backend = backend
+	s.eventual = backend.WithEventuallyConsistentReads()
+	s.writer = &keyvaluestoreinvalidator.Invalidator{
+		Backend:        backend,
+		Invalidate:     func(key string) { s.recordWrites([]string{key}) },
+		InvalidateMany: s.recordWrites,
+	}
+}
+
+func (s *Session) window() time.Duration {
+	if s.Window > 0 {
+		return s.Window
+	}
+	return DefaultWindow
+}
+
+func (s *Session) recordWrites(keys []string) {
+	now := keyvaluestore.Now(s.Clock)
+	s.log.mutex.Lock()
+	defer s.log.mutex.Unlock()
+	for _, key := range keys {
+		s.log.writes[key] = now
+	}
+}
+
+// WriteToken returns the keys that the session has written within the last Window, including
+// those of any tokens given to NewSession or AddWriteToken.
+func (s *Session) WriteToken() WriteToken {
+	cutoff := keyvaluestore.Now(s.Clock).Add(-s.window())
+	s.log.mutex.Lock()
+	defer s.log.mutex.Unlock()
+	ret := WriteToken{}
+	for key, at := range s.log.writes {
+		if at.After(cutoff) {
+			ret[key] = at
+		} else {
+			delete(s.log.writes, key)
+		}
+	}
+	return ret
+}
+
+// AddWriteToken makes the session's reads observe the writes recorded in the given token.
+func (s *Session) AddWriteToken(token WriteToken) {
+	s.log.mutex.Lock()
+	defer s.log.mutex.Unlock()
+	for key, at := range token {
+		if prev, ok := s.log.writes[key]; !ok || at.After(prev) {
+			s.log.writes[key] = at
+		}
+	}
+}
+
+func (s *Session) recentlyWritten(key string) bool {
+	cutoff := keyvaluestore.Now(s.Clock).Add(-s.window())
+	s.log.mutex.Lock()
+	defer s.log.mutex.Unlock()
+	at, ok := s.log.writes[key]
+	return ok && at.After(cutoff)
+}
+
+// reader returns the backend that should be used to read the given key.
+func (s *Session) reader(key string) keyvaluestore.Backend {
+	if s.recentlyWritten(key) {
+		return s.backend
+	}
+	return s.eventual
+}
+
+func (s *Session) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return s.writer.AtomicWrite()
+}
+
+// Batch returns a batch whose reads are routed in the same way as the session's. If necessary, it's
+// split into a strongly consistent batch and an eventually consistent batch.
+func (s *Session) Batch() keyvaluestore.BatchOperation {
+	return &batchOperation{
+		session: s,
+	}
+}
+
+func (s *Session) Ping() error {
+	return s.backend.Ping()
+}
+
+func (s *Session) Close() error {
+	return s.backend.Close()
+}
+
+func (s *Session) Delete(key string) (bool, error) {
+	return s.writer.Delete(key)
+}
+
+func (s *Session) Get(key string) (*string, error) {
+	return s.reader(key).Get(key)
+}
+
+func (s *Session) Set(key string, value interface{}) error {
+	return s.writer.Set(key, value)
+}
+
+func (s *Session) SetXX(key string, value interface{}) (bool, error) {
+	return s.writer.SetXX(key, value)
+}
+
+func (s *Session) SetNX(key string, value interface{}) (bool, error) {
+	return s.writer.SetNX(key, value)
+}
+
+func (s *Session) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	return s.writer.SetEQ(key, value, oldValue)
+}
+
+func (s *Session) NIncrBy(key string, n int64) (int64, error) {
+	return s.writer.NIncrBy(key, n)
+}
+
+func (s *Session) SAdd(key string, member interface{}, members ...interface{}) error {
+	return s.writer.SAdd(key, member, members...)
+}
+
+func (s *Session) SRem(key string, member interface{}, members ...interface{}) error {
+	return s.writer.SRem(key, member, members...)
+}
+
+func (s *Session) SMembers(key string) ([]string, error) {
+	return s.reader(key).SMembers(key)
+}
+
+func (s *Session) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	return s.writer.HSet(key, field, value, fields...)
+}
+
+func (s *Session) HDel(key, field string, fields ...string) error {
+	return s.writer.HDel(key, field, fields...)
+}
+
+func (s *Session) HGet(key, field string) (*string, error) {
+	return s.reader(key).HGet(key, field)
+}
+
+func (s *Session) HGetAll(key string) (map[string]string, error) {
+	return s.reader(key).HGetAll(key)
+}
+
+func (s *Session) ZAdd(key string, member interface{}, score float64) error {
+	return s.writer.ZAdd(key, member, score)
+}
+
+func (s *Session) ZScore(key string, member interface{}) (*float64, error) {
+	return s.reader(key).ZScore(key, member)
+}
+
+func (s *Session) ZRem(key string, member interface{}) error {
+	return s.writer.ZRem(key, member)
+}
+
+func (s *Session) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	return s.writer.ZIncrBy(key, member, n)
+}
+
+func (s *Session) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return s.reader(key).ZRangeByScore(key, min, max, limit)
+}
+
+func (s *Session) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return s.reader(key).ZRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (s *Session) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return s.reader(key).ZRevRangeByScore(key, min, max, limit)
+}
+
+func (s *Session) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return s.reader(key).ZRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (s *Session) ZCount(key string, min, max float64) (int, error) {
+	return s.reader(key).ZCount(key, min, max)
+}
+
+func (s *Session) ZLexCount(key string, min, max string) (int, error) {
+	return s.reader(key).ZLexCount(key, min, max)
+}
+
+func (s *Session) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return s.reader(key).ZRangeByLex(key, min, max, limit)
+}
+
+func (s *Session) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return s.reader(key).ZRevRangeByLex(key, min, max, limit)
+}
+
+func (s *Session) ZHAdd(key, field string, member interface{}, score float64) error {
+	return s.writer.ZHAdd(key, field, member, score)
+}
+
+func (s *Session) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	return s.writer.ZHMAdd(key, entries)
+}
+
+func (s *Session) ZHRem(key, field string) error {
+	return s.writer.ZHRem(key, field)
+}
+
+func (s *Session) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	return s.writer.ZHRemEQ(key, field, member)
+}
+
+func (s *Session) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return s.reader(key).ZHRangeByScore(key, min, max, limit)
+}
+
+func (s *Session) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return s.reader(key).ZHRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (s *Session) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return s.reader(key).ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (s *Session) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return s.reader(key).ZHRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (s *Session) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return s.reader(key).ZHRangeByLex(key, min, max, limit)
+}
+
+func (s *Session) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return s.reader(key).ZHRevRangeByLex(key, min, max, limit)
+}
+
+// WithEventuallyConsistentReads returns a session whose reads are all eventually consistent. Its
+// writes are still recorded in the receiver's WriteToken.
+func (s Session) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	s.setBackend(s.backend.WithEventuallyConsistentReads())
+	return &s
+}
+
+// WithProfiler returns a session that shares the receiver's WriteToken.
+func (s Session) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	s.setBackend(s.backend.WithProfiler(profiler))
+	return &s
+}
+
+func (s *Session) Unwrap() keyvaluestore.Backend {
+	return s.backend
+}
@@ -0,0 +1,117 @@
+package keyvaluestoreconsistency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return NewSession(memorystore.NewBackend(), nil)
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return NewSession(b, nil)
+	}, keyvaluestoretest.WrapperOptions{})
+}
+
+// laggingBackend serves eventually consistent reads from a replica that never receives writes.
+type laggingBackend struct {
+	keyvaluestore.Backend
+	replica keyvaluestore.Backend
+}
+
+func (b *laggingBackend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	return b.replica
+}
+
+func TestSession(t *testing.T) {
+	b := &laggingBackend{
+		Backend: memorystore.NewBackend(),
+		replica: memorystore.NewBackend(),
+	}
+	require.NoError(t, b.Set("theirs", "x"))
+
+	now := time.Unix(1600000000, 0)
+	clock := keyvaluestore.ClockFunc(func() time.Time {
+		return now
+	})
+	s := NewSession(b, nil)
+	s.Clock = clock
+
+	require.NoError(t, s.Set("mine", "x"))
+	v, err := s.Get("mine")
+	require.NoError(t, err)
+	assert.NotNil(t, v, "the session's own writes should be read consistently")
+
+	v, err = s.Get("theirs")
+	require.NoError(t, err)
+	assert.Nil(t, v, "other keys should be read from the replica")
+
+	t.Run("Batch", func(t *testing.T) {
+		batch := s.Batch()
+		batch.Set("batched", "x")
+		batched := batch.Get("batched")
+		mine := batch.Get("mine")
+		theirs := batch.Get("theirs")
+		require.NoError(t, batch.Exec())
+		assert.Equal(t, 4, batch.Len())
+
+		v, err := batched.Result()
+		require.NoError(t, err)
+		assert.NotNil(t, v)
+		v, err = mine.Result()
+		require.NoError(t, err)
+		assert.NotNil(t, v)
+		v, err = theirs.Result()
+		require.NoError(t, err)
+		assert.Nil(t, v)
+	})
+
+	t.Run("AtomicWrite", func(t *testing.T) {
+		tx := s.AtomicWrite()
+		tx.Set("atomic", "x")
+		_, err := tx.Exec()
+		require.NoError(t, err)
+
+		v, err := s.Get("atomic")
+		require.NoError(t, err)
+		assert.NotNil(t, v)
+	})
+
+	t.Run("Token", func(t *testing.T) {
+		token, err := ParseWriteToken(s.WriteToken().String())
+		require.NoError(t, err)
+		assert.Len(t, token, 3)
+
+		resumed := NewSession(b, token)
+		resumed.Clock = clock
+		v, err := resumed.Get("mine")
+		require.NoError(t, err)
+		assert.NotNil(t, v)
+	})
+
+	now = now.Add(DefaultWindow)
+	v, err = s.Get("mine")
+	require.NoError(t, err)
+	assert.Nil(t, v, "reads should be eventually consistent once the window has passed")
+	assert.Empty(t, s.WriteToken())
+}
+
+func TestParseWriteToken(t *testing.T) {
+	token, err := ParseWriteToken("")
+	require.NoError(t, err)
+	assert.Empty(t, token)
+
+	_, err = ParseWriteToken("!")
+	assert.Error(t, err)
+}
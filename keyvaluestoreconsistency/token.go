@@ -0,0 +1,44 @@
+package keyvaluestoreconsistency
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// WriteToken records when a session last wrote each key. Tokens can be passed between requests,
+// e.g. in a cookie, via String and ParseWriteToken so that a client's subsequent requests observe
+// its writes.
+type WriteToken map[string]time.Time
+
+// String encodes the token in a URL-safe format.
+func (t WriteToken) String() string {
+	writes := make(map[string]int64, len(t))
+	for key, at := range t {
+		writes[key] = at.UnixNano()
+	}
+	buf, _ := json.Marshal(writes)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// ParseWriteToken decodes a token encoded via WriteToken.String. An empty string is decoded as an
+// empty token.
+func ParseWriteToken(s string) (WriteToken, error) {
+	ret := WriteToken{}
+	if s == "" {
+		return ret, nil
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed write token: %w", err)
+	}
+	var writes map[string]int64
+	if err := json.Unmarshal(buf, &writes); err != nil {
+		return nil, fmt.Errorf("malformed write token: %w", err)
+	}
+	for key, at := range writes {
+		ret[key] = time.Unix(0, at)
+	}
+	return ret, nil
+}
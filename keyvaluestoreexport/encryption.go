@@ -0,0 +1,276 @@
+package keyvaluestoreexport
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KeyManager provides the data keys that encrypt exports. Each export is encrypted with a new data
+// key, and the data key is stored in the export in encrypted form, so only holders of the key that
+// encrypts data keys can restore it. KMSKeyManager implements it using AWS KMS.
+type KeyManager interface {
+	// GenerateDataKey returns a new 256-bit key along with an encrypted copy of it.
+	GenerateDataKey() (plaintext, encrypted []byte, err error)
+
+	// DecryptDataKey decrypts a key returned by GenerateDataKey.
+	DecryptDataKey(encrypted []byte) ([]byte, error)
+}
+
+// encryptionMagic begins every encrypted stream. Its first four bytes are larger than any chunk
+// length, so a new stream can always be distinguished from the next chunk of the previous one.
+var encryptionMagic = []byte("KVSENC\x00\x01")
+
+// encryptionChunkSize is the maximum amount of plaintext in each chunk.
+const encryptionChunkSize = 64 * 1024
+
+// IsEncrypted returns true if the given data, such as the first 8 bytes of a file, begins with an
+// encrypted stream written by an EncryptedWriter.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptionMagic)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("data keys must be 256 bits")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce for a chunk. Every stream has its own data key, so the chunk's index
+// is unique. The final chunk is marked so that truncated streams can be detected.
+func chunkNonce(index uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], index)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// EncryptedWriter encrypts data written to it with AES-256-GCM. It can be given to NewJSONWriter or
+// NewBinaryWriter to encrypt exports at rest:
+//
+//	encrypted, err := keyvaluestoreexport.NewEncryptedWriter(file, keyManager)
+//	writer := keyvaluestoreexport.NewJSONWriter(encrypted)
+//	// export to the writer, then close the encrypted writer
+//
+// The stream begins with a header containing the encrypted data key, followed by chunks of up to
+// 64KB of plaintext, each of which is prefixed by its length as a big-endian uint32. Chunks are
+// authenticated along with their positions, so a stream can't be reordered or truncated without
+// detection.
+type EncryptedWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	chunks uint64
+	buf    []byte
+	closed bool
+}
+
+// NewEncryptedWriter writes a header with a new data key to w and returns a writer that encrypts
+// data with it. The writer must be closed once all data is written, or the stream will appear to
+// be truncated.
+func NewEncryptedWriter(w io.Writer, keys KeyManager) (*EncryptedWriter, error) {
+	key, encryptedKey, err := keys.GenerateDataKey()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate data key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(encryptionMagic)+4+len(encryptedKey))
+	header = append(header, encryptionMagic...)
+	header = append(header, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(header[len(encryptionMagic):], uint32(len(encryptedKey)))
+	header = append(header, encryptedKey...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &EncryptedWriter{
+		w:    w,
+		aead: aead,
+	}, nil
+}
+
+func (w *EncryptedWriter) writeChunk(plaintext []byte, final bool) error {
+	sealed := w.aead.Seal(make([]byte, 4, 4+len(plaintext)+w.aead.Overhead()), chunkNonce(w.chunks, final), plaintext, nil)
+	binary.BigEndian.PutUint32(sealed, uint32(len(sealed)-4))
+	w.chunks++
+	_, err := w.w.Write(sealed)
+	return err
+}
+
+func (w *EncryptedWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("write to closed encrypted writer")
+	}
+	w.buf = append(w.buf, p...)
+	// The last chunk is kept buffered since it might be the final one.
+	for len(w.buf) > encryptionChunkSize {
+		if err := w.writeChunk(w.buf[:encryptionChunkSize], false); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[encryptionChunkSize:]
+	}
+	return len(p), nil
+}
+
+// Flush encrypts any buffered data and writes it to the underlying writer. Writers created by
+// NewJSONWriter and NewBinaryWriter invoke it when they're flushed, so checkpointed exports can be
+// resumed. A resumed export appends a new stream with a new data key, which EncryptedReader reads
+// as a continuation of the previous one.
+func (w *EncryptedWriter) Flush() error {
+	if len(w.buf) == 0 || w.closed {
+		return nil
+	}
+	if err := w.writeChunk(w.buf, false); err != nil {
+		return err
+	}
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close writes the final chunk. It doesn't close the underlying writer.
+func (w *EncryptedWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.writeChunk(w.buf, true)
+}
+
+// EncryptedReader decrypts streams written by EncryptedWriter.
+type EncryptedReader struct {
+	r    *bufio.Reader
+	keys KeyManager
+
+	aead   cipher.AEAD
+	chunks uint64
+	final  bool
+
+	buf []byte
+	err error
+}
+
+// NewEncryptedReader returns a reader that decrypts r. It can be given to NewJSONReader or
+// NewBinaryReader. If r contains multiple concatenated streams, such as those of a resumed export,
+// they're decrypted in order.
+func NewEncryptedReader(r io.Reader, keys KeyManager) *EncryptedReader {
+	return &EncryptedReader{
+		r:    bufio.NewReader(r),
+		keys: keys,
+	}
+}
+
+var errEncryptedStreamTruncated = errors.New("encrypted stream is truncated")
+
+func (r *EncryptedReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// next reads the next header or chunk.
+func (r *EncryptedReader) next() error {
+	prefix, err := r.r.Peek(len(encryptionMagic))
+	if len(prefix) == 0 && err == io.EOF {
+		switch {
+		case r.aead == nil:
+			return fmt.Errorf("missing encryption header")
+		case !r.final:
+			return errEncryptedStreamTruncated
+		}
+		return io.EOF
+	} else if err != nil && err != io.EOF {
+		return err
+	}
+
+	if IsEncrypted(prefix) {
+		return r.readHeader()
+	} else if r.aead == nil {
+		return fmt.Errorf("data is not encrypted")
+	} else if r.final {
+		return fmt.Errorf("unexpected data after the end of the encrypted stream")
+	}
+	return r.readChunk()
+}
+
+func (r *EncryptedReader) readHeader() error {
+	header := make([]byte, len(encryptionMagic)+4)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		return unexpectedEOF(err)
+	}
+	n := binary.BigEndian.Uint32(header[len(encryptionMagic):])
+	if n > encryptionChunkSize {
+		return fmt.Errorf("invalid encrypted data key length: %v", n)
+	}
+	encryptedKey := make([]byte, n)
+	if _, err := io.ReadFull(r.r, encryptedKey); err != nil {
+		return unexpectedEOF(err)
+	}
+	key, err := r.keys.DecryptDataKey(encryptedKey)
+	if err != nil {
+		return fmt.Errorf("unable to decrypt data key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	r.aead = aead
+	r.chunks = 0
+	r.final = false
+	return nil
+}
+
+func (r *EncryptedReader) readChunk() error {
+	var length [4]byte
+	if _, err := io.ReadFull(r.r, length[:]); err != nil {
+		return unexpectedEOF(err)
+	}
+	n := int(binary.BigEndian.Uint32(length[:]))
+	if n > encryptionChunkSize+r.aead.Overhead() {
+		return fmt.Errorf("invalid encrypted chunk length: %v", n)
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(r.r, sealed); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	// The chunk is either the final chunk or not, so it's authentic if either nonce works.
+	plaintext, err := r.aead.Open(nil, chunkNonce(r.chunks, false), sealed, nil)
+	if err != nil {
+		plaintext, err = r.aead.Open(nil, chunkNonce(r.chunks, true), sealed, nil)
+		if err != nil {
+			return fmt.Errorf("unable to decrypt chunk %v: %w", r.chunks, err)
+		}
+		r.final = true
+	}
+	r.chunks++
+	r.buf = plaintext
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errEncryptedStreamTruncated
+	}
+	return err
+}
@@ -0,0 +1,204 @@
+package keyvaluestoreexport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+// testKeyManager "encrypts" data keys by reversing them.
+type testKeyManager struct {
+	err error
+}
+
+func reversed(b []byte) []byte {
+	ret := make([]byte, len(b))
+	for i, c := range b {
+		ret[len(b)-1-i] = c
+	}
+	return ret
+}
+
+func (m *testKeyManager) GenerateDataKey() ([]byte, []byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	return key, reversed(key), nil
+}
+
+func (m *testKeyManager) DecryptDataKey(encrypted []byte) ([]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return reversed(encrypted), nil
+}
+
+func encrypt(t *testing.T, plaintext string) []byte {
+	var buf bytes.Buffer
+	w, err := NewEncryptedWriter(&buf, &testKeyManager{})
+	require.NoError(t, err)
+	_, err = io.WriteString(w, plaintext)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func decrypt(data []byte, keys KeyManager) (string, error) {
+	buf, err := ioutil.ReadAll(NewEncryptedReader(bytes.NewReader(data), keys))
+	return string(buf), err
+}
+
+func TestEncryption(t *testing.T) {
+	for name, plaintext := range map[string]string{
+		"Empty":     "",
+		"Short":     "foo",
+		"OneChunk":  strings.Repeat("x", encryptionChunkSize),
+		"ManyChunk": strings.Repeat("abc", encryptionChunkSize),
+	} {
+		t.Run(name, func(t *testing.T) {
+			encrypted := encrypt(t, plaintext)
+			assert.True(t, IsEncrypted(encrypted))
+			if plaintext != "" {
+				assert.False(t, bytes.Contains(encrypted, []byte(plaintext[:3])))
+			}
+
+			decrypted, err := decrypt(encrypted, &testKeyManager{})
+			require.NoError(t, err)
+			assert.Equal(t, plaintext, decrypted)
+
+			// Truncation is detected, even at chunk boundaries.
+			for _, n := range []int{len(encrypted) - 1, len(encrypted) - 20, len(encryptionMagic) + 36} {
+				_, err = decrypt(encrypted[:n], &testKeyManager{})
+				assert.Error(t, err)
+			}
+
+			tampered := append([]byte(nil), encrypted...)
+			tampered[len(tampered)-1] ^= 1
+			_, err = decrypt(tampered, &testKeyManager{})
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("DataKeyError", func(t *testing.T) {
+		_, err := decrypt(encrypt(t, "foo"), &testKeyManager{err: errors.New("access denied")})
+		assert.Error(t, err)
+	})
+
+	t.Run("NotEncrypted", func(t *testing.T) {
+		_, err := decrypt([]byte("foo\n"), &testKeyManager{})
+		assert.Error(t, err)
+		assert.False(t, IsEncrypted([]byte("foo\n")))
+	})
+}
+
+func TestEncryptedExport(t *testing.T) {
+	b := newTestBackend(t)
+
+	var buf bytes.Buffer
+	encrypted, err := NewEncryptedWriter(&buf, &testKeyManager{})
+	require.NoError(t, err)
+	n, err := Export(b, NewBinaryWriter(encrypted), Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	require.NoError(t, encrypted.Close())
+
+	restored := memorystore.NewBackend()
+	result, err := Import(restored, NewBinaryReader(NewEncryptedReader(&buf, &testKeyManager{})), ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.Imported)
+	assert.Equal(t, scanAll(t, b), scanAll(t, restored))
+}
+
+func TestEncryptedExportResume(t *testing.T) {
+	b := newTestBackend(t)
+
+	// The first export is interrupted after its first page has been checkpointed, so it's never
+	// closed.
+	var buf bytes.Buffer
+	encrypted, err := NewEncryptedWriter(&buf, &testKeyManager{})
+	require.NoError(t, err)
+	var cursor string
+	_, err = Export(b, NewJSONWriter(encrypted), Options{
+		PageSize: 2,
+		Checkpoint: func(c string) error {
+			cursor = c
+			return errors.New("interrupted")
+		},
+	})
+	require.Error(t, err)
+
+	encrypted, err = NewEncryptedWriter(&buf, &testKeyManager{})
+	require.NoError(t, err)
+	n, err := Export(b, NewJSONWriter(encrypted), Options{
+		Cursor:   cursor,
+		PageSize: 2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	require.NoError(t, encrypted.Close())
+
+	restored := memorystore.NewBackend()
+	result, err := Import(restored, NewJSONReader(NewEncryptedReader(&buf, &testKeyManager{})), ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.Imported)
+	assert.Equal(t, scanAll(t, b), scanAll(t, restored))
+}
+
+type testKMSClient struct {
+	keyID string
+}
+
+func (c *testKMSClient) GenerateDataKey(input *kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error) {
+	c.keyID = aws.StringValue(input.KeyId)
+	key := bytes.Repeat([]byte{1}, 32)
+	return &kms.GenerateDataKeyOutput{
+		Plaintext:      key,
+		CiphertextBlob: reversed(key),
+	}, nil
+}
+
+func (c *testKMSClient) Decrypt(input *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	if aws.StringValue(input.EncryptionContext["purpose"]) != "backup" {
+		return nil, errors.New("invalid encryption context")
+	}
+	return &kms.DecryptOutput{
+		Plaintext: reversed(input.CiphertextBlob),
+	}, nil
+}
+
+func TestKMSKeyManager(t *testing.T) {
+	client := &testKMSClient{}
+	keys := &KMSKeyManager{
+		Client:            client,
+		KeyID:             "alias/backups",
+		EncryptionContext: map[string]string{"purpose": "backup"},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewEncryptedWriter(&buf, keys)
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "foo")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "alias/backups", client.keyID)
+
+	decrypted, err := decrypt(buf.Bytes(), keys)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", decrypted)
+
+	keys.EncryptionContext = nil
+	_, err = decrypt(buf.Bytes(), keys)
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package keyvaluestoreexport
+
+import (
+	"fmt"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// DefaultPageSize is the number of entries requested from the backend at a time if no page size is
+// given.
+const DefaultPageSize = 1000
+
+type Options struct {
+	// If given, the export resumes from this cursor, which should be one previously passed to
+	// Checkpoint.
+	Cursor string
+
+	// The number of entries to request from the backend at a time. Defaults to DefaultPageSize.
+	PageSize int
+
+	// If given, Checkpoint is invoked after each page has been written and flushed. If the export
+	// is interrupted, it can be resumed by passing the last checkpointed cursor to another export.
+	// If Checkpoint returns an error, the export is aborted.
+	Checkpoint func(cursor string) error
+
+	// If Segments is greater than 1 and the backend implements keyvaluestore.SegmentedScanner, the
+	// backend is scanned in that many segments concurrently. Entries from different segments are
+	// interleaved in the output. Checkpointed cursors cover every segment, so an export can only be
+	// resumed with the same number of segments.
+	Segments int
+
+	// If Metadata is true, the export begins with a metadata record describing its consistency.
+	// The writer must implement MetadataWriter. Metadata is never written when resuming an export,
+	// since the resumed export's output follows that of the original.
+	Metadata bool
+}
+
+// Export writes the backend's contents to w. The backend must implement keyvaluestore.Scanner.
+// Wrappers aren't unwrapped since they may transform keys, so they need to implement Scanner
+// themselves to be exported.
+//
+// If the backend implements keyvaluestore.SnapshotScanner, the export is read from a single
+// snapshot, and its entries are consistent with each other. Snapshots can't outlive the export, so
+// exports that are checkpointed or resumed are never read from one.
+//
+// The number of entries written is returned, even if an error occurs.
+func Export(b keyvaluestore.Backend, w Writer, opts Options) (int, error) {
+	scanner, ok := b.(keyvaluestore.Scanner)
+	if !ok {
+		return 0, fmt.Errorf("backend does not support scanning: %T: %w", b, keyvaluestore.ErrNotSupported)
+	}
+
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	consistency := ConsistencyNone
+	if snapshotter, ok := b.(keyvaluestore.SnapshotScanner); ok && opts.Cursor == "" && opts.Checkpoint == nil {
+		snapshot, err := snapshotter.ScanSnapshot()
+		if err != nil {
+			return 0, err
+		}
+		scanner, consistency = snapshot, ConsistencySnapshot
+	}
+
+	if opts.Metadata && opts.Cursor == "" {
+		mw, ok := w.(MetadataWriter)
+		if !ok {
+			return 0, fmt.Errorf("writer does not support metadata: %T: %w", w, keyvaluestore.ErrNotSupported)
+		}
+		if err := mw.WriteMetadata(&Metadata{
+			Consistency: consistency,
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	if segmented, ok := scanner.(keyvaluestore.SegmentedScanner); ok && opts.Segments > 1 {
+		return exportSegments(segmented, w, pageSize, opts)
+	}
+
+	count := 0
+	cursor := opts.Cursor
+	for {
+		entries, next, err := scanner.Scan(cursor, pageSize)
+		if err != nil {
+			return count, err
+		}
+		for _, entry := range entries {
+			if err := w.WriteEntry(entry); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if err := w.Flush(); err != nil {
+			return count, err
+		}
+		if next == "" {
+			return count, nil
+		}
+		cursor = next
+		if opts.Checkpoint != nil {
+			if err := opts.Checkpoint(cursor); err != nil {
+				return count, err
+			}
+		}
+	}
+}
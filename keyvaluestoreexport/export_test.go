@@ -0,0 +1,262 @@
+package keyvaluestoreexport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func newTestBackend(t *testing.T) *memorystore.Backend {
+	b := memorystore.NewBackend()
+	require.NoError(t, b.Set("a", "foo"))
+	require.NoError(t, b.SAdd("b", "x", "y"))
+	require.NoError(t, b.HSet("c", "field", "value"))
+	require.NoError(t, b.ZHAdd("d", "field", "value", 1.5))
+	require.NoError(t, b.Set("e", "bar"))
+	return b
+}
+
+func TestExportJSON(t *testing.T) {
+	b := newTestBackend(t)
+
+	var buf bytes.Buffer
+	n, err := Export(b, NewJSONWriter(&buf), Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 5)
+	var entry keyvaluestore.Entry
+	require.NoError(t, json.Unmarshal([]byte(lines[3]), &entry))
+	assert.Equal(t, keyvaluestore.Entry{
+		Key:  "d",
+		Type: keyvaluestore.EntryTypeSortedSet,
+		SortedSetMembers: []keyvaluestore.SortedSetEntryMember{
+			{Field: "field", Value: "value", Score: 1.5},
+		},
+	}, entry)
+}
+
+func TestExportJSONInfiniteScore(t *testing.T) {
+	b := memorystore.NewBackend()
+	require.NoError(t, b.ZAdd("foo", "bar", math.Inf(1)))
+
+	_, err := Export(b, NewJSONWriter(&bytes.Buffer{}), Options{})
+	assert.Error(t, err)
+
+	_, err = Export(b, NewBinaryWriter(&bytes.Buffer{}), Options{})
+	assert.NoError(t, err)
+}
+
+func TestExportBinary(t *testing.T) {
+	b := memorystore.NewBackend()
+	require.NoError(t, b.Set("k", "v"))
+
+	var buf bytes.Buffer
+	_, err := Export(b, NewBinaryWriter(&buf), Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 5, binaryTypeString, 1, 'k', 1, 'v'}, buf.Bytes())
+}
+
+func TestExportResume(t *testing.T) {
+	b := newTestBackend(t)
+
+	var expected bytes.Buffer
+	_, err := Export(b, NewJSONWriter(&expected), Options{})
+	require.NoError(t, err)
+
+	// Interrupt the export after the first checkpoint, then resume it.
+	interrupted := errors.New("interrupted")
+	var cursor string
+	var buf bytes.Buffer
+	n, err := Export(b, NewJSONWriter(&buf), Options{
+		PageSize: 2,
+		Checkpoint: func(c string) error {
+			cursor = c
+			return interrupted
+		},
+	})
+	assert.Equal(t, interrupted, err)
+	assert.Equal(t, 2, n)
+	require.NotEmpty(t, cursor)
+
+	n, err = Export(b, NewJSONWriter(&buf), Options{
+		Cursor:   cursor,
+		PageSize: 2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	assert.Equal(t, expected.String(), buf.String())
+}
+
+func TestExportUnsupportedBackend(t *testing.T) {
+	_, err := Export(struct{ keyvaluestore.Backend }{memorystore.NewBackend()}, NewJSONWriter(&bytes.Buffer{}), Options{})
+	assert.Error(t, err)
+}
+
+// segmentedBackend divides a memory backend's keys into segments by their first byte.
+type segmentedBackend struct {
+	*memorystore.Backend
+}
+
+func (b segmentedBackend) ScanSegment(segment, totalSegments int, cursor string, limit int) ([]*keyvaluestore.Entry, string, error) {
+	entries, next, err := b.Scan(cursor, limit)
+	var ret []*keyvaluestore.Entry
+	for _, entry := range entries {
+		if int(entry.Key[0])%totalSegments == segment {
+			ret = append(ret, entry)
+		}
+	}
+	return ret, next, err
+}
+
+func sortedLines(s string) []string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestExportSegments(t *testing.T) {
+	b := segmentedBackend{newTestBackend(t)}
+
+	var expected bytes.Buffer
+	_, err := Export(b, NewJSONWriter(&expected), Options{})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	n, err := Export(b, NewJSONWriter(&buf), Options{
+		PageSize: 1,
+		Segments: 3,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, sortedLines(expected.String()), sortedLines(buf.String()))
+
+	// Interrupt the export after a few pages, then resume it.
+	interrupted := errors.New("interrupted")
+	var cursor string
+	checkpoints := 0
+	buf.Reset()
+	n, err = Export(b, NewJSONWriter(&buf), Options{
+		PageSize: 1,
+		Segments: 3,
+		Checkpoint: func(c string) error {
+			cursor = c
+			if checkpoints++; checkpoints == 3 {
+				return interrupted
+			}
+			return nil
+		},
+	})
+	assert.Equal(t, interrupted, err)
+	require.NotEmpty(t, cursor)
+
+	m, err := Export(b, NewJSONWriter(&buf), Options{
+		Cursor:   cursor,
+		PageSize: 1,
+		Segments: 3,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 5, n+m)
+	assert.Equal(t, sortedLines(expected.String()), sortedLines(buf.String()))
+
+	_, err = Export(b, NewJSONWriter(&buf), Options{
+		Cursor:   cursor,
+		Segments: 2,
+	})
+	assert.Error(t, err)
+}
+
+// snapshotBackend makes a write immediately after each snapshot is taken.
+type snapshotBackend struct {
+	*memorystore.Backend
+}
+
+func (b snapshotBackend) ScanSnapshot() (keyvaluestore.Scanner, error) {
+	scanner, err := b.Backend.ScanSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	// Writes made after the snapshot is taken shouldn't be exported.
+	if err := b.Set("z", "late"); err != nil {
+		return nil, err
+	}
+	return scanner, nil
+}
+
+func TestExportMetadata(t *testing.T) {
+	for name, format := range map[string]struct {
+		newWriter func(io.Writer) Writer
+		newReader func(io.Reader) Reader
+	}{
+		"JSON":   {NewJSONWriter, NewJSONReader},
+		"Binary": {NewBinaryWriter, NewBinaryReader},
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := snapshotBackend{newTestBackend(t)}
+
+			var buf bytes.Buffer
+			n, err := Export(b, format.newWriter(&buf), Options{
+				Metadata: true,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, 5, n)
+
+			r := format.newReader(bytes.NewReader(buf.Bytes())).(MetadataReader)
+			metadata, err := r.Metadata()
+			require.NoError(t, err)
+			assert.Equal(t, &Metadata{Consistency: ConsistencySnapshot}, metadata)
+
+			var keys []string
+			for {
+				entry, err := r.ReadEntry()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				keys = append(keys, entry.Key)
+			}
+			assert.Equal(t, []string{"a", "b", "c", "d", "e"}, keys)
+
+			// Checkpointed exports aren't read from a snapshot.
+			buf.Reset()
+			n, err = Export(b, format.newWriter(&buf), Options{
+				Metadata: true,
+				Checkpoint: func(string) error {
+					return nil
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, 6, n)
+
+			r = format.newReader(bytes.NewReader(buf.Bytes())).(MetadataReader)
+			metadata, err = r.Metadata()
+			require.NoError(t, err)
+			assert.Equal(t, &Metadata{Consistency: ConsistencyNone}, metadata)
+
+			// Readers skip metadata, and dumps without it have none.
+			result, err := Import(memorystore.NewBackend(), format.newReader(bytes.NewReader(buf.Bytes())), ImportOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, 6, result.Imported)
+
+			buf.Reset()
+			_, err = Export(b, format.newWriter(&buf), Options{})
+			require.NoError(t, err)
+			metadata, err = format.newReader(bytes.NewReader(buf.Bytes())).(MetadataReader).Metadata()
+			require.NoError(t, err)
+			assert.Nil(t, metadata)
+		})
+	}
+}
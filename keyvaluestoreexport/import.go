@@ -0,0 +1,216 @@
+package keyvaluestoreexport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// ConflictPolicy determines what happens when an imported key already exists in the destination.
+type ConflictPolicy int
+
+const (
+	// ConflictPolicyOverwrite writes the imported values over any existing ones. Members and
+	// fields that exist in the destination but not in the dump are left in place.
+	ConflictPolicyOverwrite ConflictPolicy = iota
+
+	// ConflictPolicySkip leaves existing keys untouched.
+	ConflictPolicySkip
+
+	// ConflictPolicyFail aborts the import with a *ConflictError.
+	ConflictPolicyFail
+)
+
+// ConflictError is returned when ConflictPolicyFail is used and an imported key already exists.
+type ConflictError struct {
+	Key string
+}
+
+func (err *ConflictError) Error() string {
+	return fmt.Sprintf("key already exists: %v", err.Key)
+}
+
+type ImportOptions struct {
+	// The number of entries to write concurrently. Defaults to 1.
+	Concurrency int
+
+	ConflictPolicy ConflictPolicy
+}
+
+type ImportResult struct {
+	// The number of entries written to the destination.
+	Imported int
+
+	// The number of entries skipped due to ConflictPolicySkip.
+	Skipped int
+}
+
+// Import writes the entries read from r to the backend.
+//
+// Each entry is written via atomic write operations. Sorted sets with more than
+// keyvaluestore.MaxAtomicWriteOperations members are split across multiple operations, so they
+// may be partially visible while the import is in progress. Likewise, existence checks for the
+// skip and fail policies are only atomic with the write for strings. Imports are intended for
+// destinations that aren't being concurrently modified.
+func Import(b keyvaluestore.Backend, r Reader, opts ImportOptions) (*ImportResult, error) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var imported, skipped int64
+	g, ctx := errgroup.WithContext(context.Background())
+	entries := make(chan *keyvaluestore.Entry)
+
+	for i := 0; i < concurrency; i++ {
+		g.Go(func() error {
+			for entry := range entries {
+				ok, err := importEntry(b, entry, opts.ConflictPolicy)
+				if err != nil {
+					return err
+				} else if ok {
+					atomic.AddInt64(&imported, 1)
+				} else {
+					atomic.AddInt64(&skipped, 1)
+				}
+			}
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		defer close(entries)
+		for {
+			entry, err := r.ReadEntry()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			select {
+			case entries <- entry:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+
+	err := g.Wait()
+	return &ImportResult{
+		Imported: int(imported),
+		Skipped:  int(skipped),
+	}, err
+}
+
+// importEntry writes a single entry. It returns false if the entry was skipped.
+func importEntry(b keyvaluestore.Backend, entry *keyvaluestore.Entry, policy ConflictPolicy) (bool, error) {
+	if entry.Type == keyvaluestore.EntryTypeString {
+		return importString(b, entry, policy)
+	}
+
+	if policy != ConflictPolicyOverwrite {
+		if exists, err := entryExists(b, entry); err != nil {
+			return false, err
+		} else if exists {
+			if policy == ConflictPolicyFail {
+				return false, &ConflictError{Key: entry.Key}
+			}
+			return false, nil
+		}
+	}
+
+	switch entry.Type {
+	case keyvaluestore.EntryTypeSet:
+		if len(entry.Members) == 0 {
+			return true, nil
+		}
+		members := make([]interface{}, len(entry.Members)-1)
+		for i, member := range entry.Members[1:] {
+			members[i] = member
+		}
+		tx := b.AtomicWrite()
+		tx.SAdd(entry.Key, entry.Members[0], members...)
+		return execImport(tx)
+	case keyvaluestore.EntryTypeHash:
+		if len(entry.Fields) == 0 {
+			return true, nil
+		}
+		fields := make([]keyvaluestore.KeyValue, 0, len(entry.Fields))
+		for field, value := range entry.Fields {
+			fields = append(fields, keyvaluestore.KeyValue{Key: field, Value: value})
+		}
+		tx := b.AtomicWrite()
+		tx.HSet(entry.Key, fields[0].Key, fields[0].Value, fields[1:]...)
+		return execImport(tx)
+	case keyvaluestore.EntryTypeSortedSet:
+		members := entry.SortedSetMembers
+		for len(members) > 0 {
+			chunk := members
+			if len(chunk) > keyvaluestore.MaxAtomicWriteOperations {
+				chunk = chunk[:keyvaluestore.MaxAtomicWriteOperations]
+			}
+			members = members[len(chunk):]
+
+			tx := b.AtomicWrite()
+			for _, member := range chunk {
+				tx.ZHAdd(entry.Key, member.Field, member.Value, member.Score)
+			}
+			if _, err := execImport(tx); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("unsupported entry type for key %v: %v", entry.Key, entry.Type)
+}
+
+func importString(b keyvaluestore.Backend, entry *keyvaluestore.Entry, policy ConflictPolicy) (bool, error) {
+	tx := b.AtomicWrite()
+	if policy == ConflictPolicyOverwrite {
+		tx.Set(entry.Key, entry.Value)
+	} else {
+		tx.SetNX(entry.Key, entry.Value)
+	}
+	ok, err := tx.Exec()
+	if err != nil {
+		return false, err
+	} else if !ok {
+		if policy == ConflictPolicyFail {
+			return false, &ConflictError{Key: entry.Key}
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+func execImport(tx keyvaluestore.AtomicWriteOperation) (bool, error) {
+	if ok, err := tx.Exec(); err != nil {
+		return false, err
+	} else if !ok {
+		// None of the operations used for imports are conditional.
+		return false, fmt.Errorf("unexpected conditional failure: %w", keyvaluestore.ErrConditionFailed)
+	}
+	return true, nil
+}
+
+// entryExists returns true if a value of the entry's type already exists at its key.
+func entryExists(b keyvaluestore.Backend, entry *keyvaluestore.Entry) (bool, error) {
+	switch entry.Type {
+	case keyvaluestore.EntryTypeSet:
+		members, err := b.SMembers(entry.Key)
+		return len(members) > 0, err
+	case keyvaluestore.EntryTypeHash:
+		fields, err := b.HGetAll(entry.Key)
+		return len(fields) > 0, err
+	case keyvaluestore.EntryTypeSortedSet:
+		n, err := b.ZCount(entry.Key, math.Inf(-1), math.Inf(1))
+		return n > 0, err
+	}
+	return false, fmt.Errorf("unsupported entry type for key %v: %v", entry.Key, entry.Type)
+}
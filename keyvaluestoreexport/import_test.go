@@ -0,0 +1,124 @@
+package keyvaluestoreexport
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func scanAll(t *testing.T, b *memorystore.Backend) []*keyvaluestore.Entry {
+	entries, cursor, err := b.Scan("", 0)
+	require.NoError(t, err)
+	require.Empty(t, cursor)
+	return entries
+}
+
+func TestImport(t *testing.T) {
+	for name, format := range map[string]struct {
+		NewWriter func(io.Writer) Writer
+		NewReader func(io.Reader) Reader
+	}{
+		"JSON":   {NewJSONWriter, NewJSONReader},
+		"Binary": {NewBinaryWriter, NewBinaryReader},
+	} {
+		format := format
+		t.Run(name, func(t *testing.T) {
+			src := newTestBackend(t)
+			for i := 0; i < 2*keyvaluestore.MaxAtomicWriteOperations+1; i++ {
+				require.NoError(t, src.ZAdd("big", strconv.Itoa(i), float64(i)))
+			}
+
+			var buf bytes.Buffer
+			_, err := Export(src, format.NewWriter(&buf), Options{})
+			require.NoError(t, err)
+
+			dest := memorystore.NewBackend()
+			result, err := Import(dest, format.NewReader(&buf), ImportOptions{
+				Concurrency: 4,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, &ImportResult{Imported: 6}, result)
+
+			assert.Equal(t, scanAll(t, src), scanAll(t, dest))
+		})
+	}
+}
+
+func TestImportConflictPolicy(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Export(newTestBackend(t), NewJSONWriter(&buf), Options{})
+	require.NoError(t, err)
+	dump := buf.Bytes()
+
+	newDestination := func() *memorystore.Backend {
+		dest := memorystore.NewBackend()
+		require.NoError(t, dest.Set("a", "existing"))
+		require.NoError(t, dest.SAdd("b", "z"))
+		return dest
+	}
+
+	t.Run("Overwrite", func(t *testing.T) {
+		dest := newDestination()
+		result, err := Import(dest, NewJSONReader(bytes.NewReader(dump)), ImportOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, &ImportResult{Imported: 5}, result)
+
+		v, err := dest.Get("a")
+		require.NoError(t, err)
+		assert.Equal(t, "foo", *v)
+
+		members, err := dest.SMembers("b")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"x", "y", "z"}, members)
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		dest := newDestination()
+		result, err := Import(dest, NewJSONReader(bytes.NewReader(dump)), ImportOptions{
+			ConflictPolicy: ConflictPolicySkip,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, &ImportResult{Imported: 3, Skipped: 2}, result)
+
+		v, err := dest.Get("a")
+		require.NoError(t, err)
+		assert.Equal(t, "existing", *v)
+
+		members, err := dest.SMembers("b")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"z"}, members)
+
+		v, err = dest.Get("e")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", *v)
+	})
+
+	t.Run("Fail", func(t *testing.T) {
+		dest := newDestination()
+		_, err := Import(dest, NewJSONReader(bytes.NewReader(dump)), ImportOptions{
+			ConflictPolicy: ConflictPolicyFail,
+		})
+		assert.Equal(t, &ConflictError{Key: "a"}, err)
+	})
+}
+
+func TestBinaryReaderTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Export(newTestBackend(t), NewBinaryWriter(&buf), Options{})
+	require.NoError(t, err)
+
+	r := NewBinaryReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	for i := 0; i < 4; i++ {
+		_, err := r.ReadEntry()
+		require.NoError(t, err)
+	}
+	_, err = r.ReadEntry()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
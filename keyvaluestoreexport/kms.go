@@ -0,0 +1,59 @@
+package keyvaluestoreexport
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// KMSClient is the subset of the AWS KMS client used by KMSKeyManager. It's implemented by
+// *kms.KMS.
+type KMSClient interface {
+	GenerateDataKey(input *kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(input *kms.DecryptInput) (*kms.DecryptOutput, error)
+}
+
+// KMSKeyManager generates data keys using AWS KMS. Restoring an export requires permission to
+// decrypt with the KMS key that encrypted it.
+type KMSKeyManager struct {
+	Client KMSClient
+
+	// The id or ARN of the KMS key that encrypts data keys. It's only needed for encryption, since
+	// the encrypted data keys identify their KMS keys.
+	KeyID string
+
+	// If given, EncryptionContext is bound to each data key, and the same context is required to
+	// decrypt it.
+	EncryptionContext map[string]string
+}
+
+var _ KeyManager = &KMSKeyManager{}
+
+func (m *KMSKeyManager) encryptionContext() map[string]*string {
+	if len(m.EncryptionContext) == 0 {
+		return nil
+	}
+	return aws.StringMap(m.EncryptionContext)
+}
+
+func (m *KMSKeyManager) GenerateDataKey() ([]byte, []byte, error) {
+	output, err := m.Client.GenerateDataKey(&kms.GenerateDataKeyInput{
+		KeyId:             aws.String(m.KeyID),
+		KeySpec:           aws.String(kms.DataKeySpecAes256),
+		EncryptionContext: m.encryptionContext(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return output.Plaintext, output.CiphertextBlob, nil
+}
+
+func (m *KMSKeyManager) DecryptDataKey(encrypted []byte) ([]byte, error) {
+	output, err := m.Client.Decrypt(&kms.DecryptInput{
+		CiphertextBlob:    encrypted,
+		EncryptionContext: m.encryptionContext(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Plaintext, nil
+}
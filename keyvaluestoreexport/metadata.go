@@ -0,0 +1,95 @@
+package keyvaluestoreexport
+
+import (
+	"io"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Consistency describes whether an export's entries were read from a single point in time.
+type Consistency string
+
+const (
+	// ConsistencyNone indicates that entries were read at different times, so writes made during
+	// the export may be reflected in some entries but not others.
+	ConsistencyNone Consistency = "none"
+
+	// ConsistencySnapshot indicates that every entry was read from a single, point-in-time
+	// snapshot of the backend.
+	ConsistencySnapshot Consistency = "snapshot"
+)
+
+// Metadata describes an export. It's written at the beginning of exports if Options.Metadata is
+// true.
+type Metadata struct {
+	Consistency Consistency `json:"consistency"`
+}
+
+// MetadataWriter is implemented by writers that can record an export's metadata. The writers
+// returned by NewJSONWriter and NewBinaryWriter implement it.
+type MetadataWriter interface {
+	Writer
+
+	// WriteMetadata writes the metadata. It must be invoked before any entries are written.
+	WriteMetadata(metadata *Metadata) error
+}
+
+// MetadataReader is implemented by readers that can return an export's metadata. The readers
+// returned by NewJSONReader and NewBinaryReader implement it. Their ReadEntry methods skip any
+// metadata, so readers that don't need it can ignore it.
+type MetadataReader interface {
+	Reader
+
+	// Metadata returns the export's metadata, or nil if it has none, e.g. because it was written
+	// without Options.Metadata. It must be invoked before ReadEntry.
+	Metadata() (*Metadata, error)
+}
+
+// metadataReader implements MetadataReader for readers whose records may be entries or metadata.
+// The first record is read ahead so that metadata can be returned before any entries are read.
+type metadataReader struct {
+	// readRecord returns either an entry or metadata.
+	readRecord func() (*keyvaluestore.Entry, *Metadata, error)
+
+	started  bool
+	metadata *Metadata
+	next     *keyvaluestore.Entry
+	err      error
+}
+
+func (r *metadataReader) start() {
+	if r.started {
+		return
+	}
+	r.started = true
+	entry, metadata, err := r.readRecord()
+	if metadata != nil {
+		r.metadata = metadata
+	} else {
+		r.next, r.err = entry, err
+	}
+}
+
+func (r *metadataReader) Metadata() (*Metadata, error) {
+	r.start()
+	if r.err != nil && r.err != io.EOF {
+		return nil, r.err
+	}
+	return r.metadata, nil
+}
+
+func (r *metadataReader) ReadEntry() (*keyvaluestore.Entry, error) {
+	r.start()
+	if r.next != nil || r.err != nil {
+		entry, err := r.next, r.err
+		r.next, r.err = nil, nil
+		return entry, err
+	}
+	for {
+		// Metadata can also appear after entries if dumps are concatenated.
+		entry, metadata, err := r.readRecord()
+		if metadata == nil {
+			return entry, err
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package keyvaluestoreexport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Reader reads entries written by a Writer.
+type Reader interface {
+	// ReadEntry returns the next entry. Once there are no more entries, io.EOF is returned.
+	ReadEntry() (*keyvaluestore.Entry, error)
+}
+
+type jsonReader struct {
+	decoder *json.Decoder
+}
+
+// NewJSONReader returns a reader for entries written by a writer created by NewJSONWriter. It
+// implements MetadataReader.
+func NewJSONReader(r io.Reader) Reader {
+	jr := &jsonReader{
+		decoder: json.NewDecoder(r),
+	}
+	return &metadataReader{
+		readRecord: jr.readRecord,
+	}
+}
+
+func (r *jsonReader) readRecord() (*keyvaluestore.Entry, *Metadata, error) {
+	var record jsonRecord
+	if err := r.decoder.Decode(&record); err != nil {
+		return nil, nil, err
+	} else if record.Metadata != nil {
+		return nil, record.Metadata, nil
+	} else if record.Entry == nil {
+		return &keyvaluestore.Entry{}, nil, nil
+	}
+	return record.Entry, nil, nil
+}
+
+type binaryReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewBinaryReader returns a reader for entries written by a writer created by NewBinaryWriter. It
+// implements MetadataReader.
+func NewBinaryReader(r io.Reader) Reader {
+	br := &binaryReader{
+		r: bufio.NewReader(r),
+	}
+	return &metadataReader{
+		readRecord: br.readRecord,
+	}
+}
+
+func (r *binaryReader) readRecord() (*keyvaluestore.Entry, *Metadata, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r.r, length[:]); err != nil {
+		return nil, nil, err
+	}
+	n := int(binary.BigEndian.Uint32(length[:]))
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	buf := r.buf[:n]
+	if _, err := io.ReadFull(r.r, buf); err == io.EOF {
+		return nil, nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	d := &binaryDecoder{buf: buf}
+	t := d.byte()
+	if t == binaryTypeMetadata {
+		encoded := d.string()
+		if d.err == nil && len(d.buf) > 0 {
+			d.err = fmt.Errorf("unexpected trailing bytes")
+		}
+		var metadata Metadata
+		if d.err == nil {
+			d.err = json.Unmarshal([]byte(encoded), &metadata)
+		}
+		if d.err != nil {
+			return nil, nil, fmt.Errorf("malformed record: %v", d.err)
+		}
+		return nil, &metadata, nil
+	}
+
+	entry := &keyvaluestore.Entry{}
+	entry.Key = d.string()
+	switch t {
+	case binaryTypeString:
+		entry.Type = keyvaluestore.EntryTypeString
+		entry.Value = d.string()
+	case binaryTypeSet:
+		entry.Type = keyvaluestore.EntryTypeSet
+		for i, count := 0, d.count(); i < count; i++ {
+			entry.Members = append(entry.Members, d.string())
+		}
+	case binaryTypeHash:
+		entry.Type = keyvaluestore.EntryTypeHash
+		entry.Fields = map[string]string{}
+		for i, count := 0, d.count(); i < count; i++ {
+			field := d.string()
+			entry.Fields[field] = d.string()
+		}
+	case binaryTypeSortedSet:
+		entry.Type = keyvaluestore.EntryTypeSortedSet
+		for i, count := 0, d.count(); i < count; i++ {
+			entry.SortedSetMembers = append(entry.SortedSetMembers, keyvaluestore.SortedSetEntryMember{
+				Field: d.string(),
+				Value: d.string(),
+				Score: d.float(),
+			})
+		}
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown entry type: %v", t)
+		}
+	}
+
+	if d.err == nil && len(d.buf) > 0 {
+		d.err = fmt.Errorf("unexpected trailing bytes")
+	}
+	if d.err != nil {
+		return nil, nil, fmt.Errorf("malformed record: %v", d.err)
+	}
+	return entry, nil, nil
+}
+
+// binaryDecoder consumes values from a record. Once an error is encountered, subsequent calls
+// return zero values and the first error is retained.
+type binaryDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *binaryDecoder) fail() {
+	if d.err == nil {
+		d.err = io.ErrUnexpectedEOF
+	}
+	d.buf = nil
+}
+
+func (d *binaryDecoder) byte() byte {
+	if len(d.buf) < 1 {
+		d.fail()
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	n, size := binary.Uvarint(d.buf)
+	if size <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[size:]
+	return n
+}
+
+// count decodes a count. Since every counted item occupies at least one byte, counts larger than
+// the remaining record are rejected rather than trusted for allocations.
+func (d *binaryDecoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *binaryDecoder) string() string {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail()
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *binaryDecoder) float() float64 {
+	if len(d.buf) < 8 {
+		d.fail()
+		return 0
+	}
+	f := math.Float64frombits(binary.BigEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return f
+}
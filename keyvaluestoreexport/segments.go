@@ -0,0 +1,116 @@
+package keyvaluestoreexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// segmentsCursor is the state of a segmented export. It's checkpointed as JSON.
+type segmentsCursor struct {
+	// Cursors contains the cursor of each segment.
+	Cursors []string `json:"cursors"`
+
+	// Done indicates which segments have been completely exported.
+	Done []bool `json:"done"`
+}
+
+func (c *segmentsCursor) String() string {
+	buf, err := json.Marshal(c)
+	if err != nil {
+		// The cursor only contains strings and booleans.
+		panic(err)
+	}
+	return string(buf)
+}
+
+func parseSegmentsCursor(s string, segments int) (*segmentsCursor, error) {
+	c := &segmentsCursor{
+		Cursors: make([]string, segments),
+		Done:    make([]bool, segments),
+	}
+	if s == "" {
+		return c, nil
+	}
+	if err := json.Unmarshal([]byte(s), c); err != nil || len(c.Cursors) != segments || len(c.Done) != segments {
+		return nil, fmt.Errorf("invalid cursor for %d segments: %v", segments, s)
+	}
+	return c, nil
+}
+
+// exportSegments exports each segment concurrently. Writes are serialized, and the combined cursor
+// is only checkpointed once the page it covers has been flushed.
+func exportSegments(scanner keyvaluestore.SegmentedScanner, w Writer, pageSize int, opts Options) (int, error) {
+	segments := opts.Segments
+	state, err := parseSegmentsCursor(opts.Cursor, segments)
+	if err != nil {
+		return 0, err
+	}
+
+	var mutex sync.Mutex
+	var firstErr error
+	count := 0
+
+	// write writes a segment's page and checkpoints its progress. It returns false if the export
+	// has been aborted.
+	write := func(segment int, entries []*keyvaluestore.Entry, next string) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if firstErr != nil {
+			return false
+		}
+		err := func() error {
+			for _, entry := range entries {
+				if err := w.WriteEntry(entry); err != nil {
+					return err
+				}
+				count++
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			state.Cursors[segment] = next
+			state.Done[segment] = next == ""
+			if opts.Checkpoint != nil {
+				return opts.Checkpoint(state.String())
+			}
+			return nil
+		}()
+		if err != nil {
+			firstErr = err
+			return false
+		}
+		return true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < segments; i++ {
+		if state.Done[i] {
+			continue
+		}
+		segment, cursor := i, state.Cursors[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				entries, next, err := scanner.ScanSegment(segment, segments, cursor, pageSize)
+				if err != nil {
+					mutex.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mutex.Unlock()
+					return
+				}
+				if !write(segment, entries, next) || next == "" {
+					return
+				}
+				cursor = next
+			}
+		}()
+	}
+	wg.Wait()
+	return count, firstErr
+}
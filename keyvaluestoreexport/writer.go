@@ -0,0 +1,198 @@
+package keyvaluestoreexport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Writer writes entries in a portable format.
+type Writer interface {
+	WriteEntry(entry *keyvaluestore.Entry) error
+
+	// Flush writes any buffered data to the underlying io.Writer. If the io.Writer also has a Flush
+	// method, such as EncryptedWriter, it's flushed too.
+	Flush() error
+}
+
+// flusher is implemented by io.Writers that buffer data themselves.
+type flusher interface {
+	Flush() error
+}
+
+func flush(bw *bufio.Writer, w io.Writer) error {
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if f, ok := w.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+type jsonWriter struct {
+	dst     io.Writer
+	w       *bufio.Writer
+	encoder *json.Encoder
+}
+
+// jsonRecord is a line of a JSON export. Metadata is written as an object with only a "metadata"
+// property.
+type jsonRecord struct {
+	*keyvaluestore.Entry
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// NewJSONWriter returns a writer that writes entries as JSON lines. It implements MetadataWriter.
+func NewJSONWriter(w io.Writer) Writer {
+	bw := bufio.NewWriter(w)
+	return &jsonWriter{
+		dst:     w,
+		w:       bw,
+		encoder: json.NewEncoder(bw),
+	}
+}
+
+var _ MetadataWriter = &jsonWriter{}
+
+func (w *jsonWriter) WriteEntry(entry *keyvaluestore.Entry) error {
+	for _, member := range entry.SortedSetMembers {
+		if math.IsInf(member.Score, 0) || math.IsNaN(member.Score) {
+			return fmt.Errorf("score for key %v cannot be represented in json: %v", entry.Key, member.Score)
+		}
+	}
+	return w.encoder.Encode(entry)
+}
+
+func (w *jsonWriter) WriteMetadata(metadata *Metadata) error {
+	return w.encoder.Encode(jsonRecord{
+		Metadata: metadata,
+	})
+}
+
+func (w *jsonWriter) Flush() error {
+	return flush(w.w, w.dst)
+}
+
+// Entry types in the binary format.
+const (
+	binaryTypeString    = 1
+	binaryTypeSet       = 2
+	binaryTypeHash      = 3
+	binaryTypeSortedSet = 4
+	binaryTypeMetadata  = 5
+)
+
+type binaryWriter struct {
+	dst io.Writer
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewBinaryWriter returns a writer that writes entries as a stream of length-prefixed records. Each
+// record begins with its length as a big-endian uint32, followed by a type byte and, for entries,
+// the key. The remainder depends on the type:
+//
+//	string:    value
+//	set:       count, members...
+//	hash:      count, (field, value)...
+//	sortedset: count, (field, value, score)...
+//	metadata:  json
+//
+// Strings are encoded as a uvarint length followed by their bytes, counts are uvarints, and scores
+// are big-endian IEEE 754 doubles. Unlike JSON, the binary format can represent infinite scores. The
+// writer implements MetadataWriter.
+func NewBinaryWriter(w io.Writer) Writer {
+	return &binaryWriter{
+		dst: w,
+		w:   bufio.NewWriter(w),
+	}
+}
+
+var _ MetadataWriter = &binaryWriter{}
+
+func (w *binaryWriter) WriteEntry(entry *keyvaluestore.Entry) error {
+	buf := w.buf[:0]
+	switch entry.Type {
+	case keyvaluestore.EntryTypeString:
+		buf = append(buf, binaryTypeString)
+		buf = appendString(buf, entry.Key)
+		buf = appendString(buf, entry.Value)
+	case keyvaluestore.EntryTypeSet:
+		buf = append(buf, binaryTypeSet)
+		buf = appendString(buf, entry.Key)
+		buf = appendUvarint(buf, uint64(len(entry.Members)))
+		for _, member := range entry.Members {
+			buf = appendString(buf, member)
+		}
+	case keyvaluestore.EntryTypeHash:
+		buf = append(buf, binaryTypeHash)
+		buf = appendString(buf, entry.Key)
+		buf = appendUvarint(buf, uint64(len(entry.Fields)))
+		fields := make([]string, 0, len(entry.Fields))
+		for field := range entry.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			buf = appendString(buf, field)
+			buf = appendString(buf, entry.Fields[field])
+		}
+	case keyvaluestore.EntryTypeSortedSet:
+		buf = append(buf, binaryTypeSortedSet)
+		buf = appendString(buf, entry.Key)
+		buf = appendUvarint(buf, uint64(len(entry.SortedSetMembers)))
+		for _, member := range entry.SortedSetMembers {
+			buf = appendString(buf, member.Field)
+			buf = appendString(buf, member.Value)
+			var score [8]byte
+			binary.BigEndian.PutUint64(score[:], math.Float64bits(member.Score))
+			buf = append(buf, score[:]...)
+		}
+	default:
+		return fmt.Errorf("unsupported entry type for key %v: %v", entry.Key, entry.Type)
+	}
+	w.buf = buf
+
+	if uint64(len(buf)) > math.MaxUint32 {
+		return fmt.Errorf("entry for key %v is too large", entry.Key)
+	}
+	return w.writeRecord(buf)
+}
+
+func (w *binaryWriter) WriteMetadata(metadata *Metadata) error {
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return w.writeRecord(appendString([]byte{binaryTypeMetadata}, string(encoded)))
+}
+
+func (w *binaryWriter) writeRecord(buf []byte) error {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(buf)))
+	if _, err := w.w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := w.w.Write(buf)
+	return err
+}
+
+func (w *binaryWriter) Flush() error {
+	return flush(w.w, w.dst)
+}
+
+func appendUvarint(buf []byte, n uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], n)]...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	return append(appendUvarint(buf, uint64(len(s))), s...)
+}
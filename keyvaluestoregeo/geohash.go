@@ -0,0 +1,158 @@
+package keyvaluestoregeo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// earthRadius is the radius in meters used for distance calculations. It's the same one Redis
+// uses, so that both implementations agree on what's within a radius.
+const earthRadius = 6372797.560856
+
+// hashLength is the length of the geohashes stored in the index. 12 characters is precise to a few
+// centimeters.
+const hashLength = 12
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// encode returns the geohash of the given length for the coordinates.
+func encode(longitude, latitude float64, length int) string {
+	minLongitude, maxLongitude := -180.0, 180.0
+	minLatitude, maxLatitude := -90.0, 90.0
+	buf := make([]byte, length)
+	even := true
+	for i := range buf {
+		var c byte
+		for bit := 0; bit < 5; bit++ {
+			c <<= 1
+			if even {
+				if mid := (minLongitude + maxLongitude) / 2; longitude >= mid {
+					c |= 1
+					minLongitude = mid
+				} else {
+					maxLongitude = mid
+				}
+			} else {
+				if mid := (minLatitude + maxLatitude) / 2; latitude >= mid {
+					c |= 1
+					minLatitude = mid
+				} else {
+					maxLatitude = mid
+				}
+			}
+			even = !even
+		}
+		buf[i] = base32[c]
+	}
+	return string(buf)
+}
+
+// decode returns the coordinates of the center of the geohash's cell.
+func decode(hash string) (float64, float64, error) {
+	minLongitude, maxLongitude := -180.0, 180.0
+	minLatitude, maxLatitude := -90.0, 90.0
+	even := true
+	for i := 0; i < len(hash); i++ {
+		c := strings.IndexByte(base32, hash[i])
+		if c < 0 {
+			return 0, 0, fmt.Errorf("malformed geohash: %w", keyvaluestore.ErrWrongType)
+		}
+		for bit := 4; bit >= 0; bit-- {
+			set := c&(1<<uint(bit)) != 0
+			if even {
+				if mid := (minLongitude + maxLongitude) / 2; set {
+					minLongitude = mid
+				} else {
+					maxLongitude = mid
+				}
+			} else {
+				if mid := (minLatitude + maxLatitude) / 2; set {
+					minLatitude = mid
+				} else {
+					maxLatitude = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return (minLongitude + maxLongitude) / 2, (minLatitude + maxLatitude) / 2, nil
+}
+
+// cellSize returns the width and height in degrees of geohash cells of the given length.
+func cellSize(length int) (float64, float64) {
+	longitudeBits := (5*length + 1) / 2
+	latitudeBits := 5 * length / 2
+	return 360 / math.Exp2(float64(longitudeBits)), 180 / math.Exp2(float64(latitudeBits))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+// distance returns the great-circle distance in meters between two points.
+func distance(longitude1, latitude1, longitude2, latitude2 float64) float64 {
+	u := math.Sin(radians(latitude2-latitude1) / 2)
+	v := math.Sin(radians(longitude2-longitude1) / 2)
+	a := u*u + math.Cos(radians(latitude1))*math.Cos(radians(latitude2))*v*v
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// searchLength returns the longest geohash length whose cells are at least as large as the
+// bounding box of the search area. The area is then covered by the cell containing its center and
+// that cell's neighbors. If zero is returned, the entire index needs to be searched.
+func searchLength(latitude, radius float64) int {
+	angle := radius / earthRadius
+	if angle >= math.Pi/2 || math.Sin(angle) >= math.Cos(radians(latitude)) {
+		// The area is huge or contains a pole, so it spans every longitude.
+		return 0
+	}
+	latitudeSpan := degrees(angle)
+	longitudeSpan := degrees(math.Asin(math.Sin(angle) / math.Cos(radians(latitude))))
+	for length := hashLength; length > 0; length-- {
+		width, height := cellSize(length)
+		if width >= longitudeSpan && height >= latitudeSpan {
+			return length
+		}
+	}
+	return 0
+}
+
+// searchCells returns the geohash prefixes that need to be searched to find everything within the
+// radius.
+func searchCells(longitude, latitude, radius float64) []string {
+	length := searchLength(latitude, radius)
+	if length == 0 {
+		return []string{""}
+	}
+	width, height := cellSize(length)
+	centerLongitude, centerLatitude, _ := decode(encode(longitude, latitude, length))
+
+	var cells []string
+	seen := map[string]bool{}
+	for dy := -1; dy <= 1; dy++ {
+		cellLatitude := centerLatitude + float64(dy)*height
+		if cellLatitude < -90 || cellLatitude > 90 {
+			continue
+		}
+		for dx := -1; dx <= 1; dx++ {
+			cellLongitude := centerLongitude + float64(dx)*width
+			if cellLongitude > 180 {
+				cellLongitude -= 360
+			} else if cellLongitude < -180 {
+				cellLongitude += 360
+			}
+			if cell := encode(cellLongitude, cellLatitude, length); !seen[cell] {
+				seen[cell] = true
+				cells = append(cells, cell)
+			}
+		}
+	}
+	return cells
+}
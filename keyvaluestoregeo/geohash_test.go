@@ -0,0 +1,43 @@
+package keyvaluestoregeo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeohash(t *testing.T) {
+	assert.Equal(t, "ezs42", encode(-5.6, 42.6, 5))
+	assert.Equal(t, "u4pruydqqvj", encode(10.40744, 57.64911, 11))
+
+	longitude, latitude, err := decode("u4pruydqqvj")
+	require.NoError(t, err)
+	assert.InDelta(t, 10.40744, longitude, 0.00001)
+	assert.InDelta(t, 57.64911, latitude, 0.00001)
+
+	_, _, err = decode("a")
+	assert.Error(t, err)
+}
+
+func TestSearchCells(t *testing.T) {
+	assert.Len(t, searchCells(2.3522, 48.8566, 1000), 9)
+	assert.Equal(t, []string{""}, searchCells(0, 85, 1000000))
+
+	// Every point on the circle must be within one of the cells.
+	for _, radius := range []float64{1, 100, 10000, 1000000} {
+		cells := searchCells(2.3522, 48.8566, radius)
+		for _, p := range [][2]float64{{0, 1}, {1, 0}, {0, -1}, {-1, 0}, {0.7, 0.7}, {-0.7, -0.7}} {
+			latitude := 48.8566 + p[1]*degrees(radius/earthRadius)
+			longitude := 2.3522 + p[0]*degrees(radius/earthRadius)/0.66
+			hash := encode(longitude, latitude, hashLength)
+			found := false
+			for _, cell := range cells {
+				if len(hash) >= len(cell) && hash[:len(cell)] == cell {
+					found = true
+				}
+			}
+			assert.True(t, found, "radius %v, point %v", radius, p)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package keyvaluestoregeo implements geospatial indexes on top of sorted sets.
+package keyvaluestoregeo
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// NativeBackend is implemented by backends with built-in geospatial indexes, such as
+// redisstore.Backend.
+type NativeBackend interface {
+	GeoAdd(key, member string, longitude, latitude float64) error
+
+	// GeoRadius returns up to limit members within radius meters of the given coordinates, sorted
+	// by ascending distance. Each member's score is its distance in meters. If limit is zero, all
+	// members within the radius are returned.
+	GeoRadius(key string, longitude, latitude, radius float64, limit int) (keyvaluestore.ScoredMembers, error)
+}
+
+// These are the limits imposed by Redis, which are also applied to other backends for consistency.
+const (
+	MinLatitude  = -85.05112878
+	MaxLatitude  = 85.05112878
+	MinLongitude = -180.0
+	MaxLongitude = 180.0
+)
+
+// Index is a set of members with locations that can be searched by proximity.
+//
+// If the backend implements NativeBackend, its geospatial commands are used. Otherwise the members
+// are stored in the sorted set at Key with zero scores, prefixed by their geohashes so that nearby
+// members can be found via ZRangeByLex. Each member's geohash is also stored at its own key so that
+// it can be moved or removed. Since the two representations aren't compatible, the same keys
+// should always be used with the same kind of backend.
+type Index struct {
+	Backend keyvaluestore.Backend
+	Key     string
+}
+
+// Result is a member found by a search.
+type Result struct {
+	Member string
+
+	// Distance is the member's distance from the search's center in meters.
+	Distance float64
+}
+
+func validateCoordinates(longitude, latitude float64) error {
+	if longitude < MinLongitude || longitude > MaxLongitude || latitude < MinLatitude || latitude > MaxLatitude {
+		return fmt.Errorf("invalid coordinates: %v, %v", longitude, latitude)
+	}
+	return nil
+}
+
+// positionKey returns the key at which a member's geohash is stored. Removed members leave an empty
+// geohash behind so that removals can be conditioned on it.
+func (i *Index) positionKey(member string) string {
+	return keyvaluestore.Key{i.Key, "position", member}.String()
+}
+
+// Add adds a member to the index or moves it if it's already there.
+func (i *Index) Add(member string, longitude, latitude float64) error {
+	if err := validateCoordinates(longitude, latitude); err != nil {
+		return err
+	}
+	if native, ok := i.Backend.(NativeBackend); ok {
+		return native.GeoAdd(i.Key, member, longitude, latitude)
+	}
+
+	hash := encode(longitude, latitude, hashLength)
+	for attempt := 0; attempt < keyvaluestore.MaxUpdateAttempts; attempt++ {
+		prev, err := i.Backend.Get(i.positionKey(member))
+		if err != nil {
+			return err
+		} else if prev != nil && *prev == hash {
+			return nil
+		}
+
+		tx := i.Backend.AtomicWrite()
+		if prev == nil {
+			tx.SetNX(i.positionKey(member), hash)
+		} else {
+			tx.SetEQ(i.positionKey(member), hash, *prev)
+			if *prev != "" {
+				tx.ZRem(i.Key, *prev+member)
+			}
+		}
+		tx.ZAdd(i.Key, hash+member, 0)
+
+		if ok, err := tx.Exec(); err != nil && !keyvaluestore.IsAtomicWriteConflict(err) {
+			return err
+		} else if ok && err == nil {
+			return nil
+		}
+	}
+	return &keyvaluestore.AtomicWriteConflictError{
+		Err: fmt.Errorf("unable to add %v to geospatial index %v after %v attempts", member, i.Key, keyvaluestore.MaxUpdateAttempts),
+	}
+}
+
+// Remove removes a member from the index.
+func (i *Index) Remove(member string) error {
+	if _, ok := i.Backend.(NativeBackend); ok {
+		return i.Backend.ZRem(i.Key, member)
+	}
+
+	for attempt := 0; attempt < keyvaluestore.MaxUpdateAttempts; attempt++ {
+		prev, err := i.Backend.Get(i.positionKey(member))
+		if err != nil {
+			return err
+		} else if prev == nil || *prev == "" {
+			return nil
+		}
+
+		tx := i.Backend.AtomicWrite()
+		tx.SetEQ(i.positionKey(member), "", *prev)
+		tx.ZRem(i.Key, *prev+member)
+
+		if ok, err := tx.Exec(); err != nil && !keyvaluestore.IsAtomicWriteConflict(err) {
+			return err
+		} else if ok && err == nil {
+			return nil
+		}
+	}
+	return &keyvaluestore.AtomicWriteConflictError{
+		Err: fmt.Errorf("unable to remove %v from geospatial index %v after %v attempts", member, i.Key, keyvaluestore.MaxUpdateAttempts),
+	}
+}
+
+// SearchRadius returns up to limit members within radius meters of the given coordinates, sorted
+// by ascending distance. If limit is zero, all members within the radius are returned.
+//
+// Without a native backend, every member in a region a few times larger than the radius is read,
+// so large radii can be expensive.
+func (i *Index) SearchRadius(longitude, latitude, radius float64, limit int) ([]Result, error) {
+	if err := validateCoordinates(longitude, latitude); err != nil {
+		return nil, err
+	} else if radius < 0 {
+		return nil, fmt.Errorf("invalid radius: %v", radius)
+	}
+
+	if native, ok := i.Backend.(NativeBackend); ok {
+		members, err := native.GeoRadius(i.Key, longitude, latitude, radius, limit)
+		if err != nil {
+			return nil, err
+		}
+		results := make([]Result, len(members))
+		for j, m := range members {
+			results[j] = Result{
+				Member:   m.Value,
+				Distance: m.Score,
+			}
+		}
+		return results, nil
+	}
+
+	var results []Result
+	for _, cell := range searchCells(longitude, latitude, radius) {
+		min, max := "-", "+"
+		if cell != "" {
+			// '{' sorts after every geohash character.
+			min, max = "["+cell, "("+cell+"{"
+		}
+		members, err := i.Backend.ZRangeByLex(i.Key, min, max, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			if len(m) < hashLength {
+				return nil, fmt.Errorf("malformed geospatial index: %w", keyvaluestore.ErrWrongType)
+			}
+			memberLongitude, memberLatitude, err := decode(m[:hashLength])
+			if err != nil {
+				return nil, err
+			}
+			if d := distance(longitude, latitude, memberLongitude, memberLatitude); d <= radius {
+				results = append(results, Result{
+					Member:   m[hashLength:],
+					Distance: d,
+				})
+			}
+		}
+	}
+
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Distance != results[b].Distance {
+			return results[a].Distance < results[b].Distance
+		}
+		return results[a].Member < results[b].Member
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
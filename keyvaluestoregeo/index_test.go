@@ -0,0 +1,92 @@
+package keyvaluestoregeo_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/keyvaluestoregeo"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func members(results []keyvaluestoregeo.Result) []string {
+	ret := make([]string, len(results))
+	for i, r := range results {
+		ret[i] = r.Member
+	}
+	return ret
+}
+
+func TestIndex(t *testing.T) {
+	index := &keyvaluestoregeo.Index{
+		Backend: memorystore.NewBackend(),
+		Key:     "cities",
+	}
+
+	require.NoError(t, index.Add("paris", 2.3522, 48.8566))
+	require.NoError(t, index.Add("brussels", 4.3517, 50.8503))
+	require.NoError(t, index.Add("london", -0.1276, 51.5072))
+	require.NoError(t, index.Add("new york", -74.006, 40.7128))
+
+	t.Run("Radius", func(t *testing.T) {
+		results, err := index.SearchRadius(2.3522, 48.8566, 300000, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"paris", "brussels"}, members(results))
+		assert.InDelta(t, 0, results[0].Distance, 1)
+		assert.InDelta(t, 264000, results[1].Distance, 2000)
+
+		results, err = index.SearchRadius(2.3522, 48.8566, 400000, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"paris", "brussels", "london"}, members(results))
+
+		results, err = index.SearchRadius(-73.9, 40.8, 50000, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"new york"}, members(results))
+
+		results, err = index.SearchRadius(0, 0, 1000, 0)
+		require.NoError(t, err)
+		assert.Empty(t, results)
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		results, err := index.SearchRadius(2.3522, 48.8566, 10000000, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"paris", "brussels"}, members(results))
+	})
+
+	t.Run("Move", func(t *testing.T) {
+		require.NoError(t, index.Add("brussels", -74.006, 40.7128))
+		results, err := index.SearchRadius(2.3522, 48.8566, 300000, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"paris"}, members(results))
+		require.NoError(t, index.Add("brussels", 4.3517, 50.8503))
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		require.NoError(t, index.Remove("brussels"))
+		require.NoError(t, index.Remove("brussels"))
+		results, err := index.SearchRadius(2.3522, 48.8566, 300000, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"paris"}, members(results))
+
+		require.NoError(t, index.Add("brussels", 4.3517, 50.8503))
+		results, err = index.SearchRadius(2.3522, 48.8566, 300000, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"paris", "brussels"}, members(results))
+	})
+
+	t.Run("Antimeridian", func(t *testing.T) {
+		require.NoError(t, index.Add("east", 179.999, 0))
+		require.NoError(t, index.Add("west", -179.999, 0))
+		results, err := index.SearchRadius(179.9995, 0, 1000, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"east", "west"}, members(results))
+	})
+
+	t.Run("InvalidCoordinates", func(t *testing.T) {
+		assert.Error(t, index.Add("north pole", 0, 90))
+		_, err := index.SearchRadius(181, 0, 1000, 0)
+		assert.Error(t, err)
+	})
+}
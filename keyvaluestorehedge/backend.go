@@ -0,0 +1,321 @@
+// Package keyvaluestorehedge provides a backend wrapper that hedges slow reads to reduce tail
+// latency.
+package keyvaluestorehedge
+
+import (
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// DefaultDelay is the hedging delay used by backends that don't specify one.
+const DefaultDelay = 50 * time.Millisecond
+
+// Backend passes operations through to an underlying backend. If a Get, HGet, or ZScore hasn't
+// completed after Delay, a second, identical read is issued and the first successful response is
+// returned. If the first read fails before the delay elapses, the second is issued immediately.
+//
+// Hedging increases the load on the backend, so Delay should typically be around the backend's p95
+// or p99 latency. Reads that lose the race are left to complete in the background.
+type Backend struct {
+	Backend keyvaluestore.Backend
+
+	// If Replica is given, hedged reads are sent to it instead of Backend. Replicas that lag behind
+	// may cause hedged reads to return stale values.
+	Replica keyvaluestore.Backend
+
+	// Delay is how long to wait for the first response before hedging. If zero, DefaultDelay is
+	// used.
+	Delay time.Duration
+
+	// If given, Profiler receives a profile with Hedges set to 1 for each hedged read. Its duration
+	// is the total time taken by the read. WithProfiler sets it if given a keyvaluestore.Profiler.
+	Profiler keyvaluestore.Profiler
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+
+func (b *Backend) delay() time.Duration {
+	if b.Delay > 0 {
+		return b.Delay
+	}
+	return DefaultDelay
+}
+
+func (b *Backend) replica() keyvaluestore.Backend {
+	if b.Replica != nil {
+		return b.Replica
+	}
+	return b.Backend
+}
+
+type hedgeResult struct {
+	value interface{}
+	err   error
+}
+
+// hedge invokes f with the backend and, if it's slow or fails, with the replica. It returns the
+// first successful result, or the first error if both fail.
+func (b *Backend) hedge(operation, key string, f func(keyvaluestore.Backend) (interface{}, error)) (interface{}, error) {
+	startTime := time.Now()
+	results := make(chan hedgeResult, 2)
+	do := func(backend keyvaluestore.Backend) {
+		v, err := f(backend)
+		results <- hedgeResult{v, err}
+	}
+	go do(b.Backend)
+
+	timer := time.NewTimer(b.delay())
+	defer timer.Stop()
+
+	var firstErr error
+	select {
+	case r := <-results:
+		if r.err == nil {
+			return r.value, nil
+		}
+		firstErr = r.err
+	case <-timer.C:
+	}
+
+	go do(b.replica())
+
+	v, err := func() (interface{}, error) {
+		for {
+			r := <-results
+			if r.err == nil {
+				return r.value, nil
+			} else if firstErr != nil {
+				return nil, firstErr
+			}
+			firstErr = r.err
+		}
+	}()
+	if b.Profiler != nil && keyvaluestore.ShouldProfile(b.Profiler) {
+		b.Profiler.AddProfile(&keyvaluestore.Profile{
+			Operation: operation,
+			Key:       key,
+			Duration:  time.Since(startTime),
+			Err:       err,
+			Hedges:    1,
+		})
+	}
+	return v, err
+}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return b.Backend.AtomicWrite()
+}
+
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	return b.Backend.Batch()
+}
+
+func (b *Backend) Ping() error {
+	return b.Backend.Ping()
+}
+
+// Close closes both the backend and the replica, if there is one. If both fail, the backend's error
+// is returned.
+func (b *Backend) Close() error {
+	err := b.Backend.Close()
+	if b.Replica == nil {
+		return err
+	} else if replicaErr := b.Replica.Close(); err == nil {
+		err = replicaErr
+	}
+	return err
+}
+
+func (b *Backend) Get(key string) (*string, error) {
+	v, err := b.hedge("Get", key, func(backend keyvaluestore.Backend) (interface{}, error) {
+		return backend.Get(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*string), nil
+}
+
+func (b *Backend) HGet(key, field string) (*string, error) {
+	v, err := b.hedge("HGet", key, func(backend keyvaluestore.Backend) (interface{}, error) {
+		return backend.HGet(key, field)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*string), nil
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	v, err := b.hedge("ZScore", key, func(backend keyvaluestore.Backend) (interface{}, error) {
+		return backend.ZScore(key, member)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*float64), nil
+}
+
+func (b *Backend) Delete(key string) (bool, error) {
+	return b.Backend.Delete(key)
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	return b.Backend.Set(key, value)
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	return b.Backend.SetXX(key, value)
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	return b.Backend.SetNX(key, value)
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	return b.Backend.SetEQ(key, value, oldValue)
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	return b.Backend.NIncrBy(key, n)
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	return b.Backend.SAdd(key, member, members...)
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	return b.Backend.SRem(key, member, members...)
+}
+
+func (b *Backend) SMembers(key string) ([]string, error) {
+	return b.Backend.SMembers(key)
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	return b.Backend.HSet(key, field, value, fields...)
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	return b.Backend.HDel(key, field, fields...)
+}
+
+func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	return b.Backend.HGetAll(key)
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
+	return b.Backend.ZAdd(key, member, score)
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	return b.Backend.ZRem(key, member)
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	return b.Backend.ZIncrBy(key, member, n)
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	return b.Backend.ZCount(key, min, max)
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
+	return b.Backend.ZLexCount(key, min, max)
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	return b.Backend.ZHAdd(key, field, member, score)
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	return b.Backend.ZHMAdd(key, entries)
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	return b.Backend.ZHRem(key, field)
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	return b.Backend.ZHRemEQ(key, field, member)
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZHRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZHRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZHRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZHRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZHRevRangeByLex(key, min, max, limit)
+}
+
+func (b Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	b.Backend = b.Backend.WithProfiler(profiler)
+	if p, ok := profiler.(keyvaluestore.Profiler); ok {
+		b.Profiler = p
+	}
+	if b.Replica != nil {
+		b.Replica = b.Replica.WithProfiler(profiler)
+	}
+	return &b
+}
+
+func (b Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	b.Backend = b.Backend.WithEventuallyConsistentReads()
+	if b.Replica != nil {
+		b.Replica = b.Replica.WithEventuallyConsistentReads()
+	}
+	return &b
+}
+
+func (b Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	b.Backend = keyvaluestore.WithOptions(b.Backend, opts)
+	if b.Replica != nil {
+		b.Replica = keyvaluestore.WithOptions(b.Replica, opts)
+	}
+	return &b
+}
+
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return b.Backend
+}
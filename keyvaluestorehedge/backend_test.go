@@ -0,0 +1,145 @@
+package keyvaluestorehedge
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoremock"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return &Backend{
+			Backend: memorystore.NewBackend(),
+			Delay:   time.Millisecond,
+		}
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return &Backend{
+			Backend: b,
+			Delay:   time.Millisecond,
+		}
+	}, keyvaluestoretest.WrapperOptions{})
+}
+
+func constantGet(value string, delay time.Duration, err error) func(string) (*string, error) {
+	return func(key string) (*string, error) {
+		time.Sleep(delay)
+		if err != nil {
+			return nil, err
+		}
+		return &value, nil
+	}
+}
+
+func TestHedge(t *testing.T) {
+	errFoo := errors.New("foo")
+	errBar := errors.New("bar")
+
+	for name, tc := range map[string]struct {
+		Primary  func(string) (*string, error)
+		Replica  func(string) (*string, error)
+		Expected string
+		Error    error
+		Hedged   bool
+	}{
+		"Fast": {
+			Primary:  constantGet("primary", 0, nil),
+			Replica:  constantGet("replica", 0, nil),
+			Expected: "primary",
+		},
+		"Slow": {
+			Primary:  constantGet("primary", time.Second, nil),
+			Replica:  constantGet("replica", 0, nil),
+			Expected: "replica",
+			Hedged:   true,
+		},
+		"SlowReplica": {
+			Primary:  constantGet("primary", 50*time.Millisecond, nil),
+			Replica:  constantGet("replica", time.Second, nil),
+			Expected: "primary",
+			Hedged:   true,
+		},
+		"PrimaryError": {
+			Primary:  constantGet("", 0, errFoo),
+			Replica:  constantGet("replica", 0, nil),
+			Expected: "replica",
+			Hedged:   true,
+		},
+		"ReplicaError": {
+			Primary:  constantGet("primary", 50*time.Millisecond, nil),
+			Replica:  constantGet("", 0, errBar),
+			Expected: "primary",
+			Hedged:   true,
+		},
+		"BothErrors": {
+			Primary: constantGet("", 0, errFoo),
+			Replica: constantGet("", 0, errBar),
+			Error:   errFoo,
+			Hedged:  true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			primary := &keyvaluestoremock.Backend{GetFunc: tc.Primary}
+			replica := &keyvaluestoremock.Backend{GetFunc: tc.Replica}
+			profiler := &keyvaluestore.BasicProfiler{}
+			b := &Backend{
+				Backend:  primary,
+				Replica:  replica,
+				Delay:    10 * time.Millisecond,
+				Profiler: profiler,
+			}
+			v, err := b.Get("foo")
+			if tc.Error != nil {
+				assert.Equal(t, tc.Error, err)
+			} else {
+				require.NoError(t, err)
+				require.NotNil(t, v)
+				assert.Equal(t, tc.Expected, *v)
+			}
+			assert.Len(t, primary.CallsTo("Get"), 1)
+			if tc.Hedged {
+				assert.Len(t, replica.CallsTo("Get"), 1)
+				assert.Equal(t, 1, profiler.HedgeCount())
+			} else {
+				assert.Empty(t, replica.CallsTo("Get"))
+				assert.Equal(t, 0, profiler.HedgeCount())
+			}
+		})
+	}
+}
+
+func TestHedgeWithoutReplica(t *testing.T) {
+	var calls int32
+	mock := &keyvaluestoremock.Backend{
+		HGetFunc: func(key, field string) (*string, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				time.Sleep(time.Second)
+			}
+			v := "x"
+			return &v, nil
+		},
+	}
+	b := &Backend{
+		Backend: mock,
+		Delay:   10 * time.Millisecond,
+	}
+	start := time.Now()
+	v, err := b.HGet("foo", "bar")
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, "x", *v)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Len(t, mock.CallsTo("HGet"), 2)
+}
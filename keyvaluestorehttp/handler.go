@@ -0,0 +1,341 @@
+// Package keyvaluestorehttp provides an HTTP handler that exposes a backend's most common
+// operations as a JSON API. It's intended for debugging dashboards and low-volume integrations
+// that can't link this library, not as a replacement for it.
+package keyvaluestorehttp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// MaxRequestBodySize is the largest request body that the handler accepts.
+const MaxRequestBodySize = 1 << 20
+
+// Handler serves the following endpoints. Keys, fields, and members are path segments, so they
+// must be escaped if they contain slashes or other reserved characters.
+//
+//	GET    /keys/{key}                    Get, responding with {"value": "..."}
+//	PUT    /keys/{key}                    Set, given {"value": "..."}
+//	DELETE /keys/{key}                    Delete, responding with {"deleted": true}
+//	GET    /hashes/{key}                  HGetAll, responding with {"fields": {...}}
+//	GET    /hashes/{key}/{field}          HGet, responding with {"value": "..."}
+//	PUT    /hashes/{key}/{field}          HSet, given {"value": "..."}
+//	DELETE /hashes/{key}/{field}          HDel
+//	GET    /sets/{key}                    SMembers, responding with {"members": [...]}
+//	PUT    /sets/{key}/{member}           SAdd
+//	DELETE /sets/{key}/{member}           SRem
+//	GET    /sortedsets/{key}              ZRangeByScoreWithScores, responding with {"members": [{"value": "...", "score": 1}]}
+//	GET    /sortedsets/{key}/{member}     ZScore, responding with {"score": 1}
+//	PUT    /sortedsets/{key}/{member}     ZAdd, given {"score": 1}
+//	DELETE /sortedsets/{key}/{member}     ZRem
+//
+// Sorted sets are ranged via the optional min, max, and limit query parameters, which default to
+// the entire set. If reverse is "true", members are returned by descending score instead.
+//
+// Reads of missing keys, fields, and members respond with 404. Successful writes without a
+// response body respond with 204. Errors respond with {"error": "..."}, and the status reflects the
+// kind of error, e.g. 429 for keyvaluestore.ErrThrottled.
+type Handler struct {
+	Backend keyvaluestore.Backend
+
+	// If given, Authorize is invoked before each operation. If it returns an error, the request
+	// is rejected with 403. The operation's Write field can be used to limit clients to reads.
+	Authorize func(r *http.Request, op keyvaluestore.Operation, key string) error
+}
+
+var _ http.Handler = &Handler{}
+
+// errNotFound is returned by routes when the requested value doesn't exist.
+var errNotFound = errors.New("not found")
+
+// requestError is returned by routes when the request is malformed.
+type requestError struct {
+	message string
+}
+
+func (err *requestError) Error() string {
+	return err.message
+}
+
+type routeKey struct {
+	resource string
+	method   string
+
+	// hasArg is true if the path contains a field or member after the key.
+	hasArg bool
+}
+
+type route struct {
+	operation string
+
+	// serve performs the operation, returning the response body. If the body is nil, the response
+	// has no content.
+	serve func(b keyvaluestore.Backend, r *http.Request, key, arg string) (interface{}, error)
+}
+
+type valueBody struct {
+	Value *string `json:"value"`
+}
+
+type scoreBody struct {
+	Score *float64 `json:"score"`
+}
+
+type scoredMember struct {
+	Value string  `json:"value"`
+	Score float64 `json:"score"`
+}
+
+var routes = map[routeKey]route{
+	{"keys", http.MethodGet, false}: {"Get", func(b keyvaluestore.Backend, r *http.Request, key, _ string) (interface{}, error) {
+		v, err := b.Get(key)
+		if err != nil {
+			return nil, err
+		} else if v == nil {
+			return nil, errNotFound
+		}
+		return valueBody{Value: v}, nil
+	}},
+	{"keys", http.MethodPut, false}: {"Set", func(b keyvaluestore.Backend, r *http.Request, key, _ string) (interface{}, error) {
+		var body valueBody
+		if err := decodeBody(r, &body); err != nil {
+			return nil, err
+		} else if body.Value == nil {
+			return nil, &requestError{"a value is required"}
+		}
+		return nil, b.Set(key, *body.Value)
+	}},
+	{"keys", http.MethodDelete, false}: {"Delete", func(b keyvaluestore.Backend, r *http.Request, key, _ string) (interface{}, error) {
+		deleted, err := b.Delete(key)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]bool{"deleted": deleted}, nil
+	}},
+	{"hashes", http.MethodGet, false}: {"HGetAll", func(b keyvaluestore.Backend, r *http.Request, key, _ string) (interface{}, error) {
+		fields, err := b.HGetAll(key)
+		if err != nil {
+			return nil, err
+		} else if fields == nil {
+			fields = map[string]string{}
+		}
+		return map[string]map[string]string{"fields": fields}, nil
+	}},
+	{"hashes", http.MethodGet, true}: {"HGet", func(b keyvaluestore.Backend, r *http.Request, key, field string) (interface{}, error) {
+		v, err := b.HGet(key, field)
+		if err != nil {
+			return nil, err
+		} else if v == nil {
+			return nil, errNotFound
+		}
+		return valueBody{Value: v}, nil
+	}},
+	{"hashes", http.MethodPut, true}: {"HSet", func(b keyvaluestore.Backend, r *http.Request, key, field string) (interface{}, error) {
+		var body valueBody
+		if err := decodeBody(r, &body); err != nil {
+			return nil, err
+		} else if body.Value == nil {
+			return nil, &requestError{"a value is required"}
+		}
+		return nil, b.HSet(key, field, *body.Value)
+	}},
+	{"hashes", http.MethodDelete, true}: {"HDel", func(b keyvaluestore.Backend, r *http.Request, key, field string) (interface{}, error) {
+		return nil, b.HDel(key, field)
+	}},
+	{"sets", http.MethodGet, false}: {"SMembers", func(b keyvaluestore.Backend, r *http.Request, key, _ string) (interface{}, error) {
+		members, err := b.SMembers(key)
+		if err != nil {
+			return nil, err
+		} else if members == nil {
+			members = []string{}
+		}
+		return map[string][]string{"members": members}, nil
+	}},
+	{"sets", http.MethodPut, true}: {"SAdd", func(b keyvaluestore.Backend, r *http.Request, key, member string) (interface{}, error) {
+		return nil, b.SAdd(key, member)
+	}},
+	{"sets", http.MethodDelete, true}: {"SRem", func(b keyvaluestore.Backend, r *http.Request, key, member string) (interface{}, error) {
+		return nil, b.SRem(key, member)
+	}},
+	{"sortedsets", http.MethodGet, false}: {"ZRangeByScoreWithScores", func(b keyvaluestore.Backend, r *http.Request, key, _ string) (interface{}, error) {
+		query := r.URL.Query()
+		min, err := floatParameter(query, "min", math.Inf(-1))
+		if err != nil {
+			return nil, err
+		}
+		max, err := floatParameter(query, "max", math.Inf(1))
+		if err != nil {
+			return nil, err
+		}
+		limit := 0
+		if s := query.Get("limit"); s != "" {
+			if limit, err = strconv.Atoi(s); err != nil {
+				return nil, &requestError{"invalid limit: " + s}
+			}
+		}
+		var members keyvaluestore.ScoredMembers
+		if query.Get("reverse") == "true" {
+			members, err = b.ZRevRangeByScoreWithScores(key, min, max, limit)
+		} else {
+			members, err = b.ZRangeByScoreWithScores(key, min, max, limit)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]scoredMember, len(members))
+		for i, member := range members {
+			ret[i] = scoredMember{
+				Value: member.Value,
+				Score: member.Score,
+			}
+		}
+		return map[string][]scoredMember{"members": ret}, nil
+	}},
+	{"sortedsets", http.MethodGet, true}: {"ZScore", func(b keyvaluestore.Backend, r *http.Request, key, member string) (interface{}, error) {
+		score, err := b.ZScore(key, member)
+		if err != nil {
+			return nil, err
+		} else if score == nil {
+			return nil, errNotFound
+		}
+		return scoreBody{Score: score}, nil
+	}},
+	{"sortedsets", http.MethodPut, true}: {"ZAdd", func(b keyvaluestore.Backend, r *http.Request, key, member string) (interface{}, error) {
+		var body scoreBody
+		if err := decodeBody(r, &body); err != nil {
+			return nil, err
+		} else if body.Score == nil {
+			return nil, &requestError{"a score is required"}
+		}
+		return nil, b.ZAdd(key, member, *body.Score)
+	}},
+	{"sortedsets", http.MethodDelete, true}: {"ZRem", func(b keyvaluestore.Backend, r *http.Request, key, member string) (interface{}, error) {
+		return nil, b.ZRem(key, member)
+	}},
+}
+
+func decodeBody(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(io.LimitReader(r.Body, MaxRequestBodySize)).Decode(v); err != nil {
+		return &requestError{"invalid request body: " + err.Error()}
+	}
+	return nil
+}
+
+// floatParameter parses a query parameter. Infinities can be given as "-inf" and "+inf".
+func floatParameter(query url.Values, name string, defaultValue float64) (float64, error) {
+	s := query.Get(name)
+	if s == "" {
+		return defaultValue, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, &requestError{"invalid " + name + ": " + s}
+	}
+	return f, nil
+}
+
+// operation returns the description of the named operation.
+func operation(name string) keyvaluestore.Operation {
+	for _, op := range keyvaluestore.Operations {
+		if op.Name == name {
+			return op
+		}
+	}
+	return keyvaluestore.Operation{Name: name}
+}
+
+// pathSegments splits an escaped path into its unescaped segments.
+func pathSegments(path string) ([]string, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		s, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments[i] = s
+	}
+	return segments, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments, err := pathSegments(r.URL.EscapedPath())
+	if err != nil || len(segments) < 2 || len(segments) > 3 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	arg := ""
+	if len(segments) == 3 {
+		arg = segments[2]
+	}
+	route, ok := routes[routeKey{
+		resource: segments[0],
+		method:   r.Method,
+		hasArg:   len(segments) == 3,
+	}]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	key := segments[1]
+	if h.Authorize != nil {
+		if err := h.Authorize(r, operation(route.operation), key); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	body, err := route.serve(h.Backend, r, key, arg)
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	} else if body == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	buf, err := json.Marshal(body)
+	if err != nil {
+		// This happens if a sorted set has infinite scores, which JSON can't represent.
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf)
+}
+
+// errorStatus returns the HTTP status corresponding to an error returned by a route.
+func errorStatus(err error) int {
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		return http.StatusBadRequest
+	case errors.Is(err, errNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, keyvaluestore.ErrWrongType):
+		return http.StatusConflict
+	case errors.Is(err, keyvaluestore.ErrValueTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, keyvaluestore.ErrThrottled):
+		return http.StatusTooManyRequests
+	case errors.Is(err, keyvaluestore.ErrNotSupported):
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	buf, _ := json.Marshal(map[string]string{"error": message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(buf)
+}
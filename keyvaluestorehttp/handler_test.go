@@ -0,0 +1,179 @@
+package keyvaluestorehttp
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoremock"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func request(t *testing.T, h http.Handler, method, path, body string) (int, string) {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	buf, err := ioutil.ReadAll(w.Result().Body)
+	require.NoError(t, err)
+	return w.Code, strings.TrimSpace(string(buf))
+}
+
+func TestHandler(t *testing.T) {
+	b := memorystore.NewBackend()
+	h := &Handler{
+		Backend: b,
+	}
+
+	t.Run("Keys", func(t *testing.T) {
+		status, _ := request(t, h, "GET", "/keys/foo", "")
+		assert.Equal(t, http.StatusNotFound, status)
+
+		status, _ = request(t, h, "PUT", "/keys/foo", `{"value": "bar"}`)
+		assert.Equal(t, http.StatusNoContent, status)
+
+		status, body := request(t, h, "GET", "/keys/foo", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"value": "bar"}`, body)
+
+		status, _ = request(t, h, "PUT", "/keys/foo", `{}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		status, body = request(t, h, "DELETE", "/keys/foo", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"deleted": true}`, body)
+	})
+
+	t.Run("EscapedKeys", func(t *testing.T) {
+		require.NoError(t, b.Set("a/b c", "foo"))
+		status, body := request(t, h, "GET", "/keys/"+url.PathEscape("a/b c"), "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"value": "foo"}`, body)
+	})
+
+	t.Run("Hashes", func(t *testing.T) {
+		status, _ := request(t, h, "PUT", "/hashes/h/field", `{"value": "bar"}`)
+		assert.Equal(t, http.StatusNoContent, status)
+
+		status, body := request(t, h, "GET", "/hashes/h/field", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"value": "bar"}`, body)
+
+		status, body = request(t, h, "GET", "/hashes/h", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"fields": {"field": "bar"}}`, body)
+
+		status, _ = request(t, h, "DELETE", "/hashes/h/field", "")
+		assert.Equal(t, http.StatusNoContent, status)
+
+		status, _ = request(t, h, "GET", "/hashes/h/field", "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("Sets", func(t *testing.T) {
+		status, _ := request(t, h, "PUT", "/sets/s/a", "")
+		assert.Equal(t, http.StatusNoContent, status)
+
+		status, body := request(t, h, "GET", "/sets/s", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"members": ["a"]}`, body)
+
+		status, _ = request(t, h, "DELETE", "/sets/s/a", "")
+		assert.Equal(t, http.StatusNoContent, status)
+
+		status, body = request(t, h, "GET", "/sets/s", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"members": []}`, body)
+	})
+
+	t.Run("SortedSets", func(t *testing.T) {
+		status, _ := request(t, h, "PUT", "/sortedsets/z/a", `{"score": 1}`)
+		assert.Equal(t, http.StatusNoContent, status)
+		status, _ = request(t, h, "PUT", "/sortedsets/z/b", `{"score": 2.5}`)
+		assert.Equal(t, http.StatusNoContent, status)
+
+		status, body := request(t, h, "GET", "/sortedsets/z/b", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"score": 2.5}`, body)
+
+		status, body = request(t, h, "GET", "/sortedsets/z", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"members": [{"value": "a", "score": 1}, {"value": "b", "score": 2.5}]}`, body)
+
+		status, body = request(t, h, "GET", "/sortedsets/z?min=2&reverse=true&limit=1", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"members": [{"value": "b", "score": 2.5}]}`, body)
+
+		status, _ = request(t, h, "GET", "/sortedsets/z?min=x", "")
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		status, _ = request(t, h, "DELETE", "/sortedsets/z/a", "")
+		assert.Equal(t, http.StatusNoContent, status)
+
+		status, _ = request(t, h, "GET", "/sortedsets/z/a", "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("UnknownRoute", func(t *testing.T) {
+		status, _ := request(t, h, "POST", "/keys/foo", "")
+		assert.Equal(t, http.StatusNotFound, status)
+
+		status, _ = request(t, h, "GET", "/foo/bar", "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+}
+
+func TestHandlerErrors(t *testing.T) {
+	b := &keyvaluestoremock.Backend{
+		Errors: map[string]error{
+			"SAdd": &keyvaluestore.Error{Kind: keyvaluestore.ErrWrongType, Err: errors.New("not a set")},
+			"Get":  &keyvaluestore.Error{Kind: keyvaluestore.ErrThrottled, Err: errors.New("slow down")},
+		},
+	}
+	h := &Handler{
+		Backend: b,
+	}
+
+	status, body := request(t, h, "PUT", "/sets/foo/a", "")
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Contains(t, body, "not a set")
+
+	status, _ = request(t, h, "GET", "/keys/foo", "")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+}
+
+func TestHandlerAuthorize(t *testing.T) {
+	b := memorystore.NewBackend()
+	require.NoError(t, b.Set("foo", "bar"))
+
+	var keys []string
+	h := &Handler{
+		Backend: b,
+		Authorize: func(r *http.Request, op keyvaluestore.Operation, key string) error {
+			keys = append(keys, key)
+			if op.Write {
+				return errors.New("read only")
+			}
+			return nil
+		},
+	}
+
+	status, _ := request(t, h, "GET", "/keys/foo", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, body := request(t, h, "PUT", "/keys/foo", `{"value": "baz"}`)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.JSONEq(t, `{"error": "read only"}`, body)
+
+	v, err := b.Get("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", *v)
+	assert.Equal(t, []string{"foo", "foo"}, keys)
+}
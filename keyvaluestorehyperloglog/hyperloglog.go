@@ -0,0 +1,160 @@
+// Package keyvaluestorehyperloglog implements approximate distinct counters on top of any backend.
+package keyvaluestorehyperloglog
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// NativeBackend is implemented by backends with built-in HyperLogLogs, such as redisstore.Backend.
+type NativeBackend interface {
+	PFAdd(key string, element string, elements ...string) error
+	PFCount(key string) (int64, error)
+}
+
+// DefaultPrecision is the precision used by counters that don't specify one. It results in a
+// standard error of about 1.6% using 4 KiB per key.
+const DefaultPrecision = 12
+
+// Counter estimates the number of distinct elements added to each key using a fixed amount of
+// memory per key.
+//
+// If the backend implements NativeBackend, its HyperLogLogs are used. Otherwise each key's sketch is
+// stored as a string value and updated via keyvaluestore.Update. Since the two representations
+// aren't compatible, the same keys should always be used with the same kind of backend.
+type Counter struct {
+	Backend keyvaluestore.Backend
+
+	// Precision determines the number of registers in each sketch (2^Precision) and therefore its
+	// size and accuracy. The standard error is approximately 1.04 / sqrt(2^Precision). It must be
+	// between 4 and 16. If zero, DefaultPrecision is used. It's ignored by native backends.
+	Precision uint8
+}
+
+func (c *Counter) precision() uint8 {
+	if c.Precision == 0 {
+		return DefaultPrecision
+	}
+	return c.Precision
+}
+
+// Add adds elements to the key's set.
+func (c *Counter) Add(key string, element string, elements ...string) error {
+	if native, ok := c.Backend.(NativeBackend); ok {
+		return native.PFAdd(key, element, elements...)
+	}
+	p := c.precision()
+	if p < 4 || p > 16 {
+		return fmt.Errorf("invalid hyperloglog precision: %v", p)
+	}
+	return keyvaluestore.Update(c.Backend, key, func(prev *string) (*string, error) {
+		s, err := decodeSketch(prev, p)
+		if err != nil {
+			return nil, err
+		}
+		changed := s.add(element)
+		for _, element := range elements {
+			if s.add(element) {
+				changed = true
+			}
+		}
+		if !changed {
+			return nil, nil
+		}
+		encoded := string(s)
+		return &encoded, nil
+	})
+}
+
+// Count returns the approximate number of distinct elements added to the key.
+func (c *Counter) Count(key string) (int64, error) {
+	if native, ok := c.Backend.(NativeBackend); ok {
+		return native.PFCount(key)
+	}
+	v, err := c.Backend.Get(key)
+	if err != nil || v == nil {
+		return 0, err
+	}
+	s, err := decodeSketch(v, c.precision())
+	if err != nil {
+		return 0, err
+	}
+	return s.count(), nil
+}
+
+// sketch is a dense HyperLogLog. The first byte is the precision, and each subsequent byte is a
+// register.
+type sketch []byte
+
+func decodeSketch(v *string, p uint8) (sketch, error) {
+	if v == nil {
+		s := make(sketch, 1+(1<<p))
+		s[0] = p
+		return s, nil
+	}
+	s := sketch(*v)
+	if len(s) == 0 || s[0] < 4 || s[0] > 16 || len(s) != 1+(1<<s[0]) {
+		return nil, fmt.Errorf("malformed hyperloglog: %w", keyvaluestore.ErrWrongType)
+	}
+	return s, nil
+}
+
+func hash(element string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(element))
+	// FNV's high bits are poorly distributed for short inputs, so they're mixed using the
+	// SplitMix64 finalizer.
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// add adds the element to the sketch and returns true if a register changed.
+func (s sketch) add(element string) bool {
+	p := s[0]
+	h := hash(element)
+	index := 1 + (h >> (64 - p))
+	rho := uint8(bits.LeadingZeros64(h<<p|1<<(p-1))) + 1
+	if rho > s[index] {
+		s[index] = rho
+		return true
+	}
+	return false
+}
+
+func (s sketch) count() int64 {
+	registers := s[1:]
+	m := float64(len(registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	var alpha float64
+	switch len(registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+	estimate := alpha * m * m / sum
+
+	// For small cardinalities, linear counting is more accurate.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
@@ -0,0 +1,55 @@
+package keyvaluestorehyperloglog_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorehyperloglog"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestCounter(t *testing.T) {
+	c := &keyvaluestorehyperloglog.Counter{
+		Backend: memorystore.NewBackend(),
+	}
+
+	n, err := c.Count("visitors")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	require.NoError(t, c.Add("visitors", "a", "b", "c"))
+	require.NoError(t, c.Add("visitors", "a"))
+	require.NoError(t, c.Add("visitors", "c", "b"))
+	n, err = c.Count("visitors")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	const distinct = 100000
+	for i := 0; i < distinct; i += 100 {
+		elements := make([]string, 100)
+		for j := range elements {
+			elements[j] = strconv.Itoa(i + j)
+		}
+		require.NoError(t, c.Add("large", elements[0], elements[1:]...))
+	}
+	n, err = c.Count("large")
+	require.NoError(t, err)
+	assert.InEpsilon(t, distinct, n, 0.05)
+}
+
+func TestCounterWrongType(t *testing.T) {
+	b := memorystore.NewBackend()
+	require.NoError(t, b.Set("visitors", "foo"))
+
+	c := &keyvaluestorehyperloglog.Counter{
+		Backend: b,
+	}
+	_, err := c.Count("visitors")
+	assert.True(t, errors.Is(err, keyvaluestore.ErrWrongType))
+	assert.True(t, errors.Is(c.Add("visitors", "a"), keyvaluestore.ErrWrongType))
+}
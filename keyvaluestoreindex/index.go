@@ -0,0 +1,177 @@
+// Package keyvaluestoreindex maintains secondary indexes of records within atomic writes.
+package keyvaluestoreindex
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Kind determines how records are added to an index.
+type Kind int
+
+const (
+	// Set indexes add the record's key to the set at the index key.
+	Set Kind = iota
+
+	// SortedSet indexes add the record's key to the sorted set at the index key, using the field's
+	// value as the score. The value must be a number.
+	SortedSet
+
+	// Unique indexes set the index key to the record's key. The atomic write is aborted if another
+	// record already has the same value.
+	Unique
+)
+
+// Index is the definition of a secondary index on one of a record's fields.
+type Index struct {
+	Field string
+	Kind  Kind
+
+	// Key returns the index key for the field's value. For Set and Unique indexes, this typically
+	// includes the value, e.g. keyvaluestore.Key{"user_by_username", value}.String(). For
+	// SortedSet indexes, it's typically a constant.
+	Key func(value string) string
+}
+
+// Record is a record's value along with the values of its indexed fields. Fields that aren't
+// present aren't indexed.
+type Record struct {
+	Value  interface{}
+	Fields map[string]string
+}
+
+// Indexer adds the operations needed to keep records and their indexes consistent to atomic
+// writes. The writes must be executed by the caller, and each index may add up to two operations,
+// so the number of indexes is limited by keyvaluestore.MaxAtomicWriteOperations.
+type Indexer struct {
+	Indexes []Index
+}
+
+// Result reports why an atomic write that was prepared by an Indexer was aborted.
+type Result struct {
+	record keyvaluestore.AtomicWriteResult
+	unique map[string]keyvaluestore.AtomicWriteResult
+}
+
+// RecordConditionalFailed returns true if the write was aborted because the record didn't have the
+// expected value. For creations, this means that the record already exists.
+func (r *Result) RecordConditionalFailed() bool {
+	return r.record.ConditionalFailed()
+}
+
+// ConflictingField returns the field of a unique index whose value was already taken by another
+// record, or the empty string if there was no such conflict.
+func (r *Result) ConflictingField() string {
+	for field, result := range r.unique {
+		if result.ConditionalFailed() {
+			return field
+		}
+	}
+	return ""
+}
+
+// Create adds operations that create the record at the given key and add it to every index. The
+// write is aborted if the record already exists.
+func (ix *Indexer) Create(tx keyvaluestore.AtomicWriteOperation, key string, record *Record) (*Result, error) {
+	if err := ix.validate(record); err != nil {
+		return nil, err
+	}
+	result := &Result{
+		record: tx.SetNX(key, record.Value),
+		unique: map[string]keyvaluestore.AtomicWriteResult{},
+	}
+	for _, index := range ix.Indexes {
+		if value, ok := record.Fields[index.Field]; ok {
+			ix.add(tx, result, index, key, value)
+		}
+	}
+	return result, nil
+}
+
+// Update adds operations that replace the record at the given key and move it between indexes as
+// needed. The write is aborted if the record's current value isn't prev.Value, so prev should be
+// the record as it was read prior to the update.
+func (ix *Indexer) Update(tx keyvaluestore.AtomicWriteOperation, key string, prev, next *Record) (*Result, error) {
+	if err := ix.validate(next); err != nil {
+		return nil, err
+	}
+	result := &Result{
+		record: tx.SetEQ(key, next.Value, prev.Value),
+		unique: map[string]keyvaluestore.AtomicWriteResult{},
+	}
+	for _, index := range ix.Indexes {
+		prevValue, hadPrev := prev.Fields[index.Field]
+		nextValue, hasNext := next.Fields[index.Field]
+		if hadPrev && hasNext {
+			if prevValue == nextValue {
+				continue
+			} else if index.Key(prevValue) == index.Key(nextValue) {
+				// Some backends don't allow multiple operations on the same item within an atomic
+				// write, so the entry is updated in place.
+				if index.Kind == SortedSet {
+					ix.add(tx, result, index, key, nextValue)
+				}
+				continue
+			}
+		}
+		if hadPrev {
+			ix.remove(tx, index, key, prevValue)
+		}
+		if hasNext {
+			ix.add(tx, result, index, key, nextValue)
+		}
+	}
+	return result, nil
+}
+
+// Delete adds operations that delete the record at the given key and remove it from every index.
+// prev must be the record as it was last read. The write is aborted if the record doesn't exist,
+// but unlike Update, it isn't aborted if the record has changed, so concurrent updates and deletes
+// of the same record need to be coordinated some other way, e.g. with keyvaluestorelock.
+func (ix *Indexer) Delete(tx keyvaluestore.AtomicWriteOperation, key string, prev *Record) *Result {
+	result := &Result{
+		record: tx.DeleteXX(key),
+	}
+	for _, index := range ix.Indexes {
+		if value, ok := prev.Fields[index.Field]; ok {
+			ix.remove(tx, index, key, value)
+		}
+	}
+	return result
+}
+
+func (ix *Indexer) validate(record *Record) error {
+	for _, index := range ix.Indexes {
+		if value, ok := record.Fields[index.Field]; ok && index.Kind == SortedSet {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("invalid value for sorted set index on %v: %v", index.Field, value)
+			}
+		}
+	}
+	return nil
+}
+
+func (ix *Indexer) add(tx keyvaluestore.AtomicWriteOperation, result *Result, index Index, key, value string) {
+	switch index.Kind {
+	case Set:
+		tx.SAdd(index.Key(value), key)
+	case SortedSet:
+		score, _ := strconv.ParseFloat(value, 64)
+		tx.ZAdd(index.Key(value), key, score)
+	case Unique:
+		result.unique[index.Field] = tx.SetNX(index.Key(value), key)
+	}
+}
+
+func (ix *Indexer) remove(tx keyvaluestore.AtomicWriteOperation, index Index, key, value string) {
+	switch index.Kind {
+	case Set:
+		tx.SRem(index.Key(value), key)
+	case SortedSet:
+		tx.ZRem(index.Key(value), key)
+	case Unique:
+		tx.Delete(index.Key(value))
+	}
+}
@@ -0,0 +1,161 @@
+package keyvaluestoreindex_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreindex"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+var indexer = &keyvaluestoreindex.Indexer{
+	Indexes: []keyvaluestoreindex.Index{
+		{
+			Field: "username",
+			Kind:  keyvaluestoreindex.Unique,
+			Key: func(value string) string {
+				return keyvaluestore.Key{"user_by_username", value}.String()
+			},
+		},
+		{
+			Field: "team",
+			Kind:  keyvaluestoreindex.Set,
+			Key: func(value string) string {
+				return keyvaluestore.Key{"team_users", value}.String()
+			},
+		},
+		{
+			Field: "score",
+			Kind:  keyvaluestoreindex.SortedSet,
+			Key: func(value string) string {
+				return "users_by_score"
+			},
+		},
+	},
+}
+
+func user(username, team, score string) *keyvaluestoreindex.Record {
+	fields := map[string]string{
+		"username": username,
+		"score":    score,
+	}
+	if team != "" {
+		fields["team"] = team
+	}
+	return &keyvaluestoreindex.Record{
+		Value:  username + "/" + team + "/" + score,
+		Fields: fields,
+	}
+}
+
+func TestIndexer(t *testing.T) {
+	b := memorystore.NewBackend()
+
+	exec := func(f func(tx keyvaluestore.AtomicWriteOperation) (*keyvaluestoreindex.Result, error)) (bool, *keyvaluestoreindex.Result) {
+		tx := b.AtomicWrite()
+		result, err := f(tx)
+		require.NoError(t, err)
+		ok, err := tx.Exec()
+		require.NoError(t, err)
+		return ok, result
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		ok, _ := exec(func(tx keyvaluestore.AtomicWriteOperation) (*keyvaluestoreindex.Result, error) {
+			return indexer.Create(tx, "user:1", user("alice", "red", "10"))
+		})
+		require.True(t, ok)
+		ok, _ = exec(func(tx keyvaluestore.AtomicWriteOperation) (*keyvaluestoreindex.Result, error) {
+			return indexer.Create(tx, "user:2", user("bob", "red", "20"))
+		})
+		require.True(t, ok)
+
+		v, err := b.Get("user_by_username:alice")
+		require.NoError(t, err)
+		assert.Equal(t, "user:1", *v)
+		members, err := b.SMembers("team_users:red")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"user:1", "user:2"}, members)
+		members, err = b.ZRangeByScore("users_by_score", math.Inf(-1), math.Inf(1), 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user:1", "user:2"}, members)
+	})
+
+	t.Run("Conflicts", func(t *testing.T) {
+		ok, result := exec(func(tx keyvaluestore.AtomicWriteOperation) (*keyvaluestoreindex.Result, error) {
+			return indexer.Create(tx, "user:3", user("alice", "blue", "30"))
+		})
+		assert.False(t, ok)
+		assert.False(t, result.RecordConditionalFailed())
+		assert.Equal(t, "username", result.ConflictingField())
+
+		ok, result = exec(func(tx keyvaluestore.AtomicWriteOperation) (*keyvaluestoreindex.Result, error) {
+			return indexer.Create(tx, "user:1", user("carol", "blue", "30"))
+		})
+		assert.False(t, ok)
+		assert.True(t, result.RecordConditionalFailed())
+		assert.Equal(t, "", result.ConflictingField())
+
+		ok, result = exec(func(tx keyvaluestore.AtomicWriteOperation) (*keyvaluestoreindex.Result, error) {
+			return indexer.Update(tx, "user:1", user("alice", "blue", "10"), user("alice", "red", "15"))
+		})
+		assert.False(t, ok)
+		assert.True(t, result.RecordConditionalFailed())
+
+		_, err := indexer.Create(b.AtomicWrite(), "user:3", user("carol", "blue", "x"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		ok, _ := exec(func(tx keyvaluestore.AtomicWriteOperation) (*keyvaluestoreindex.Result, error) {
+			return indexer.Update(tx, "user:1", user("alice", "red", "10"), user("alicia", "", "30"))
+		})
+		require.True(t, ok)
+
+		v, err := b.Get("user:1")
+		require.NoError(t, err)
+		assert.Equal(t, "alicia//30", *v)
+		v, err = b.Get("user_by_username:alice")
+		require.NoError(t, err)
+		assert.Nil(t, v)
+		v, err = b.Get("user_by_username:alicia")
+		require.NoError(t, err)
+		assert.Equal(t, "user:1", *v)
+		members, err := b.SMembers("team_users:red")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user:2"}, members)
+		members, err = b.ZRangeByScore("users_by_score", math.Inf(-1), math.Inf(1), 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user:2", "user:1"}, members)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ok, _ := exec(func(tx keyvaluestore.AtomicWriteOperation) (*keyvaluestoreindex.Result, error) {
+			return indexer.Delete(tx, "user:2", user("bob", "red", "20")), nil
+		})
+		require.True(t, ok)
+
+		v, err := b.Get("user:2")
+		require.NoError(t, err)
+		assert.Nil(t, v)
+		v, err = b.Get("user_by_username:bob")
+		require.NoError(t, err)
+		assert.Nil(t, v)
+		members, err := b.SMembers("team_users:red")
+		require.NoError(t, err)
+		assert.Empty(t, members)
+		members, err = b.ZRangeByScore("users_by_score", math.Inf(-1), math.Inf(1), 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user:1"}, members)
+
+		ok, result := exec(func(tx keyvaluestore.AtomicWriteOperation) (*keyvaluestoreindex.Result, error) {
+			return indexer.Delete(tx, "user:2", user("bob", "red", "20")), nil
+		})
+		assert.False(t, ok)
+		assert.True(t, result.RecordConditionalFailed())
+	})
+}
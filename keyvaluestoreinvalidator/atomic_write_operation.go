@@ -53,11 +53,21 @@ func (op *atomicWriteOperation) ZHAdd(key, field string, member interface{}, sco
 	return op.atomicWrite.ZHAdd(key, field, member, score)
 }
 
+func (op *atomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	op.invalidations = append(op.invalidations, key)
+	return op.atomicWrite.ZHMAdd(key, entries)
+}
+
 func (op *atomicWriteOperation) ZAddNX(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
 	op.invalidations = append(op.invalidations, key)
 	return op.atomicWrite.ZAddNX(key, member, score)
 }
 
+func (op *atomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	op.invalidations = append(op.invalidations, key)
+	return op.atomicWrite.ZHSetEQ(key, field, member, oldMember, score)
+}
+
 func (op *atomicWriteOperation) ZRem(key string, member interface{}) keyvaluestore.AtomicWriteResult {
 	op.invalidations = append(op.invalidations, key)
 	return op.atomicWrite.ZRem(key, member)
@@ -68,6 +78,11 @@ func (op *atomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWri
 	return op.atomicWrite.ZHRem(key, field)
 }
 
+func (op *atomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	op.invalidations = append(op.invalidations, key)
+	return op.atomicWrite.ZHRemEQ(key, field, member)
+}
+
 func (op *atomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
 	op.invalidations = append(op.invalidations, key)
 	return op.atomicWrite.SAdd(key, member, members...)
@@ -93,12 +108,19 @@ func (op *atomicWriteOperation) HDel(key, field string, fields ...string) keyval
 	return op.atomicWrite.HDel(key, field, fields...)
 }
 
+func (op *atomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.atomicWrite.WithIdempotencyToken(token)
+	return op
+}
+
+func (op *atomicWriteOperation) Validate() error {
+	return op.atomicWrite.Validate()
+}
+
 func (op *atomicWriteOperation) Exec() (bool, error) {
 	ret, err := op.atomicWrite.Exec()
 	// invalidate everything, always. if the transaction wasn't committed, one of the values
 	// probably wasn't what the client was expecting and they may want to refetch it and try again
-	for _, key := range op.invalidations {
-		op.invalidator.Invalidate(key)
-	}
+	op.invalidator.invalidateMany(op.invalidations)
 	return ret, err
 }
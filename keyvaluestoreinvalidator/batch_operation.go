@@ -41,6 +41,11 @@ func (op *batchOperation) ZAdd(key string, member interface{}, score float64) ke
 	return op.batch.ZAdd(key, member, score)
 }
 
+func (op *batchOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.ErrorResult {
+	op.invalidations = append(op.invalidations, key)
+	return op.batch.ZHMAdd(key, entries)
+}
+
 func (op *batchOperation) ZRem(key string, member interface{}) keyvaluestore.ErrorResult {
 	op.invalidations = append(op.invalidations, key)
 	return op.batch.ZRem(key, member)
@@ -50,10 +55,28 @@ func (op *batchOperation) ZScore(key string, member interface{}) keyvaluestore.Z
 	return op.batch.ZScore(key, member)
 }
 
+func (op *batchOperation) ZHRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRangeByScore(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRangeByLex(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRevRangeByLex(key, min, max, limit)
+}
+
+func (op *batchOperation) Len() int {
+	return op.batch.Len()
+}
+
 func (op *batchOperation) Exec() error {
 	err := op.batch.Exec()
-	for _, key := range op.invalidations {
-		op.invalidator.Invalidate(key)
-	}
+	op.invalidator.invalidateMany(op.invalidations)
 	return err
 }
@@ -9,10 +9,37 @@ import (
 type Invalidator struct {
 	Backend    keyvaluestore.Backend
 	Invalidate func(key string)
+
+	// If given, batches and atomic writes invoke InvalidateMany once with the deduplicated keys they
+	// may have impacted instead of invoking Invalidate for each one. This lets remote transports
+	// send a single message per Exec, e.g. via PublishInvalidationBatches. Invalidate is still
+	// required for other operations.
+	InvalidateMany func(keys []string)
 }
 
 var _ keyvaluestore.Backend = &Invalidator{}
 
+func (c *Invalidator) invalidateMany(keys []string) {
+	if c.InvalidateMany == nil {
+		for _, key := range keys {
+			c.Invalidate(key)
+		}
+		return
+	}
+	if len(keys) == 0 {
+		return
+	}
+	seen := make(map[string]struct{}, len(keys))
+	deduplicated := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			deduplicated = append(deduplicated, key)
+		}
+	}
+	c.InvalidateMany(deduplicated)
+}
+
 func (c *Invalidator) AtomicWrite() keyvaluestore.AtomicWriteOperation {
 	return &atomicWriteOperation{
 		invalidator: c,
@@ -27,6 +54,14 @@ func (c *Invalidator) Batch() keyvaluestore.BatchOperation {
 	}
 }
 
+func (c *Invalidator) Ping() error {
+	return c.Backend.Ping()
+}
+
+func (c *Invalidator) Close() error {
+	return c.Backend.Close()
+}
+
 func (c *Invalidator) Delete(key string) (success bool, err error) {
 	success, err = c.Backend.Delete(key)
 	c.Invalidate(key)
@@ -115,6 +150,12 @@ func (c *Invalidator) ZHAdd(key, field string, member interface{}, score float64
 	return err
 }
 
+func (c *Invalidator) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	err := c.Backend.ZHMAdd(key, entries)
+	c.Invalidate(key)
+	return err
+}
+
 func (c *Invalidator) ZScore(key string, member interface{}) (*float64, error) {
 	return c.Backend.ZScore(key, member)
 }
@@ -137,6 +178,12 @@ func (c *Invalidator) ZHRem(key, field string) error {
 	return err
 }
 
+func (c *Invalidator) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	ok, err := c.Backend.ZHRemEQ(key, field, member)
+	c.Invalidate(key)
+	return ok, err
+}
+
 func (c *Invalidator) ZCount(key string, min, max float64) (int, error) {
 	return c.Backend.ZCount(key, min, max)
 }
@@ -193,6 +240,36 @@ func (c *Invalidator) ZHRevRangeByLex(key string, min, max string, limit int) ([
 	return c.Backend.ZHRevRangeByLex(key, min, max, limit)
 }
 
+var _ keyvaluestore.SortedHashFieldRanger = &Invalidator{}
+
+func (c *Invalidator) ZHRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRangeByScoreWithFields(c.Backend, key, min, max, limit)
+}
+
+func (c *Invalidator) ZHRevRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRevRangeByScoreWithFields(c.Backend, key, min, max, limit)
+}
+
+func (c *Invalidator) ZHRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRangeByLexWithFields(c.Backend, key, min, max, limit)
+}
+
+func (c *Invalidator) ZHRevRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRevRangeByLexWithFields(c.Backend, key, min, max, limit)
+}
+
+var _ keyvaluestore.MultiExister = &Invalidator{}
+
+func (c *Invalidator) ExistsMulti(keys ...string) (map[string]bool, error) {
+	return keyvaluestore.ExistsMulti(c.Backend, keys...)
+}
+
+var _ keyvaluestore.MultiSortedSetRanger = &Invalidator{}
+
+func (c *Invalidator) ZRangeByScoreMulti(keys []string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return keyvaluestore.ZRangeByScoreMulti(c.Backend, keys, min, max, limit)
+}
+
 func (c Invalidator) WithProfiler(profiler interface{}) keyvaluestore.Backend {
 	c.Backend = c.Backend.WithProfiler(profiler)
 	return &c
@@ -203,6 +280,11 @@ func (c Invalidator) WithEventuallyConsistentReads() keyvaluestore.Backend {
 	return &c
 }
 
+func (c Invalidator) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	c.Backend = keyvaluestore.WithOptions(c.Backend, opts)
+	return &c
+}
+
 func (c *Invalidator) Unwrap() keyvaluestore.Backend {
 	return c.Backend
 }
@@ -2,6 +2,10 @@ package keyvaluestoreinvalidator_test
 
 import (
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ccbrown/keyvaluestore"
 	"github.com/ccbrown/keyvaluestore/keyvaluestoreinvalidator"
@@ -17,3 +21,129 @@ func TestReadCache(t *testing.T) {
 		}
 	})
 }
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return &keyvaluestoreinvalidator.Invalidator{
+			Backend:    b,
+			Invalidate: func(string) {},
+		}
+	}, keyvaluestoretest.WrapperOptions{})
+}
+
+type testWatcher struct {
+	ch chan struct{}
+}
+
+func (w *testWatcher) Watch(key string) (<-chan struct{}, func()) {
+	return w.ch, func() {
+		close(w.ch)
+	}
+}
+
+func TestInvalidateOnChange(t *testing.T) {
+	w := &testWatcher{
+		ch: make(chan struct{}),
+	}
+	invalidated := make(chan string)
+	cancel := keyvaluestoreinvalidator.InvalidateOnChange(w, "foo", func(key string) {
+		invalidated <- key
+	})
+	defer cancel()
+
+	w.ch <- struct{}{}
+	assert.Equal(t, "foo", <-invalidated)
+
+	w.ch <- struct{}{}
+	assert.Equal(t, "foo", <-invalidated)
+}
+
+func TestInvalidateOnMessage(t *testing.T) {
+	bus := memorystore.NewBackend()
+
+	invalidated := make(chan string)
+	cancel, err := keyvaluestoreinvalidator.InvalidateOnMessage(bus, "invalidations", func(key string) {
+		invalidated <- key
+	})
+	require.NoError(t, err)
+	defer cancel()
+
+	b := &keyvaluestoreinvalidator.Invalidator{
+		Backend:    memorystore.NewBackend(),
+		Invalidate: keyvaluestoreinvalidator.PublishInvalidations(bus, "invalidations", nil),
+	}
+	require.NoError(t, b.Set("foo", "bar"))
+	assert.Equal(t, "foo", <-invalidated)
+}
+
+func TestInvalidateOnBatchMessage(t *testing.T) {
+	bus := memorystore.NewBackend()
+
+	messages, cancelMessages, err := bus.Subscribe("invalidations")
+	require.NoError(t, err)
+	defer cancelMessages()
+
+	invalidated := make(chan string, 10)
+	cancel, err := keyvaluestoreinvalidator.InvalidateOnBatchMessage(bus, "invalidations", func(key string) {
+		invalidated <- key
+	})
+	require.NoError(t, err)
+	defer cancel()
+
+	b := &keyvaluestoreinvalidator.Invalidator{
+		Backend:        memorystore.NewBackend(),
+		Invalidate:     keyvaluestoreinvalidator.PublishInvalidations(bus, "invalidations", nil),
+		InvalidateMany: keyvaluestoreinvalidator.PublishInvalidationBatches(bus, "invalidations", nil),
+	}
+
+	batch := b.Batch()
+	batch.Set("foo", "x")
+	batch.Set("bar", "x")
+	batch.Delete("foo")
+	require.NoError(t, batch.Exec())
+
+	// The keys are deduplicated and published as a single message.
+	<-messages
+	assert.Equal(t, "foo", <-invalidated)
+	assert.Equal(t, "bar", <-invalidated)
+
+	tx := b.AtomicWrite()
+	tx.Set("baz", "x")
+	_, err = tx.Exec()
+	require.NoError(t, err)
+
+	<-messages
+	assert.Equal(t, "baz", <-invalidated)
+	assert.Len(t, messages, 0)
+	assert.Len(t, invalidated, 0)
+}
+
+func TestDebounce(t *testing.T) {
+	invalidated := make(chan string, 10)
+	invalidate := keyvaluestoreinvalidator.Debounce(func(key string) {
+		invalidated <- key
+	}, 10*time.Millisecond)
+
+	invalidate("foo")
+	invalidate("foo")
+	invalidate("bar")
+	invalidate("foo")
+	assert.ElementsMatch(t, []string{"foo", "bar"}, []string{<-invalidated, <-invalidated})
+
+	// Once the invalidation is delivered, the key can be invalidated again.
+	invalidate("foo")
+	assert.Equal(t, "foo", <-invalidated)
+	assert.Len(t, invalidated, 0)
+}
+
+func TestInvalidation(t *testing.T) {
+	invalidated := map[string]bool{}
+	keyvaluestoretest.TestInvalidation(t, &keyvaluestoreinvalidator.Invalidator{
+		Backend: memorystore.NewBackend(),
+		Invalidate: func(key string) {
+			invalidated[key] = true
+		},
+	}, func(key string) bool {
+		return invalidated[key]
+	})
+}
@@ -0,0 +1,120 @@
+package keyvaluestoreinvalidator
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Watcher is implemented by backends that can notify of changes to keys, including changes made by
+// other processes. Every keyvaluestore.ObservableBackend implements it.
+type Watcher interface {
+	// Watch notifies the returned channel whenever the key changes until the returned function is
+	// invoked, at which point the channel is closed.
+	Watch(key string) (<-chan struct{}, func())
+}
+
+// InvalidateOnChange invokes invalidate each time the given key changes. This allows caches to
+// react to writes made by other processes without polling. The returned function stops the watch.
+func InvalidateOnChange(w Watcher, key string, invalidate func(key string)) func() {
+	ch, cancel := w.Watch(key)
+	go func() {
+		for range ch {
+			invalidate(key)
+		}
+	}()
+	return cancel
+}
+
+// PublishInvalidations returns a function suitable for Invalidator.Invalidate that publishes each
+// invalidated key to the given channel. Subscribers can use InvalidateOnMessage to invalidate their
+// own caches. Since invalidation is best-effort, errors are passed to onError, which may be nil.
+func PublishInvalidations(p keyvaluestore.Publisher, channel string, onError func(error)) func(key string) {
+	return func(key string) {
+		if err := p.Publish(channel, key); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// InvalidateOnMessage invokes invalidate for each key published to the given channel, e.g. via
+// PublishInvalidations. The returned function stops the subscription.
+func InvalidateOnMessage(s keyvaluestore.Subscriber, channel string, invalidate func(key string)) (func(), error) {
+	ch, cancel, err := s.Subscribe(channel)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for key := range ch {
+			invalidate(key)
+		}
+	}()
+	return cancel, nil
+}
+
+// PublishInvalidationBatches returns a function suitable for Invalidator.InvalidateMany that
+// publishes each batch of invalidated keys to the given channel as a single message. Subscribers
+// must use InvalidateOnBatchMessage rather than InvalidateOnMessage. Since invalidation is
+// best-effort, errors are passed to onError, which may be nil.
+func PublishInvalidationBatches(p keyvaluestore.Publisher, channel string, onError func(error)) func(keys []string) {
+	return func(keys []string) {
+		message, err := json.Marshal(keys)
+		if err == nil {
+			err = p.Publish(channel, string(message))
+		}
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// InvalidateOnBatchMessage invokes invalidate for each key in the batches published to the given
+// channel via PublishInvalidationBatches. Messages that aren't batches are ignored. The returned
+// function stops the subscription.
+func InvalidateOnBatchMessage(s keyvaluestore.Subscriber, channel string, invalidate func(key string)) (func(), error) {
+	ch, cancel, err := s.Subscribe(channel)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for message := range ch {
+			var keys []string
+			if err := json.Unmarshal([]byte(message), &keys); err != nil {
+				continue
+			}
+			for _, key := range keys {
+				invalidate(key)
+			}
+		}
+	}()
+	return cancel, nil
+}
+
+// Debounce returns a function suitable for Invalidator.Invalidate that coalesces invalidations of
+// the same key. The first invalidation of a key schedules invalidate to be invoked after the given
+// delay, and further invalidations of the key are dropped until then. This prevents hot keys that
+// are written frequently from flooding a fleet with invalidations, e.g. when wrapping
+// PublishInvalidations or the function given to InvalidateOnMessage.
+//
+// Caches may serve values that are up to delay old, so it should be short relative to how stale
+// reads are allowed to be.
+func Debounce(invalidate func(key string), delay time.Duration) func(key string) {
+	var mutex sync.Mutex
+	pending := map[string]struct{}{}
+	return func(key string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if _, ok := pending[key]; ok {
+			return
+		}
+		pending[key] = struct{}{}
+		time.AfterFunc(delay, func() {
+			mutex.Lock()
+			delete(pending, key)
+			mutex.Unlock()
+			invalidate(key)
+		})
+	}
+}
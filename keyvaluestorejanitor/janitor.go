@@ -0,0 +1,253 @@
+// Package keyvaluestorejanitor runs periodic maintenance tasks, such as trimming sorted sets or
+// purging expired data, on behalf of the other packages.
+package keyvaluestorejanitor
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore/keyvaluestorelock"
+)
+
+// Result describes a single run of a task.
+type Result struct {
+	// Processed is the number of items, such as keys or members, that the run cleaned up.
+	Processed int
+
+	// More indicates that the run stopped before finishing its work, e.g. because of a limit on
+	// the number of removals. The task is run again after its Pace instead of its Interval.
+	More bool
+}
+
+// Task is a maintenance task that's run periodically by a Janitor. Tasks should be idempotent, since
+// a run may be repeated after a failure or, rarely, overlap with a run in another process when
+// leadership changes.
+type Task struct {
+	// Name identifies the task in stats and errors. Names must be unique within a janitor.
+	Name string
+
+	// Interval is the time between runs.
+	Interval time.Duration
+
+	// Pace is the time to wait before running again when a run reports that it has more work to
+	// do. Small delays spread large cleanups out instead of concentrating writes on the backend.
+	Pace time.Duration
+
+	// Run performs a single run of the task.
+	Run func() (Result, error)
+}
+
+// Elector determines whether this process should run tasks. Only one of the processes sharing a
+// backend typically needs to perform maintenance.
+type Elector interface {
+	// IsLeader is invoked before each run. Runs are skipped if it returns false.
+	IsLeader() (bool, error)
+}
+
+// MutexElector elects a leader via a distributed lock. The lock is acquired or renewed before each
+// run, so TTL should be longer than the longest time between runs of the janitor's tasks, or
+// leadership will change hands frequently.
+type MutexElector struct {
+	Mutex *keyvaluestorelock.Mutex
+	TTL   time.Duration
+}
+
+func (e *MutexElector) IsLeader() (bool, error) {
+	return e.Mutex.Acquire(e.TTL)
+}
+
+// TaskStats holds the statistics for a single task.
+type TaskStats struct {
+	Runs   int64
+	Errors int64
+
+	// Skipped is the number of runs skipped because the process wasn't the leader.
+	Skipped int64
+
+	// Processed is the total number of items processed by all runs.
+	Processed int64
+
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    string `json:",omitempty"`
+}
+
+// Janitor runs tasks on their schedules. It implements expvar.Var, so its stats can be published
+// via expvar.Publish. It's safe for concurrent use.
+type Janitor struct {
+	// If given, tasks are only run while the elector reports that this process is the leader.
+	Elector Elector
+
+	// If given, OnError is invoked with errors returned by tasks or the elector.
+	OnError func(task string, err error)
+
+	mutex   sync.Mutex
+	tasks   map[string]*Task
+	stats   map[string]*TaskStats
+	running bool
+}
+
+var _ expvar.Var = (*Janitor)(nil)
+
+// Register adds a task to the janitor. Tasks registered after Start has been invoked aren't run
+// until the janitor is started again.
+func (j *Janitor) Register(task Task) error {
+	if task.Name == "" {
+		return fmt.Errorf("tasks must have names")
+	} else if task.Interval <= 0 {
+		return fmt.Errorf("task %v must have a positive interval", task.Name)
+	} else if task.Run == nil {
+		return fmt.Errorf("task %v must have a run function", task.Name)
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if _, ok := j.tasks[task.Name]; ok {
+		return fmt.Errorf("task %v is already registered", task.Name)
+	}
+	if j.tasks == nil {
+		j.tasks = map[string]*Task{}
+		j.stats = map[string]*TaskStats{}
+	}
+	j.tasks[task.Name] = &task
+	j.stats[task.Name] = &TaskStats{}
+	return nil
+}
+
+// Run runs the named task once, subject to the elector. It returns false if the run was skipped
+// because the process isn't the leader. It can be used to trigger tasks manually, e.g. from an
+// admin endpoint.
+func (j *Janitor) Run(name string) (Result, bool, error) {
+	j.mutex.Lock()
+	task, ok := j.tasks[name]
+	j.mutex.Unlock()
+	if !ok {
+		return Result{}, false, fmt.Errorf("unknown task: %v", name)
+	}
+	return j.run(task)
+}
+
+func (j *Janitor) run(task *Task) (Result, bool, error) {
+	if j.Elector != nil {
+		if leader, err := j.Elector.IsLeader(); err != nil {
+			return Result{}, false, fmt.Errorf("unable to determine leadership: %w", err)
+		} else if !leader {
+			j.mutex.Lock()
+			j.stats[task.Name].Skipped++
+			j.mutex.Unlock()
+			return Result{}, false, nil
+		}
+	}
+
+	start := time.Now()
+	result, err := task.Run()
+	duration := time.Since(start)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	stats := j.stats[task.Name]
+	stats.Runs++
+	stats.Processed += int64(result.Processed)
+	stats.LastRun = start
+	stats.LastDuration = duration
+	stats.LastError = ""
+	if err != nil {
+		stats.Errors++
+		stats.LastError = err.Error()
+	}
+	return result, true, err
+}
+
+// Start runs each registered task in the background, starting one interval from now, until the
+// returned function is invoked. The returned function waits for any runs in progress to complete.
+func (j *Janitor) Start() func() {
+	j.mutex.Lock()
+	if j.running {
+		j.mutex.Unlock()
+		panic("janitor is already running")
+	}
+	j.running = true
+	tasks := make([]*Task, 0, len(j.tasks))
+	for _, task := range j.tasks {
+		tasks = append(tasks, task)
+	}
+	j.mutex.Unlock()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task *Task) {
+			defer wg.Done()
+			j.loop(task, done)
+		}(task)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			j.mutex.Lock()
+			j.running = false
+			j.mutex.Unlock()
+		})
+	}
+}
+
+func (j *Janitor) loop(task *Task, done <-chan struct{}) {
+	timer := time.NewTimer(task.Interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-done:
+			return
+		}
+		result, _, err := j.run(task)
+		if err != nil && j.OnError != nil {
+			j.OnError(task.Name, err)
+		}
+		if result.More && err == nil {
+			timer.Reset(task.Pace)
+		} else {
+			timer.Reset(task.Interval)
+		}
+	}
+}
+
+// Stats returns a snapshot of the statistics for each task.
+func (j *Janitor) Stats() map[string]TaskStats {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	ret := make(map[string]TaskStats, len(j.stats))
+	for name, stats := range j.stats {
+		ret[name] = *stats
+	}
+	return ret
+}
+
+// Tasks returns the names of the registered tasks in sorted order.
+func (j *Janitor) Tasks() []string {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	ret := make([]string, 0, len(j.tasks))
+	for name := range j.tasks {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// String returns the stats as JSON.
+func (j *Janitor) String() string {
+	buf, err := json.Marshal(j.Stats())
+	if err != nil {
+		return "{}"
+	}
+	return string(buf)
+}
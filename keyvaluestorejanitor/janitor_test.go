@@ -0,0 +1,125 @@
+package keyvaluestorejanitor_test
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/keyvaluestorejanitor"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorelock"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretrim"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestJanitor_Register(t *testing.T) {
+	j := &keyvaluestorejanitor.Janitor{}
+	run := func() (keyvaluestorejanitor.Result, error) {
+		return keyvaluestorejanitor.Result{}, nil
+	}
+	assert.Error(t, j.Register(keyvaluestorejanitor.Task{Interval: time.Second, Run: run}))
+	assert.Error(t, j.Register(keyvaluestorejanitor.Task{Name: "foo", Run: run}))
+	assert.Error(t, j.Register(keyvaluestorejanitor.Task{Name: "foo", Interval: time.Second}))
+	require.NoError(t, j.Register(keyvaluestorejanitor.Task{Name: "foo", Interval: time.Second, Run: run}))
+	assert.Error(t, j.Register(keyvaluestorejanitor.Task{Name: "foo", Interval: time.Second, Run: run}))
+	assert.Equal(t, []string{"foo"}, j.Tasks())
+
+	_, _, err := j.Run("bar")
+	assert.Error(t, err)
+}
+
+func TestJanitor_Elector(t *testing.T) {
+	backend := memorystore.NewBackend()
+	newJanitor := func() *keyvaluestorejanitor.Janitor {
+		j := &keyvaluestorejanitor.Janitor{
+			Elector: &keyvaluestorejanitor.MutexElector{
+				Mutex: &keyvaluestorelock.Mutex{
+					Backend: backend,
+					Key:     "janitor",
+				},
+				TTL: time.Minute,
+			},
+		}
+		require.NoError(t, j.Register(keyvaluestorejanitor.Task{
+			Name:     "task",
+			Interval: time.Minute,
+			Run: func() (keyvaluestorejanitor.Result, error) {
+				return keyvaluestorejanitor.Result{Processed: 2}, errors.New("failed")
+			},
+		}))
+		return j
+	}
+	leader, follower := newJanitor(), newJanitor()
+
+	_, ran, err := leader.Run("task")
+	assert.True(t, ran)
+	assert.Error(t, err)
+	_, ran, err = follower.Run("task")
+	assert.False(t, ran)
+	assert.NoError(t, err)
+
+	stats := leader.Stats()["task"]
+	assert.EqualValues(t, 1, stats.Runs)
+	assert.EqualValues(t, 1, stats.Errors)
+	assert.EqualValues(t, 2, stats.Processed)
+	assert.Equal(t, "failed", stats.LastError)
+	assert.EqualValues(t, 1, follower.Stats()["task"].Skipped)
+
+	var published map[string]keyvaluestorejanitor.TaskStats
+	require.NoError(t, json.Unmarshal([]byte(leader.String()), &published))
+	assert.EqualValues(t, 1, published["task"].Runs)
+}
+
+func TestJanitor_Start(t *testing.T) {
+	var runs int64
+	j := &keyvaluestorejanitor.Janitor{}
+	require.NoError(t, j.Register(keyvaluestorejanitor.Task{
+		Name:     "task",
+		Interval: 10 * time.Millisecond,
+		Pace:     time.Millisecond,
+		Run: func() (keyvaluestorejanitor.Result, error) {
+			n := atomic.AddInt64(&runs, 1)
+			return keyvaluestorejanitor.Result{Processed: 1, More: n%5 != 0}, nil
+		},
+	}))
+
+	stop := j.Start()
+	defer stop()
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt64(&runs) < 10 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+
+	n := atomic.LoadInt64(&runs)
+	assert.True(t, n >= 10)
+	assert.Equal(t, n, j.Stats()["task"].Runs)
+
+	// Nothing runs once stopped.
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadInt64(&runs))
+}
+
+func TestTrimByScore(t *testing.T) {
+	backend := memorystore.NewBackend()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, backend.ZAdd("feed", i, float64(now.Add(-time.Duration(i)*time.Hour).Unix())))
+	}
+
+	run := keyvaluestorejanitor.TrimByScore(&keyvaluestoretrim.Trimmer{
+		Backend:     backend,
+		MaxRemovals: 2,
+	}, 90*time.Minute, "feed")
+
+	result, err := run()
+	require.NoError(t, err)
+	assert.Equal(t, keyvaluestorejanitor.Result{Processed: 2, More: true}, result)
+
+	result, err = run()
+	require.NoError(t, err)
+	assert.Equal(t, keyvaluestorejanitor.Result{Processed: 1}, result)
+}
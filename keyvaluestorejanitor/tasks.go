@@ -0,0 +1,102 @@
+package keyvaluestorejanitor
+
+import (
+	"time"
+
+	"github.com/ccbrown/keyvaluestore/keyvaluestorequota"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreregistry"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoresoftdelete"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretrim"
+)
+
+// The functions below return Run functions for tasks that perform the maintenance required by other
+// packages. For example:
+//
+//	janitor.Register(keyvaluestorejanitor.Task{
+//		Name:     "trim-feeds",
+//		Interval: time.Minute,
+//		Pace:     time.Second,
+//		Run:      keyvaluestorejanitor.TrimByScore(trimmer, 24*time.Hour, "feed:global"),
+//	})
+
+// TrimByScore trims the given sorted sets via keyvaluestoretrim.Trimmer.TrimByScore. If the trimmer
+// has a MaxRemovals limit and reaches it, the run reports that it has more work to do.
+func TrimByScore(t *keyvaluestoretrim.Trimmer, maxAge time.Duration, keys ...string) func() (Result, error) {
+	return func() (Result, error) {
+		var result Result
+		for _, key := range keys {
+			n, err := t.TrimByScore(key, maxAge)
+			result.Processed += n
+			if err != nil {
+				return result, err
+			}
+			if t.MaxRemovals > 0 && n >= t.MaxRemovals {
+				result.More = true
+			}
+		}
+		return result, nil
+	}
+}
+
+// TrimToSize trims the given sorted sets via keyvaluestoretrim.Trimmer.TrimToSize. If the trimmer
+// has a MaxRemovals limit and reaches it, the run reports that it has more work to do.
+func TrimToSize(t *keyvaluestoretrim.Trimmer, n int, keys ...string) func() (Result, error) {
+	return func() (Result, error) {
+		var result Result
+		for _, key := range keys {
+			removed, err := t.TrimToSize(key, n)
+			result.Processed += removed
+			if err != nil {
+				return result, err
+			}
+			if t.MaxRemovals > 0 && removed >= t.MaxRemovals {
+				result.More = true
+			}
+		}
+		return result, nil
+	}
+}
+
+// PurgeTombstones deletes expired tombstones via keyvaluestoresoftdelete.Backend.PurgeExpired. It's
+// only needed for backends that don't implement keyvaluestore.Expirer.
+func PurgeTombstones(b *keyvaluestoresoftdelete.Backend, pageSize int) func() (Result, error) {
+	return func() (Result, error) {
+		n, err := b.PurgeExpired(pageSize)
+		return Result{Processed: n}, err
+	}
+}
+
+// Sweeper is implemented by backends that don't remove expired keys on their own, such as
+// memorystore.Backend.
+type Sweeper interface {
+	SweepExpired()
+}
+
+// SweepExpired removes expired keys from backends that lack native expiration.
+func SweepExpired(s Sweeper) func() (Result, error) {
+	return func() (Result, error) {
+		s.SweepExpired()
+		return Result{}, nil
+	}
+}
+
+// RecomputeQuotas corrects drift in usage counters via keyvaluestorequota.Backend.Recompute. The
+// number of tenants is reported as the number of items processed.
+func RecomputeQuotas(b *keyvaluestorequota.Backend, pageSize int) func() (Result, error) {
+	return func() (Result, error) {
+		usage, err := b.Recompute(pageSize)
+		return Result{Processed: len(usage)}, err
+	}
+}
+
+// RemoveExpiredInstances removes instances whose leases have expired from a registry, up to limit
+// per run. If the limit is reached, the run reports that it has more work to do.
+func RemoveExpiredInstances(r *keyvaluestoreregistry.Registry, limit int) func() (Result, error) {
+	return func() (Result, error) {
+		removed, err := r.RemoveExpired(limit)
+		return Result{
+			Processed: len(removed),
+			More:      limit > 0 && len(removed) >= limit,
+		}, err
+	}
+}
@@ -0,0 +1,203 @@
+// Package keyvaluestoreleaderboard implements leaderboards on top of sorted sets.
+package keyvaluestoreleaderboard
+
+import (
+	"math"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Leaderboard ranks members of the sorted set at Key by descending score.
+//
+// Members with equal scores share the same rank, and the next rank is skipped for each of them
+// (e.g. 1, 2, 2, 4). Within a rank, members are listed in reverse lexicographical order, which is
+// the order in which backends return them from ZRevRangeByScore. If ties should instead be broken
+// by something like the time at which the score was reached, it must be encoded into the score.
+type Leaderboard struct {
+	Backend keyvaluestore.Backend
+	Key     string
+}
+
+// Entry is a member's position on the leaderboard.
+type Entry struct {
+	Member string
+	Score  float64
+
+	// Rank is the member's 1-based rank.
+	Rank int
+}
+
+// SetScore sets a member's score, adding the member if necessary.
+func (l *Leaderboard) SetScore(member string, score float64) error {
+	return l.Backend.ZAdd(l.Key, member, score)
+}
+
+// AddScore adds to a member's score, adding the member if necessary. It returns the new score.
+func (l *Leaderboard) AddScore(member string, n float64) (float64, error) {
+	return l.Backend.ZIncrBy(l.Key, member, n)
+}
+
+// Remove removes a member from the leaderboard.
+func (l *Leaderboard) Remove(member string) error {
+	return l.Backend.ZRem(l.Key, member)
+}
+
+// Len returns the number of members on the leaderboard.
+func (l *Leaderboard) Len() (int, error) {
+	return l.Backend.ZCount(l.Key, math.Inf(-1), math.Inf(1))
+}
+
+// Entry returns the member's entry or nil if the member isn't on the leaderboard.
+func (l *Leaderboard) Entry(member string) (*Entry, error) {
+	score, err := l.Backend.ZScore(l.Key, member)
+	if err != nil || score == nil {
+		return nil, err
+	}
+	rank, err := l.rank(*score)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{
+		Member: member,
+		Score:  *score,
+		Rank:   rank,
+	}, nil
+}
+
+// Rank returns the member's rank or zero if the member isn't on the leaderboard.
+func (l *Leaderboard) Rank(member string) (int, error) {
+	entry, err := l.Entry(member)
+	if err != nil || entry == nil {
+		return 0, err
+	}
+	return entry.Rank, nil
+}
+
+// rank returns the rank of members with the given score.
+func (l *Leaderboard) rank(score float64) (int, error) {
+	if math.IsInf(score, 1) {
+		return 1, nil
+	}
+	higher, err := l.Backend.ZCount(l.Key, math.Nextafter(score, math.Inf(1)), math.Inf(1))
+	if err != nil {
+		return 0, err
+	}
+	return higher + 1, nil
+}
+
+// Percentile returns the percentage of members whose scores are lower than the given member's, or
+// nil if the member isn't on the leaderboard.
+func (l *Leaderboard) Percentile(member string) (*float64, error) {
+	score, err := l.Backend.ZScore(l.Key, member)
+	if err != nil || score == nil {
+		return nil, err
+	}
+	total, err := l.Len()
+	if err != nil {
+		return nil, err
+	}
+	var lower int
+	if !math.IsInf(*score, -1) {
+		if lower, err = l.Backend.ZCount(l.Key, math.Inf(-1), math.Nextafter(*score, math.Inf(-1))); err != nil {
+			return nil, err
+		}
+	}
+	percentile := 100 * float64(lower) / float64(total)
+	return &percentile, nil
+}
+
+// Top returns the first n entries. If n is zero, all entries are returned.
+func (l *Leaderboard) Top(n int) ([]*Entry, error) {
+	members, err := l.Backend.ZRevRangeByScoreWithScores(l.Key, math.Inf(-1), math.Inf(1), n)
+	if err != nil {
+		return nil, err
+	}
+	return l.entries(members)
+}
+
+// Around returns the given member's entry along with up to n entries on either side of it. If the
+// member isn't on the leaderboard, nil is returned.
+func (l *Leaderboard) Around(member string, n int) ([]*Entry, error) {
+	score, err := l.Backend.ZScore(l.Key, member)
+	if err != nil || score == nil {
+		return nil, err
+	}
+
+	// The member may be anywhere among the members with the same score, so enough members need to
+	// be fetched to get past all of them.
+	ties, err := l.Backend.ZCount(l.Key, *score, *score)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries above the member, in ascending order.
+	above, err := l.Backend.ZRangeByScoreWithScores(l.Key, *score, math.Inf(1), ties+n)
+	if err != nil {
+		return nil, err
+	}
+	above = neighbors(above, member, n)
+
+	// The member and the entries below it, in descending order.
+	below, err := l.Backend.ZRevRangeByScoreWithScores(l.Key, math.Inf(-1), *score, ties+n)
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range below {
+		if m.Value == member {
+			below = below[i:]
+			break
+		}
+	}
+	if len(below) > n+1 {
+		below = below[:n+1]
+	}
+
+	return l.entries(append(above.Reverse(), below...))
+}
+
+// neighbors returns up to n members that follow the given member.
+func neighbors(members keyvaluestore.ScoredMembers, member string, n int) keyvaluestore.ScoredMembers {
+	for i, m := range members {
+		if m.Value == member {
+			members = members[i+1:]
+			break
+		}
+	}
+	if len(members) > n {
+		members = members[:n]
+	}
+	return members
+}
+
+// entries converts contiguous members in descending order to entries.
+func (l *Leaderboard) entries(members keyvaluestore.ScoredMembers) ([]*Entry, error) {
+	if len(members) == 0 {
+		return nil, nil
+	}
+	rank, err := l.rank(members[0].Score)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*Entry, len(members))
+	groupStart := 0
+	for i, m := range members {
+		if m.Score != members[groupStart].Score {
+			groupSize := i - groupStart
+			if groupStart == 0 {
+				// The first group may be missing members that precede the first one, so it needs
+				// to be counted.
+				if groupSize, err = l.Backend.ZCount(l.Key, members[0].Score, members[0].Score); err != nil {
+					return nil, err
+				}
+			}
+			rank += groupSize
+			groupStart = i
+		}
+		ret[i] = &Entry{
+			Member: m.Value,
+			Score:  m.Score,
+			Rank:   rank,
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,123 @@
+package keyvaluestoreleaderboard_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreleaderboard"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func newTestLeaderboard(t *testing.T) *keyvaluestoreleaderboard.Leaderboard {
+	l := &keyvaluestoreleaderboard.Leaderboard{
+		Backend: memorystore.NewBackend(),
+		Key:     "leaderboard",
+	}
+	for member, score := range map[string]float64{
+		"a": 10,
+		"b": 8,
+		"c": 8,
+		"d": 8,
+		"e": 5,
+		"f": 1,
+	} {
+		require.NoError(t, l.SetScore(member, score))
+	}
+	return l
+}
+
+func members(entries []*keyvaluestoreleaderboard.Entry) []string {
+	ret := make([]string, len(entries))
+	for i, entry := range entries {
+		ret[i] = entry.Member
+	}
+	return ret
+}
+
+func ranks(entries []*keyvaluestoreleaderboard.Entry) []int {
+	ret := make([]int, len(entries))
+	for i, entry := range entries {
+		ret[i] = entry.Rank
+	}
+	return ret
+}
+
+func TestLeaderboard(t *testing.T) {
+	l := newTestLeaderboard(t)
+
+	n, err := l.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+
+	top, err := l.Top(0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "d", "c", "b", "e", "f"}, members(top))
+	assert.Equal(t, []int{1, 2, 2, 2, 5, 6}, ranks(top))
+
+	top, err = l.Top(3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "d", "c"}, members(top))
+
+	for member, expected := range map[string]int{"a": 1, "c": 2, "e": 5, "f": 6, "z": 0} {
+		rank, err := l.Rank(member)
+		require.NoError(t, err)
+		assert.Equal(t, expected, rank, member)
+	}
+
+	score, err := l.AddScore("f", 10)
+	require.NoError(t, err)
+	assert.Equal(t, 11.0, score)
+	entry, err := l.Entry("f")
+	require.NoError(t, err)
+	assert.Equal(t, &keyvaluestoreleaderboard.Entry{Member: "f", Score: 11, Rank: 1}, entry)
+
+	require.NoError(t, l.Remove("f"))
+	entry, err = l.Entry("f")
+	require.NoError(t, err)
+	assert.Nil(t, entry)
+}
+
+func TestLeaderboardAround(t *testing.T) {
+	l := newTestLeaderboard(t)
+
+	for name, tc := range map[string]struct {
+		Member  string
+		N       int
+		Members []string
+		Ranks   []int
+	}{
+		"Top":         {"a", 1, []string{"a", "d"}, []int{1, 2}},
+		"Bottom":      {"f", 2, []string{"b", "e", "f"}, []int{2, 5, 6}},
+		"TieStart":    {"d", 1, []string{"a", "d", "c"}, []int{1, 2, 2}},
+		"TieMiddle":   {"c", 1, []string{"d", "c", "b"}, []int{2, 2, 2}},
+		"TieEnd":      {"b", 1, []string{"c", "b", "e"}, []int{2, 2, 5}},
+		"AfterTie":    {"e", 2, []string{"c", "b", "e", "f"}, []int{2, 2, 5, 6}},
+		"Everything":  {"c", 10, []string{"a", "d", "c", "b", "e", "f"}, []int{1, 2, 2, 2, 5, 6}},
+		"JustMember":  {"c", 0, []string{"c"}, []int{2}},
+		"Nonexistent": {"z", 1, []string{}, []int{}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			entries, err := l.Around(tc.Member, tc.N)
+			require.NoError(t, err)
+			assert.Equal(t, tc.Members, members(entries))
+			assert.Equal(t, tc.Ranks, ranks(entries))
+		})
+	}
+}
+
+func TestLeaderboardPercentile(t *testing.T) {
+	l := newTestLeaderboard(t)
+
+	for member, expected := range map[string]float64{"a": 100 * 5.0 / 6, "c": 100 * 2.0 / 6, "f": 0} {
+		percentile, err := l.Percentile(member)
+		require.NoError(t, err)
+		require.NotNil(t, percentile)
+		assert.InDelta(t, expected, *percentile, 0.0001, member)
+	}
+
+	percentile, err := l.Percentile("z")
+	require.NoError(t, err)
+	assert.Nil(t, percentile)
+}
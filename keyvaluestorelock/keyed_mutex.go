@@ -0,0 +1,64 @@
+package keyvaluestorelock
+
+import (
+	"sync"
+)
+
+// KeyedMutex is a set of in-process locks identified by key. It's useful for serializing
+// read-modify-write sequences that are performed by many goroutines of the same process, such as
+// SetEQ retry loops. Serializing them locally means that only one goroutine per process contends
+// with other processes, which avoids most of the wasted round trips of retries.
+//
+// Unlike Mutex, it doesn't coordinate with other processes, so writes must still be made safe with
+// conditional operations. Locks are only kept in memory while they're held or waited for, so any
+// number of keys can be used. The zero value is ready to use.
+type KeyedMutex struct {
+	mutex sync.Mutex
+	locks map[string]*keyedMutexEntry
+}
+
+type keyedMutexEntry struct {
+	mutex sync.Mutex
+
+	// refs is the number of goroutines holding or waiting for the lock. It's guarded by the
+	// KeyedMutex's mutex.
+	refs int
+}
+
+// Lock locks the given key. If it's already locked, Lock blocks until it's available.
+func (m *KeyedMutex) Lock(key string) {
+	m.mutex.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*keyedMutexEntry)
+	}
+	entry, ok := m.locks[key]
+	if !ok {
+		entry = &keyedMutexEntry{}
+		m.locks[key] = entry
+	}
+	entry.refs++
+	m.mutex.Unlock()
+
+	entry.mutex.Lock()
+}
+
+// Unlock unlocks the given key. It panics if the key isn't locked.
+func (m *KeyedMutex) Unlock(key string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	entry, ok := m.locks[key]
+	if !ok {
+		panic("keyvaluestorelock: unlock of unlocked key")
+	}
+	if entry.refs--; entry.refs == 0 {
+		delete(m.locks, key)
+	}
+	entry.mutex.Unlock()
+}
+
+// Do invokes f while holding the lock for the given key and returns its error.
+func (m *KeyedMutex) Do(key string, f func() error) error {
+	m.Lock(key)
+	defer m.Unlock(key)
+	return f()
+}
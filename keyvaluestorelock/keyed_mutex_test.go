@@ -0,0 +1,62 @@
+package keyvaluestorelock_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/keyvaluestorelock"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	b := memorystore.NewBackend()
+	var m keyvaluestorelock.KeyedMutex
+
+	// Non-atomic increments don't lose updates when they're serialized.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		key := "foo"
+		if i%2 == 1 {
+			key = "bar"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, m.Do(key, func() error {
+				v, err := b.Get(key)
+				if err != nil {
+					return err
+				} else if v == nil {
+					return b.Set(key, 1)
+				}
+				n, err := strconv.Atoi(*v)
+				if err != nil {
+					return err
+				}
+				return b.Set(key, n+1)
+			}))
+		}()
+	}
+	wg.Wait()
+
+	for _, key := range []string{"foo", "bar"} {
+		v, err := b.Get(key)
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		assert.Equal(t, "10", *v)
+	}
+
+	// Different keys don't block each other.
+	m.Lock("foo")
+	m.Lock("bar")
+	m.Unlock("foo")
+	m.Unlock("bar")
+
+	assert.Panics(t, func() {
+		m.Unlock("foo")
+	})
+}
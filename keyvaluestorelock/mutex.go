@@ -0,0 +1,206 @@
+// Package keyvaluestorelock implements distributed locks on top of any backend.
+package keyvaluestorelock
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Mutex is a distributed lock with a time to live. Every acquisition is assigned a fencing token
+// that's greater than those of all previous acquisitions. Since the lock can expire while its
+// holder is still working (e.g. after a long GC pause), resources guarded by the lock should
+// reject requests whose token is lower than the highest they've seen.
+//
+// Expiration is based on the clocks of the processes using the lock, so they need to be loosely
+// synchronized. Fencing tokens remain correct regardless.
+//
+// The lock's state is stored in a single string key which is never deleted, as it's also what
+// keeps the fencing tokens increasing.
+//
+// A Mutex represents a single holder. It's safe for concurrent use, e.g. to renew the lock in the
+// background.
+type Mutex struct {
+	Backend keyvaluestore.Backend
+	Key     string
+
+	// Clock is used to get the current time. If nil, the wall clock is used.
+	Clock keyvaluestore.Clock
+
+	mutex sync.Mutex
+	value string
+	state lockState
+}
+
+type lockState struct {
+	Token     int64
+	ExpiresAt time.Time
+	Owner     string
+}
+
+func (s lockState) String() string {
+	var expiresAt int64
+	if !s.ExpiresAt.IsZero() {
+		expiresAt = s.ExpiresAt.UnixNano()
+	}
+	return keyvaluestore.Key{
+		strconv.FormatInt(s.Token, 10),
+		strconv.FormatInt(expiresAt, 10),
+		s.Owner,
+	}.String()
+}
+
+func (s lockState) isHeld(now time.Time) bool {
+	return s.Owner != "" && now.Before(s.ExpiresAt)
+}
+
+func parseLockState(v string) (lockState, error) {
+	k, err := keyvaluestore.ParseKey(v)
+	if err != nil {
+		return lockState{}, err
+	} else if len(k) != 3 {
+		return lockState{}, fmt.Errorf("malformed lock: %q", v)
+	}
+	token, err := strconv.ParseInt(k[0], 10, 64)
+	if err != nil {
+		return lockState{}, fmt.Errorf("malformed lock token: %w", err)
+	}
+	expiresAt, err := strconv.ParseInt(k[1], 10, 64)
+	if err != nil {
+		return lockState{}, fmt.Errorf("malformed lock expiration: %w", err)
+	}
+	ret := lockState{
+		Token: token,
+		Owner: k[2],
+	}
+	if expiresAt != 0 {
+		ret.ExpiresAt = time.Unix(0, expiresAt)
+	}
+	return ret, nil
+}
+
+func newOwner() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Acquire makes a single attempt to acquire the lock for the given duration. It returns false if
+// the lock is held by someone else. Acquiring a lock that's already held by the receiver renews it.
+func (m *Mutex) Acquire(ttl time.Duration) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.value != "" {
+		return m.renew(ttl)
+	}
+
+	prev, err := m.Backend.Get(m.Key)
+	if err != nil {
+		return false, err
+	}
+
+	owner, err := newOwner()
+	if err != nil {
+		return false, err
+	}
+	now := keyvaluestore.Now(m.Clock)
+	next := lockState{
+		Token:     1,
+		ExpiresAt: now.Add(ttl),
+		Owner:     owner,
+	}
+
+	var ok bool
+	if prev == nil {
+		ok, err = m.Backend.SetNX(m.Key, next.String())
+	} else {
+		var prevState lockState
+		if prevState, err = parseLockState(*prev); err != nil {
+			return false, err
+		} else if prevState.isHeld(now) {
+			return false, nil
+		}
+		next.Token = prevState.Token + 1
+		ok, err = m.Backend.SetEQ(m.Key, next.String(), *prev)
+	}
+	if err != nil || !ok {
+		return false, err
+	}
+
+	m.value = next.String()
+	m.state = next
+	return true, nil
+}
+
+// Renew extends the lock's expiration to the given duration from now. It returns false if the lock
+// is no longer held by the receiver, in which case it must be acquired again.
+func (m *Mutex) Renew(ttl time.Duration) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.renew(ttl)
+}
+
+func (m *Mutex) renew(ttl time.Duration) (bool, error) {
+	if m.value == "" {
+		return false, nil
+	}
+	next := m.state
+	next.ExpiresAt = keyvaluestore.Now(m.Clock).Add(ttl)
+	if ok, err := m.Backend.SetEQ(m.Key, next.String(), m.value); err != nil {
+		return false, err
+	} else if !ok {
+		m.forget()
+		return false, nil
+	}
+	m.value = next.String()
+	m.state = next
+	return true, nil
+}
+
+// Release releases the lock. It returns false if the lock was no longer held by the receiver.
+func (m *Mutex) Release() (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.value == "" {
+		return false, nil
+	}
+	released := lockState{
+		Token: m.state.Token,
+	}
+	ok, err := m.Backend.SetEQ(m.Key, released.String(), m.value)
+	if err != nil {
+		return false, err
+	}
+	m.forget()
+	return ok, nil
+}
+
+func (m *Mutex) forget() {
+	m.value = ""
+	m.state = lockState{}
+}
+
+// Token returns the fencing token of the receiver's current acquisition, or zero if it doesn't
+// hold the lock.
+func (m *Mutex) Token() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.state.Token
+}
+
+// ExpiresAt returns the time at which the receiver's current acquisition expires, or the zero time
+// if it doesn't hold the lock.
+func (m *Mutex) ExpiresAt() time.Time {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.state.ExpiresAt
+}
@@ -0,0 +1,76 @@
+package keyvaluestorelock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/keyvaluestorelock"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestMutex(t *testing.T) {
+	b := memorystore.NewBackend()
+	a := &keyvaluestorelock.Mutex{Backend: b, Key: "lock"}
+	c := &keyvaluestorelock.Mutex{Backend: b, Key: "lock"}
+
+	ok, err := a.Acquire(time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, int64(1), a.Token())
+	assert.WithinDuration(t, time.Now().Add(time.Minute), a.ExpiresAt(), 10*time.Second)
+
+	ok, err = c.Acquire(time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), c.Token())
+
+	ok, err = a.Renew(time.Hour)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), a.Token())
+
+	ok, err = a.Release()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), a.Token())
+
+	ok, err = c.Acquire(time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, int64(2), c.Token())
+
+	ok, err = a.Renew(time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok, "renewing a released lock should fail")
+}
+
+func TestMutexExpiration(t *testing.T) {
+	b := memorystore.NewBackend()
+	a := &keyvaluestorelock.Mutex{Backend: b, Key: "lock", Clock: b}
+	c := &keyvaluestorelock.Mutex{Backend: b, Key: "lock", Clock: b}
+
+	ok, err := a.Acquire(time.Second)
+	require.NoError(t, err)
+	require.True(t, ok)
+	b.FastForward(2 * time.Second)
+
+	ok, err = c.Acquire(time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, int64(2), c.Token())
+
+	// a's acquisition has been taken over, so it can neither renew nor release the lock.
+	ok, err = a.Renew(time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = a.Release()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = a.Acquire(time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok, "c should still hold the lock")
+}
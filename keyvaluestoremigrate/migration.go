@@ -0,0 +1,277 @@
+package keyvaluestoremigrate
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorecheck"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreexport"
+)
+
+// DefaultMaxResyncPasses is the maximum number of re-sync passes made by Run if no maximum is given.
+const DefaultMaxResyncPasses = 10
+
+// Migration copies data from one backend to another.
+//
+// Migrating a live backend is done in three phases:
+//
+//  1. Copy writes everything in the source to the destination. Keys written during the copy
+//     are recorded by the Tracker.
+//  2. Resync re-copies the keys recorded by the tracker, replacing their contents in the
+//     destination. This can be repeated until the application is cut over to the destination.
+//  3. Verify compares the source and destination, reporting any mismatches.
+type Migration struct {
+	// The source must implement keyvaluestore.Scanner and keyvaluestore.EntryGetter.
+	Source keyvaluestore.Backend
+
+	// If the destination implements keyvaluestore.EntryGetter, it's used to read sorted hashes
+	// exactly. Otherwise sorted set members are compared by value and score only. If the
+	// destination implements keyvaluestore.Scanner, verification also reports keys that only
+	// exist in the destination.
+	Destination keyvaluestore.Backend
+
+	// If given, the tracker's keys are re-synced by Resync. The tracker should be wrapping the
+	// source before Copy is invoked.
+	Tracker *Tracker
+
+	// The number of keys to write concurrently. Defaults to 1.
+	Concurrency int
+
+	// The number of entries to scan at a time. Defaults to keyvaluestoreexport.DefaultPageSize.
+	PageSize int
+
+	// The maximum number of re-sync passes made by Run. Defaults to DefaultMaxResyncPasses.
+	MaxResyncPasses int
+}
+
+// Run copies the source to the destination, re-syncs touched keys until either no more keys are
+// touched or MaxResyncPasses is reached, then verifies the result.
+func (m *Migration) Run() (*Verification, error) {
+	if _, err := m.Copy(); err != nil {
+		return nil, err
+	}
+	maxPasses := m.MaxResyncPasses
+	if maxPasses <= 0 {
+		maxPasses = DefaultMaxResyncPasses
+	}
+	for i := 0; i < maxPasses; i++ {
+		if n, err := m.Resync(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			break
+		}
+	}
+	return m.Verify()
+}
+
+func (m *Migration) scanner() (keyvaluestore.Scanner, error) {
+	scanner, ok := m.Source.(keyvaluestore.Scanner)
+	if !ok {
+		return nil, fmt.Errorf("source does not support scanning: %T: %w", m.Source, keyvaluestore.ErrNotSupported)
+	}
+	return scanner, nil
+}
+
+func (m *Migration) entryGetter() (keyvaluestore.EntryGetter, error) {
+	getter, ok := m.Source.(keyvaluestore.EntryGetter)
+	if !ok {
+		return nil, fmt.Errorf("source does not support getting entries: %T: %w", m.Source, keyvaluestore.ErrNotSupported)
+	}
+	return getter, nil
+}
+
+// Copy writes the source's contents to the destination and returns the number of entries
+// written. Existing keys in the destination are overwritten.
+func (m *Migration) Copy() (int, error) {
+	scanner, err := m.scanner()
+	if err != nil {
+		return 0, err
+	}
+	result, err := keyvaluestoreexport.Import(m.Destination, &scanReader{
+		scanner:  scanner,
+		pageSize: m.PageSize,
+	}, keyvaluestoreexport.ImportOptions{
+		Concurrency: m.Concurrency,
+	})
+	return result.Imported, err
+}
+
+// Resync replaces the contents of every key touched since the last re-sync and returns the number
+// of keys re-synced. Unlike Copy, members and fields that no longer exist in the source are
+// removed from the destination, and keys that no longer exist are deleted.
+func (m *Migration) Resync() (int, error) {
+	if m.Tracker == nil {
+		return 0, nil
+	}
+	getter, err := m.entryGetter()
+	if err != nil {
+		return 0, err
+	}
+	keys := m.Tracker.Drain()
+	err = m.forEach(len(keys), func(i int) error {
+		entry, err := getter.GetEntry(keys[i])
+		if err != nil {
+			return err
+		}
+		return m.syncEntry(keys[i], entry)
+	})
+	return len(keys), err
+}
+
+// forEach invokes f for indices 0 through n-1 with the configured concurrency.
+func (m *Migration) forEach(n int, f func(i int) error) error {
+	concurrency := m.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var g errgroup.Group
+	for worker := 0; worker < concurrency; worker++ {
+		worker := worker
+		g.Go(func() error {
+			for i := worker; i < n; i += concurrency {
+				if err := f(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// syncEntry makes the destination's key match the given entry. If entry is nil, the key is
+// removed from the destination.
+func (m *Migration) syncEntry(key string, entry *keyvaluestore.Entry) error {
+	if entry == nil {
+		if getter, ok := m.Destination.(keyvaluestore.EntryGetter); ok {
+			// Some backends can't delete sorted sets via Delete, so remove their members instead.
+			existing, err := getter.GetEntry(key)
+			if err != nil {
+				return err
+			} else if existing != nil && existing.Type == keyvaluestore.EntryTypeSortedSet {
+				for _, member := range existing.SortedSetMembers {
+					if err := m.Destination.ZHRem(key, member.Field); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		}
+		_, err := m.Destination.Delete(key)
+		return err
+	}
+
+	dest := m.Destination
+	switch entry.Type {
+	case keyvaluestore.EntryTypeString:
+		return dest.Set(key, entry.Value)
+	case keyvaluestore.EntryTypeSet:
+		existing, err := dest.SMembers(key)
+		if err != nil {
+			return err
+		}
+		members := map[string]struct{}{}
+		var add []interface{}
+		for _, member := range entry.Members {
+			members[member] = struct{}{}
+			add = append(add, member)
+		}
+		for _, member := range existing {
+			if _, ok := members[member]; !ok {
+				if err := dest.SRem(key, member); err != nil {
+					return err
+				}
+			}
+		}
+		if len(add) > 0 {
+			return dest.SAdd(key, add[0], add[1:]...)
+		}
+		return nil
+	case keyvaluestore.EntryTypeHash:
+		existing, err := dest.HGetAll(key)
+		if err != nil {
+			return err
+		}
+		for field := range existing {
+			if _, ok := entry.Fields[field]; !ok {
+				if err := dest.HDel(key, field); err != nil {
+					return err
+				}
+			}
+		}
+		var fields []keyvaluestore.KeyValue
+		for field, value := range entry.Fields {
+			fields = append(fields, keyvaluestore.KeyValue{Key: field, Value: value})
+		}
+		if len(fields) > 0 {
+			return dest.HSet(key, fields[0].Key, fields[0].Value, fields[1:]...)
+		}
+		return nil
+	case keyvaluestore.EntryTypeSortedSet:
+		existing, err := m.destinationEntry(key, entry.Type)
+		if err != nil {
+			return err
+		}
+		fields := map[string]struct{}{}
+		for _, member := range entry.SortedSetMembers {
+			fields[member.Field] = struct{}{}
+		}
+		if existing != nil {
+			for _, member := range existing.SortedSetMembers {
+				if _, ok := fields[member.Field]; !ok {
+					if err := dest.ZHRem(key, member.Field); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		entries := make([]keyvaluestore.ZHEntry, len(entry.SortedSetMembers))
+		for i, member := range entry.SortedSetMembers {
+			entries[i] = keyvaluestore.ZHEntry{
+				Field:  member.Field,
+				Member: member.Value,
+				Score:  member.Score,
+			}
+		}
+		return dest.ZHMAdd(key, entries)
+	}
+	return fmt.Errorf("unsupported entry type for key %v: %v", key, entry.Type)
+}
+
+// destinationEntry reads the given key from the destination. If the key doesn't exist, nil is
+// returned.
+func (m *Migration) destinationEntry(key string, t keyvaluestore.EntryType) (*keyvaluestore.Entry, error) {
+	return keyvaluestorecheck.GetEntry(m.Destination, key, t)
+}
+
+// scanReader adapts a scanner to the keyvaluestoreexport.Reader interface.
+type scanReader struct {
+	scanner  keyvaluestore.Scanner
+	pageSize int
+	page     []*keyvaluestore.Entry
+	cursor   string
+	done     bool
+}
+
+func (r *scanReader) ReadEntry() (*keyvaluestore.Entry, error) {
+	for len(r.page) == 0 {
+		if r.done {
+			return nil, io.EOF
+		}
+		pageSize := r.pageSize
+		if pageSize <= 0 {
+			pageSize = keyvaluestoreexport.DefaultPageSize
+		}
+		page, cursor, err := r.scanner.Scan(r.cursor, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		r.page, r.cursor, r.done = page, cursor, cursor == ""
+	}
+	entry := r.page[0]
+	r.page = r.page[1:]
+	return entry, nil
+}
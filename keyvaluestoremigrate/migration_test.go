@@ -0,0 +1,111 @@
+package keyvaluestoremigrate
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+// opaqueBackend hides the optional interfaces of a backend.
+type opaqueBackend struct {
+	keyvaluestore.Backend
+}
+
+func newSource(t *testing.T) *memorystore.Backend {
+	b := memorystore.NewBackend()
+	require.NoError(t, b.Set("string", "foo"))
+	require.NoError(t, b.SAdd("set", "a", "b"))
+	require.NoError(t, b.HSet("hash", "a", "1", keyvaluestore.KeyValue{Key: "b", Value: "2"}))
+	require.NoError(t, b.ZHAdd("sortedhash", "field", "value", 1))
+	for i := 0; i < 30; i++ {
+		require.NoError(t, b.ZAdd("sortedset", strconv.Itoa(i), float64(i)))
+	}
+	return b
+}
+
+func TestMigration(t *testing.T) {
+	for name, dest := range map[string]func() keyvaluestore.Backend{
+		"EntryGetter": func() keyvaluestore.Backend { return memorystore.NewBackend() },
+		"Opaque":      func() keyvaluestore.Backend { return opaqueBackend{memorystore.NewBackend()} },
+	} {
+		dest := dest
+		t.Run(name, func(t *testing.T) {
+			source := newSource(t)
+			tracker := &Tracker{}
+			app := tracker.Wrap(source)
+
+			m := &Migration{
+				Source:      source,
+				Destination: dest(),
+				Tracker:     tracker,
+				Concurrency: 3,
+				PageSize:    2,
+			}
+			n, err := m.Copy()
+			require.NoError(t, err)
+			assert.Equal(t, 5, n)
+
+			verification, err := m.Verify()
+			require.NoError(t, err)
+			assert.Equal(t, 5, verification.Checked)
+			assert.Empty(t, verification.Mismatches)
+
+			// Simulate application writes that happen after the copy.
+			require.NoError(t, app.Set("string", "bar"))
+			require.NoError(t, app.SRem("set", "a"))
+			require.NoError(t, app.HDel("hash", "a"))
+			require.NoError(t, app.ZRem("sortedset", "0"))
+			require.NoError(t, app.Set("new", "baz"))
+
+			verification, err = m.Verify()
+			require.NoError(t, err)
+			var mismatches []string
+			for _, mismatch := range verification.Mismatches {
+				mismatches = append(mismatches, mismatch.String())
+			}
+			assert.ElementsMatch(t, []string{
+				"string: string differs",
+				"set: set differs",
+				"hash: hash differs",
+				"sortedset: sortedset differs",
+				"new: missing from destination",
+			}, mismatches)
+
+			n, err = m.Resync()
+			require.NoError(t, err)
+			assert.Equal(t, 5, n)
+
+			verification, err = m.Verify()
+			require.NoError(t, err)
+			assert.Equal(t, 6, verification.Checked)
+			assert.Empty(t, verification.Mismatches)
+
+			// Deletes are re-synced as well.
+			_, err = app.Delete("new")
+			require.NoError(t, err)
+			verification, err = m.Run()
+			require.NoError(t, err)
+			assert.Equal(t, 5, verification.Checked)
+			assert.Empty(t, verification.Mismatches)
+		})
+	}
+}
+
+func TestVerifyUnexpectedKeys(t *testing.T) {
+	dest := memorystore.NewBackend()
+	require.NoError(t, dest.Set("extra", "foo"))
+
+	m := &Migration{
+		Source:      memorystore.NewBackend(),
+		Destination: dest,
+	}
+	verification, err := m.Verify()
+	require.NoError(t, err)
+	require.Len(t, verification.Mismatches, 1)
+	assert.Equal(t, "extra: unexpected key in destination", verification.Mismatches[0].String())
+}
@@ -0,0 +1,301 @@
+package keyvaluestoremigrate
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreinvalidator"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreoplog"
+)
+
+// DefaultReplicationRetryInterval is how long the replicator waits before retrying a key that
+// failed to sync if no interval is given.
+const DefaultReplicationRetryInterval = time.Second
+
+// Replicator continuously copies keys that change in the migration's source to its destination.
+// Keys are re-read from the source when they're synced, so notifications for the same key are
+// coalesced and the destination always converges to the source's latest contents.
+//
+// Each key is always synced by the same worker, so changes to a key are applied in order. Keys
+// that fail to sync are retried until they succeed or the replicator is stopped.
+//
+// Change notifications can come from Watch, which uses the source's keyspace notifications, from
+// Wrap, which notifies of the application's own writes, or from an operation log, since the
+// replicator is also a keyvaluestoreoplog.Sink. Redis doesn't guarantee delivery of keyspace
+// notifications, so a warm migration should start the replicator, then Copy, then Verify.
+type Replicator struct {
+	// The migration's source must implement keyvaluestore.EntryGetter. Its Concurrency is the
+	// number of keys synced concurrently.
+	Migration *Migration
+
+	// If given, keys aren't synced until Delay after they change. Operation logs append entries
+	// before their writes are performed, so a delay is needed to avoid reading the key before the
+	// write lands.
+	Delay time.Duration
+
+	// How long to wait before retrying a key that failed to sync. Defaults to
+	// DefaultReplicationRetryInterval.
+	RetryInterval time.Duration
+
+	// If given, OnSync is invoked after each key is synced with the time that elapsed since the
+	// replicator was first notified of the change.
+	OnSync func(key string, lag time.Duration)
+
+	// If given, OnError is invoked whenever a key fails to sync.
+	OnError func(key string, err error)
+
+	initOnce sync.Once
+	workers  []*replicationWorker
+}
+
+type replicationWorker struct {
+	mutex sync.Mutex
+
+	// pending maps keys to the time at which the replicator was first notified of their changes.
+	pending map[string]time.Time
+	queue   []string
+
+	// syncing is the time of the change that's currently being synced, if any.
+	syncing time.Time
+
+	signal chan struct{}
+}
+
+var _ keyvaluestoreoplog.Sink = &Replicator{}
+
+func (r *Replicator) init() {
+	r.initOnce.Do(func() {
+		n := r.Migration.Concurrency
+		if n <= 0 {
+			n = 1
+		}
+		r.workers = make([]*replicationWorker, n)
+		for i := range r.workers {
+			r.workers[i] = &replicationWorker{
+				pending: map[string]time.Time{},
+				signal:  make(chan struct{}, 1),
+			}
+		}
+	})
+}
+
+func (r *Replicator) worker(key string) *replicationWorker {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return r.workers[h.Sum32()%uint32(len(r.workers))]
+}
+
+// Notify schedules the key to be synced.
+func (r *Replicator) Notify(key string) {
+	r.init()
+	r.worker(key).add(key, time.Now())
+}
+
+func (w *replicationWorker) add(key string, t time.Time) {
+	w.mutex.Lock()
+	if _, ok := w.pending[key]; !ok {
+		w.pending[key] = t
+		w.queue = append(w.queue, key)
+	}
+	w.mutex.Unlock()
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+// next removes the next key from the queue. If no key is ready, it returns how long to wait for
+// one, or zero if the queue is empty.
+func (w *replicationWorker) next(delay time.Duration) (string, time.Time, time.Duration) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if len(w.queue) == 0 {
+		return "", time.Time{}, 0
+	}
+	key := w.queue[0]
+	t := w.pending[key]
+	if wait := time.Until(t.Add(delay)); wait > 0 {
+		return "", time.Time{}, wait
+	}
+	w.queue = w.queue[1:]
+	delete(w.pending, key)
+	w.syncing = t
+	return key, t, 0
+}
+
+func (w *replicationWorker) done() {
+	w.mutex.Lock()
+	w.syncing = time.Time{}
+	w.mutex.Unlock()
+}
+
+// oldest returns the time of the oldest change that hasn't been synced yet.
+func (w *replicationWorker) oldest() time.Time {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	oldest := w.syncing
+	if len(w.queue) > 0 {
+		if t := w.pending[w.queue[0]]; oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	return oldest
+}
+
+// Pending returns the number of keys waiting to be synced.
+func (r *Replicator) Pending() int {
+	r.init()
+	n := 0
+	for _, w := range r.workers {
+		w.mutex.Lock()
+		n += len(w.queue)
+		w.mutex.Unlock()
+	}
+	return n
+}
+
+// Lag returns the time that has elapsed since the oldest change that hasn't been synced yet, or
+// zero if the destination is caught up.
+func (r *Replicator) Lag() time.Duration {
+	r.init()
+	var oldest time.Time
+	for _, w := range r.workers {
+		if t := w.oldest(); !t.IsZero() && (oldest.IsZero() || t.Before(oldest)) {
+			oldest = t
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest)
+}
+
+// Start begins syncing keys in the background. The returned function stops the replicator and
+// waits for any in-progress syncs to complete. Keys that are still pending remain queued and are
+// synced if the replicator is started again.
+func (r *Replicator) Start() (func(), error) {
+	r.init()
+	getter, err := r.Migration.entryGetter()
+	if err != nil {
+		return nil, err
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(len(r.workers))
+	for _, w := range r.workers {
+		w := w
+		go func() {
+			defer wg.Done()
+			r.run(w, getter, stop)
+		}()
+	}
+	return func() {
+		close(stop)
+		wg.Wait()
+	}, nil
+}
+
+func (r *Replicator) run(w *replicationWorker, getter keyvaluestore.EntryGetter, stop <-chan struct{}) {
+	retryInterval := r.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = DefaultReplicationRetryInterval
+	}
+
+	for {
+		key, t, wait := w.next(r.Delay)
+		if key == "" {
+			var timer <-chan time.Time
+			if wait > 0 {
+				timer = time.After(wait)
+			}
+			select {
+			case <-w.signal:
+			case <-timer:
+			case <-stop:
+				return
+			}
+			continue
+		}
+
+		err := r.sync(getter, key)
+		w.done()
+		if err == nil {
+			if r.OnSync != nil {
+				r.OnSync(key, time.Since(t))
+			}
+			continue
+		}
+
+		if r.OnError != nil {
+			r.OnError(key, err)
+		}
+		w.add(key, t)
+		select {
+		case <-time.After(retryInterval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (r *Replicator) sync(getter keyvaluestore.EntryGetter, key string) error {
+	entry, err := getter.GetEntry(key)
+	if err != nil {
+		return err
+	}
+	if err := r.Migration.syncEntry(key, entry); err != nil {
+		return fmt.Errorf("unable to sync %v: %w", key, err)
+	}
+	return nil
+}
+
+// Watch notifies the replicator of changes to keys in the source that begin with the given prefix.
+// The source must implement keyvaluestore.ObservableBackend. For Redis, keyspace notifications must
+// be enabled on the server. The returned function stops watching.
+func (r *Replicator) Watch(prefix string) (func(), error) {
+	source, ok := r.Migration.Source.(keyvaluestore.ObservableBackend)
+	if !ok {
+		return nil, fmt.Errorf("source does not support watching: %T: %w", r.Migration.Source, keyvaluestore.ErrNotSupported)
+	}
+	keys, stop, err := source.WatchPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for key := range keys {
+			r.Notify(key)
+		}
+	}()
+	return func() {
+		stop()
+		<-done
+	}, nil
+}
+
+// Wrap returns a backend that notifies the replicator of the keys written through it once the
+// writes complete.
+func (r *Replicator) Wrap(b keyvaluestore.Backend) keyvaluestore.Backend {
+	return &keyvaluestoreinvalidator.Invalidator{
+		Backend:    b,
+		Invalidate: r.Notify,
+	}
+}
+
+// Append notifies the replicator of the keys written by an operation log entry.
+func (r *Replicator) Append(entry *keyvaluestoreoplog.Entry) error {
+	if len(entry.Args) > 0 && entry.Method != "AtomicWrite" {
+		r.Notify(entry.Args[0])
+	}
+	for _, op := range entry.Operations {
+		if err := r.Append(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package keyvaluestoremigrate
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreoplog"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func waitFor(t *testing.T, f func() bool) {
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(time.Millisecond) {
+		if f() {
+			return
+		}
+		require.True(t, time.Now().Before(deadline), "timed out waiting for replication")
+	}
+}
+
+func TestReplicator(t *testing.T) {
+	source := memorystore.NewBackend()
+	dest := memorystore.NewBackend()
+
+	var synced int64
+	r := &Replicator{
+		Migration: &Migration{
+			Source:      source,
+			Destination: dest,
+			Concurrency: 3,
+		},
+		OnSync: func(key string, lag time.Duration) {
+			atomic.AddInt64(&synced, 1)
+		},
+	}
+	stop, err := r.Start()
+	require.NoError(t, err)
+	defer stop()
+	stopWatching, err := r.Watch("")
+	require.NoError(t, err)
+	defer stopWatching()
+
+	require.NoError(t, source.Set("string", "foo"))
+	require.NoError(t, source.SAdd("set", "a", "b"))
+	require.NoError(t, source.ZHAdd("sortedhash", "field", "value", 1))
+
+	waitFor(t, func() bool {
+		v, err := dest.Get("string")
+		require.NoError(t, err)
+		members, err := dest.SMembers("set")
+		require.NoError(t, err)
+		sortedHash, err := dest.ZHRangeByScore("sortedhash", 0, 10, 0)
+		require.NoError(t, err)
+		return v != nil && *v == "foo" && len(members) == 2 && len(sortedHash) == 1
+	})
+
+	_, err = source.Delete("string")
+	require.NoError(t, err)
+	waitFor(t, func() bool {
+		v, err := dest.Get("string")
+		require.NoError(t, err)
+		return v == nil
+	})
+
+	waitFor(t, func() bool {
+		return r.Pending() == 0 && r.Lag() == 0
+	})
+	assert.True(t, atomic.LoadInt64(&synced) >= 4)
+}
+
+// unavailableBackend fails writes while unavailable is non-zero.
+type unavailableBackend struct {
+	keyvaluestore.Backend
+	unavailable int32
+}
+
+func (b *unavailableBackend) Set(key string, value interface{}) error {
+	if atomic.LoadInt32(&b.unavailable) != 0 {
+		return errors.New("unavailable")
+	}
+	return b.Backend.Set(key, value)
+}
+
+func TestReplicatorRetry(t *testing.T) {
+	source := memorystore.NewBackend()
+	require.NoError(t, source.Set("foo", "bar"))
+
+	dest := &unavailableBackend{
+		Backend:     memorystore.NewBackend(),
+		unavailable: 1,
+	}
+	errs := make(chan error, 1)
+	r := &Replicator{
+		Migration: &Migration{
+			Source:      source,
+			Destination: dest,
+		},
+		RetryInterval: time.Millisecond,
+		OnError: func(key string, err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	}
+	r.Notify("foo")
+	assert.Equal(t, 1, r.Pending())
+
+	stop, err := r.Start()
+	require.NoError(t, err)
+	defer stop()
+
+	assert.Error(t, <-errs)
+	assert.True(t, r.Lag() > 0)
+
+	// Once the destination recovers, the key is synced.
+	atomic.StoreInt32(&dest.unavailable, 0)
+	waitFor(t, func() bool {
+		v, err := dest.Get("foo")
+		require.NoError(t, err)
+		return v != nil && *v == "bar"
+	})
+}
+
+func TestReplicatorOpLog(t *testing.T) {
+	source := memorystore.NewBackend()
+	dest := memorystore.NewBackend()
+	r := &Replicator{
+		Migration: &Migration{
+			Source:      source,
+			Destination: dest,
+		},
+		Delay: 10 * time.Millisecond,
+	}
+	app := &keyvaluestoreoplog.Backend{
+		Backend: source,
+		Sink:    r,
+	}
+
+	tx := app.AtomicWrite()
+	tx.Set("foo", "bar")
+	tx.HSet("hash", "field", "value")
+	_, err := tx.Exec()
+	require.NoError(t, err)
+	assert.Equal(t, 2, r.Pending())
+
+	stop, err := r.Start()
+	require.NoError(t, err)
+	defer stop()
+
+	waitFor(t, func() bool {
+		v, err := dest.HGet("hash", "field")
+		require.NoError(t, err)
+		return v != nil && *v == "value"
+	})
+}
+
+func TestReplicatorUnsupportedSource(t *testing.T) {
+	r := &Replicator{
+		Migration: &Migration{
+			Source:      opaqueBackend{memorystore.NewBackend()},
+			Destination: memorystore.NewBackend(),
+		},
+	}
+	_, err := r.Start()
+	assert.True(t, errors.Is(err, keyvaluestore.ErrNotSupported))
+	_, err = r.Watch("")
+	assert.True(t, errors.Is(err, keyvaluestore.ErrNotSupported))
+}
@@ -0,0 +1,50 @@
+package keyvaluestoremigrate
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreinvalidator"
+)
+
+// Tracker records the keys that are written while a migration is in progress so that they can be
+// re-synced once the initial copy is complete.
+type Tracker struct {
+	mutex sync.Mutex
+	keys  map[string]struct{}
+}
+
+// Wrap returns a backend that records the keys written through it. Applications should write to
+// the source through the returned backend for the duration of the migration.
+func (t *Tracker) Wrap(b keyvaluestore.Backend) keyvaluestore.Backend {
+	return &keyvaluestoreinvalidator.Invalidator{
+		Backend:    b,
+		Invalidate: t.Touch,
+	}
+}
+
+// Touch records a key as written.
+func (t *Tracker) Touch(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.keys == nil {
+		t.keys = map[string]struct{}{}
+	}
+	t.keys[key] = struct{}{}
+}
+
+// Drain returns the keys written since the last call to Drain in sorted order.
+func (t *Tracker) Drain() []string {
+	t.mutex.Lock()
+	keys := t.keys
+	t.keys = nil
+	t.mutex.Unlock()
+
+	ret := make([]string, 0, len(keys))
+	for key := range keys {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
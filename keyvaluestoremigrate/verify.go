@@ -0,0 +1,124 @@
+package keyvaluestoremigrate
+
+import (
+	"fmt"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorecheck"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreexport"
+)
+
+// Mismatch describes a key whose contents differ between the source and destination.
+type Mismatch struct {
+	Key string
+
+	// Expected is the source's entry, or nil if the key only exists in the destination.
+	Expected *keyvaluestore.Entry
+
+	// Actual is the destination's entry, or nil if the key is missing from the destination.
+	Actual *keyvaluestore.Entry
+}
+
+func (m *Mismatch) String() string {
+	switch {
+	case m.Expected == nil:
+		return fmt.Sprintf("%v: unexpected key in destination", m.Key)
+	case m.Actual == nil:
+		return fmt.Sprintf("%v: missing from destination", m.Key)
+	}
+	return fmt.Sprintf("%v: %v differs", m.Key, m.Expected.Type)
+}
+
+// Verification is the result of a verification pass.
+type Verification struct {
+	// The number of keys compared.
+	Checked int
+
+	Mismatches []*Mismatch
+}
+
+// Verify compares every key in the source to the destination. If the destination implements
+// keyvaluestore.Scanner, keys that only exist in the destination are reported as well.
+func (m *Migration) Verify() (*Verification, error) {
+	scanner, err := m.scanner()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &Verification{}
+	err = scanAll(scanner, m.PageSize, func(entries []*keyvaluestore.Entry) error {
+		actual := make([]*keyvaluestore.Entry, len(entries))
+		if err := m.forEach(len(entries), func(i int) error {
+			entry, err := m.destinationEntry(entries[i].Key, entries[i].Type)
+			actual[i] = entry
+			return err
+		}); err != nil {
+			return err
+		}
+		for i, expected := range entries {
+			ret.Checked++
+			if !m.entriesEqual(expected, actual[i]) {
+				ret.Mismatches = append(ret.Mismatches, &Mismatch{
+					Key:      expected.Key,
+					Expected: expected,
+					Actual:   actual[i],
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	destScanner, ok := m.Destination.(keyvaluestore.Scanner)
+	if !ok {
+		return ret, nil
+	}
+	getter, err := m.entryGetter()
+	if err != nil {
+		return nil, err
+	}
+	err = scanAll(destScanner, m.PageSize, func(entries []*keyvaluestore.Entry) error {
+		for _, entry := range entries {
+			if expected, err := getter.GetEntry(entry.Key); err != nil {
+				return err
+			} else if expected == nil {
+				ret.Mismatches = append(ret.Mismatches, &Mismatch{
+					Key:    entry.Key,
+					Actual: entry,
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func scanAll(scanner keyvaluestore.Scanner, pageSize int, f func([]*keyvaluestore.Entry) error) error {
+	if pageSize <= 0 {
+		pageSize = keyvaluestoreexport.DefaultPageSize
+	}
+	cursor := ""
+	for {
+		entries, next, err := scanner.Scan(cursor, pageSize)
+		if err != nil {
+			return err
+		} else if err := f(entries); err != nil {
+			return err
+		} else if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// entriesEqual compares entries, ignoring the fields of sorted set members if the destination
+// can't read them.
+func (m *Migration) entriesEqual(expected, actual *keyvaluestore.Entry) bool {
+	_, exact := m.Destination.(keyvaluestore.EntryGetter)
+	return keyvaluestorecheck.Compare(expected, actual, exact) == nil
+}
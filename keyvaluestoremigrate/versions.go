@@ -0,0 +1,99 @@
+package keyvaluestoremigrate
+
+import (
+	"fmt"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Versions allows the format of long-lived values to evolve. Values are written with a leading
+// version byte, and values written in older formats are upgraded lazily when they're read.
+//
+// Versions start at 1. Upgrades[0] converts a version 1 value to version 2, Upgrades[1] converts a
+// version 2 value to version 3, and so on. The current version is len(Upgrades) + 1. Upgrades must
+// never be removed or reordered once values have been written with them.
+type Versions struct {
+	Upgrades []func(value []byte) ([]byte, error)
+}
+
+// Current returns the version that values are written with.
+func (v *Versions) Current() byte {
+	return byte(len(v.Upgrades) + 1)
+}
+
+// Encode prepends the current version to a value.
+func (v *Versions) Encode(value []byte) []byte {
+	return append([]byte{v.Current()}, value...)
+}
+
+// Decode strips the version from an encoded value and upgrades it to the current version if
+// necessary. It also returns the version the value was encoded with.
+func (v *Versions) Decode(data []byte) ([]byte, byte, error) {
+	if len(data) == 0 {
+		return nil, 0, &VersionError{}
+	}
+	version, value := data[0], data[1:]
+	if version < 1 || version > v.Current() {
+		return nil, version, &VersionError{
+			Version: version,
+		}
+	}
+	for i := version; i < v.Current(); i++ {
+		upgraded, err := v.Upgrades[i-1](value)
+		if err != nil {
+			return nil, version, &VersionError{
+				Version: version,
+				Err:     err,
+			}
+		}
+		value = upgraded
+	}
+	return value, version, nil
+}
+
+// Set encodes the value and sets the key to it.
+func (v *Versions) Set(b keyvaluestore.Backend, key string, value []byte) error {
+	return b.Set(key, v.Encode(value))
+}
+
+// Get gets the key's value, upgrading it if necessary. If the key doesn't exist, nil is returned.
+//
+// If the value was upgraded, the upgraded value is written back so that the upgrade doesn't need
+// to be repeated. The write is conditional, so concurrent writes aren't overwritten, and it's
+// best-effort: if it fails, the upgraded value is still returned.
+func (v *Versions) Get(b keyvaluestore.Backend, key string) ([]byte, error) {
+	data, err := b.Get(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	value, version, err := v.Decode([]byte(*data))
+	if err != nil {
+		err.(*VersionError).Key = key
+		return nil, err
+	}
+	if version != v.Current() {
+		b.SetEQ(key, v.Encode(value), *data)
+	}
+	return value, nil
+}
+
+// VersionError is returned when a value can't be decoded, either because it has an unknown
+// version or because an upgrade failed.
+type VersionError struct {
+	Key     string
+	Version byte
+
+	// Err is the error returned by the upgrade, if any.
+	Err error
+}
+
+func (e *VersionError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("unable to upgrade key %v from version %v: %v", e.Key, e.Version, e.Err)
+	}
+	return fmt.Sprintf("unknown version %v for key %v", e.Version, e.Key)
+}
+
+func (e *VersionError) Unwrap() error {
+	return e.Err
+}
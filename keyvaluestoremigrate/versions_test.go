@@ -0,0 +1,63 @@
+package keyvaluestoremigrate
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestVersions(t *testing.T) {
+	b := memorystore.NewBackend()
+
+	v1 := &Versions{}
+	require.NoError(t, v1.Set(b, "foo", []byte("bar")))
+
+	errUpgrade := errors.New("upgrade failed")
+	v3 := &Versions{
+		Upgrades: []func([]byte) ([]byte, error){
+			func(value []byte) ([]byte, error) {
+				return bytes.ToUpper(value), nil
+			},
+			func(value []byte) ([]byte, error) {
+				if len(value) == 0 {
+					return nil, errUpgrade
+				}
+				return append(value, '!'), nil
+			},
+		},
+	}
+	assert.EqualValues(t, 3, v3.Current())
+
+	value, err := v3.Get(b, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "BAR!", string(value))
+
+	// The upgraded value should have been written back.
+	raw, err := b.Get("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "\x03BAR!", *raw)
+
+	value, err = v3.Get(b, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "BAR!", string(value))
+
+	value, err = v3.Get(b, "missing")
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	// Newer versions can't be read by older code.
+	_, err = v1.Get(b, "foo")
+	var versionErr *VersionError
+	require.True(t, errors.As(err, &versionErr))
+	assert.Equal(t, "foo", versionErr.Key)
+	assert.EqualValues(t, 3, versionErr.Version)
+
+	require.NoError(t, v1.Set(b, "empty", nil))
+	_, err = v3.Get(b, "empty")
+	assert.True(t, errors.Is(err, errUpgrade))
+}
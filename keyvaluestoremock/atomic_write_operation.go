@@ -0,0 +1,26 @@
+package keyvaluestoremock
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+type atomicWriteOperation struct {
+	keyvaluestore.AtomicWriteOperation
+	backend *Backend
+}
+
+func (op *atomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.AtomicWriteOperation.WithIdempotencyToken(token)
+	return op
+}
+
+func (op *atomicWriteOperation) Exec() (bool, error) {
+	b := op.backend
+	b.mutex.Lock()
+	err := b.Errors["AtomicWrite"]
+	b.mutex.Unlock()
+	if err != nil {
+		return false, err
+	}
+	return op.AtomicWriteOperation.Exec()
+}
@@ -0,0 +1,551 @@
+// Package keyvaluestoremock provides a backend whose behavior can be programmed per test. It's
+// useful for testing how application code handles errors and other results that are hard to
+// produce with a real store.
+package keyvaluestoremock
+
+import (
+	"sync"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+// Call is a record of a method invocation.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Backend records every call made to it. For each method, the result is determined as follows:
+//
+// 1. If Errors contains an error for the method's name, that error is returned.
+// 2. If the method's Func field is non-nil, it's invoked.
+// 3. Otherwise, the call is passed through to Fallback.
+//
+// The zero value is ready to use. If Fallback is nil, a new memorystore backend is used.
+type Backend struct {
+	// Fallback handles calls that aren't programmed.
+	Fallback keyvaluestore.Backend
+
+	// Errors maps method names to errors that the methods should return. To make atomic writes
+	// fail, use "AtomicWrite" as the method name. The error will be returned by Exec.
+	Errors map[string]error
+
+	AtomicWriteFunc                 func() keyvaluestore.AtomicWriteOperation
+	PingFunc                        func() error
+	CloseFunc                       func() error
+	DeleteFunc                      func(key string) (bool, error)
+	GetFunc                         func(key string) (*string, error)
+	SetFunc                         func(key string, value interface{}) error
+	SetXXFunc                       func(key string, value interface{}) (bool, error)
+	SetNXFunc                       func(key string, value interface{}) (bool, error)
+	SetEQFunc                       func(key string, value, oldValue interface{}) (bool, error)
+	NIncrByFunc                     func(key string, n int64) (int64, error)
+	SAddFunc                        func(key string, member interface{}, members ...interface{}) error
+	SRemFunc                        func(key string, member interface{}, members ...interface{}) error
+	SMembersFunc                    func(key string) ([]string, error)
+	HSetFunc                        func(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error
+	HDelFunc                        func(key, field string, fields ...string) error
+	HGetFunc                        func(key, field string) (*string, error)
+	HGetAllFunc                     func(key string) (map[string]string, error)
+	ZAddFunc                        func(key string, member interface{}, score float64) error
+	ZScoreFunc                      func(key string, member interface{}) (*float64, error)
+	ZRemFunc                        func(key string, member interface{}) error
+	ZIncrByFunc                     func(key string, member interface{}, n float64) (float64, error)
+	ZRangeByScoreFunc               func(key string, min, max float64, limit int) ([]string, error)
+	ZRangeByScoreWithScoresFunc     func(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error)
+	ZRevRangeByScoreFunc            func(key string, min, max float64, limit int) ([]string, error)
+	ZRevRangeByScoreWithScoresFunc  func(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error)
+	ZCountFunc                      func(key string, min, max float64) (int, error)
+	ZLexCountFunc                   func(key string, min, max string) (int, error)
+	ZRangeByLexFunc                 func(key string, min, max string, limit int) ([]string, error)
+	ZRevRangeByLexFunc              func(key string, min, max string, limit int) ([]string, error)
+	ZHAddFunc                       func(key, field string, member interface{}, score float64) error
+	ZHMAddFunc                      func(key string, entries []keyvaluestore.ZHEntry) error
+	ZHRemFunc                       func(key, field string) error
+	ZHRemEQFunc                     func(key, field string, member interface{}) (bool, error)
+	ZHRangeByScoreFunc              func(key string, min, max float64, limit int) ([]string, error)
+	ZHRangeByScoreWithScoresFunc    func(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error)
+	ZHRevRangeByScoreFunc           func(key string, min, max float64, limit int) ([]string, error)
+	ZHRevRangeByScoreWithScoresFunc func(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error)
+	ZHRangeByLexFunc                func(key string, min, max string, limit int) ([]string, error)
+	ZHRevRangeByLexFunc             func(key string, min, max string, limit int) ([]string, error)
+
+	mutex sync.Mutex
+	calls []Call
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+
+// SetError programs the given method to return an error. Passing a nil error clears it. Unlike
+// modifying Errors directly, it's safe to call while the backend is in use.
+func (b *Backend) SetError(method string, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil {
+		delete(b.Errors, method)
+		return
+	}
+	if b.Errors == nil {
+		b.Errors = map[string]error{}
+	}
+	b.Errors[method] = err
+}
+
+// Calls returns all of the calls that have been made so far.
+func (b *Backend) Calls() []Call {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]Call(nil), b.calls...)
+}
+
+// CallsTo returns the calls that have been made to the given method so far.
+func (b *Backend) CallsTo(method string) []Call {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var ret []Call
+	for _, call := range b.calls {
+		if call.Method == method {
+			ret = append(ret, call)
+		}
+	}
+	return ret
+}
+
+// ResetCalls forgets all of the calls that have been made so far.
+func (b *Backend) ResetCalls() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.calls = nil
+}
+
+func (b *Backend) record(method string, args ...interface{}) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.calls = append(b.calls, Call{
+		Method: method,
+		Args:   args,
+	})
+	return b.Errors[method]
+}
+
+func (b *Backend) fallback() keyvaluestore.Backend {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.Fallback == nil {
+		b.Fallback = memorystore.NewBackend()
+	}
+	return b.Fallback
+}
+
+// Batch returns a batch that executes each of its operations via the backend's methods, so
+// programmed results apply to batches too.
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	b.record("Batch")
+	return &keyvaluestore.FallbackBatchOperation{
+		Backend: b,
+	}
+}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	b.record("AtomicWrite")
+	if b.AtomicWriteFunc != nil {
+		return b.AtomicWriteFunc()
+	}
+	return &atomicWriteOperation{
+		AtomicWriteOperation: b.fallback().AtomicWrite(),
+		backend:              b,
+	}
+}
+
+func (b *Backend) Ping() error {
+	if err := b.record("Ping"); err != nil {
+		return err
+	}
+	if b.PingFunc != nil {
+		return b.PingFunc()
+	}
+	return b.fallback().Ping()
+}
+
+func (b *Backend) Close() error {
+	if err := b.record("Close"); err != nil {
+		return err
+	}
+	if b.CloseFunc != nil {
+		return b.CloseFunc()
+	}
+	return b.fallback().Close()
+}
+
+func (b *Backend) Delete(key string) (bool, error) {
+	if err := b.record("Delete", key); err != nil {
+		return false, err
+	}
+	if b.DeleteFunc != nil {
+		return b.DeleteFunc(key)
+	}
+	return b.fallback().Delete(key)
+}
+
+func (b *Backend) Get(key string) (*string, error) {
+	if err := b.record("Get", key); err != nil {
+		return nil, err
+	}
+	if b.GetFunc != nil {
+		return b.GetFunc(key)
+	}
+	return b.fallback().Get(key)
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	if err := b.record("Set", key, value); err != nil {
+		return err
+	}
+	if b.SetFunc != nil {
+		return b.SetFunc(key, value)
+	}
+	return b.fallback().Set(key, value)
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	if err := b.record("SetXX", key, value); err != nil {
+		return false, err
+	}
+	if b.SetXXFunc != nil {
+		return b.SetXXFunc(key, value)
+	}
+	return b.fallback().SetXX(key, value)
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	if err := b.record("SetNX", key, value); err != nil {
+		return false, err
+	}
+	if b.SetNXFunc != nil {
+		return b.SetNXFunc(key, value)
+	}
+	return b.fallback().SetNX(key, value)
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	if err := b.record("SetEQ", key, value, oldValue); err != nil {
+		return false, err
+	}
+	if b.SetEQFunc != nil {
+		return b.SetEQFunc(key, value, oldValue)
+	}
+	return b.fallback().SetEQ(key, value, oldValue)
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	if err := b.record("NIncrBy", key, n); err != nil {
+		return 0, err
+	}
+	if b.NIncrByFunc != nil {
+		return b.NIncrByFunc(key, n)
+	}
+	return b.fallback().NIncrBy(key, n)
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	if err := b.record("SAdd", key, member, members); err != nil {
+		return err
+	}
+	if b.SAddFunc != nil {
+		return b.SAddFunc(key, member, members...)
+	}
+	return b.fallback().SAdd(key, member, members...)
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	if err := b.record("SRem", key, member, members); err != nil {
+		return err
+	}
+	if b.SRemFunc != nil {
+		return b.SRemFunc(key, member, members...)
+	}
+	return b.fallback().SRem(key, member, members...)
+}
+
+func (b *Backend) SMembers(key string) ([]string, error) {
+	if err := b.record("SMembers", key); err != nil {
+		return nil, err
+	}
+	if b.SMembersFunc != nil {
+		return b.SMembersFunc(key)
+	}
+	return b.fallback().SMembers(key)
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	if err := b.record("HSet", key, field, value, fields); err != nil {
+		return err
+	}
+	if b.HSetFunc != nil {
+		return b.HSetFunc(key, field, value, fields...)
+	}
+	return b.fallback().HSet(key, field, value, fields...)
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	if err := b.record("HDel", key, field, fields); err != nil {
+		return err
+	}
+	if b.HDelFunc != nil {
+		return b.HDelFunc(key, field, fields...)
+	}
+	return b.fallback().HDel(key, field, fields...)
+}
+
+func (b *Backend) HGet(key, field string) (*string, error) {
+	if err := b.record("HGet", key, field); err != nil {
+		return nil, err
+	}
+	if b.HGetFunc != nil {
+		return b.HGetFunc(key, field)
+	}
+	return b.fallback().HGet(key, field)
+}
+
+func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	if err := b.record("HGetAll", key); err != nil {
+		return nil, err
+	}
+	if b.HGetAllFunc != nil {
+		return b.HGetAllFunc(key)
+	}
+	return b.fallback().HGetAll(key)
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
+	if err := b.record("ZAdd", key, member, score); err != nil {
+		return err
+	}
+	if b.ZAddFunc != nil {
+		return b.ZAddFunc(key, member, score)
+	}
+	return b.fallback().ZAdd(key, member, score)
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	if err := b.record("ZScore", key, member); err != nil {
+		return nil, err
+	}
+	if b.ZScoreFunc != nil {
+		return b.ZScoreFunc(key, member)
+	}
+	return b.fallback().ZScore(key, member)
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	if err := b.record("ZRem", key, member); err != nil {
+		return err
+	}
+	if b.ZRemFunc != nil {
+		return b.ZRemFunc(key, member)
+	}
+	return b.fallback().ZRem(key, member)
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	if err := b.record("ZIncrBy", key, member, n); err != nil {
+		return 0, err
+	}
+	if b.ZIncrByFunc != nil {
+		return b.ZIncrByFunc(key, member, n)
+	}
+	return b.fallback().ZIncrBy(key, member, n)
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	if err := b.record("ZRangeByScore", key, min, max, limit); err != nil {
+		return nil, err
+	}
+	if b.ZRangeByScoreFunc != nil {
+		return b.ZRangeByScoreFunc(key, min, max, limit)
+	}
+	return b.fallback().ZRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.record("ZRangeByScoreWithScores", key, min, max, limit); err != nil {
+		return nil, err
+	}
+	if b.ZRangeByScoreWithScoresFunc != nil {
+		return b.ZRangeByScoreWithScoresFunc(key, min, max, limit)
+	}
+	return b.fallback().ZRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	if err := b.record("ZRevRangeByScore", key, min, max, limit); err != nil {
+		return nil, err
+	}
+	if b.ZRevRangeByScoreFunc != nil {
+		return b.ZRevRangeByScoreFunc(key, min, max, limit)
+	}
+	return b.fallback().ZRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.record("ZRevRangeByScoreWithScores", key, min, max, limit); err != nil {
+		return nil, err
+	}
+	if b.ZRevRangeByScoreWithScoresFunc != nil {
+		return b.ZRevRangeByScoreWithScoresFunc(key, min, max, limit)
+	}
+	return b.fallback().ZRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	if err := b.record("ZCount", key, min, max); err != nil {
+		return 0, err
+	}
+	if b.ZCountFunc != nil {
+		return b.ZCountFunc(key, min, max)
+	}
+	return b.fallback().ZCount(key, min, max)
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
+	if err := b.record("ZLexCount", key, min, max); err != nil {
+		return 0, err
+	}
+	if b.ZLexCountFunc != nil {
+		return b.ZLexCountFunc(key, min, max)
+	}
+	return b.fallback().ZLexCount(key, min, max)
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	if err := b.record("ZRangeByLex", key, min, max, limit); err != nil {
+		return nil, err
+	}
+	if b.ZRangeByLexFunc != nil {
+		return b.ZRangeByLexFunc(key, min, max, limit)
+	}
+	return b.fallback().ZRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	if err := b.record("ZRevRangeByLex", key, min, max, limit); err != nil {
+		return nil, err
+	}
+	if b.ZRevRangeByLexFunc != nil {
+		return b.ZRevRangeByLexFunc(key, min, max, limit)
+	}
+	return b.fallback().ZRevRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	if err := b.record("ZHAdd", key, field, member, score); err != nil {
+		return err
+	}
+	if b.ZHAddFunc != nil {
+		return b.ZHAddFunc(key, field, member, score)
+	}
+	return b.fallback().ZHAdd(key, field, member, score)
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	if err := b.record("ZHMAdd", key, entries); err != nil {
+		return err
+	}
+	if b.ZHMAddFunc != nil {
+		return b.ZHMAddFunc(key, entries)
+	}
+	return b.fallback().ZHMAdd(key, entries)
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	if err := b.record("ZHRem", key, field); err != nil {
+		return err
+	}
+	if b.ZHRemFunc != nil {
+		return b.ZHRemFunc(key, field)
+	}
+	return b.fallback().ZHRem(key, field)
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	if err := b.record("ZHRemEQ", key, field, member); err != nil {
+		return false, err
+	}
+	if b.ZHRemEQFunc != nil {
+		return b.ZHRemEQFunc(key, field, member)
+	}
+	return b.fallback().ZHRemEQ(key, field, member)
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	if err := b.record("ZHRangeByScore", key, min, max, limit); err != nil {
+		return nil, err
+	}
+	if b.ZHRangeByScoreFunc != nil {
+		return b.ZHRangeByScoreFunc(key, min, max, limit)
+	}
+	return b.fallback().ZHRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.record("ZHRangeByScoreWithScores", key, min, max, limit); err != nil {
+		return nil, err
+	}
+	if b.ZHRangeByScoreWithScoresFunc != nil {
+		return b.ZHRangeByScoreWithScoresFunc(key, min, max, limit)
+	}
+	return b.fallback().ZHRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	if err := b.record("ZHRevRangeByScore", key, min, max, limit); err != nil {
+		return nil, err
+	}
+	if b.ZHRevRangeByScoreFunc != nil {
+		return b.ZHRevRangeByScoreFunc(key, min, max, limit)
+	}
+	return b.fallback().ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.record("ZHRevRangeByScoreWithScores", key, min, max, limit); err != nil {
+		return nil, err
+	}
+	if b.ZHRevRangeByScoreWithScoresFunc != nil {
+		return b.ZHRevRangeByScoreWithScoresFunc(key, min, max, limit)
+	}
+	return b.fallback().ZHRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	if err := b.record("ZHRangeByLex", key, min, max, limit); err != nil {
+		return nil, err
+	}
+	if b.ZHRangeByLexFunc != nil {
+		return b.ZHRangeByLexFunc(key, min, max, limit)
+	}
+	return b.fallback().ZHRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	if err := b.record("ZHRevRangeByLex", key, min, max, limit); err != nil {
+		return nil, err
+	}
+	if b.ZHRevRangeByLexFunc != nil {
+		return b.ZHRevRangeByLexFunc(key, min, max, limit)
+	}
+	return b.fallback().ZHRevRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	return b
+}
+
+func (b *Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	return b
+}
+
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return nil
+}
@@ -0,0 +1,74 @@
+package keyvaluestoremock
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return &Backend{}
+	})
+}
+
+func TestProgramming(t *testing.T) {
+	b := &Backend{
+		GetFunc: func(key string) (*string, error) {
+			v := "mocked " + key
+			return &v, nil
+		},
+	}
+
+	v, err := b.Get("foo")
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, "mocked foo", *v)
+
+	require.NoError(t, b.SAdd("set", "a", "b"))
+	members, err := b.SMembers("set")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, members)
+
+	assert.Equal(t, []Call{
+		{Method: "Get", Args: []interface{}{"foo"}},
+		{Method: "SAdd", Args: []interface{}{"set", "a", []interface{}{"b"}}},
+		{Method: "SMembers", Args: []interface{}{"set"}},
+	}, b.Calls())
+	assert.Len(t, b.CallsTo("SAdd"), 1)
+
+	b.ResetCalls()
+	assert.Empty(t, b.Calls())
+}
+
+func TestErrors(t *testing.T) {
+	b := &Backend{}
+	testErr := errors.New("test")
+
+	b.SetError("Set", testErr)
+	assert.Equal(t, testErr, b.Set("foo", "bar"))
+
+	batch := b.Batch()
+	set := batch.Set("foo", "bar")
+	assert.Error(t, batch.Exec())
+	assert.Equal(t, testErr, set.Result())
+
+	b.SetError("Set", nil)
+	assert.NoError(t, b.Set("foo", "bar"))
+
+	b.SetError("AtomicWrite", testErr)
+	tx := b.AtomicWrite()
+	tx.Set("foo", "baz")
+	_, err := tx.Exec()
+	assert.Equal(t, testErr, err)
+
+	v, err := b.Get("foo")
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, "bar", *v)
+}
@@ -0,0 +1,432 @@
+package keyvaluestoremsgpack
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+var binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+
+var errUnexpectedEnd = errors.New("unexpected end of data")
+
+// Unmarshal decodes MessagePack into v, which must be a non-nil pointer. When decoding into an
+// empty interface, integers become int64 (or uint64 if they're too large), floats become float64,
+// binary becomes []byte, arrays become []interface{}, and maps become map[string]interface{} (or
+// map[interface{}]interface{} if any key isn't a string).
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("unmarshal requires a non-nil pointer: %T", v)
+	}
+	d := &decoder{
+		data: data,
+	}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	} else if d.pos != len(d.data) {
+		return fmt.Errorf("unexpected data after value")
+	}
+	return nil
+}
+
+type kind int
+
+const (
+	kindNil kind = iota
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindString
+	kindBinary
+	kindArray
+	kindMap
+)
+
+func (k kind) String() string {
+	return [...]string{"nil", "bool", "int", "uint", "float", "string", "binary", "array", "map"}[k]
+}
+
+// header is the beginning of an encoded value. For strings, binary, arrays, and maps, the contents
+// follow it.
+type header struct {
+	kind kind
+	b    bool
+	i    int64
+	u    uint64
+	f    float64
+
+	// n is the length of strings and binary, the number of elements in arrays, and the number of
+	// entries in maps.
+	n int
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errUnexpectedEnd
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) readUint(size int) (uint64, error) {
+	b, err := d.read(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (d *decoder) header() (header, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return header{}, err
+	}
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		return header{kind: kindUint, u: uint64(c)}, nil
+	case c >= 0xe0:
+		return header{kind: kindInt, i: int64(int8(c))}, nil
+	case c&0xe0 == 0xa0:
+		return header{kind: kindString, n: int(c & 0x1f)}, nil
+	case c&0xf0 == 0x90:
+		return header{kind: kindArray, n: int(c & 0x0f)}, nil
+	case c&0xf0 == 0x80:
+		return header{kind: kindMap, n: int(c & 0x0f)}, nil
+	}
+
+	var h header
+	var size int
+	switch c {
+	case 0xc0:
+		return header{kind: kindNil}, nil
+	case 0xc2, 0xc3:
+		return header{kind: kindBool, b: c == 0xc3}, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		h.kind, size = kindUint, 1<<(c-0xcc)
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		h.kind, size = kindInt, 1<<(c-0xd0)
+	case 0xca:
+		h.kind, size = kindFloat, 4
+	case 0xcb:
+		h.kind, size = kindFloat, 8
+	case 0xd9, 0xda, 0xdb:
+		h.kind, size = kindString, 1<<(c-0xd9)
+	case 0xc4, 0xc5, 0xc6:
+		h.kind, size = kindBinary, 1<<(c-0xc4)
+	case 0xdc, 0xdd:
+		h.kind, size = kindArray, 2<<(c-0xdc)
+	case 0xde, 0xdf:
+		h.kind, size = kindMap, 2<<(c-0xde)
+	default:
+		return header{}, fmt.Errorf("unsupported format: 0x%x", c)
+	}
+
+	n, err := d.readUint(size)
+	if err != nil {
+		return header{}, err
+	}
+	switch h.kind {
+	case kindUint:
+		h.u = n
+	case kindInt:
+		switch size {
+		case 1:
+			h.i = int64(int8(n))
+		case 2:
+			h.i = int64(int16(n))
+		case 4:
+			h.i = int64(int32(n))
+		default:
+			h.i = int64(n)
+		}
+	case kindFloat:
+		if size == 4 {
+			h.f = float64(math.Float32frombits(uint32(n)))
+		} else {
+			h.f = math.Float64frombits(n)
+		}
+	default:
+		// Every element takes at least one byte, so this prevents huge allocations for corrupt
+		// data.
+		if n > uint64(len(d.data)-d.pos) {
+			return header{}, errUnexpectedEnd
+		}
+		h.n = int(n)
+	}
+	return h, nil
+}
+
+func (d *decoder) decode(v reflect.Value) error {
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		x, err := d.decodeInterface()
+		if err != nil {
+			return err
+		} else if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+
+	start := d.pos
+	h, err := d.header()
+	if err != nil {
+		return err
+	}
+
+	if h.kind == kindNil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		d.pos = start
+		return d.decode(v.Elem())
+	}
+
+	if (h.kind == kindBinary || h.kind == kindString) && reflect.PtrTo(v.Type()).Implements(binaryUnmarshalerType) {
+		b, err := d.read(h.n)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(append([]byte(nil), b...))
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("cannot decode %v into %v", h.kind, v.Type())
+	}
+
+	switch h.kind {
+	case kindBool:
+		if v.Kind() != reflect.Bool {
+			return mismatch()
+		}
+		v.SetBool(h.b)
+	case kindInt, kindUint:
+		return setInt(v, h, mismatch)
+	case kindFloat:
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(h.f)
+		default:
+			return mismatch()
+		}
+	case kindString, kindBinary:
+		b, err := d.read(h.n)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(b))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), b...))
+		default:
+			return mismatch()
+		}
+	case kindArray:
+		switch v.Kind() {
+		case reflect.Slice:
+			v.Set(reflect.MakeSlice(v.Type(), h.n, h.n))
+		case reflect.Array:
+			if h.n > v.Len() {
+				return fmt.Errorf("cannot decode array of length %v into %v", h.n, v.Type())
+			}
+			v.Set(reflect.Zero(v.Type()))
+		default:
+			return mismatch()
+		}
+		for i := 0; i < h.n; i++ {
+			if err := d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case kindMap:
+		switch v.Kind() {
+		case reflect.Map:
+			return d.decodeMap(v, h.n)
+		case reflect.Struct:
+			return d.decodeStruct(v, h.n)
+		default:
+			return mismatch()
+		}
+	}
+	return nil
+}
+
+func setInt(v reflect.Value, h header, mismatch func() error) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := h.i
+		if h.kind == kindUint {
+			if h.u > math.MaxInt64 {
+				return fmt.Errorf("%v overflows %v", h.u, v.Type())
+			}
+			n = int64(h.u)
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("%v overflows %v", n, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n := h.u
+		if h.kind == kindInt {
+			if h.i < 0 {
+				return fmt.Errorf("%v overflows %v", h.i, v.Type())
+			}
+			n = uint64(h.i)
+		}
+		if v.OverflowUint(n) {
+			return fmt.Errorf("%v overflows %v", n, v.Type())
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if h.kind == kindUint {
+			v.SetFloat(float64(h.u))
+		} else {
+			v.SetFloat(float64(h.i))
+		}
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+func (d *decoder) decodeMap(v reflect.Value, n int) error {
+	t := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+	for i := 0; i < n; i++ {
+		key := reflect.New(t.Key()).Elem()
+		if err := d.decode(key); err != nil {
+			return err
+		}
+		value := reflect.New(t.Elem()).Elem()
+		if err := d.decode(value); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, value)
+	}
+	return nil
+}
+
+func (d *decoder) decodeStruct(v reflect.Value, n int) error {
+	fields := structFields(v.Type())
+	for i := 0; i < n; i++ {
+		var name string
+		if err := d.decode(reflect.ValueOf(&name).Elem()); err != nil {
+			return err
+		}
+		found := false
+		for _, f := range fields {
+			if f.name == name {
+				if err := d.decode(v.Field(f.index)); err != nil {
+					return err
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			// Unknown fields are ignored.
+			if _, err := d.decodeInterface(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *decoder) decodeInterface() (interface{}, error) {
+	h, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+
+	switch h.kind {
+	case kindNil:
+		return nil, nil
+	case kindBool:
+		return h.b, nil
+	case kindInt:
+		return h.i, nil
+	case kindUint:
+		if h.u > math.MaxInt64 {
+			return h.u, nil
+		}
+		return int64(h.u), nil
+	case kindFloat:
+		return h.f, nil
+	case kindString:
+		b, err := d.read(h.n)
+		return string(b), err
+	case kindBinary:
+		b, err := d.read(h.n)
+		return append([]byte(nil), b...), err
+	case kindArray:
+		ret := make([]interface{}, h.n)
+		for i := range ret {
+			if ret[i], err = d.decodeInterface(); err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	default:
+		keys := make([]interface{}, h.n)
+		values := make([]interface{}, h.n)
+		allStrings := true
+		for i := range keys {
+			if keys[i], err = d.decodeInterface(); err != nil {
+				return nil, err
+			} else if values[i], err = d.decodeInterface(); err != nil {
+				return nil, err
+			}
+			if _, ok := keys[i].(string); !ok {
+				allStrings = false
+			}
+		}
+		if allStrings {
+			ret := make(map[string]interface{}, h.n)
+			for i, k := range keys {
+				ret[k.(string)] = values[i]
+			}
+			return ret, nil
+		}
+		ret := make(map[interface{}]interface{}, h.n)
+		for i, k := range keys {
+			switch k.(type) {
+			case []interface{}, map[string]interface{}, map[interface{}]interface{}, []byte:
+				return nil, fmt.Errorf("unhashable map key: %T", k)
+			}
+			ret[k] = values[i]
+		}
+		return ret, nil
+	}
+}
@@ -0,0 +1,297 @@
+package keyvaluestoremsgpack
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+var binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+
+// Marshal encodes v as MessagePack. Map entries are sorted by their encoded keys so that equal
+// values always produce equal bytes, which allows them to be used with conditionals such as SetEQ.
+func Marshal(v interface{}) ([]byte, error) {
+	var e encoder
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf.WriteByte(0xc0)
+		return nil
+	}
+
+	if v.Type().Implements(binaryMarshalerType) && !isNil(v) {
+		b, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.encodeBinary(b)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf.WriteByte(0xc3)
+		} else {
+			e.buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.buf.WriteByte(0xca)
+		e.writeUint32(math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.buf.WriteByte(0xcb)
+		e.writeUint64(math.Float64bits(v.Float()))
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		} else if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.encodeBinary(v.Bytes())
+			return nil
+		}
+		return e.encodeArray(v)
+	case reflect.Array:
+		return e.encodeArray(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+		return e.encodeMap(v)
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	default:
+		return fmt.Errorf("unsupported type: %v", v.Type())
+	}
+	return nil
+}
+
+func (e *encoder) writeUint16(n uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], n)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) writeUint32(n uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], n)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) writeUint64(n uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) encodeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.encodeUint(uint64(n))
+	case n >= -32:
+		e.buf.WriteByte(byte(n))
+	case n >= math.MinInt8:
+		e.buf.WriteByte(0xd0)
+		e.buf.WriteByte(byte(n))
+	case n >= math.MinInt16:
+		e.buf.WriteByte(0xd1)
+		e.writeUint16(uint16(n))
+	case n >= math.MinInt32:
+		e.buf.WriteByte(0xd2)
+		e.writeUint32(uint32(n))
+	default:
+		e.buf.WriteByte(0xd3)
+		e.writeUint64(uint64(n))
+	}
+}
+
+func (e *encoder) encodeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(0xcc)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(0xcd)
+		e.writeUint16(uint16(n))
+	case n <= math.MaxUint32:
+		e.buf.WriteByte(0xce)
+		e.writeUint32(uint32(n))
+	default:
+		e.buf.WriteByte(0xcf)
+		e.writeUint64(n)
+	}
+}
+
+func (e *encoder) encodeString(s string) {
+	switch n := len(s); {
+	case n < 32:
+		e.buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(0xd9)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(0xda)
+		e.writeUint16(uint16(n))
+	default:
+		e.buf.WriteByte(0xdb)
+		e.writeUint32(uint32(n))
+	}
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) encodeBinary(b []byte) {
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(0xc4)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(0xc5)
+		e.writeUint16(uint16(n))
+	default:
+		e.buf.WriteByte(0xc6)
+		e.writeUint32(uint32(n))
+	}
+	e.buf.Write(b)
+}
+
+func (e *encoder) encodeArrayHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(0xdc)
+		e.writeUint16(uint16(n))
+	default:
+		e.buf.WriteByte(0xdd)
+		e.writeUint32(uint32(n))
+	}
+}
+
+func (e *encoder) encodeMapHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(0xde)
+		e.writeUint16(uint16(n))
+	default:
+		e.buf.WriteByte(0xdf)
+		e.writeUint32(uint32(n))
+	}
+}
+
+func (e *encoder) encodeArray(v reflect.Value) error {
+	e.encodeArrayHeader(v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) encodeMap(v reflect.Value) error {
+	type entry struct {
+		key   []byte
+		value reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		var k encoder
+		if err := k.encode(iter.Key()); err != nil {
+			return err
+		}
+		entries = append(entries, entry{
+			key:   k.buf.Bytes(),
+			value: iter.Value(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	e.encodeMapHeader(len(entries))
+	for _, entry := range entries {
+		e.buf.Write(entry.key)
+		if err := e.encode(entry.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) encodeStruct(v reflect.Value) error {
+	fields := structFields(v.Type())
+	n := 0
+	for _, f := range fields {
+		if !f.omitEmpty || !isEmptyValue(v.Field(f.index)) {
+			n++
+		}
+	}
+	e.encodeMapHeader(n)
+	for _, f := range fields {
+		fv := v.Field(f.index)
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		e.encodeString(f.name)
+		if err := e.encode(fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package keyvaluestoremsgpack
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map
+
+// structFields returns the exported fields of the struct type. Like encoding/json, fields can be
+// renamed or marked as omitempty with a tag, e.g. `msgpack:"name,omitempty"`, and skipped with
+// `msgpack:"-"`.
+func structFields(t reflect.Type) []field {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := sf.Tag.Get("msgpack")
+		if tag == "-" {
+			continue
+		}
+		f := field{
+			name:  sf.Name,
+			index: i,
+		}
+		parts := strings.Split(tag, ",")
+		if parts[0] != "" {
+			f.name = parts[0]
+		}
+		for _, option := range parts[1:] {
+			if option == "omitempty" {
+				f.omitEmpty = true
+			}
+		}
+		fields = append(fields, f)
+	}
+
+	fieldCache.Store(t, fields)
+	return fields
+}
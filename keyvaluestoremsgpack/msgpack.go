@@ -0,0 +1,37 @@
+// Package keyvaluestoremsgpack encodes values as MessagePack, which is more compact than JSON and
+// supports binary data.
+//
+// Values can be written by wrapping them with Value, which can be passed anywhere a backend accepts
+// a value, or via keyvaluestore.SetSerialized with Serializer:
+//
+//	backend.Set("user", keyvaluestoremsgpack.Value(user))
+//	keyvaluestore.GetSerialized(backend, keyvaluestoremsgpack.Serializer, "user", &user)
+//
+// Structs are encoded as maps keyed by field name. Like encoding/json, fields can be renamed or
+// omitted when empty via tags, e.g. `msgpack:"name,omitempty"`. Types that implement
+// encoding.BinaryMarshaler, such as time.Time, are encoded as binary.
+package keyvaluestoremsgpack
+
+import (
+	"encoding"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+type serializer struct{}
+
+func (serializer) Marshal(v interface{}) ([]byte, error) {
+	return Marshal(v)
+}
+
+func (serializer) Unmarshal(data []byte, v interface{}) error {
+	return Unmarshal(data, v)
+}
+
+// Serializer encodes values as MessagePack.
+var Serializer keyvaluestore.Serializer = serializer{}
+
+// Value returns a value that's encoded as MessagePack when it's written.
+func Value(v interface{}) encoding.BinaryMarshaler {
+	return keyvaluestore.Serialized(Serializer, v)
+}
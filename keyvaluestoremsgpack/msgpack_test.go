@@ -0,0 +1,139 @@
+package keyvaluestoremsgpack
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestMarshal(t *testing.T) {
+	for name, tc := range map[string]struct {
+		Value    interface{}
+		Expected []byte
+	}{
+		"Nil":              {nil, []byte{0xc0}},
+		"True":             {true, []byte{0xc3}},
+		"PositiveFixint":   {7, []byte{0x07}},
+		"NegativeFixint":   {-1, []byte{0xff}},
+		"Uint8":            {200, []byte{0xcc, 0xc8}},
+		"Uint16":           {1000, []byte{0xcd, 0x03, 0xe8}},
+		"Int8":             {-100, []byte{0xd0, 0x9c}},
+		"Int32":            {-100000, []byte{0xd2, 0xff, 0xfe, 0x79, 0x60}},
+		"Uint64":           {uint64(math.MaxUint64), []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		"Float64":          {1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		"Fixstr":           {"foo", []byte{0xa3, 'f', 'o', 'o'}},
+		"Bin":              {[]byte{1, 2}, []byte{0xc4, 0x02, 0x01, 0x02}},
+		"Fixarray":         {[]int{1, 2}, []byte{0x92, 0x01, 0x02}},
+		"FixmapSortedKeys": {map[string]int{"b": 2, "a": 1}, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			b, err := Marshal(tc.Value)
+			require.NoError(t, err)
+			assert.Equal(t, tc.Expected, b)
+		})
+	}
+
+	_, err := Marshal(func() {})
+	assert.Error(t, err)
+}
+
+func TestRoundTrip(t *testing.T) {
+	type inner struct {
+		Values []float64
+	}
+	type object struct {
+		Name     string `msgpack:"name"`
+		Count    int
+		Skipped  string `msgpack:"-"`
+		Empty    string `msgpack:",omitempty"`
+		Data     []byte
+		Inner    *inner
+		Tags     map[string]string
+		Time     time.Time
+		Any      interface{}
+		Array    [2]uint8
+		Long     string
+		private  int
+		Negative int64
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	in := object{
+		Name:     "foo",
+		Count:    1 << 20,
+		Skipped:  "skipped",
+		Data:     []byte{0, 1, 2},
+		Inner:    &inner{Values: []float64{1.5, -2}},
+		Tags:     map[string]string{"a": "b"},
+		Time:     now,
+		Any:      []interface{}{"x", int64(1)},
+		Array:    [2]uint8{3, 4},
+		Long:     strings.Repeat("x", 70000),
+		private:  1,
+		Negative: math.MinInt64,
+	}
+	b, err := Marshal(in)
+	require.NoError(t, err)
+
+	var out object
+	require.NoError(t, Unmarshal(b, &out))
+	expected := in
+	expected.Skipped = ""
+	expected.private = 0
+	assert.Equal(t, expected, out)
+
+	var generic interface{}
+	require.NoError(t, Unmarshal(b, &generic))
+	m := generic.(map[string]interface{})
+	assert.Equal(t, "foo", m["name"])
+	assert.Equal(t, int64(1<<20), m["Count"])
+	assert.Equal(t, map[string]interface{}{"Values": []interface{}{1.5, -2.0}}, m["Inner"])
+	assert.NotContains(t, m, "Skipped")
+	assert.NotContains(t, m, "Empty")
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	var s string
+	assert.Error(t, Unmarshal([]byte{0x01}, &s))
+	assert.Error(t, Unmarshal([]byte{0xa3, 'f'}, &s))
+	assert.Error(t, Unmarshal([]byte{0xa1, 'f', 'f'}, &s))
+	assert.Error(t, Unmarshal([]byte{0xa1, 'f'}, s))
+
+	var n int8
+	assert.Error(t, Unmarshal([]byte{0xcc, 0xc8}, &n))
+
+	var u uint
+	assert.Error(t, Unmarshal([]byte{0xff}, &u))
+
+	// Huge lengths are rejected without allocating.
+	var a []interface{}
+	assert.Error(t, Unmarshal([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, &a))
+}
+
+func TestSerializer(t *testing.T) {
+	b := memorystore.NewBackend()
+
+	type object struct {
+		Name string
+	}
+	require.NoError(t, b.Set("foo", Value(object{Name: "foo"})))
+
+	var v object
+	ok, err := keyvaluestore.GetSerialized(b, Serializer, "foo", &v)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "foo", v.Name)
+
+	// Equal maps produce equal bytes, so they can be used as conditionals.
+	require.NoError(t, b.Set("map", Value(map[string]int{"a": 1, "b": 2, "c": 3})))
+	ok, err = b.SetEQ("map", "bar", Value(map[string]int{"c": 3, "b": 2, "a": 1}))
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
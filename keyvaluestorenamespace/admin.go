@@ -0,0 +1,259 @@
+package keyvaluestorenamespace
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// DefaultRegistryKey is the key of the hash in which Admin records namespaces if no other key is
+// given.
+const DefaultRegistryKey = "_namespaces"
+
+var (
+	// ErrNamespaceExists is returned when creating a namespace that already exists.
+	ErrNamespaceExists = errors.New("namespace already exists")
+
+	// ErrNamespaceNotFound is returned when operating on a namespace, or the parent of a new
+	// namespace, that doesn't exist.
+	ErrNamespaceNotFound = errors.New("namespace not found")
+)
+
+// Admin manages hierarchical namespaces, such as one per tenant with one per feature beneath it.
+// Namespaces are identified by paths like keyvaluestore.Key{"tenants", "acme"} and are recorded
+// in a hash so that operators can list them.
+//
+// A namespace's keys are stored beneath its path's encoding followed by two separators, e.g.
+// "tenants:acme::", and its children's keys are stored beneath "tenants:acme:child::". So the
+// namespace and all of its descendants share the prefix "tenants:acme:", which lets Drop delete
+// them all at once without keys of the namespace ever colliding with keys of its children.
+//
+// Drop and Stats scan the backend, so it must implement keyvaluestore.Scanner.
+type Admin struct {
+	Backend keyvaluestore.Backend
+
+	// The key of the hash in which namespaces are recorded. It must not begin with a namespace's
+	// prefix. Defaults to DefaultRegistryKey.
+	RegistryKey string
+
+	// The number of entries requested from the backend at a time when scanning. Defaults to
+	// DefaultPageSize.
+	PageSize int
+
+	// Clock is used to record the time at which namespaces are created. If nil, the wall clock is
+	// used.
+	Clock keyvaluestore.Clock
+}
+
+// Namespace describes a namespace created via Admin.
+type Namespace struct {
+	Path keyvaluestore.Key
+
+	// Prefix is the prefix of the namespace's keys within the underlying backend.
+	Prefix string
+
+	Created time.Time
+
+	// Backend confines operations to the namespace.
+	Backend keyvaluestore.Backend
+}
+
+// Stats describes the contents of a namespace and its descendants.
+type Stats struct {
+	Keys int
+
+	// Types is the number of keys of each type.
+	Types map[keyvaluestore.EntryType]int
+
+	// Bytes is the approximate size of the keys and their contents, as stored in the underlying
+	// backend.
+	Bytes int64
+}
+
+func (a *Admin) registryKey() string {
+	if a.RegistryKey != "" {
+		return a.RegistryKey
+	}
+	return DefaultRegistryKey
+}
+
+// treePrefix returns the prefix shared by the keys of the namespace and its descendants.
+func treePrefix(path keyvaluestore.Key) string {
+	return path.String() + keyvaluestore.KeySeparator
+}
+
+func validatePath(path keyvaluestore.Key) error {
+	if len(path) == 0 {
+		return fmt.Errorf("namespace paths must have at least one component")
+	}
+	for _, component := range path {
+		if component == "" {
+			return fmt.Errorf("namespace path components must not be empty: %q", []string(path))
+		}
+	}
+	return nil
+}
+
+func (a *Admin) namespace(path keyvaluestore.Key, created time.Time) *Namespace {
+	prefix := treePrefix(path) + keyvaluestore.KeySeparator
+	return &Namespace{
+		Path:    path,
+		Prefix:  prefix,
+		Created: created,
+		Backend: &Backend{
+			Backend: a.Backend,
+			Prefix:  prefix,
+		},
+	}
+}
+
+func (a *Admin) parseNamespace(field, value string) (*Namespace, error) {
+	path, err := keyvaluestore.ParseKey(field)
+	if err != nil {
+		return nil, err
+	}
+	created, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid creation time for namespace %q: %w", field, err)
+	}
+	return a.namespace(path, created), nil
+}
+
+// Create records a new namespace and returns it. If the path has more than one component, its
+// parent must already exist.
+func (a *Admin) Create(path ...string) (*Namespace, error) {
+	if err := validatePath(path); err != nil {
+		return nil, err
+	}
+	if len(path) > 1 {
+		if parent, err := a.Get(path[:len(path)-1]...); err != nil {
+			return nil, err
+		} else if parent == nil {
+			return nil, fmt.Errorf("unable to create namespace %q: parent %w", path, ErrNamespaceNotFound)
+		}
+	}
+
+	created := keyvaluestore.Now(a.Clock).UTC()
+	tx := a.Backend.AtomicWrite()
+	tx.HSetNX(a.registryKey(), keyvaluestore.Key(path).String(), created.Format(time.RFC3339Nano))
+	if ok, err := tx.Exec(); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("unable to create namespace %q: %w", path, ErrNamespaceExists)
+	}
+	return a.namespace(path, created), nil
+}
+
+// Get returns the namespace with the given path, or nil if it doesn't exist.
+func (a *Admin) Get(path ...string) (*Namespace, error) {
+	if err := validatePath(path); err != nil {
+		return nil, err
+	}
+	field := keyvaluestore.Key(path).String()
+	v, err := a.Backend.HGet(a.registryKey(), field)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return a.parseNamespace(field, *v)
+}
+
+// List returns the descendants of the namespace with the given path, sorted by path. If no path
+// is given, every namespace is returned.
+func (a *Admin) List(path ...string) ([]*Namespace, error) {
+	fields, err := a.Backend.HGetAll(a.registryKey())
+	if err != nil {
+		return nil, err
+	}
+	prefix := ""
+	if len(path) > 0 {
+		prefix = treePrefix(path)
+	}
+	var ret []*Namespace
+	for field, value := range fields {
+		if !strings.HasPrefix(field, prefix) {
+			continue
+		}
+		ns, err := a.parseNamespace(field, value)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, ns)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Path.String() < ret[j].Path.String()
+	})
+	return ret, nil
+}
+
+// Drop deletes the namespace and its descendants, including all of their keys. If progress is
+// given, it's invoked periodically with the number of keys deleted so far.
+//
+// The namespaces are only removed from the registry once their keys are deleted, so if Drop fails,
+// it can be retried. Keys written to the namespaces while they're being dropped may or may not be
+// deleted, so writers should be stopped first. The number of keys deleted is returned, even if an
+// error occurs.
+func (a *Admin) Drop(path []string, progress func(deleted int)) (int, error) {
+	if ns, err := a.Get(path...); err != nil {
+		return 0, err
+	} else if ns == nil {
+		return 0, fmt.Errorf("unable to drop namespace %q: %w", path, ErrNamespaceNotFound)
+	}
+
+	deleted, err := DeletePrefix(a.Backend, treePrefix(path), a.PageSize, progress)
+	if err != nil {
+		return deleted, err
+	}
+
+	descendants, err := a.List(path...)
+	if err != nil {
+		return deleted, err
+	}
+	fields := make([]string, len(descendants))
+	for i, ns := range descendants {
+		fields[i] = ns.Path.String()
+	}
+	return deleted, a.Backend.HDel(a.registryKey(), keyvaluestore.Key(path).String(), fields...)
+}
+
+// Stats scans the namespace and its descendants and summarizes their contents.
+func (a *Admin) Stats(path ...string) (*Stats, error) {
+	if err := validatePath(path); err != nil {
+		return nil, err
+	}
+	stats := &Stats{
+		Types: map[keyvaluestore.EntryType]int{},
+	}
+	if err := ScanPrefix(a.Backend, treePrefix(path), a.PageSize, func(entries []*keyvaluestore.Entry) error {
+		for _, entry := range entries {
+			stats.Keys++
+			stats.Types[entry.Type]++
+			stats.Bytes += int64(entrySize(entry))
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// entrySize approximates the size of an entry. Scores are counted as 8-byte floats.
+func entrySize(entry *keyvaluestore.Entry) int {
+	n := len(entry.Key) + len(entry.Value)
+	for _, member := range entry.Members {
+		n += len(member)
+	}
+	for field, value := range entry.Fields {
+		n += len(field) + len(value)
+	}
+	for _, member := range entry.SortedSetMembers {
+		n += len(member.Value) + 8
+		if member.Field != member.Value {
+			n += len(member.Field)
+		}
+	}
+	return n
+}
@@ -0,0 +1,126 @@
+package keyvaluestorenamespace_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorenamespace"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func paths(namespaces []*keyvaluestorenamespace.Namespace) []string {
+	ret := make([]string, len(namespaces))
+	for i, ns := range namespaces {
+		ret[i] = ns.Path.String()
+	}
+	return ret
+}
+
+func TestAdmin(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	admin := &keyvaluestorenamespace.Admin{
+		Backend:  underlying,
+		PageSize: 2,
+	}
+
+	acme, err := admin.Create("tenants", "acme")
+	assert.True(t, errors.Is(err, keyvaluestorenamespace.ErrNamespaceNotFound))
+	assert.Nil(t, acme)
+
+	_, err = admin.Create("tenants")
+	require.NoError(t, err)
+	acme, err = admin.Create("tenants", "acme")
+	require.NoError(t, err)
+	assert.Equal(t, "tenants:acme::", acme.Prefix)
+	billing, err := admin.Create("tenants", "acme", "billing")
+	require.NoError(t, err)
+	other, err := admin.Create("tenants", "acmecorp")
+	require.NoError(t, err)
+
+	_, err = admin.Create("tenants", "acme")
+	assert.True(t, errors.Is(err, keyvaluestorenamespace.ErrNamespaceExists))
+
+	_, err = admin.Create("tenants", "")
+	assert.Error(t, err)
+
+	ns, err := admin.Get("tenants", "acme")
+	require.NoError(t, err)
+	require.NotNil(t, ns)
+	assert.Equal(t, acme.Created, ns.Created)
+	ns, err = admin.Get("tenants", "missing")
+	require.NoError(t, err)
+	assert.Nil(t, ns)
+
+	all, err := admin.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tenants", "tenants:acme", "tenants:acme:billing", "tenants:acmecorp"}, paths(all))
+	children, err := admin.List("tenants", "acme")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tenants:acme:billing"}, paths(children))
+
+	// Keys of a namespace never collide with keys of its children.
+	require.NoError(t, acme.Backend.Set("billing::foo", "acme"))
+	require.NoError(t, billing.Backend.Set("foo", "billing"))
+	v, err := acme.Backend.Get("billing::foo")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", *v)
+
+	require.NoError(t, acme.Backend.SAdd("set", "a", "b"))
+	require.NoError(t, acme.Backend.HSet("hash", "f", "v"))
+	require.NoError(t, other.Backend.Set("foo", "other"))
+
+	stats, err := admin.Stats("tenants", "acme")
+	require.NoError(t, err)
+	assert.Equal(t, 4, stats.Keys)
+	assert.Equal(t, map[keyvaluestore.EntryType]int{
+		keyvaluestore.EntryTypeString: 2,
+		keyvaluestore.EntryTypeSet:    1,
+		keyvaluestore.EntryTypeHash:   1,
+	}, stats.Types)
+	assert.True(t, stats.Bytes > 0)
+
+	var progress []int
+	deleted, err := admin.Drop([]string{"tenants", "acme"}, func(deleted int) {
+		progress = append(progress, deleted)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, deleted)
+	require.NotEmpty(t, progress)
+	assert.Equal(t, 4, progress[len(progress)-1])
+
+	all, err = admin.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tenants", "tenants:acmecorp"}, paths(all))
+
+	v, err = billing.Backend.Get("foo")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+	v, err = other.Backend.Get("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "other", *v)
+
+	_, err = admin.Drop([]string{"tenants", "acme"}, nil)
+	assert.True(t, errors.Is(err, keyvaluestorenamespace.ErrNamespaceNotFound))
+}
+
+func TestDeletePrefix(t *testing.T) {
+	b := memorystore.NewBackend()
+	for _, key := range []string{"a:1", "a:2", "a:3", "b:1"} {
+		require.NoError(t, b.Set(key, "x"))
+	}
+
+	deleted, err := keyvaluestorenamespace.DeletePrefix(b, "a:", 1, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+
+	exists, err := keyvaluestore.ExistsMulti(b, "a:1", "b:1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a:1": false, "b:1": true}, exists)
+
+	_, err = keyvaluestorenamespace.DeletePrefix(&keyvaluestorenamespace.Backend{Backend: b}, "a:", 0, nil)
+	assert.True(t, errors.Is(err, keyvaluestore.ErrNotSupported))
+}
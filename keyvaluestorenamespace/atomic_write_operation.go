@@ -0,0 +1,101 @@
+package keyvaluestorenamespace
+
+import "github.com/ccbrown/keyvaluestore"
+
+type atomicWriteOperation struct {
+	backend     *Backend
+	atomicWrite keyvaluestore.AtomicWriteOperation
+}
+
+func (op *atomicWriteOperation) Set(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.Set(op.backend.key(key), value)
+}
+
+func (op *atomicWriteOperation) SetNX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.SetNX(op.backend.key(key), value)
+}
+
+func (op *atomicWriteOperation) SetXX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.SetXX(op.backend.key(key), value)
+}
+
+func (op *atomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.SetEQ(op.backend.key(key), value, oldValue)
+}
+
+func (op *atomicWriteOperation) Delete(key string) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.Delete(op.backend.key(key))
+}
+
+func (op *atomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.DeleteXX(op.backend.key(key))
+}
+
+func (op *atomicWriteOperation) NIncrBy(key string, n int64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.NIncrBy(op.backend.key(key), n)
+}
+
+func (op *atomicWriteOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZAdd(op.backend.key(key), member, score)
+}
+
+func (op *atomicWriteOperation) ZAddNX(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZAddNX(op.backend.key(key), member, score)
+}
+
+func (op *atomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZHSetEQ(op.backend.key(key), field, member, oldMember, score)
+}
+
+func (op *atomicWriteOperation) ZRem(key string, member interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZRem(op.backend.key(key), member)
+}
+
+func (op *atomicWriteOperation) ZHAdd(key, field string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZHAdd(op.backend.key(key), field, member, score)
+}
+
+func (op *atomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZHMAdd(op.backend.key(key), entries)
+}
+
+func (op *atomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZHRem(op.backend.key(key), field)
+}
+
+func (op *atomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZHRemEQ(op.backend.key(key), field, member)
+}
+
+func (op *atomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.SAdd(op.backend.key(key), member, members...)
+}
+
+func (op *atomicWriteOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.SRem(op.backend.key(key), member, members...)
+}
+
+func (op *atomicWriteOperation) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.HSet(op.backend.key(key), field, value, fields...)
+}
+
+func (op *atomicWriteOperation) HSetNX(key, field string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.HSetNX(op.backend.key(key), field, value)
+}
+
+func (op *atomicWriteOperation) HDel(key, field string, fields ...string) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.HDel(op.backend.key(key), field, fields...)
+}
+
+func (op *atomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.atomicWrite.WithIdempotencyToken(token)
+	return op
+}
+
+func (op *atomicWriteOperation) Validate() error {
+	return op.atomicWrite.Validate()
+}
+
+func (op *atomicWriteOperation) Exec() (bool, error) {
+	return op.atomicWrite.Exec()
+}
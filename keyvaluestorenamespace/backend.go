@@ -0,0 +1,365 @@
+// Package keyvaluestorenamespace provides a backend wrapper that confines all operations to a key
+// prefix. This lets multiple applications, features, or tests share a single backend without
+// interfering with each other.
+package keyvaluestorenamespace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Backend prepends Prefix to the keys of all operations before passing them through to the
+// underlying backend.
+type Backend struct {
+	Backend keyvaluestore.Backend
+	Prefix  string
+
+	// If non-zero, keys that would be longer than MaxKeyLength bytes once prefixed are replaced by
+	// Prefix followed by "sha256:" and the hex-encoded SHA-256 hash of the key. This keeps long
+	// application keys within the limits of backends such as DynamoDB, whose limit is given by
+	// dynamodbstore.MaxKeySize.
+	//
+	// Keys that fit are passed through unchanged, except for keys that begin with "sha256:", which
+	// are always hashed so that they can't collide with hashed keys. Hashing can't be reversed, so
+	// the original keys of hashed entries can't be recovered from the underlying backend, e.g. when
+	// exporting it. Existing keys can be moved to their hashed keys via HashKeys.
+	MaxKeyLength int
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+
+// Middleware returns a middleware that confines operations to the given prefix.
+func Middleware(prefix string) keyvaluestore.Middleware {
+	return keyvaluestore.MiddlewareFunc(func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return &Backend{
+			Backend: b,
+			Prefix:  prefix,
+		}
+	})
+}
+
+// hashTag begins hashed keys. See MaxKeyLength.
+const hashTag = "sha256:"
+
+func (b *Backend) key(key string) string {
+	if b.needsHash(key) {
+		hash := sha256.Sum256([]byte(key))
+		return b.Prefix + hashTag + hex.EncodeToString(hash[:])
+	}
+	return b.Prefix + key
+}
+
+func (b *Backend) needsHash(key string) bool {
+	return b.MaxKeyLength > 0 && (len(b.Prefix)+len(key) > b.MaxKeyLength || strings.HasPrefix(key, hashTag))
+}
+
+// isHashed returns true if the unprefixed key is the result of hashing some other key.
+func isHashed(key string) bool {
+	if !strings.HasPrefix(key, hashTag) || len(key) != len(hashTag)+2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(key[len(hashTag):])
+	return err == nil
+}
+
+// HashKeys moves each key under Prefix that MaxKeyLength requires to be hashed, but which was
+// written to the underlying backend without hashing, to its hashed key. This is needed when
+// MaxKeyLength is enabled for a backend such as Redis that already accepted long keys. Keys that
+// already look like hashed keys are assumed to be hashed and are left alone.
+//
+// The underlying backend must implement keyvaluestore.Scanner and keyvaluestore.Renamer. Until
+// HashKeys completes, the keys it has yet to move aren't visible via the backend, so it should
+// be run before the application starts using MaxKeyLength. It returns the number of keys moved.
+func (b *Backend) HashKeys(pageSize int) (int, error) {
+	var keys []string
+	if err := ScanPrefix(b.Backend, b.Prefix, pageSize, func(entries []*keyvaluestore.Entry) error {
+		for _, entry := range entries {
+			if key := entry.Key[len(b.Prefix):]; b.needsHash(key) && !isHashed(key) {
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, key := range keys {
+		if ok, err := keyvaluestore.RenameCollection(b.Backend, b.Prefix+key, b.key(key)); err != nil {
+			return moved, err
+		} else if ok {
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return &atomicWriteOperation{
+		backend:     b,
+		atomicWrite: b.Backend.AtomicWrite(),
+	}
+}
+
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	return &batchOperation{
+		backend: b,
+		batch:   b.Backend.Batch(),
+	}
+}
+
+func (b *Backend) Ping() error {
+	return b.Backend.Ping()
+}
+
+// Close does nothing since the underlying backend is typically shared with other namespaces. It
+// should be closed directly instead.
+func (b *Backend) Close() error {
+	return nil
+}
+
+func (b *Backend) Delete(key string) (bool, error) {
+	return b.Backend.Delete(b.key(key))
+}
+
+func (b *Backend) Get(key string) (*string, error) {
+	return b.Backend.Get(b.key(key))
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	return b.Backend.Set(b.key(key), value)
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	return b.Backend.SetXX(b.key(key), value)
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	return b.Backend.SetNX(b.key(key), value)
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	return b.Backend.SetEQ(b.key(key), value, oldValue)
+}
+
+func (b *Backend) Update(key string, f func(prev *string) (*string, error)) error {
+	return keyvaluestore.Update(b.Backend, b.key(key), f)
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	return b.Backend.NIncrBy(b.key(key), n)
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	return b.Backend.SAdd(b.key(key), member, members...)
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	return b.Backend.SRem(b.key(key), member, members...)
+}
+
+func (b *Backend) SMembers(key string) ([]string, error) {
+	return b.Backend.SMembers(b.key(key))
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	return b.Backend.HSet(b.key(key), field, value, fields...)
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	return b.Backend.HDel(b.key(key), field, fields...)
+}
+
+func (b *Backend) HGet(key, field string) (*string, error) {
+	return b.Backend.HGet(b.key(key), field)
+}
+
+func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	return b.Backend.HGetAll(b.key(key))
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
+	return b.Backend.ZAdd(b.key(key), member, score)
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	return b.Backend.ZScore(b.key(key), member)
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	return b.Backend.ZRem(b.key(key), member)
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	return b.Backend.ZIncrBy(b.key(key), member, n)
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRangeByScore(b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRangeByScoreWithScores(b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByScore(b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRevRangeByScoreWithScores(b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	return b.Backend.ZCount(b.key(key), min, max)
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
+	return b.Backend.ZLexCount(b.key(key), min, max)
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRangeByLex(b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByLex(b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	return b.Backend.ZHAdd(b.key(key), field, member, score)
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	return b.Backend.ZHMAdd(b.key(key), entries)
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	return b.Backend.ZHRem(b.key(key), field)
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	return b.Backend.ZHRemEQ(b.key(key), field, member)
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZHRangeByScore(b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZHRangeByScoreWithScores(b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZHRevRangeByScore(b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZHRevRangeByScoreWithScores(b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZHRangeByLex(b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZHRevRangeByLex(b.key(key), min, max, limit)
+}
+
+var _ keyvaluestore.SortedHashFieldRanger = &Backend{}
+
+func (b *Backend) ZHRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRangeByScoreWithFields(b.Backend, b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRevRangeByScoreWithFields(b.Backend, b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZHRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRangeByLexWithFields(b.Backend, b.key(key), min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRevRangeByLexWithFields(b.Backend, b.key(key), min, max, limit)
+}
+
+var _ keyvaluestore.MultiExister = &Backend{}
+
+func (b *Backend) ExistsMulti(keys ...string) (map[string]bool, error) {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = b.key(key)
+	}
+	exists, err := keyvaluestore.ExistsMulti(b.Backend, prefixed...)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]bool, len(keys))
+	for i, key := range keys {
+		ret[key] = exists[prefixed[i]]
+	}
+	return ret, nil
+}
+
+var _ keyvaluestore.Renamer = &Backend{}
+
+func (b *Backend) RenameCollection(src, dst string) (bool, error) {
+	return keyvaluestore.RenameCollection(b.Backend, b.key(src), b.key(dst))
+}
+
+var _ keyvaluestore.ApproximateCounter = &Backend{}
+
+func (b *Backend) ZCountApprox(key string, min, max float64) (int, error) {
+	return keyvaluestore.ZCountApprox(b.Backend, b.key(key), min, max)
+}
+
+var _ keyvaluestore.PageTokenRanger = &Backend{}
+
+func (b *Backend) ZRangeByScoreAfter(key string, after keyvaluestore.PageToken, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return keyvaluestore.ZRangeByScoreAfter(b.Backend, b.key(key), after, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScoreAfter(key string, after keyvaluestore.PageToken, min float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return keyvaluestore.ZRevRangeByScoreAfter(b.Backend, b.key(key), after, min, limit)
+}
+
+func (b *Backend) ZHRangeByScoreWithFieldsAfter(key string, after keyvaluestore.PageToken, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRangeByScoreWithFieldsAfter(b.Backend, b.key(key), after, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithFieldsAfter(key string, after keyvaluestore.PageToken, min float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRevRangeByScoreWithFieldsAfter(b.Backend, b.key(key), after, min, limit)
+}
+
+var _ keyvaluestore.MultiSortedSetRanger = &Backend{}
+
+func (b *Backend) ZRangeByScoreMulti(keys []string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = b.key(key)
+	}
+	return keyvaluestore.ZRangeByScoreMulti(b.Backend, prefixed, min, max, limit)
+}
+
+func (b Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	b.Backend = b.Backend.WithProfiler(profiler)
+	return &b
+}
+
+func (b Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	b.Backend = b.Backend.WithEventuallyConsistentReads()
+	return &b
+}
+
+func (b Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	b.Backend = keyvaluestore.WithOptions(b.Backend, opts)
+	return &b
+}
+
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return b.Backend
+}
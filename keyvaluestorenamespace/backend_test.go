@@ -0,0 +1,173 @@
+package keyvaluestorenamespace_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorenamespace"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return &keyvaluestorenamespace.Backend{
+			Backend: memorystore.NewBackend(),
+			Prefix:  "ns:",
+		}
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return &keyvaluestorenamespace.Backend{
+			Backend: b,
+			Prefix:  "ns:",
+		}
+	}, keyvaluestoretest.WrapperOptions{
+		// The underlying backend is shared, so namespaces don't close it.
+		Unforwarded: []string{"Close"},
+	})
+}
+
+func TestBackendWithHashedKeys(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return &keyvaluestorenamespace.Backend{
+			Backend:      memorystore.NewBackend(),
+			Prefix:       "ns:",
+			MaxKeyLength: 5,
+		}
+	})
+}
+
+func TestMaxKeyLength(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	b := &keyvaluestorenamespace.Backend{
+		Backend:      underlying,
+		Prefix:       "ns:",
+		MaxKeyLength: 100,
+	}
+
+	short := strings.Repeat("x", 97)
+	long := strings.Repeat("x", 98)
+	require.NoError(t, b.Set(short, "short"))
+	require.NoError(t, b.Set(long, "long"))
+
+	v, err := b.Get(long)
+	require.NoError(t, err)
+	assert.Equal(t, "long", *v)
+
+	v, err = underlying.Get("ns:" + short)
+	require.NoError(t, err)
+	assert.Equal(t, "short", *v)
+
+	v, err = underlying.Get("ns:" + long)
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	hashed := "sha256:" + fmt.Sprintf("%x", sha256.Sum256([]byte(long)))
+	v, err = underlying.Get("ns:" + hashed)
+	require.NoError(t, err)
+	assert.Equal(t, "long", *v)
+
+	// Short keys that look like hashed keys are hashed too, so they can't collide.
+	require.NoError(t, b.Set(hashed, "collision"))
+	v, err = b.Get(long)
+	require.NoError(t, err)
+	assert.Equal(t, "long", *v)
+	v, err = b.Get(hashed)
+	require.NoError(t, err)
+	assert.Equal(t, "collision", *v)
+}
+
+func TestHashKeys(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	long := strings.Repeat("x", 98)
+	require.NoError(t, underlying.Set("ns:short", "short"))
+	require.NoError(t, underlying.Set("ns:"+long, "long"))
+	require.NoError(t, underlying.ZAdd("ns:"+long+"z", "member", 1))
+	require.NoError(t, underlying.Set("ns:sha256:foo", "tagged"))
+	require.NoError(t, underlying.Set("other:"+long, "other"))
+
+	b := &keyvaluestorenamespace.Backend{
+		Backend:      underlying,
+		Prefix:       "ns:",
+		MaxKeyLength: 100,
+	}
+	n, err := b.HashKeys(0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	for key, expected := range map[string]string{
+		"short":      "short",
+		long:         "long",
+		"sha256:foo": "tagged",
+	} {
+		v, err := b.Get(key)
+		require.NoError(t, err)
+		require.NotNil(t, v, key)
+		assert.Equal(t, expected, *v)
+	}
+	members, err := b.ZRangeByScore(long+"z", 0, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"member"}, members)
+
+	v, err := underlying.Get("ns:" + long)
+	require.NoError(t, err)
+	assert.Nil(t, v)
+	v, err = underlying.Get("other:" + long)
+	require.NoError(t, err)
+	assert.Equal(t, "other", *v)
+
+	// The hashed keys are recognized, so running it again does nothing.
+	n, err = b.HashKeys(0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestIsolation(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	a := &keyvaluestorenamespace.Backend{
+		Backend: underlying,
+		Prefix:  "a:",
+	}
+	b := &keyvaluestorenamespace.Backend{
+		Backend: underlying,
+		Prefix:  "b:",
+	}
+
+	require.NoError(t, a.Set("foo", "a"))
+	require.NoError(t, b.Set("foo", "b"))
+
+	batch := a.Batch()
+	batch.ZAdd("z", "a", 1)
+	require.NoError(t, batch.Exec())
+
+	tx := b.AtomicWrite()
+	tx.SetNX("foo", "x")
+	ok, err := tx.Exec()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	v, err := a.Get("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "a", *v)
+
+	v, err = underlying.Get("b:foo")
+	require.NoError(t, err)
+	assert.Equal(t, "b", *v)
+
+	n, err := b.ZCount("z", 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = underlying.ZCount("a:z", 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
@@ -0,0 +1,72 @@
+package keyvaluestorenamespace
+
+import "github.com/ccbrown/keyvaluestore"
+
+type batchOperation struct {
+	backend *Backend
+	batch   keyvaluestore.BatchOperation
+}
+
+func (op *batchOperation) Get(key string) keyvaluestore.GetResult {
+	return op.batch.Get(op.backend.key(key))
+}
+
+func (op *batchOperation) Delete(key string) keyvaluestore.ErrorResult {
+	return op.batch.Delete(op.backend.key(key))
+}
+
+func (op *batchOperation) Set(key string, value interface{}) keyvaluestore.ErrorResult {
+	return op.batch.Set(op.backend.key(key), value)
+}
+
+func (op *batchOperation) SMembers(key string) keyvaluestore.SMembersResult {
+	return op.batch.SMembers(op.backend.key(key))
+}
+
+func (op *batchOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	return op.batch.SAdd(op.backend.key(key), member, members...)
+}
+
+func (op *batchOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	return op.batch.SRem(op.backend.key(key), member, members...)
+}
+
+func (op *batchOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.ErrorResult {
+	return op.batch.ZAdd(op.backend.key(key), member, score)
+}
+
+func (op *batchOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.ErrorResult {
+	return op.batch.ZHMAdd(op.backend.key(key), entries)
+}
+
+func (op *batchOperation) ZRem(key string, member interface{}) keyvaluestore.ErrorResult {
+	return op.batch.ZRem(op.backend.key(key), member)
+}
+
+func (op *batchOperation) ZScore(key string, member interface{}) keyvaluestore.ZScoreResult {
+	return op.batch.ZScore(op.backend.key(key), member)
+}
+
+func (op *batchOperation) ZHRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRangeByScore(op.backend.key(key), min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRevRangeByScore(op.backend.key(key), min, max, limit)
+}
+
+func (op *batchOperation) ZHRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRangeByLex(op.backend.key(key), min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRevRangeByLex(op.backend.key(key), min, max, limit)
+}
+
+func (op *batchOperation) Len() int {
+	return op.batch.Len()
+}
+
+func (op *batchOperation) Exec() error {
+	return op.batch.Exec()
+}
@@ -0,0 +1,80 @@
+package keyvaluestorenamespace
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// DefaultPageSize is the number of entries requested from the backend at a time by ScanPrefix and
+// DeletePrefix if no page size is given.
+const DefaultPageSize = 1000
+
+// ScanPrefix invokes f with each page of entries whose keys begin with the given prefix. The
+// backend must implement keyvaluestore.Scanner. Scanners can't filter by prefix, so the entire
+// backend is scanned, and the time it takes depends on the size of the backend rather than the
+// number of matching keys. If f returns an error, the scan is aborted.
+func ScanPrefix(b keyvaluestore.Backend, prefix string, pageSize int, f func(entries []*keyvaluestore.Entry) error) error {
+	scanner, ok := b.(keyvaluestore.Scanner)
+	if !ok {
+		return fmt.Errorf("backend does not support scanning: %T: %w", b, keyvaluestore.ErrNotSupported)
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	cursor := ""
+	for {
+		entries, next, err := scanner.Scan(cursor, pageSize)
+		if err != nil {
+			return err
+		}
+		var matches []*keyvaluestore.Entry
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Key, prefix) {
+				matches = append(matches, entry)
+			}
+		}
+		if len(matches) > 0 {
+			if err := f(matches); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// DeletePrefix deletes every key that begins with the given prefix, as found by ScanPrefix. Each
+// page of keys is deleted in a single batch. If progress is given, it's invoked after each batch
+// with the total number of keys deleted so far.
+//
+// The number of keys deleted is returned, even if an error occurs. Keys written during the
+// deletion may or may not be deleted.
+func DeletePrefix(b keyvaluestore.Backend, prefix string, pageSize int, progress func(deleted int)) (int, error) {
+	deleted := 0
+	err := ScanPrefix(b, prefix, pageSize, func(entries []*keyvaluestore.Entry) error {
+		batch := b.Batch()
+		results := make([]keyvaluestore.ErrorResult, len(entries))
+		for i, entry := range entries {
+			results[i] = batch.Delete(entry.Key)
+		}
+		if err := batch.Exec(); err != nil {
+			return err
+		}
+		for _, result := range results {
+			if err := result.Result(); err != nil {
+				return err
+			}
+			deleted++
+		}
+		if progress != nil {
+			progress(deleted)
+		}
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,145 @@
+package keyvaluestoreoplog
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+type atomicWriteOperation struct {
+	backend     *Backend
+	atomicWrite keyvaluestore.AtomicWriteOperation
+	entry       Entry
+}
+
+func (op *atomicWriteOperation) add(method string, args ...interface{}) {
+	op.entry.Operations = append(op.entry.Operations, &Entry{
+		Method: method,
+		Args:   formatArgs(args...),
+	})
+}
+
+func (op *atomicWriteOperation) Set(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	op.add("Set", key, value)
+	return op.atomicWrite.Set(key, value)
+}
+
+func (op *atomicWriteOperation) SetNX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	op.add("SetNX", key, value)
+	return op.atomicWrite.SetNX(key, value)
+}
+
+func (op *atomicWriteOperation) SetXX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	op.add("SetXX", key, value)
+	return op.atomicWrite.SetXX(key, value)
+}
+
+func (op *atomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
+	op.add("SetEQ", key, value, oldValue)
+	return op.atomicWrite.SetEQ(key, value, oldValue)
+}
+
+func (op *atomicWriteOperation) Delete(key string) keyvaluestore.AtomicWriteResult {
+	op.add("Delete", key)
+	return op.atomicWrite.Delete(key)
+}
+
+func (op *atomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteResult {
+	op.add("DeleteXX", key)
+	return op.atomicWrite.DeleteXX(key)
+}
+
+func (op *atomicWriteOperation) NIncrBy(key string, n int64) keyvaluestore.AtomicWriteResult {
+	op.add("NIncrBy", key, n)
+	return op.atomicWrite.NIncrBy(key, n)
+}
+
+func (op *atomicWriteOperation) ZAdd(key string, member interface{}, s float64) keyvaluestore.AtomicWriteResult {
+	op.add("ZAdd", key, member, score(s))
+	return op.atomicWrite.ZAdd(key, member, s)
+}
+
+func (op *atomicWriteOperation) ZAddNX(key string, member interface{}, s float64) keyvaluestore.AtomicWriteResult {
+	op.add("ZAddNX", key, member, score(s))
+	return op.atomicWrite.ZAddNX(key, member, s)
+}
+
+func (op *atomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, s float64) keyvaluestore.AtomicWriteResult {
+	op.add("ZHSetEQ", key, field, member, oldMember, score(s))
+	return op.atomicWrite.ZHSetEQ(key, field, member, oldMember, s)
+}
+
+func (op *atomicWriteOperation) ZRem(key string, member interface{}) keyvaluestore.AtomicWriteResult {
+	op.add("ZRem", key, member)
+	return op.atomicWrite.ZRem(key, member)
+}
+
+func (op *atomicWriteOperation) ZHAdd(key, field string, member interface{}, s float64) keyvaluestore.AtomicWriteResult {
+	op.add("ZHAdd", key, field, member, score(s))
+	return op.atomicWrite.ZHAdd(key, field, member, s)
+}
+
+func (op *atomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	if len(entries) > 0 {
+		op.add("ZHMAdd", key, entries)
+	}
+	return op.atomicWrite.ZHMAdd(key, entries)
+}
+
+func (op *atomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWriteResult {
+	op.add("ZHRem", key, field)
+	return op.atomicWrite.ZHRem(key, field)
+}
+
+func (op *atomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	op.add("ZHRemEQ", key, field, member)
+	return op.atomicWrite.ZHRemEQ(key, field, member)
+}
+
+func (op *atomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	op.add("SAdd", key, member, members)
+	return op.atomicWrite.SAdd(key, member, members...)
+}
+
+func (op *atomicWriteOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	op.add("SRem", key, member, members)
+	return op.atomicWrite.SRem(key, member, members...)
+}
+
+func (op *atomicWriteOperation) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) keyvaluestore.AtomicWriteResult {
+	op.add("HSet", key, field, value, fields)
+	return op.atomicWrite.HSet(key, field, value, fields...)
+}
+
+func (op *atomicWriteOperation) HSetNX(key, field string, value interface{}) keyvaluestore.AtomicWriteResult {
+	op.add("HSetNX", key, field, value)
+	return op.atomicWrite.HSetNX(key, field, value)
+}
+
+func (op *atomicWriteOperation) HDel(key, field string, fields ...string) keyvaluestore.AtomicWriteResult {
+	op.add("HDel", key, field, fields)
+	return op.atomicWrite.HDel(key, field, fields...)
+}
+
+func (op *atomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.entry.Args = []string{token}
+	op.atomicWrite.WithIdempotencyToken(token)
+	return op
+}
+
+func (op *atomicWriteOperation) Validate() error {
+	return op.atomicWrite.Validate()
+}
+
+// Exec logs the atomic write as a single entry. Writes that are structurally invalid aren't logged
+// since they can't be performed.
+func (op *atomicWriteOperation) Exec() (bool, error) {
+	if len(op.entry.Operations) > 0 {
+		if err := op.atomicWrite.Validate(); err != nil {
+			return false, err
+		}
+		op.entry.Method = "AtomicWrite"
+		if err := op.backend.append(&op.entry); err != nil {
+			return false, err
+		}
+	}
+	return op.atomicWrite.Exec()
+}
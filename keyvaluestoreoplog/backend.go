@@ -0,0 +1,314 @@
+package keyvaluestoreoplog
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Backend appends each write to Sink before passing it through to the underlying backend. If the
+// entry can't be appended, the write isn't performed and the sink's error is returned. Reads aren't
+// logged.
+//
+// Entries are appended in the order in which writes begin, so concurrent writes to the same key
+// may be logged in a different order than the backend applies them. Applications that replicate
+// such keys via the log should serialize their writes. Expirations aren't logged, and updates are
+// logged as the SetNX or SetEQ operations that they're made of.
+type Backend struct {
+	Backend keyvaluestore.Backend
+	Sink    Sink
+
+	// Clock is used to timestamp entries. If nil, the wall clock is used.
+	Clock keyvaluestore.Clock
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+
+// score marks an argument as a score so that it's formatted without loss of precision. Values are
+// formatted the same way backends format them.
+type score float64
+
+// formatArgs converts arguments to strings. Variadic arguments are flattened.
+func formatArgs(args ...interface{}) []string {
+	var ret []string
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case score:
+			ret = append(ret, strconv.FormatFloat(float64(arg), 'g', -1, 64))
+		case []string:
+			ret = append(ret, arg...)
+		case []interface{}:
+			ret = append(ret, formatArgs(arg...)...)
+		case []keyvaluestore.KeyValue:
+			for _, kv := range arg {
+				ret = append(ret, formatArgs(kv.Key, kv.Value)...)
+			}
+		case []keyvaluestore.ZHEntry:
+			for _, e := range arg {
+				ret = append(ret, formatArgs(e.Field, e.Member, score(e.Score))...)
+			}
+		default:
+			if s := keyvaluestore.ToString(arg); s != nil {
+				ret = append(ret, *s)
+			} else {
+				ret = append(ret, fmt.Sprint(arg))
+			}
+		}
+	}
+	return ret
+}
+
+func (b *Backend) append(entry *Entry) error {
+	entry.Time = keyvaluestore.Now(b.Clock)
+	if err := b.Sink.Append(entry); err != nil {
+		return fmt.Errorf("unable to append to operation log: %w", err)
+	}
+	return nil
+}
+
+func (b *Backend) log(method string, args ...interface{}) error {
+	return b.append(&Entry{
+		Method: method,
+		Args:   formatArgs(args...),
+	})
+}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return &atomicWriteOperation{
+		backend:     b,
+		atomicWrite: b.Backend.AtomicWrite(),
+	}
+}
+
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	return &batchOperation{
+		backend: b,
+		batch:   b.Backend.Batch(),
+	}
+}
+
+func (b *Backend) Ping() error {
+	return b.Backend.Ping()
+}
+
+func (b *Backend) Close() error {
+	return b.Backend.Close()
+}
+
+func (b *Backend) Delete(key string) (bool, error) {
+	if err := b.log("Delete", key); err != nil {
+		return false, err
+	}
+	return b.Backend.Delete(key)
+}
+
+func (b *Backend) Get(key string) (*string, error) {
+	return b.Backend.Get(key)
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	if err := b.log("Set", key, value); err != nil {
+		return err
+	}
+	return b.Backend.Set(key, value)
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	if err := b.log("SetXX", key, value); err != nil {
+		return false, err
+	}
+	return b.Backend.SetXX(key, value)
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	if err := b.log("SetNX", key, value); err != nil {
+		return false, err
+	}
+	return b.Backend.SetNX(key, value)
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	if err := b.log("SetEQ", key, value, oldValue); err != nil {
+		return false, err
+	}
+	return b.Backend.SetEQ(key, value, oldValue)
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	if err := b.log("NIncrBy", key, n); err != nil {
+		return 0, err
+	}
+	return b.Backend.NIncrBy(key, n)
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	if err := b.log("SAdd", key, member, members); err != nil {
+		return err
+	}
+	return b.Backend.SAdd(key, member, members...)
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	if err := b.log("SRem", key, member, members); err != nil {
+		return err
+	}
+	return b.Backend.SRem(key, member, members...)
+}
+
+func (b *Backend) SMembers(key string) ([]string, error) {
+	return b.Backend.SMembers(key)
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	if err := b.log("HSet", key, field, value, fields); err != nil {
+		return err
+	}
+	return b.Backend.HSet(key, field, value, fields...)
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	if err := b.log("HDel", key, field, fields); err != nil {
+		return err
+	}
+	return b.Backend.HDel(key, field, fields...)
+}
+
+func (b *Backend) HGet(key, field string) (*string, error) {
+	return b.Backend.HGet(key, field)
+}
+
+func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	return b.Backend.HGetAll(key)
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, s float64) error {
+	if err := b.log("ZAdd", key, member, score(s)); err != nil {
+		return err
+	}
+	return b.Backend.ZAdd(key, member, s)
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	return b.Backend.ZScore(key, member)
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	if err := b.log("ZRem", key, member); err != nil {
+		return err
+	}
+	return b.Backend.ZRem(key, member)
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	if err := b.log("ZIncrBy", key, member, score(n)); err != nil {
+		return 0, err
+	}
+	return b.Backend.ZIncrBy(key, member, n)
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	return b.Backend.ZCount(key, min, max)
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
+	return b.Backend.ZLexCount(key, min, max)
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, s float64) error {
+	if err := b.log("ZHAdd", key, field, member, score(s)); err != nil {
+		return err
+	}
+	return b.Backend.ZHAdd(key, field, member, s)
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	if len(entries) == 0 {
+		return b.Backend.ZHMAdd(key, entries)
+	}
+	if err := b.log("ZHMAdd", key, entries); err != nil {
+		return err
+	}
+	return b.Backend.ZHMAdd(key, entries)
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	if err := b.log("ZHRem", key, field); err != nil {
+		return err
+	}
+	return b.Backend.ZHRem(key, field)
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	if err := b.log("ZHRemEQ", key, field, member); err != nil {
+		return false, err
+	}
+	return b.Backend.ZHRemEQ(key, field, member)
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZHRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZHRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZHRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZHRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZHRevRangeByLex(key, min, max, limit)
+}
+
+func (b Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	b.Backend = b.Backend.WithProfiler(profiler)
+	return &b
+}
+
+func (b Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	b.Backend = b.Backend.WithEventuallyConsistentReads()
+	return &b
+}
+
+func (b Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	b.Backend = keyvaluestore.WithOptions(b.Backend, opts)
+	return &b
+}
+
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return b.Backend
+}
@@ -0,0 +1,184 @@
+package keyvaluestoreoplog
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return &Backend{
+			Backend: memorystore.NewBackend(),
+			Sink:    NewJSONSink(&bytes.Buffer{}),
+		}
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return &Backend{
+			Backend: b,
+			Sink:    NewJSONSink(&bytes.Buffer{}),
+		}
+	}, keyvaluestoretest.WrapperOptions{})
+}
+
+// write makes a deterministic sequence of writes.
+func write(t *testing.T, b keyvaluestore.Backend) {
+	require.NoError(t, b.Set("foo", "bar"))
+	_, err := b.SetNX("foo", "baz")
+	require.NoError(t, err)
+	_, err = b.NIncrBy("n", 2)
+	require.NoError(t, err)
+	_, err = b.NIncrBy("foo", 2)
+	require.Error(t, err)
+	require.NoError(t, b.SAdd("set", "a", "b", "c"))
+	require.NoError(t, b.SRem("set", "c"))
+	require.NoError(t, b.HSet("h", "a", "b", keyvaluestore.KeyValue{Key: "c", Value: 1}))
+	require.NoError(t, b.HDel("h", "a"))
+	require.NoError(t, b.ZAdd("z", "a", 0.1))
+	require.NoError(t, b.ZAdd("z", "b", math.Inf(1)))
+	_, err = b.ZIncrBy("z", "a", 0.2)
+	require.NoError(t, err)
+	require.NoError(t, b.ZHMAdd("zh", []keyvaluestore.ZHEntry{
+		{Field: "a", Member: "x", Score: 1},
+		{Field: "b", Member: "y", Score: 2},
+	}))
+	_, err = b.ZHRemEQ("zh", "a", "x")
+	require.NoError(t, err)
+
+	batch := b.Batch()
+	batch.Set("batched", "value")
+	batch.ZAdd("z", "c", -1)
+	require.NoError(t, batch.Exec())
+
+	tx := b.AtomicWrite().WithIdempotencyToken("token")
+	tx.SetEQ("foo", "qux", "bar")
+	tx.HSetNX("h", "d", "e")
+	tx.ZHSetEQ("zh", "b", "z", "y", 3)
+	ok, err := tx.Exec()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	tx = b.AtomicWrite()
+	tx.SetNX("foo", "conflict")
+	tx.Set("unwritten", "value")
+	ok, err = tx.Exec()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+// dump reads everything written by write.
+func dump(t *testing.T, b keyvaluestore.Backend) []interface{} {
+	var ret []interface{}
+	for _, key := range []string{"foo", "n", "batched", "unwritten"} {
+		v, err := b.Get(key)
+		require.NoError(t, err)
+		ret = append(ret, v)
+	}
+	members, err := b.SMembers("set")
+	require.NoError(t, err)
+	sort.Strings(members)
+	fields, err := b.HGetAll("h")
+	require.NoError(t, err)
+	z, err := b.ZRangeByScoreWithScores("z", math.Inf(-1), math.Inf(1), 0)
+	require.NoError(t, err)
+	zh, err := b.ZHRangeByScoreWithScores("zh", math.Inf(-1), math.Inf(1), 0)
+	require.NoError(t, err)
+	return append(ret, members, fields, z, zh)
+}
+
+func TestReplay(t *testing.T) {
+	var buf bytes.Buffer
+	b := &Backend{
+		Backend: memorystore.NewBackend(),
+		Sink:    NewJSONSink(&buf),
+	}
+	write(t, b)
+
+	replayed := memorystore.NewBackend()
+	r := &Replayer{
+		Backend: replayed,
+	}
+	n, err := r.Replay(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, 17, n)
+	assert.Equal(t, dump(t, b), dump(t, replayed))
+}
+
+func TestReplayUntil(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	b := &Backend{
+		Backend: memorystore.NewBackend(),
+		Sink:    NewJSONSink(&buf),
+		Clock: keyvaluestore.ClockFunc(func() time.Time {
+			return now
+		}),
+	}
+	require.NoError(t, b.Set("foo", "bar"))
+	now = now.Add(time.Hour)
+	require.NoError(t, b.Set("foo", "baz"))
+
+	replayed := memorystore.NewBackend()
+	r := &Replayer{
+		Backend: replayed,
+		Until:   now.Add(-time.Minute),
+	}
+	n, err := r.Replay(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	v, err := replayed.Get("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", *v)
+}
+
+func TestReplayInvalidEntry(t *testing.T) {
+	r := &Replayer{
+		Backend: memorystore.NewBackend(),
+	}
+	_, err := r.Replay(strings.NewReader(`{"method":"ZAdd","args":["z","a","x"]}`))
+	assert.Error(t, err)
+	_, err = r.Replay(strings.NewReader(`{"method":"Set","args":["foo"]}`))
+	assert.Error(t, err)
+	_, err = r.Replay(strings.NewReader(`{"method":"Frobnicate","args":["foo"]}`))
+	assert.Error(t, err)
+}
+
+func TestSinkError(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	sinkErr := errors.New("sink unavailable")
+	b := &Backend{
+		Backend: underlying,
+		Sink: SinkFunc(func(entry *Entry) error {
+			return sinkErr
+		}),
+	}
+
+	assert.True(t, errors.Is(b.Set("foo", "bar"), sinkErr))
+
+	tx := b.AtomicWrite()
+	tx.Set("foo", "bar")
+	_, err := tx.Exec()
+	assert.True(t, errors.Is(err, sinkErr))
+
+	batch := b.Batch()
+	batch.Set("foo", "bar")
+	assert.True(t, errors.Is(batch.Exec(), sinkErr))
+
+	v, err := underlying.Get("foo")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
@@ -0,0 +1,99 @@
+package keyvaluestoreoplog
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// batchOperation logs the batch's writes as individual entries when it's executed.
+type batchOperation struct {
+	backend *Backend
+	batch   keyvaluestore.BatchOperation
+	entries []*Entry
+}
+
+func (op *batchOperation) add(method string, args ...interface{}) {
+	op.entries = append(op.entries, &Entry{
+		Method: method,
+		Args:   formatArgs(args...),
+	})
+}
+
+func (op *batchOperation) Get(key string) keyvaluestore.GetResult {
+	return op.batch.Get(key)
+}
+
+func (op *batchOperation) Delete(key string) keyvaluestore.ErrorResult {
+	op.add("Delete", key)
+	return op.batch.Delete(key)
+}
+
+func (op *batchOperation) Set(key string, value interface{}) keyvaluestore.ErrorResult {
+	op.add("Set", key, value)
+	return op.batch.Set(key, value)
+}
+
+func (op *batchOperation) SMembers(key string) keyvaluestore.SMembersResult {
+	return op.batch.SMembers(key)
+}
+
+func (op *batchOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	op.add("SAdd", key, member, members)
+	return op.batch.SAdd(key, member, members...)
+}
+
+func (op *batchOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	op.add("SRem", key, member, members)
+	return op.batch.SRem(key, member, members...)
+}
+
+func (op *batchOperation) ZAdd(key string, member interface{}, s float64) keyvaluestore.ErrorResult {
+	op.add("ZAdd", key, member, score(s))
+	return op.batch.ZAdd(key, member, s)
+}
+
+func (op *batchOperation) ZRem(key string, member interface{}) keyvaluestore.ErrorResult {
+	op.add("ZRem", key, member)
+	return op.batch.ZRem(key, member)
+}
+
+func (op *batchOperation) ZScore(key string, member interface{}) keyvaluestore.ZScoreResult {
+	return op.batch.ZScore(key, member)
+}
+
+func (op *batchOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.ErrorResult {
+	if len(entries) > 0 {
+		op.add("ZHMAdd", key, entries)
+	}
+	return op.batch.ZHMAdd(key, entries)
+}
+
+func (op *batchOperation) ZHRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRangeByScore(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRangeByLex(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRevRangeByLex(key, min, max, limit)
+}
+
+func (op *batchOperation) Len() int {
+	return op.batch.Len()
+}
+
+// Exec logs the batch's writes before executing it. If any of them can't be logged, none of the
+// batch's operations are performed.
+func (op *batchOperation) Exec() error {
+	for _, entry := range op.entries {
+		if err := op.backend.append(entry); err != nil {
+			return err
+		}
+	}
+	return op.batch.Exec()
+}
@@ -0,0 +1,378 @@
+// Package keyvaluestoreoplog provides a backend wrapper that logs every write before performing it,
+// and a replayer that applies such a log to another backend. Together they can be used to rebuild a
+// store as of a point in time, or to asynchronously replicate writes to another region for backends
+// that don't have native change streams.
+//
+// To log writes, wrap a backend with Backend and give it a Sink such as NewJSONSink. To rebuild a
+// store, pass the log to a Replayer whose backend is empty.
+package keyvaluestoreoplog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Entry is a single logged operation.
+type Entry struct {
+	// Method is the name of the backend method, e.g. "ZHAdd", or "AtomicWrite" for atomic writes.
+	Method string `json:"method"`
+
+	// Args are the method's arguments, formatted as strings. Variadic arguments are flattened.
+	Args []string `json:"args,omitempty"`
+
+	// Operations are the operations of an atomic write. For atomic writes, Args contains the
+	// idempotency token, if any.
+	Operations []*Entry `json:"operations,omitempty"`
+
+	// Time is when the operation was logged.
+	Time time.Time `json:"time"`
+}
+
+// Sink stores log entries. Sinks must be safe for concurrent use. Entries should be durable once
+// Append returns, since the operation is performed immediately afterwards.
+type Sink interface {
+	Append(entry *Entry) error
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(entry *Entry) error
+
+func (f SinkFunc) Append(entry *Entry) error {
+	return f(entry)
+}
+
+type jsonSink struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONSink returns a sink that writes entries to w as JSON lines, which can be replayed via
+// Replayer.Replay. Writes aren't buffered, so w should be buffered if durability isn't a concern.
+func NewJSONSink(w io.Writer) Sink {
+	return &jsonSink{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+func (s *jsonSink) Append(entry *Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.encoder.Encode(entry)
+}
+
+// Replayer applies logged operations to a backend.
+type Replayer struct {
+	Backend keyvaluestore.Backend
+
+	// If Until is non-zero, entries logged after it are skipped. This can be used to rebuild a
+	// store as of a point in time.
+	Until time.Time
+}
+
+// Replay reads JSON lines written by a sink created via NewJSONSink and applies them in order. It
+// returns the number of entries that were applied.
+func (r *Replayer) Replay(reader io.Reader) (int, error) {
+	decoder := json.NewDecoder(reader)
+	n := 0
+	for {
+		var entry Entry
+		if err := decoder.Decode(&entry); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		if !r.Until.IsZero() && entry.Time.After(r.Until) {
+			continue
+		}
+		if err := r.Apply(&entry); err != nil {
+			return n, fmt.Errorf("unable to apply entry %v (%v%v): %w", n, entry.Method, entry.Args, err)
+		}
+		n++
+	}
+}
+
+// Apply performs a single logged operation.
+//
+// Entries are logged before their operations are performed, so the log may contain operations that
+// failed. Operations that failed because a key had the wrong type fail the same way when they're
+// replayed, so those errors are ignored. Conditional operations are replayed with their conditions,
+// which evaluate the same way as they originally did as long as the log is applied in order to a
+// backend that started out with the same data.
+func (r *Replayer) Apply(entry *Entry) error {
+	err := apply(r.Backend, entry)
+	if errors.Is(err, keyvaluestore.ErrWrongType) {
+		return nil
+	}
+	return err
+}
+
+// argReader parses the arguments of a logged operation.
+type argReader struct {
+	args []string
+	err  error
+}
+
+func (r *argReader) string() string {
+	if len(r.args) == 0 {
+		if r.err == nil {
+			r.err = fmt.Errorf("too few arguments")
+		}
+		return ""
+	}
+	s := r.args[0]
+	r.args = r.args[1:]
+	return s
+}
+
+func (r *argReader) float() float64 {
+	s := r.string()
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("invalid float argument: %v", s)
+	}
+	return f
+}
+
+func (r *argReader) int() int64 {
+	s := r.string()
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("invalid integer argument: %v", s)
+	}
+	return n
+}
+
+// rest returns the remaining arguments, which must be a non-empty multiple of n.
+func (r *argReader) rest(n int) []string {
+	rest := r.args
+	if (len(rest) == 0 || len(rest)%n != 0) && r.err == nil {
+		r.err = fmt.Errorf("wrong number of arguments")
+	}
+	r.args = nil
+	return rest
+}
+
+// done returns an error if the arguments were invalid or not all of them were read.
+func (r *argReader) done() error {
+	if r.err == nil && len(r.args) > 0 {
+		r.err = fmt.Errorf("too many arguments")
+	}
+	return r.err
+}
+
+func interfaces(s []string) []interface{} {
+	ret := make([]interface{}, len(s))
+	for i, v := range s {
+		ret[i] = v
+	}
+	return ret
+}
+
+func keyValues(s []string) []keyvaluestore.KeyValue {
+	ret := make([]keyvaluestore.KeyValue, len(s)/2)
+	for i := range ret {
+		ret[i] = keyvaluestore.KeyValue{
+			Key:   s[2*i],
+			Value: s[2*i+1],
+		}
+	}
+	return ret
+}
+
+func zhEntries(r *argReader) []keyvaluestore.ZHEntry {
+	rest := r.rest(3)
+	entries := make([]keyvaluestore.ZHEntry, len(rest)/3)
+	for i := range entries {
+		score, err := strconv.ParseFloat(rest[3*i+2], 64)
+		if err != nil && r.err == nil {
+			r.err = fmt.Errorf("invalid float argument: %v", rest[3*i+2])
+		}
+		entries[i] = keyvaluestore.ZHEntry{
+			Field:  rest[3*i],
+			Member: rest[3*i+1],
+			Score:  score,
+		}
+	}
+	return entries
+}
+
+func apply(b keyvaluestore.Backend, entry *Entry) error {
+	if entry.Method == "AtomicWrite" {
+		return applyAtomicWrite(b, entry)
+	}
+
+	r := &argReader{args: entry.Args}
+	key := r.string()
+	var f func() error
+	switch entry.Method {
+	case "Delete":
+		f = func() error {
+			_, err := b.Delete(key)
+			return err
+		}
+	case "Set", "SetXX", "SetNX":
+		value := r.string()
+		f = func() error {
+			switch entry.Method {
+			case "SetXX":
+				_, err := b.SetXX(key, value)
+				return err
+			case "SetNX":
+				_, err := b.SetNX(key, value)
+				return err
+			}
+			return b.Set(key, value)
+		}
+	case "SetEQ":
+		value, oldValue := r.string(), r.string()
+		f = func() error {
+			_, err := b.SetEQ(key, value, oldValue)
+			return err
+		}
+	case "NIncrBy":
+		n := r.int()
+		f = func() error {
+			_, err := b.NIncrBy(key, n)
+			return err
+		}
+	case "SAdd", "SRem":
+		members := interfaces(r.rest(1))
+		f = func() error {
+			if entry.Method == "SRem" {
+				return b.SRem(key, members[0], members[1:]...)
+			}
+			return b.SAdd(key, members[0], members[1:]...)
+		}
+	case "HSet":
+		fields := keyValues(r.rest(2))
+		f = func() error {
+			return b.HSet(key, fields[0].Key, fields[0].Value, fields[1:]...)
+		}
+	case "HDel":
+		fields := r.rest(1)
+		f = func() error {
+			return b.HDel(key, fields[0], fields[1:]...)
+		}
+	case "ZAdd":
+		member, score := r.string(), r.float()
+		f = func() error {
+			return b.ZAdd(key, member, score)
+		}
+	case "ZRem":
+		member := r.string()
+		f = func() error {
+			return b.ZRem(key, member)
+		}
+	case "ZIncrBy":
+		member, n := r.string(), r.float()
+		f = func() error {
+			_, err := b.ZIncrBy(key, member, n)
+			return err
+		}
+	case "ZHAdd":
+		field, member, score := r.string(), r.string(), r.float()
+		f = func() error {
+			return b.ZHAdd(key, field, member, score)
+		}
+	case "ZHMAdd":
+		entries := zhEntries(r)
+		f = func() error {
+			return b.ZHMAdd(key, entries)
+		}
+	case "ZHRem":
+		field := r.string()
+		f = func() error {
+			return b.ZHRem(key, field)
+		}
+	case "ZHRemEQ":
+		field, member := r.string(), r.string()
+		f = func() error {
+			_, err := b.ZHRemEQ(key, field, member)
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown method: %v", entry.Method)
+	}
+	if err := r.done(); err != nil {
+		return err
+	}
+	return f()
+}
+
+func applyAtomicWrite(b keyvaluestore.Backend, entry *Entry) error {
+	tx := b.AtomicWrite()
+	if len(entry.Args) > 0 {
+		tx = tx.WithIdempotencyToken(entry.Args[0])
+	}
+	for _, op := range entry.Operations {
+		r := &argReader{args: op.Args}
+		key := r.string()
+		switch op.Method {
+		case "Set":
+			tx.Set(key, r.string())
+		case "SetNX":
+			tx.SetNX(key, r.string())
+		case "SetXX":
+			tx.SetXX(key, r.string())
+		case "SetEQ":
+			tx.SetEQ(key, r.string(), r.string())
+		case "Delete":
+			tx.Delete(key)
+		case "DeleteXX":
+			tx.DeleteXX(key)
+		case "NIncrBy":
+			tx.NIncrBy(key, r.int())
+		case "ZAdd":
+			tx.ZAdd(key, r.string(), r.float())
+		case "ZAddNX":
+			tx.ZAddNX(key, r.string(), r.float())
+		case "ZRem":
+			tx.ZRem(key, r.string())
+		case "ZHAdd":
+			tx.ZHAdd(key, r.string(), r.string(), r.float())
+		case "ZHMAdd":
+			tx.ZHMAdd(key, zhEntries(r))
+		case "ZHSetEQ":
+			tx.ZHSetEQ(key, r.string(), r.string(), r.string(), r.float())
+		case "ZHRem":
+			tx.ZHRem(key, r.string())
+		case "ZHRemEQ":
+			tx.ZHRemEQ(key, r.string(), r.string())
+		case "SAdd", "SRem":
+			members := interfaces(r.rest(1))
+			if r.err == nil {
+				if op.Method == "SRem" {
+					tx.SRem(key, members[0], members[1:]...)
+				} else {
+					tx.SAdd(key, members[0], members[1:]...)
+				}
+			}
+		case "HSet":
+			fields := keyValues(r.rest(2))
+			if r.err == nil {
+				tx.HSet(key, fields[0].Key, fields[0].Value, fields[1:]...)
+			}
+		case "HSetNX":
+			tx.HSetNX(key, r.string(), r.string())
+		case "HDel":
+			fields := r.rest(1)
+			if r.err == nil {
+				tx.HDel(key, fields[0], fields[1:]...)
+			}
+		default:
+			return fmt.Errorf("unknown atomic write method: %v", op.Method)
+		}
+		if err := r.done(); err != nil {
+			return fmt.Errorf("invalid atomic write %v operation: %w", op.Method, err)
+		}
+	}
+	_, err := tx.Exec()
+	return err
+}
@@ -0,0 +1,126 @@
+// Package keyvaluestoreoutbox implements the transactional outbox pattern, which makes writing data
+// and emitting events about it atomic.
+package keyvaluestoreoutbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Outbox is a log of events stored in the sorted hash at Key. Events are appended as part of the
+// same atomic writes as the changes they describe, and a poller publishes them afterwards. Events
+// are published in the order they were appended at least once, so consumers should be idempotent.
+type Outbox struct {
+	Backend keyvaluestore.Backend
+	Key     string
+
+	// Clock is used to get the current time. If nil, the wall clock is used.
+	Clock keyvaluestore.Clock
+}
+
+func (o *Outbox) currentTime() time.Time {
+	return keyvaluestore.Now(o.Clock)
+}
+
+var appendCount uint32
+
+// Append adds an operation to the atomic write that appends the event to the outbox. The event is
+// only appended if the write commits.
+func (o *Outbox) Append(tx keyvaluestore.AtomicWriteOperation, payload string) error {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	now := o.currentTime().UnixNano()
+	// The id begins with the time and a counter so that events appended by the same process within
+	// the same microsecond are still ordered.
+	id := fmt.Sprintf("%016x%08x", now, atomic.AddUint32(&appendCount, 1)) + hex.EncodeToString(nonce)
+	tx.ZHAdd(o.Key, id, keyvaluestore.Key{id, payload}.String(), float64(now/1000))
+	return nil
+}
+
+// Drain publishes up to limit of the oldest events, removing each from the outbox once it's been
+// published. It returns the number of events published. If publish returns an error, draining
+// stops so that the event can be retried without publishing later events before it. If the
+// process stops after publishing an event but before removing it, it will be published again.
+//
+// If Drain is invoked concurrently, events may be published more than once, so typically only one
+// process should drain each outbox, e.g. by holding a keyvaluestorelock.Mutex.
+func (o *Outbox) Drain(limit int, publish func(payload string) error) (int, error) {
+	members, err := o.Backend.ZHRangeByScore(o.Key, math.Inf(-1), math.Inf(1), limit)
+	if err != nil {
+		return 0, err
+	}
+	for i, member := range members {
+		k, err := keyvaluestore.ParseKey(member)
+		if err != nil || len(k) != 2 {
+			return i, fmt.Errorf("malformed outbox event: %w", keyvaluestore.ErrWrongType)
+		}
+		if err := publish(k[1]); err != nil {
+			return i, err
+		}
+		if err := o.Backend.ZHRem(o.Key, k[0]); err != nil {
+			return i + 1, err
+		}
+	}
+	return len(members), nil
+}
+
+// Poll drains the outbox in batches of up to batchSize events every interval until the returned
+// function is invoked. If a batch is full, the next one is drained immediately. If batchSize is
+// zero, every event is drained at once. Errors are passed
+// to onError, which may be nil.
+func (o *Outbox) Poll(interval time.Duration, batchSize int, publish func(payload string) error, onError func(error)) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			for {
+				n, err := o.Drain(batchSize, publish)
+				if err != nil && onError != nil {
+					onError(err)
+				}
+				if err != nil || batchSize == 0 || n < batchSize {
+					break
+				}
+				select {
+				case <-done:
+					return
+				default:
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+		<-stopped
+	}
+}
+
+// PublishTo returns a function suitable for Drain or Poll that publishes each event to the given
+// channel.
+func PublishTo(p keyvaluestore.Publisher, channel string) func(payload string) error {
+	return func(payload string) error {
+		return p.Publish(channel, payload)
+	}
+}
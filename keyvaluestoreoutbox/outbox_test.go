@@ -0,0 +1,119 @@
+package keyvaluestoreoutbox
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestOutbox(t *testing.T) {
+	b := memorystore.NewBackend()
+	now := time.Unix(1600000000, 0)
+	o := &Outbox{
+		Backend: b,
+		Key:     "outbox",
+		Clock: keyvaluestore.ClockFunc(func() time.Time {
+			return now
+		}),
+	}
+
+	tx := b.AtomicWrite()
+	tx.Set("user:1", "alice")
+	require.NoError(t, o.Append(tx, "user 1 created"))
+	require.NoError(t, o.Append(tx, "user 1 renamed"))
+	ok, err := tx.Exec()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	tx = b.AtomicWrite()
+	tx.SetNX("user:1", "bob")
+	require.NoError(t, o.Append(tx, "user 1 created again"))
+	ok, err = tx.Exec()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	now = now.Add(time.Second)
+	tx = b.AtomicWrite()
+	tx.Set("user:2", "bob")
+	require.NoError(t, o.Append(tx, "user 2 created"))
+	ok, err = tx.Exec()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	var published []string
+	failing := true
+	publish := func(payload string) error {
+		if payload == "user 1 renamed" && failing {
+			failing = false
+			return errors.New("publish failed")
+		}
+		published = append(published, payload)
+		return nil
+	}
+
+	n, err := o.Drain(0, publish)
+	assert.Error(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"user 1 created"}, published)
+
+	n, err = o.Drain(1, publish)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"user 1 created", "user 1 renamed"}, published)
+
+	n, err = o.Drain(0, publish)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"user 1 created", "user 1 renamed", "user 2 created"}, published)
+
+	n, err = o.Drain(0, publish)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestOutboxPoll(t *testing.T) {
+	b := memorystore.NewBackend()
+	o := &Outbox{
+		Backend: b,
+		Key:     "outbox",
+	}
+
+	ch, cancel, err := b.Subscribe("events")
+	require.NoError(t, err)
+	defer cancel()
+
+	var errs []error
+	var errsMutex sync.Mutex
+	stop := o.Poll(time.Millisecond, 2, PublishTo(b, "events"), func(err error) {
+		errsMutex.Lock()
+		defer errsMutex.Unlock()
+		errs = append(errs, err)
+	})
+
+	for _, payload := range []string{"a", "b", "c"} {
+		tx := b.AtomicWrite()
+		require.NoError(t, o.Append(tx, payload))
+		_, err := tx.Exec()
+		require.NoError(t, err)
+	}
+
+	var received []string
+	for len(received) < 3 {
+		select {
+		case message := <-ch:
+			received = append(received, message)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for events")
+		}
+	}
+	stop()
+	assert.Equal(t, []string{"a", "b", "c"}, received)
+	assert.Empty(t, errs)
+}
@@ -0,0 +1,109 @@
+// Package keyvaluestoreproto provides helpers for storing Protocol Buffers messages.
+//
+// Messages are written by wrapping them with Value or DeterministicValue, which can be passed
+// anywhere a backend accepts a value, including atomic writes and batches:
+//
+//	backend.Set("user", keyvaluestoreproto.Value(user))
+//	backend.ZHAdd("users", id, keyvaluestoreproto.Value(user), score)
+//
+// If a message contains maps and will be used with SetEQ or similar conditionals, use
+// DeterministicValue so that equal messages always produce equal bytes.
+package keyvaluestoreproto
+
+import (
+	"encoding"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+type Options struct {
+	// If true, messages are marshaled deterministically. See proto.MarshalOptions.
+	Deterministic bool
+}
+
+type value struct {
+	message proto.Message
+	options proto.MarshalOptions
+}
+
+func (v *value) MarshalBinary() ([]byte, error) {
+	return v.options.Marshal(v.message)
+}
+
+// Value returns a value that marshals the message using the given options.
+func (opts Options) Value(m proto.Message) encoding.BinaryMarshaler {
+	return &value{
+		message: m,
+		options: proto.MarshalOptions{
+			Deterministic: opts.Deterministic,
+		},
+	}
+}
+
+// Value returns a value that marshals the message using the default options.
+func Value(m proto.Message) encoding.BinaryMarshaler {
+	return Options{}.Value(m)
+}
+
+// DeterministicValue returns a value that marshals the message deterministically.
+func DeterministicValue(m proto.Message) encoding.BinaryMarshaler {
+	return Options{Deterministic: true}.Value(m)
+}
+
+type serializer struct {
+	options proto.MarshalOptions
+}
+
+func (s *serializer) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("value is not a proto.Message: %T", v)
+	}
+	return s.options.Marshal(m)
+}
+
+func (s *serializer) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("value is not a proto.Message: %T", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// Serializer returns a serializer for messages that uses the given options. This allows messages
+// to be used with generic helpers such as keyvaluestore.SetSerialized.
+func (opts Options) Serializer() keyvaluestore.Serializer {
+	return &serializer{
+		options: proto.MarshalOptions{
+			Deterministic: opts.Deterministic,
+		},
+	}
+}
+
+// Unmarshal decodes a value read from a backend into m. This can be used for values returned by
+// operations such as ZHRangeByScore.
+func Unmarshal(v string, m proto.Message) error {
+	return proto.Unmarshal([]byte(v), m)
+}
+
+// Get gets the key and decodes its value into m. If the key doesn't exist, false is returned and m
+// is left untouched.
+func Get(b keyvaluestore.Backend, key string, m proto.Message) (bool, error) {
+	v, err := b.Get(key)
+	if err != nil || v == nil {
+		return false, err
+	}
+	return true, Unmarshal(*v, m)
+}
+
+// HGet is like Get, but for hash fields.
+func HGet(b keyvaluestore.Backend, key, field string, m proto.Message) (bool, error) {
+	v, err := b.HGet(key, field)
+	if err != nil || v == nil {
+		return false, err
+	}
+	return true, Unmarshal(*v, m)
+}
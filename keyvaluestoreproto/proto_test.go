@@ -0,0 +1,79 @@
+package keyvaluestoreproto
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestProto(t *testing.T) {
+	b := memorystore.NewBackend()
+
+	require.NoError(t, b.Set("foo", Value(wrapperspb.String("bar"))))
+	var s wrapperspb.StringValue
+	ok, err := Get(b, "foo", &s)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "bar", s.Value)
+
+	ok, err = Get(b, "missing", &s)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, b.HSet("hash", "field", Value(wrapperspb.Int64(1))))
+	var n wrapperspb.Int64Value
+	ok, err = HGet(b, "hash", "field", &n)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), n.Value)
+
+	require.NoError(t, b.ZHAdd("zset", "field", Value(wrapperspb.String("baz")), 1))
+	values, err := b.ZHRangeByScore("zset", math.Inf(-1), math.Inf(1), 0)
+	require.NoError(t, err)
+	require.Len(t, values, 1)
+	require.NoError(t, Unmarshal(values[0], &s))
+	assert.Equal(t, "baz", s.Value)
+}
+
+func TestDeterministicValue(t *testing.T) {
+	fields := map[string]interface{}{}
+	for i := 0; i < 100; i++ {
+		fields[strconv.Itoa(i)] = i
+	}
+	newMessage := func() proto.Message {
+		m, err := structpb.NewStruct(fields)
+		require.NoError(t, err)
+		return m
+	}
+
+	b := memorystore.NewBackend()
+	require.NoError(t, b.Set("foo", DeterministicValue(newMessage())))
+
+	// A separately constructed but equal message can be used as the conditional.
+	ok, err := b.SetEQ("foo", "bar", DeterministicValue(newMessage()))
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestSerializer(t *testing.T) {
+	b := memorystore.NewBackend()
+	s := Options{}.Serializer()
+
+	require.NoError(t, keyvaluestore.SetSerialized(b, s, "foo", wrapperspb.String("bar")))
+	var v wrapperspb.StringValue
+	ok, err := keyvaluestore.GetSerialized(b, s, "foo", &v)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "bar", v.Value)
+
+	assert.Error(t, keyvaluestore.SetSerialized(b, s, "foo", "bar"))
+}
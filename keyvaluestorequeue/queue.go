@@ -0,0 +1,241 @@
+// Package keyvaluestorequeue implements a work queue with at-least-once delivery on top of any
+// backend.
+package keyvaluestorequeue
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Queue is a work queue. Received messages are hidden from other receivers until their visibility
+// timeout expires, after which they're delivered again unless they've been acknowledged. Messages
+// that are received too many times are moved to a dead letter queue.
+//
+// Messages are stored in a sorted hash scored by the time at which they become visible. Each
+// message also has a receipt key, which is conditionally updated whenever the message is received
+// or removed so that only one receiver can succeed.
+type Queue struct {
+	Backend keyvaluestore.Backend
+	Name    string
+
+	// MaxReceives is the number of times a message may be received before it's moved to the dead
+	// letter queue. If zero, messages are never dead-lettered automatically.
+	MaxReceives int
+
+	// Clock is used to get the current time. If nil, the wall clock is used.
+	Clock keyvaluestore.Clock
+}
+
+// Message is a message received from a queue.
+type Message struct {
+	ID   string
+	Body string
+
+	// Receives is the number of times the message has been received, including this time.
+	Receives int
+
+	receipt string
+}
+
+// The receipt of messages that have been removed from the queue. Real receipts are never empty.
+const removedReceipt = "-"
+
+func (m *Message) encode() string {
+	return keyvaluestore.Key{m.ID, m.receipt, strconv.Itoa(m.Receives), m.Body}.String()
+}
+
+func decodeMessage(s string) (*Message, error) {
+	k, err := keyvaluestore.ParseKey(s)
+	if err != nil {
+		return nil, err
+	} else if len(k) != 4 {
+		return nil, fmt.Errorf("malformed queue message: %q", s)
+	}
+	receives, err := strconv.Atoi(k[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed queue message receive count: %w", err)
+	}
+	return &Message{
+		ID:       k[0],
+		Body:     k[3],
+		Receives: receives,
+		receipt:  k[1],
+	}, nil
+}
+
+func newRandomString() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func score(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+func (q *Queue) messagesKey() string {
+	return keyvaluestore.Key{q.Name, "messages"}.String()
+}
+
+func (q *Queue) deadLettersKey() string {
+	return keyvaluestore.Key{q.Name, "dead"}.String()
+}
+
+func (q *Queue) receiptKey(id string) string {
+	return keyvaluestore.Key{q.Name, "receipts", id}.String()
+}
+
+func (q *Queue) currentTime() time.Time {
+	return keyvaluestore.Now(q.Clock)
+}
+
+// Enqueue adds a message to the queue and returns its id.
+func (q *Queue) Enqueue(body string) (string, error) {
+	id, err := newRandomString()
+	if err != nil {
+		return "", err
+	}
+	receipt, err := newRandomString()
+	if err != nil {
+		return "", err
+	}
+	m := &Message{
+		ID:      id,
+		Body:    body,
+		receipt: receipt,
+	}
+	tx := q.Backend.AtomicWrite()
+	tx.SetNX(q.receiptKey(id), receipt)
+	tx.ZHAdd(q.messagesKey(), id, m.encode(), score(q.currentTime()))
+	if ok, err := tx.Exec(); err != nil {
+		return "", err
+	} else if !ok {
+		return "", fmt.Errorf("message id collision")
+	}
+	return id, nil
+}
+
+// Dequeue receives up to max visible messages, hiding them from other receivers for the given
+// duration. If the messages aren't acknowledged by then, they'll be delivered again.
+//
+// Fewer messages may be returned if other receivers win races for them. If no messages are
+// visible, an empty slice is returned.
+func (q *Queue) Dequeue(max int, visibilityTimeout time.Duration) ([]*Message, error) {
+	now := q.currentTime()
+	candidates, err := q.Backend.ZHRangeByScore(q.messagesKey(), math.Inf(-1), score(now), max)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*Message
+	for _, candidate := range candidates {
+		m, err := decodeMessage(candidate)
+		if err != nil {
+			return nil, err
+		}
+
+		if q.MaxReceives > 0 && m.Receives >= q.MaxReceives {
+			if _, err := q.remove(m, true); err != nil && !keyvaluestore.IsAtomicWriteConflict(err) {
+				return nil, err
+			}
+			continue
+		}
+
+		if received, err := q.receive(m, now.Add(visibilityTimeout)); err != nil {
+			return nil, err
+		} else if received != nil {
+			ret = append(ret, received)
+		}
+	}
+	return ret, nil
+}
+
+// receive claims the message until the given time. It returns nil if another receiver claimed or
+// removed it first.
+func (q *Queue) receive(m *Message, visibleAt time.Time) (*Message, error) {
+	receipt, err := newRandomString()
+	if err != nil {
+		return nil, err
+	}
+	received := &Message{
+		ID:       m.ID,
+		Body:     m.Body,
+		Receives: m.Receives + 1,
+		receipt:  receipt,
+	}
+	tx := q.Backend.AtomicWrite()
+	tx.SetEQ(q.receiptKey(m.ID), receipt, m.receipt)
+	tx.ZHAdd(q.messagesKey(), m.ID, received.encode(), score(visibleAt))
+	if ok, err := tx.Exec(); err != nil {
+		if keyvaluestore.IsAtomicWriteConflict(err) {
+			return nil, nil
+		}
+		return nil, err
+	} else if !ok {
+		return nil, nil
+	}
+	return received, nil
+}
+
+// Ack removes a received message from the queue. It returns false if the message's visibility
+// timeout expired and it was received again or removed by someone else.
+func (q *Queue) Ack(m *Message) (bool, error) {
+	return q.remove(m, false)
+}
+
+// DeadLetter moves a received message to the dead letter queue. It returns false if the message's
+// visibility timeout expired and it was received again or removed by someone else.
+func (q *Queue) DeadLetter(m *Message) (bool, error) {
+	return q.remove(m, true)
+}
+
+func (q *Queue) remove(m *Message, deadLetter bool) (bool, error) {
+	tx := q.Backend.AtomicWrite()
+	tx.SetEQ(q.receiptKey(m.ID), removedReceipt, m.receipt)
+	tx.ZHRem(q.messagesKey(), m.ID)
+	if deadLetter {
+		tx.ZHAdd(q.deadLettersKey(), m.ID, m.encode(), score(q.currentTime()))
+	}
+	if ok, err := tx.Exec(); err != nil || !ok {
+		return false, err
+	}
+
+	// Receivers with stale reads of the message will fail to update the receipt key whether it
+	// holds the removed receipt or doesn't exist, so it's safe to delete now.
+	if _, err := q.Backend.Delete(q.receiptKey(m.ID)); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// DeadLetters returns up to limit messages from the dead letter queue, oldest first. If limit is
+// zero, all of them are returned.
+func (q *Queue) DeadLetters(limit int) ([]*Message, error) {
+	members, err := q.Backend.ZHRangeByScore(q.deadLettersKey(), math.Inf(-1), math.Inf(1), limit)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*Message, len(members))
+	for i, member := range members {
+		m, err := decodeMessage(member)
+		if err != nil {
+			return nil, err
+		}
+		m.receipt = ""
+		ret[i] = m
+	}
+	return ret, nil
+}
+
+// RemoveDeadLetter permanently deletes a message from the dead letter queue.
+func (q *Queue) RemoveDeadLetter(id string) error {
+	return q.Backend.ZHRem(q.deadLettersKey(), id)
+}
@@ -0,0 +1,127 @@
+package keyvaluestorequeue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func newTestQueue() (*Queue, *time.Time) {
+	now := time.Unix(1600000000, 0)
+	return &Queue{
+		Backend:     memorystore.NewBackend(),
+		Name:        "jobs",
+		MaxReceives: 2,
+		Clock: keyvaluestore.ClockFunc(func() time.Time {
+			return now
+		}),
+	}, &now
+}
+
+func bodies(messages []*Message) []string {
+	ret := make([]string, len(messages))
+	for i, m := range messages {
+		ret[i] = m.Body
+	}
+	return ret
+}
+
+func TestQueue(t *testing.T) {
+	q, now := newTestQueue()
+
+	for _, body := range []string{"foo", "bar:baz"} {
+		_, err := q.Enqueue(body)
+		require.NoError(t, err)
+	}
+
+	messages, err := q.Dequeue(10, time.Minute)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"foo", "bar:baz"}, bodies(messages))
+	for _, m := range messages {
+		assert.Equal(t, 1, m.Receives)
+	}
+
+	// The messages are invisible until their visibility timeout expires.
+	empty, err := q.Dequeue(10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	ok, err := q.Ack(messages[0])
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	*now = now.Add(2 * time.Minute)
+
+	redelivered, err := q.Dequeue(10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, redelivered, 1)
+	assert.Equal(t, messages[1].ID, redelivered[0].ID)
+	assert.Equal(t, 2, redelivered[0].Receives)
+
+	// Once redelivered, the original receipt is no longer valid.
+	ok, err = q.Ack(messages[1])
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = q.Ack(redelivered[0])
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	*now = now.Add(2 * time.Minute)
+
+	empty, err = q.Dequeue(10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	// Acknowledged messages don't leave anything behind.
+	v, err := q.Backend.Get(q.receiptKey(messages[0].ID))
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+	q, now := newTestQueue()
+
+	id, err := q.Enqueue("foo")
+	require.NoError(t, err)
+	_, err = q.Enqueue("bar")
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		messages, err := q.Dequeue(1, time.Minute)
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		if messages[0].Body == "bar" {
+			ok, err := q.DeadLetter(messages[0])
+			require.NoError(t, err)
+			assert.True(t, ok)
+		}
+	}
+
+	// "foo" has been received once, so it can be received one more time.
+	*now = now.Add(2 * time.Minute)
+	messages, err := q.Dequeue(10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, id, messages[0].ID)
+
+	// After that, it's dead-lettered automatically.
+	*now = now.Add(2 * time.Minute)
+	messages, err = q.Dequeue(10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+
+	dead, err := q.DeadLetters(0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bar", "foo"}, bodies(dead))
+
+	require.NoError(t, q.RemoveDeadLetter(dead[0].ID))
+	dead, err = q.DeadLetters(0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, bodies(dead))
+}
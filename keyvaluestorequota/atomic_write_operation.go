@@ -0,0 +1,111 @@
+package keyvaluestorequota
+
+import "github.com/ccbrown/keyvaluestore"
+
+type atomicWriteOperation struct {
+	keyvaluestore.AtomicWriteOperation
+	backend *Backend
+
+	// changes determine the change in usage caused by each tracked operation. They're invoked
+	// immediately before the atomic write is executed.
+	changes []func(usageChanges) error
+}
+
+func (op *atomicWriteOperation) Set(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	op.changes = append(op.changes, func(c usageChanges) error {
+		return op.backend.set(c, key, keyvaluestore.ToString(value))
+	})
+	return op.AtomicWriteOperation.Set(key, value)
+}
+
+func (op *atomicWriteOperation) SetNX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	op.changes = append(op.changes, func(c usageChanges) error {
+		return op.backend.set(c, key, keyvaluestore.ToString(value))
+	})
+	return op.AtomicWriteOperation.SetNX(key, value)
+}
+
+func (op *atomicWriteOperation) SetXX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	op.changes = append(op.changes, func(c usageChanges) error {
+		return op.backend.set(c, key, keyvaluestore.ToString(value))
+	})
+	return op.AtomicWriteOperation.SetXX(key, value)
+}
+
+func (op *atomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
+	op.changes = append(op.changes, func(c usageChanges) error {
+		return op.backend.set(c, key, keyvaluestore.ToString(value))
+	})
+	return op.AtomicWriteOperation.SetEQ(key, value, oldValue)
+}
+
+func (op *atomicWriteOperation) Delete(key string) keyvaluestore.AtomicWriteResult {
+	op.changes = append(op.changes, func(c usageChanges) error {
+		return op.backend.set(c, key, nil)
+	})
+	return op.AtomicWriteOperation.Delete(key)
+}
+
+func (op *atomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteResult {
+	op.changes = append(op.changes, func(c usageChanges) error {
+		return op.backend.set(c, key, nil)
+	})
+	return op.AtomicWriteOperation.DeleteXX(key)
+}
+
+func (op *atomicWriteOperation) NIncrBy(key string, n int64) keyvaluestore.AtomicWriteResult {
+	op.changes = append(op.changes, func(c usageChanges) error {
+		return op.backend.incr(c, key, n)
+	})
+	return op.AtomicWriteOperation.NIncrBy(key, n)
+}
+
+func (op *atomicWriteOperation) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) keyvaluestore.AtomicWriteResult {
+	op.changes = append(op.changes, func(c usageChanges) error {
+		if err := op.backend.hset(c, key, field, keyvaluestore.ToString(value)); err != nil {
+			return err
+		}
+		for _, kv := range fields {
+			if err := op.backend.hset(c, key, kv.Key, keyvaluestore.ToString(kv.Value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return op.AtomicWriteOperation.HSet(key, field, value, fields...)
+}
+
+func (op *atomicWriteOperation) HSetNX(key, field string, value interface{}) keyvaluestore.AtomicWriteResult {
+	op.changes = append(op.changes, func(c usageChanges) error {
+		return op.backend.hset(c, key, field, keyvaluestore.ToString(value))
+	})
+	return op.AtomicWriteOperation.HSetNX(key, field, value)
+}
+
+func (op *atomicWriteOperation) HDel(key, field string, fields ...string) keyvaluestore.AtomicWriteResult {
+	op.changes = append(op.changes, func(c usageChanges) error {
+		for _, field := range append([]string{field}, fields...) {
+			if err := op.backend.hset(c, key, field, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return op.AtomicWriteOperation.HDel(key, field, fields...)
+}
+
+func (op *atomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.AtomicWriteOperation.WithIdempotencyToken(token)
+	return op
+}
+
+func (op *atomicWriteOperation) Exec() (bool, error) {
+	return op.backend.write(func(c usageChanges) error {
+		for _, f := range op.changes {
+			if err := f(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, op.AtomicWriteOperation.Exec)
+}
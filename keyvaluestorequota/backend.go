@@ -0,0 +1,442 @@
+// Package keyvaluestorequota provides a backend wrapper that tracks how much data each tenant of a
+// shared backend stores, so that quotas can be enforced and usage can be billed without scanning the
+// whole store.
+package keyvaluestorequota
+
+import (
+	"errors"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// DefaultCounterPrefix is the prefix used for usage counters by backends that don't specify one.
+const DefaultCounterPrefix = "_quota:"
+
+const (
+	keysCounterSuffix  = ":keys"
+	bytesCounterSuffix = ":bytes"
+)
+
+// Backend passes operations through to an underlying backend and maintains per-tenant usage
+// counters via NIncrBy. Writes of plain values and hash fields, including those made via batches
+// and atomic writes, read the previous values of the keys or fields they modify to determine the
+// change in usage. Set and sorted set operations aren't tracked.
+//
+// Usage is an estimate: concurrent writes to the same key may each count the same previous value,
+// and writes that partially fail, such as batches, aren't counted. If a write succeeds but its
+// counters can't be updated, the counters' error is returned.
+type Backend struct {
+	Backend keyvaluestore.Backend
+
+	// Tenant returns the tenant that a key belongs to. Keys for which it returns "" aren't tracked.
+	// See SeparatorTenant.
+	Tenant func(key string) string
+
+	// If Limit is given, writes that would increase a tenant's usage beyond its limit fail with a
+	// *QuotaExceededError. Zero fields are unlimited. Since usage is an estimate, the limits are
+	// soft.
+	Limit func(tenant string) Usage
+
+	// CounterPrefix is prepended to the keys of the usage counters. If empty, DefaultCounterPrefix
+	// is used. The counters are stored in the underlying backend and never count towards usage.
+	CounterPrefix string
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+
+func (b *Backend) counterPrefix() string {
+	if b.CounterPrefix != "" {
+		return b.CounterPrefix
+	}
+	return DefaultCounterPrefix
+}
+
+func (b *Backend) counterKeys(tenant string) (keys, bytes string) {
+	prefix := b.counterPrefix()
+	return prefix + tenant + keysCounterSuffix, prefix + tenant + bytesCounterSuffix
+}
+
+// Usage returns the tenant's current usage.
+func (b *Backend) Usage(tenant string) (Usage, error) {
+	keysKey, bytesKey := b.counterKeys(tenant)
+	keys, err := b.Backend.NIncrBy(keysKey, 0)
+	if err != nil {
+		return Usage{}, err
+	}
+	bytes, err := b.Backend.NIncrBy(bytesKey, 0)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{
+		Keys:  keys,
+		Bytes: bytes,
+	}, nil
+}
+
+func (b *Backend) tenant(key string) string {
+	if b.Tenant == nil {
+		return ""
+	}
+	return b.Tenant(key)
+}
+
+// keyUsage determines the current usage of a key, which may hold a plain value or a hash.
+func (b *Backend) keyUsage(key string) (Usage, error) {
+	v, err := b.Backend.Get(key)
+	if err != nil && !errors.Is(err, keyvaluestore.ErrWrongType) {
+		return Usage{}, err
+	} else if v != nil {
+		return valueUsage(key, v), nil
+	}
+	h, err := b.Backend.HGetAll(key)
+	if err != nil && !errors.Is(err, keyvaluestore.ErrWrongType) {
+		return Usage{}, err
+	}
+	var usage Usage
+	for field, v := range h {
+		usage = usage.add(fieldUsage(field, &v))
+	}
+	return usage, nil
+}
+
+// set adds the change in usage caused by setting a key to a plain value.
+func (b *Backend) set(changes usageChanges, key string, value *string) error {
+	tenant := b.tenant(key)
+	if tenant == "" {
+		return nil
+	}
+	prev, err := b.keyUsage(key)
+	if err != nil {
+		return err
+	}
+	changes.add(tenant, prev, valueUsage(key, value))
+	return nil
+}
+
+// incr adds the change in usage caused by incrementing a key.
+func (b *Backend) incr(changes usageChanges, key string, n int64) error {
+	tenant := b.tenant(key)
+	if tenant == "" {
+		return nil
+	}
+	prev, err := b.Backend.Get(key)
+	if err != nil {
+		return err
+	}
+	changes.add(tenant, valueUsage(key, prev), valueUsage(key, incremented(prev, n)))
+	return nil
+}
+
+// hset adds the change in usage caused by setting a hash field. If value is nil, the field is
+// being deleted.
+func (b *Backend) hset(changes usageChanges, key, field string, value *string) error {
+	tenant := b.tenant(key)
+	if tenant == "" {
+		return nil
+	}
+	prev, err := b.Backend.HGet(key, field)
+	if err != nil {
+		return err
+	}
+	changes.add(tenant, fieldUsage(field, prev), fieldUsage(field, value))
+	return nil
+}
+
+// check returns an error if the changes would take any tenant over its limit.
+func (b *Backend) check(changes usageChanges) error {
+	if b.Limit == nil {
+		return nil
+	}
+	for tenant, change := range changes {
+		if change.Keys <= 0 && change.Bytes <= 0 {
+			continue
+		}
+		limit := b.Limit(tenant)
+		if limit == (Usage{}) {
+			continue
+		}
+		usage, err := b.Usage(tenant)
+		if err != nil {
+			return err
+		}
+		if next := usage.add(change); next.exceeds(limit) {
+			return &QuotaExceededError{
+				Tenant: tenant,
+				Usage:  next,
+				Limit:  limit,
+			}
+		}
+	}
+	return nil
+}
+
+// record applies the changes to the usage counters.
+func (b *Backend) record(changes usageChanges) error {
+	for tenant, change := range changes {
+		keysKey, bytesKey := b.counterKeys(tenant)
+		if change.Keys != 0 {
+			if _, err := b.Backend.NIncrBy(keysKey, change.Keys); err != nil {
+				return err
+			}
+		}
+		if change.Bytes != 0 {
+			if _, err := b.Backend.NIncrBy(bytesKey, change.Bytes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// write performs a write whose effect on usage is determined by changes. If f reports that the
+// write wasn't applied, usage is left unchanged.
+func (b *Backend) write(changes func(usageChanges) error, f func() (bool, error)) (bool, error) {
+	c := usageChanges{}
+	if err := changes(c); err != nil {
+		return false, err
+	} else if err := b.check(c); err != nil {
+		return false, err
+	}
+	ok, err := f()
+	if err != nil || !ok {
+		return ok, err
+	}
+	return true, b.record(c)
+}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return &atomicWriteOperation{
+		AtomicWriteOperation: b.Backend.AtomicWrite(),
+		backend:              b,
+	}
+}
+
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	return &batchOperation{
+		BatchOperation: b.Backend.Batch(),
+		backend:        b,
+	}
+}
+
+func (b *Backend) Ping() error {
+	return b.Backend.Ping()
+}
+
+func (b *Backend) Close() error {
+	return b.Backend.Close()
+}
+
+func (b *Backend) Delete(key string) (bool, error) {
+	return b.write(func(c usageChanges) error {
+		return b.set(c, key, nil)
+	}, func() (bool, error) {
+		return b.Backend.Delete(key)
+	})
+}
+
+func (b *Backend) Get(key string) (*string, error) {
+	return b.Backend.Get(key)
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	_, err := b.write(func(c usageChanges) error {
+		return b.set(c, key, keyvaluestore.ToString(value))
+	}, func() (bool, error) {
+		return true, b.Backend.Set(key, value)
+	})
+	return err
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	return b.write(func(c usageChanges) error {
+		return b.set(c, key, keyvaluestore.ToString(value))
+	}, func() (bool, error) {
+		return b.Backend.SetXX(key, value)
+	})
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	return b.write(func(c usageChanges) error {
+		return b.set(c, key, keyvaluestore.ToString(value))
+	}, func() (bool, error) {
+		return b.Backend.SetNX(key, value)
+	})
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	return b.write(func(c usageChanges) error {
+		return b.set(c, key, keyvaluestore.ToString(value))
+	}, func() (bool, error) {
+		return b.Backend.SetEQ(key, value, oldValue)
+	})
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	var ret int64
+	_, err := b.write(func(c usageChanges) error {
+		return b.incr(c, key, n)
+	}, func() (bool, error) {
+		var err error
+		ret, err = b.Backend.NIncrBy(key, n)
+		return err == nil, err
+	})
+	return ret, err
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	_, err := b.write(func(c usageChanges) error {
+		if err := b.hset(c, key, field, keyvaluestore.ToString(value)); err != nil {
+			return err
+		}
+		for _, kv := range fields {
+			if err := b.hset(c, key, kv.Key, keyvaluestore.ToString(kv.Value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func() (bool, error) {
+		return true, b.Backend.HSet(key, field, value, fields...)
+	})
+	return err
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	_, err := b.write(func(c usageChanges) error {
+		for _, field := range append([]string{field}, fields...) {
+			if err := b.hset(c, key, field, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func() (bool, error) {
+		return true, b.Backend.HDel(key, field, fields...)
+	})
+	return err
+}
+
+func (b *Backend) HGet(key, field string) (*string, error) {
+	return b.Backend.HGet(key, field)
+}
+
+func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	return b.Backend.HGetAll(key)
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	return b.Backend.SAdd(key, member, members...)
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	return b.Backend.SRem(key, member, members...)
+}
+
+func (b *Backend) SMembers(key string) ([]string, error) {
+	return b.Backend.SMembers(key)
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
+	return b.Backend.ZAdd(key, member, score)
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	return b.Backend.ZScore(key, member)
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	return b.Backend.ZRem(key, member)
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	return b.Backend.ZIncrBy(key, member, n)
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	return b.Backend.ZCount(key, min, max)
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
+	return b.Backend.ZLexCount(key, min, max)
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	return b.Backend.ZHAdd(key, field, member, score)
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	return b.Backend.ZHMAdd(key, entries)
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	return b.Backend.ZHRem(key, field)
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	return b.Backend.ZHRemEQ(key, field, member)
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZHRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZHRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZHRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZHRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZHRevRangeByLex(key, min, max, limit)
+}
+
+func (b Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	b.Backend = b.Backend.WithProfiler(profiler)
+	return &b
+}
+
+func (b Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	b.Backend = b.Backend.WithEventuallyConsistentReads()
+	return &b
+}
+
+func (b Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	b.Backend = keyvaluestore.WithOptions(b.Backend, opts)
+	return &b
+}
+
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return b.Backend
+}
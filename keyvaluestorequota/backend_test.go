@@ -0,0 +1,185 @@
+package keyvaluestorequota
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return &Backend{
+			Backend: memorystore.NewBackend(),
+			Tenant: func(key string) string {
+				return "tenant"
+			},
+		}
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return &Backend{
+			Backend: b,
+			Tenant: func(key string) string {
+				return "tenant"
+			},
+		}
+	}, keyvaluestoretest.WrapperOptions{
+		// Reads, sets, and sorted sets don't affect usage.
+		Inherited: []string{
+			"Batch.Get", "Batch.SMembers", "Batch.SAdd", "Batch.SRem", "Batch.ZAdd", "Batch.ZRem",
+			"Batch.ZScore", "Batch.ZHMAdd", "Batch.ZHRangeByScore", "Batch.ZHRevRangeByScore",
+			"Batch.ZHRangeByLex", "Batch.ZHRevRangeByLex",
+			"AtomicWrite.SAdd", "AtomicWrite.SRem", "AtomicWrite.ZAdd", "AtomicWrite.ZAddNX",
+			"AtomicWrite.ZRem", "AtomicWrite.ZHAdd", "AtomicWrite.ZHMAdd", "AtomicWrite.ZHSetEQ",
+			"AtomicWrite.ZHRem", "AtomicWrite.ZHRemEQ",
+		},
+	})
+}
+
+func TestUsage(t *testing.T) {
+	b := &Backend{
+		Backend: memorystore.NewBackend(),
+		Tenant:  SeparatorTenant(":"),
+	}
+
+	assertUsage := func(tenant string, keys, bytes int64) {
+		t.Helper()
+		usage, err := b.Usage(tenant)
+		require.NoError(t, err)
+		assert.Equal(t, Usage{Keys: keys, Bytes: bytes}, usage)
+	}
+
+	require.NoError(t, b.Set("a:foo", "bar"))
+	assertUsage("a", 1, 8)
+
+	require.NoError(t, b.Set("a:foo", "barbaz"))
+	assertUsage("a", 1, 11)
+
+	ok, err := b.SetNX("a:foo", "x")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assertUsage("a", 1, 11)
+
+	_, err = b.NIncrBy("b:n", 10)
+	require.NoError(t, err)
+	assertUsage("b", 1, 5)
+	assertUsage("a", 1, 11)
+
+	require.NoError(t, b.HSet("a:h", "f", "v", keyvaluestore.KeyValue{Key: "g", Value: "w"}))
+	assertUsage("a", 1, 15)
+
+	require.NoError(t, b.HDel("a:h", "f"))
+	assertUsage("a", 1, 13)
+
+	ok, err = b.Delete("a:foo")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assertUsage("a", 0, 2)
+
+	ok, err = b.Delete("a:h")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assertUsage("a", 0, 0)
+
+	tx := b.AtomicWrite()
+	tx.Set("a:x", "1234")
+	tx.HSet("a:y", "f", "v")
+	ok, err = tx.Exec()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assertUsage("a", 1, 9)
+
+	tx = b.AtomicWrite()
+	tx.Set("a:z", "1234")
+	tx.SetNX("a:x", "1234")
+	ok, err = tx.Exec()
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assertUsage("a", 1, 9)
+
+	batch := b.Batch()
+	batch.Set("a:z", "1234")
+	batch.Delete("a:x")
+	require.NoError(t, batch.Exec())
+	assertUsage("a", 1, 9)
+
+	// Untracked keys don't count towards any tenant.
+	require.NoError(t, b.Set("untracked", "foo"))
+	assertUsage("", 0, 0)
+}
+
+func TestLimit(t *testing.T) {
+	b := &Backend{
+		Backend: memorystore.NewBackend(),
+		Tenant:  SeparatorTenant(":"),
+		Limit: func(tenant string) Usage {
+			if tenant == "a" {
+				return Usage{Keys: 2}
+			}
+			return Usage{}
+		},
+	}
+
+	require.NoError(t, b.Set("a:foo", "bar"))
+	require.NoError(t, b.Set("a:bar", "bar"))
+	require.NoError(t, b.Set("a:bar", "baz"))
+
+	var quotaErr *QuotaExceededError
+	require.True(t, errors.As(b.Set("a:baz", "bar"), &quotaErr))
+	assert.Equal(t, "a", quotaErr.Tenant)
+	assert.EqualValues(t, 3, quotaErr.Usage.Keys)
+
+	v, err := b.Get("a:baz")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	batch := b.Batch()
+	set := batch.Set("a:baz", "bar")
+	assert.True(t, errors.As(batch.Exec(), &quotaErr))
+	assert.True(t, errors.As(set.Result(), &quotaErr))
+
+	// Writes that reduce usage are always allowed.
+	_, err = b.Delete("a:foo")
+	require.NoError(t, err)
+	require.NoError(t, b.Set("a:baz", "bar"))
+	require.NoError(t, b.Set("b:foo", "bar"))
+}
+
+func TestRecompute(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	b := &Backend{
+		Backend: underlying,
+		Tenant:  SeparatorTenant(":"),
+	}
+
+	require.NoError(t, b.Set("a:foo", "bar"))
+	require.NoError(t, b.Set("b:foo", "bar"))
+
+	// Writes that bypass the backend cause drift.
+	require.NoError(t, underlying.Set("a:bar", "baz"))
+	require.NoError(t, underlying.HSet("a:h", "f", "v"))
+	_, err := underlying.Delete("b:foo")
+	require.NoError(t, err)
+
+	usage, err := b.Recompute(1)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Usage{
+		"a": {Keys: 2, Bytes: 18},
+		"b": {},
+	}, usage)
+
+	usage2, err := b.Usage("a")
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Keys: 2, Bytes: 18}, usage2)
+	usage2, err = b.Usage("b")
+	require.NoError(t, err)
+	assert.Equal(t, Usage{}, usage2)
+}
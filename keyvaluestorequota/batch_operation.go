@@ -0,0 +1,67 @@
+package keyvaluestorequota
+
+import "github.com/ccbrown/keyvaluestore"
+
+type batchOperation struct {
+	keyvaluestore.BatchOperation
+	backend *Backend
+
+	// changes determine the change in usage caused by each tracked operation. They're invoked
+	// immediately before the batch is executed.
+	changes []func(usageChanges) error
+
+	// err is set if the batch was rejected without being executed.
+	err error
+}
+
+type errorResult struct {
+	op     *batchOperation
+	result keyvaluestore.ErrorResult
+}
+
+func (r *errorResult) Result() error {
+	if r.op.err != nil {
+		return r.op.err
+	}
+	return r.result.Result()
+}
+
+func (op *batchOperation) Set(key string, value interface{}) keyvaluestore.ErrorResult {
+	op.changes = append(op.changes, func(c usageChanges) error {
+		return op.backend.set(c, key, keyvaluestore.ToString(value))
+	})
+	return &errorResult{
+		op:     op,
+		result: op.BatchOperation.Set(key, value),
+	}
+}
+
+func (op *batchOperation) Delete(key string) keyvaluestore.ErrorResult {
+	op.changes = append(op.changes, func(c usageChanges) error {
+		return op.backend.set(c, key, nil)
+	})
+	return &errorResult{
+		op:     op,
+		result: op.BatchOperation.Delete(key),
+	}
+}
+
+func (op *batchOperation) Exec() error {
+	executed := false
+	_, err := op.backend.write(func(c usageChanges) error {
+		for _, f := range op.changes {
+			if err := f(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func() (bool, error) {
+		executed = true
+		err := op.BatchOperation.Exec()
+		return err == nil, err
+	})
+	if !executed {
+		op.err = err
+	}
+	return err
+}
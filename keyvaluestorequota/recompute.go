@@ -0,0 +1,76 @@
+package keyvaluestorequota
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// DefaultRecomputePageSize is the number of entries requested at a time by Recompute if no page size
+// is given.
+const DefaultRecomputePageSize = 1000
+
+// Recompute scans the underlying backend, which must implement keyvaluestore.Scanner, and
+// overwrites the usage counters with the tenants' actual usage. This corrects any drift caused by
+// concurrent writes or partially failed batches. Counters of tenants that no longer have any data
+// are reset to zero. The recomputed usage is returned.
+//
+// Writes made while the scan is in progress may be counted twice or not at all, so it's best run
+// periodically during quiet periods, e.g. by a janitor.
+func (b *Backend) Recompute(pageSize int) (map[string]Usage, error) {
+	scanner, ok := b.Backend.(keyvaluestore.Scanner)
+	if !ok {
+		return nil, fmt.Errorf("backend does not support scanning: %T: %w", b.Backend, keyvaluestore.ErrNotSupported)
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultRecomputePageSize
+	}
+
+	usage := map[string]Usage{}
+	counterPrefix := b.counterPrefix()
+	cursor := ""
+	for {
+		entries, next, err := scanner.Scan(cursor, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Key, counterPrefix) {
+				// Make sure that tenants with stale counters are reset.
+				tenant := strings.TrimPrefix(entry.Key, counterPrefix)
+				tenant = strings.TrimSuffix(strings.TrimSuffix(tenant, keysCounterSuffix), bytesCounterSuffix)
+				usage[tenant] = usage[tenant]
+				continue
+			}
+			tenant := b.tenant(entry.Key)
+			if tenant == "" {
+				continue
+			}
+			switch entry.Type {
+			case keyvaluestore.EntryTypeString:
+				usage[tenant] = usage[tenant].add(valueUsage(entry.Key, &entry.Value))
+			case keyvaluestore.EntryTypeHash:
+				for field, v := range entry.Fields {
+					v := v
+					usage[tenant] = usage[tenant].add(fieldUsage(field, &v))
+				}
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	for tenant, u := range usage {
+		keysKey, bytesKey := b.counterKeys(tenant)
+		tx := b.Backend.AtomicWrite()
+		tx.Set(keysKey, u.Keys)
+		tx.Set(bytesKey, u.Bytes)
+		if _, err := tx.Exec(); err != nil {
+			return nil, err
+		}
+	}
+	return usage, nil
+}
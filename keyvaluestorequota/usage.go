@@ -0,0 +1,95 @@
+package keyvaluestorequota
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Usage describes the data stored by a tenant.
+type Usage struct {
+	// Keys is the number of keys holding plain values, i.e. values written by Set or NIncrBy.
+	Keys int64
+
+	// Bytes estimates the size of the tenant's data. Each plain value counts as the combined length
+	// of its key and value, and each hash field as the combined length of its name and value.
+	Bytes int64
+}
+
+func (u Usage) add(other Usage) Usage {
+	return Usage{
+		Keys:  u.Keys + other.Keys,
+		Bytes: u.Bytes + other.Bytes,
+	}
+}
+
+// exceeds returns true if u is over the given limit. Zero limits are unlimited.
+func (u Usage) exceeds(limit Usage) bool {
+	return (limit.Keys > 0 && u.Keys > limit.Keys) || (limit.Bytes > 0 && u.Bytes > limit.Bytes)
+}
+
+// QuotaExceededError is returned when a write would take a tenant over its limit.
+type QuotaExceededError struct {
+	Tenant string
+
+	// Usage is what the tenant's usage would have been after the write.
+	Usage Usage
+	Limit Usage
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for tenant %v: %v keys and %v bytes would exceed the limit of %v keys and %v bytes", e.Tenant, e.Usage.Keys, e.Usage.Bytes, e.Limit.Keys, e.Limit.Bytes)
+}
+
+// SeparatorTenant returns a function for Backend.Tenant that uses everything up to the first
+// occurrence of sep as the tenant. Keys that don't contain sep aren't tracked.
+func SeparatorTenant(sep string) func(key string) string {
+	return func(key string) string {
+		if i := strings.Index(key, sep); i > 0 {
+			return key[:i]
+		}
+		return ""
+	}
+}
+
+// usageChanges accumulates the changes in usage caused by a write, keyed by tenant.
+type usageChanges map[string]Usage
+
+func valueUsage(key string, value *string) Usage {
+	if value == nil {
+		return Usage{}
+	}
+	return Usage{
+		Keys:  1,
+		Bytes: int64(len(key) + len(*value)),
+	}
+}
+
+func fieldUsage(field string, value *string) Usage {
+	if value == nil {
+		return Usage{}
+	}
+	return Usage{
+		Bytes: int64(len(field) + len(*value)),
+	}
+}
+
+func (c usageChanges) add(tenant string, prev, next Usage) {
+	if tenant == "" {
+		return
+	}
+	c[tenant] = c[tenant].add(Usage{
+		Keys:  next.Keys - prev.Keys,
+		Bytes: next.Bytes - prev.Bytes,
+	})
+}
+
+// incremented returns the value stored by NIncrBy given the previous value.
+func incremented(prev *string, n int64) *string {
+	var v int64
+	if prev != nil {
+		v, _ = strconv.ParseInt(*prev, 10, 64)
+	}
+	s := strconv.FormatInt(v+n, 10)
+	return &s
+}
@@ -0,0 +1,69 @@
+// Package keyvaluestoreratelimit implements rate limiters on top of any backend.
+//
+// Each limiter stores its state for a given key in a single string value, which is updated via
+// keyvaluestore.Update. Backends that implement keyvaluestore.Updater (memorystore, redisstore, and
+// foundationdbstore) update it transactionally. Others fall back to optimistic updates.
+package keyvaluestoreratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Result describes the outcome of a request to a limiter.
+type Result struct {
+	// Allowed is true if the request is allowed and has been counted against the quota.
+	Allowed bool
+
+	// Remaining is the quota remaining after the request.
+	Remaining int64
+
+	// RetryAfter is how long the caller should wait before the same request would be allowed. It's
+	// zero if the request was allowed or if it can never be allowed because it exceeds the limit.
+	RetryAfter time.Duration
+}
+
+// Limiter is implemented by the rate limiters in this package.
+type Limiter interface {
+	// Allow is shorthand for AllowN(key, 1).
+	Allow(key string) (*Result, error)
+
+	// AllowN reports whether n units may be consumed for the given key at this time, and consumes
+	// them if so.
+	AllowN(key string, n int64) (*Result, error)
+}
+
+func formatState(values ...float64) *string {
+	k := make(keyvaluestore.Key, len(values))
+	for i, v := range values {
+		k[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	s := k.String()
+	return &s
+}
+
+func parseState(s *string, n int) ([]float64, error) {
+	if s == nil {
+		return nil, nil
+	}
+	k, err := keyvaluestore.ParseKey(*s)
+	if err != nil {
+		return nil, err
+	} else if len(k) != n {
+		return nil, fmt.Errorf("malformed rate limiter state: %q", *s)
+	}
+	ret := make([]float64, n)
+	for i, component := range k {
+		if ret[i], err = strconv.ParseFloat(component, 64); err != nil {
+			return nil, fmt.Errorf("malformed rate limiter state: %w", err)
+		}
+	}
+	return ret, nil
+}
+
+func durationFromSeconds(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
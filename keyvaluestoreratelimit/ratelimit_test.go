@@ -0,0 +1,115 @@
+package keyvaluestoreratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestClock() *testClock {
+	return &testClock{
+		// Start at the beginning of a minute so that sliding windows are easy to reason about.
+		now: time.Unix(1600000020, 0),
+	}
+}
+
+func allow(t *testing.T, l Limiter, key string, n int64) *Result {
+	result, err := l.AllowN(key, n)
+	require.NoError(t, err)
+	return result
+}
+
+// optimisticBackend hides the underlying backend's keyvaluestore.Updater implementation.
+type optimisticBackend struct {
+	keyvaluestore.Backend
+}
+
+// backends returns a backend that implements keyvaluestore.Updater and one that doesn't.
+func backends() map[string]keyvaluestore.Backend {
+	return map[string]keyvaluestore.Backend{
+		"Updater":    memorystore.NewBackend(),
+		"Optimistic": optimisticBackend{memorystore.NewBackend()},
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	for name, b := range backends() {
+		t.Run(name, func(t *testing.T) {
+			clock := newTestClock()
+			l := &TokenBucket{
+				Backend:  b,
+				Capacity: 10,
+				Rate:     2,
+				Clock:    clock,
+			}
+
+			assert.Equal(t, &Result{Allowed: true, Remaining: 9}, allow(t, l, "foo", 1))
+			assert.Equal(t, &Result{Allowed: true, Remaining: 0}, allow(t, l, "foo", 9))
+			assert.Equal(t, &Result{RetryAfter: 500 * time.Millisecond}, allow(t, l, "foo", 1))
+
+			// Keys are limited independently.
+			assert.Equal(t, &Result{Allowed: true, Remaining: 9}, allow(t, l, "bar", 1))
+
+			clock.Advance(time.Second)
+			assert.Equal(t, &Result{Allowed: true, Remaining: 1}, allow(t, l, "foo", 1))
+			assert.Equal(t, &Result{Remaining: 1, RetryAfter: time.Second}, allow(t, l, "foo", 3))
+
+			// The bucket doesn't fill beyond its capacity.
+			clock.Advance(time.Hour)
+			assert.Equal(t, &Result{Allowed: true, Remaining: 0}, allow(t, l, "foo", 10))
+
+			// Requests larger than the capacity can never be allowed.
+			clock.Advance(time.Hour)
+			assert.Equal(t, &Result{Remaining: 10}, allow(t, l, "foo", 11))
+		})
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	for name, b := range backends() {
+		t.Run(name, func(t *testing.T) {
+			clock := newTestClock()
+			l := &SlidingWindow{
+				Backend: b,
+				Limit:   10,
+				Window:  time.Minute,
+				Clock:   clock,
+			}
+
+			clock.Advance(30 * time.Second)
+			assert.Equal(t, &Result{Allowed: true, Remaining: 0}, allow(t, l, "foo", 10))
+			assert.Equal(t, &Result{RetryAfter: 54 * time.Second}, allow(t, l, "foo", 4))
+
+			// Keys are limited independently.
+			assert.Equal(t, &Result{Allowed: true, Remaining: 9}, allow(t, l, "bar", 1))
+
+			// Halfway through the next window, half of the previous window's count remains.
+			clock.Advance(time.Minute)
+			assert.Equal(t, &Result{Allowed: true, Remaining: 1}, allow(t, l, "foo", 4))
+			assert.Equal(t, &Result{Remaining: 1, RetryAfter: 6 * time.Second}, allow(t, l, "foo", 2))
+
+			// After two windows, everything has slid out.
+			clock.Advance(2 * time.Minute)
+			assert.Equal(t, &Result{Allowed: true, Remaining: 0}, allow(t, l, "foo", 10))
+
+			assert.Equal(t, &Result{Remaining: 0}, allow(t, l, "foo", 11))
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package keyvaluestoreratelimit
+
+import (
+	"math"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// SlidingWindow allows up to Limit units within any period of length Window. It approximates the
+// sliding window by weighting the previous fixed window's count by how much of it still overlaps
+// the sliding window, which only requires two counters per key.
+type SlidingWindow struct {
+	Backend keyvaluestore.Backend
+	Limit   int64
+	Window  time.Duration
+
+	// Clock is used to get the current time. If nil, the wall clock is used.
+	Clock keyvaluestore.Clock
+}
+
+var _ Limiter = (*SlidingWindow)(nil)
+
+func (l *SlidingWindow) Allow(key string) (*Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN implements Limiter. The counts for the current and previous windows are stored as the
+// key's value.
+func (l *SlidingWindow) AllowN(key string, n int64) (*Result, error) {
+	var result *Result
+	err := keyvaluestore.Update(l.Backend, key, func(prev *string) (*string, error) {
+		state, err := parseState(prev, 3)
+		if err != nil {
+			return nil, err
+		}
+
+		now := keyvaluestore.Now(l.Clock)
+		windowIndex := now.UnixNano() / int64(l.Window)
+		windowStart := time.Unix(0, windowIndex*int64(l.Window))
+		var previous, current float64
+		if state != nil {
+			switch int64(state[0]) {
+			case windowIndex:
+				previous, current = state[1], state[2]
+			case windowIndex - 1:
+				previous = state[2]
+			}
+		}
+
+		// The fraction of the previous window that still overlaps the sliding window.
+		elapsed := float64(now.Sub(windowStart)) / float64(l.Window)
+		weight := 1 - elapsed
+		count := previous*weight + current
+		limit := float64(l.Limit)
+
+		result = &Result{}
+		if count+float64(n) <= limit {
+			current += float64(n)
+			count += float64(n)
+			result.Allowed = true
+		} else if n <= l.Limit {
+			result.RetryAfter = l.retryAfter(now, windowStart, previous, current, n)
+		}
+		result.Remaining = int64(math.Max(0, math.Floor(limit-count)))
+
+		if !result.Allowed {
+			return nil, nil
+		}
+		return formatState(float64(windowIndex), previous, current), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// retryAfter returns the time until a request for n units would be allowed, assuming no other
+// requests are made in the meantime.
+func (l *SlidingWindow) retryAfter(now, windowStart time.Time, previous, current float64, n int64) time.Duration {
+	available := float64(l.Limit - n)
+	window := float64(l.Window)
+	var at time.Time
+	if current <= available {
+		// The request will be allowed within the current window once enough of the previous one
+		// has slid out.
+		at = windowStart.Add(time.Duration(window * (1 - (available-current)/previous)))
+	} else {
+		// The request will be allowed in the next window once enough of the current one has slid
+		// out.
+		at = windowStart.Add(l.Window).Add(time.Duration(window * (1 - available/current)))
+	}
+	if d := at.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
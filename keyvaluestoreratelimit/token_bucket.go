@@ -0,0 +1,60 @@
+package keyvaluestoreratelimit
+
+import (
+	"math"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// TokenBucket allows bursts of up to Capacity units, refilling at Rate units per second.
+type TokenBucket struct {
+	Backend  keyvaluestore.Backend
+	Capacity int64
+	Rate     float64
+
+	// Clock is used to get the current time. If nil, the wall clock is used.
+	Clock keyvaluestore.Clock
+}
+
+var _ Limiter = (*TokenBucket)(nil)
+
+func (l *TokenBucket) Allow(key string) (*Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN implements Limiter. The bucket's state is stored as the key's value.
+func (l *TokenBucket) AllowN(key string, n int64) (*Result, error) {
+	var result *Result
+	err := keyvaluestore.Update(l.Backend, key, func(prev *string) (*string, error) {
+		state, err := parseState(prev, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		now := float64(keyvaluestore.Now(l.Clock).UnixNano()) / float64(time.Second)
+		capacity := float64(l.Capacity)
+		tokens := capacity
+		if state != nil {
+			tokens = math.Min(capacity, state[0]+(now-state[1])*l.Rate)
+		}
+
+		result = &Result{}
+		if float64(n) <= tokens {
+			tokens -= float64(n)
+			result.Allowed = true
+		} else if n <= l.Capacity && l.Rate > 0 {
+			result.RetryAfter = durationFromSeconds((float64(n) - tokens) / l.Rate)
+		}
+		result.Remaining = int64(math.Floor(tokens))
+
+		if !result.Allowed {
+			return nil, nil
+		}
+		return formatState(tokens, now), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,94 @@
+// Package keyvaluestoreregistry implements a registry of live process instances on top of sorted
+// sets, e.g. for worker discovery or for janitor processes that need to know which of their peers
+// are alive.
+package keyvaluestoreregistry
+
+import (
+	"math"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Registry tracks instances via leases. Each instance registers itself with a TTL and must send
+// heartbeats before its lease expires to remain alive.
+//
+// Instances are stored in the sorted set at Key, scored by the time at which their leases expire.
+type Registry struct {
+	Backend keyvaluestore.Backend
+	Key     string
+
+	// Clock is used to get the current time. If nil, the wall clock is used.
+	Clock keyvaluestore.Clock
+}
+
+func (r *Registry) currentTime() time.Time {
+	return keyvaluestore.Now(r.Clock)
+}
+
+func score(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// Register adds the instance to the registry, or renews its lease if it's already registered. The
+// instance is considered alive until ttl elapses.
+func (r *Registry) Register(instanceID string, ttl time.Duration) error {
+	return r.Backend.ZAdd(r.Key, instanceID, score(r.currentTime().Add(ttl)))
+}
+
+// Heartbeat renews the instance's lease. If the lease has already expired or the instance was
+// deregistered, false is returned and the instance isn't renewed. Peers may have already acted on
+// its absence, so the instance should re-register via Register once it's ready to do so.
+//
+// A heartbeat that races with RemoveExpired may renew an instance that's being removed, in which
+// case the instance is removed anyway and the next heartbeat returns false.
+func (r *Registry) Heartbeat(instanceID string, ttl time.Duration) (bool, error) {
+	now := r.currentTime()
+	expiration, err := r.Backend.ZScore(r.Key, instanceID)
+	if err != nil {
+		return false, err
+	} else if expiration == nil || *expiration <= score(now) {
+		return false, nil
+	}
+	if err := r.Backend.ZAdd(r.Key, instanceID, score(now.Add(ttl))); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Deregister removes the instance from the registry.
+func (r *Registry) Deregister(instanceID string) error {
+	return r.Backend.ZRem(r.Key, instanceID)
+}
+
+// ListAlive returns the ids of the instances whose leases haven't expired.
+func (r *Registry) ListAlive() ([]string, error) {
+	now := score(r.currentTime())
+	members, err := r.Backend.ZRangeByScoreWithScores(r.Key, now, math.Inf(1), 0)
+	if err != nil {
+		return nil, err
+	}
+	// The range is inclusive, but leases that expire exactly now have expired.
+	ret := make([]string, 0, len(members))
+	for _, m := range members {
+		if m.Score > now {
+			ret = append(ret, m.Value)
+		}
+	}
+	return ret, nil
+}
+
+// RemoveExpired removes up to limit instances whose leases have expired and returns their ids. If
+// limit is zero, all of them are removed. It's typically invoked periodically by a janitor process.
+func (r *Registry) RemoveExpired(limit int) ([]string, error) {
+	expired, err := r.Backend.ZRangeByScore(r.Key, math.Inf(-1), score(r.currentTime()), limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range expired {
+		if err := r.Backend.ZRem(r.Key, id); err != nil {
+			return nil, err
+		}
+	}
+	return expired, nil
+}
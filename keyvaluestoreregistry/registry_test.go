@@ -0,0 +1,63 @@
+package keyvaluestoreregistry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestRegistry(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	r := &Registry{
+		Backend: memorystore.NewBackend(),
+		Key:     "workers",
+		Clock: keyvaluestore.ClockFunc(func() time.Time {
+			return now
+		}),
+	}
+
+	require.NoError(t, r.Register("a", time.Minute))
+	require.NoError(t, r.Register("b", 2*time.Minute))
+
+	alive, err := r.ListAlive()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, alive)
+
+	now = now.Add(90 * time.Second)
+
+	alive, err = r.ListAlive()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, alive)
+
+	ok, err := r.Heartbeat("a", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = r.Heartbeat("b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	now = now.Add(45 * time.Second)
+
+	alive, err = r.ListAlive()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, alive)
+
+	expired, err := r.RemoveExpired(0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, expired)
+
+	require.NoError(t, r.Deregister("b"))
+	ok, err = r.Heartbeat("b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	alive, err = r.ListAlive()
+	require.NoError(t, err)
+	assert.Empty(t, alive)
+}
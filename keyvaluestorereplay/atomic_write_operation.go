@@ -0,0 +1,192 @@
+package keyvaluestorereplay
+
+import (
+	"fmt"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+type atomicWriteOperation struct {
+	backend *Backend
+
+	// atomicWrite is nil if we're replaying.
+	atomicWrite keyvaluestore.AtomicWriteOperation
+
+	// args describes all of the operations so that the atomic write can be recorded as one call.
+	args    []string
+	results []*atomicWriteResult
+}
+
+type atomicWriteResult struct {
+	result            keyvaluestore.AtomicWriteResult
+	conditionalFailed bool
+}
+
+func (r *atomicWriteResult) ConditionalFailed() bool {
+	return r.conditionalFailed
+}
+
+func (op *atomicWriteOperation) add(method string, args []string, f func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult) keyvaluestore.AtomicWriteResult {
+	op.args = append(append(op.args, method), args...)
+	r := &atomicWriteResult{}
+	if op.atomicWrite != nil {
+		r.result = f(op.atomicWrite)
+	}
+	op.results = append(op.results, r)
+	return r
+}
+
+func (op *atomicWriteOperation) Set(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return op.add("Set", formatArgs(key, value), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.Set(key, value)
+	})
+}
+
+func (op *atomicWriteOperation) SetNX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return op.add("SetNX", formatArgs(key, value), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.SetNX(key, value)
+	})
+}
+
+func (op *atomicWriteOperation) SetXX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return op.add("SetXX", formatArgs(key, value), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.SetXX(key, value)
+	})
+}
+
+func (op *atomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
+	return op.add("SetEQ", formatArgs(key, value, oldValue), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.SetEQ(key, value, oldValue)
+	})
+}
+
+func (op *atomicWriteOperation) Delete(key string) keyvaluestore.AtomicWriteResult {
+	return op.add("Delete", formatArgs(key), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.Delete(key)
+	})
+}
+
+func (op *atomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteResult {
+	return op.add("DeleteXX", formatArgs(key), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.DeleteXX(key)
+	})
+}
+
+func (op *atomicWriteOperation) NIncrBy(key string, n int64) keyvaluestore.AtomicWriteResult {
+	return op.add("NIncrBy", formatArgs(key, n), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.NIncrBy(key, n)
+	})
+}
+
+func (op *atomicWriteOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.add("ZAdd", formatArgs(key, member, score), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZAdd(key, member, score)
+	})
+}
+
+func (op *atomicWriteOperation) ZAddNX(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.add("ZAddNX", formatArgs(key, member, score), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZAddNX(key, member, score)
+	})
+}
+
+func (op *atomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.add("ZHSetEQ", formatArgs(key, field, member, oldMember, score), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZHSetEQ(key, field, member, oldMember, score)
+	})
+}
+
+func (op *atomicWriteOperation) ZRem(key string, member interface{}) keyvaluestore.AtomicWriteResult {
+	return op.add("ZRem", formatArgs(key, member), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZRem(key, member)
+	})
+}
+
+func (op *atomicWriteOperation) ZHAdd(key, field string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.add("ZHAdd", formatArgs(key, field, member, score), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZHAdd(key, field, member, score)
+	})
+}
+
+func (op *atomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	return op.add("ZHMAdd", formatArgs(key, entries), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZHMAdd(key, entries)
+	})
+}
+
+func (op *atomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWriteResult {
+	return op.add("ZHRem", formatArgs(key, field), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZHRem(key, field)
+	})
+}
+
+func (op *atomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	return op.add("ZHRemEQ", formatArgs(key, field, member), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZHRemEQ(key, field, member)
+	})
+}
+
+func (op *atomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	return op.add("SAdd", formatArgs(key, member, members), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.SAdd(key, member, members...)
+	})
+}
+
+func (op *atomicWriteOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	return op.add("SRem", formatArgs(key, member, members), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.SRem(key, member, members...)
+	})
+}
+
+func (op *atomicWriteOperation) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) keyvaluestore.AtomicWriteResult {
+	return op.add("HSet", formatArgs(key, field, value, fields), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.HSet(key, field, value, fields...)
+	})
+}
+
+func (op *atomicWriteOperation) HSetNX(key, field string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return op.add("HSetNX", formatArgs(key, field, value), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.HSetNX(key, field, value)
+	})
+}
+
+func (op *atomicWriteOperation) HDel(key, field string, fields ...string) keyvaluestore.AtomicWriteResult {
+	return op.add("HDel", formatArgs(key, field, fields), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.HDel(key, field, fields...)
+	})
+}
+
+// WithIdempotencyToken isn't recorded since tokens are typically random.
+func (op *atomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	if op.atomicWrite != nil {
+		op.atomicWrite.WithIdempotencyToken(token)
+	}
+	return op
+}
+
+// Validate isn't recorded. While replaying, only the limits common to all backends are checked.
+func (op *atomicWriteOperation) Validate() error {
+	if op.atomicWrite != nil {
+		return op.atomicWrite.Validate()
+	} else if len(op.results) > keyvaluestore.MaxAtomicWriteOperations {
+		return fmt.Errorf("max operation count exceeded")
+	}
+	return nil
+}
+
+func (op *atomicWriteOperation) Exec() (bool, error) {
+	r := op.backend.invoke("AtomicWrite", op.args, func(r *result) {
+		ok, err := op.atomicWrite.Exec()
+		r.Bool = ok
+		r.setError(err)
+		for _, result := range op.results {
+			r.ConditionalFailed = append(r.ConditionalFailed, result.result.ConditionalFailed())
+		}
+	})
+	for i, failed := range r.ConditionalFailed {
+		if i < len(op.results) {
+			op.results[i].conditionalFailed = failed
+		}
+	}
+	return r.Bool, r.err()
+}
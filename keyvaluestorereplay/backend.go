@@ -0,0 +1,401 @@
+// Package keyvaluestorereplay records the operations performed against a backend so that they can
+// later be replayed without the backend. This makes it possible to run tests of code that normally
+// needs a real store, such as DynamoDB or Redis, quickly and deterministically.
+//
+// To create a recording, wrap a real backend with NewRecorder, run the code, and write the
+// recording with Save. To replay it, pass it to Load and use the returned backend in place of the
+// real one.
+package keyvaluestorereplay
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Backend is either a recorder, which passes calls through to another backend and records them, or
+// a replayer, which returns the results of previously recorded calls.
+type Backend struct {
+	// backend is nil if we're replaying.
+	backend   keyvaluestore.Backend
+	recording *recording
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+
+// NewRecorder creates a backend that records the calls made to the given one.
+func NewRecorder(backend keyvaluestore.Backend) *Backend {
+	return &Backend{
+		backend:   backend,
+		recording: &recording{},
+	}
+}
+
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	return &keyvaluestore.FallbackBatchOperation{
+		Backend: b,
+	}
+}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	op := &atomicWriteOperation{
+		backend: b,
+	}
+	if b.backend != nil {
+		op.atomicWrite = b.backend.AtomicWrite()
+	}
+	return op
+}
+
+// Ping isn't recorded since health checks typically run on their own schedule, which would make
+// recordings nondeterministic. Replayers always succeed.
+func (b *Backend) Ping() error {
+	if b.backend == nil {
+		return nil
+	}
+	return b.backend.Ping()
+}
+
+// Close isn't recorded since recordings usually end before the backend is closed.
+func (b *Backend) Close() error {
+	if b.backend == nil {
+		return nil
+	}
+	return b.backend.Close()
+}
+
+func (b *Backend) Delete(key string) (bool, error) {
+	r := b.invoke("Delete", formatArgs(key), func(r *result) {
+		v, err := b.backend.Delete(key)
+		r.Bool = v
+		r.setError(err)
+	})
+	return r.Bool, r.err()
+}
+
+func (b *Backend) Get(key string) (*string, error) {
+	r := b.invoke("Get", formatArgs(key), func(r *result) {
+		v, err := b.backend.Get(key)
+		r.String = v
+		r.setError(err)
+	})
+	return r.String, r.err()
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	r := b.invoke("Set", formatArgs(key, value), func(r *result) {
+		r.setError(b.backend.Set(key, value))
+	})
+	return r.err()
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	r := b.invoke("SetXX", formatArgs(key, value), func(r *result) {
+		v, err := b.backend.SetXX(key, value)
+		r.Bool = v
+		r.setError(err)
+	})
+	return r.Bool, r.err()
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	r := b.invoke("SetNX", formatArgs(key, value), func(r *result) {
+		v, err := b.backend.SetNX(key, value)
+		r.Bool = v
+		r.setError(err)
+	})
+	return r.Bool, r.err()
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	r := b.invoke("SetEQ", formatArgs(key, value, oldValue), func(r *result) {
+		v, err := b.backend.SetEQ(key, value, oldValue)
+		r.Bool = v
+		r.setError(err)
+	})
+	return r.Bool, r.err()
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	r := b.invoke("NIncrBy", formatArgs(key, n), func(r *result) {
+		v, err := b.backend.NIncrBy(key, n)
+		r.Int = v
+		r.setError(err)
+	})
+	return r.Int, r.err()
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	r := b.invoke("SAdd", formatArgs(key, member, members), func(r *result) {
+		r.setError(b.backend.SAdd(key, member, members...))
+	})
+	return r.err()
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	r := b.invoke("SRem", formatArgs(key, member, members), func(r *result) {
+		r.setError(b.backend.SRem(key, member, members...))
+	})
+	return r.err()
+}
+
+func (b *Backend) SMembers(key string) ([]string, error) {
+	r := b.invoke("SMembers", formatArgs(key), func(r *result) {
+		v, err := b.backend.SMembers(key)
+		r.Strings = v
+		r.setError(err)
+	})
+	return r.Strings, r.err()
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	r := b.invoke("HSet", formatArgs(key, field, value, fields), func(r *result) {
+		r.setError(b.backend.HSet(key, field, value, fields...))
+	})
+	return r.err()
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	r := b.invoke("HDel", formatArgs(key, field, fields), func(r *result) {
+		r.setError(b.backend.HDel(key, field, fields...))
+	})
+	return r.err()
+}
+
+func (b *Backend) HGet(key, field string) (*string, error) {
+	r := b.invoke("HGet", formatArgs(key, field), func(r *result) {
+		v, err := b.backend.HGet(key, field)
+		r.String = v
+		r.setError(err)
+	})
+	return r.String, r.err()
+}
+
+func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	r := b.invoke("HGetAll", formatArgs(key), func(r *result) {
+		v, err := b.backend.HGetAll(key)
+		r.Map = v
+		r.setError(err)
+	})
+	return r.Map, r.err()
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
+	r := b.invoke("ZAdd", formatArgs(key, member, score), func(r *result) {
+		r.setError(b.backend.ZAdd(key, member, score))
+	})
+	return r.err()
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	r := b.invoke("ZScore", formatArgs(key, member), func(r *result) {
+		v, err := b.backend.ZScore(key, member)
+		r.Float = v
+		r.setError(err)
+	})
+	return r.Float, r.err()
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	r := b.invoke("ZRem", formatArgs(key, member), func(r *result) {
+		r.setError(b.backend.ZRem(key, member))
+	})
+	return r.err()
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	r := b.invoke("ZIncrBy", formatArgs(key, member, n), func(r *result) {
+		v, err := b.backend.ZIncrBy(key, member, n)
+		r.Float = &v
+		r.setError(err)
+	})
+	return r.float(), r.err()
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	r := b.invoke("ZRangeByScore", formatArgs(key, min, max, limit), func(r *result) {
+		v, err := b.backend.ZRangeByScore(key, min, max, limit)
+		r.Strings = v
+		r.setError(err)
+	})
+	return r.Strings, r.err()
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	r := b.invoke("ZRangeByScoreWithScores", formatArgs(key, min, max, limit), func(r *result) {
+		v, err := b.backend.ZRangeByScoreWithScores(key, min, max, limit)
+		r.ScoredMembers = v
+		r.setError(err)
+	})
+	return r.ScoredMembers, r.err()
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	r := b.invoke("ZRevRangeByScore", formatArgs(key, min, max, limit), func(r *result) {
+		v, err := b.backend.ZRevRangeByScore(key, min, max, limit)
+		r.Strings = v
+		r.setError(err)
+	})
+	return r.Strings, r.err()
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	r := b.invoke("ZRevRangeByScoreWithScores", formatArgs(key, min, max, limit), func(r *result) {
+		v, err := b.backend.ZRevRangeByScoreWithScores(key, min, max, limit)
+		r.ScoredMembers = v
+		r.setError(err)
+	})
+	return r.ScoredMembers, r.err()
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	r := b.invoke("ZCount", formatArgs(key, min, max), func(r *result) {
+		v, err := b.backend.ZCount(key, min, max)
+		r.Int = int64(v)
+		r.setError(err)
+	})
+	return int(r.Int), r.err()
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
+	r := b.invoke("ZLexCount", formatArgs(key, min, max), func(r *result) {
+		v, err := b.backend.ZLexCount(key, min, max)
+		r.Int = int64(v)
+		r.setError(err)
+	})
+	return int(r.Int), r.err()
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	r := b.invoke("ZRangeByLex", formatArgs(key, min, max, limit), func(r *result) {
+		v, err := b.backend.ZRangeByLex(key, min, max, limit)
+		r.Strings = v
+		r.setError(err)
+	})
+	return r.Strings, r.err()
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	r := b.invoke("ZRevRangeByLex", formatArgs(key, min, max, limit), func(r *result) {
+		v, err := b.backend.ZRevRangeByLex(key, min, max, limit)
+		r.Strings = v
+		r.setError(err)
+	})
+	return r.Strings, r.err()
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	r := b.invoke("ZHAdd", formatArgs(key, field, member, score), func(r *result) {
+		r.setError(b.backend.ZHAdd(key, field, member, score))
+	})
+	return r.err()
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	r := b.invoke("ZHMAdd", formatArgs(key, entries), func(r *result) {
+		r.setError(b.backend.ZHMAdd(key, entries))
+	})
+	return r.err()
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	r := b.invoke("ZHRem", formatArgs(key, field), func(r *result) {
+		r.setError(b.backend.ZHRem(key, field))
+	})
+	return r.err()
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	r := b.invoke("ZHRemEQ", formatArgs(key, field, member), func(r *result) {
+		v, err := b.backend.ZHRemEQ(key, field, member)
+		r.Bool = v
+		r.setError(err)
+	})
+	return r.Bool, r.err()
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	r := b.invoke("ZHRangeByScore", formatArgs(key, min, max, limit), func(r *result) {
+		v, err := b.backend.ZHRangeByScore(key, min, max, limit)
+		r.Strings = v
+		r.setError(err)
+	})
+	return r.Strings, r.err()
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	r := b.invoke("ZHRangeByScoreWithScores", formatArgs(key, min, max, limit), func(r *result) {
+		v, err := b.backend.ZHRangeByScoreWithScores(key, min, max, limit)
+		r.ScoredMembers = v
+		r.setError(err)
+	})
+	return r.ScoredMembers, r.err()
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	r := b.invoke("ZHRevRangeByScore", formatArgs(key, min, max, limit), func(r *result) {
+		v, err := b.backend.ZHRevRangeByScore(key, min, max, limit)
+		r.Strings = v
+		r.setError(err)
+	})
+	return r.Strings, r.err()
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	r := b.invoke("ZHRevRangeByScoreWithScores", formatArgs(key, min, max, limit), func(r *result) {
+		v, err := b.backend.ZHRevRangeByScoreWithScores(key, min, max, limit)
+		r.ScoredMembers = v
+		r.setError(err)
+	})
+	return r.ScoredMembers, r.err()
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	r := b.invoke("ZHRangeByLex", formatArgs(key, min, max, limit), func(r *result) {
+		v, err := b.backend.ZHRangeByLex(key, min, max, limit)
+		r.Strings = v
+		r.setError(err)
+	})
+	return r.Strings, r.err()
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	r := b.invoke("ZHRevRangeByLex", formatArgs(key, min, max, limit), func(r *result) {
+		v, err := b.backend.ZHRevRangeByLex(key, min, max, limit)
+		r.Strings = v
+		r.setError(err)
+	})
+	return r.Strings, r.err()
+}
+
+func (b *Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	if b.backend == nil {
+		return b
+	}
+	return &Backend{
+		backend:   b.backend.WithEventuallyConsistentReads(),
+		recording: b.recording,
+	}
+}
+
+func (b *Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	if b.backend == nil {
+		return b
+	}
+	return &Backend{
+		backend:   keyvaluestore.WithOptions(b.backend, opts),
+		recording: b.recording,
+	}
+}
+
+func (b *Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	if b.backend == nil {
+		return b
+	}
+	return &Backend{
+		backend:   b.backend.WithProfiler(profiler),
+		recording: b.recording,
+	}
+}
+
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return b.backend
+}
@@ -0,0 +1,110 @@
+package keyvaluestorereplay
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return NewRecorder(memorystore.NewBackend())
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return NewRecorder(b)
+	}, keyvaluestoretest.WrapperOptions{})
+}
+
+// exercise makes a deterministic sequence of calls and returns everything it observed.
+func exercise(t *testing.T, b keyvaluestore.Backend) []interface{} {
+	var observed []interface{}
+	observe := func(values ...interface{}) {
+		observed = append(observed, values...)
+	}
+
+	observe(b.Set("foo", "bar"))
+	observe(b.Get("foo"))
+	observe(b.SetNX("foo", "baz"))
+	observe(b.NIncrBy("n", 2))
+	observe(b.SAdd("set", "a", "b"))
+	observe(b.HSet("h", "a", "b", keyvaluestore.KeyValue{Key: "c", Value: 1}))
+	observe(b.HGetAll("h"))
+	observe(b.ZAdd("z", "a", 1))
+	observe(b.ZIncrBy("z", "a", 0.5))
+	observe(b.ZScore("z", "a"))
+	observe(b.ZRangeByScoreWithScores("z", math.Inf(-1), math.Inf(1), 0))
+	observe(b.ZCount("z", 0, 10))
+
+	batch := b.Batch()
+	get := batch.Get("foo")
+	smembers := batch.SMembers("set")
+	require.NoError(t, batch.Exec())
+	observe(get.Result())
+	observe(smembers.Result())
+
+	tx := b.AtomicWrite()
+	set := tx.Set("bar", "baz")
+	setNX := tx.SetNX("foo", "qux")
+	observe(tx.Exec())
+	observe(set.ConditionalFailed(), setNX.ConditionalFailed())
+
+	return observed
+}
+
+func TestReplay(t *testing.T) {
+	recorder := NewRecorder(memorystore.NewBackend())
+	recorded := exercise(t, recorder)
+
+	var buf bytes.Buffer
+	require.NoError(t, recorder.Save(&buf))
+
+	replayer, err := Load(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, recorded, exercise(t, replayer))
+	assert.Equal(t, 0, replayer.Remaining())
+
+	_, err = replayer.Get("foo")
+	assert.True(t, errors.Is(err, ErrUnexpectedCall))
+}
+
+func TestReplayUnexpectedCall(t *testing.T) {
+	recorder := NewRecorder(memorystore.NewBackend())
+	require.NoError(t, recorder.Set("foo", "bar"))
+
+	var buf bytes.Buffer
+	require.NoError(t, recorder.Save(&buf))
+
+	replayer, err := Load(&buf)
+	require.NoError(t, err)
+	assert.True(t, errors.Is(replayer.Set("foo", "baz"), ErrUnexpectedCall))
+	assert.Equal(t, 1, replayer.Remaining())
+	assert.NoError(t, replayer.Set("foo", "bar"))
+}
+
+func TestReplayErrors(t *testing.T) {
+	recorder := NewRecorder(memorystore.NewBackend())
+	require.NoError(t, recorder.Set("foo", "bar"))
+	_, recordErr := recorder.NIncrBy("foo", 1)
+	require.Error(t, recordErr)
+
+	var buf bytes.Buffer
+	require.NoError(t, recorder.Save(&buf))
+
+	replayer, err := Load(&buf)
+	require.NoError(t, err)
+	require.NoError(t, replayer.Set("foo", "bar"))
+	_, err = replayer.NIncrBy("foo", 1)
+	assert.EqualError(t, err, recordErr.Error())
+	assert.True(t, errors.Is(err, keyvaluestore.ErrWrongType))
+}
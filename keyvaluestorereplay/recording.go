@@ -0,0 +1,223 @@
+package keyvaluestorereplay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// ErrUnexpectedCall is returned by replaying backends when a call doesn't match the next one in
+// the recording.
+var ErrUnexpectedCall = errors.New("call does not match the recording")
+
+type entry struct {
+	Method string   `json:"method"`
+	Args   []string `json:"args,omitempty"`
+	Result result   `json:"result"`
+}
+
+// result holds the return values of any backend method.
+type result struct {
+	Bool              bool                        `json:"bool,omitempty"`
+	Int               int64                       `json:"int,omitempty"`
+	Float             *float64                    `json:"float,omitempty"`
+	String            *string                     `json:"string,omitempty"`
+	Strings           []string                    `json:"strings,omitempty"`
+	Map               map[string]string           `json:"map,omitempty"`
+	ScoredMembers     keyvaluestore.ScoredMembers `json:"scoredMembers,omitempty"`
+	ConditionalFailed []bool                      `json:"conditionalFailed,omitempty"`
+	Error             string                      `json:"error,omitempty"`
+
+	// Conflict indicates that Error should be replayed as an AtomicWriteConflictError.
+	Conflict bool `json:"conflict,omitempty"`
+
+	// Kind is the message of the keyvaluestore error kind that Error should be replayed with, if
+	// any.
+	Kind string `json:"kind,omitempty"`
+
+	replayErr error
+
+	// recordedErr is the original error while recording. It's returned instead of the serialized
+	// form so that recording doesn't change the error's type.
+	recordedErr error
+}
+
+func (r *result) setError(err error) {
+	if err == nil {
+		return
+	}
+	r.recordedErr = err
+	var conflictErr *keyvaluestore.AtomicWriteConflictError
+	if errors.As(err, &conflictErr) {
+		r.Conflict = true
+		err = conflictErr.Err
+	}
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind) {
+			r.Kind = kind.Error()
+			if kindErr, ok := err.(*keyvaluestore.Error); ok {
+				err = kindErr.Err
+			}
+			break
+		}
+	}
+	r.Error = err.Error()
+}
+
+var errorKinds = []error{
+	keyvaluestore.ErrNotSupported,
+	keyvaluestore.ErrWrongType,
+	keyvaluestore.ErrValueTooLarge,
+	keyvaluestore.ErrConditionFailed,
+	keyvaluestore.ErrThrottled,
+}
+
+func (r *result) err() error {
+	if r.replayErr != nil {
+		return r.replayErr
+	} else if r.recordedErr != nil {
+		return r.recordedErr
+	} else if r.Error == "" {
+		return nil
+	}
+	err := errors.New(r.Error)
+	for _, kind := range errorKinds {
+		if r.Kind == kind.Error() {
+			err = &keyvaluestore.Error{
+				Kind: kind,
+				Err:  err,
+			}
+			break
+		}
+	}
+	if r.Conflict {
+		return &keyvaluestore.AtomicWriteConflictError{
+			Err: err,
+		}
+	}
+	return err
+}
+
+func (r *result) float() float64 {
+	if r.Float == nil {
+		return 0
+	}
+	return *r.Float
+}
+
+type recording struct {
+	mutex   sync.Mutex
+	entries []entry
+	next    int
+}
+
+// formatArgs converts arguments to strings so that they can be serialized and compared.
+// Variadic arguments are flattened.
+func formatArgs(args ...interface{}) []string {
+	var ret []string
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case float64:
+			ret = append(ret, strconv.FormatFloat(arg, 'g', -1, 64))
+		case []string:
+			ret = append(ret, arg...)
+		case []interface{}:
+			ret = append(ret, formatArgs(arg...)...)
+		case []keyvaluestore.KeyValue:
+			for _, kv := range arg {
+				ret = append(ret, formatArgs(kv.Key, kv.Value)...)
+			}
+		default:
+			if s := keyvaluestore.ToString(arg); s != nil {
+				ret = append(ret, *s)
+			} else {
+				ret = append(ret, fmt.Sprint(arg))
+			}
+		}
+	}
+	return ret
+}
+
+// invoke either performs and records a call or replays it from the recording.
+func (b *Backend) invoke(method string, args []string, f func(r *result)) *result {
+	rec := b.recording
+
+	if b.backend == nil {
+		rec.mutex.Lock()
+		defer rec.mutex.Unlock()
+		if rec.next >= len(rec.entries) {
+			return &result{
+				replayErr: fmt.Errorf("%w: %v%v was called after the end of the recording", ErrUnexpectedCall, method, args),
+			}
+		}
+		e := &rec.entries[rec.next]
+		if e.Method != method || !reflect.DeepEqual(e.Args, args) {
+			return &result{
+				replayErr: fmt.Errorf("%w: expected %v%v, got %v%v", ErrUnexpectedCall, e.Method, e.Args, method, args),
+			}
+		}
+		rec.next++
+		r := e.Result
+		return &r
+	}
+
+	r := &result{}
+	f(r)
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	rec.entries = append(rec.entries, entry{
+		Method: method,
+		Args:   args,
+		Result: *r,
+	})
+	return r
+}
+
+// Save writes everything recorded so far as JSON lines.
+func (b *Backend) Save(w io.Writer) error {
+	rec := b.recording
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	encoder := json.NewEncoder(w)
+	for _, e := range rec.entries {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads a recording written by Save and returns a backend that replays it. Calls must be made
+// in the same order as they were recorded. Calls that don't match the recording fail with
+// ErrUnexpectedCall.
+func Load(r io.Reader) (*Backend, error) {
+	rec := &recording{}
+	decoder := json.NewDecoder(r)
+	for {
+		var e entry
+		if err := decoder.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		rec.entries = append(rec.entries, e)
+	}
+	return &Backend{
+		recording: rec,
+	}, nil
+}
+
+// Remaining returns the number of recorded calls that haven't been replayed yet. Tests can use
+// this to verify that the code under test made every call it made when the recording was taken.
+func (b *Backend) Remaining() int {
+	rec := b.recording
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	return len(rec.entries) - rec.next
+}
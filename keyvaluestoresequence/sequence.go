@@ -0,0 +1,62 @@
+// Package keyvaluestoresequence generates unique, increasing IDs on top of any backend.
+package keyvaluestoresequence
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// DefaultBlockSize is the block size used by sequences that don't specify one.
+const DefaultBlockSize = 100
+
+// Sequence generates IDs by reserving blocks of them from a counter stored at Key, then handing
+// them out locally. This reduces round trips to one per block.
+//
+// IDs are unique across all sequences sharing the same key. IDs returned by a single Sequence are
+// strictly increasing, but since each Sequence reserves its own blocks, IDs from different
+// Sequences may interleave. Reserved IDs that are never returned (e.g. because the process exits)
+// are skipped, so sequences may have gaps. If gapless, globally ordered IDs are required, set
+// BlockSize to 1.
+//
+// A Sequence is safe for concurrent use.
+type Sequence struct {
+	Backend keyvaluestore.Backend
+	Key     string
+
+	// BlockSize is the number of IDs to reserve at a time. If zero, DefaultBlockSize is used.
+	BlockSize int64
+
+	mutex sync.Mutex
+	next  int64
+	end   int64
+}
+
+func (s *Sequence) blockSize() int64 {
+	if s.BlockSize > 0 {
+		return s.BlockSize
+	}
+	return DefaultBlockSize
+}
+
+// Next returns the next ID. The first ID of a new sequence is 1.
+func (s *Sequence) Next() (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.next >= s.end {
+		blockSize := s.blockSize()
+		end, err := s.Backend.NIncrBy(s.Key, blockSize)
+		if err != nil {
+			return 0, fmt.Errorf("unable to reserve ids: %w", err)
+		}
+		// The counter holds the last reserved ID, so the new block is (end - blockSize, end].
+		s.next = end - blockSize + 1
+		s.end = end + 1
+	}
+
+	id := s.next
+	s.next++
+	return id, nil
+}
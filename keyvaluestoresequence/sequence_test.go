@@ -0,0 +1,74 @@
+package keyvaluestoresequence_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoresequence"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestSequence(t *testing.T) {
+	b := memorystore.NewBackend()
+	a := &keyvaluestoresequence.Sequence{Backend: b, Key: "seq", BlockSize: 3}
+	c := &keyvaluestoresequence.Sequence{Backend: b, Key: "seq", BlockSize: 3}
+
+	var ids []int64
+	for _, s := range []*keyvaluestoresequence.Sequence{a, a, c, a, a, c} {
+		id, err := s.Next()
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []int64{1, 2, 4, 3, 7, 5}, ids)
+
+	v, err := b.Get("seq")
+	require.NoError(t, err)
+	assert.Equal(t, "9", *v)
+}
+
+func TestSequenceConcurrency(t *testing.T) {
+	b := memorystore.NewBackend()
+
+	const sequences = 4
+	const idsPerSequence = 100
+
+	results := make([][]int64, sequences)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := &keyvaluestoresequence.Sequence{Backend: b, Key: "seq", BlockSize: 7}
+			for j := 0; j < idsPerSequence; j++ {
+				id, err := s.Next()
+				assert.NoError(t, err)
+				results[i] = append(results[i], id)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[int64]bool{}
+	for _, ids := range results {
+		for i, id := range ids {
+			assert.False(t, seen[id], "duplicate id %v", id)
+			seen[id] = true
+			if i > 0 {
+				assert.True(t, id > ids[i-1], "ids should increase")
+			}
+		}
+	}
+	assert.Len(t, seen, sequences*idsPerSequence)
+}
+
+func TestSequenceWrongType(t *testing.T) {
+	b := memorystore.NewBackend()
+	require.NoError(t, b.Set("seq", "foo"))
+	_, err := (&keyvaluestoresequence.Sequence{Backend: b, Key: "seq"}).Next()
+	assert.True(t, errors.Is(err, keyvaluestore.ErrWrongType))
+}
@@ -0,0 +1,160 @@
+// Package keyvaluestoresession implements expiring sessions, e.g. for web applications, on top of
+// any backend.
+package keyvaluestoresession
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Store stores sessions as hashes under Prefix. Each session has a JSON payload and an expiration
+// time, which can be extended via Refresh.
+type Store struct {
+	Backend keyvaluestore.Backend
+	Prefix  string
+
+	// Clock is used to get the current time. If nil, the wall clock is used.
+	Clock keyvaluestore.Clock
+}
+
+const (
+	payloadField    = "payload"
+	expirationField = "expires"
+)
+
+func (s *Store) key(id string) string {
+	return s.Prefix + id
+}
+
+func (s *Store) currentTime() time.Time {
+	return keyvaluestore.Now(s.Clock)
+}
+
+func newSessionId() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Create creates a session with the given payload, which is marshaled as JSON. It returns the
+// session's id, which is suitable for use as a cookie value.
+func (s *Store) Create(ttl time.Duration, payload interface{}) (string, error) {
+	id, err := newSessionId()
+	if err != nil {
+		return "", err
+	}
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return "", &keyvaluestore.JSONError{Key: s.key(id), Err: err}
+	}
+	expiresAt := s.currentTime().Add(ttl)
+	if err := s.Backend.HSet(s.key(id), payloadField, buf, keyvaluestore.KeyValue{
+		Key:   expirationField,
+		Value: expiresAt.UnixNano(),
+	}); err != nil {
+		return "", err
+	}
+	if err := s.expireAt(id, expiresAt); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (s *Store) expireAt(id string, deadline time.Time) error {
+	if expirer, ok := s.Backend.(keyvaluestore.Expirer); ok {
+		_, err := expirer.ExpireAt(s.key(id), deadline)
+		return err
+	}
+	return nil
+}
+
+// expiration returns the session's expiration time, or nil if it doesn't exist or has expired.
+func (s *Store) expiration(id string, fields map[string]string) (*time.Time, error) {
+	v, ok := fields[expirationField]
+	if !ok {
+		return nil, nil
+	}
+	nanos, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed session expiration: %w", keyvaluestore.ErrWrongType)
+	}
+	expiresAt := time.Unix(0, nanos)
+	if !s.currentTime().Before(expiresAt) {
+		if _, err := s.Backend.Delete(s.key(id)); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &expiresAt, nil
+}
+
+// Get unmarshals the session's payload into v. If the session doesn't exist or has expired, false
+// is returned and v is left untouched.
+func (s *Store) Get(id string, v interface{}) (bool, error) {
+	fields, err := s.Backend.HGetAll(s.key(id))
+	if err != nil {
+		return false, err
+	}
+	payload, ok := fields[payloadField]
+	if !ok {
+		return false, nil
+	}
+	if expiresAt, err := s.expiration(id, fields); err != nil || expiresAt == nil {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(payload), v); err != nil {
+		return false, &keyvaluestore.JSONError{Key: s.key(id), Err: err}
+	}
+	return true, nil
+}
+
+// ExpiresAt returns the session's expiration time, or nil if it doesn't exist or has expired.
+func (s *Store) ExpiresAt(id string) (*time.Time, error) {
+	fields, err := s.Backend.HGetAll(s.key(id))
+	if err != nil {
+		return nil, err
+	} else if _, ok := fields[payloadField]; !ok {
+		return nil, nil
+	}
+	return s.expiration(id, fields)
+}
+
+// Update replaces the session's payload without changing its expiration. It returns false if the
+// session doesn't exist or has expired.
+func (s *Store) Update(id string, payload interface{}) (bool, error) {
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return false, &keyvaluestore.JSONError{Key: s.key(id), Err: err}
+	}
+	if expiresAt, err := s.ExpiresAt(id); err != nil || expiresAt == nil {
+		return false, err
+	}
+	return true, s.Backend.HSet(s.key(id), payloadField, buf)
+}
+
+// Refresh extends the session so that it expires after the given duration from now. It returns
+// false if the session doesn't exist or has already expired.
+func (s *Store) Refresh(id string, ttl time.Duration) (bool, error) {
+	if expiresAt, err := s.ExpiresAt(id); err != nil || expiresAt == nil {
+		return false, err
+	}
+	expiresAt := s.currentTime().Add(ttl)
+	if err := s.Backend.HSet(s.key(id), expirationField, expiresAt.UnixNano()); err != nil {
+		return false, err
+	}
+	return true, s.expireAt(id, expiresAt)
+}
+
+// Destroy deletes the session.
+func (s *Store) Destroy(id string) error {
+	_, err := s.Backend.Delete(s.key(id))
+	return err
+}
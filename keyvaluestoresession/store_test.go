@@ -0,0 +1,104 @@
+package keyvaluestoresession
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+type testPayload struct {
+	UserId string
+}
+
+// hideExpirer hides the backend's Expirer implementation.
+type hideExpirer struct {
+	keyvaluestore.Backend
+}
+
+func TestStore(t *testing.T) {
+	for name, b := range map[string]keyvaluestore.Backend{
+		"Expirer":   memorystore.NewBackend(),
+		"NoExpirer": hideExpirer{memorystore.NewBackend()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			s := &Store{
+				Backend: b,
+				Prefix:  "sessions:",
+				Clock: keyvaluestore.ClockFunc(func() time.Time {
+					return now
+				}),
+			}
+
+			id, err := s.Create(time.Hour, &testPayload{UserId: "foo"})
+			require.NoError(t, err)
+
+			var payload testPayload
+			ok, err := s.Get(id, &payload)
+			require.NoError(t, err)
+			require.True(t, ok)
+			assert.Equal(t, "foo", payload.UserId)
+
+			ok, err = s.Update(id, &testPayload{UserId: "bar"})
+			require.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = s.Get(id, &payload)
+			require.NoError(t, err)
+			require.True(t, ok)
+			assert.Equal(t, "bar", payload.UserId)
+
+			now = now.Add(50 * time.Minute)
+			ok, err = s.Refresh(id, time.Hour)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			expiresAt, err := s.ExpiresAt(id)
+			require.NoError(t, err)
+			require.NotNil(t, expiresAt)
+			assert.True(t, expiresAt.Equal(now.Add(time.Hour)))
+
+			now = now.Add(50 * time.Minute)
+			ok, err = s.Get(id, &payload)
+			require.NoError(t, err)
+			assert.True(t, ok, "refreshed sessions should still be valid")
+
+			now = now.Add(time.Hour)
+			ok, err = s.Get(id, &payload)
+			require.NoError(t, err)
+			assert.False(t, ok, "the session should have expired")
+			ok, err = s.Refresh(id, time.Hour)
+			require.NoError(t, err)
+			assert.False(t, ok, "expired sessions can't be refreshed")
+
+			id, err = s.Create(time.Hour, &testPayload{UserId: "foo"})
+			require.NoError(t, err)
+			require.NoError(t, s.Destroy(id))
+			ok, err = s.Get(id, &payload)
+			require.NoError(t, err)
+			assert.False(t, ok)
+			ok, err = s.Update(id, &testPayload{UserId: "bar"})
+			require.NoError(t, err)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestStoreExpiration(t *testing.T) {
+	b := memorystore.NewBackend()
+	s := &Store{
+		Backend: b,
+		Prefix:  "sessions:",
+	}
+
+	id, err := s.Create(-time.Second, &testPayload{})
+	require.NoError(t, err)
+
+	// The backend expired the session immediately.
+	v, err := b.HGetAll(s.key(id))
+	require.NoError(t, err)
+	assert.Empty(t, v)
+}
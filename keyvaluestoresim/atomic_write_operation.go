@@ -0,0 +1,222 @@
+package keyvaluestoresim
+
+import (
+	"fmt"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+// atomicWriteOperation buffers operations until Exec, then applies them to the simulation's
+// primary as a single simulated operation.
+type atomicWriteOperation struct {
+	sim              *Simulation
+	keys             []string
+	operations       []func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult
+	results          []*atomicWriteResult
+	idempotencyToken string
+}
+
+// atomicWriteResult is the result of an operation in an atomic write. It reflects the result of the
+// operation when it was applied to the primary.
+type atomicWriteResult struct {
+	result keyvaluestore.AtomicWriteResult
+}
+
+func (r *atomicWriteResult) ConditionalFailed() bool {
+	return r.result != nil && r.result.ConditionalFailed()
+}
+
+func (r *atomicWriteResult) Value() (int64, bool) {
+	if r.result == nil {
+		return 0, false
+	}
+	return keyvaluestore.NIncrByValue(r.result)
+}
+
+func (op *atomicWriteOperation) add(key string, f func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult) keyvaluestore.AtomicWriteResult {
+	r := &atomicWriteResult{}
+	op.keys = append(op.keys, key)
+	op.operations = append(op.operations, f)
+	op.results = append(op.results, r)
+	return r
+}
+
+func (op *atomicWriteOperation) Set(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	value = normalize(value)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.Set(key, value)
+	})
+}
+
+func (op *atomicWriteOperation) SetNX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	value = normalize(value)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.SetNX(key, value)
+	})
+}
+
+func (op *atomicWriteOperation) SetXX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	value = normalize(value)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.SetXX(key, value)
+	})
+}
+
+func (op *atomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
+	value = normalize(value)
+	oldValue = normalize(oldValue)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.SetEQ(key, value, oldValue)
+	})
+}
+
+func (op *atomicWriteOperation) Delete(key string) keyvaluestore.AtomicWriteResult {
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.Delete(key)
+	})
+}
+
+func (op *atomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteResult {
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.DeleteXX(key)
+	})
+}
+
+func (op *atomicWriteOperation) NIncrBy(key string, n int64) keyvaluestore.AtomicWriteResult {
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.NIncrBy(key, n)
+	})
+}
+
+func (op *atomicWriteOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	member = normalize(member)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZAdd(key, member, score)
+	})
+}
+
+func (op *atomicWriteOperation) ZAddNX(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	member = normalize(member)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZAddNX(key, member, score)
+	})
+}
+
+func (op *atomicWriteOperation) ZRem(key string, member interface{}) keyvaluestore.AtomicWriteResult {
+	member = normalize(member)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZRem(key, member)
+	})
+}
+
+func (op *atomicWriteOperation) ZHAdd(key, field string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	member = normalize(member)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZHAdd(key, field, member, score)
+	})
+}
+
+func (op *atomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	entries = normalizeZHEntries(entries)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZHMAdd(key, entries)
+	})
+}
+
+func (op *atomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	member = normalize(member)
+	oldMember = normalize(oldMember)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZHSetEQ(key, field, member, oldMember, score)
+	})
+}
+
+func (op *atomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWriteResult {
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZHRem(key, field)
+	})
+}
+
+func (op *atomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	member = normalize(member)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.ZHRemEQ(key, field, member)
+	})
+}
+
+func (op *atomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	member = normalize(member)
+	members = normalizeAll(members)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.SAdd(key, member, members...)
+	})
+}
+
+func (op *atomicWriteOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	member = normalize(member)
+	members = normalizeAll(members)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.SRem(key, member, members...)
+	})
+}
+
+func (op *atomicWriteOperation) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) keyvaluestore.AtomicWriteResult {
+	value = normalize(value)
+	fields = normalizeKeyValues(fields)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.HSet(key, field, value, fields...)
+	})
+}
+
+func (op *atomicWriteOperation) HSetNX(key, field string, value interface{}) keyvaluestore.AtomicWriteResult {
+	value = normalize(value)
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.HSetNX(key, field, value)
+	})
+}
+
+func (op *atomicWriteOperation) HDel(key, field string, fields ...string) keyvaluestore.AtomicWriteResult {
+	return op.add(key, func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+		return tx.HDel(key, field, fields...)
+	})
+}
+
+func (op *atomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.idempotencyToken = token
+	return op
+}
+
+func (op *atomicWriteOperation) Validate() error {
+	if len(op.operations) > keyvaluestore.MaxAtomicWriteOperations {
+		return fmt.Errorf("max operation count exceeded")
+	} else if len(op.idempotencyToken) > keyvaluestore.MaxIdempotencyTokenLength {
+		return fmt.Errorf("idempotency token too long")
+	}
+	return nil
+}
+
+func (op *atomicWriteOperation) Exec() (bool, error) {
+	if err := op.Validate(); err != nil {
+		return false, err
+	}
+
+	var ok bool
+	err := op.sim.write("AtomicWrite", op.keys, func(s *memorystore.Backend) (err error) {
+		tx := s.AtomicWrite()
+		if op.idempotencyToken != "" {
+			tx = tx.WithIdempotencyToken(op.idempotencyToken)
+		}
+		results := make([]keyvaluestore.AtomicWriteResult, len(op.operations))
+		for i, f := range op.operations {
+			results[i] = f(tx)
+		}
+		if ok, err = tx.Exec(); s == op.sim.primary {
+			for i, r := range op.results {
+				r.result = results[i]
+			}
+		}
+		return err
+	})
+	return ok, err
+}
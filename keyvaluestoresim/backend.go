@@ -0,0 +1,471 @@
+package keyvaluestoresim
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+var errConflict = errors.New("simulated conflict")
+
+// Backend is a simulated backend. Its operations are scheduled by the simulation that created it.
+// Reads are strongly consistent unless the backend was created via WithEventuallyConsistentReads,
+// in which case they may not reflect writes made within the simulation's MaxReplicationLag.
+type Backend struct {
+	sim                  *Simulation
+	eventuallyConsistent bool
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+
+// begin waits for the operation's latency to elapse, then determines whether it fails. If the
+// simulation isn't running, active is false and the operation should be applied immediately. The
+// mutex is held when it returns.
+func (s *Simulation) begin(operation string) (issued time.Time, active bool, err error) {
+	s.mutex.Lock()
+	if !s.active {
+		return time.Time{}, false, nil
+	}
+	issued = s.Now()
+	latency := s.duration(s.MinLatency, s.MaxLatency)
+	s.mutex.Unlock()
+
+	s.yield(latency)
+
+	s.mutex.Lock()
+	if s.chance(s.ErrorRates[operation]) {
+		return issued, true, memorystore.ErrSimulatedFault
+	}
+	return issued, true, nil
+}
+
+func (b *Backend) read(operation string, f func(s *memorystore.Backend) error) error {
+	s := b.sim
+	_, active, err := s.begin(operation)
+	defer s.mutex.Unlock()
+	if err != nil {
+		return err
+	} else if active && b.eventuallyConsistent {
+		return f(s.replica)
+	}
+	return f(s.primary)
+}
+
+func (b *Backend) write(operation string, key string, f func(s *memorystore.Backend) error) error {
+	return b.sim.write(operation, []string{key}, f)
+}
+
+// write applies a write to the primary. If it succeeds, f is invoked again to apply it to the
+// replica once it's replicated, so f must not have side effects other than on the backend that it's
+// given.
+func (s *Simulation) write(operation string, keys []string, f func(s *memorystore.Backend) error) error {
+	issued, active, err := s.begin(operation)
+	defer s.mutex.Unlock()
+	if err != nil {
+		return err
+	} else if !active {
+		return f(s.primary)
+	}
+
+	if operation == "AtomicWrite" && s.conflicts(keys, issued) && s.chance(s.AtomicWriteConflictRate) {
+		return &keyvaluestore.AtomicWriteConflictError{
+			Err: errConflict,
+		}
+	}
+
+	if err := f(s.primary); err != nil {
+		return err
+	}
+
+	now := s.Now()
+	for _, key := range keys {
+		s.lastWrites[key] = now
+	}
+	if at := now.Add(s.duration(0, s.MaxReplicationLag)); at.After(s.replicated) {
+		s.replicated = at
+	}
+	s.push(&event{
+		at:        s.replicated,
+		replicate: f,
+	})
+
+	if s.chance(s.AmbiguousErrorRate) {
+		return memorystore.ErrSimulatedFault
+	}
+	return nil
+}
+
+// conflicts returns true if any of the keys were written after the given time. The mutex must be
+// held.
+func (s *Simulation) conflicts(keys []string, since time.Time) bool {
+	for _, key := range keys {
+		if s.lastWrites[key].After(since) {
+			return true
+		}
+	}
+	return false
+}
+
+// Batch returns a batch that executes each of its operations as a separate simulated operation.
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	return &keyvaluestore.FallbackBatchOperation{
+		Backend: b,
+	}
+}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return &atomicWriteOperation{
+		sim: b.sim,
+	}
+}
+
+// Close does nothing. The simulation's data remains accessible.
+func (b *Backend) Close() error {
+	return nil
+}
+
+func (b *Backend) Ping() error {
+	return b.read("Ping", func(s *memorystore.Backend) error {
+		return s.Ping()
+	})
+}
+
+func (b *Backend) Delete(key string) (ok bool, err error) {
+	err = b.write("Delete", key, func(s *memorystore.Backend) (err error) {
+		ok, err = s.Delete(key)
+		return err
+	})
+	return ok, err
+}
+
+func (b *Backend) Get(key string) (value *string, err error) {
+	err = b.read("Get", func(s *memorystore.Backend) (err error) {
+		value, err = s.Get(key)
+		return err
+	})
+	return value, err
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	value = normalize(value)
+	return b.write("Set", key, func(s *memorystore.Backend) error {
+		return s.Set(key, value)
+	})
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (ok bool, err error) {
+	value = normalize(value)
+	err = b.write("SetXX", key, func(s *memorystore.Backend) (err error) {
+		ok, err = s.SetXX(key, value)
+		return err
+	})
+	return ok, err
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (ok bool, err error) {
+	value = normalize(value)
+	err = b.write("SetNX", key, func(s *memorystore.Backend) (err error) {
+		ok, err = s.SetNX(key, value)
+		return err
+	})
+	return ok, err
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (ok bool, err error) {
+	value = normalize(value)
+	oldValue = normalize(oldValue)
+	err = b.write("SetEQ", key, func(s *memorystore.Backend) (err error) {
+		ok, err = s.SetEQ(key, value, oldValue)
+		return err
+	})
+	return ok, err
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (value int64, err error) {
+	err = b.write("NIncrBy", key, func(s *memorystore.Backend) (err error) {
+		value, err = s.NIncrBy(key, n)
+		return err
+	})
+	return value, err
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	member = normalize(member)
+	members = normalizeAll(members)
+	return b.write("SAdd", key, func(s *memorystore.Backend) error {
+		return s.SAdd(key, member, members...)
+	})
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	member = normalize(member)
+	members = normalizeAll(members)
+	return b.write("SRem", key, func(s *memorystore.Backend) error {
+		return s.SRem(key, member, members...)
+	})
+}
+
+func (b *Backend) SMembers(key string) (members []string, err error) {
+	err = b.read("SMembers", func(s *memorystore.Backend) (err error) {
+		members, err = s.SMembers(key)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	value = normalize(value)
+	fields = normalizeKeyValues(fields)
+	return b.write("HSet", key, func(s *memorystore.Backend) error {
+		return s.HSet(key, field, value, fields...)
+	})
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	return b.write("HDel", key, func(s *memorystore.Backend) error {
+		return s.HDel(key, field, fields...)
+	})
+}
+
+func (b *Backend) HGet(key, field string) (value *string, err error) {
+	err = b.read("HGet", func(s *memorystore.Backend) (err error) {
+		value, err = s.HGet(key, field)
+		return err
+	})
+	return value, err
+}
+
+func (b *Backend) HGetAll(key string) (fields map[string]string, err error) {
+	err = b.read("HGetAll", func(s *memorystore.Backend) (err error) {
+		fields, err = s.HGetAll(key)
+		return err
+	})
+	return fields, err
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
+	member = normalize(member)
+	return b.write("ZAdd", key, func(s *memorystore.Backend) error {
+		return s.ZAdd(key, member, score)
+	})
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (score *float64, err error) {
+	member = normalize(member)
+	err = b.read("ZScore", func(s *memorystore.Backend) (err error) {
+		score, err = s.ZScore(key, member)
+		return err
+	})
+	return score, err
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	member = normalize(member)
+	return b.write("ZRem", key, func(s *memorystore.Backend) error {
+		return s.ZRem(key, member)
+	})
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (score float64, err error) {
+	member = normalize(member)
+	err = b.write("ZIncrBy", key, func(s *memorystore.Backend) (err error) {
+		score, err = s.ZIncrBy(key, member, n)
+		return err
+	})
+	return score, err
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) (members []string, err error) {
+	err = b.read("ZRangeByScore", func(s *memorystore.Backend) (err error) {
+		members, err = s.ZRangeByScore(key, min, max, limit)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (members keyvaluestore.ScoredMembers, err error) {
+	err = b.read("ZRangeByScoreWithScores", func(s *memorystore.Backend) (err error) {
+		members, err = s.ZRangeByScoreWithScores(key, min, max, limit)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) (members []string, err error) {
+	err = b.read("ZRevRangeByScore", func(s *memorystore.Backend) (err error) {
+		members, err = s.ZRevRangeByScore(key, min, max, limit)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (members keyvaluestore.ScoredMembers, err error) {
+	err = b.read("ZRevRangeByScoreWithScores", func(s *memorystore.Backend) (err error) {
+		members, err = s.ZRevRangeByScoreWithScores(key, min, max, limit)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (n int, err error) {
+	err = b.read("ZCount", func(s *memorystore.Backend) (err error) {
+		n, err = s.ZCount(key, min, max)
+		return err
+	})
+	return n, err
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (n int, err error) {
+	err = b.read("ZLexCount", func(s *memorystore.Backend) (err error) {
+		n, err = s.ZLexCount(key, min, max)
+		return err
+	})
+	return n, err
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) (members []string, err error) {
+	err = b.read("ZRangeByLex", func(s *memorystore.Backend) (err error) {
+		members, err = s.ZRangeByLex(key, min, max, limit)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) (members []string, err error) {
+	err = b.read("ZRevRangeByLex", func(s *memorystore.Backend) (err error) {
+		members, err = s.ZRevRangeByLex(key, min, max, limit)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	member = normalize(member)
+	return b.write("ZHAdd", key, func(s *memorystore.Backend) error {
+		return s.ZHAdd(key, field, member, score)
+	})
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	entries = normalizeZHEntries(entries)
+	return b.write("ZHMAdd", key, func(s *memorystore.Backend) error {
+		return s.ZHMAdd(key, entries)
+	})
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	return b.write("ZHRem", key, func(s *memorystore.Backend) error {
+		return s.ZHRem(key, field)
+	})
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (ok bool, err error) {
+	member = normalize(member)
+	err = b.write("ZHRemEQ", key, func(s *memorystore.Backend) (err error) {
+		ok, err = s.ZHRemEQ(key, field, member)
+		return err
+	})
+	return ok, err
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) (members []string, err error) {
+	err = b.read("ZHRangeByScore", func(s *memorystore.Backend) (err error) {
+		members, err = s.ZHRangeByScore(key, min, max, limit)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (members keyvaluestore.ScoredMembers, err error) {
+	err = b.read("ZHRangeByScoreWithScores", func(s *memorystore.Backend) (err error) {
+		members, err = s.ZHRangeByScoreWithScores(key, min, max, limit)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) (members []string, err error) {
+	err = b.read("ZHRevRangeByScore", func(s *memorystore.Backend) (err error) {
+		members, err = s.ZHRevRangeByScore(key, min, max, limit)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (members keyvaluestore.ScoredMembers, err error) {
+	err = b.read("ZHRevRangeByScoreWithScores", func(s *memorystore.Backend) (err error) {
+		members, err = s.ZHRevRangeByScoreWithScores(key, min, max, limit)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) (members []string, err error) {
+	err = b.read("ZHRangeByLex", func(s *memorystore.Backend) (err error) {
+		members, err = s.ZHRangeByLex(key, min, max, limit)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) (members []string, err error) {
+	err = b.read("ZHRevRangeByLex", func(s *memorystore.Backend) (err error) {
+		members, err = s.ZHRevRangeByLex(key, min, max, limit)
+		return err
+	})
+	return members, err
+}
+
+func (b *Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	return &Backend{
+		sim:                  b.sim,
+		eventuallyConsistent: true,
+	}
+}
+
+func (b *Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	return b
+}
+
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return nil
+}
+
+// normalize converts values to strings when they're given so that replicas apply the same values
+// even if the caller modifies them in the meantime.
+func normalize(v interface{}) interface{} {
+	if s := keyvaluestore.ToString(v); s != nil {
+		return *s
+	}
+	return v
+}
+
+func normalizeAll(values []interface{}) []interface{} {
+	ret := make([]interface{}, len(values))
+	for i, v := range values {
+		ret[i] = normalize(v)
+	}
+	return ret
+}
+
+func normalizeKeyValues(fields []keyvaluestore.KeyValue) []keyvaluestore.KeyValue {
+	ret := make([]keyvaluestore.KeyValue, len(fields))
+	for i, field := range fields {
+		ret[i] = keyvaluestore.KeyValue{
+			Key:   field.Key,
+			Value: normalize(field.Value),
+		}
+	}
+	return ret
+}
+
+func normalizeZHEntries(entries []keyvaluestore.ZHEntry) []keyvaluestore.ZHEntry {
+	ret := make([]keyvaluestore.ZHEntry, len(entries))
+	for i, entry := range entries {
+		entry.Member = normalize(entry.Member)
+		ret[i] = entry
+	}
+	return ret
+}
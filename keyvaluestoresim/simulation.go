@@ -0,0 +1,260 @@
+// Package keyvaluestoresim provides a backend for deterministic simulation testing, in the spirit of
+// FoundationDB's simulator. Application code runs as a number of actors that share a simulated
+// backend. A scheduler driven by a seeded random number generator decides when each operation is
+// applied, how long it takes, whether it fails, and how stale eventually consistent reads are. So a
+// test can run thousands of seeds looking for one that breaks an application invariant, and any
+// failing seed can be replayed exactly.
+//
+// Only one actor runs at a time, and control only passes between actors when they invoke the
+// simulated backend or Simulation.Sleep. For runs to be deterministic, actors must not
+// communicate or block via anything else, such as channels, mutexes, the wall clock, or goroutines
+// of their own. Additional actors can be started via Simulation.Go.
+package keyvaluestoresim
+
+import (
+	"container/heap"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+// StartTime is the simulated time at which every simulation begins.
+var StartTime = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Simulation schedules the operations of a set of actors. The exported fields configure its fault
+// and time modeling, and must be set before Run is invoked.
+type Simulation struct {
+	// MinLatency and MaxLatency bound the simulated time that each operation takes. Operations are
+	// applied when they complete, so operations issued concurrently by different actors are
+	// applied in an order that depends on the seed.
+	MinLatency time.Duration
+	MaxLatency time.Duration
+
+	// MaxReplicationLag is the maximum simulated time it takes for a write to become visible to
+	// eventually consistent reads. Writes always become visible in the order they were applied.
+	MaxReplicationLag time.Duration
+
+	// AtomicWriteConflictRate is the probability that an atomic write fails with a
+	// keyvaluestore.AtomicWriteConflictError if another write to one of its keys was applied while
+	// it was in flight, like a DynamoDB transaction conflict.
+	AtomicWriteConflictRate float64
+
+	// ErrorRates maps operation names to the probability that they fail with
+	// memorystore.ErrSimulatedFault without being applied. Atomic writes are identified as
+	// "AtomicWrite".
+	ErrorRates map[string]float64
+
+	// AmbiguousErrorRate is the probability that a write fails with memorystore.ErrSimulatedFault
+	// after it has been applied, as if the response were lost. Applications must be prepared for
+	// this with any backend that's accessed over a network.
+	AmbiguousErrorRate float64
+
+	primary *memorystore.Backend
+	replica *memorystore.Backend
+
+	// now is the simulated time in nanoseconds since StartTime. It's accessed atomically.
+	now int64
+
+	mutex      sync.Mutex
+	rand       *rand.Rand
+	active     bool
+	done       chan struct{}
+	running    int
+	events     eventHeap
+	seq        int
+	replicated time.Time
+	lastWrites map[string]time.Time
+}
+
+// New creates a simulation whose randomness is determined by the given seed.
+func New(seed int64) *Simulation {
+	s := &Simulation{
+		rand:       rand.New(rand.NewSource(seed)),
+		lastWrites: map[string]time.Time{},
+	}
+	s.primary = memorystore.NewBackend()
+	s.primary.Clock = s
+	s.replica = memorystore.NewBackend()
+	s.replica.Clock = s
+	return s
+}
+
+// Now returns the current simulated time. It only advances while the simulation is running.
+func (s *Simulation) Now() time.Time {
+	return StartTime.Add(time.Duration(atomic.LoadInt64(&s.now)))
+}
+
+var _ keyvaluestore.Clock = &Simulation{}
+
+// Backend returns the simulated backend. Outside of Run, it behaves like a memorystore backend
+// without any simulated faults, which is useful for setting up fixtures and checking invariants
+// afterwards.
+func (s *Simulation) Backend() keyvaluestore.Backend {
+	return &Backend{
+		sim: s,
+	}
+}
+
+// Run starts each of the actors and blocks until all of them, and any that they start via Go, have
+// returned. Once Run returns, every write is visible to eventually consistent reads.
+func (s *Simulation) Run(actors ...func()) {
+	s.mutex.Lock()
+	s.replica.Restore(s.primary.Snapshot())
+	s.replicated = s.Now()
+	s.active = true
+	s.done = make(chan struct{})
+	done := s.done
+	for _, actor := range actors {
+		s.spawn(actor)
+	}
+	s.step()
+	s.mutex.Unlock()
+	<-done
+}
+
+// Go starts another actor. It must be invoked by an actor.
+func (s *Simulation) Go(actor func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.spawn(actor)
+}
+
+// Sleep blocks the calling actor for the given amount of simulated time. Outside of Run, it returns
+// immediately.
+func (s *Simulation) Sleep(d time.Duration) {
+	s.yield(d)
+}
+
+// Rand returns a random number generator that actors can use to make decisions. It's derived from
+// the simulation's seed so that runs remain deterministic. It must only be used by actors.
+func (s *Simulation) Rand() *rand.Rand {
+	return rand.New(rand.NewSource(s.int63()))
+}
+
+func (s *Simulation) int63() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rand.Int63()
+}
+
+// event is either an actor waiting to be resumed or a write waiting to be replicated.
+type event struct {
+	at  time.Time
+	seq int
+
+	ready     chan struct{}
+	replicate func(b *memorystore.Backend) error
+}
+
+type eventHeap []*event
+
+func (h eventHeap) Len() int { return len(h) }
+
+func (h eventHeap) Less(i, j int) bool {
+	if !h[i].at.Equal(h[j].at) {
+		return h[i].at.Before(h[j].at)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h eventHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *eventHeap) Push(x interface{}) { *h = append(*h, x.(*event)) }
+
+func (h *eventHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// push schedules an event. The mutex must be held.
+func (s *Simulation) push(e *event) {
+	e.seq = s.seq
+	s.seq++
+	heap.Push(&s.events, e)
+}
+
+// spawn schedules an actor to start now. The mutex must be held.
+func (s *Simulation) spawn(actor func()) {
+	e := &event{
+		at:    s.Now(),
+		ready: make(chan struct{}),
+	}
+	s.push(e)
+	go func() {
+		<-e.ready
+		// This is deferred so that actors that exit via runtime.Goexit, e.g. because of
+		// require.NoError, don't deadlock the simulation.
+		defer s.finish()
+		actor()
+	}()
+}
+
+func (s *Simulation) finish() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.running--
+	s.step()
+}
+
+// yield blocks the calling actor until d has elapsed. The mutex must not be held.
+func (s *Simulation) yield(d time.Duration) {
+	s.mutex.Lock()
+	if !s.active {
+		s.mutex.Unlock()
+		return
+	}
+	e := &event{
+		at:    s.Now().Add(d),
+		ready: make(chan struct{}),
+	}
+	s.push(e)
+	s.running--
+	s.step()
+	s.mutex.Unlock()
+	<-e.ready
+}
+
+// step processes events until an actor has been resumed. If every actor has returned, the run is
+// completed. The mutex must be held.
+func (s *Simulation) step() {
+	for s.running == 0 && s.events.Len() > 0 {
+		e := heap.Pop(&s.events).(*event)
+		if e.at.After(s.Now()) {
+			atomic.StoreInt64(&s.now, int64(e.at.Sub(StartTime)))
+		}
+		if e.replicate != nil {
+			// The write already succeeded on the primary, and the replica applies writes in the
+			// same order, so it must succeed here too.
+			if err := e.replicate(s.replica); err != nil {
+				panic("keyvaluestoresim: replication failed: " + err.Error())
+			}
+			continue
+		}
+		s.running++
+		close(e.ready)
+	}
+	if s.running == 0 && s.events.Len() == 0 && s.active {
+		s.active = false
+		close(s.done)
+	}
+}
+
+// duration returns a random duration between min and max. The mutex must be held.
+func (s *Simulation) duration(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(s.rand.Int63n(int64(max-min)+1))
+}
+
+// chance returns true with the given probability. The mutex must be held.
+func (s *Simulation) chance(p float64) bool {
+	return p > 0 && s.rand.Float64() < p
+}
@@ -0,0 +1,183 @@
+package keyvaluestoresim
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return New(0).Backend()
+	})
+}
+
+func TestBackendAtomicWrite(t *testing.T) {
+	keyvaluestoretest.TestBackendAtomicWrite(t, func() keyvaluestore.Backend {
+		return New(0).Backend()
+	})
+}
+
+// runIncrements has several actors increment a counter via non-atomic reads and writes, returning
+// the history of operations and the final value.
+func runIncrements(t *testing.T, seed int64) ([]string, string) {
+	s := New(seed)
+	s.MinLatency = time.Millisecond
+	s.MaxLatency = 10 * time.Millisecond
+	b := s.Backend()
+	require.NoError(t, b.Set("counter", 0))
+
+	var history []string
+	var actors []func()
+	for i := 0; i < 5; i++ {
+		i := i
+		actors = append(actors, func() {
+			for j := 0; j < 3; j++ {
+				v, err := b.Get("counter")
+				require.NoError(t, err)
+				n, err := strconv.Atoi(*v)
+				require.NoError(t, err)
+				require.NoError(t, b.Set("counter", n+1))
+				history = append(history, fmt.Sprintf("%v: %v -> %v at %v", i, n, n+1, s.Now().Sub(StartTime)))
+			}
+		})
+	}
+	s.Run(actors...)
+
+	v, err := b.Get("counter")
+	require.NoError(t, err)
+	return history, *v
+}
+
+func TestSimulation_Deterministic(t *testing.T) {
+	history, value := runIncrements(t, 1)
+	assert.Len(t, history, 15)
+
+	// Concurrent read-modify-writes lose updates.
+	assert.NotEqual(t, "15", value)
+
+	for i := 0; i < 3; i++ {
+		replayed, replayedValue := runIncrements(t, 1)
+		assert.Equal(t, history, replayed)
+		assert.Equal(t, value, replayedValue)
+	}
+
+	other, _ := runIncrements(t, 2)
+	assert.NotEqual(t, history, other)
+}
+
+func TestSimulation_EventuallyConsistentReads(t *testing.T) {
+	stale := 0
+	for seed := int64(0); seed < 10; seed++ {
+		s := New(seed)
+		s.MinLatency = time.Millisecond
+		s.MaxLatency = time.Millisecond
+		s.MaxReplicationLag = time.Second
+		b := s.Backend()
+		eventual := b.WithEventuallyConsistentReads()
+
+		s.Run(func() {
+			require.NoError(t, b.Set("foo", "bar"))
+
+			v, err := b.Get("foo")
+			require.NoError(t, err)
+			assert.NotNil(t, v)
+
+			v, err = eventual.Get("foo")
+			require.NoError(t, err)
+			if v == nil {
+				stale++
+			}
+
+			s.Sleep(s.MaxReplicationLag)
+			v, err = eventual.Get("foo")
+			require.NoError(t, err)
+			assert.NotNil(t, v)
+		})
+	}
+	assert.True(t, stale > 0)
+}
+
+func TestSimulation_AtomicWriteConflicts(t *testing.T) {
+	s := New(0)
+	s.MinLatency = time.Millisecond
+	s.MaxLatency = 10 * time.Millisecond
+	s.AtomicWriteConflictRate = 1
+	b := s.Backend()
+
+	conflicts := 0
+	write := func() {
+		tx := b.AtomicWrite()
+		tx.Set("foo", "bar")
+		_, err := tx.Exec()
+		if keyvaluestore.IsAtomicWriteConflict(err) {
+			conflicts++
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+	s.Run(write, write)
+	assert.Equal(t, 1, conflicts)
+
+	// Atomic writes that don't overlap never conflict.
+	conflicts = 0
+	s.Run(write)
+	s.Run(write)
+	assert.Equal(t, 0, conflicts)
+}
+
+func TestSimulation_Faults(t *testing.T) {
+	s := New(0)
+	s.ErrorRates = map[string]float64{
+		"Set": 1,
+	}
+	b := s.Backend()
+
+	s.Run(func() {
+		assert.True(t, errors.Is(b.Set("foo", "bar"), memorystore.ErrSimulatedFault))
+	})
+	v, err := b.Get("foo")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	s.ErrorRates = nil
+	s.AmbiguousErrorRate = 1
+	s.Run(func() {
+		assert.True(t, errors.Is(b.Set("foo", "bar"), memorystore.ErrSimulatedFault))
+	})
+	v, err = b.Get("foo")
+	require.NoError(t, err)
+	assert.NotNil(t, v)
+}
+
+func TestSimulation_Time(t *testing.T) {
+	s := New(0)
+	b := s.Backend()
+
+	var order []string
+	s.Run(func() {
+		s.Go(func() {
+			s.Sleep(time.Minute)
+			order = append(order, "b")
+			assert.Equal(t, StartTime.Add(time.Minute), s.Now())
+		})
+		s.Sleep(time.Second)
+		order = append(order, "a")
+		require.NoError(t, b.Set("foo", "bar"))
+	})
+	assert.Equal(t, []string{"a", "b"}, order)
+	assert.Equal(t, StartTime.Add(time.Minute), s.Now())
+
+	// Outside of Run, the backend can be used directly and time doesn't pass.
+	s.Sleep(time.Hour)
+	assert.Equal(t, StartTime.Add(time.Minute), s.Now())
+}
@@ -0,0 +1,133 @@
+package keyvaluestoresoftdelete
+
+import "github.com/ccbrown/keyvaluestore"
+
+type atomicWriteOperation struct {
+	backend     *Backend
+	atomicWrite keyvaluestore.AtomicWriteOperation
+	tombstones  []*pendingTombstone
+	err         error
+}
+
+// addTombstone reads the key and adds its tombstone to the atomic write. Errors are returned by
+// Exec.
+func (op *atomicWriteOperation) addTombstone(key string) {
+	tombstone, err := op.backend.tombstone(key)
+	if err != nil {
+		if op.err == nil {
+			op.err = err
+		}
+		return
+	} else if tombstone == nil {
+		return
+	}
+	op.atomicWrite.Set(tombstone.key, tombstone.encoded)
+	op.tombstones = append(op.tombstones, tombstone)
+}
+
+func (op *atomicWriteOperation) Set(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.Set(key, value)
+}
+
+func (op *atomicWriteOperation) SetNX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.SetNX(key, value)
+}
+
+func (op *atomicWriteOperation) SetXX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.SetXX(key, value)
+}
+
+func (op *atomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.SetEQ(key, value, oldValue)
+}
+
+func (op *atomicWriteOperation) Delete(key string) keyvaluestore.AtomicWriteResult {
+	op.addTombstone(key)
+	return op.atomicWrite.Delete(key)
+}
+
+func (op *atomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteResult {
+	op.addTombstone(key)
+	return op.atomicWrite.DeleteXX(key)
+}
+
+func (op *atomicWriteOperation) NIncrBy(key string, n int64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.NIncrBy(key, n)
+}
+
+func (op *atomicWriteOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZAdd(key, member, score)
+}
+
+func (op *atomicWriteOperation) ZHAdd(key, field string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZHAdd(key, field, member, score)
+}
+
+func (op *atomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZHMAdd(key, entries)
+}
+
+func (op *atomicWriteOperation) ZAddNX(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZAddNX(key, member, score)
+}
+
+func (op *atomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZHSetEQ(key, field, member, oldMember, score)
+}
+
+func (op *atomicWriteOperation) ZRem(key string, member interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZRem(key, member)
+}
+
+func (op *atomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZHRem(key, field)
+}
+
+func (op *atomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZHRemEQ(key, field, member)
+}
+
+func (op *atomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.SAdd(key, member, members...)
+}
+
+func (op *atomicWriteOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.SRem(key, member, members...)
+}
+
+func (op *atomicWriteOperation) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.HSet(key, field, value, fields...)
+}
+
+func (op *atomicWriteOperation) HSetNX(key, field string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.HSetNX(key, field, value)
+}
+
+func (op *atomicWriteOperation) HDel(key, field string, fields ...string) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.HDel(key, field, fields...)
+}
+
+func (op *atomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.atomicWrite.WithIdempotencyToken(token)
+	return op
+}
+
+func (op *atomicWriteOperation) Validate() error {
+	return op.atomicWrite.Validate()
+}
+
+func (op *atomicWriteOperation) Exec() (bool, error) {
+	if op.err != nil {
+		return false, op.err
+	}
+	ok, err := op.atomicWrite.Exec()
+	if err != nil || !ok {
+		return ok, err
+	}
+	for _, tombstone := range op.tombstones {
+		if err := op.backend.expire(tombstone); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
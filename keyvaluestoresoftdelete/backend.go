@@ -0,0 +1,274 @@
+package keyvaluestoresoftdelete
+
+import (
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// DefaultPrefix is the prefix of tombstone keys if no other prefix is given.
+const DefaultPrefix = "_deleted:"
+
+// DefaultTTL is the amount of time for which tombstones are kept if no other TTL is given.
+const DefaultTTL = 30 * 24 * time.Hour
+
+// Backend passes operations through to an underlying backend, but instead of deleting keys, moves
+// their contents into tombstones. Deleted keys are gone as far as reads are concerned, but they can
+// be restored via Undelete until their tombstones expire or are purged. This protects critical
+// keys, such as configuration, against accidental deletions.
+//
+// Tombstones are stored in the underlying backend at the deleted key prefixed by Prefix. The
+// underlying backend must implement keyvaluestore.EntryGetter so that keys of any type can be
+// captured. If it implements keyvaluestore.Expirer, tombstones are removed automatically once their
+// TTL elapses. Otherwise they're ignored once expired, but remain until purged.
+//
+// Deletions via batches and atomic writes are soft too. Because keys are read before they're
+// deleted, writes made concurrently with a deletion may not be reflected in its tombstone.
+type Backend struct {
+	Backend keyvaluestore.Backend
+
+	// The prefix of tombstone keys. Defaults to DefaultPrefix.
+	Prefix string
+
+	// The amount of time for which tombstones are kept. Defaults to DefaultTTL.
+	TTL time.Duration
+
+	// If given, only keys for which Filter returns true are soft-deleted. Other keys are deleted
+	// immediately.
+	Filter func(key string) bool
+
+	// Clock is used to determine when tombstones expire. If nil, the wall clock is used.
+	Clock keyvaluestore.Clock
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return &atomicWriteOperation{
+		backend:     b,
+		atomicWrite: b.Backend.AtomicWrite(),
+	}
+}
+
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	return &batchOperation{
+		backend: b,
+		batch:   b.Backend.Batch(),
+	}
+}
+
+func (b *Backend) Ping() error {
+	return b.Backend.Ping()
+}
+
+func (b *Backend) Close() error {
+	return b.Backend.Close()
+}
+
+// Delete moves the key's contents into a tombstone and deletes it. Keys excluded by Filter are
+// deleted immediately.
+func (b *Backend) Delete(key string) (success bool, err error) {
+	tombstone, err := b.tombstone(key)
+	if err != nil {
+		return false, err
+	} else if tombstone == nil {
+		return b.Backend.Delete(key)
+	}
+
+	tx := b.Backend.AtomicWrite()
+	tx.Delete(key)
+	tx.Set(tombstone.key, tombstone.encoded)
+	if _, err := tx.Exec(); err != nil {
+		return false, err
+	}
+	return true, b.expire(tombstone)
+}
+
+func (b *Backend) Get(key string) (*string, error) {
+	return b.Backend.Get(key)
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	return b.Backend.Set(key, value)
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	return b.Backend.NIncrBy(key, n)
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	return b.Backend.SetXX(key, value)
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	return b.Backend.SetNX(key, value)
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	return b.Backend.SetEQ(key, value, oldValue)
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	return b.Backend.SAdd(key, member, members...)
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	return b.Backend.SRem(key, member, members...)
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	return b.Backend.HSet(key, field, value, fields...)
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	return b.Backend.HDel(key, field, fields...)
+}
+
+func (b *Backend) HGet(key, field string) (*string, error) {
+	return b.Backend.HGet(key, field)
+}
+
+func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	return b.Backend.HGetAll(key)
+}
+
+func (b *Backend) SMembers(key string) ([]string, error) {
+	return b.Backend.SMembers(key)
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
+	return b.Backend.ZAdd(key, member, score)
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	return b.Backend.ZHAdd(key, field, member, score)
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	return b.Backend.ZHMAdd(key, entries)
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	return b.Backend.ZScore(key, member)
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	return b.Backend.ZIncrBy(key, member, n)
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	return b.Backend.ZRem(key, member)
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	return b.Backend.ZHRem(key, field)
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	return b.Backend.ZHRemEQ(key, field, member)
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	return b.Backend.ZCount(key, min, max)
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
+	return b.Backend.ZLexCount(key, min, max)
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZHRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZHRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZHRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZHRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZHRevRangeByLex(key, min, max, limit)
+}
+
+var _ keyvaluestore.SortedHashFieldRanger = &Backend{}
+
+func (b *Backend) ZHRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRangeByScoreWithFields(b.Backend, key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRevRangeByScoreWithFields(b.Backend, key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRangeByLexWithFields(b.Backend, key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return keyvaluestore.ZHRevRangeByLexWithFields(b.Backend, key, min, max, limit)
+}
+
+var _ keyvaluestore.MultiExister = &Backend{}
+
+func (b *Backend) ExistsMulti(keys ...string) (map[string]bool, error) {
+	return keyvaluestore.ExistsMulti(b.Backend, keys...)
+}
+
+var _ keyvaluestore.MultiSortedSetRanger = &Backend{}
+
+func (b *Backend) ZRangeByScoreMulti(keys []string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return keyvaluestore.ZRangeByScoreMulti(b.Backend, keys, min, max, limit)
+}
+
+func (b Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	b.Backend = b.Backend.WithProfiler(profiler)
+	return &b
+}
+
+func (b Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	b.Backend = b.Backend.WithEventuallyConsistentReads()
+	return &b
+}
+
+func (b Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	b.Backend = keyvaluestore.WithOptions(b.Backend, opts)
+	return &b
+}
+
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return b.Backend
+}
@@ -0,0 +1,224 @@
+package keyvaluestoresoftdelete_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreexport"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoresoftdelete"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return &keyvaluestoresoftdelete.Backend{
+			Backend: memorystore.NewBackend(),
+		}
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return &keyvaluestoresoftdelete.Backend{
+			Backend: b,
+		}
+	}, keyvaluestoretest.WrapperOptions{
+		// Deletes require a keyvaluestore.EntryGetter, which the wrapped backend isn't.
+		Unforwarded: []string{"Delete", "AtomicWrite"},
+	})
+}
+
+func TestSoftDelete(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	b := &keyvaluestoresoftdelete.Backend{
+		Backend: underlying,
+		TTL:     time.Hour,
+		Clock:   underlying,
+	}
+
+	require.NoError(t, b.Set("config", "critical"))
+	require.NoError(t, b.SAdd("set", "a", "b"))
+
+	ok, err := b.Delete("config")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = b.Delete("set")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = b.Delete("missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	v, err := b.Get("config")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+	members, err := b.SMembers("set")
+	require.NoError(t, err)
+	assert.Empty(t, members)
+
+	tombstone, err := b.Deleted("config")
+	require.NoError(t, err)
+	require.NotNil(t, tombstone)
+	assert.Equal(t, "critical", tombstone.Entry.Value)
+	assert.Equal(t, tombstone.Deleted.Add(time.Hour), tombstone.Expires)
+	tombstone, err = b.Deleted("missing")
+	require.NoError(t, err)
+	assert.Nil(t, tombstone)
+
+	ok, err = b.Undelete("config")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	v, err = b.Get("config")
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, "critical", *v)
+	tombstone, err = b.Deleted("config")
+	require.NoError(t, err)
+	assert.Nil(t, tombstone)
+
+	ok, err = b.Undelete("config")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Keys that have been recreated aren't overwritten.
+	require.NoError(t, b.SAdd("set", "c"))
+	_, err = b.Undelete("set")
+	var conflict *keyvaluestoreexport.ConflictError
+	assert.True(t, errors.As(err, &conflict))
+
+	ok, err = b.Purge("set")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = b.Undelete("set")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Tombstones expire.
+	_, err = b.Delete("config")
+	require.NoError(t, err)
+	underlying.FastForward(time.Hour)
+	ok, err = b.Undelete("config")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestSoftDelete_Filter(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	b := &keyvaluestoresoftdelete.Backend{
+		Backend: underlying,
+		Filter: func(key string) bool {
+			return strings.HasPrefix(key, "config:")
+		},
+	}
+
+	require.NoError(t, b.Set("config:foo", "foo"))
+	require.NoError(t, b.Set("cache:foo", "foo"))
+	for _, key := range []string{"config:foo", "cache:foo"} {
+		_, err := b.Delete(key)
+		require.NoError(t, err)
+	}
+
+	exists, err := keyvaluestore.ExistsMulti(underlying, keyvaluestoresoftdelete.DefaultPrefix+"config:foo", keyvaluestoresoftdelete.DefaultPrefix+"cache:foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		keyvaluestoresoftdelete.DefaultPrefix + "config:foo": true,
+		keyvaluestoresoftdelete.DefaultPrefix + "cache:foo":  false,
+	}, exists)
+}
+
+func TestSoftDelete_AtomicWriteAndBatch(t *testing.T) {
+	b := &keyvaluestoresoftdelete.Backend{
+		Backend: memorystore.NewBackend(),
+	}
+
+	require.NoError(t, b.Set("a", "a"))
+	require.NoError(t, b.Set("b", "b"))
+	require.NoError(t, b.HSet("c", "f", "v"))
+
+	tx := b.AtomicWrite()
+	tx.DeleteXX("a")
+	tx.Delete("b")
+	ok, err := tx.Exec()
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	batch := b.Batch()
+	result := batch.Delete("c")
+	require.NoError(t, batch.Exec())
+	require.NoError(t, result.Result())
+
+	for _, key := range []string{"a", "b", "c"} {
+		exists, err := keyvaluestore.ExistsMulti(b, key)
+		require.NoError(t, err)
+		assert.False(t, exists[key])
+
+		ok, err := b.Undelete(key)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	fields, err := b.HGetAll("c")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"f": "v"}, fields)
+
+	// Atomic writes that fail their conditions don't leave tombstones behind.
+	tx = b.AtomicWrite()
+	tx.Delete("a")
+	tx.SetNX("b", "b")
+	ok, err = tx.Exec()
+	require.NoError(t, err)
+	assert.False(t, ok)
+	tombstone, err := b.Deleted("a")
+	require.NoError(t, err)
+	assert.Nil(t, tombstone)
+}
+
+func TestSoftDelete_NotSupported(t *testing.T) {
+	b := &keyvaluestoresoftdelete.Backend{
+		Backend: &keyvaluestoresoftdelete.Backend{
+			Backend: memorystore.NewBackend(),
+		},
+	}
+	_, err := b.Delete("foo")
+	assert.True(t, errors.Is(err, keyvaluestore.ErrNotSupported))
+}
+
+func TestPurgeExpired(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	now := time.Now()
+	b := &keyvaluestoresoftdelete.Backend{
+		Backend: underlying,
+		TTL:     time.Hour,
+		Clock: keyvaluestore.ClockFunc(func() time.Time {
+			return now
+		}),
+	}
+
+	require.NoError(t, b.Set("a", "a"))
+	require.NoError(t, b.Set("b", "b"))
+	_, err := b.Delete("a")
+	require.NoError(t, err)
+	now = now.Add(30 * time.Minute)
+	_, err = b.Delete("b")
+	require.NoError(t, err)
+
+	// The underlying backend's clock hasn't advanced, so only PurgeExpired removes the tombstone.
+	now = now.Add(30 * time.Minute)
+	purged, err := b.PurgeExpired(1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	exists, err := keyvaluestore.ExistsMulti(underlying, keyvaluestoresoftdelete.DefaultPrefix+"a", keyvaluestoresoftdelete.DefaultPrefix+"b")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		keyvaluestoresoftdelete.DefaultPrefix + "a": false,
+		keyvaluestoresoftdelete.DefaultPrefix + "b": true,
+	}, exists)
+}
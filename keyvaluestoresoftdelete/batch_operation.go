@@ -0,0 +1,94 @@
+package keyvaluestoresoftdelete
+
+import "github.com/ccbrown/keyvaluestore"
+
+type batchOperation struct {
+	backend   *Backend
+	batch     keyvaluestore.BatchOperation
+	deletions []*deletion
+}
+
+// deletion is a soft deletion that's performed once the rest of the batch has been executed.
+type deletion struct {
+	key string
+	err error
+}
+
+func (d *deletion) Result() error {
+	return d.err
+}
+
+func (op *batchOperation) Get(key string) keyvaluestore.GetResult {
+	return op.batch.Get(key)
+}
+
+func (op *batchOperation) Delete(key string) keyvaluestore.ErrorResult {
+	if op.backend.Filter != nil && !op.backend.Filter(key) {
+		return op.batch.Delete(key)
+	}
+	d := &deletion{key: key}
+	op.deletions = append(op.deletions, d)
+	return d
+}
+
+func (op *batchOperation) Set(key string, value interface{}) keyvaluestore.ErrorResult {
+	return op.batch.Set(key, value)
+}
+
+func (op *batchOperation) SMembers(key string) keyvaluestore.SMembersResult {
+	return op.batch.SMembers(key)
+}
+
+func (op *batchOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	return op.batch.SAdd(key, member, members...)
+}
+
+func (op *batchOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	return op.batch.SRem(key, member, members...)
+}
+
+func (op *batchOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.ErrorResult {
+	return op.batch.ZAdd(key, member, score)
+}
+
+func (op *batchOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.ErrorResult {
+	return op.batch.ZHMAdd(key, entries)
+}
+
+func (op *batchOperation) ZRem(key string, member interface{}) keyvaluestore.ErrorResult {
+	return op.batch.ZRem(key, member)
+}
+
+func (op *batchOperation) ZScore(key string, member interface{}) keyvaluestore.ZScoreResult {
+	return op.batch.ZScore(key, member)
+}
+
+func (op *batchOperation) ZHRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRangeByScore(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRangeByLex(key, min, max, limit)
+}
+
+func (op *batchOperation) ZHRevRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.batch.ZHRevRangeByLex(key, min, max, limit)
+}
+
+func (op *batchOperation) Len() int {
+	return op.batch.Len() + len(op.deletions)
+}
+
+func (op *batchOperation) Exec() error {
+	if err := op.batch.Exec(); err != nil {
+		return err
+	}
+	for _, d := range op.deletions {
+		_, d.err = op.backend.Delete(d.key)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package keyvaluestoresoftdelete
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoreexport"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorenamespace"
+)
+
+// Tombstone holds the contents of a deleted key.
+type Tombstone struct {
+	Entry   *keyvaluestore.Entry `json:"entry"`
+	Deleted time.Time            `json:"deleted"`
+	Expires time.Time            `json:"expires"`
+}
+
+// pendingTombstone is a tombstone that's about to be written.
+type pendingTombstone struct {
+	key     string
+	encoded []byte
+	expires time.Time
+}
+
+func (b *Backend) prefix() string {
+	if b.Prefix != "" {
+		return b.Prefix
+	}
+	return DefaultPrefix
+}
+
+func (b *Backend) ttl() time.Duration {
+	if b.TTL > 0 {
+		return b.TTL
+	}
+	return DefaultTTL
+}
+
+func (b *Backend) tombstoneKey(key string) string {
+	return b.prefix() + key
+}
+
+// tombstone reads the key and returns a tombstone for it. If the key doesn't exist or isn't
+// soft-deleted, nil is returned.
+func (b *Backend) tombstone(key string) (*pendingTombstone, error) {
+	if b.Filter != nil && !b.Filter(key) {
+		return nil, nil
+	}
+	getter, ok := b.Backend.(keyvaluestore.EntryGetter)
+	if !ok {
+		return nil, fmt.Errorf("backend does not support getting entries: %T: %w", b.Backend, keyvaluestore.ErrNotSupported)
+	}
+	entry, err := getter.GetEntry(key)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	now := keyvaluestore.Now(b.Clock)
+	tombstone := &Tombstone{
+		Entry:   entry,
+		Deleted: now,
+		Expires: now.Add(b.ttl()),
+	}
+	encoded, err := keyvaluestore.JSONSerializer.Marshal(tombstone)
+	if err != nil {
+		return nil, &keyvaluestore.JSONError{Key: b.tombstoneKey(key), Err: err}
+	}
+	return &pendingTombstone{
+		key:     b.tombstoneKey(key),
+		encoded: encoded,
+		expires: tombstone.Expires,
+	}, nil
+}
+
+// expire sets the tombstone's expiration if the backend supports it.
+func (b *Backend) expire(tombstone *pendingTombstone) error {
+	if expirer, ok := b.Backend.(keyvaluestore.Expirer); ok {
+		_, err := expirer.ExpireAt(tombstone.key, tombstone.expires)
+		return err
+	}
+	return nil
+}
+
+// Deleted returns the tombstone of the given key, or nil if it hasn't been deleted or its
+// tombstone has expired.
+func (b *Backend) Deleted(key string) (*Tombstone, error) {
+	var tombstone Tombstone
+	if ok, err := keyvaluestore.GetJSON(b.Backend, b.tombstoneKey(key), &tombstone); err != nil || !ok {
+		return nil, err
+	}
+	if !keyvaluestore.Now(b.Clock).Before(tombstone.Expires) {
+		return nil, nil
+	}
+	return &tombstone, nil
+}
+
+// Undelete restores a deleted key from its tombstone and removes the tombstone. It returns false
+// if the key has no tombstone. If the key has been recreated since it was deleted, a
+// *keyvaluestoreexport.ConflictError is returned and the tombstone is left in place.
+func (b *Backend) Undelete(key string) (bool, error) {
+	tombstone, err := b.Deleted(key)
+	if err != nil || tombstone == nil {
+		return false, err
+	}
+	if _, err := keyvaluestoreexport.Import(b.Backend, &entryReader{entry: tombstone.Entry}, keyvaluestoreexport.ImportOptions{
+		ConflictPolicy: keyvaluestoreexport.ConflictPolicyFail,
+	}); err != nil {
+		return false, err
+	}
+	_, err = b.Backend.Delete(b.tombstoneKey(key))
+	return true, err
+}
+
+// Purge permanently removes the tombstone of a deleted key. It returns false if the key has no
+// tombstone.
+func (b *Backend) Purge(key string) (bool, error) {
+	return b.Backend.Delete(b.tombstoneKey(key))
+}
+
+// PurgeExpired deletes tombstones that have expired. It's only needed if the underlying backend
+// doesn't implement keyvaluestore.Expirer, in which case it should be invoked periodically, e.g. by
+// a janitor. The backend must implement keyvaluestore.Scanner. The number of tombstones deleted is
+// returned, even if an error occurs.
+func (b *Backend) PurgeExpired(pageSize int) (int, error) {
+	purged := 0
+	err := keyvaluestorenamespace.ScanPrefix(b.Backend, b.prefix(), pageSize, func(entries []*keyvaluestore.Entry) error {
+		now := keyvaluestore.Now(b.Clock)
+		for _, entry := range entries {
+			if entry.Type != keyvaluestore.EntryTypeString {
+				continue
+			}
+			var tombstone Tombstone
+			if err := keyvaluestore.JSONSerializer.Unmarshal([]byte(entry.Value), &tombstone); err != nil {
+				return &keyvaluestore.JSONError{Key: entry.Key, Err: err}
+			}
+			if now.Before(tombstone.Expires) {
+				continue
+			}
+			if _, err := b.Backend.Delete(entry.Key); err != nil {
+				return err
+			}
+			purged++
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// entryReader adapts a single entry to the keyvaluestoreexport.Reader interface.
+type entryReader struct {
+	entry *keyvaluestore.Entry
+}
+
+func (r *entryReader) ReadEntry() (*keyvaluestore.Entry, error) {
+	if r.entry == nil {
+		return nil, io.EOF
+	}
+	entry := r.entry
+	r.entry = nil
+	return entry, nil
+}
@@ -0,0 +1,20 @@
+package keyvaluestorestats
+
+import "github.com/ccbrown/keyvaluestore"
+
+type atomicWriteOperation struct {
+	keyvaluestore.AtomicWriteOperation
+	stats *Stats
+}
+
+func (op *atomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.AtomicWriteOperation.WithIdempotencyToken(token)
+	return op
+}
+
+func (op *atomicWriteOperation) Exec() (bool, error) {
+	done := op.stats.begin("AtomicWrite")
+	ok, err := op.AtomicWriteOperation.Exec()
+	done(err)
+	return ok, err
+}
@@ -0,0 +1,401 @@
+// Package keyvaluestorestats provides a backend wrapper that collects operation counts, error
+// counts, and in-flight operations in a form that can be published via expvar.
+package keyvaluestorestats
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Backend passes operations through to an underlying backend and records them in Stats. Multiple
+// backends may share the same Stats.
+type Backend struct {
+	Backend keyvaluestore.Backend
+	Stats   *Stats
+
+	// If given, Sampler records the keys and value sizes of a fraction of the operations.
+	// Operations in batches and atomic writes aren't sampled.
+	Sampler *Sampler
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+
+// Middleware returns a middleware that records statistics in the given Stats.
+func Middleware(stats *Stats) keyvaluestore.Middleware {
+	return keyvaluestore.MiddlewareFunc(func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return &Backend{
+			Backend: b,
+			Stats:   stats,
+		}
+	})
+}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return &atomicWriteOperation{
+		AtomicWriteOperation: b.Backend.AtomicWrite(),
+		stats:                b.Stats,
+	}
+}
+
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	return &batchOperation{
+		BatchOperation: b.Backend.Batch(),
+		stats:          b.Stats,
+	}
+}
+
+func (b *Backend) Delete(key string) (bool, error) {
+	done := b.Stats.begin("Delete")
+	v, err := b.Backend.Delete(key)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) Ping() error {
+	done := b.Stats.begin("Ping")
+	err := b.Backend.Ping()
+	done(err)
+	return err
+}
+
+func (b *Backend) Close() error {
+	return b.Backend.Close()
+}
+
+func (b *Backend) Get(key string) (*string, error) {
+	done := b.Stats.begin("Get")
+	v, err := b.Backend.Get(key)
+	done(err)
+	b.sample(key, stringSize(v))
+	return v, err
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	done := b.Stats.begin("Set")
+	err := b.Backend.Set(key, value)
+	done(err)
+	b.sample(key, valueSize(value))
+	return err
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	done := b.Stats.begin("SetXX")
+	v, err := b.Backend.SetXX(key, value)
+	done(err)
+	b.sample(key, valueSize(value))
+	return v, err
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	done := b.Stats.begin("SetNX")
+	v, err := b.Backend.SetNX(key, value)
+	done(err)
+	b.sample(key, valueSize(value))
+	return v, err
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	done := b.Stats.begin("SetEQ")
+	v, err := b.Backend.SetEQ(key, value, oldValue)
+	done(err)
+	b.sample(key, valueSize(value))
+	return v, err
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	done := b.Stats.begin("NIncrBy")
+	v, err := b.Backend.NIncrBy(key, n)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	done := b.Stats.begin("SAdd")
+	err := b.Backend.SAdd(key, member, members...)
+	done(err)
+	b.sample(key, -1)
+	return err
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	done := b.Stats.begin("SRem")
+	err := b.Backend.SRem(key, member, members...)
+	done(err)
+	b.sample(key, -1)
+	return err
+}
+
+func (b *Backend) SMembers(key string) ([]string, error) {
+	done := b.Stats.begin("SMembers")
+	v, err := b.Backend.SMembers(key)
+	done(err)
+	b.sample(key, membersSize(v))
+	return v, err
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	done := b.Stats.begin("HSet")
+	err := b.Backend.HSet(key, field, value, fields...)
+	done(err)
+	b.sample(key, -1)
+	return err
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	done := b.Stats.begin("HDel")
+	err := b.Backend.HDel(key, field, fields...)
+	done(err)
+	b.sample(key, -1)
+	return err
+}
+
+func (b *Backend) HGet(key, field string) (*string, error) {
+	done := b.Stats.begin("HGet")
+	v, err := b.Backend.HGet(key, field)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	done := b.Stats.begin("HGetAll")
+	v, err := b.Backend.HGetAll(key)
+	done(err)
+	b.sample(key, hashSize(v))
+	return v, err
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
+	done := b.Stats.begin("ZAdd")
+	err := b.Backend.ZAdd(key, member, score)
+	done(err)
+	b.sample(key, -1)
+	return err
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	done := b.Stats.begin("ZScore")
+	v, err := b.Backend.ZScore(key, member)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	done := b.Stats.begin("ZRem")
+	err := b.Backend.ZRem(key, member)
+	done(err)
+	b.sample(key, -1)
+	return err
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	done := b.Stats.begin("ZIncrBy")
+	v, err := b.Backend.ZIncrBy(key, member, n)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	done := b.Stats.begin("ZRangeByScore")
+	v, err := b.Backend.ZRangeByScore(key, min, max, limit)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	done := b.Stats.begin("ZRangeByScoreWithScores")
+	v, err := b.Backend.ZRangeByScoreWithScores(key, min, max, limit)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	done := b.Stats.begin("ZRevRangeByScore")
+	v, err := b.Backend.ZRevRangeByScore(key, min, max, limit)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	done := b.Stats.begin("ZRevRangeByScoreWithScores")
+	v, err := b.Backend.ZRevRangeByScoreWithScores(key, min, max, limit)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	done := b.Stats.begin("ZCount")
+	v, err := b.Backend.ZCount(key, min, max)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
+	done := b.Stats.begin("ZLexCount")
+	v, err := b.Backend.ZLexCount(key, min, max)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	done := b.Stats.begin("ZRangeByLex")
+	v, err := b.Backend.ZRangeByLex(key, min, max, limit)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	done := b.Stats.begin("ZRevRangeByLex")
+	v, err := b.Backend.ZRevRangeByLex(key, min, max, limit)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	done := b.Stats.begin("ZHAdd")
+	err := b.Backend.ZHAdd(key, field, member, score)
+	done(err)
+	b.sample(key, -1)
+	return err
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	done := b.Stats.begin("ZHMAdd")
+	err := b.Backend.ZHMAdd(key, entries)
+	done(err)
+	b.sample(key, -1)
+	return err
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	done := b.Stats.begin("ZHRem")
+	err := b.Backend.ZHRem(key, field)
+	done(err)
+	b.sample(key, -1)
+	return err
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	done := b.Stats.begin("ZHRemEQ")
+	v, err := b.Backend.ZHRemEQ(key, field, member)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	done := b.Stats.begin("ZHRangeByScore")
+	v, err := b.Backend.ZHRangeByScore(key, min, max, limit)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	done := b.Stats.begin("ZHRangeByScoreWithScores")
+	v, err := b.Backend.ZHRangeByScoreWithScores(key, min, max, limit)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	done := b.Stats.begin("ZHRevRangeByScore")
+	v, err := b.Backend.ZHRevRangeByScore(key, min, max, limit)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	done := b.Stats.begin("ZHRevRangeByScoreWithScores")
+	v, err := b.Backend.ZHRevRangeByScoreWithScores(key, min, max, limit)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	done := b.Stats.begin("ZHRangeByLex")
+	v, err := b.Backend.ZHRangeByLex(key, min, max, limit)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	done := b.Stats.begin("ZHRevRangeByLex")
+	v, err := b.Backend.ZHRevRangeByLex(key, min, max, limit)
+	done(err)
+	b.sample(key, -1)
+	return v, err
+}
+
+func (b Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	b.Backend = b.Backend.WithProfiler(profiler)
+	return &b
+}
+
+func (b Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	b.Backend = b.Backend.WithEventuallyConsistentReads()
+	return &b
+}
+
+func (b Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	b.Backend = keyvaluestore.WithOptions(b.Backend, opts)
+	return &b
+}
+
+func (b *Backend) sample(key string, size int) {
+	if b.Sampler != nil {
+		b.Sampler.record(key, size)
+	}
+}
+
+func valueSize(value interface{}) int {
+	switch v := value.(type) {
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	}
+	return len(*keyvaluestore.ToString(value))
+}
+
+func stringSize(v *string) int {
+	if v == nil {
+		return -1
+	}
+	return len(*v)
+}
+
+func membersSize(members []string) int {
+	n := 0
+	for _, m := range members {
+		n += len(m)
+	}
+	return n
+}
+
+func hashSize(fields map[string]string) int {
+	n := 0
+	for k, v := range fields {
+		n += len(k) + len(v)
+	}
+	return n
+}
+
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return b.Backend
+}
@@ -0,0 +1,87 @@
+package keyvaluestorestats_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoremock"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorestats"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return &keyvaluestorestats.Backend{
+			Backend: memorystore.NewBackend(),
+			Stats:   &keyvaluestorestats.Stats{},
+		}
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return &keyvaluestorestats.Backend{
+			Backend: b,
+			Stats:   &keyvaluestorestats.Stats{},
+		}
+	}, keyvaluestoretest.WrapperOptions{})
+}
+
+func TestStats(t *testing.T) {
+	mock := &keyvaluestoremock.Backend{}
+	stats := &keyvaluestorestats.Stats{}
+	b := &keyvaluestorestats.Backend{
+		Backend: mock,
+		Stats:   stats,
+	}
+	stats.AddGauge("Answer", func() interface{} {
+		return 42
+	})
+
+	require.NoError(t, b.Set("foo", "bar"))
+	_, err := b.Get("foo")
+	require.NoError(t, err)
+	mock.SetError("Get", errors.New("test"))
+	_, err = b.Get("foo")
+	require.Error(t, err)
+
+	tx := b.AtomicWrite()
+	tx.Set("bar", "baz")
+	_, err = tx.Exec()
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]keyvaluestorestats.OperationStats{
+		"Set":         {Count: 1},
+		"Get":         {Count: 2, Errors: 1},
+		"AtomicWrite": {Count: 1},
+	}, stats.Operations())
+	assert.Equal(t, 0, stats.InFlight())
+
+	stats.AddProfile(&keyvaluestore.Profile{Operation: "ZIncrBy", Retries: 2})
+	stats.AddProfile(&keyvaluestore.Profile{Operation: "Get", Hedges: 1, SampleRate: 0.5})
+	stats.AddProfile(&keyvaluestore.Profile{Operation: "AtomicWrite", Conflicts: 1})
+
+	var published struct {
+		Count     int64
+		Errors    int64
+		InFlight  int
+		Retries   int
+		Hedges    int
+		Conflicts int
+		Gauges    map[string]interface{}
+	}
+	require.NoError(t, json.Unmarshal([]byte(stats.String()), &published))
+	assert.EqualValues(t, 4, published.Count)
+	assert.EqualValues(t, 1, published.Errors)
+	assert.Equal(t, 0, published.InFlight)
+	assert.Equal(t, 2, published.Retries)
+	assert.Equal(t, 2, published.Hedges)
+	assert.Equal(t, 1, published.Conflicts)
+	assert.EqualValues(t, 42, published.Gauges["Answer"])
+}
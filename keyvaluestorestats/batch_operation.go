@@ -0,0 +1,15 @@
+package keyvaluestorestats
+
+import "github.com/ccbrown/keyvaluestore"
+
+type batchOperation struct {
+	keyvaluestore.BatchOperation
+	stats *Stats
+}
+
+func (op *batchOperation) Exec() error {
+	done := op.stats.begin("Batch")
+	err := op.BatchOperation.Exec()
+	done(err)
+	return err
+}
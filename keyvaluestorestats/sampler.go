@@ -0,0 +1,194 @@
+package keyvaluestorestats
+
+import (
+	"encoding/json"
+	"expvar"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// DefaultSampleRate is the fraction of operations sampled by samplers that don't specify one.
+const DefaultSampleRate = 0.01
+
+// DefaultMaxSampledKeys is the number of keys tracked by samplers that don't specify a limit.
+const DefaultMaxSampledKeys = 1000
+
+// defaultReportSize is the number of keys included in each of the sampler's expvar reports.
+const defaultReportSize = 10
+
+// KeySample describes the sampled operations on a key.
+type KeySample struct {
+	Key string
+
+	// Accesses estimates the number of operations on the key. It's the number of sampled
+	// operations divided by the sample rate.
+	Accesses int64
+
+	// Size is the largest value size observed for the key, in bytes. Sizes are only observed for
+	// operations that read or write whole values, e.g. Get, Set, SMembers, and HGetAll.
+	Size int
+}
+
+// Sampler records the keys and value sizes of a fraction of a backend's operations so that the
+// hottest keys and largest values can be identified, e.g. to guide caching and sharding decisions.
+// It implements expvar.Var, so its report can be published alongside Stats. It's safe for
+// concurrent use.
+//
+// Only a bounded number of keys are tracked. Once the limit is reached, newly sampled keys replace
+// the least accessed (or for sizes, the smallest) ones, so the reports are approximate but favor
+// the keys that matter most.
+type Sampler struct {
+	// Rate is the fraction of operations that are sampled, between 0 and 1. If zero,
+	// DefaultSampleRate is used.
+	Rate float64
+
+	// MaxKeys is the maximum number of keys tracked for each report. If zero,
+	// DefaultMaxSampledKeys is used.
+	MaxKeys int
+
+	mutex    sync.Mutex
+	accesses map[string]int64
+	sizes    map[string]int
+}
+
+var _ expvar.Var = (*Sampler)(nil)
+
+func (s *Sampler) rate() float64 {
+	if s.Rate > 0 {
+		return s.Rate
+	}
+	return DefaultSampleRate
+}
+
+func (s *Sampler) maxKeys() int {
+	if s.MaxKeys > 0 {
+		return s.MaxKeys
+	}
+	return DefaultMaxSampledKeys
+}
+
+// record samples an operation on the key. size is the size of the value that was read or
+// written, or a negative number if it's unknown.
+func (s *Sampler) record(key string, size int) {
+	if rate := s.rate(); rate < 1 && rand.Float64() >= rate {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.accesses == nil {
+		s.accesses = map[string]int64{}
+		s.sizes = map[string]int{}
+	}
+
+	if n, ok := s.accesses[key]; ok {
+		s.accesses[key] = n + 1
+	} else if len(s.accesses) < s.maxKeys() {
+		s.accesses[key] = 1
+	} else {
+		// The new key inherits the count of the key it replaces. This over-estimates it, but it
+		// means that frequently accessed keys can't be starved out by a stream of new ones.
+		victim, min := "", int64(0)
+		for k, n := range s.accesses {
+			if victim == "" || n < min {
+				victim, min = k, n
+			}
+		}
+		delete(s.accesses, victim)
+		s.accesses[key] = min + 1
+	}
+
+	if size < 0 {
+		return
+	} else if prev, ok := s.sizes[key]; ok {
+		if size > prev {
+			s.sizes[key] = size
+		}
+	} else if len(s.sizes) < s.maxKeys() {
+		s.sizes[key] = size
+	} else {
+		victim, min := "", 0
+		for k, n := range s.sizes {
+			if victim == "" || n < min {
+				victim, min = k, n
+			}
+		}
+		if size > min {
+			delete(s.sizes, victim)
+			s.sizes[key] = size
+		}
+	}
+}
+
+func (s *Sampler) sample(key string) KeySample {
+	return KeySample{
+		Key:      key,
+		Accesses: int64(float64(s.accesses[key]) / s.rate()),
+		Size:     s.sizes[key],
+	}
+}
+
+// Hottest returns up to n of the most frequently accessed keys, in descending order of accesses.
+func (s *Sampler) Hottest(n int) []KeySample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ret := make([]KeySample, 0, len(s.accesses))
+	for key := range s.accesses {
+		ret = append(ret, s.sample(key))
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Accesses != ret[j].Accesses {
+			return ret[i].Accesses > ret[j].Accesses
+		}
+		return ret[i].Key < ret[j].Key
+	})
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
+
+// Largest returns up to n of the keys with the largest values, in descending order of size.
+func (s *Sampler) Largest(n int) []KeySample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ret := make([]KeySample, 0, len(s.sizes))
+	for key := range s.sizes {
+		ret = append(ret, s.sample(key))
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Size != ret[j].Size {
+			return ret[i].Size > ret[j].Size
+		}
+		return ret[i].Key < ret[j].Key
+	})
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
+
+// Reset discards all of the samples, e.g. to start a new reporting period.
+func (s *Sampler) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.accesses = nil
+	s.sizes = nil
+}
+
+// String returns a JSON object containing the ten hottest keys and the ten largest values.
+func (s *Sampler) String() string {
+	buf, err := json.Marshal(struct {
+		Hottest []KeySample
+		Largest []KeySample
+	}{
+		Hottest: s.Hottest(defaultReportSize),
+		Largest: s.Largest(defaultReportSize),
+	})
+	if err != nil {
+		return "null"
+	}
+	return string(buf)
+}
@@ -0,0 +1,81 @@
+package keyvaluestorestats_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore/keyvaluestorestats"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestSampler(t *testing.T) {
+	sampler := &keyvaluestorestats.Sampler{
+		Rate:    1,
+		MaxKeys: 3,
+	}
+	b := &keyvaluestorestats.Backend{
+		Backend: memorystore.NewBackend(),
+		Stats:   &keyvaluestorestats.Stats{},
+		Sampler: sampler,
+	}
+
+	require.NoError(t, b.Set("small", "a"))
+	require.NoError(t, b.Set("large", "aaaaa"))
+	require.NoError(t, b.Set("large", "aaaaaaaaaa"))
+	for i := 0; i < 5; i++ {
+		_, err := b.Get("hot")
+		require.NoError(t, err)
+	}
+
+	// The set replaces the least accessed key, inheriting its access count.
+	require.NoError(t, b.SAdd("set", "aaa", "bbb"))
+	_, err := b.SMembers("set")
+	require.NoError(t, err)
+
+	assert.Equal(t, []keyvaluestorestats.KeySample{
+		{Key: "hot", Accesses: 5},
+		{Key: "set", Accesses: 3, Size: 6},
+	}, sampler.Hottest(2))
+
+	assert.Equal(t, []keyvaluestorestats.KeySample{
+		{Key: "large", Accesses: 2, Size: 10},
+		{Key: "set", Accesses: 3, Size: 6},
+		{Key: "small", Size: 1},
+	}, sampler.Largest(3))
+
+	var report struct {
+		Hottest []keyvaluestorestats.KeySample
+		Largest []keyvaluestorestats.KeySample
+	}
+	require.NoError(t, json.Unmarshal([]byte(sampler.String()), &report))
+	assert.Len(t, report.Hottest, 3)
+	assert.Len(t, report.Largest, 3)
+
+	sampler.Reset()
+	assert.Empty(t, sampler.Hottest(10))
+	assert.Empty(t, sampler.Largest(10))
+}
+
+func TestSamplerRate(t *testing.T) {
+	sampler := &keyvaluestorestats.Sampler{
+		Rate: 0.5,
+	}
+	b := &keyvaluestorestats.Backend{
+		Backend: memorystore.NewBackend(),
+		Stats:   &keyvaluestorestats.Stats{},
+		Sampler: sampler,
+	}
+
+	for i := 0; i < 10000; i++ {
+		_, err := b.Get(fmt.Sprintf("key-%d", i%2))
+		require.NoError(t, err)
+	}
+
+	for _, sample := range sampler.Hottest(2) {
+		assert.InDelta(t, 5000, sample.Accesses, 500)
+	}
+}
@@ -0,0 +1,175 @@
+package keyvaluestorestats
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// OperationStats holds the statistics for a single operation.
+type OperationStats struct {
+	Count  int64
+	Errors int64
+}
+
+// Stats aggregates statistics for one or more backends. It implements expvar.Var, so it can be
+// published via expvar.Publish and surfaced by existing debug endpoints. It's safe for concurrent
+// use.
+//
+// Stats also implements keyvaluestore.Profiler. Giving it to a backend's WithProfiler adds the
+// retries, hedges, and conflicts that the backend reports, so contention and flakiness can be
+// tracked per backend by publishing a Stats for each one:
+//
+//	stats := &keyvaluestorestats.Stats{}
+//	expvar.Publish("kvs.users", stats)
+//	backend = backend.WithProfiler(stats)
+type Stats struct {
+	inFlight  int64
+	retries   int64
+	hedges    int64
+	conflicts int64
+
+	mutex      sync.Mutex
+	operations map[string]*OperationStats
+	gauges     map[string]func() interface{}
+}
+
+var _ expvar.Var = (*Stats)(nil)
+var _ keyvaluestore.Profiler = (*Stats)(nil)
+
+// AddProfile records the profile's retries, hedges, and conflicts. If the profile was sampled, the
+// counts are scaled by its sample rate to estimate the totals.
+func (s *Stats) AddProfile(profile *keyvaluestore.Profile) {
+	scale := func(n int) int64 {
+		if profile.SampleRate > 0 {
+			return int64(math.Round(float64(n) / profile.SampleRate))
+		}
+		return int64(n)
+	}
+	atomic.AddInt64(&s.retries, scale(profile.Retries))
+	atomic.AddInt64(&s.hedges, scale(profile.Hedges))
+	atomic.AddInt64(&s.conflicts, scale(profile.Conflicts))
+}
+
+// RetryCount returns the number of retries reported via AddProfile.
+func (s *Stats) RetryCount() int {
+	return int(atomic.LoadInt64(&s.retries))
+}
+
+// HedgeCount returns the number of hedged requests reported via AddProfile.
+func (s *Stats) HedgeCount() int {
+	return int(atomic.LoadInt64(&s.hedges))
+}
+
+// ConflictCount returns the number of conflicts reported via AddProfile.
+func (s *Stats) ConflictCount() int {
+	return int(atomic.LoadInt64(&s.conflicts))
+}
+
+// begin records the start of an operation. The returned function must be invoked with the result
+// when the operation completes.
+func (s *Stats) begin(operation string) func(err error) {
+	atomic.AddInt64(&s.inFlight, 1)
+	return func(err error) {
+		atomic.AddInt64(&s.inFlight, -1)
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.operations == nil {
+			s.operations = map[string]*OperationStats{}
+		}
+		op, ok := s.operations[operation]
+		if !ok {
+			op = &OperationStats{}
+			s.operations[operation] = op
+		}
+		op.Count++
+		if err != nil {
+			op.Errors++
+		}
+	}
+}
+
+// AddGauge adds a value that's computed whenever the stats are read. For example, it can be used
+// to report the size of a cache:
+//
+//	stats.AddGauge("ReadCacheSize", func() interface{} { return cache.Len() })
+func (s *Stats) AddGauge(name string, f func() interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.gauges == nil {
+		s.gauges = map[string]func() interface{}{}
+	}
+	s.gauges[name] = f
+}
+
+// InFlight returns the number of operations that have started but not yet completed.
+func (s *Stats) InFlight() int {
+	return int(atomic.LoadInt64(&s.inFlight))
+}
+
+// Operations returns a copy of the statistics for each operation that has completed at least once.
+func (s *Stats) Operations() map[string]OperationStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ret := make(map[string]OperationStats, len(s.operations))
+	for name, op := range s.operations {
+		ret[name] = *op
+	}
+	return ret
+}
+
+// String returns the stats as a JSON object.
+func (s *Stats) String() string {
+	operations := s.Operations()
+
+	s.mutex.Lock()
+	names := make([]string, 0, len(s.gauges))
+	gauges := make(map[string]func() interface{}, len(s.gauges))
+	for name, f := range s.gauges {
+		names = append(names, name)
+		gauges[name] = f
+	}
+	s.mutex.Unlock()
+
+	// Gauges are evaluated without holding the lock in case they're slow or use the stats.
+	sort.Strings(names)
+	values := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		values[name] = gauges[name]()
+	}
+
+	var totalCount, totalErrors int64
+	for _, op := range operations {
+		totalCount += op.Count
+		totalErrors += op.Errors
+	}
+
+	buf, err := json.Marshal(struct {
+		Count      int64
+		Errors     int64
+		InFlight   int
+		Retries    int
+		Hedges     int
+		Conflicts  int
+		Operations map[string]OperationStats
+		Gauges     map[string]interface{} `json:",omitempty"`
+	}{
+		Count:      totalCount,
+		Errors:     totalErrors,
+		InFlight:   s.InFlight(),
+		Retries:    s.RetryCount(),
+		Hedges:     s.HedgeCount(),
+		Conflicts:  s.ConflictCount(),
+		Operations: operations,
+		Gauges:     values,
+	})
+	if err != nil {
+		return "null"
+	}
+	return string(buf)
+}
@@ -1,17 +1,22 @@
 package keyvaluestoretest
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorenamespace"
 )
 
 type testBinaryMarshaler struct{}
@@ -20,6 +25,21 @@ func (testBinaryMarshaler) MarshalBinary() ([]byte, error) {
 	return []byte("bar"), nil
 }
 
+type testTextMarshaler struct{}
+
+func (testTextMarshaler) MarshalText() ([]byte, error) {
+	return []byte("text"), nil
+}
+
+// newIdempotencyToken returns a random token. Some backends remember tokens across test runs, so
+// they can't be hard-coded.
+func newIdempotencyToken(t *testing.T) string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	return hex.EncodeToString(b)
+}
+
 func assertConditionPass(t *testing.T, r keyvaluestore.AtomicWriteResult) {
 	assert.False(t, r.ConditionalFailed())
 }
@@ -29,6 +49,12 @@ func assertConditionFail(t *testing.T, r keyvaluestore.AtomicWriteResult) {
 }
 
 func TestBackendAtomicWrite(t *testing.T, newBackend func() keyvaluestore.Backend) {
+	TestBackendAtomicWriteWithOptions(t, newBackend, Options{})
+}
+
+// TestBackendAtomicWriteWithOptions is like TestBackendAtomicWrite, but skips tests for
+// capabilities the backend doesn't support.
+func TestBackendAtomicWriteWithOptions(t *testing.T, newBackend func() keyvaluestore.Backend, opts Options) {
 	b := newBackend()
 
 	t.Run("Set", func(t *testing.T) {
@@ -193,6 +219,41 @@ func TestBackendAtomicWrite(t *testing.T, newBackend func() keyvaluestore.Backen
 		assert.EqualValues(t, 1, got)
 	})
 
+	t.Run("NIncrByValue", func(t *testing.T) {
+		assert.NoError(t, b.Set("foo", "bar"))
+		_, err := b.NIncrBy("nvalue", 10)
+		assert.NoError(t, err)
+		_, err = b.Delete("notset")
+		assert.NoError(t, err)
+
+		tx := b.AtomicWrite()
+		defer assertConditionFail(t, tx.SetNX("foo", "bar"))
+		incr := tx.NIncrBy("nvalue", 1)
+		ok, err := tx.Exec()
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		// Failed atomic writes don't have values.
+		_, hasValue := keyvaluestore.NIncrByValue(incr)
+		assert.False(t, hasValue)
+
+		tx = b.AtomicWrite()
+		defer assertConditionPass(t, tx.SetNX("notset", "baz"))
+		incr = tx.NIncrBy("nvalue", 2)
+		ok, err = tx.Exec()
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		// Not every backend can return the value, but those that do must return the right one.
+		if v, ok := keyvaluestore.NIncrByValue(incr); ok {
+			assert.EqualValues(t, 12, v)
+		}
+
+		got, err := b.NIncrBy("nvalue", 0)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 12, got)
+	})
+
 	t.Run("SetEQ", func(t *testing.T) {
 		assert.NoError(t, b.Set("foo", 1))
 		assert.NoError(t, b.Set("deleteme", "bar"))
@@ -215,6 +276,7 @@ func TestBackendAtomicWrite(t *testing.T, newBackend func() keyvaluestore.Backen
 	})
 
 	t.Run("ZAdd", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
 		assert.NoError(t, b.Set("zsetcond", "foo"))
 
 		tx := b.AtomicWrite()
@@ -254,6 +316,7 @@ func TestBackendAtomicWrite(t *testing.T, newBackend func() keyvaluestore.Backen
 	})
 
 	t.Run("ZHAdd", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
 		assert.NoError(t, b.Set("zhashcond", "foo"))
 
 		tx := b.AtomicWrite()
@@ -292,7 +355,39 @@ func TestBackendAtomicWrite(t *testing.T, newBackend func() keyvaluestore.Backen
 		})
 	})
 
+	t.Run("ZHMAdd", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		assert.NoError(t, b.Set("zhmhashcond", "foo"))
+
+		entries := []keyvaluestore.ZHEntry{
+			{Field: "f", Member: "foo", Score: 1.0},
+			{Field: "b", Member: "bar", Score: 2.0},
+		}
+
+		tx := b.AtomicWrite()
+		defer assertConditionFail(t, tx.SetNX("zhmhashcond", "foo"))
+		defer assertConditionPass(t, tx.ZHMAdd("zhmhash", entries))
+		ok, err := tx.Exec()
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		count, err := b.ZCount("zhmhash", 0.0, 10.0)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, count)
+
+		tx = b.AtomicWrite()
+		defer assertConditionPass(t, tx.ZHMAdd("zhmhash", entries))
+		ok, err = tx.Exec()
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		members, err := b.ZHRangeByScore("zhmhash", 0.0, 10.0, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"foo", "bar"}, members)
+	})
+
 	t.Run("ZAddNX", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
 		assert.NoError(t, b.ZRem("zset", "foo"))
 		assert.NoError(t, b.ZRem("zset", "bar"))
 
@@ -318,7 +413,84 @@ func TestBackendAtomicWrite(t *testing.T, newBackend func() keyvaluestore.Backen
 		assert.True(t, ok)
 	})
 
+	t.Run("ZHSetEQ", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		assert.NoError(t, b.ZHAdd("zhseteq", "f", "foo", 1.0))
+		assert.NoError(t, b.ZAdd("zhseteq", "z", 2.0))
+
+		tx := b.AtomicWrite()
+		defer assertConditionFail(t, tx.ZHSetEQ("zhseteq", "f", "bar", "baz", 3.0))
+		ok, err := tx.Exec()
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		tx = b.AtomicWrite()
+		defer assertConditionFail(t, tx.ZHSetEQ("zhseteq", "missing", "bar", "foo", 3.0))
+		ok, err = tx.Exec()
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		members, err := b.ZHRangeByScore("zhseteq", 0.0, 10.0, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"foo", "z"}, members)
+
+		tx = b.AtomicWrite()
+		defer assertConditionPass(t, tx.ZHSetEQ("zhseteq", "f", "bar", "foo", 3.0))
+		defer assertConditionPass(t, tx.ZHSetEQ("zhseteq", "z", "qux", "z", 4.0))
+		ok, err = tx.Exec()
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		members, err = b.ZHRangeByScore("zhseteq", 0.0, 10.0, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"bar", "qux"}, members)
+
+		count, err := b.ZCount("zhseteq", 0.0, 10.0)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("ZHRemEQ", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		assert.NoError(t, b.ZHAdd("zhremeq", "f", "foo", 1.0))
+		assert.NoError(t, b.ZHAdd("zhremeq", "g", "bar", 2.0))
+		assert.NoError(t, b.ZAdd("zhremeq", "z", 3.0))
+
+		tx := b.AtomicWrite()
+		defer assertConditionPass(t, tx.ZHRem("zhremeq", "g"))
+		defer assertConditionFail(t, tx.ZHRemEQ("zhremeq", "f", "baz"))
+		ok, err := tx.Exec()
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		tx = b.AtomicWrite()
+		defer assertConditionFail(t, tx.ZHRemEQ("zhremeq", "missing", "foo"))
+		ok, err = tx.Exec()
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		members, err := b.ZHRangeByScore("zhremeq", 0.0, 10.0, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"foo", "bar", "z"}, members)
+
+		tx = b.AtomicWrite()
+		defer assertConditionPass(t, tx.ZHRemEQ("zhremeq", "f", "foo"))
+		defer assertConditionPass(t, tx.ZHRemEQ("zhremeq", "z", "z"))
+		ok, err = tx.Exec()
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		members, err = b.ZHRangeByScore("zhremeq", 0.0, 10.0, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"bar"}, members)
+
+		count, err := b.ZCount("zhremeq", 0.0, 10.0)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
 	t.Run("SAdd", func(t *testing.T) {
+		opts.require(t, CapabilitySets)
 		assert.NoError(t, b.Set("setcond", "foo"))
 
 		tx := b.AtomicWrite()
@@ -356,6 +528,7 @@ func TestBackendAtomicWrite(t *testing.T, newBackend func() keyvaluestore.Backen
 	})
 
 	t.Run("HSet", func(t *testing.T) {
+		opts.require(t, CapabilityHashes)
 		assert.NoError(t, b.Set("setcond", "foo"))
 
 		tx := b.AtomicWrite()
@@ -381,6 +554,7 @@ func TestBackendAtomicWrite(t *testing.T, newBackend func() keyvaluestore.Backen
 	})
 
 	t.Run("HSetNX", func(t *testing.T) {
+		opts.require(t, CapabilityHashes)
 		assert.NoError(t, b.HDel("h", "foo"))
 		assert.NoError(t, b.Set("foo", "x"))
 
@@ -408,6 +582,7 @@ func TestBackendAtomicWrite(t *testing.T, newBackend func() keyvaluestore.Backen
 	})
 
 	t.Run("HDel", func(t *testing.T) {
+		opts.require(t, CapabilityHashes)
 		assert.NoError(t, b.Set("setcond", "foo"))
 		assert.NoError(t, b.HSet("h", "foo", "bar"))
 
@@ -432,10 +607,90 @@ func TestBackendAtomicWrite(t *testing.T, newBackend func() keyvaluestore.Backen
 		assert.NoError(t, err)
 		assert.Nil(t, v)
 	})
+
+	t.Run("Validate", func(t *testing.T) {
+		tx := b.AtomicWrite()
+		tx.Set("validate", "foo")
+		assert.NoError(t, tx.Validate())
+
+		for i := 1; i <= keyvaluestore.MaxAtomicWriteOperations; i++ {
+			tx.Set(fmt.Sprintf("validate%v", i), "foo")
+		}
+		assert.Error(t, tx.Validate())
+		_, err := tx.Exec()
+		assert.Error(t, err)
+
+		v, err := b.Get("validate")
+		require.NoError(t, err)
+		assert.Nil(t, v)
+
+		tx = b.AtomicWrite().WithIdempotencyToken(strings.Repeat("x", keyvaluestore.MaxIdempotencyTokenLength+1))
+		tx.Set("validate", "foo")
+		assert.Error(t, tx.Validate())
+	})
+
+	t.Run("IdempotencyToken", func(t *testing.T) {
+		token := newIdempotencyToken(t)
+
+		tx := b.AtomicWrite().WithIdempotencyToken(token)
+		defer assertConditionPass(t, tx.SetNX("idempotent", "foo"))
+		defer assertConditionPass(t, tx.NIncrBy("idempotentcount", 1))
+		ok, err := tx.Exec()
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		// Retries succeed without applying the operations again.
+		tx = b.AtomicWrite().WithIdempotencyToken(token)
+		defer assertConditionPass(t, tx.SetNX("idempotent", "foo"))
+		defer assertConditionPass(t, tx.NIncrBy("idempotentcount", 1))
+		ok, err = tx.Exec()
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		v, err := b.Get("idempotentcount")
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		assert.Equal(t, "1", *v)
+
+		// Other tokens don't.
+		tx = b.AtomicWrite().WithIdempotencyToken(newIdempotencyToken(t))
+		defer assertConditionFail(t, tx.SetNX("idempotent", "foo"))
+		ok, err = tx.Exec()
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		tx = b.AtomicWrite().WithIdempotencyToken(strings.Repeat("x", keyvaluestore.MaxIdempotencyTokenLength+1))
+		tx.Set("idempotent", "bar")
+		_, err = tx.Exec()
+		assert.Error(t, err)
+	})
 }
 
 func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
+	TestBackendWithOptions(t, newBackend, Options{})
+}
+
+// TestBackendWithOptions is like TestBackend, but can skip tests for capabilities the backend doesn't
+// support or run the tests in parallel.
+func TestBackendWithOptions(t *testing.T, newBackend func() keyvaluestore.Backend, opts Options) {
+	if opts.Parallel {
+		shared := newBackend()
+		var namespaces int64
+		newBackend = func() keyvaluestore.Backend {
+			return &keyvaluestorenamespace.Backend{
+				Backend: shared,
+				Prefix:  fmt.Sprintf("%v:", atomic.AddInt64(&namespaces, 1)),
+			}
+		}
+	}
+
+	t.Run("Ping", func(t *testing.T) {
+		opts.parallel(t)
+		assert.NoError(t, newBackend().Ping())
+	})
+
 	t.Run("Set", func(t *testing.T) {
+		opts.parallel(t)
 		t.Run("BinaryMarshaler", func(t *testing.T) {
 			b := newBackend()
 
@@ -446,9 +701,37 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 			require.NoError(t, err)
 			assert.Equal(t, "bar", *v)
 		})
+
+		t.Run("ValueTypes", func(t *testing.T) {
+			b := newBackend()
+
+			for _, tc := range []struct {
+				Value    interface{}
+				Expected string
+			}{
+				{uint(1), "1"},
+				{uint64(math.MaxUint64), "18446744073709551615"},
+				{1.5, "1.5"},
+				{true, "1"},
+				{testTextMarshaler{}, "text"},
+			} {
+				require.NoError(t, b.Set("foo", tc.Value), "%T", tc.Value)
+				v, err := b.Get("foo")
+				require.NoError(t, err)
+				require.NotNil(t, v)
+				assert.Equal(t, tc.Expected, *v, "%T", tc.Value)
+
+				require.NoError(t, b.SAdd("set", tc.Value))
+			}
+
+			members, err := b.SMembers("set")
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"1", "18446744073709551615", "1.5", "text"}, members)
+		})
 	})
 
 	t.Run("NIncrBy", func(t *testing.T) {
+		opts.parallel(t)
 		b := newBackend()
 
 		n, err := b.NIncrBy("foo", 2)
@@ -471,6 +754,7 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("Delete", func(t *testing.T) {
+		opts.parallel(t)
 		b := newBackend()
 
 		success, err := b.Delete("foo")
@@ -491,6 +775,7 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("SetNX", func(t *testing.T) {
+		opts.parallel(t)
 		b := newBackend()
 
 		didSet, err := b.SetNX("foo", "bar")
@@ -507,6 +792,7 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("SetXX", func(t *testing.T) {
+		opts.parallel(t)
 		b := newBackend()
 
 		didSet, err := b.SetXX("foo", "bar")
@@ -530,6 +816,8 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("SAdd", func(t *testing.T) {
+		opts.require(t, CapabilitySets)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.SAdd("foo", "bar"))
@@ -547,6 +835,8 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("SRem", func(t *testing.T) {
+		opts.require(t, CapabilitySets)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.SAdd("foo", "a", "b", "c", "d"))
@@ -569,6 +859,8 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("HGet", func(t *testing.T) {
+		opts.require(t, CapabilityHashes)
+		opts.parallel(t)
 		b := newBackend()
 
 		v, err := b.HGet("foo", "bar")
@@ -583,6 +875,8 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("HDel", func(t *testing.T) {
+		opts.require(t, CapabilityHashes)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.HDel("foo", "bar"))
@@ -601,6 +895,8 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("HGetAll", func(t *testing.T) {
+		opts.require(t, CapabilityHashes)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.HSet("foo", "bar", "baz", keyvaluestore.KeyValue{"baz", "qux"}))
@@ -612,11 +908,178 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 		assert.Equal(t, "qux", m["baz"])
 	})
 
+	t.Run("EmptySets", func(t *testing.T) {
+		opts.require(t, CapabilitySets)
+		opts.parallel(t)
+		b := newBackend()
+
+		members, err := b.SMembers("foo")
+		assert.NoError(t, err)
+		assert.Nil(t, members)
+
+		assert.NoError(t, b.SAdd("foo", "a", "b"))
+		assert.NoError(t, b.SRem("foo", "a", "b"))
+
+		members, err = b.SMembers("foo")
+		assert.NoError(t, err)
+		assert.Nil(t, members)
+
+		batch := b.Batch()
+		smembers := batch.SMembers("foo")
+		require.NoError(t, batch.Exec())
+		members, err = smembers.Result()
+		assert.NoError(t, err)
+		assert.Nil(t, members)
+	})
+
+	t.Run("EmptyHashes", func(t *testing.T) {
+		opts.require(t, CapabilityHashes)
+		opts.parallel(t)
+		b := newBackend()
+
+		m, err := b.HGetAll("foo")
+		assert.NoError(t, err)
+		assert.Nil(t, m)
+
+		assert.NoError(t, b.HSet("foo", "a", "x", keyvaluestore.KeyValue{"b", "y"}))
+		assert.NoError(t, b.HDel("foo", "a", "b"))
+
+		m, err = b.HGetAll("foo")
+		assert.NoError(t, err)
+		assert.Nil(t, m)
+
+		v, err := b.HGet("foo", "a")
+		assert.NoError(t, err)
+		assert.Nil(t, v)
+	})
+
+	t.Run("ExistsMulti", func(t *testing.T) {
+		opts.parallel(t)
+		b := newBackend()
+
+		if _, err := keyvaluestore.ExistsMulti(b); errors.Is(err, keyvaluestore.ErrNotSupported) {
+			t.Skip("backend doesn't support existence checks")
+		}
+
+		keys := make([]string, 250)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("key%d", i)
+			if i%2 == 0 {
+				assert.NoError(t, b.Set(keys[i], "x"))
+			}
+		}
+
+		// Duplicate keys are allowed.
+		exists, err := keyvaluestore.ExistsMulti(b, append(keys, keys[0], keys[1])...)
+		assert.NoError(t, err)
+		assert.Len(t, exists, len(keys))
+		for i, key := range keys {
+			assert.Equal(t, i%2 == 0, exists[key], key)
+		}
+
+		exists, err = keyvaluestore.ExistsMulti(b)
+		assert.NoError(t, err)
+		assert.Empty(t, exists)
+	})
+
+	t.Run("ZRangeByScoreMulti", func(t *testing.T) {
+		opts.parallel(t)
+		b := newBackend()
+
+		assert.NoError(t, b.ZAdd("a", "a1", 1))
+		assert.NoError(t, b.ZAdd("a", "a4", 4))
+		assert.NoError(t, b.ZAdd("a", "shared", 5))
+		assert.NoError(t, b.ZAdd("b", "b2", 2))
+		assert.NoError(t, b.ZAdd("b", "shared", 3))
+		assert.NoError(t, b.ZAdd("b", "b6", 6))
+
+		members, err := keyvaluestore.ZRangeByScoreMulti(b, []string{"a", "b", "c"}, math.Inf(-1), math.Inf(1), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a1", "b2", "shared", "a4", "b6"}, members.Values())
+		assert.Equal(t, []float64{1, 2, 3, 4, 6}, members.Scores())
+
+		members, err = keyvaluestore.ZRangeByScoreMulti(b, []string{"a", "b"}, 2, 10, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b2", "shared", "a4"}, members.Values())
+
+		members, err = keyvaluestore.ZRangeByScoreMulti(b, nil, math.Inf(-1), math.Inf(1), 0)
+		assert.NoError(t, err)
+		assert.Empty(t, members)
+	})
+
+	// FoundationDB has to split values larger than 100KB across multiple keys.
+	t.Run("LargeValues", func(t *testing.T) {
+		opts.require(t, CapabilityLargeValues)
+		opts.parallel(t)
+		b := newBackend()
+
+		big := strings.Repeat("x", 300000)
+		assert.NoError(t, b.Set("foo", big))
+
+		v, err := b.Get("foo")
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		assert.Equal(t, big, *v)
+
+		batch := b.Batch()
+		get := batch.Get("foo")
+		require.NoError(t, batch.Exec())
+		v, err = get.Result()
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		assert.Equal(t, big, *v)
+
+		tx := b.AtomicWrite()
+		tx.SetEQ("foo", "bar", big)
+		ok, err := tx.Exec()
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		v, err = b.Get("foo")
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		assert.Equal(t, "bar", *v)
+
+		assert.NoError(t, b.Set("foo", big))
+		success, err := b.Delete("foo")
+		assert.NoError(t, err)
+		assert.True(t, success)
+		v, err = b.Get("foo")
+		assert.NoError(t, err)
+		assert.Nil(t, v)
+
+		bigA := strings.Repeat("a", 120000)
+		bigB := strings.Repeat("b", 120000)
+
+		assert.NoError(t, b.HSet("h", "a", bigA, keyvaluestore.KeyValue{"b", bigB}))
+		m, err := b.HGetAll("h")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": bigA, "b": bigB}, m)
+
+		assert.NoError(t, b.SAdd("s", bigA, bigB))
+		members, err := b.SMembers("s")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{bigA, bigB}, members)
+
+		assert.NoError(t, b.SRem("s", bigA))
+		members, err = b.SMembers("s")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{bigB}, members)
+	})
+
+	t.Run("Golden", func(t *testing.T) {
+		TestBackendGoldenWithOptions(t, newBackend, opts)
+	})
+
 	t.Run("AtomicWrite", func(t *testing.T) {
-		TestBackendAtomicWrite(t, newBackend)
+		opts.require(t, CapabilityAtomicWrite)
+		opts.parallel(t)
+		TestBackendAtomicWriteWithOptions(t, newBackend, opts)
 	})
 
 	t.Run("Batch", func(t *testing.T) {
+		opts.require(t, CapabilityBatch)
+		opts.parallel(t)
 		t.Run("Get", func(t *testing.T) {
 			b := newBackend()
 
@@ -642,7 +1105,37 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 			assert.NoError(t, err)
 		})
 
+		t.Run("Large", func(t *testing.T) {
+			b := newBackend()
+
+			// This should be large enough to require multiple round trips for every backend.
+			const n = 2500
+
+			batch := b.Batch()
+			for i := 0; i < n; i++ {
+				batch.Set(fmt.Sprintf("large%v", i), i)
+			}
+			assert.Equal(t, n, batch.Len())
+			require.NoError(t, batch.Exec())
+
+			batch = b.Batch()
+			gets := make([]keyvaluestore.GetResult, n)
+			for i := range gets {
+				gets[i] = batch.Get(fmt.Sprintf("large%v", i))
+			}
+			assert.Equal(t, n, batch.Len())
+			require.NoError(t, batch.Exec())
+
+			for i, get := range gets {
+				v, err := get.Result()
+				require.NoError(t, err)
+				require.NotNil(t, v)
+				assert.Equal(t, strconv.Itoa(i), *v)
+			}
+		})
+
 		t.Run("SMembers", func(t *testing.T) {
+			opts.require(t, CapabilitySets)
 			b := newBackend()
 
 			assert.NoError(t, b.SAdd("set", "a"))
@@ -701,6 +1194,7 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 		})
 
 		t.Run("ZAdd", func(t *testing.T) {
+			opts.require(t, CapabilitySortedSets)
 			b := newBackend()
 
 			batch := b.Batch()
@@ -722,7 +1216,27 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 			assert.NoError(t, err)
 		})
 
+		t.Run("ZHMAdd", func(t *testing.T) {
+			opts.require(t, CapabilitySortedSets)
+			b := newBackend()
+
+			batch := b.Batch()
+			add := batch.ZHMAdd("foo", []keyvaluestore.ZHEntry{
+				{Field: "a", Member: "av", Score: 1.0},
+				{Field: "b", Member: "bv", Score: 2.0},
+			})
+			empty := batch.ZHMAdd("foo", nil)
+			require.NoError(t, batch.Exec())
+			assert.NoError(t, add.Result())
+			assert.NoError(t, empty.Result())
+
+			members, err := b.ZHRangeByScore("foo", 0.0, 100.0, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"av", "bv"}, members)
+		})
+
 		t.Run("ZScore", func(t *testing.T) {
+			opts.require(t, CapabilitySortedSets)
 			b := newBackend()
 
 			assert.NoError(t, b.ZAdd("foo", "a", 0.0))
@@ -743,9 +1257,58 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 			score, _ = absent.Result()
 			assert.Nil(t, score)
 		})
+
+		t.Run("ZHRange", func(t *testing.T) {
+			opts.require(t, CapabilitySortedSets)
+			b := newBackend()
+
+			assert.NoError(t, b.ZHAdd("scores", "a", "av", 1.0))
+			assert.NoError(t, b.ZHAdd("scores", "b", "bv", 2.0))
+			assert.NoError(t, b.ZHAdd("scores", "c", "cv", 3.0))
+			assert.NoError(t, b.ZHAdd("lex", "a", "av", 0.0))
+			assert.NoError(t, b.ZHAdd("lex", "b", "bv", 0.0))
+			assert.NoError(t, b.ZHAdd("lex", "c", "cv", 0.0))
+
+			// Run the batch twice so that cached results are also tested.
+			for i := 0; i < 2; i++ {
+				batch := b.Batch()
+				byScore := batch.ZHRangeByScore("scores", 1.5, math.Inf(1), 0)
+				byScoreLimit := batch.ZHRangeByScore("scores", math.Inf(-1), math.Inf(1), 2)
+				revByScore := batch.ZHRevRangeByScore("scores", math.Inf(-1), 2.5, 0)
+				byLex := batch.ZHRangeByLex("lex", "(a", "+", 0)
+				revByLex := batch.ZHRevRangeByLex("lex", "-", "[b", 1)
+				empty := batch.ZHRangeByScore("absent", math.Inf(-1), math.Inf(1), 0)
+				require.NoError(t, batch.Exec())
+
+				members, err := byScore.Result()
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"bv", "cv"}, members)
+
+				members, err = byScoreLimit.Result()
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"av", "bv"}, members)
+
+				members, err = revByScore.Result()
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"bv", "av"}, members)
+
+				members, err = byLex.Result()
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"bv", "cv"}, members)
+
+				members, err = revByLex.Result()
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"bv"}, members)
+
+				members, err = empty.Result()
+				assert.NoError(t, err)
+				assert.Empty(t, members)
+			}
+		})
 	})
 
 	t.Run("SetEQ", func(t *testing.T) {
+		opts.parallel(t)
 		t.Run("Ok", func(t *testing.T) {
 			b := newBackend()
 
@@ -773,9 +1336,50 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 			require.NoError(t, err)
 			assert.Equal(t, "bar", *v)
 		})
+
+		t.Run("Types", func(t *testing.T) {
+			b := newBackend()
+
+			// Old values are compared using their canonical encodings, regardless of the types
+			// used to set them.
+			for _, tc := range []struct {
+				value    interface{}
+				oldValue interface{}
+			}{
+				{int64(10), "10"},
+				{"10", 10},
+				{uint64(10), int64(10)},
+				{[]byte("10"), uint(10)},
+				{&testBinaryMarshaler{}, "bar"},
+				{"bar", &testBinaryMarshaler{}},
+				{[]byte("bar"), &testBinaryMarshaler{}},
+				{true, 1},
+				{0.5, "0.5"},
+			} {
+				assert.NoError(t, b.Set("foo", tc.value))
+				success, err := b.SetEQ("foo", "qux", tc.oldValue)
+				assert.NoError(t, err)
+				assert.True(t, success, "%#v should equal %#v", tc.oldValue, tc.value)
+
+				tx := b.AtomicWrite()
+				assert.NoError(t, b.Set("foo", tc.value))
+				defer assertConditionPass(t, tx.SetEQ("foo", "qux", tc.oldValue))
+				ok, err := tx.Exec()
+				require.NoError(t, err)
+				assert.True(t, ok, "%#v should equal %#v", tc.oldValue, tc.value)
+			}
+
+			// Numbers aren't compared numerically.
+			assert.NoError(t, b.Set("foo", 10))
+			success, err := b.SetEQ("foo", "qux", "010")
+			assert.NoError(t, err)
+			assert.False(t, success)
+		})
 	})
 
 	t.Run("ZRem", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.ZAdd("foo", "a", 0.0))
@@ -792,7 +1396,41 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 		assert.Equal(t, []string{"b"}, members)
 	})
 
+	t.Run("ZHMAdd", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
+		b := newBackend()
+
+		assert.NoError(t, b.ZHMAdd("foo", nil))
+
+		assert.NoError(t, b.ZHAdd("foo", "f000", "old", 1000.0))
+
+		// Enough entries to require multiple requests with DynamoDB.
+		var entries []keyvaluestore.ZHEntry
+		var expected []string
+		for i := 0; i < 100; i++ {
+			field := fmt.Sprintf("f%03d", i)
+			entries = append(entries, keyvaluestore.ZHEntry{
+				Field:  field,
+				Member: "m" + field,
+				Score:  float64(i),
+			})
+			expected = append(expected, "m"+field)
+		}
+		assert.NoError(t, b.ZHMAdd("foo", entries))
+
+		members, err := b.ZHRangeByScore("foo", math.Inf(-1), math.Inf(1), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, members)
+
+		count, err := b.ZCount("foo", math.Inf(-1), math.Inf(1))
+		assert.NoError(t, err)
+		assert.Equal(t, 100, count)
+	})
+
 	t.Run("ZHRem", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.ZHAdd("foo", "f", "foo", 1.0))
@@ -809,7 +1447,39 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 		assert.Equal(t, []string{"foo"}, members)
 	})
 
+	t.Run("ZHRemEQ", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
+		b := newBackend()
+
+		assert.NoError(t, b.ZHAdd("foo", "f", "foo", 1.0))
+		assert.NoError(t, b.ZAdd("foo", "z", 2.0))
+
+		// The field was repointed, so it's left in place.
+		ok, err := b.ZHRemEQ("foo", "f", "bar")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = b.ZHRemEQ("foo", "missing", "foo")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = b.ZHRemEQ("foo", "f", "foo")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = b.ZHRemEQ("foo", "z", "z")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		members, err := b.ZHRangeByLex("foo", "-", "+", 0)
+		assert.NoError(t, err)
+		assert.Empty(t, members)
+	})
+
 	t.Run("ZRangeByScore", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.ZAdd("foo", "-2", -2.0))
@@ -878,7 +1548,83 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 		})
 	})
 
+	t.Run("ScoreRange", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
+		b := newBackend()
+
+		for _, score := range []float64{-1, 0, 0.5, 1, 2} {
+			assert.NoError(t, b.ZAdd("z", strconv.FormatFloat(score, 'g', -1, 64), score))
+			assert.NoError(t, b.ZHAdd("zh", "f"+strconv.FormatFloat(score, 'g', -1, 64), strconv.FormatFloat(score, 'g', -1, 64), score))
+		}
+
+		for name, tc := range map[string]struct {
+			Range    keyvaluestore.ScoreRange
+			Expected []string
+		}{
+			"Inclusive":        {keyvaluestore.ScoreRange{Min: 0, Max: 1}, []string{"0", "0.5", "1"}},
+			"MinExclusive":     {keyvaluestore.ScoreRange{Min: 0, Max: 1, MinExclusive: true}, []string{"0.5", "1"}},
+			"MaxExclusive":     {keyvaluestore.ScoreRange{Min: 0, Max: 1, MaxExclusive: true}, []string{"0", "0.5"}},
+			"Exclusive":        {keyvaluestore.ScoreRange{Min: 0, Max: 1, MinExclusive: true, MaxExclusive: true}, []string{"0.5"}},
+			"Empty":            {keyvaluestore.ScoreRange{Min: 1, Max: 1, MinExclusive: true}, []string{}},
+			"ExclusiveInf":     {keyvaluestore.ScoreRange{Min: math.Inf(-1), Max: math.Inf(1), MinExclusive: true, MaxExclusive: true}, []string{"-1", "0", "0.5", "1", "2"}},
+			"ExclusiveWithInf": {keyvaluestore.ScoreRange{Min: math.Inf(1), Max: math.Inf(1), MinExclusive: true}, []string{}},
+		} {
+			tc := tc
+			t.Run(name, func(t *testing.T) {
+				reversed := make([]string, len(tc.Expected))
+				for i, m := range tc.Expected {
+					reversed[len(reversed)-1-i] = m
+				}
+
+				members, err := keyvaluestore.ZRangeByScoreRange(b, "z", tc.Range, 0)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Expected, append([]string{}, members...))
+
+				members, err = keyvaluestore.ZRevRangeByScoreRange(b, "z", tc.Range, 0)
+				assert.NoError(t, err)
+				assert.Equal(t, reversed, append([]string{}, members...))
+
+				scored, err := keyvaluestore.ZRangeByScoreRangeWithScores(b, "z", tc.Range, 0)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Expected, scored.Values())
+
+				scored, err = keyvaluestore.ZRevRangeByScoreRangeWithScores(b, "z", tc.Range, 0)
+				assert.NoError(t, err)
+				assert.Equal(t, reversed, scored.Values())
+
+				members, err = keyvaluestore.ZHRangeByScoreRange(b, "zh", tc.Range, 0)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Expected, append([]string{}, members...))
+
+				members, err = keyvaluestore.ZHRevRangeByScoreRange(b, "zh", tc.Range, 0)
+				assert.NoError(t, err)
+				assert.Equal(t, reversed, append([]string{}, members...))
+
+				scored, err = keyvaluestore.ZHRangeByScoreRangeWithScores(b, "zh", tc.Range, 0)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Expected, scored.Values())
+
+				scored, err = keyvaluestore.ZHRevRangeByScoreRangeWithScores(b, "zh", tc.Range, 0)
+				assert.NoError(t, err)
+				assert.Equal(t, reversed, scored.Values())
+
+				n, err := keyvaluestore.ZCountRange(b, "z", tc.Range)
+				assert.NoError(t, err)
+				assert.Equal(t, len(tc.Expected), n)
+			})
+		}
+
+		t.Run("Limit", func(t *testing.T) {
+			members, err := keyvaluestore.ZRangeByScoreRange(b, "z", keyvaluestore.ScoreRange{Min: 0, Max: 2, MinExclusive: true}, 2)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"0.5", "1"}, members)
+		})
+	})
+
 	t.Run("ZHRangeByScore", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.ZHAdd("foo", "a", "-2", -2.0))
@@ -928,19 +1674,6 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 			})
 		})
 
-		// to make migrations easier, zhrange functions should also return zadded members since it
-		// doesn't really cost us anything
-		t.Run("ZAddMigration", func(t *testing.T) {
-			assert.NoError(t, b.ZAdd("zaddtest", "a", 0.0))
-			assert.NoError(t, b.ZHAdd("zaddtest", "b", "bob", 0.0))
-			assert.NoError(t, b.ZAdd("zaddtest", "c", 0.0))
-			assert.NoError(t, b.ZHAdd("zaddtest", "d", "dan", 0.0))
-
-			members, err := b.ZHRangeByScore("zaddtest", -0.5, 1.0, 0)
-			assert.NoError(t, err)
-			assert.Equal(t, []string{"a", "bob", "c", "dan"}, members)
-		})
-
 		t.Run("Update", func(t *testing.T) {
 			assert.NoError(t, b.ZHAdd("update-test", "f", "foo", 2.0))
 
@@ -960,7 +1693,92 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 		})
 	})
 
+	t.Run("ZHRangeWithMetadata", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
+		b := newBackend()
+
+		assert.NoError(t, keyvaluestore.ZHAddWithMetadata(b, "foo", "a", "av", map[string]string{"flags": "pinned"}, 1))
+		assert.NoError(t, b.ZHAdd("foo", "b", "bv", 2))
+
+		tx := b.AtomicWrite()
+		tx.ZHAdd("foo", "c", keyvaluestore.WithMetadata("cv", map[string]string{"expires": "100"}), 3)
+		ok, err := tx.Exec()
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		members, err := keyvaluestore.ZHRangeByScoreWithMetadata(b, "foo", math.Inf(-1), math.Inf(1), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, keyvaluestore.MetadataScoredMembers{
+			{Value: "av", Score: 1, Metadata: map[string]string{"flags": "pinned"}},
+			{Value: "bv", Score: 2},
+			{Value: "cv", Score: 3, Metadata: map[string]string{"expires": "100"}},
+		}, members)
+
+		members, err = keyvaluestore.ZHRevRangeByScoreWithMetadata(b, "foo", math.Inf(-1), math.Inf(1), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"cv"}, members.Values())
+	})
+
+	t.Run("ZHRangeWithFields", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
+		b := newBackend()
+
+		if _, err := keyvaluestore.ZHRangeByScoreWithFields(b, "foo", 0, 0, 0); errors.Is(err, keyvaluestore.ErrNotSupported) {
+			t.Skip("backend doesn't support sorted hash fields")
+		}
+
+		assert.NoError(t, b.ZHAdd("foo", "a", "x", 1.0))
+		assert.NoError(t, b.ZHAdd("foo", "b", "y", 2.0))
+		assert.NoError(t, b.ZAdd("foo", "c", 3.0))
+		assert.NoError(t, b.ZHAdd("foo", "d", "z", 4.0))
+
+		t.Run("Score", func(t *testing.T) {
+			members, err := keyvaluestore.ZHRangeByScoreWithFields(b, "foo", 2.0, math.Inf(1), 2)
+			assert.NoError(t, err)
+			assert.Equal(t, keyvaluestore.FieldScoredMembers{
+				{Field: "b", Value: "y", Score: 2.0},
+				{Field: "c", Value: "c", Score: 3.0},
+			}, members)
+
+			members, err = keyvaluestore.ZHRevRangeByScoreWithFields(b, "foo", math.Inf(-1), 2.0, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, keyvaluestore.FieldScoredMembers{
+				{Field: "b", Value: "y", Score: 2.0},
+				{Field: "a", Value: "x", Score: 1.0},
+			}, members)
+
+			members, err = keyvaluestore.ZHRangeByScoreWithFields(b, "bar", math.Inf(-1), math.Inf(1), 0)
+			assert.NoError(t, err)
+			assert.Empty(t, members)
+		})
+
+		t.Run("Lex", func(t *testing.T) {
+			opts.require(t, CapabilityLexRanges)
+
+			assert.NoError(t, b.ZHAdd("lex", "a", "x", 0.0))
+			assert.NoError(t, b.ZHAdd("lex", "b", "y", 0.0))
+			assert.NoError(t, b.ZHAdd("lex", "c", "z", 0.0))
+
+			members, err := keyvaluestore.ZHRangeByLexWithFields(b, "lex", "(a", "+", 0)
+			assert.NoError(t, err)
+			assert.Equal(t, keyvaluestore.FieldScoredMembers{
+				{Field: "b", Value: "y"},
+				{Field: "c", Value: "z"},
+			}, members)
+
+			members, err = keyvaluestore.ZHRevRangeByLexWithFields(b, "lex", "-", "[b", 1)
+			assert.NoError(t, err)
+			assert.Equal(t, keyvaluestore.FieldScoredMembers{
+				{Field: "b", Value: "y"},
+			}, members)
+		})
+	})
+
 	t.Run("ZRangeByLex", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets, CapabilityLexRanges)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.ZAdd("foo", "a", 0.0))
@@ -1044,6 +1862,8 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("ZHRangeByLex", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets, CapabilityLexRanges)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.ZHAdd("foo", "w", "alice", 0.0))
@@ -1093,19 +1913,6 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 			assert.Empty(t, members)
 		})
 
-		// to make migrations easier, zhrange functions should also return zadded members since it
-		// doesn't really cost us anything
-		t.Run("ZAddMigration", func(t *testing.T) {
-			assert.NoError(t, b.ZAdd("zaddtest", "a", 0.0))
-			assert.NoError(t, b.ZHAdd("zaddtest", "b", "bob", 0.0))
-			assert.NoError(t, b.ZAdd("zaddtest", "c", 0.0))
-			assert.NoError(t, b.ZHAdd("zaddtest", "d", "dan", 0.0))
-
-			members, err := b.ZHRangeByLex("zaddtest", "-", "+", 0)
-			assert.NoError(t, err)
-			assert.Equal(t, []string{"a", "bob", "c", "dan"}, members)
-		})
-
 		t.Run("Rev", func(t *testing.T) {
 			t.Run("Inf", func(t *testing.T) {
 				members, err := b.ZHRevRangeByLex("foo", "-", "+", 0)
@@ -1139,7 +1946,113 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 		})
 	})
 
+	t.Run("ZAddMigration", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
+		testZAddMigration(t, newBackend(), opts)
+	})
+
+	t.Run("RenameCollection", func(t *testing.T) {
+		opts.parallel(t)
+		b := newBackend()
+		if !keyvaluestore.Supports(b, keyvaluestore.FeatureRename) {
+			t.Skip("backend doesn't support renaming")
+		}
+		testRenameCollection(t, b, opts)
+	})
+
+	t.Run("ZCountApprox", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
+		b := newBackend()
+
+		n, err := keyvaluestore.ZCountApprox(b, "foo", math.Inf(-1), math.Inf(1))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, n)
+
+		for i := 0; i < 20; i++ {
+			require.NoError(t, b.ZAdd("foo", strconv.Itoa(i), float64(i%10)))
+		}
+		require.NoError(t, b.ZHAdd("foo", "f", "bar", 3.5))
+
+		// Small ranges must be counted exactly.
+		for _, r := range [][2]float64{
+			{math.Inf(-1), math.Inf(1)},
+			{0, 9},
+			{2, 5},
+			{3.5, 3.5},
+			{9, math.Inf(1)},
+			{10, 20},
+			{5, 2},
+		} {
+			expected, err := b.ZCount("foo", r[0], r[1])
+			require.NoError(t, err)
+			n, err := keyvaluestore.ZCountApprox(b, "foo", r[0], r[1])
+			assert.NoError(t, err)
+			assert.Equal(t, expected, n, "range %v", r)
+		}
+	})
+
+	t.Run("PageTokens", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
+		b := newBackend()
+
+		// Several members share each score so that pages begin and end between them.
+		for i := 0; i < 13; i++ {
+			require.NoError(t, b.ZAdd("foo", fmt.Sprintf("m%02d", i), float64(i/4)))
+			require.NoError(t, b.ZHAdd("bar", fmt.Sprintf("f%02d", i), fmt.Sprintf("v%v", 12-i), float64(i/4)))
+		}
+
+		paginate := func(first keyvaluestore.ScoredMembers, next func(after keyvaluestore.PageToken) (keyvaluestore.ScoredMembers, error)) keyvaluestore.ScoredMembers {
+			all := first
+			for page := first; len(page) > 0; {
+				token, err := keyvaluestore.ParsePageToken(page[len(page)-1].PageToken().String())
+				require.NoError(t, err)
+				page, err = next(token)
+				require.NoError(t, err)
+				all = append(all, page...)
+			}
+			return all
+		}
+
+		expected, err := b.ZRangeByScoreWithScores("foo", math.Inf(-1), 2, 0)
+		require.NoError(t, err)
+		first, err := b.ZRangeByScoreWithScores("foo", math.Inf(-1), 2, 3)
+		require.NoError(t, err)
+		assert.Equal(t, expected, paginate(first, func(after keyvaluestore.PageToken) (keyvaluestore.ScoredMembers, error) {
+			return keyvaluestore.ZRangeByScoreAfter(b, "foo", after, 2, 3)
+		}))
+
+		expected, err = b.ZRevRangeByScoreWithScores("foo", 1, math.Inf(1), 0)
+		require.NoError(t, err)
+		first, err = b.ZRevRangeByScoreWithScores("foo", 1, math.Inf(1), 3)
+		require.NoError(t, err)
+		assert.Equal(t, expected, paginate(first, func(after keyvaluestore.PageToken) (keyvaluestore.ScoredMembers, error) {
+			return keyvaluestore.ZRevRangeByScoreAfter(b, "foo", after, 1, 3)
+		}))
+
+		members, err := keyvaluestore.ZRangeByScoreAfter(b, "foo", keyvaluestore.PageToken{Score: 1, Member: "m05"}, math.Inf(1), 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"m06", "m07", "m08", "m09", "m10", "m11", "m12"}, members.Values())
+
+		if _, err := keyvaluestore.ZHRangeByScoreWithFields(b, "bar", 0, 0, 0); errors.Is(err, keyvaluestore.ErrNotSupported) {
+			return
+		}
+
+		fields, err := keyvaluestore.ZHRangeByScoreWithFieldsAfter(b, "bar", keyvaluestore.PageToken{Score: 1, Member: "f05"}, 2, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"f06", "f07"}, fields.Fields())
+		assert.Equal(t, []string{"v6", "v5"}, fields.Values())
+
+		fields, err = keyvaluestore.ZHRevRangeByScoreWithFieldsAfter(b, "bar", fields[1].PageToken(), math.Inf(-1), 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"f06", "f05", "f04", "f03", "f02", "f01", "f00"}, fields.Fields())
+	})
+
 	t.Run("ZScore", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.ZAdd("foo", "a", 0.0))
@@ -1168,6 +2081,8 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("ZCount", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.ZAdd("foo", "a", 0.0))
@@ -1192,6 +2107,22 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 			assert.Equal(t, tc.expected, n, fmt.Sprintf("%#v %#v", tc.min, tc.max))
 		}
 
+		t.Run("AfterUpdates", func(t *testing.T) {
+			assert.NoError(t, b.ZAdd("foo", "a", 10.0))
+			assert.NoError(t, b.ZRem("foo", "b"))
+			assert.NoError(t, b.ZRem("foo", "x"))
+			_, err := b.ZIncrBy("foo", "g", 1.0)
+			assert.NoError(t, err)
+
+			n, err := b.ZCount("foo", math.Inf(-1), math.Inf(1))
+			assert.NoError(t, err)
+			assert.Equal(t, 6, n)
+
+			n, err = b.ZLexCount("foo", "-", "+")
+			assert.NoError(t, err)
+			assert.Equal(t, 6, n)
+		})
+
 		// DynamoDB has to paginate requests for ZCounts on big sets.
 		t.Run("BigZSet", func(t *testing.T) {
 			bigString := strings.Repeat("x", 1000)
@@ -1205,6 +2136,8 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("ZLexCount", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets, CapabilityLexRanges)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.ZAdd("foo", "a", 0.0))
@@ -1240,6 +2173,8 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("ZIncrBy", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
 		b := newBackend()
 
 		t.Run("ExistingKey", func(t *testing.T) {
@@ -1326,6 +2261,8 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("ZRangeByScoreWithScores", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.ZAdd("foo", "-2", -2.0))
@@ -1378,6 +2315,8 @@ func TestBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
 	})
 
 	t.Run("ZRevRangeByScoreWithScores", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+		opts.parallel(t)
 		b := newBackend()
 
 		assert.NoError(t, b.ZAdd("foo", "-2", -2.0))
@@ -0,0 +1,41 @@
+package keyvaluestoretest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// TestBatchErrors tests that a failed operation doesn't prevent the rest of a batch from being
+// executed, and that Exec reports the failure via a *keyvaluestore.BatchError. addFailure should
+// add an operation to the batch that will fail, using the backend to set up the failure if needed.
+func TestBatchErrors(t *testing.T, newBackend func() keyvaluestore.Backend, addFailure func(b keyvaluestore.Backend, batch keyvaluestore.BatchOperation) keyvaluestore.ErrorResult) {
+	b := newBackend()
+	require.NoError(t, b.Set("batch-errors-foo", "bar"))
+
+	batch := b.Batch()
+	get := batch.Get("batch-errors-foo")
+	failure := addFailure(b, batch)
+	set := batch.Set("batch-errors-baz", "qux")
+
+	err := batch.Exec()
+	var batchErr *keyvaluestore.BatchError
+	require.True(t, errors.As(err, &batchErr), "Exec should return a *BatchError, not %v", err)
+	assert.NotEmpty(t, batchErr.Errors)
+	assert.Error(t, failure.Result())
+
+	v, err := get.Result()
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, "bar", *v)
+
+	require.NoError(t, set.Result())
+	v, err = b.Get("batch-errors-baz")
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, "qux", *v)
+}
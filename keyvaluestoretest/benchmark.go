@@ -0,0 +1,103 @@
+package keyvaluestoretest
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+const benchmarkKeyCount = 1000
+
+// BenchmarkBackend measures the performance of a backend's most common operations. The results
+// are reported using the same sub-benchmark names for every backend so that they can be compared.
+func BenchmarkBackend(b *testing.B, newBackend func() keyvaluestore.Backend) {
+	b.Run("Get", func(b *testing.B) {
+		backend := newBackend()
+		for i := 0; i < benchmarkKeyCount; i++ {
+			if err := backend.Set("key"+strconv.Itoa(i), "value"); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := backend.Get("key" + strconv.Itoa(i%benchmarkKeyCount)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Set", func(b *testing.B) {
+		backend := newBackend()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := backend.Set("key"+strconv.Itoa(i%benchmarkKeyCount), "value"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("BatchGet", func(b *testing.B) {
+		backend := newBackend()
+		for i := 0; i < benchmarkKeyCount; i++ {
+			if err := backend.Set("key"+strconv.Itoa(i), "value"); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			batch := backend.Batch()
+			for j := 0; j < 100; j++ {
+				batch.Get("key" + strconv.Itoa((i+j)%benchmarkKeyCount))
+			}
+			if err := batch.Exec(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("ZRangeByScore", func(b *testing.B) {
+		backend := newBackend()
+		for i := 0; i < benchmarkKeyCount; i++ {
+			if err := backend.ZAdd("zset", i, float64(i)); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			min := float64(i % (benchmarkKeyCount - 100))
+			if _, err := backend.ZRangeByScore("zset", min, min+100, 10); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("ZRangeByLex", func(b *testing.B) {
+		backend := newBackend()
+		for i := 0; i < benchmarkKeyCount; i++ {
+			if err := backend.ZAdd("zset", strconv.Itoa(i), 0.0); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := backend.ZRangeByLex("zset", "[1", "(2", 10); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("AtomicWrite", func(b *testing.B) {
+		backend := newBackend()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			key := "key" + strconv.Itoa(i%benchmarkKeyCount)
+			tx := backend.AtomicWrite()
+			tx.Set(key, "value")
+			tx.ZAdd("zset", key, float64(i))
+			if _, err := tx.Exec(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package keyvaluestoretest
+
+import "testing"
+
+// Capability identifies a group of features that a backend may or may not implement.
+type Capability string
+
+const (
+	CapabilitySets        Capability = "sets"
+	CapabilityHashes      Capability = "hashes"
+	CapabilitySortedSets  Capability = "sorted sets"
+	CapabilityLexRanges   Capability = "sorted set lexicographical ranges"
+	CapabilityLargeValues Capability = "large values"
+	CapabilityAtomicWrite Capability = "atomic writes"
+	CapabilityBatch       Capability = "batches"
+)
+
+// Options can be used to tailor the conformance tests to a backend.
+type Options struct {
+	// Unsupported lists the capabilities that the backend doesn't implement. The tests for them
+	// are explicitly skipped rather than run.
+	Unsupported []Capability
+
+	// If true, a single backend is created and each test operates on it under a unique key prefix.
+	// This allows the tests to run in parallel, which is much faster for remote backends.
+	Parallel bool
+}
+
+func (o Options) supports(c Capability) bool {
+	for _, unsupported := range o.Unsupported {
+		if unsupported == c {
+			return false
+		}
+	}
+	return true
+}
+
+// parallel signals that the test can be run in parallel if enabled.
+func (o Options) parallel(t *testing.T) {
+	if o.Parallel {
+		t.Parallel()
+	}
+}
+
+// require skips the test if any of the given capabilities are unsupported.
+func (o Options) require(t *testing.T, capabilities ...Capability) {
+	for _, c := range capabilities {
+		if !o.supports(c) {
+			t.Skipf("backend doesn't support %v", c)
+		}
+	}
+}
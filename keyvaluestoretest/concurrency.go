@@ -0,0 +1,221 @@
+package keyvaluestoretest
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorelock"
+)
+
+const (
+	concurrencyWriters = 10
+	concurrencyLoops   = 10
+
+	// Backends may fail operations due to contention, so errors are retried as long as they don't
+	// happen too many times in a row.
+	concurrencyMaxErrorStreak = 100
+)
+
+// runConcurrently runs f from concurrencyWriters goroutines until each of them has succeeded
+// concurrencyLoops times. f returns false if the operation needs to be retried, e.g. because a
+// conditional failed.
+func runConcurrently(t *testing.T, f func(writer int) (bool, error)) {
+	var wg sync.WaitGroup
+	for i := 0; i < concurrencyWriters; i++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			successful := 0
+			errorStreak := 0
+			for successful < concurrencyLoops {
+				ok, err := f(writer)
+				if err != nil {
+					errorStreak++
+					if !assert.Less(t, errorStreak, concurrencyMaxErrorStreak, "last error: %v", err) {
+						return
+					}
+					continue
+				}
+				errorStreak = 0
+				if ok {
+					successful++
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestBackendConcurrency hammers a backend's conditional and atomic operations from many
+// goroutines and verifies that no updates are lost and that conditionals are never violated.
+func TestBackendConcurrency(t *testing.T, newBackend func() keyvaluestore.Backend) {
+	total := concurrencyWriters * concurrencyLoops
+
+	t.Run("SetNX", func(t *testing.T) {
+		b := newBackend()
+
+		var wg sync.WaitGroup
+		winners := make(chan string, concurrencyWriters)
+		for i := 0; i < concurrencyWriters; i++ {
+			wg.Add(1)
+			go func(writer int) {
+				defer wg.Done()
+				id := strconv.Itoa(writer)
+				ok, err := b.SetNX("foo", id)
+				if assert.NoError(t, err) && ok {
+					winners <- id
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(winners)
+
+		var ids []string
+		for id := range winners {
+			ids = append(ids, id)
+		}
+		require.Len(t, ids, 1)
+
+		v, err := b.Get("foo")
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		assert.Equal(t, ids[0], *v)
+	})
+
+	t.Run("SetEQ", func(t *testing.T) {
+		b := newBackend()
+		require.NoError(t, b.Set("foo", "0"))
+
+		runConcurrently(t, func(int) (bool, error) {
+			v, err := b.Get("foo")
+			if err != nil || v == nil {
+				return false, err
+			}
+			n, err := strconv.Atoi(*v)
+			if err != nil {
+				return false, err
+			}
+			return b.SetEQ("foo", strconv.Itoa(n+1), *v)
+		})
+
+		v, err := b.Get("foo")
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		assert.Equal(t, strconv.Itoa(total), *v)
+	})
+
+	t.Run("NIncrBy", func(t *testing.T) {
+		b := newBackend()
+
+		runConcurrently(t, func(int) (bool, error) {
+			_, err := b.NIncrBy("foo", 1)
+			return true, err
+		})
+
+		n, err := b.NIncrBy("foo", 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(total), n)
+	})
+
+	t.Run("ZIncrBy", func(t *testing.T) {
+		b := newBackend()
+
+		runConcurrently(t, func(writer int) (bool, error) {
+			_, err := b.ZIncrBy("foo", strconv.Itoa(writer%2), 1)
+			return true, err
+		})
+
+		members, err := b.ZRangeByScoreWithScores("foo", 0, float64(total), 0)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, keyvaluestore.ScoredMembers{
+			{Score: float64(total / 2), Value: "0"},
+			{Score: float64(total / 2), Value: "1"},
+		}, members)
+	})
+
+	t.Run("AtomicWrite", func(t *testing.T) {
+		b := newBackend()
+		require.NoError(t, b.Set("counter", "0"))
+
+		// Each successful write increments the counter and records the new value in a sorted set.
+		// If the writes are atomic and their conditionals hold, the set will contain every value
+		// exactly once.
+		runConcurrently(t, func(writer int) (bool, error) {
+			v, err := b.Get("counter")
+			if err != nil || v == nil {
+				return false, err
+			}
+			n, err := strconv.Atoi(*v)
+			if err != nil {
+				return false, err
+			}
+			tx := b.AtomicWrite()
+			tx.SetEQ("counter", strconv.Itoa(n+1), *v)
+			tx.ZAdd("values", n+1, float64(n+1))
+			tx.ZAdd("writers", keyvaluestore.Key{strconv.Itoa(n + 1), strconv.Itoa(writer)}.String(), float64(writer))
+			ok, err := tx.Exec()
+			if keyvaluestore.IsAtomicWriteConflict(err) {
+				return false, nil
+			}
+			return ok, err
+		})
+
+		v, err := b.Get("counter")
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		assert.Equal(t, strconv.Itoa(total), *v)
+
+		values, err := b.ZRangeByScore("values", 0, float64(total), 0)
+		require.NoError(t, err)
+		expected := make([]string, total)
+		for i := range expected {
+			expected[i] = strconv.Itoa(i + 1)
+		}
+		assert.Equal(t, expected, values)
+
+		for writer := 0; writer < concurrencyWriters; writer++ {
+			n, err := b.ZCount("writers", float64(writer), float64(writer))
+			require.NoError(t, err)
+			assert.Equal(t, concurrencyLoops, n)
+		}
+	})
+
+	t.Run("Mutex", func(t *testing.T) {
+		b := newBackend()
+
+		// Each successful acquisition checks that nobody else holds the lock and that its fencing
+		// token is greater than all previous ones.
+		var holders int32
+		var tokenMutex sync.Mutex
+		var lastToken int64
+		runConcurrently(t, func(int) (bool, error) {
+			m := &keyvaluestorelock.Mutex{
+				Backend: b,
+				Key:     "lock",
+			}
+			if ok, err := m.Acquire(time.Minute); err != nil || !ok {
+				return false, err
+			}
+
+			assert.Equal(t, int32(1), atomic.AddInt32(&holders, 1), "the lock should have one holder at a time")
+			tokenMutex.Lock()
+			assert.Greater(t, m.Token(), lastToken, "fencing tokens should increase")
+			lastToken = m.Token()
+			tokenMutex.Unlock()
+			atomic.AddInt32(&holders, -1)
+
+			ok, err := m.Release()
+			assert.True(t, ok || err != nil, "the lock should still be held")
+			return ok, err
+		})
+
+		assert.Equal(t, int64(total), lastToken)
+	})
+}
@@ -0,0 +1,292 @@
+package keyvaluestoretest
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// errorBackend is the backend given to wrappers under test by TestWrapper. Every method returns a
+// *wrapperError. Atomic writes fail on Exec.
+//
+// keyvaluestoremock can't be used for this because it depends on memorystore, whose tests depend
+// on this package.
+type errorBackend struct{}
+
+var _ keyvaluestore.Backend = &errorBackend{}
+
+// Batch returns a batch that executes each of its operations via the backend's methods, so they
+// all fail.
+func (b *errorBackend) Batch() keyvaluestore.BatchOperation {
+	return &keyvaluestore.FallbackBatchOperation{
+		Backend: b,
+	}
+}
+
+func (b *errorBackend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return &errorAtomicWriteOperation{}
+}
+
+func (b *errorBackend) Ping() error {
+	return &wrapperError{method: "Ping"}
+}
+
+func (b *errorBackend) Close() error {
+	return &wrapperError{method: "Close"}
+}
+
+func (b *errorBackend) Delete(key string) (success bool, err error) {
+	return false, &wrapperError{method: "Delete"}
+}
+
+func (b *errorBackend) Get(key string) (*string, error) {
+	return nil, &wrapperError{method: "Get"}
+}
+
+func (b *errorBackend) Set(key string, value interface{}) error {
+	return &wrapperError{method: "Set"}
+}
+
+func (b *errorBackend) SetXX(key string, value interface{}) (bool, error) {
+	return false, &wrapperError{method: "SetXX"}
+}
+
+func (b *errorBackend) SetNX(key string, value interface{}) (bool, error) {
+	return false, &wrapperError{method: "SetNX"}
+}
+
+func (b *errorBackend) SetEQ(key string, value, oldValue interface{}) (success bool, err error) {
+	return false, &wrapperError{method: "SetEQ"}
+}
+
+func (b *errorBackend) NIncrBy(key string, n int64) (int64, error) {
+	return 0, &wrapperError{method: "NIncrBy"}
+}
+
+func (b *errorBackend) SAdd(key string, member interface{}, members ...interface{}) error {
+	return &wrapperError{method: "SAdd"}
+}
+
+func (b *errorBackend) SRem(key string, member interface{}, members ...interface{}) error {
+	return &wrapperError{method: "SRem"}
+}
+
+func (b *errorBackend) SMembers(key string) ([]string, error) {
+	return nil, &wrapperError{method: "SMembers"}
+}
+
+func (b *errorBackend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	return &wrapperError{method: "HSet"}
+}
+
+func (b *errorBackend) HDel(key, field string, fields ...string) error {
+	return &wrapperError{method: "HDel"}
+}
+
+func (b *errorBackend) HGet(key, field string) (*string, error) {
+	return nil, &wrapperError{method: "HGet"}
+}
+
+func (b *errorBackend) HGetAll(key string) (map[string]string, error) {
+	return nil, &wrapperError{method: "HGetAll"}
+}
+
+func (b *errorBackend) ZAdd(key string, member interface{}, score float64) error {
+	return &wrapperError{method: "ZAdd"}
+}
+
+func (b *errorBackend) ZScore(key string, member interface{}) (*float64, error) {
+	return nil, &wrapperError{method: "ZScore"}
+}
+
+func (b *errorBackend) ZRem(key string, member interface{}) error {
+	return &wrapperError{method: "ZRem"}
+}
+
+func (b *errorBackend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	return 0, &wrapperError{method: "ZIncrBy"}
+}
+
+func (b *errorBackend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return nil, &wrapperError{method: "ZRangeByScore"}
+}
+
+func (b *errorBackend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return nil, &wrapperError{method: "ZRangeByScoreWithScores"}
+}
+
+func (b *errorBackend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return nil, &wrapperError{method: "ZRevRangeByScore"}
+}
+
+func (b *errorBackend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return nil, &wrapperError{method: "ZRevRangeByScoreWithScores"}
+}
+
+func (b *errorBackend) ZCount(key string, min, max float64) (int, error) {
+	return 0, &wrapperError{method: "ZCount"}
+}
+
+func (b *errorBackend) ZLexCount(key string, min, max string) (int, error) {
+	return 0, &wrapperError{method: "ZLexCount"}
+}
+
+func (b *errorBackend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return nil, &wrapperError{method: "ZRangeByLex"}
+}
+
+func (b *errorBackend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return nil, &wrapperError{method: "ZRevRangeByLex"}
+}
+
+func (b *errorBackend) ZHAdd(key, field string, member interface{}, score float64) error {
+	return &wrapperError{method: "ZHAdd"}
+}
+
+func (b *errorBackend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	return &wrapperError{method: "ZHMAdd"}
+}
+
+func (b *errorBackend) ZHRem(key, field string) error {
+	return &wrapperError{method: "ZHRem"}
+}
+
+func (b *errorBackend) ZHRemEQ(key, field string, member interface{}) (success bool, err error) {
+	return false, &wrapperError{method: "ZHRemEQ"}
+}
+
+func (b *errorBackend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return nil, &wrapperError{method: "ZHRangeByScore"}
+}
+
+func (b *errorBackend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return nil, &wrapperError{method: "ZHRangeByScoreWithScores"}
+}
+
+func (b *errorBackend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return nil, &wrapperError{method: "ZHRevRangeByScore"}
+}
+
+func (b *errorBackend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return nil, &wrapperError{method: "ZHRevRangeByScoreWithScores"}
+}
+
+func (b *errorBackend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return nil, &wrapperError{method: "ZHRangeByLex"}
+}
+
+func (b *errorBackend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return nil, &wrapperError{method: "ZHRevRangeByLex"}
+}
+
+func (b *errorBackend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	return b
+}
+
+func (b *errorBackend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	return b
+}
+
+func (b *errorBackend) Unwrap() keyvaluestore.Backend {
+	return nil
+}
+
+type errorAtomicWriteResult struct{}
+
+func (errorAtomicWriteResult) ConditionalFailed() bool {
+	return false
+}
+
+type errorAtomicWriteOperation struct{}
+
+var _ keyvaluestore.AtomicWriteOperation = &errorAtomicWriteOperation{}
+
+func (op *errorAtomicWriteOperation) Set(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) SetNX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) SetXX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) Delete(key string) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) NIncrBy(key string, n int64) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) ZAddNX(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) ZRem(key string, member interface{}) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) ZHAdd(key, field string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) HSetNX(key, field string, value interface{}) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) HDel(key, field string, fields ...string) keyvaluestore.AtomicWriteResult {
+	return errorAtomicWriteResult{}
+}
+
+func (op *errorAtomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	return op
+}
+
+func (op *errorAtomicWriteOperation) Validate() error {
+	return nil
+}
+
+func (op *errorAtomicWriteOperation) Exec() (bool, error) {
+	return false, &wrapperError{method: "AtomicWrite"}
+}
@@ -0,0 +1,223 @@
+package keyvaluestoretest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// goldenFixture is the format of the files in the golden directory. Each file contains cases that
+// pin down semantics that are easy for backends to get subtly wrong.
+type goldenFixture struct {
+	Cases []goldenCase `json:"cases"`
+}
+
+type goldenCase struct {
+	Name     string       `json:"name"`
+	Requires []Capability `json:"requires"`
+	Steps    []goldenStep `json:"steps"`
+}
+
+// goldenStep invokes a backend method. Floating point arguments may be given as "+inf" or "-inf".
+// If Expect is given, the method's results (excluding the error) must match it. Pointers are
+// compared by the values they point to, and empty slices and maps are equivalent to null.
+type goldenStep struct {
+	Op     string            `json:"op"`
+	Args   []json.RawMessage `json:"args"`
+	Expect []json.RawMessage `json:"expect"`
+	Error  bool              `json:"error"`
+}
+
+func goldenDirectory() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "golden")
+}
+
+// TestBackendGolden runs the golden fixtures against a backend. It's run as part of TestBackend.
+func TestBackendGolden(t *testing.T, newBackend func() keyvaluestore.Backend) {
+	TestBackendGoldenWithOptions(t, newBackend, Options{})
+}
+
+// TestBackendGoldenWithOptions is like TestBackendGolden, but accepts the same options as
+// TestBackendWithOptions.
+func TestBackendGoldenWithOptions(t *testing.T, newBackend func() keyvaluestore.Backend, opts Options) {
+	paths, err := filepath.Glob(filepath.Join(goldenDirectory(), "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, paths, "no golden fixtures found")
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		path := path
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			buf, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+			var fixture goldenFixture
+			require.NoError(t, json.Unmarshal(buf, &fixture))
+
+			for _, c := range fixture.Cases {
+				c := c
+				t.Run(c.Name, func(t *testing.T) {
+					opts.require(t, c.Requires...)
+					opts.parallel(t)
+					b := newBackend()
+					for i, step := range c.Steps {
+						if !runGoldenStep(t, b, step) {
+							t.Fatalf("step %v (%v) failed", i, step.Op)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func runGoldenStep(t *testing.T, b keyvaluestore.Backend, step goldenStep) bool {
+	method := reflect.ValueOf(b).MethodByName(step.Op)
+	if !assert.True(t, method.IsValid(), "unknown operation %v", step.Op) {
+		return false
+	}
+	methodType := method.Type()
+
+	var args []reflect.Value
+	for i, raw := range step.Args {
+		var paramType reflect.Type
+		if methodType.IsVariadic() && i >= methodType.NumIn()-1 {
+			paramType = methodType.In(methodType.NumIn() - 1).Elem()
+		} else if i < methodType.NumIn() {
+			paramType = methodType.In(i)
+		} else {
+			assert.Fail(t, "too many arguments")
+			return false
+		}
+		arg, err := decodeGoldenArg(raw, paramType)
+		if !assert.NoError(t, err, "argument %v", i) {
+			return false
+		}
+		args = append(args, arg)
+	}
+
+	results := method.Call(args)
+	err, _ := results[len(results)-1].Interface().(error)
+	if step.Error {
+		return assert.Error(t, err)
+	} else if !assert.NoError(t, err) {
+		return false
+	}
+
+	if step.Expect == nil {
+		return true
+	}
+	results = results[:len(results)-1]
+	if !assert.Len(t, step.Expect, len(results)) {
+		return false
+	}
+	for i, raw := range step.Expect {
+		var expected interface{}
+		if !assert.NoError(t, json.Unmarshal(raw, &expected)) {
+			return false
+		}
+		if !assert.Equal(t, normalizeGoldenValue(reflect.ValueOf(expected)), normalizeGoldenValue(results[i]), "result %v", i) {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeGoldenArg(raw json.RawMessage, t reflect.Type) (reflect.Value, error) {
+	switch t.Kind() {
+	case reflect.Float64:
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			switch s {
+			case "+inf":
+				return reflect.ValueOf(math.Inf(1)), nil
+			case "-inf":
+				return reflect.ValueOf(math.Inf(-1)), nil
+			}
+			return reflect.Value{}, fmt.Errorf("invalid float: %v", s)
+		}
+	case reflect.Interface:
+		// Only strings and integers can be used as values.
+		var v interface{}
+		decoder := json.NewDecoder(strings.NewReader(string(raw)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err != nil {
+			return reflect.Value{}, err
+		}
+		if n, ok := v.(json.Number); ok {
+			i, err := n.Int64()
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v = i
+		}
+		return reflect.ValueOf(&v).Elem(), nil
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(raw, v.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return v.Elem(), nil
+}
+
+// normalizeGoldenValue converts a value into a form that can be compared to a decoded JSON value.
+func normalizeGoldenValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return normalizeGoldenValue(v.Elem())
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return nil
+		}
+		ret := make([]interface{}, v.Len())
+		for i := range ret {
+			ret[i] = normalizeGoldenValue(v.Index(i))
+		}
+		return ret
+	case reflect.Map:
+		if v.Len() == 0 {
+			return nil
+		}
+		ret := map[string]interface{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			ret[fmt.Sprint(iter.Key().Interface())] = normalizeGoldenValue(iter.Value())
+		}
+		return ret
+	case reflect.Struct:
+		ret := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			ret[v.Type().Field(i).Name] = normalizeGoldenValue(v.Field(i))
+		}
+		return ret
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsInf(f, 1) {
+			return "+inf"
+		} else if math.IsInf(f, -1) {
+			return "-inf"
+		}
+		return f
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	}
+	return v.Interface()
+}
@@ -0,0 +1,79 @@
+package keyvaluestoretest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// TestInvalidation verifies that a wrapper such as a cache or invalidator handles every write
+// operation in keyvaluestore.Operations that it implements. For each one, the key is first read
+// via Get, then the operation is invoked, and finally invalidated must return true to indicate that
+// the wrapper invalidated the key.
+//
+// Because the operations come from keyvaluestore.Operations, wrappers are automatically tested
+// against new write methods as they're added.
+func TestInvalidation(t *testing.T, b keyvaluestore.Backend, invalidated func(key string) bool) {
+	v := reflect.ValueOf(b)
+	for _, op := range keyvaluestore.Operations {
+		if !op.Write {
+			continue
+		}
+		method := v.MethodByName(op.Name)
+		if !method.IsValid() {
+			continue
+		}
+		op := op
+		t.Run(op.Name, func(t *testing.T) {
+			key := "invalidation:" + op.Name
+			_, err := b.Get(key)
+			require.NoError(t, err)
+
+			method.Call(operationArgs(method.Type(), key))
+			assert.True(t, invalidated(key), "%v didn't invalidate its key", op.Name)
+		})
+	}
+}
+
+// operationArgs returns plausible arguments for an operation's method. The key is always the first
+// argument. Variadic arguments are omitted.
+func operationArgs(t reflect.Type, key string) []reflect.Value {
+	n := t.NumIn()
+	if t.IsVariadic() {
+		n--
+	}
+	args := make([]reflect.Value, n)
+	args[0] = reflect.ValueOf(key)
+	for i := 1; i < n; i++ {
+		in := t.In(i)
+		switch {
+		case in == reflect.TypeOf(time.Time{}):
+			args[i] = reflect.ValueOf(time.Now().Add(time.Hour))
+		case in.Kind() == reflect.Interface:
+			args[i] = reflect.New(in).Elem()
+			args[i].Set(reflect.ValueOf("x"))
+		case in.Kind() == reflect.String:
+			args[i] = reflect.ValueOf("x").Convert(in)
+		case in.Kind() == reflect.Float64, in.Kind() == reflect.Int64, in.Kind() == reflect.Int:
+			args[i] = reflect.ValueOf(1).Convert(in)
+		case in.Kind() == reflect.Func:
+			// Functions such as Update's return their zero values, which generally means "do
+			// nothing".
+			args[i] = reflect.MakeFunc(in, func([]reflect.Value) []reflect.Value {
+				ret := make([]reflect.Value, in.NumOut())
+				for j := range ret {
+					ret[j] = reflect.Zero(in.Out(j))
+				}
+				return ret
+			})
+		default:
+			args[i] = reflect.Zero(in)
+		}
+	}
+	return args
+}
@@ -0,0 +1,72 @@
+package keyvaluestoretest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// pubSubTimeout is how long to wait for messages to be delivered.
+const pubSubTimeout = 10 * time.Second
+
+func receive(t *testing.T, ch <-chan string) (string, bool) {
+	select {
+	case message, ok := <-ch:
+		return message, ok
+	case <-time.After(pubSubTimeout):
+		t.Fatal("timed out waiting for message")
+		return "", false
+	}
+}
+
+// TestPubSub tests that messages are delivered to exactly the subscribers of their channel.
+func TestPubSub(t *testing.T, newPubSub func() keyvaluestore.PubSub) {
+	ps := newPubSub()
+
+	foo1, cancelFoo1, err := ps.Subscribe("foo")
+	require.NoError(t, err)
+	defer cancelFoo1()
+	foo2, cancelFoo2, err := ps.Subscribe("foo")
+	require.NoError(t, err)
+	bar, cancelBar, err := ps.Subscribe("bar")
+	require.NoError(t, err)
+	defer cancelBar()
+
+	require.NoError(t, ps.Publish("foo", "a"))
+	require.NoError(t, ps.Publish("foo", "a"))
+	require.NoError(t, ps.Publish("bar", "b"))
+
+	for _, ch := range []<-chan string{foo1, foo2} {
+		for i := 0; i < 2; i++ {
+			message, ok := receive(t, ch)
+			require.True(t, ok)
+			assert.Equal(t, "a", message)
+		}
+	}
+	message, ok := receive(t, bar)
+	require.True(t, ok)
+	assert.Equal(t, "b", message)
+
+	// Once cancelled, the subscription's channel is closed.
+	cancelFoo2()
+	for {
+		if _, ok := receive(t, foo2); !ok {
+			break
+		}
+	}
+
+	require.NoError(t, ps.Publish("foo", "c"))
+	message, ok = receive(t, foo1)
+	require.True(t, ok)
+	assert.Equal(t, "c", message)
+
+	select {
+	case message := <-bar:
+		t.Fatalf("unexpected message: %v", message)
+	default:
+	}
+}
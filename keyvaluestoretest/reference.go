@@ -0,0 +1,380 @@
+package keyvaluestoretest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+const (
+	referenceSequenceCount  = 20
+	referenceSequenceLength = 100
+)
+
+// Each key is only ever used for one type of value so that the results never depend on how a
+// backend handles type mismatches.
+var (
+	referenceStringKeys    = []string{"s0", "s1", "s2"}
+	referenceCounterKeys   = []string{"n0", "n1"}
+	referenceSetKeys       = []string{"set0", "set1"}
+	referenceHashKeys      = []string{"h0", "h1"}
+	referenceSortedSetKeys = []string{"z0", "z1"}
+	referenceLexKeys       = []string{"zlex"}
+	referenceSortedHashKey = "zh"
+
+	referenceValues  = []string{"a", "b", "c"}
+	referenceMembers = []string{"a", "ab", "b", "c"}
+	referenceScores  = []float64{-1, 0, 0.5, 1, 2}
+	referenceBounds  = []float64{math.Inf(-1), -1, 0, 0.5, 1, 2, math.Inf(1)}
+	referenceLexMins = []string{"-", "[a", "(a", "[ab", "(ab", "[b", "(c"}
+	referenceLexMaxs = []string{"+", "[a", "(a", "[ab", "(b", "[b", "[c", "(c"}
+	referenceLimits  = []int{0, 1, 2}
+)
+
+type referenceOperation struct {
+	description string
+	apply       func(b keyvaluestore.Backend) []interface{}
+}
+
+// TestBackendAgainstReference applies the same randomly generated sequences of operations to a
+// backend and to a reference backend, which is typically a memorystore backend, and fails if any
+// result or the final state differs. This catches ordering and boundary bugs that are easy to miss
+// with hand-written tests. The seed is logged so that failures can be reproduced with
+// TestBackendAgainstReferenceWithSeed.
+func TestBackendAgainstReference(t *testing.T, newBackend, newReference func() keyvaluestore.Backend) {
+	TestBackendAgainstReferenceWithSeed(t, newBackend, newReference, time.Now().UnixNano())
+}
+
+// TestBackendAgainstReferenceWithSeed is like TestBackendAgainstReference, but uses the given seed
+// to generate the operations.
+func TestBackendAgainstReferenceWithSeed(t *testing.T, newBackend, newReference func() keyvaluestore.Backend, seed int64) {
+	t.Logf("seed: %v", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	for i := 0; i < referenceSequenceCount; i++ {
+		reference := newReference()
+		b := newBackend()
+
+		var history []string
+		for j := 0; j < referenceSequenceLength; j++ {
+			op := randomReferenceOperation(rng)
+			history = append(history, op.description)
+			expected := normalizeReferenceResults(op.apply(reference))
+			actual := normalizeReferenceResults(op.apply(b))
+			if !assert.Equal(t, expected, actual, "sequence %v diverged on operation %v: %v\nhistory:\n%v", i, j, op.description, history) {
+				return
+			}
+		}
+
+		if !assert.Equal(t, referenceState(t, reference), referenceState(t, b), "sequence %v diverged\nhistory:\n%v", i, history) {
+			return
+		}
+	}
+}
+
+func randomString(rng *rand.Rand, choices []string) string {
+	return choices[rng.Intn(len(choices))]
+}
+
+func randomFloat(rng *rand.Rand, choices []float64) float64 {
+	return choices[rng.Intn(len(choices))]
+}
+
+// errored is used in place of errors in results since backends are free to return different
+// errors.
+func errored(err error) bool {
+	return err != nil
+}
+
+func randomReferenceOperation(rng *rand.Rand) referenceOperation {
+	switch rng.Intn(27) {
+	case 0:
+		key, value := randomString(rng, referenceStringKeys), randomString(rng, referenceValues)
+		return referenceOperation{fmt.Sprintf("Set(%q, %q)", key, value), func(b keyvaluestore.Backend) []interface{} {
+			return []interface{}{errored(b.Set(key, value))}
+		}}
+	case 1:
+		key := randomString(rng, referenceStringKeys)
+		return referenceOperation{fmt.Sprintf("Get(%q)", key), func(b keyvaluestore.Backend) []interface{} {
+			v, err := b.Get(key)
+			return []interface{}{v, errored(err)}
+		}}
+	case 2:
+		key := randomString(rng, append(append([]string(nil), referenceStringKeys...), referenceCounterKeys...))
+		return referenceOperation{fmt.Sprintf("Delete(%q)", key), func(b keyvaluestore.Backend) []interface{} {
+			ok, err := b.Delete(key)
+			return []interface{}{ok, errored(err)}
+		}}
+	case 3:
+		key, value := randomString(rng, referenceStringKeys), randomString(rng, referenceValues)
+		return referenceOperation{fmt.Sprintf("SetNX(%q, %q)", key, value), func(b keyvaluestore.Backend) []interface{} {
+			ok, err := b.SetNX(key, value)
+			return []interface{}{ok, errored(err)}
+		}}
+	case 4:
+		key, value := randomString(rng, referenceStringKeys), randomString(rng, referenceValues)
+		return referenceOperation{fmt.Sprintf("SetXX(%q, %q)", key, value), func(b keyvaluestore.Backend) []interface{} {
+			ok, err := b.SetXX(key, value)
+			return []interface{}{ok, errored(err)}
+		}}
+	case 5:
+		key, value, oldValue := randomString(rng, referenceStringKeys), randomString(rng, referenceValues), randomString(rng, referenceValues)
+		return referenceOperation{fmt.Sprintf("SetEQ(%q, %q, %q)", key, value, oldValue), func(b keyvaluestore.Backend) []interface{} {
+			ok, err := b.SetEQ(key, value, oldValue)
+			return []interface{}{ok, errored(err)}
+		}}
+	case 6:
+		key, n := randomString(rng, referenceCounterKeys), int64(rng.Intn(5)-2)
+		return referenceOperation{fmt.Sprintf("NIncrBy(%q, %v)", key, n), func(b keyvaluestore.Backend) []interface{} {
+			v, err := b.NIncrBy(key, n)
+			return []interface{}{v, errored(err)}
+		}}
+	case 7:
+		key, member := randomString(rng, referenceSetKeys), randomString(rng, referenceMembers)
+		return referenceOperation{fmt.Sprintf("SAdd(%q, %q)", key, member), func(b keyvaluestore.Backend) []interface{} {
+			return []interface{}{errored(b.SAdd(key, member))}
+		}}
+	case 8:
+		key, member := randomString(rng, referenceSetKeys), randomString(rng, referenceMembers)
+		return referenceOperation{fmt.Sprintf("SRem(%q, %q)", key, member), func(b keyvaluestore.Backend) []interface{} {
+			return []interface{}{errored(b.SRem(key, member))}
+		}}
+	case 9:
+		key, field, value := randomString(rng, referenceHashKeys), randomString(rng, referenceMembers), randomString(rng, referenceValues)
+		return referenceOperation{fmt.Sprintf("HSet(%q, %q, %q)", key, field, value), func(b keyvaluestore.Backend) []interface{} {
+			return []interface{}{errored(b.HSet(key, field, value))}
+		}}
+	case 10:
+		key, field := randomString(rng, referenceHashKeys), randomString(rng, referenceMembers)
+		return referenceOperation{fmt.Sprintf("HDel(%q, %q)", key, field), func(b keyvaluestore.Backend) []interface{} {
+			return []interface{}{errored(b.HDel(key, field))}
+		}}
+	case 11:
+		key, field := randomString(rng, referenceHashKeys), randomString(rng, referenceMembers)
+		return referenceOperation{fmt.Sprintf("HGet(%q, %q)", key, field), func(b keyvaluestore.Backend) []interface{} {
+			v, err := b.HGet(key, field)
+			return []interface{}{v, errored(err)}
+		}}
+	case 12, 13:
+		key, member, score := randomString(rng, referenceSortedSetKeys), randomString(rng, referenceMembers), randomFloat(rng, referenceScores)
+		return referenceOperation{fmt.Sprintf("ZAdd(%q, %q, %v)", key, member, score), func(b keyvaluestore.Backend) []interface{} {
+			return []interface{}{errored(b.ZAdd(key, member, score))}
+		}}
+	case 14:
+		key, member := randomString(rng, referenceSortedSetKeys), randomString(rng, referenceMembers)
+		return referenceOperation{fmt.Sprintf("ZRem(%q, %q)", key, member), func(b keyvaluestore.Backend) []interface{} {
+			return []interface{}{errored(b.ZRem(key, member))}
+		}}
+	case 15:
+		key, member, n := randomString(rng, referenceSortedSetKeys), randomString(rng, referenceMembers), randomFloat(rng, referenceScores)
+		return referenceOperation{fmt.Sprintf("ZIncrBy(%q, %q, %v)", key, member, n), func(b keyvaluestore.Backend) []interface{} {
+			v, err := b.ZIncrBy(key, member, n)
+			return []interface{}{v, errored(err)}
+		}}
+	case 16:
+		key, member := randomString(rng, referenceSortedSetKeys), randomString(rng, referenceMembers)
+		return referenceOperation{fmt.Sprintf("ZScore(%q, %q)", key, member), func(b keyvaluestore.Backend) []interface{} {
+			v, err := b.ZScore(key, member)
+			return []interface{}{v, errored(err)}
+		}}
+	case 17:
+		key, min, max, limit := randomString(rng, referenceSortedSetKeys), randomFloat(rng, referenceBounds), randomFloat(rng, referenceBounds), referenceLimits[rng.Intn(len(referenceLimits))]
+		return referenceOperation{fmt.Sprintf("ZRangeByScoreWithScores(%q, %v, %v, %v)", key, min, max, limit), func(b keyvaluestore.Backend) []interface{} {
+			v, err := b.ZRangeByScoreWithScores(key, min, max, limit)
+			return []interface{}{v, errored(err)}
+		}}
+	case 18:
+		key, min, max, limit := randomString(rng, referenceSortedSetKeys), randomFloat(rng, referenceBounds), randomFloat(rng, referenceBounds), referenceLimits[rng.Intn(len(referenceLimits))]
+		return referenceOperation{fmt.Sprintf("ZRevRangeByScore(%q, %v, %v, %v)", key, min, max, limit), func(b keyvaluestore.Backend) []interface{} {
+			v, err := b.ZRevRangeByScore(key, min, max, limit)
+			return []interface{}{v, errored(err)}
+		}}
+	case 19:
+		key, min, max := randomString(rng, referenceSortedSetKeys), randomFloat(rng, referenceBounds), randomFloat(rng, referenceBounds)
+		return referenceOperation{fmt.Sprintf("ZCount(%q, %v, %v)", key, min, max), func(b keyvaluestore.Backend) []interface{} {
+			v, err := b.ZCount(key, min, max)
+			return []interface{}{v, errored(err)}
+		}}
+	case 20:
+		key, member := randomString(rng, referenceLexKeys), randomString(rng, referenceMembers)
+		return referenceOperation{fmt.Sprintf("ZAdd(%q, %q, 0)", key, member), func(b keyvaluestore.Backend) []interface{} {
+			return []interface{}{errored(b.ZAdd(key, member, 0))}
+		}}
+	case 21:
+		key, member := randomString(rng, referenceLexKeys), randomString(rng, referenceMembers)
+		return referenceOperation{fmt.Sprintf("ZRem(%q, %q)", key, member), func(b keyvaluestore.Backend) []interface{} {
+			return []interface{}{errored(b.ZRem(key, member))}
+		}}
+	case 22:
+		key, min, max, limit := randomString(rng, referenceLexKeys), randomString(rng, referenceLexMins), randomString(rng, referenceLexMaxs), referenceLimits[rng.Intn(len(referenceLimits))]
+		return referenceOperation{fmt.Sprintf("ZRangeByLex(%q, %q, %q, %v)", key, min, max, limit), func(b keyvaluestore.Backend) []interface{} {
+			v, err := b.ZRangeByLex(key, min, max, limit)
+			return []interface{}{v, errored(err)}
+		}}
+	case 23:
+		key, min, max, limit := randomString(rng, referenceLexKeys), randomString(rng, referenceLexMins), randomString(rng, referenceLexMaxs), referenceLimits[rng.Intn(len(referenceLimits))]
+		return referenceOperation{fmt.Sprintf("ZRevRangeByLex(%q, %q, %q, %v)", key, min, max, limit), func(b keyvaluestore.Backend) []interface{} {
+			v, err := b.ZRevRangeByLex(key, min, max, limit)
+			return []interface{}{v, errored(err)}
+		}}
+	case 24:
+		key, min, max := randomString(rng, referenceLexKeys), randomString(rng, referenceLexMins), randomString(rng, referenceLexMaxs)
+		return referenceOperation{fmt.Sprintf("ZLexCount(%q, %q, %q)", key, min, max), func(b keyvaluestore.Backend) []interface{} {
+			v, err := b.ZLexCount(key, min, max)
+			return []interface{}{v, errored(err)}
+		}}
+	case 25:
+		field, member, score := randomString(rng, referenceMembers), randomString(rng, referenceValues), randomFloat(rng, referenceScores)
+		return referenceOperation{fmt.Sprintf("ZHAdd(%q, %q, %q, %v)", referenceSortedHashKey, field, member, score), func(b keyvaluestore.Backend) []interface{} {
+			return []interface{}{errored(b.ZHAdd(referenceSortedHashKey, field, member, score))}
+		}}
+	default:
+		return randomReferenceAtomicWrite(rng)
+	}
+}
+
+type referenceAtomicWriteOperation struct {
+	description string
+	apply       func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult
+}
+
+func randomReferenceAtomicWrite(rng *rand.Rand) referenceOperation {
+	// Each key is used at most once per atomic write since some backends don't allow multiple
+	// operations on the same key.
+	var ops []referenceAtomicWriteOperation
+	used := map[string]bool{}
+	for n := 1 + rng.Intn(3); len(ops) < n; {
+		var op referenceAtomicWriteOperation
+		var key string
+		switch rng.Intn(7) {
+		case 0:
+			key = randomString(rng, referenceStringKeys)
+			value := randomString(rng, referenceValues)
+			op = referenceAtomicWriteOperation{fmt.Sprintf("Set(%q, %q)", key, value), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+				return tx.Set(key, value)
+			}}
+		case 1:
+			key = randomString(rng, referenceStringKeys)
+			value := randomString(rng, referenceValues)
+			op = referenceAtomicWriteOperation{fmt.Sprintf("SetNX(%q, %q)", key, value), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+				return tx.SetNX(key, value)
+			}}
+		case 2:
+			key = randomString(rng, referenceStringKeys)
+			value := randomString(rng, referenceValues)
+			op = referenceAtomicWriteOperation{fmt.Sprintf("SetXX(%q, %q)", key, value), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+				return tx.SetXX(key, value)
+			}}
+		case 3:
+			key = randomString(rng, referenceStringKeys)
+			value, oldValue := randomString(rng, referenceValues), randomString(rng, referenceValues)
+			op = referenceAtomicWriteOperation{fmt.Sprintf("SetEQ(%q, %q, %q)", key, value, oldValue), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+				return tx.SetEQ(key, value, oldValue)
+			}}
+		case 4:
+			key = randomString(rng, referenceStringKeys)
+			op = referenceAtomicWriteOperation{fmt.Sprintf("DeleteXX(%q)", key), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+				return tx.DeleteXX(key)
+			}}
+		case 5:
+			key = randomString(rng, referenceSortedSetKeys)
+			member, score := randomString(rng, referenceMembers), randomFloat(rng, referenceScores)
+			op = referenceAtomicWriteOperation{fmt.Sprintf("ZAdd(%q, %q, %v)", key, member, score), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+				return tx.ZAdd(key, member, score)
+			}}
+		default:
+			key = randomString(rng, referenceHashKeys)
+			field, value := randomString(rng, referenceMembers), randomString(rng, referenceValues)
+			op = referenceAtomicWriteOperation{fmt.Sprintf("HSet(%q, %q, %q)", key, field, value), func(tx keyvaluestore.AtomicWriteOperation) keyvaluestore.AtomicWriteResult {
+				return tx.HSet(key, field, value)
+			}}
+		}
+		if used[key] {
+			continue
+		}
+		used[key] = true
+		ops = append(ops, op)
+	}
+
+	description := "AtomicWrite("
+	for i, op := range ops {
+		if i > 0 {
+			description += ", "
+		}
+		description += op.description
+	}
+	description += ")"
+
+	return referenceOperation{description, func(b keyvaluestore.Backend) []interface{} {
+		tx := b.AtomicWrite()
+		results := make([]keyvaluestore.AtomicWriteResult, len(ops))
+		for i, op := range ops {
+			results[i] = op.apply(tx)
+		}
+		ok, err := tx.Exec()
+		ret := []interface{}{ok, errored(err)}
+		for _, r := range results {
+			ret = append(ret, r.ConditionalFailed())
+		}
+		return ret
+	}}
+}
+
+// normalizeReferenceResults replaces empty slices and maps with nil since backends are free to
+// return either.
+func normalizeReferenceResults(results []interface{}) []interface{} {
+	for i, r := range results {
+		if v := reflect.ValueOf(r); (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0 {
+			results[i] = nil
+		}
+	}
+	return results
+}
+
+func normalizeReferenceState(state map[string]interface{}) map[string]interface{} {
+	for k, v := range state {
+		state[k] = normalizeReferenceResults([]interface{}{v})[0]
+	}
+	return state
+}
+
+// referenceState returns everything observable about the keys used by the reference operations.
+func referenceState(t *testing.T, b keyvaluestore.Backend) map[string]interface{} {
+	state := map[string]interface{}{}
+	for _, key := range append(append([]string(nil), referenceStringKeys...), referenceCounterKeys...) {
+		v, err := b.Get(key)
+		require.NoError(t, err)
+		state[key] = v
+	}
+	for _, key := range referenceSetKeys {
+		members, err := b.SMembers(key)
+		require.NoError(t, err)
+		set := map[string]bool{}
+		for _, member := range members {
+			set[member] = true
+		}
+		state[key] = set
+	}
+	for _, key := range referenceHashKeys {
+		fields, err := b.HGetAll(key)
+		require.NoError(t, err)
+		state[key] = fields
+	}
+	for _, key := range append(append([]string(nil), referenceSortedSetKeys...), referenceLexKeys...) {
+		members, err := b.ZRangeByScoreWithScores(key, math.Inf(-1), math.Inf(1), 0)
+		require.NoError(t, err)
+		state[key] = members
+	}
+	members, err := b.ZHRangeByScoreWithScores(referenceSortedHashKey, math.Inf(-1), math.Inf(1), 0)
+	require.NoError(t, err)
+	state[referenceSortedHashKey] = members
+	return normalizeReferenceState(state)
+}
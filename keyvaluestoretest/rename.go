@@ -0,0 +1,85 @@
+package keyvaluestoretest
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// testRenameCollection tests keyvaluestore.Renamer implementations.
+func testRenameCollection(t *testing.T, b keyvaluestore.Backend, opts Options) {
+	ok, err := keyvaluestore.RenameCollection(b, "missing", "dst")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = keyvaluestore.RenameCollection(b, "src", "src")
+	assert.Error(t, err)
+
+	t.Run("SortedHash", func(t *testing.T) {
+		opts.require(t, CapabilitySortedSets)
+
+		require.NoError(t, b.ZHAdd("zsrc", "a", "alice", 1.0))
+		require.NoError(t, b.ZHAdd("zsrc", "b", "bob", 2.0))
+		require.NoError(t, b.ZAdd("zsrc", "c", 3.0))
+		require.NoError(t, b.ZHAdd("zdst", "a", "old", 0.0))
+		require.NoError(t, b.ZHAdd("zdst", "x", "stale", 0.0))
+
+		ok, err := keyvaluestore.RenameCollection(b, "zsrc", "zdst")
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		members, err := b.ZHRangeByScoreWithScores("zdst", math.Inf(-1), math.Inf(1), 0)
+		require.NoError(t, err)
+		assert.Equal(t, keyvaluestore.ScoredMembers{
+			{Value: "alice", Score: 1.0},
+			{Value: "bob", Score: 2.0},
+			{Value: "c", Score: 3.0},
+		}, members)
+
+		n, err := b.ZCount("zdst", math.Inf(-1), math.Inf(1))
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		score, err := b.ZScore("zdst", "c")
+		require.NoError(t, err)
+		require.NotNil(t, score)
+		assert.Equal(t, 3.0, *score)
+
+		members, err = b.ZHRangeByScoreWithScores("zsrc", math.Inf(-1), math.Inf(1), 0)
+		require.NoError(t, err)
+		assert.Empty(t, members)
+
+		n, err = b.ZCount("zsrc", math.Inf(-1), math.Inf(1))
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+
+		// The old key can be reused.
+		require.NoError(t, b.ZHAdd("zsrc", "d", "dan", 4.0))
+		members, err = b.ZHRangeByScoreWithScores("zsrc", math.Inf(-1), math.Inf(1), 0)
+		require.NoError(t, err)
+		assert.Equal(t, keyvaluestore.ScoredMembers{{Value: "dan", Score: 4.0}}, members)
+	})
+
+	t.Run("Hash", func(t *testing.T) {
+		opts.require(t, CapabilityHashes)
+
+		require.NoError(t, b.HSet("hsrc", "a", "1", keyvaluestore.KeyValue{Key: "b", Value: "2"}))
+		require.NoError(t, b.HSet("hdst", "c", "3"))
+
+		ok, err := keyvaluestore.RenameCollection(b, "hsrc", "hdst")
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		m, err := b.HGetAll("hdst")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "1", "b": "2"}, m)
+
+		m, err = b.HGetAll("hsrc")
+		require.NoError(t, err)
+		assert.Empty(t, m)
+	})
+}
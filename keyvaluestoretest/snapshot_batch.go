@@ -0,0 +1,86 @@
+package keyvaluestoretest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// TestSnapshotBatch tests that the reads in a backend's snapshot batches are consistent with each
+// other, even while the keys they read are being concurrently modified.
+func TestSnapshotBatch(t *testing.T, newBackend func() keyvaluestore.Backend) {
+	t.Run("WritesAfterReads", func(t *testing.T) {
+		b := newBackend()
+		require.NoError(t, b.Set("snapshot-foo", "a"))
+
+		batch, err := keyvaluestore.BatchWithOptions(b, keyvaluestore.BatchOptions{
+			Snapshot: true,
+		})
+		require.NoError(t, err)
+		set := batch.Set("snapshot-foo", "b")
+		get := batch.Get("snapshot-foo")
+		assert.Equal(t, 2, batch.Len())
+		require.NoError(t, batch.Exec())
+
+		require.NoError(t, set.Result())
+		v, err := get.Result()
+		require.NoError(t, err)
+		assert.Equal(t, "a", *v)
+
+		v, err = b.Get("snapshot-foo")
+		require.NoError(t, err)
+		assert.Equal(t, "b", *v)
+	})
+
+	t.Run("Consistency", func(t *testing.T) {
+		b := newBackend()
+		require.NoError(t, b.Set("snapshot-a", 0))
+		require.NoError(t, b.Set("snapshot-b", 0))
+		require.NoError(t, b.ZHAdd("snapshot-z", "f", 0, 0))
+
+		// Each write changes all of the keys atomically, so every snapshot should see them agree.
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				tx := b.AtomicWrite()
+				tx.Set("snapshot-a", i)
+				tx.Set("snapshot-b", i)
+				tx.ZHAdd("snapshot-z", "f", i, float64(i))
+				_, err := tx.Exec()
+				assert.NoError(t, err)
+			}
+		}()
+
+		for i := 0; i < 100; i++ {
+			batch := b.(keyvaluestore.SnapshotBatcher).SnapshotBatch()
+			getA := batch.Get("snapshot-a")
+			getZ := batch.ZHRangeByScore("snapshot-z", 0, 1e9, 0)
+			getB := batch.Get("snapshot-b")
+			require.NoError(t, batch.Exec())
+
+			av, err := getA.Result()
+			require.NoError(t, err)
+			bv, err := getB.Result()
+			require.NoError(t, err)
+			zv, err := getZ.Result()
+			require.NoError(t, err)
+			assert.Equal(t, *av, *bv)
+			assert.Equal(t, []string{*av}, zv)
+		}
+
+		close(done)
+		wg.Wait()
+	})
+}
@@ -0,0 +1,54 @@
+//go:build containers
+// +build containers
+
+// Command runtests starts the integration test services in containers, runs "go test" with the
+// given arguments against them, and stops the containers:
+//
+//	go run -tags containers ./keyvaluestoretest/testcontainers/runtests ./...
+//
+// If no arguments are given, "./..." is tested.
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest/testcontainers"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		args = []string{"./..."}
+	}
+
+	fmt.Fprintln(os.Stderr, "starting containers...")
+	env, err := testcontainers.Start(testcontainers.DefaultServices...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer env.Close()
+
+	// Interrupts are delivered to go test as well, so we only need to wait for it to exit before
+	// the containers are stopped.
+	signal.Ignore(os.Interrupt)
+
+	cmd := exec.Command("go", append([]string{"test"}, args...)...)
+	cmd.Env = append(os.Environ(), env.Env()...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,266 @@
+//go:build containers
+// +build containers
+
+// Package testcontainers starts the services used by the backends' integration tests in docker
+// containers, so that the full test matrix can be run locally without any manual setup:
+//
+//	go run -tags containers ./keyvaluestoretest/testcontainers/runtests ./...
+//
+// Each service is exposed to the tests via the same environment variables used by
+// docker-compose.yml. The FoundationDB tests also require the FoundationDB client library to be
+// installed on the host.
+//
+// There's no Cassandra backend in this repository, so no Cassandra container is started.
+//
+// The package is guarded by the "containers" build tag so that it isn't built by "go test ./...".
+package testcontainers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// StartTimeout is how long Start waits for each service to become ready.
+const StartTimeout = 60 * time.Second
+
+// Service describes a service that can be started in a container.
+type Service struct {
+	Name string
+
+	// Image is the docker image to run.
+	Image string
+
+	// Args are additional arguments for "docker run", such as environment variables.
+	Args []string
+
+	// Port is the container port that's exposed on the host.
+	Port string
+
+	// HostAddress is the host address that Port is published on. If empty, a random port on
+	// 127.0.0.1 is used.
+	HostAddress string
+
+	// Ready returns nil once the container is ready for use.
+	Ready func(c *Container) error
+
+	// Env returns the environment variables that direct the tests to the container.
+	Env func(c *Container) map[string]string
+}
+
+// Redis is a Redis server. It sets REDIS_ADDRESS.
+var Redis = Service{
+	Name:  "redis",
+	Image: "redis",
+	Port:  "6379",
+	Ready: func(c *Container) error {
+		return c.Exec("redis-cli", "ping")
+	},
+	Env: func(c *Container) map[string]string {
+		return map[string]string{
+			"REDIS_ADDRESS": c.Address,
+		}
+	},
+}
+
+// DynamoDB is a DynamoDB Local server. It sets DYNAMODB_ENDPOINT.
+var DynamoDB = Service{
+	Name:  "dynamodb",
+	Image: "amazon/dynamodb-local",
+	Port:  "8000",
+	Ready: func(c *Container) error {
+		// The server responds to unsigned requests with an error, which is good enough.
+		resp, err := http.Get("http://" + c.Address)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	},
+	Env: func(c *Container) map[string]string {
+		return map[string]string{
+			"DYNAMODB_ENDPOINT": "http://" + c.Address,
+		}
+	},
+}
+
+// FoundationDB is a single process FoundationDB cluster. It sets FOUNDATIONDB_CLUSTERFILE_CONTENT
+// and FOUNDATIONDB_SUBSPACE.
+//
+// FoundationDB servers advertise their own address to clients, so unlike the other services, its
+// port must be the same on the host as in the container. It's bound to 127.0.0.1:4500.
+var FoundationDB = Service{
+	Name:        "foundationdb",
+	Image:       "foundationdb/foundationdb:6.2.28",
+	Args:        []string{"-e", "FDB_NETWORKING_MODE=host"},
+	Port:        "4500",
+	HostAddress: "127.0.0.1:4500",
+	Ready: func(c *Container) error {
+		// A new cluster has to be configured before it can be used. Once configured, this fails
+		// with "Database already exists", so we check the status instead.
+		if c.Exec("fdbcli", "--exec", "status minimal", "--timeout", "5") == nil {
+			return nil
+		}
+		return c.Exec("fdbcli", "--exec", "configure new single memory", "--timeout", "5")
+	},
+	Env: func(c *Container) map[string]string {
+		return map[string]string{
+			"FOUNDATIONDB_CLUSTERFILE_CONTENT": "docker:docker@" + c.Address,
+			"FOUNDATIONDB_SUBSPACE":            "test",
+		}
+	},
+}
+
+// DefaultServices are the services started by the runtests command.
+var DefaultServices = []Service{Redis, DynamoDB, FoundationDB}
+
+// Container is a running service.
+type Container struct {
+	Service Service
+	ID      string
+
+	// Address is the host address that the service's port is exposed on.
+	Address string
+}
+
+// Exec runs a command in the container.
+func (c *Container) Exec(name string, args ...string) error {
+	out, err := exec.Command("docker", append([]string{"exec", c.ID, name}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %v", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Stop stops and removes the container.
+func (c *Container) Stop() error {
+	return exec.Command("docker", "stop", c.ID).Run()
+}
+
+// Env returns the environment variables that direct the tests to the container.
+func (c *Container) Env() map[string]string {
+	return c.Service.Env(c)
+}
+
+// StartContainer starts a service and waits for it to become ready.
+func StartContainer(s Service) (*Container, error) {
+	hostAddress := s.HostAddress
+	if hostAddress == "" {
+		hostAddress = "127.0.0.1:"
+	}
+	args := append([]string{"run", "-d", "--rm", "-p", hostAddress + ":" + s.Port}, s.Args...)
+	args = append(args, s.Image)
+	out, err := exec.Command("docker", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to start %v container: %w", s.Name, err)
+	}
+	c := &Container{
+		Service: s,
+		ID:      strings.TrimSpace(string(out)),
+	}
+
+	out, err = exec.Command("docker", "port", c.ID, s.Port).Output()
+	if err != nil {
+		c.Stop()
+		return nil, fmt.Errorf("unable to get %v container port: %w", s.Name, err)
+	}
+	// There may be one line per address family. We only bound IPv4, so the first will do.
+	c.Address = strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	if host, port, err := net.SplitHostPort(c.Address); err == nil && (host == "0.0.0.0" || host == "") {
+		c.Address = net.JoinHostPort("127.0.0.1", port)
+	}
+
+	deadline := time.Now().Add(StartTimeout)
+	for {
+		err := s.Ready(c)
+		if err == nil {
+			return c, nil
+		} else if time.Now().After(deadline) {
+			c.Stop()
+			return nil, fmt.Errorf("%v container didn't become ready: %w", s.Name, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// Environment is a set of running containers.
+type Environment struct {
+	Containers []*Container
+}
+
+// Start starts the given services concurrently. If any of them fail to start, the others are
+// stopped.
+func Start(services ...Service) (*Environment, error) {
+	type result struct {
+		container *Container
+		err       error
+	}
+	results := make([]result, len(services))
+	done := make(chan struct{})
+	for i, s := range services {
+		go func(i int, s Service) {
+			c, err := StartContainer(s)
+			results[i] = result{c, err}
+			done <- struct{}{}
+		}(i, s)
+	}
+	for range services {
+		<-done
+	}
+
+	env := &Environment{}
+	var firstErr error
+	for _, r := range results {
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+		} else {
+			env.Containers = append(env.Containers, r.container)
+		}
+	}
+	if firstErr != nil {
+		env.Close()
+		return nil, firstErr
+	}
+	return env, nil
+}
+
+// Env returns the environment variables for all of the containers in "KEY=value" form, suitable
+// for exec.Cmd.
+func (e *Environment) Env() []string {
+	var ret []string
+	for _, c := range e.Containers {
+		for k, v := range c.Env() {
+			ret = append(ret, k+"="+v)
+		}
+	}
+	return ret
+}
+
+// Setenv sets the environment variables for all of the containers in the current process. This is
+// useful for starting the containers from a TestMain function.
+func (e *Environment) Setenv() error {
+	for _, c := range e.Containers {
+		for k, v := range c.Env() {
+			if err := os.Setenv(k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close stops all of the containers.
+func (e *Environment) Close() error {
+	var firstErr error
+	for _, c := range e.Containers {
+		if err := c.Stop(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
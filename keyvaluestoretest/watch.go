@@ -0,0 +1,84 @@
+package keyvaluestoretest
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// TestObservableBackend tests that watches are notified of changes. Watches may be established
+// asynchronously, so changes are repeated until they're noticed.
+func TestObservableBackend(t *testing.T, newBackend func() keyvaluestore.Backend) {
+	t.Run("Watch", func(t *testing.T) {
+		b := newBackend()
+		ch, cancel := b.(keyvaluestore.ObservableBackend).Watch("foo")
+
+		for i := 0; ; i++ {
+			require.NoError(t, b.Set("foo", i))
+			select {
+			case _, ok := <-ch:
+				require.True(t, ok)
+			case <-time.After(100 * time.Millisecond):
+				require.Less(t, i, 100, "timed out waiting for watch")
+				continue
+			}
+			break
+		}
+
+		// Once cancelled, the watch's channel is closed.
+		cancel()
+		for {
+			select {
+			case _, ok := <-ch:
+				if ok {
+					continue
+				}
+			case <-time.After(pubSubTimeout):
+				t.Fatal("timed out waiting for watch to close")
+			}
+			break
+		}
+	})
+
+	t.Run("WatchPrefix", func(t *testing.T) {
+		b := newBackend()
+		ch, cancel, err := b.(keyvaluestore.ObservableBackend).WatchPrefix("foo:")
+		if errors.Is(err, keyvaluestore.ErrNotSupported) {
+			t.Skip("backend doesn't support prefix watches")
+		}
+		require.NoError(t, err)
+
+		for i := 0; ; i++ {
+			require.NoError(t, b.Set("bar:"+strconv.Itoa(i), i))
+			require.NoError(t, b.Set("foo:"+strconv.Itoa(i), i))
+			select {
+			case key, ok := <-ch:
+				require.True(t, ok)
+				assert.Equal(t, "foo:", key[:4])
+			case <-time.After(100 * time.Millisecond):
+				require.Less(t, i, 100, "timed out waiting for watch")
+				continue
+			}
+			break
+		}
+
+		cancel()
+		for {
+			select {
+			case _, ok := <-ch:
+				if ok {
+					continue
+				}
+			case <-time.After(pubSubTimeout):
+				t.Fatal("timed out waiting for watch to close")
+			}
+			break
+		}
+	})
+}
@@ -0,0 +1,263 @@
+package keyvaluestoretest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// WrapperOptions configures TestWrapper.
+type WrapperOptions struct {
+	// Inherited lists the methods of the wrapper's batches and atomic writes that it deliberately
+	// inherits from the wrapped operation by embedding it, such as "AtomicWrite.ZHAdd" or
+	// "Batch.Get".
+	Inherited []string
+
+	// Unforwarded lists the backend methods whose errors deliberately don't reach the caller, such
+	// as writes that are buffered and applied later. "Batch" and "AtomicWrite" skip the checks of
+	// batches and atomic writes.
+	Unforwarded []string
+
+	// Opaque indicates that the wrapper's Unwrap deliberately returns nil, e.g. so that the
+	// wrapped backend can't be used to bypass access rules.
+	Opaque bool
+}
+
+func (o WrapperOptions) inherited(name string) bool {
+	for _, s := range o.Inherited {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (o WrapperOptions) unforwarded(name string) bool {
+	for _, s := range o.Unforwarded {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapperError is returned by every method of errorBackend.
+type wrapperError struct {
+	method string
+}
+
+func (e *wrapperError) Error() string {
+	return "test error from " + e.method
+}
+
+// operationLifecycleMethods are the batch and atomic write methods that don't add operations. A
+// wrapper that only overrides these is passing its operations through unmodified.
+var operationLifecycleMethods = map[string]bool{
+	"Len":                  true,
+	"Exec":                 true,
+	"Validate":             true,
+	"WithIdempotencyToken": true,
+}
+
+// TestWrapper tests that a wrapper is transparent. newWrapper is invoked with the backend to wrap
+// and should return the wrapper under test. It checks that:
+//
+//   - Errors returned by every method of the wrapped backend reach the caller in a form that
+//     errors.As can still match, including via batches and atomic writes.
+//   - The wrapper's batches and atomic writes either pass every operation through unmodified or
+//     implement every operation themselves. Embedding the wrapped operation and overriding only
+//     some of its methods silently bypasses the wrapper whenever a new method is added.
+//   - Unwrap chains terminate at the wrapped backend, including for backends derived via
+//     WithEventuallyConsistentReads and WithProfiler.
+//
+// Wrappers should also be tested with TestBackend to verify their behavior.
+func TestWrapper(t *testing.T, newWrapper func(keyvaluestore.Backend) keyvaluestore.Backend, opts WrapperOptions) {
+	backendType := reflect.TypeOf((*keyvaluestore.Backend)(nil)).Elem()
+
+	t.Run("Errors", func(t *testing.T) {
+		for i := 0; i < backendType.NumMethod(); i++ {
+			method := backendType.Method(i)
+			switch method.Name {
+			case "Batch", "AtomicWrite", "WithEventuallyConsistentReads", "WithProfiler", "Unwrap":
+				continue
+			}
+			if opts.unforwarded(method.Name) {
+				continue
+			}
+			b := newWrapper(&errorBackend{})
+			out := callWithTestArgs(reflect.ValueOf(b).MethodByName(method.Name), method.Name)
+			assertWrapperError(t, method.Name, out)
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		b := newWrapper(&errorBackend{})
+		batch := b.Batch()
+		batchType := reflect.TypeOf((*keyvaluestore.BatchOperation)(nil)).Elem()
+		checkOperationType(t, "Batch", batch, batchType, opts)
+		if opts.unforwarded("Batch") {
+			return
+		}
+
+		for i := 0; i < batchType.NumMethod(); i++ {
+			name := batchType.Method(i).Name
+			if operationLifecycleMethods[name] {
+				continue
+			}
+			callWithTestArgs(reflect.ValueOf(batch).MethodByName(name), name)
+		}
+		err := batch.Exec()
+		var target *wrapperError
+		assert.True(t, errors.As(err, &target), "batch errors must be returned by Exec: %v", err)
+	})
+
+	t.Run("AtomicWrite", func(t *testing.T) {
+		b := newWrapper(&errorBackend{})
+		tx := b.AtomicWrite()
+		atomicWriteType := reflect.TypeOf((*keyvaluestore.AtomicWriteOperation)(nil)).Elem()
+		checkOperationType(t, "AtomicWrite", tx, atomicWriteType, opts)
+		if opts.unforwarded("AtomicWrite") {
+			return
+		}
+
+		for i := 0; i < atomicWriteType.NumMethod(); i++ {
+			name := atomicWriteType.Method(i).Name
+			if operationLifecycleMethods[name] {
+				continue
+			}
+			callWithTestArgs(reflect.ValueOf(tx).MethodByName(name), name)
+		}
+		_, err := tx.Exec()
+		var target *wrapperError
+		assert.True(t, errors.As(err, &target), "atomic write errors must be returned by Exec: %v", err)
+	})
+
+	t.Run("Unwrap", func(t *testing.T) {
+		base := &errorBackend{}
+		b := newWrapper(base)
+		for name, derived := range map[string]keyvaluestore.Backend{
+			"Wrapper":                       b,
+			"WithEventuallyConsistentReads": b.WithEventuallyConsistentReads(),
+			"WithProfiler":                  b.WithProfiler(&keyvaluestore.BasicProfiler{}),
+		} {
+			if opts.Opaque {
+				assert.Nil(t, derived.Unwrap(), name)
+				continue
+			}
+			var last keyvaluestore.Backend
+			for i, next := 0, derived; next != nil; i, next = i+1, next.Unwrap() {
+				require.True(t, i < 100, "%v: Unwrap chain doesn't terminate", name)
+				last = next
+			}
+			assert.True(t, last == keyvaluestore.Backend(base), "%v: Unwrap chain ends at %T instead of the wrapped backend", name, last)
+		}
+	})
+}
+
+// checkOperationType fails the test if op's type embeds the operation that it wraps and overrides
+// some, but not all, of its operations.
+func checkOperationType(t *testing.T, prefix string, op interface{}, iface reflect.Type, opts WrapperOptions) {
+	var overridden, inherited []string
+	for i := 0; i < iface.NumMethod(); i++ {
+		name := iface.Method(i).Name
+		if operationLifecycleMethods[name] {
+			continue
+		} else if isInheritedMethod(reflect.TypeOf(op), name) {
+			if !opts.inherited(prefix + "." + name) {
+				inherited = append(inherited, name)
+			}
+		} else {
+			overridden = append(overridden, name)
+		}
+	}
+	if len(overridden) > 0 && len(inherited) > 0 {
+		t.Errorf("%T implements %v but inherits %v", op, strings.Join(overridden, ", "), strings.Join(inherited, ", "))
+	}
+}
+
+// isInheritedMethod returns true if the method is promoted from an embedded field rather than
+// declared on the type itself. The compiler generates wrappers for promoted methods, so they're
+// identified by their source location.
+func isInheritedMethod(t reflect.Type, name string) bool {
+	for _, t := range []reflect.Type{t, derefType(t)} {
+		if m, ok := t.MethodByName(name); ok {
+			f := runtime.FuncForPC(m.Func.Pointer())
+			if file, _ := f.FileLine(f.Entry()); file != "<autogenerated>" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// callWithTestArgs invokes the method with arguments that are valid for any method of the Backend,
+// BatchOperation, or AtomicWriteOperation interfaces. Variadic arguments are omitted.
+func callWithTestArgs(method reflect.Value, name string) []reflect.Value {
+	methodType := method.Type()
+	n := methodType.NumIn()
+	if methodType.IsVariadic() {
+		n--
+	}
+	lex := strings.Contains(name, "Lex")
+	args := make([]reflect.Value, n)
+	for i := range args {
+		switch in := methodType.In(i); in.Kind() {
+		case reflect.String:
+			switch {
+			case i == 0:
+				args[i] = reflect.ValueOf("key")
+			case lex && i == 1:
+				args[i] = reflect.ValueOf("-")
+			case lex && i == 2:
+				args[i] = reflect.ValueOf("+")
+			default:
+				args[i] = reflect.ValueOf(fmt.Sprintf("arg%v", i))
+			}
+		case reflect.Interface:
+			args[i] = reflect.ValueOf("value")
+		case reflect.Float64:
+			// Score ranges are always the second and third arguments.
+			if i == 1 && (strings.Contains(name, "Range") || name == "ZCount") {
+				args[i] = reflect.ValueOf(math.Inf(-1))
+			} else if i == 2 && (strings.Contains(name, "Range") || name == "ZCount") {
+				args[i] = reflect.ValueOf(math.Inf(1))
+			} else {
+				args[i] = reflect.ValueOf(1.0)
+			}
+		case reflect.Int, reflect.Int64:
+			args[i] = reflect.ValueOf(1).Convert(in)
+		default:
+			if in == reflect.TypeOf([]keyvaluestore.ZHEntry(nil)) {
+				args[i] = reflect.ValueOf([]keyvaluestore.ZHEntry{{Field: "field", Member: "value", Score: 1}})
+			} else {
+				args[i] = reflect.Zero(in)
+			}
+		}
+	}
+	return method.Call(args)
+}
+
+func assertWrapperError(t *testing.T, name string, out []reflect.Value) {
+	var err error
+	if len(out) > 0 {
+		err, _ = out[len(out)-1].Interface().(error)
+	}
+	var target *wrapperError
+	assert.True(t, errors.As(err, &target), "%v must return the wrapped backend's error: %v", name, err)
+}
@@ -0,0 +1,108 @@
+package keyvaluestoretest
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// testZAddMigration tests that sorted sets written via ZAdd can be read and modified as sorted
+// hashes. To make migrating from ZAdd to ZHAdd easier, backends must treat ZAdd(key, member, score)
+// exactly like ZHAdd(key, member, member, score), i.e. the member is encoded as the field and is
+// also returned as the value. The data doesn't need to be rewritten in order to switch.
+func testZAddMigration(t *testing.T, b keyvaluestore.Backend, opts Options) {
+	assert.NoError(t, b.ZAdd("zaddtest", "a", 0.0))
+	assert.NoError(t, b.ZHAdd("zaddtest", "b", "bob", 0.0))
+	assert.NoError(t, b.ZAdd("zaddtest", "c", 0.0))
+	assert.NoError(t, b.ZHAdd("zaddtest", "d", "dan", 0.0))
+
+	t.Run("Score", func(t *testing.T) {
+		members, err := b.ZHRangeByScore("zaddtest", -0.5, 1.0, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "bob", "c", "dan"}, members)
+
+		members, err = b.ZHRevRangeByScore("zaddtest", -0.5, 1.0, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"dan", "c", "bob", "a"}, members)
+
+		scored, err := b.ZHRangeByScoreWithScores("zaddtest", -0.5, 1.0, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, keyvaluestore.ScoredMembers{
+			{Value: "a", Score: 0.0},
+			{Value: "bob", Score: 0.0},
+		}, scored)
+	})
+
+	t.Run("Lex", func(t *testing.T) {
+		opts.require(t, CapabilityLexRanges)
+
+		members, err := b.ZHRangeByLex("zaddtest", "-", "+", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "bob", "c", "dan"}, members)
+
+		members, err = b.ZHRevRangeByLex("zaddtest", "-", "[c", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"c", "bob", "a"}, members)
+	})
+
+	t.Run("Fields", func(t *testing.T) {
+		members, err := keyvaluestore.ZHRangeByScoreWithFields(b, "zaddtest", -0.5, 1.0, 0)
+		if errors.Is(err, keyvaluestore.ErrNotSupported) {
+			t.Skip("backend doesn't support sorted hash fields")
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, keyvaluestore.FieldScoredMembers{
+			{Field: "a", Value: "a"},
+			{Field: "b", Value: "bob"},
+			{Field: "c", Value: "c"},
+			{Field: "d", Value: "dan"},
+		}, members)
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		opts.require(t, CapabilityBatch)
+
+		batch := b.Batch()
+		result := batch.ZHRangeByScore("zaddtest", -0.5, 1.0, 0)
+		require.NoError(t, batch.Exec())
+		members, err := result.Result()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "bob", "c", "dan"}, members)
+	})
+
+	t.Run("Upgrade", func(t *testing.T) {
+		assert.NoError(t, b.ZAdd("zaddupgrade", "a", 1.0))
+		assert.NoError(t, b.ZAdd("zaddupgrade", "b", 2.0))
+		assert.NoError(t, b.ZAdd("zaddupgrade", "c", 3.0))
+
+		// Adding a field with the same name as a ZAdd member replaces the member.
+		assert.NoError(t, b.ZHAdd("zaddupgrade", "a", "alice", 4.0))
+
+		// ZAdd members can be removed by field.
+		assert.NoError(t, b.ZHRem("zaddupgrade", "b"))
+		ok, err := b.ZHRemEQ("zaddupgrade", "c", "x")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		members, err := b.ZHRangeByScore("zaddupgrade", math.Inf(-1), math.Inf(1), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"c", "alice"}, members)
+
+		ok, err = b.ZHRemEQ("zaddupgrade", "c", "c")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		members, err = b.ZHRangeByScore("zaddupgrade", math.Inf(-1), math.Inf(1), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"alice"}, members)
+
+		n, err := b.ZCount("zaddupgrade", math.Inf(-1), math.Inf(1))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+	})
+}
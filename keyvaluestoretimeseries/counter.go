@@ -0,0 +1,196 @@
+// Package keyvaluestoretimeseries implements time-bucketed counters on top of any backend.
+package keyvaluestoretimeseries
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Resolution is a bucket size along with how long buckets of that size are kept.
+type Resolution struct {
+	Bucket    time.Duration
+	Retention time.Duration
+}
+
+// DefaultResolutions are used by counters that don't specify any. They keep per-minute counts for
+// a day, per-hour counts for 30 days, and per-day counts for two years.
+var DefaultResolutions = []Resolution{
+	{Bucket: time.Minute, Retention: 24 * time.Hour},
+	{Bucket: time.Hour, Retention: 30 * 24 * time.Hour},
+	{Bucket: 24 * time.Hour, Retention: 2 * 365 * 24 * time.Hour},
+}
+
+// Counter counts events in time buckets. Each increment is added to a bucket of every resolution,
+// so counts are rolled up as they're written. Buckets are aligned to UTC.
+//
+// Each bucket is stored as an integer at its own key, and each resolution has a sorted set of its
+// buckets, which Prune uses to find buckets past their retention.
+type Counter struct {
+	Backend keyvaluestore.Backend
+
+	// Resolutions must be ordered from the smallest bucket size to the largest, and each bucket
+	// size must be a multiple of the previous one. If nil, DefaultResolutions is used.
+	Resolutions []Resolution
+}
+
+func (c *Counter) resolutions() []Resolution {
+	if c.Resolutions != nil {
+		return c.Resolutions
+	}
+	return DefaultResolutions
+}
+
+func (c *Counter) validate() error {
+	resolutions := c.resolutions()
+	if len(resolutions) == 0 || 2*len(resolutions) > keyvaluestore.MaxAtomicWriteOperations {
+		return fmt.Errorf("invalid number of time series resolutions: %v", len(resolutions))
+	}
+	for i, r := range resolutions {
+		if r.Bucket <= 0 || (i > 0 && r.Bucket%resolutions[i-1].Bucket != 0) {
+			return fmt.Errorf("invalid time series bucket size: %v", r.Bucket)
+		}
+	}
+	return nil
+}
+
+func indexKey(name string, r Resolution) string {
+	return keyvaluestore.Key{name, r.Bucket.String()}.String()
+}
+
+func bucketKey(name string, r Resolution, start time.Time) string {
+	return keyvaluestore.Key{name, r.Bucket.String(), strconv.FormatInt(start.Unix(), 10)}.String()
+}
+
+// Incr is shorthand for IncrBy(name, t, 1).
+func (c *Counter) Incr(name string, t time.Time) error {
+	return c.IncrBy(name, t, 1)
+}
+
+// IncrBy adds n to the buckets containing t.
+func (c *Counter) IncrBy(name string, t time.Time, n int64) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	tx := c.Backend.AtomicWrite()
+	for _, r := range c.resolutions() {
+		start := t.Truncate(r.Bucket)
+		tx.NIncrBy(bucketKey(name, r, start), n)
+		tx.ZAdd(indexKey(name, r), start.Unix(), float64(start.Unix()))
+	}
+	if _, err := tx.Exec(); err != nil {
+		return err
+	}
+
+	if expirer, ok := c.Backend.(keyvaluestore.Expirer); ok {
+		for _, r := range c.resolutions() {
+			start := t.Truncate(r.Bucket)
+			if _, err := expirer.ExpireAt(bucketKey(name, r, start), start.Add(r.Bucket+r.Retention)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RangeSum returns the total count for the period from "from" (inclusive) to "to" (exclusive).
+// Both are rounded down to the smallest bucket size. The largest buckets that fit within the
+// period are used, so ranges that are older than the smallest resolution's retention are only
+// accurate if they're aligned to larger buckets.
+func (c *Counter) RangeSum(name string, from, to time.Time) (int64, error) {
+	if err := c.validate(); err != nil {
+		return 0, err
+	}
+
+	resolutions := c.resolutions()
+	from = from.Truncate(resolutions[0].Bucket)
+	to = to.Truncate(resolutions[0].Bucket)
+
+	batch := c.Backend.Batch()
+	var results []keyvaluestore.GetResult
+	c.cover(from, to, len(resolutions)-1, func(r Resolution, start time.Time) {
+		results = append(results, batch.Get(bucketKey(name, r, start)))
+	})
+	if err := batch.Exec(); err != nil {
+		return 0, err
+	}
+
+	var sum int64
+	for _, result := range results {
+		v, err := result.Result()
+		if err != nil {
+			return 0, err
+		} else if v == nil {
+			continue
+		}
+		n, err := strconv.ParseInt(*v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("malformed time series bucket: %w", keyvaluestore.ErrWrongType)
+		}
+		sum += n
+	}
+	return sum, nil
+}
+
+// cover invokes f for a minimal set of buckets that exactly covers the period from "from" to "to",
+// using resolutions up to the given index. Both must be aligned to the smallest bucket size.
+func (c *Counter) cover(from, to time.Time, resolution int, f func(r Resolution, start time.Time)) {
+	if !from.Before(to) {
+		return
+	}
+	r := c.resolutions()[resolution]
+	start := from.Truncate(r.Bucket)
+	if start.Before(from) {
+		start = start.Add(r.Bucket)
+	}
+	end := to.Truncate(r.Bucket)
+	if resolution == 0 || !start.Before(end) {
+		if resolution > 0 {
+			c.cover(from, to, resolution-1, f)
+			return
+		}
+		start, end = from, to
+	}
+	for t := start; t.Before(end); t = t.Add(r.Bucket) {
+		f(r, t)
+	}
+	if resolution > 0 {
+		c.cover(from, start, resolution-1, f)
+		c.cover(end, to, resolution-1, f)
+	}
+}
+
+// Prune deletes the buckets that are past their resolution's retention as of now. If the backend
+// implements Expirer, the buckets expire on their own, but Prune still needs to be invoked
+// periodically to remove them from the index.
+func (c *Counter) Prune(name string, now time.Time) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	for _, r := range c.resolutions() {
+		// A bucket is pruned once its end is older than the retention.
+		cutoff := now.Add(-r.Retention - r.Bucket)
+		starts, err := c.Backend.ZRangeByScore(indexKey(name, r), math.Inf(-1), float64(cutoff.Unix()), 0)
+		if err != nil {
+			return err
+		}
+		for _, s := range starts {
+			unix, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("malformed time series index: %w", keyvaluestore.ErrWrongType)
+			}
+			if _, err := c.Backend.Delete(bucketKey(name, r, time.Unix(unix, 0))); err != nil {
+				return err
+			}
+			if err := c.Backend.ZRem(indexKey(name, r), s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
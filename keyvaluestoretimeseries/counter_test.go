@@ -0,0 +1,126 @@
+package keyvaluestoretimeseries_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretimeseries"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+// hideExpirer hides the backend's keyvaluestoretimeseries.Expirer implementation.
+type hideExpirer struct {
+	keyvaluestore.Backend
+}
+
+func TestCounter(t *testing.T) {
+	c := &keyvaluestoretimeseries.Counter{
+		Backend: hideExpirer{memorystore.NewBackend()},
+	}
+
+	day := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	events := []time.Time{
+		day.Add(-time.Minute),
+		day,
+		day.Add(30 * time.Second),
+		day.Add(time.Minute),
+		day.Add(90 * time.Minute),
+		day.Add(23 * time.Hour),
+		day.Add(36 * time.Hour),
+	}
+	for _, e := range events {
+		require.NoError(t, c.Incr("signups", e))
+	}
+	require.NoError(t, c.IncrBy("logins", day, 5))
+
+	for name, tc := range map[string]struct {
+		From     time.Time
+		To       time.Time
+		Expected int64
+	}{
+		"Minute":         {day, day.Add(time.Minute), 2},
+		"PartialMinutes": {day.Add(30 * time.Second), day.Add(90 * time.Second), 2},
+		"Hour":           {day, day.Add(time.Hour), 3},
+		"Day":            {day, day.Add(24 * time.Hour), 5},
+		"Unaligned":      {day.Add(-time.Minute), day.Add(91*time.Minute + time.Second), 5},
+		"Days":           {day.Add(-24 * time.Hour), day.Add(48 * time.Hour), 7},
+		"Empty":          {day.Add(2 * time.Hour), day.Add(3 * time.Hour), 0},
+		"Backwards":      {day.Add(time.Hour), day, 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			n, err := c.RangeSum("signups", tc.From, tc.To)
+			require.NoError(t, err)
+			assert.Equal(t, tc.Expected, n)
+		})
+	}
+
+	n, err := c.RangeSum("logins", day, day.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+
+	t.Run("Prune", func(t *testing.T) {
+		require.NoError(t, c.Prune("signups", day.Add(48*time.Hour)))
+
+		// The minutes on the first day are gone, but the hours and days remain.
+		n, err := c.RangeSum("signups", day, day.Add(time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+
+		n, err = c.RangeSum("signups", day, day.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), n)
+
+		n, err = c.RangeSum("signups", day, day.Add(48*time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), n)
+	})
+}
+
+func TestCounterExpiration(t *testing.T) {
+	b := memorystore.NewBackend()
+	c := &keyvaluestoretimeseries.Counter{
+		Backend: b,
+		Resolutions: []keyvaluestoretimeseries.Resolution{
+			{Bucket: time.Second, Retention: time.Second},
+			{Bucket: time.Hour, Retention: time.Hour},
+		},
+	}
+
+	now := time.Now()
+	require.NoError(t, c.Incr("events", now.Add(-2*time.Second)))
+	require.NoError(t, c.Incr("events", now))
+
+	// The hourly bucket hasn't expired, and it has both events unless an hour just started.
+	start := now.Truncate(time.Hour)
+	expected := int64(1)
+	if now.Add(-2 * time.Second).After(start) {
+		expected = 2
+	}
+	n, err := c.RangeSum("events", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, expected, n)
+
+	// The old per-second bucket has already expired.
+	n, err = c.RangeSum("events", now.Add(-2*time.Second), now.Add(-time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	n, err = c.RangeSum("events", now, now.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestCounterInvalidResolutions(t *testing.T) {
+	c := &keyvaluestoretimeseries.Counter{
+		Backend: memorystore.NewBackend(),
+		Resolutions: []keyvaluestoretimeseries.Resolution{
+			{Bucket: time.Minute},
+			{Bucket: 90 * time.Second},
+		},
+	}
+	assert.Error(t, c.Incr("events", time.Now()))
+}
@@ -0,0 +1,170 @@
+package keyvaluestoretransform
+
+import "github.com/ccbrown/keyvaluestore"
+
+type atomicWriteOperation struct {
+	backend     *Backend
+	atomicWrite keyvaluestore.AtomicWriteOperation
+	err         error
+}
+
+type failedResult struct{}
+
+func (failedResult) ConditionalFailed() bool {
+	return false
+}
+
+// fail records the first error returned by BeforeWrite. Exec fails if there is one.
+func (op *atomicWriteOperation) fail(err error) keyvaluestore.AtomicWriteResult {
+	if op.err == nil {
+		op.err = err
+	}
+	return failedResult{}
+}
+
+func (op *atomicWriteOperation) Set(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	value, err := op.backend.beforeWrite(KindString, key, "", value)
+	if err != nil {
+		return op.fail(err)
+	}
+	return op.atomicWrite.Set(key, value)
+}
+
+func (op *atomicWriteOperation) SetNX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	value, err := op.backend.beforeWrite(KindString, key, "", value)
+	if err != nil {
+		return op.fail(err)
+	}
+	return op.atomicWrite.SetNX(key, value)
+}
+
+func (op *atomicWriteOperation) SetXX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	value, err := op.backend.beforeWrite(KindString, key, "", value)
+	if err != nil {
+		return op.fail(err)
+	}
+	return op.atomicWrite.SetXX(key, value)
+}
+
+func (op *atomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
+	value, err := op.backend.beforeWrite(KindString, key, "", value)
+	if err != nil {
+		return op.fail(err)
+	}
+	oldValue, err = op.backend.beforeWrite(KindString, key, "", oldValue)
+	if err != nil {
+		return op.fail(err)
+	}
+	return op.atomicWrite.SetEQ(key, value, oldValue)
+}
+
+func (op *atomicWriteOperation) Delete(key string) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.Delete(key)
+}
+
+func (op *atomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.DeleteXX(key)
+}
+
+func (op *atomicWriteOperation) NIncrBy(key string, n int64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.NIncrBy(key, n)
+}
+
+func (op *atomicWriteOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZAdd(key, member, score)
+}
+
+func (op *atomicWriteOperation) ZAddNX(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZAddNX(key, member, score)
+}
+
+func (op *atomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	member, err := op.backend.beforeWrite(KindSortedHashMember, key, field, member)
+	if err != nil {
+		return op.fail(err)
+	}
+	oldMember, err = op.backend.beforeWrite(KindSortedHashMember, key, field, oldMember)
+	if err != nil {
+		return op.fail(err)
+	}
+	return op.atomicWrite.ZHSetEQ(key, field, member, oldMember, score)
+}
+
+func (op *atomicWriteOperation) ZRem(key string, member interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZRem(key, member)
+}
+
+func (op *atomicWriteOperation) ZHAdd(key, field string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	member, err := op.backend.beforeWrite(KindSortedHashMember, key, field, member)
+	if err != nil {
+		return op.fail(err)
+	}
+	return op.atomicWrite.ZHAdd(key, field, member, score)
+}
+
+func (op *atomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	entries, err := op.backend.beforeWriteEntries(key, entries)
+	if err != nil {
+		return op.fail(err)
+	}
+	return op.atomicWrite.ZHMAdd(key, entries)
+}
+
+func (op *atomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.ZHRem(key, field)
+}
+
+func (op *atomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	member, err := op.backend.beforeWrite(KindSortedHashMember, key, field, member)
+	if err != nil {
+		return op.fail(err)
+	}
+	return op.atomicWrite.ZHRemEQ(key, field, member)
+}
+
+func (op *atomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.SAdd(key, member, members...)
+}
+
+func (op *atomicWriteOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.SRem(key, member, members...)
+}
+
+func (op *atomicWriteOperation) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) keyvaluestore.AtomicWriteResult {
+	value, fields, err := op.backend.beforeWriteFields(key, field, value, fields)
+	if err != nil {
+		return op.fail(err)
+	}
+	return op.atomicWrite.HSet(key, field, value, fields...)
+}
+
+func (op *atomicWriteOperation) HSetNX(key, field string, value interface{}) keyvaluestore.AtomicWriteResult {
+	value, err := op.backend.beforeWrite(KindHashField, key, field, value)
+	if err != nil {
+		return op.fail(err)
+	}
+	return op.atomicWrite.HSetNX(key, field, value)
+}
+
+func (op *atomicWriteOperation) HDel(key, field string, fields ...string) keyvaluestore.AtomicWriteResult {
+	return op.atomicWrite.HDel(key, field, fields...)
+}
+
+func (op *atomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.atomicWrite.WithIdempotencyToken(token)
+	return op
+}
+
+func (op *atomicWriteOperation) Validate() error {
+	if op.err != nil {
+		return op.err
+	}
+	return op.atomicWrite.Validate()
+}
+
+func (op *atomicWriteOperation) Exec() (bool, error) {
+	if op.err != nil {
+		return false, op.err
+	}
+	return op.atomicWrite.Exec()
+}
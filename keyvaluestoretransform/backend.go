@@ -0,0 +1,321 @@
+// Package keyvaluestoretransform provides a backend wrapper that applies hooks to values as they're
+// written and read, e.g. for redacting sensitive data, shimming legacy formats, or tagging metrics.
+package keyvaluestoretransform
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Backend passes string values, hash field values, and sorted hash members through BeforeWrite
+// before writing them to the underlying backend and through AfterRead after reading them.
+//
+// Integers written via NIncrBy, set members, and sorted set members written via ZAdd are stored
+// as-is since they're used for arithmetic, comparisons, and ordering. Values that can't be
+// converted to strings are passed through so that the underlying backend can reject them.
+//
+// Conditional writes such as SetEQ and ZHRemEQ compare the transformed values, so BeforeWrite must
+// be deterministic.
+type Backend struct {
+	Backend keyvaluestore.Backend
+
+	// If given, BeforeWrite returns the value to write in place of the given one. If it returns an
+	// error, nothing is written and the error is returned. Within batches and atomic writes, the
+	// first error fails the entire operation.
+	BeforeWrite func(v Value) (string, error)
+
+	// If given, AfterRead returns the value to return in place of the one that was read. If it
+	// returns an error, the error is returned instead of the value.
+	AfterRead func(v Value) (string, error)
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+var _ keyvaluestore.SortedHashFieldRanger = &Backend{}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return &atomicWriteOperation{
+		backend:     b,
+		atomicWrite: b.Backend.AtomicWrite(),
+	}
+}
+
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	return &batchOperation{
+		backend: b,
+		batch:   b.Backend.Batch(),
+	}
+}
+
+func (b *Backend) Ping() error {
+	return b.Backend.Ping()
+}
+
+func (b *Backend) Close() error {
+	return b.Backend.Close()
+}
+
+func (b *Backend) Delete(key string) (bool, error) {
+	return b.Backend.Delete(key)
+}
+
+func (b *Backend) Get(key string) (*string, error) {
+	v, err := b.Backend.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterRead(KindString, key, "", v)
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	value, err := b.beforeWrite(KindString, key, "", value)
+	if err != nil {
+		return err
+	}
+	return b.Backend.Set(key, value)
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	value, err := b.beforeWrite(KindString, key, "", value)
+	if err != nil {
+		return false, err
+	}
+	return b.Backend.SetXX(key, value)
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	value, err := b.beforeWrite(KindString, key, "", value)
+	if err != nil {
+		return false, err
+	}
+	return b.Backend.SetNX(key, value)
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	value, err := b.beforeWrite(KindString, key, "", value)
+	if err != nil {
+		return false, err
+	}
+	oldValue, err = b.beforeWrite(KindString, key, "", oldValue)
+	if err != nil {
+		return false, err
+	}
+	return b.Backend.SetEQ(key, value, oldValue)
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	return b.Backend.NIncrBy(key, n)
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	value, fields, err := b.beforeWriteFields(key, field, value, fields)
+	if err != nil {
+		return err
+	}
+	return b.Backend.HSet(key, field, value, fields...)
+}
+
+func (b *Backend) HGet(key, field string) (*string, error) {
+	v, err := b.Backend.HGet(key, field)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterRead(KindHashField, key, field, v)
+}
+
+func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	m, err := b.Backend.HGetAll(key)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterReadFields(key, m)
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	return b.Backend.SAdd(key, member, members...)
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	return b.Backend.SRem(key, member, members...)
+}
+
+func (b *Backend) SMembers(key string) ([]string, error) {
+	return b.Backend.SMembers(key)
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	return b.Backend.HDel(key, field, fields...)
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
+	return b.Backend.ZAdd(key, member, score)
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	return b.Backend.ZScore(key, member)
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	return b.Backend.ZRem(key, member)
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	return b.Backend.ZIncrBy(key, member, n)
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.Backend.ZRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	return b.Backend.ZCount(key, min, max)
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
+	return b.Backend.ZLexCount(key, min, max)
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	return b.Backend.ZRevRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	member, err := b.beforeWrite(KindSortedHashMember, key, field, member)
+	if err != nil {
+		return err
+	}
+	return b.Backend.ZHAdd(key, field, member, score)
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	entries, err := b.beforeWriteEntries(key, entries)
+	if err != nil {
+		return err
+	}
+	return b.Backend.ZHMAdd(key, entries)
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	return b.Backend.ZHRem(key, field)
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	member, err := b.beforeWrite(KindSortedHashMember, key, field, member)
+	if err != nil {
+		return false, err
+	}
+	return b.Backend.ZHRemEQ(key, field, member)
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	members, err := b.Backend.ZHRangeByScore(key, min, max, limit)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterReadMembers(key, members)
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	members, err := b.Backend.ZHRangeByScoreWithScores(key, min, max, limit)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterReadScoredMembers(key, members)
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	members, err := b.Backend.ZHRevRangeByScore(key, min, max, limit)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterReadMembers(key, members)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	members, err := b.Backend.ZHRevRangeByScoreWithScores(key, min, max, limit)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterReadScoredMembers(key, members)
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	members, err := b.Backend.ZHRangeByLex(key, min, max, limit)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterReadMembers(key, members)
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	members, err := b.Backend.ZHRevRangeByLex(key, min, max, limit)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterReadMembers(key, members)
+}
+
+func (b *Backend) ZHRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	members, err := keyvaluestore.ZHRangeByScoreWithFields(b.Backend, key, min, max, limit)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterReadFieldScoredMembers(key, members)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	members, err := keyvaluestore.ZHRevRangeByScoreWithFields(b.Backend, key, min, max, limit)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterReadFieldScoredMembers(key, members)
+}
+
+func (b *Backend) ZHRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	members, err := keyvaluestore.ZHRangeByLexWithFields(b.Backend, key, min, max, limit)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterReadFieldScoredMembers(key, members)
+}
+
+func (b *Backend) ZHRevRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	members, err := keyvaluestore.ZHRevRangeByLexWithFields(b.Backend, key, min, max, limit)
+	if err != nil {
+		return nil, err
+	}
+	return b.afterReadFieldScoredMembers(key, members)
+}
+
+func (b Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	b.Backend = b.Backend.WithProfiler(profiler)
+	return &b
+}
+
+func (b Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	b.Backend = b.Backend.WithEventuallyConsistentReads()
+	return &b
+}
+
+func (b Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	b.Backend = keyvaluestore.WithOptions(b.Backend, opts)
+	return &b
+}
+
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return b.Backend
+}
@@ -0,0 +1,184 @@
+package keyvaluestoretransform
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func identity(v Value) (string, error) {
+	return v.Value, nil
+}
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return &Backend{
+			Backend:     memorystore.NewBackend(),
+			BeforeWrite: identity,
+			AfterRead:   identity,
+		}
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return &Backend{
+			Backend:     b,
+			BeforeWrite: identity,
+			AfterRead:   identity,
+		}
+	}, keyvaluestoretest.WrapperOptions{})
+}
+
+func TestTransform(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	var written []Value
+	b := &Backend{
+		Backend: underlying,
+		BeforeWrite: func(v Value) (string, error) {
+			if v.Value == "invalid" {
+				return "", errors.New("invalid value")
+			}
+			written = append(written, v)
+			return "v1:" + v.Value, nil
+		},
+		AfterRead: func(v Value) (string, error) {
+			if !strings.HasPrefix(v.Value, "v1:") {
+				return "", errors.New("unknown format")
+			}
+			return strings.TrimPrefix(v.Value, "v1:"), nil
+		},
+	}
+
+	t.Run("Strings", func(t *testing.T) {
+		require.NoError(t, b.Set("foo", "bar"))
+		v, err := underlying.Get("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "v1:bar", *v)
+
+		v, err = b.Get("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", *v)
+
+		ok, err := b.SetEQ("foo", "baz", "bar")
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		assert.Error(t, b.Set("foo", "invalid"))
+		v, err = b.Get("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "baz", *v)
+
+		require.NoError(t, underlying.Set("legacy", "qux"))
+		_, err = b.Get("legacy")
+		assert.Error(t, err)
+	})
+
+	t.Run("Hashes", func(t *testing.T) {
+		written = nil
+		require.NoError(t, b.HSet("h", "a", "1", keyvaluestore.KeyValue{Key: "b", Value: 2}))
+		assert.Equal(t, []Value{
+			{Kind: KindHashField, Key: "h", Field: "a", Value: "1"},
+			{Kind: KindHashField, Key: "h", Field: "b", Value: "2"},
+		}, written)
+
+		v, err := b.HGet("h", "b")
+		require.NoError(t, err)
+		assert.Equal(t, "2", *v)
+
+		m, err := b.HGetAll("h")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "1", "b": "2"}, m)
+	})
+
+	t.Run("SortedHashes", func(t *testing.T) {
+		require.NoError(t, b.ZHAdd("zh", "a", "x", 1))
+		require.NoError(t, b.ZHMAdd("zh", []keyvaluestore.ZHEntry{{Field: "b", Member: "y", Score: 2}}))
+
+		members, err := underlying.ZHRangeByScore("zh", 0, 10, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"v1:x", "v1:y"}, members)
+
+		members, err = b.ZHRangeByScore("zh", 0, 10, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"x", "y"}, members)
+
+		withFields, err := b.ZHRangeByScoreWithFields("zh", 0, 10, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"x", "y"}, withFields.Values())
+
+		ok, err := b.ZHRemEQ("zh", "a", "x")
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		// Sorted set members aren't transformed.
+		require.NoError(t, b.ZAdd("z", "x", 1))
+		members, err = underlying.ZRangeByScore("z", 0, 10, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"x"}, members)
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		batch := b.Batch()
+		batch.Set("batch", "bar")
+		batch.ZHMAdd("batchzh", []keyvaluestore.ZHEntry{{Field: "a", Member: "x"}})
+		require.NoError(t, batch.Exec())
+
+		batch = b.Batch()
+		get := batch.Get("batch")
+		zRange := batch.ZHRangeByScore("batchzh", 0, 0, 0)
+		require.NoError(t, batch.Exec())
+		v, err := get.Result()
+		require.NoError(t, err)
+		assert.Equal(t, "bar", *v)
+		members, err := zRange.Result()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"x"}, members)
+
+		batch = b.Batch()
+		batch.Set("batch2", "bar")
+		set := batch.Set("batch", "invalid")
+		assert.Error(t, batch.Exec())
+		assert.Error(t, set.Result())
+		v, err = b.Get("batch2")
+		require.NoError(t, err)
+		assert.Nil(t, v)
+	})
+
+	t.Run("AtomicWrite", func(t *testing.T) {
+		tx := b.AtomicWrite()
+		tx.SetNX("atomic", "bar")
+		tx.HSetNX("atomich", "a", "1")
+		tx.ZHAdd("atomiczh", "a", "x", 0)
+		ok, err := tx.Exec()
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		v, err := b.HGet("atomich", "a")
+		require.NoError(t, err)
+		assert.Equal(t, "1", *v)
+
+		tx = b.AtomicWrite()
+		tx.ZHSetEQ("atomiczh", "a", "y", "x", 0)
+		ok, err = tx.Exec()
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		tx = b.AtomicWrite()
+		tx.Set("atomic2", "bar")
+		tx.Set("atomic", "invalid")
+		assert.Error(t, tx.Validate())
+		_, err = tx.Exec()
+		assert.Error(t, err)
+		v, err = b.Get("atomic2")
+		require.NoError(t, err)
+		assert.Nil(t, v)
+	})
+}
@@ -0,0 +1,140 @@
+package keyvaluestoretransform
+
+import "github.com/ccbrown/keyvaluestore"
+
+type batchOperation struct {
+	backend *Backend
+	batch   keyvaluestore.BatchOperation
+	err     error
+}
+
+type errorResult struct {
+	err error
+}
+
+func (r errorResult) Result() error {
+	return r.err
+}
+
+// fail records the first error returned by BeforeWrite. Exec fails if there is one.
+func (op *batchOperation) fail(err error) keyvaluestore.ErrorResult {
+	if op.err == nil {
+		op.err = err
+	}
+	return errorResult{err}
+}
+
+type getResult struct {
+	backend *Backend
+	key     string
+	result  keyvaluestore.GetResult
+}
+
+func (r *getResult) Result() (*string, error) {
+	v, err := r.result.Result()
+	if err != nil {
+		return nil, err
+	}
+	return r.backend.afterRead(KindString, r.key, "", v)
+}
+
+type zRangeResult struct {
+	backend *Backend
+	key     string
+	result  keyvaluestore.ZRangeResult
+}
+
+func (r *zRangeResult) Result() ([]string, error) {
+	members, err := r.result.Result()
+	if err != nil {
+		return nil, err
+	}
+	return r.backend.afterReadMembers(r.key, members)
+}
+
+func (op *batchOperation) Get(key string) keyvaluestore.GetResult {
+	return &getResult{
+		backend: op.backend,
+		key:     key,
+		result:  op.batch.Get(key),
+	}
+}
+
+func (op *batchOperation) Delete(key string) keyvaluestore.ErrorResult {
+	return op.batch.Delete(key)
+}
+
+func (op *batchOperation) Set(key string, value interface{}) keyvaluestore.ErrorResult {
+	value, err := op.backend.beforeWrite(KindString, key, "", value)
+	if err != nil {
+		return op.fail(err)
+	}
+	return op.batch.Set(key, value)
+}
+
+func (op *batchOperation) SMembers(key string) keyvaluestore.SMembersResult {
+	return op.batch.SMembers(key)
+}
+
+func (op *batchOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	return op.batch.SAdd(key, member, members...)
+}
+
+func (op *batchOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	return op.batch.SRem(key, member, members...)
+}
+
+func (op *batchOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.ErrorResult {
+	return op.batch.ZAdd(key, member, score)
+}
+
+func (op *batchOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.ErrorResult {
+	entries, err := op.backend.beforeWriteEntries(key, entries)
+	if err != nil {
+		return op.fail(err)
+	}
+	return op.batch.ZHMAdd(key, entries)
+}
+
+func (op *batchOperation) ZRem(key string, member interface{}) keyvaluestore.ErrorResult {
+	return op.batch.ZRem(key, member)
+}
+
+func (op *batchOperation) ZScore(key string, member interface{}) keyvaluestore.ZScoreResult {
+	return op.batch.ZScore(key, member)
+}
+
+func (op *batchOperation) zRange(key string, result keyvaluestore.ZRangeResult) keyvaluestore.ZRangeResult {
+	return &zRangeResult{
+		backend: op.backend,
+		key:     key,
+		result:  result,
+	}
+}
+
+func (op *batchOperation) ZHRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.zRange(key, op.batch.ZHRangeByScore(key, min, max, limit))
+}
+
+func (op *batchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return op.zRange(key, op.batch.ZHRevRangeByScore(key, min, max, limit))
+}
+
+func (op *batchOperation) ZHRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.zRange(key, op.batch.ZHRangeByLex(key, min, max, limit))
+}
+
+func (op *batchOperation) ZHRevRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return op.zRange(key, op.batch.ZHRevRangeByLex(key, min, max, limit))
+}
+
+func (op *batchOperation) Len() int {
+	return op.batch.Len()
+}
+
+func (op *batchOperation) Exec() error {
+	if op.err != nil {
+		return op.err
+	}
+	return op.batch.Exec()
+}
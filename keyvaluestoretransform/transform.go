@@ -0,0 +1,173 @@
+package keyvaluestoretransform
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Kind identifies where a transformed value is stored.
+type Kind int
+
+const (
+	// KindString is the value of a key written by Set, SetNX, SetXX, or SetEQ.
+	KindString Kind = iota
+
+	// KindHashField is the value of a hash field.
+	KindHashField
+
+	// KindSortedHashMember is a member of a sorted hash, written by ZHAdd or ZHMAdd.
+	KindSortedHashMember
+)
+
+// Value is a value passed to a hook.
+type Value struct {
+	Kind Kind
+	Key  string
+
+	// Field is the hash field or sorted hash field that the value belongs to. It's empty for
+	// strings and for sorted hash members read via ranges that don't return fields.
+	Field string
+
+	Value string
+}
+
+func (b *Backend) beforeWrite(kind Kind, key, field string, value interface{}) (interface{}, error) {
+	if b.BeforeWrite == nil {
+		return value, nil
+	}
+	s := keyvaluestore.ToString(value)
+	if s == nil {
+		// Let the underlying backend reject the value.
+		return value, nil
+	}
+	return b.BeforeWrite(Value{
+		Kind:  kind,
+		Key:   key,
+		Field: field,
+		Value: *s,
+	})
+}
+
+func (b *Backend) beforeWriteFields(key, field string, value interface{}, fields []keyvaluestore.KeyValue) (interface{}, []keyvaluestore.KeyValue, error) {
+	value, err := b.beforeWrite(KindHashField, key, field, value)
+	if err != nil || len(fields) == 0 {
+		return value, nil, err
+	}
+	transformed := make([]keyvaluestore.KeyValue, len(fields))
+	for i, kv := range fields {
+		v, err := b.beforeWrite(KindHashField, key, kv.Key, kv.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		transformed[i] = keyvaluestore.KeyValue{
+			Key:   kv.Key,
+			Value: v,
+		}
+	}
+	return value, transformed, nil
+}
+
+func (b *Backend) beforeWriteEntries(key string, entries []keyvaluestore.ZHEntry) ([]keyvaluestore.ZHEntry, error) {
+	if b.BeforeWrite == nil {
+		return entries, nil
+	}
+	transformed := make([]keyvaluestore.ZHEntry, len(entries))
+	for i, entry := range entries {
+		member, err := b.beforeWrite(KindSortedHashMember, key, entry.Field, entry.Member)
+		if err != nil {
+			return nil, err
+		}
+		transformed[i] = keyvaluestore.ZHEntry{
+			Field:  entry.Field,
+			Member: member,
+			Score:  entry.Score,
+		}
+	}
+	return transformed, nil
+}
+
+func (b *Backend) afterRead(kind Kind, key, field string, v *string) (*string, error) {
+	if b.AfterRead == nil || v == nil {
+		return v, nil
+	}
+	s, err := b.AfterRead(Value{
+		Kind:  kind,
+		Key:   key,
+		Field: field,
+		Value: *v,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (b *Backend) afterReadFields(key string, m map[string]string) (map[string]string, error) {
+	if b.AfterRead == nil || m == nil {
+		return m, nil
+	}
+	ret := make(map[string]string, len(m))
+	for field, v := range m {
+		v := v
+		s, err := b.afterRead(KindHashField, key, field, &v)
+		if err != nil {
+			return nil, err
+		}
+		ret[field] = *s
+	}
+	return ret, nil
+}
+
+func (b *Backend) afterReadMembers(key string, members []string) ([]string, error) {
+	if b.AfterRead == nil || members == nil {
+		return members, nil
+	}
+	ret := make([]string, len(members))
+	for i, member := range members {
+		member := member
+		s, err := b.afterRead(KindSortedHashMember, key, "", &member)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = *s
+	}
+	return ret, nil
+}
+
+func (b *Backend) afterReadScoredMembers(key string, members keyvaluestore.ScoredMembers) (keyvaluestore.ScoredMembers, error) {
+	if b.AfterRead == nil || members == nil {
+		return members, nil
+	}
+	ret := make(keyvaluestore.ScoredMembers, len(members))
+	for i, member := range members {
+		value := member.Value
+		s, err := b.afterRead(KindSortedHashMember, key, "", &value)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = &keyvaluestore.ScoredMember{
+			Score: member.Score,
+			Value: *s,
+		}
+	}
+	return ret, nil
+}
+
+func (b *Backend) afterReadFieldScoredMembers(key string, members keyvaluestore.FieldScoredMembers) (keyvaluestore.FieldScoredMembers, error) {
+	if b.AfterRead == nil || members == nil {
+		return members, nil
+	}
+	ret := make(keyvaluestore.FieldScoredMembers, len(members))
+	for i, member := range members {
+		value := member.Value
+		s, err := b.afterRead(KindSortedHashMember, key, member.Field, &value)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = &keyvaluestore.FieldScoredMember{
+			Field: member.Field,
+			Value: *s,
+			Score: member.Score,
+		}
+	}
+	return ret, nil
+}
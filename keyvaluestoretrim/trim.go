@@ -0,0 +1,121 @@
+// Package keyvaluestoretrim keeps sorted sets such as feeds and timelines bounded, either by age or
+// by size.
+package keyvaluestoretrim
+
+import (
+	"math"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// DefaultBatchSize is the number of members removed per batch by trimmers that don't specify one.
+const DefaultBatchSize = 100
+
+// Trimmer removes the oldest or lowest-scored members of sorted sets. It can be invoked inline
+// after writes or periodically from a janitor process.
+//
+// Removals are made in batches. Spreading large trims out via Delay and MaxRemovals avoids
+// concentrating writes on a single key, which can get throttled by backends such as DynamoDB that
+// store each sorted set in a single partition.
+type Trimmer struct {
+	Backend keyvaluestore.Backend
+
+	// BatchSize is the number of members removed per batch. If zero, DefaultBatchSize is used.
+	BatchSize int
+
+	// Delay is how long to wait between batches.
+	Delay time.Duration
+
+	// MaxRemovals limits the number of members removed per invocation. Any excess is left for the
+	// next invocation. If zero, there's no limit.
+	MaxRemovals int
+
+	// ScoreUnit is the unit of the scores used by TrimByScore, which must be Unix timestamps. If
+	// zero, scores are in seconds.
+	ScoreUnit time.Duration
+
+	// Clock is used to get the current time. If nil, the wall clock is used.
+	Clock keyvaluestore.Clock
+}
+
+func (t *Trimmer) currentTime() time.Time {
+	return keyvaluestore.Now(t.Clock)
+}
+
+func (t *Trimmer) batchSize() int {
+	if t.BatchSize > 0 {
+		return t.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+func (t *Trimmer) score(tm time.Time) float64 {
+	unit := t.ScoreUnit
+	if unit <= 0 {
+		unit = time.Second
+	}
+	return float64(tm.UnixNano()) / float64(unit)
+}
+
+// limit caps n at MaxRemovals.
+func (t *Trimmer) limit(n int) int {
+	if t.MaxRemovals > 0 && (n == 0 || n > t.MaxRemovals) {
+		return t.MaxRemovals
+	}
+	return n
+}
+
+// TrimByScore removes the members whose scores are older than maxAge. It returns the number of
+// members removed.
+func (t *Trimmer) TrimByScore(key string, maxAge time.Duration) (int, error) {
+	cutoff := t.currentTime().Add(-maxAge)
+	members, err := keyvaluestore.ZRangeByScoreRange(t.Backend, key, keyvaluestore.ScoreRange{
+		Min:          math.Inf(-1),
+		Max:          t.score(cutoff),
+		MaxExclusive: true,
+	}, t.limit(0))
+	if err != nil {
+		return 0, err
+	}
+	return t.remove(key, members)
+}
+
+// TrimToSize removes the lowest-scored members until at most n remain. It returns the number of
+// members removed.
+func (t *Trimmer) TrimToSize(key string, n int) (int, error) {
+	count, err := t.Backend.ZCount(key, math.Inf(-1), math.Inf(1))
+	if err != nil || count <= n {
+		return 0, err
+	}
+	members, err := t.Backend.ZRangeByScore(key, math.Inf(-1), math.Inf(1), t.limit(count-n))
+	if err != nil {
+		return 0, err
+	}
+	return t.remove(key, members)
+}
+
+func (t *Trimmer) remove(key string, members []string) (int, error) {
+	removed := 0
+	for len(members) > 0 {
+		if removed > 0 && t.Delay > 0 {
+			time.Sleep(t.Delay)
+		}
+
+		chunk := members
+		if len(chunk) > t.batchSize() {
+			chunk = chunk[:t.batchSize()]
+		}
+		members = members[len(chunk):]
+
+		batch := t.Backend.Batch()
+		for _, member := range chunk {
+			batch.ZRem(key, member)
+		}
+		if err := batch.Exec(); err != nil {
+			return removed, err
+		}
+		removed += len(chunk)
+	}
+	return removed, nil
+}
@@ -0,0 +1,72 @@
+package keyvaluestoretrim
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestTrimByScore(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	trimmer := &Trimmer{
+		Backend:   memorystore.NewBackend(),
+		BatchSize: 3,
+		Clock: keyvaluestore.ClockFunc(func() time.Time {
+			return now
+		}),
+	}
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, trimmer.Backend.ZAdd("feed", strconv.Itoa(i), float64(now.Add(time.Duration(i-10)*time.Minute).Unix())))
+	}
+
+	n, err := trimmer.TrimByScore("feed", 5*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	members, err := trimmer.Backend.ZRangeByScore("feed", math.Inf(-1), math.Inf(1), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"5", "6", "7", "8", "9"}, members)
+
+	trimmer.MaxRemovals = 2
+	trimmer.ScoreUnit = time.Millisecond
+	n, err = trimmer.TrimByScore("feed", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestTrimToSize(t *testing.T) {
+	trimmer := &Trimmer{
+		Backend:   memorystore.NewBackend(),
+		BatchSize: 2,
+		Delay:     time.Millisecond,
+	}
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, trimmer.Backend.ZAdd("feed", strconv.Itoa(i), float64(i)))
+	}
+
+	n, err := trimmer.TrimToSize("feed", 20)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = trimmer.TrimToSize("feed", 7)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	trimmer.MaxRemovals = 2
+	n, err = trimmer.TrimToSize("feed", 3)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	members, err := trimmer.Backend.ZRangeByScore("feed", math.Inf(-1), math.Inf(1), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"5", "6", "7", "8", "9"}, members)
+}
@@ -0,0 +1,20 @@
+package keyvaluestorewritebehind
+
+import "github.com/ccbrown/keyvaluestore"
+
+type atomicWriteOperation struct {
+	keyvaluestore.AtomicWriteOperation
+	backend *Backend
+}
+
+func (op *atomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.AtomicWriteOperation.WithIdempotencyToken(token)
+	return op
+}
+
+func (op *atomicWriteOperation) Exec() (bool, error) {
+	if err := op.backend.Flush(); err != nil {
+		return false, err
+	}
+	return op.AtomicWriteOperation.Exec()
+}
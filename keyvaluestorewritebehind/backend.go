@@ -0,0 +1,374 @@
+// Package keyvaluestorewritebehind provides a backend wrapper that buffers writes and applies them
+// to the underlying backend in the background.
+package keyvaluestorewritebehind
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Backend acknowledges Set, SAdd, ZAdd, and HSet immediately, buffers them, and periodically
+// flushes them to the underlying backend in batches. It's intended for workloads such as telemetry
+// where losing recent writes on a crash is acceptable in exchange for fewer round trips.
+//
+// All other operations, including reads, flush the buffer first, so a process always observes its
+// own writes and buffered writes are never reordered relative to unbuffered ones. If that flush
+// fails, the operation returns the flush's error without being attempted. Buffered writes aren't
+// visible to other processes until they're flushed, and errors from background flushes can only
+// be observed via Options.OnError.
+//
+// Close must be invoked once the backend is no longer needed to stop its background goroutine and
+// flush any remaining writes.
+type Backend struct {
+	backend keyvaluestore.Backend
+	buffer  *writeBuffer
+}
+
+var _ keyvaluestore.Backend = &Backend{}
+
+// NewBackend creates a write-behind backend and starts flushing writes to the given backend in the
+// background.
+func NewBackend(backend keyvaluestore.Backend, options Options) *Backend {
+	return &Backend{
+		backend: backend,
+		buffer:  newWriteBuffer(backend, options),
+	}
+}
+
+// Flush applies all writes that were buffered before it was invoked. If any of them fail, the
+// first error is returned.
+func (b *Backend) Flush() error {
+	return b.buffer.flush()
+}
+
+// Close stops the background flushes, flushes any remaining writes, and closes the underlying
+// backend. If the flush fails, the underlying backend is still closed, and the flush's error is
+// returned.
+func (b *Backend) Close() error {
+	err := b.buffer.close()
+	if closeErr := b.backend.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Buffered returns the number of writes that are waiting to be flushed.
+func (b *Backend) Buffered() int {
+	return b.buffer.len()
+}
+
+func (b *Backend) add(w *bufferedWrite, direct func() error) error {
+	if ok, err := b.buffer.add(w); err != nil || ok {
+		return err
+	}
+	return direct()
+}
+
+func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
+	return &atomicWriteOperation{
+		AtomicWriteOperation: b.backend.AtomicWrite(),
+		backend:              b,
+	}
+}
+
+func (b *Backend) Batch() keyvaluestore.BatchOperation {
+	return &batchOperation{
+		BatchOperation: b.backend.Batch(),
+		backend:        b,
+	}
+}
+
+// Ping doesn't flush the buffer.
+func (b *Backend) Ping() error {
+	return b.backend.Ping()
+}
+
+func (b *Backend) Set(key string, value interface{}) error {
+	return b.add(&bufferedWrite{
+		kind:  writeKindSet,
+		key:   key,
+		value: copyValue(value),
+	}, func() error {
+		return b.backend.Set(key, value)
+	})
+}
+
+func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	return b.add(&bufferedWrite{
+		kind:   writeKindSAdd,
+		key:    key,
+		value:  copyValue(member),
+		values: copyValues(members),
+	}, func() error {
+		return b.backend.SAdd(key, member, members...)
+	})
+}
+
+func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	return b.add(&bufferedWrite{
+		kind:   writeKindHSet,
+		key:    key,
+		field:  field,
+		value:  copyValue(value),
+		fields: copyFields(fields),
+	}, func() error {
+		return b.backend.HSet(key, field, value, fields...)
+	})
+}
+
+func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
+	return b.add(&bufferedWrite{
+		kind:  writeKindZAdd,
+		key:   key,
+		value: copyValue(member),
+		score: score,
+	}, func() error {
+		return b.backend.ZAdd(key, member, score)
+	})
+}
+
+func (b *Backend) Delete(key string) (bool, error) {
+	if err := b.Flush(); err != nil {
+		return false, err
+	}
+	return b.backend.Delete(key)
+}
+
+func (b *Backend) Get(key string) (*string, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.Get(key)
+}
+
+func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	if err := b.Flush(); err != nil {
+		return false, err
+	}
+	return b.backend.SetXX(key, value)
+}
+
+func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	if err := b.Flush(); err != nil {
+		return false, err
+	}
+	return b.backend.SetNX(key, value)
+}
+
+func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	if err := b.Flush(); err != nil {
+		return false, err
+	}
+	return b.backend.SetEQ(key, value, oldValue)
+}
+
+func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	if err := b.Flush(); err != nil {
+		return 0, err
+	}
+	return b.backend.NIncrBy(key, n)
+}
+
+func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	return b.backend.SRem(key, member, members...)
+}
+
+func (b *Backend) SMembers(key string) ([]string, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.SMembers(key)
+}
+
+func (b *Backend) HDel(key, field string, fields ...string) error {
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	return b.backend.HDel(key, field, fields...)
+}
+
+func (b *Backend) HGet(key, field string) (*string, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.HGet(key, field)
+}
+
+func (b *Backend) HGetAll(key string) (map[string]string, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.HGetAll(key)
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZScore(key, member)
+}
+
+func (b *Backend) ZRem(key string, member interface{}) error {
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	return b.backend.ZRem(key, member)
+}
+
+func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	if err := b.Flush(); err != nil {
+		return 0, err
+	}
+	return b.backend.ZIncrBy(key, member, n)
+}
+
+func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	if err := b.Flush(); err != nil {
+		return 0, err
+	}
+	return b.backend.ZCount(key, min, max)
+}
+
+func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
+	if err := b.Flush(); err != nil {
+		return 0, err
+	}
+	return b.backend.ZLexCount(key, min, max)
+}
+
+func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZRevRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	return b.backend.ZHAdd(key, field, member, score)
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	return b.backend.ZHMAdd(key, entries)
+}
+
+func (b *Backend) ZHRem(key, field string) error {
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	return b.backend.ZHRem(key, field)
+}
+
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	if err := b.Flush(); err != nil {
+		return false, err
+	}
+	return b.backend.ZHRemEQ(key, field, member)
+}
+
+func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZHRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZHRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZHRevRangeByScore(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZHRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZHRangeByLex(key, min, max, limit)
+}
+
+func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.backend.ZHRevRangeByLex(key, min, max, limit)
+}
+
+// WithProfiler returns a backend that reads via a profiled backend. It shares the receiver's
+// buffer, which continues to flush via the original backend.
+func (b Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
+	b.backend = b.backend.WithProfiler(profiler)
+	return &b
+}
+
+// WithEventuallyConsistentReads returns a backend that shares the receiver's buffer.
+func (b Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
+	b.backend = b.backend.WithEventuallyConsistentReads()
+	return &b
+}
+
+// WithOptions returns a backend that shares the receiver's buffer.
+func (b Backend) WithOptions(opts keyvaluestore.RequestOptions) keyvaluestore.Backend {
+	b.backend = keyvaluestore.WithOptions(b.backend, opts)
+	return &b
+}
+
+func (b *Backend) Unwrap() keyvaluestore.Backend {
+	return b.backend
+}
@@ -0,0 +1,195 @@
+package keyvaluestorewritebehind
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoremock"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestBackend(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return NewBackend(memorystore.NewBackend(), Options{
+			MaxBatchSize: 3,
+		})
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	keyvaluestoretest.TestWrapper(t, func(b keyvaluestore.Backend) keyvaluestore.Backend {
+		return NewBackend(b, Options{
+			MaxBatchSize: 3,
+		})
+	}, keyvaluestoretest.WrapperOptions{
+		// Buffered writes fail when they're flushed.
+		Unforwarded: []string{"Set", "HSet", "SAdd", "ZAdd"},
+	})
+}
+
+func TestBackendConcurrency(t *testing.T) {
+	keyvaluestoretest.TestBackendConcurrency(t, func() keyvaluestore.Backend {
+		return NewBackend(memorystore.NewBackend(), Options{
+			FlushInterval: time.Millisecond,
+			MaxBatchSize:  3,
+		})
+	})
+}
+
+func TestWriteBehind(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	b := NewBackend(underlying, Options{
+		FlushInterval: time.Hour,
+	})
+	defer b.Close()
+
+	buf := []byte("foo")
+	require.NoError(t, b.Set("a", buf))
+	buf[0] = 'x'
+	require.NoError(t, b.SAdd("s", "a", "b"))
+	require.NoError(t, b.ZAdd("z", "a", 1))
+	require.NoError(t, b.HSet("h", "f", "v", keyvaluestore.KeyValue{Key: "g", Value: "w"}))
+	require.NoError(t, b.Set("b", "bar"))
+	assert.Equal(t, 5, b.Buffered())
+
+	v, err := underlying.Get("a")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	require.NoError(t, b.Flush())
+	assert.Equal(t, 0, b.Buffered())
+
+	v, err = underlying.Get("a")
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, "foo", *v)
+
+	members, err := underlying.SMembers("s")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, members)
+
+	fields, err := underlying.HGetAll("h")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"f": "v", "g": "w"}, fields)
+
+	// Reads flush first.
+	require.NoError(t, b.ZAdd("z", "b", 2))
+	members, err = b.ZRangeByScore("z", 0, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, members)
+
+	// Unbuffered writes aren't reordered.
+	require.NoError(t, b.Set("c", "x"))
+	tx := b.AtomicWrite()
+	tx.SetEQ("c", "y", "x")
+	ok, err := tx.Exec()
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestWriteBehindBatches(t *testing.T) {
+	mock := &keyvaluestoremock.Backend{}
+	b := NewBackend(mock, Options{
+		FlushInterval:     time.Hour,
+		MaxBatchSize:      2,
+		MaxBufferedWrites: 5,
+	})
+	defer b.Close()
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, b.Set(key, "x"))
+	}
+
+	// A full batch starts a flush in the background.
+	for deadline := time.Now().Add(time.Second); b.Buffered() > 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, len(mock.CallsTo("Batch")) >= 1)
+
+	// Hitting the buffer limit flushes synchronously.
+	for _, key := range []string{"e", "f", "g", "h", "i"} {
+		require.NoError(t, b.Set(key, "x"))
+	}
+	require.NoError(t, b.Flush())
+	assert.Len(t, mock.CallsTo("Set"), 9)
+	assert.True(t, len(mock.CallsTo("Batch")) >= 5)
+}
+
+func TestWriteBehindErrors(t *testing.T) {
+	mock := &keyvaluestoremock.Backend{}
+	var mutex sync.Mutex
+	var errs []error
+	b := NewBackend(mock, Options{
+		FlushInterval: time.Millisecond,
+		OnError: func(err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			errs = append(errs, err)
+		},
+	})
+
+	errFoo := errors.New("foo")
+	mock.SetError("Set", errFoo)
+	require.NoError(t, b.Set("a", "x"))
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		mutex.Lock()
+		n := len(errs)
+		mutex.Unlock()
+		if n > 0 {
+			break
+		}
+	}
+	mutex.Lock()
+	require.Len(t, errs, 1)
+	assert.True(t, errors.Is(errs[0], errFoo))
+	mutex.Unlock()
+
+	require.NoError(t, b.Close())
+
+	// Explicit flushes return errors.
+	b = NewBackend(mock, Options{
+		FlushInterval: time.Hour,
+	})
+	mock.SetError("Set", nil)
+	mock.SetError("HSet", errFoo)
+	require.NoError(t, b.Set("b", "x"))
+	require.NoError(t, b.HSet("h", "f", "x"))
+	assert.Equal(t, errFoo, b.Flush())
+
+	// So do writes after Close.
+	require.NoError(t, b.Close())
+	assert.Equal(t, errFoo, b.HSet("h", "f", "x"))
+}
+
+func TestWriteBehindClose(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	b := NewBackend(underlying, Options{
+		FlushInterval: time.Hour,
+	})
+
+	require.NoError(t, b.Set("a", "x"))
+	require.NoError(t, b.Close())
+
+	v, err := underlying.Get("a")
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, "x", *v)
+
+	// Writes after Close are applied directly.
+	require.NoError(t, b.Set("b", "y"))
+	assert.Equal(t, 0, b.Buffered())
+	v, err = underlying.Get("b")
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, "y", *v)
+
+	require.NoError(t, b.Close())
+}
@@ -0,0 +1,15 @@
+package keyvaluestorewritebehind
+
+import "github.com/ccbrown/keyvaluestore"
+
+type batchOperation struct {
+	keyvaluestore.BatchOperation
+	backend *Backend
+}
+
+func (op *batchOperation) Exec() error {
+	if err := op.backend.Flush(); err != nil {
+		return err
+	}
+	return op.BatchOperation.Exec()
+}
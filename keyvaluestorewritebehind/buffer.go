@@ -0,0 +1,256 @@
+package keyvaluestorewritebehind
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+const (
+	// DefaultFlushInterval is the flush interval used by backends that don't specify one.
+	DefaultFlushInterval = time.Second
+
+	// DefaultMaxBatchSize is the batch size used by backends that don't specify one.
+	DefaultMaxBatchSize = 100
+
+	// DefaultMaxBufferedWrites is the buffer limit used by backends that don't specify one.
+	DefaultMaxBufferedWrites = 10000
+)
+
+// Options configure a write-behind backend.
+type Options struct {
+	// FlushInterval is how often buffered writes are flushed in the background. If zero,
+	// DefaultFlushInterval is used.
+	FlushInterval time.Duration
+
+	// MaxBatchSize is the maximum number of writes sent to the underlying backend in one batch.
+	// Once this many writes are buffered, a background flush is started without waiting for the
+	// interval. If zero, DefaultMaxBatchSize is used.
+	MaxBatchSize int
+
+	// MaxBufferedWrites bounds the buffer's memory. Once this many writes are buffered, further
+	// writes flush synchronously until the buffer drains. If zero, DefaultMaxBufferedWrites is used.
+	MaxBufferedWrites int
+
+	// OnError is invoked with errors from background flushes. The writes in a failed batch are
+	// dropped. If nil, such errors are ignored.
+	OnError func(error)
+}
+
+type writeKind int
+
+const (
+	writeKindSet writeKind = iota
+	writeKindSAdd
+	writeKindZAdd
+	writeKindHSet
+)
+
+type bufferedWrite struct {
+	kind   writeKind
+	key    string
+	field  string
+	value  interface{}
+	values []interface{}
+	fields []keyvaluestore.KeyValue
+	score  float64
+}
+
+type writeBuffer struct {
+	backend keyvaluestore.Backend
+	options Options
+
+	mutex  sync.Mutex
+	writes []*bufferedWrite
+	closed bool
+
+	// flushMutex serializes flushes so that writes are applied in the order they were buffered.
+	flushMutex sync.Mutex
+
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newWriteBuffer(backend keyvaluestore.Backend, options Options) *writeBuffer {
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = DefaultFlushInterval
+	}
+	if options.MaxBatchSize <= 0 {
+		options.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if options.MaxBufferedWrites <= 0 {
+		options.MaxBufferedWrites = DefaultMaxBufferedWrites
+	}
+	b := &writeBuffer{
+		backend: backend,
+		options: options,
+		full:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *writeBuffer) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.options.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		case <-b.full:
+		}
+		if err := b.flush(); err != nil && b.options.OnError != nil {
+			b.options.OnError(err)
+		}
+	}
+}
+
+// add buffers the write. It returns false if the buffer is closed, in which case the write should
+// be applied directly.
+func (b *writeBuffer) add(w *bufferedWrite) (bool, error) {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return false, nil
+	}
+	b.writes = append(b.writes, w)
+	n := len(b.writes)
+	b.mutex.Unlock()
+
+	if n >= b.options.MaxBufferedWrites {
+		return true, b.flush()
+	} else if n >= b.options.MaxBatchSize {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	return true, nil
+}
+
+func (b *writeBuffer) len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.writes)
+}
+
+// flush applies all writes buffered before it was invoked. If any batch fails, the remaining
+// batches are still attempted and the first error is returned.
+func (b *writeBuffer) flush() error {
+	b.flushMutex.Lock()
+	defer b.flushMutex.Unlock()
+
+	b.mutex.Lock()
+	writes := b.writes
+	b.writes = nil
+	b.mutex.Unlock()
+
+	var firstErr error
+	for len(writes) > 0 {
+		n := len(writes)
+		if n > b.options.MaxBatchSize {
+			n = b.options.MaxBatchSize
+		}
+		if err := b.apply(writes[:n]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		writes = writes[n:]
+	}
+	return firstErr
+}
+
+// apply applies the writes as a single batch. Writes that batches don't support are applied
+// directly, in order.
+func (b *writeBuffer) apply(writes []*bufferedWrite) error {
+	var firstErr error
+	var batch keyvaluestore.BatchOperation
+	var results []keyvaluestore.ErrorResult
+	exec := func() {
+		if batch == nil {
+			return
+		}
+		if err := batch.Exec(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		for _, r := range results {
+			if err := r.Result(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		batch, results = nil, nil
+	}
+	for _, w := range writes {
+		if w.kind == writeKindHSet {
+			exec()
+			if err := b.backend.HSet(w.key, w.field, w.value, w.fields...); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if batch == nil {
+			batch = b.backend.Batch()
+		}
+		switch w.kind {
+		case writeKindSet:
+			results = append(results, batch.Set(w.key, w.value))
+		case writeKindSAdd:
+			results = append(results, batch.SAdd(w.key, w.value, w.values...))
+		case writeKindZAdd:
+			results = append(results, batch.ZAdd(w.key, w.value, w.score))
+		}
+	}
+	exec()
+	return firstErr
+}
+
+// close stops the background goroutine and flushes any remaining writes. Subsequent writes are
+// applied directly.
+func (b *writeBuffer) close() error {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mutex.Unlock()
+
+	close(b.stop)
+	<-b.done
+	return b.flush()
+}
+
+// copyValue copies byte slices so that callers may reuse them once the write is acknowledged.
+func copyValue(v interface{}) interface{} {
+	if buf, ok := v.([]byte); ok {
+		return append([]byte(nil), buf...)
+	}
+	return v
+}
+
+func copyValues(vs []interface{}) []interface{} {
+	if len(vs) == 0 {
+		return nil
+	}
+	ret := make([]interface{}, len(vs))
+	for i, v := range vs {
+		ret[i] = copyValue(v)
+	}
+	return ret
+}
+
+func copyFields(fields []keyvaluestore.KeyValue) []keyvaluestore.KeyValue {
+	if len(fields) == 0 {
+		return nil
+	}
+	ret := make([]keyvaluestore.KeyValue, len(fields))
+	for i, f := range fields {
+		ret[i] = keyvaluestore.KeyValue{Key: f.Key, Value: copyValue(f.Value)}
+	}
+	return ret
+}
@@ -0,0 +1,47 @@
+package keyvaluestore
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger receives warnings about conditions that don't cause operations to fail, but that may
+// indicate problems, such as operations that are repeatedly retried due to contention.
+//
+// Warnings consist of a message followed by alternating keys and values. The signature matches
+// that of log/slog, so a *slog.Logger can be used directly.
+type Logger interface {
+	Warn(msg string, args ...interface{})
+}
+
+type standardLogger struct {
+	logger *log.Logger
+}
+
+// StandardLogger adapts a logger from the standard log package. Warnings are written on a single
+// line with their keys and values formatted as "key=value". If l is nil, the standard logger is
+// used.
+func StandardLogger(l *log.Logger) Logger {
+	return &standardLogger{
+		logger: l,
+	}
+}
+
+func (l *standardLogger) Warn(msg string, args ...interface{}) {
+	var sb strings.Builder
+	sb.WriteString("WARN ")
+	sb.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&sb, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&sb, " %v", args[i])
+		}
+	}
+	if l.logger != nil {
+		l.logger.Print(sb.String())
+	} else {
+		log.Print(sb.String())
+	}
+}
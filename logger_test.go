@@ -0,0 +1,18 @@
+package keyvaluestore
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStandardLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := StandardLogger(log.New(&buf, "", 0))
+
+	logger.Warn("something happened", "key", "foo", "retries", 3)
+	logger.Warn("odd args", "key")
+	assert.Equal(t, "WARN something happened key=foo retries=3\nWARN odd args key\n", buf.String())
+}
@@ -9,7 +9,8 @@ import (
 type AtomicWriteOperation struct {
 	Backend *Backend
 
-	operations []*atomicWriteOperation
+	operations       []*atomicWriteOperation
+	idempotencyToken string
 }
 
 type atomicWriteOperation struct {
@@ -89,12 +90,26 @@ func (op *AtomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteRe
 	})
 }
 
+type nincrByResult struct {
+	*atomicWriteOperation
+	value    int64
+	hasValue bool
+}
+
+func (r *nincrByResult) Value() (int64, bool) {
+	return r.value, r.hasValue
+}
+
 func (op *AtomicWriteOperation) NIncrBy(key string, n int64) keyvaluestore.AtomicWriteResult {
-	return op.write(&atomicWriteOperation{
+	result := &nincrByResult{}
+	result.atomicWriteOperation = &atomicWriteOperation{
 		write: func() {
-			op.Backend.nincrBy(key, n)
+			v, err := op.Backend.nincrBy(key, n)
+			result.value, result.hasValue = v, err == nil
 		},
-	})
+	}
+	op.write(result.atomicWriteOperation)
+	return result
 }
 
 func (op *AtomicWriteOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
@@ -112,6 +127,10 @@ func (op *AtomicWriteOperation) ZHAdd(key, field string, member interface{}, sco
 	})
 }
 
+func (op *AtomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	return keyvaluestore.ZHMAddEach(op, key, entries)
+}
+
 func (op *AtomicWriteOperation) ZAddNX(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
 	s := *keyvaluestore.ToString(member)
 	return op.write(&atomicWriteOperation{
@@ -126,6 +145,20 @@ func (op *AtomicWriteOperation) ZAddNX(key string, member interface{}, score flo
 	})
 }
 
+func (op *AtomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.write(&atomicWriteOperation{
+		condition: func() bool {
+			v := op.Backend.zhget(key, field)
+			return v != nil && *v == *keyvaluestore.ToString(oldMember)
+		},
+		write: func() {
+			op.Backend.zhadd(key, field, member, func(previousScore *float64) (float64, error) {
+				return score, nil
+			})
+		},
+	})
+}
+
 func (op *AtomicWriteOperation) ZRem(key string, member interface{}) keyvaluestore.AtomicWriteResult {
 	s := *keyvaluestore.ToString(member)
 	return op.ZHRem(key, s)
@@ -139,6 +172,18 @@ func (op *AtomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWri
 	})
 }
 
+func (op *AtomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	return op.write(&atomicWriteOperation{
+		condition: func() bool {
+			v := op.Backend.zhget(key, field)
+			return v != nil && *v == *keyvaluestore.ToString(member)
+		},
+		write: func() {
+			op.Backend.zhrem(key, field)
+		},
+	})
+}
+
 func (op *AtomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
 	return op.write(&atomicWriteOperation{
 		write: func() {
@@ -182,14 +227,49 @@ func (op *AtomicWriteOperation) HDel(key, field string, fields ...string) keyval
 	})
 }
 
-func (op *AtomicWriteOperation) Exec() (bool, error) {
+func (op *AtomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.idempotencyToken = token
+	return op
+}
+
+func (op *AtomicWriteOperation) Validate() error {
 	if len(op.operations) > keyvaluestore.MaxAtomicWriteOperations {
-		return false, fmt.Errorf("max operation count exceeded")
+		return fmt.Errorf("max operation count exceeded")
+	} else if len(op.idempotencyToken) > keyvaluestore.MaxIdempotencyTokenLength {
+		return fmt.Errorf("idempotency token too long")
+	}
+	return nil
+}
+
+func (op *AtomicWriteOperation) Exec() (bool, error) {
+	if err := op.Validate(); err != nil {
+		return false, err
+	}
+
+	if err := op.Backend.simulate("AtomicWrite"); err != nil {
+		return false, err
 	}
 
 	op.Backend.mutex.Lock()
 	defer op.Backend.mutex.Unlock()
 
+	now := op.Backend.Now()
+	if op.idempotencyToken != "" {
+		if expiration, ok := op.Backend.idempotencyTokens[op.idempotencyToken]; ok && now.Before(expiration) {
+			for _, wOp := range op.operations {
+				wOp.conditionPassed = true
+			}
+			return true, nil
+		}
+	}
+
+	if faults := op.Backend.Faults; faults != nil && faults.takeAtomicWriteConditionalFailure() {
+		for _, wOp := range op.operations {
+			wOp.conditionPassed = wOp.condition == nil
+		}
+		return false, nil
+	}
+
 	allPassed := true
 
 	for _, wOp := range op.operations {
@@ -211,6 +291,11 @@ func (op *AtomicWriteOperation) Exec() (bool, error) {
 	for _, wOp := range op.operations {
 		wOp.write()
 	}
+	op.Backend.evict()
+
+	if op.idempotencyToken != "" {
+		op.Backend.rememberIdempotencyToken(op.idempotencyToken, now)
+	}
 
 	return true, nil
 }
@@ -1,24 +1,69 @@
 package memorystore
 
 import (
-	"encoding/binary"
-	"math"
+	"fmt"
 	"strconv"
 	"sync"
-
-	"github.com/ccbrown/go-immutable"
+	"time"
 
 	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/internal/sortkey"
 )
 
 type Backend struct {
-	m     map[string]interface{}
-	mutex sync.Mutex
+	// If non-zero, MaxMemory is the approximate number of bytes the backend may use. Once it's
+	// exceeded, keys are evicted according to EvictionPolicy. This must be set before the backend
+	// is used.
+	MaxMemory int
+
+	// EvictionPolicy determines which keys are evicted when MaxMemory is exceeded.
+	EvictionPolicy EvictionPolicy
+
+	// If non-nil, Faults is used to simulate errors and latency.
+	Faults *Faults
+
+	// If non-nil, Logger is warned when keys are evicted due to MaxMemory. It's invoked while the
+	// backend is locked, so it must not use the backend.
+	Logger keyvaluestore.Logger
+
+	// If non-nil, Clock is used instead of the wall clock for expirations, which allows them to be
+	// driven by simulations. Time added via FastForward is added to the clock's time.
+	Clock keyvaluestore.Clock
+
+	m           map[string]interface{}
+	expirations map[string]time.Time
+	mutex       sync.RWMutex
+
+	// timeOffset is the number of nanoseconds the backend's clock has been fast-forwarded. It's
+	// accessed atomically.
+	timeOffset int64
+
+	// These are only maintained if MaxMemory is non-zero.
+	sizes      map[string]int
+	usedMemory int
+	accesses   map[string]*keyAccesses
+	clock      int64
+
+	// idempotencyTokens maps the tokens of successful atomic writes to their expirations.
+	idempotencyTokens map[string]time.Time
+
+	subscriptions      map[string]map[*subscription]struct{}
+	subscriptionsMutex sync.RWMutex
+
+	sweepers      map[chan struct{}]struct{}
+	sweepersMutex sync.Mutex
+
+	keyWatches    map[*keyWatch]struct{}
+	prefixWatches map[*prefixWatch]struct{}
+	watchesMutex  sync.RWMutex
 }
 
 func NewBackend() *Backend {
 	return &Backend{
-		m: make(map[string]interface{}),
+		m:           make(map[string]interface{}),
+		expirations: make(map[string]time.Time),
+		sizes:       make(map[string]int),
+		accesses:    make(map[string]*keyAccesses),
 	}
 }
 
@@ -27,17 +72,75 @@ func (b *Backend) Reinitialize() {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 	b.m = make(map[string]interface{})
+	b.expirations = make(map[string]time.Time)
+	b.sizes = make(map[string]int)
+	b.usedMemory = 0
+	b.accesses = make(map[string]*keyAccesses)
+	b.idempotencyTokens = nil
+}
+
+// rememberIdempotencyToken records a successful atomic write's token and forgets any that have
+// expired. The caller must hold the write lock.
+func (b *Backend) rememberIdempotencyToken(token string, now time.Time) {
+	if b.idempotencyTokens == nil {
+		b.idempotencyTokens = map[string]time.Time{}
+	}
+	for t, expiration := range b.idempotencyTokens {
+		if !now.Before(expiration) {
+			delete(b.idempotencyTokens, t)
+		}
+	}
+	b.idempotencyTokens[token] = now.Add(keyvaluestore.IdempotencyWindow)
+}
+
+// lookup returns the value at the given key or nil if there is none. All reads should go through
+// lookup rather than accessing b.m directly so that expired keys are never visible. It only needs
+// the read lock.
+func (b *Backend) lookup(key string) interface{} {
+	if b.isExpired(key) {
+		return nil
+	}
+	b.touch(key)
+	return b.m[key]
+}
+
+func (b *Backend) isExpired(key string) bool {
+	deadline, ok := b.expirations[key]
+	return ok && !b.Now().Before(deadline)
+}
+
+// removeIfExpired deletes the key if it has expired. Writes that modify values in place must call
+// this first so that they don't modify an expired value. It requires the write lock.
+func (b *Backend) removeIfExpired(key string) {
+	if b.isExpired(key) {
+		b.remove(key)
+	}
+}
+
+// remove removes the key and all of its metadata. It requires the write lock.
+func (b *Backend) remove(key string) {
+	if _, ok := b.m[key]; ok {
+		b.changed(key)
+	}
+	delete(b.m, key)
+	delete(b.expirations, key)
+	b.setSize(key, 0)
+	delete(b.sizes, key)
+	delete(b.accesses, key)
 }
 
 func (b *Backend) Delete(key string) (bool, error) {
+	if err := b.simulate("Delete"); err != nil {
+		return false, err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 	return b.delete(key), nil
 }
 
 func (b *Backend) delete(key string) bool {
-	_, ok := b.m[key]
-	delete(b.m, key)
+	ok := b.lookup(key) != nil
+	b.remove(key)
 	return ok
 }
 
@@ -54,148 +157,237 @@ func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
 }
 
 func (b *Backend) Get(key string) (*string, error) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	if err := b.simulate("Get"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
 	return b.get(key), nil
 }
 
+var _ keyvaluestore.MultiExister = &Backend{}
+
+func (b *Backend) ExistsMulti(keys ...string) (map[string]bool, error) {
+	if err := b.simulate("ExistsMulti"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	ret := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		ret[key] = b.lookup(key) != nil
+	}
+	return ret, nil
+}
+
 func (b *Backend) get(key string) *string {
-	if v, ok := b.m[key]; ok {
+	if v := b.lookup(key); v != nil {
 		return keyvaluestore.ToString(v)
 	}
 	return nil
 }
 
 func (b *Backend) Set(key string, value interface{}) error {
+	if err := b.simulate("Set"); err != nil {
+		return err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 	b.set(key, value)
+	b.evict()
 	return nil
 }
 
 func (b *Backend) set(key string, value interface{}) {
 	b.m[key] = value
+	b.changed(key)
+	delete(b.expirations, key)
+	if b.MaxMemory > 0 {
+		b.setSize(key, stringSize(key, *keyvaluestore.ToString(value)))
+	}
 }
 
 func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
+	if err := b.simulate("NIncrBy"); err != nil {
+		return 0, err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
+	defer b.evict()
 	return b.nincrBy(key, n)
 }
 
 func (b *Backend) nincrBy(key string, n int64) (int64, error) {
-	if v, ok := b.m[key]; ok {
+	b.removeIfExpired(key)
+	if v := b.lookup(key); v != nil {
+		switch v.(type) {
+		case map[string]struct{}, map[string]string, *sortedSet:
+			return 0, &keyvaluestore.Error{
+				Kind: keyvaluestore.ErrWrongType,
+				Err:  fmt.Errorf("key %v does not hold a string", key),
+			}
+		}
 		if s := keyvaluestore.ToString(v); s != nil {
 			i, err := strconv.ParseInt(*s, 10, 64)
 			if err != nil {
-				return 0, err
+				return 0, &keyvaluestore.Error{
+					Kind: keyvaluestore.ErrWrongType,
+					Err:  err,
+				}
 			}
 			b.m[key] = strconv.FormatInt(i+n, 10)
+			b.changed(key)
+			b.setSize(key, stringSize(key, b.m[key].(string)))
 			return i + n, nil
 		}
 	}
 	b.m[key] = strconv.FormatInt(n, 10)
+	b.changed(key)
+	b.setSize(key, stringSize(key, b.m[key].(string)))
 	return n, nil
 }
 
 func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
+	if err := b.simulate("SAdd"); err != nil {
+		return err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 	b.sadd(key, member, members...)
+	b.evict()
 	return nil
 }
 
 func (b *Backend) sadd(key string, member interface{}, members ...interface{}) {
-	s, ok := b.m[key].(map[string]struct{})
+	b.removeIfExpired(key)
+	s, ok := b.lookup(key).(map[string]struct{})
 	if !ok {
 		s = make(map[string]struct{})
+		b.setSize(key, keySize(key))
 	}
-	s[*keyvaluestore.ToString(member)] = struct{}{}
-	for _, member := range members {
-		s[*keyvaluestore.ToString(member)] = struct{}{}
+	for _, member := range append([]interface{}{member}, members...) {
+		m := *keyvaluestore.ToString(member)
+		if _, ok := s[m]; !ok {
+			s[m] = struct{}{}
+			b.addSize(key, setMemberSize(m))
+		}
 	}
 	b.m[key] = s
+	b.changed(key)
 }
 
 func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
+	if err := b.simulate("SRem"); err != nil {
+		return err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 	return b.srem(key, member, members...)
 }
 
 func (b *Backend) srem(key string, member interface{}, members ...interface{}) error {
-	s, ok := b.m[key].(map[string]struct{})
+	s, ok := b.lookup(key).(map[string]struct{})
 	if !ok {
 		return nil
 	}
-	delete(s, *keyvaluestore.ToString(member))
-	for _, member := range members {
-		delete(s, *keyvaluestore.ToString(member))
+	for _, member := range append([]interface{}{member}, members...) {
+		m := *keyvaluestore.ToString(member)
+		if _, ok := s[m]; ok {
+			delete(s, m)
+			b.addSize(key, -setMemberSize(m))
+			b.changed(key)
+		}
 	}
 	if len(s) == 0 {
-		delete(b.m, key)
+		b.delete(key)
 	}
 	return nil
 }
 
 func (b *Backend) SMembers(key string) ([]string, error) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	if err := b.simulate("SMembers"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.smembers(key), nil
+}
 
-	s, ok := b.m[key].(map[string]struct{})
+func (b *Backend) smembers(key string) []string {
+	s, ok := b.lookup(key).(map[string]struct{})
 	if !ok {
-		return nil, nil
+		return nil
 	}
 	var results []string
 	for k := range s {
 		results = append(results, k)
 	}
-	return results, nil
+	return results
 }
 
 func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
+	if err := b.simulate("HSet"); err != nil {
+		return err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
+	defer b.evict()
 	return b.hset(key, field, value, fields...)
 }
 
 func (b *Backend) hset(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
-	h, ok := b.m[key].(map[string]string)
+	b.removeIfExpired(key)
+	h, ok := b.lookup(key).(map[string]string)
 	if !ok {
 		h = make(map[string]string)
+		b.setSize(key, keySize(key))
 	}
-	h[field] = *keyvaluestore.ToString(value)
-	for _, field := range fields {
-		h[field.Key] = *keyvaluestore.ToString(field.Value)
+	for _, field := range append([]keyvaluestore.KeyValue{{Key: field, Value: value}}, fields...) {
+		if prev, ok := h[field.Key]; ok {
+			b.addSize(key, -hashFieldSize(field.Key, prev))
+		}
+		v := *keyvaluestore.ToString(field.Value)
+		h[field.Key] = v
+		b.addSize(key, hashFieldSize(field.Key, v))
 	}
 	b.m[key] = h
+	b.changed(key)
 	return nil
 }
 
 func (b *Backend) HDel(key string, field string, fields ...string) error {
+	if err := b.simulate("HDel"); err != nil {
+		return err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 	return b.hdel(key, field, fields...)
 }
 
 func (b *Backend) hdel(key string, field string, fields ...string) error {
-	h, ok := b.m[key].(map[string]string)
+	h, ok := b.lookup(key).(map[string]string)
 	if !ok {
 		return nil
 	}
-	delete(h, field)
-	for _, field := range fields {
-		delete(h, field)
+	for _, field := range append([]string{field}, fields...) {
+		if prev, ok := h[field]; ok {
+			delete(h, field)
+			b.addSize(key, -hashFieldSize(field, prev))
+			b.changed(key)
+		}
 	}
 	if len(h) == 0 {
-		delete(b.m, key)
+		b.delete(key)
 	}
 	return nil
 }
 
 func (b *Backend) HGet(key, field string) (*string, error) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	if err := b.simulate("HGet"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
 	return b.hget(key, field), nil
 }
 
@@ -207,13 +399,25 @@ func (b *Backend) hget(key, field string) *string {
 }
 
 func (b *Backend) HGetAll(key string) (map[string]string, error) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
-	return b.hgetall(key), nil
+	if err := b.simulate("HGetAll"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	h := b.hgetall(key)
+	if h == nil {
+		return nil, nil
+	}
+	// The hash is modified in place by writes, so we can't return it directly.
+	ret := make(map[string]string, len(h))
+	for k, v := range h {
+		ret[k] = v
+	}
+	return ret, nil
 }
 
 func (b *Backend) hgetall(key string) map[string]string {
-	h, ok := b.m[key].(map[string]string)
+	h, ok := b.lookup(key).(map[string]string)
 	if !ok {
 		return nil
 	}
@@ -221,101 +425,94 @@ func (b *Backend) hgetall(key string) map[string]string {
 }
 
 func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
+	if err := b.simulate("SetNX"); err != nil {
+		return false, err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
-	if _, ok := b.m[key]; ok {
+	if b.lookup(key) != nil {
 		return false, nil
 	}
 
-	b.m[key] = value
+	b.set(key, value)
+	b.evict()
 	return true, nil
 }
 
 func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
+	if err := b.simulate("SetXX"); err != nil {
+		return false, err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
-	if _, ok := b.m[key]; !ok {
+	if b.lookup(key) == nil {
 		return false, nil
 	}
 
-	b.m[key] = value
+	b.set(key, value)
+	b.evict()
 	return true, nil
 }
 
 func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	if err := b.simulate("SetEQ"); err != nil {
+		return false, err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
-	if v, ok := b.m[key]; !ok || *keyvaluestore.ToString(v) != *keyvaluestore.ToString(oldValue) {
+	if v := b.lookup(key); v == nil || *keyvaluestore.ToString(v) != *keyvaluestore.ToString(oldValue) {
 		return false, nil
 	}
 
-	b.m[key] = value
+	b.set(key, value)
+	b.evict()
 	return true, nil
 }
 
-const floatSortKeyNumBytes = 8
-
-func floatSortKey(f float64) string {
-	n := math.Float64bits(f)
-	if (n & (1 << 63)) != 0 {
-		n ^= 0xffffffffffffffff
-	} else {
-		n ^= 0x8000000000000000
-	}
-	buf := make([]byte, floatSortKeyNumBytes)
-	binary.BigEndian.PutUint64(buf, n)
-	return string(buf)
-}
-
-func sortKeyFloat(key string) float64 {
-	if len(key) < floatSortKeyNumBytes {
-		return 0
-	}
-	n := binary.BigEndian.Uint64([]byte(key))
-	if (n & (1 << 63)) == 0 {
-		n ^= 0xffffffffffffffff
-	} else {
-		n ^= 0x8000000000000000
+// Update implements keyvaluestore.Updater. f is invoked while the backend is locked, so it must not
+// use the backend.
+func (b *Backend) Update(key string, f func(prev *string) (*string, error)) error {
+	if err := b.simulate("Update"); err != nil {
+		return err
 	}
-	return math.Float64frombits(n)
-}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
 
-func floatSortKeyAfter(f float64) string {
-	n := math.Float64bits(f)
-	if (n & (1 << 63)) != 0 {
-		n ^= 0xffffffffffffffff
-	} else {
-		n ^= 0x8000000000000000
+	next, err := f(b.get(key))
+	if err != nil || next == nil {
+		return err
 	}
-	n++
-	if n == 0 {
-		return ""
-	}
-	buf := make([]byte, 8)
-	binary.BigEndian.PutUint64(buf, n)
-	return string(buf)
+	b.set(key, *next)
+	b.evict()
+	return nil
 }
 
 type sortedSet struct {
 	scoresByMember map[string]float64
-	m              *immutable.OrderedMap
+	m              *skiplist
 }
 
 func (b *Backend) zhadd(key, field string, member interface{}, f func(previousScore *float64) (float64, error)) (float64, error) {
-	s, _ := b.m[key].(*sortedSet)
+	b.removeIfExpired(key)
+	s, _ := b.lookup(key).(*sortedSet)
 	if s == nil {
 		s = &sortedSet{
 			scoresByMember: make(map[string]float64),
+			m:              newSkiplist(),
 		}
+		b.setSize(key, keySize(key))
 	}
 
 	var previousScore *float64
 
 	if prev, ok := s.scoresByMember[field]; ok {
-		s.m = s.m.Delete(floatSortKey(prev) + field)
+		if v, ok := s.m.Get(sortkey.Float(prev) + field); ok {
+			b.addSize(key, -sortedSetMemberSize(field, v))
+		}
+		s.m.Delete(sortkey.Float(prev) + field)
 		previousScore = &prev
 	}
 
@@ -325,11 +522,13 @@ func (b *Backend) zhadd(key, field string, member interface{}, f func(previousSc
 		return 0, err
 	} else {
 		v := *keyvaluestore.ToString(member)
-		s.m = s.m.Set(floatSortKey(newScore)+field, v)
+		s.m.Set(sortkey.Float(newScore)+field, v)
 		s.scoresByMember[field] = newScore
+		b.addSize(key, sortedSetMemberSize(field, v))
 	}
 
 	b.m[key] = s
+	b.changed(key)
 	return newScore, nil
 }
 
@@ -339,8 +538,12 @@ func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
 }
 
 func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) error {
+	if err := b.simulate("ZHAdd"); err != nil {
+		return err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
+	defer b.evict()
 
 	_, err := b.zhadd(key, field, member, func(previousScore *float64) (float64, error) {
 		return score, nil
@@ -348,11 +551,36 @@ func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) er
 	return err
 }
 
-func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	if err := b.simulate("ZHMAdd"); err != nil {
+		return err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
+	defer b.evict()
+	return b.zhmadd(key, entries)
+}
+
+func (b *Backend) zhmadd(key string, entries []keyvaluestore.ZHEntry) error {
+	for _, entry := range entries {
+		score := entry.Score
+		if _, err := b.zhadd(key, entry.Field, entry.Member, func(previousScore *float64) (float64, error) {
+			return score, nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
+	if err := b.simulate("ZScore"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
 
-	if s, _ := b.m[key].(*sortedSet); s != nil {
+	if s, _ := b.lookup(key).(*sortedSet); s != nil {
 		v := *keyvaluestore.ToString(member)
 		if prev, ok := s.scoresByMember[v]; ok {
 			return &prev, nil
@@ -363,8 +591,12 @@ func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
 }
 
 func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
+	if err := b.simulate("ZIncrBy"); err != nil {
+		return 0, err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
+	defer b.evict()
 
 	s := *keyvaluestore.ToString(member)
 	return b.zhadd(key, s, s, func(previousScore *float64) (float64, error) {
@@ -377,7 +609,7 @@ func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, e
 }
 
 func (b *Backend) zscore(key string, member interface{}) *float64 {
-	s, _ := b.m[key].(*sortedSet)
+	s, _ := b.lookup(key).(*sortedSet)
 	if s != nil {
 		v := *keyvaluestore.ToString(member)
 		if score, ok := s.scoresByMember[v]; ok {
@@ -387,32 +619,68 @@ func (b *Backend) zscore(key string, member interface{}) *float64 {
 	return nil
 }
 
+// zhget returns the member of the sorted hash with the given field.
+func (b *Backend) zhget(key, field string) *string {
+	s, _ := b.lookup(key).(*sortedSet)
+	if s != nil {
+		if score, ok := s.scoresByMember[field]; ok {
+			if v, ok := s.m.Get(sortkey.Float(score) + field); ok {
+				return &v
+			}
+		}
+	}
+	return nil
+}
+
 func (b *Backend) ZRem(key string, member interface{}) error {
 	s := *keyvaluestore.ToString(member)
 	return b.ZHRem(key, s)
 }
 
 func (b *Backend) ZHRem(key, field string) error {
+	if err := b.simulate("ZHRem"); err != nil {
+		return err
+	}
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 	return b.zhrem(key, field)
 }
 
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	if err := b.simulate("ZHRemEQ"); err != nil {
+		return false, err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if v := b.zhget(key, field); v == nil || *v != *keyvaluestore.ToString(member) {
+		return false, nil
+	}
+	return true, b.zhrem(key, field)
+}
+
 func (b *Backend) zhrem(key, field string) error {
-	s, _ := b.m[key].(*sortedSet)
+	s, _ := b.lookup(key).(*sortedSet)
 	if s != nil {
 		if previous, ok := s.scoresByMember[field]; ok {
-			s.m = s.m.Delete(floatSortKey(previous) + field)
+			if v, ok := s.m.Get(sortkey.Float(previous) + field); ok {
+				b.addSize(key, -sortedSetMemberSize(field, v))
+			}
+			s.m.Delete(sortkey.Float(previous) + field)
 			delete(s.scoresByMember, field)
 			b.m[key] = s
+			b.changed(key)
 		}
 	}
 	return nil
 }
 
 func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	if err := b.simulate("ZRangeByScore"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
 
 	if members, err := b.zRangeByScoreWithScores(key, min, max, limit); err != nil {
 		return nil, err
@@ -426,8 +694,11 @@ func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]str
 }
 
 func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	if err := b.simulate("ZRangeByScoreWithScores"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
 
 	return b.zRangeByScoreWithScores(key, min, max, limit)
 }
@@ -437,15 +708,25 @@ func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit i
 }
 
 func (b *Backend) zRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
-	s, _ := b.m[key].(*sortedSet)
+	var results keyvaluestore.ScoredMembers
+	b.zRangeByScore(key, min, max, limit, func(n *skiplistNode) {
+		results = append(results, &keyvaluestore.ScoredMember{
+			Score: sortkey.ParseFloat(n.key),
+			Value: n.value,
+		})
+	})
+	return results, nil
+}
+
+// zRangeByScore invokes f for up to limit nodes with scores between min and max, in ascending order.
+func (b *Backend) zRangeByScore(key string, min, max float64, limit int, f func(n *skiplistNode)) {
+	s, _ := b.lookup(key).(*sortedSet)
 	if s == nil {
-		return nil, nil
+		return
 	}
 
-	var results []*keyvaluestore.ScoredMember
-
-	minSortKey := floatSortKey(min)
-	maxSortKeyPrefix := floatSortKey(max)
+	minSortKey := sortkey.Float(min)
+	maxSortKeyPrefix := sortkey.Float(max)
 
 	next := s.m.MaxBefore(minSortKey)
 	if next == nil {
@@ -454,20 +735,18 @@ func (b *Backend) zRangeByScoreWithScores(key string, min, max float64, limit in
 		next = next.Next()
 	}
 
-	for (limit == 0 || len(results) < limit) && next != nil && next.Key().(string)[:len(maxSortKeyPrefix)] <= maxSortKeyPrefix {
-		results = append(results, &keyvaluestore.ScoredMember{
-			Score: sortKeyFloat(next.Key().(string)),
-			Value: next.Value().(string),
-		})
+	for n := 0; (limit == 0 || n < limit) && next != nil && next.key[:len(maxSortKeyPrefix)] <= maxSortKeyPrefix; n++ {
+		f(next)
 		next = next.Next()
 	}
-
-	return results, nil
 }
 
 func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	if err := b.simulate("ZRevRangeByScore"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
 
 	if members, err := b.zRevRangeByScoreWithScores(key, min, max, limit); err != nil {
 		return nil, err
@@ -481,8 +760,11 @@ func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]
 }
 
 func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	if err := b.simulate("ZRevRangeByScoreWithScores"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
 
 	return b.zRevRangeByScoreWithScores(key, min, max, limit)
 }
@@ -492,32 +774,38 @@ func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limi
 }
 
 func (b *Backend) zRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
-	s, _ := b.m[key].(*sortedSet)
+	var results keyvaluestore.ScoredMembers
+	b.zRevRangeByScore(key, min, max, limit, func(n *skiplistNode) {
+		results = append(results, &keyvaluestore.ScoredMember{
+			Score: sortkey.ParseFloat(n.key),
+			Value: n.value,
+		})
+	})
+	return results, nil
+}
+
+// zRevRangeByScore invokes f for up to limit nodes with scores between min and max, in descending
+// order.
+func (b *Backend) zRevRangeByScore(key string, min, max float64, limit int, f func(n *skiplistNode)) {
+	s, _ := b.lookup(key).(*sortedSet)
 	if s == nil {
-		return nil, nil
+		return
 	}
 
-	var results []*keyvaluestore.ScoredMember
-
-	minSortKey := floatSortKey(min)
-	sortKeyAfterMax := floatSortKeyAfter(max)
+	minSortKey := sortkey.Float(min)
+	sortKeyAfterMax := sortkey.FloatAfter(max)
 
-	var next *immutable.OrderedMapElement
+	var next *skiplistNode
 	if sortKeyAfterMax == "" {
 		next = s.m.Max()
 	} else {
 		next = s.m.MaxBefore(sortKeyAfterMax)
 	}
 
-	for (limit == 0 || len(results) < limit) && next != nil && next.Key().(string) >= minSortKey {
-		results = append(results, &keyvaluestore.ScoredMember{
-			Score: sortKeyFloat(next.Key().(string)),
-			Value: next.Value().(string),
-		})
+	for n := 0; (limit == 0 || n < limit) && next != nil && next.key >= minSortKey; n++ {
+		f(next)
 		next = next.Prev()
 	}
-
-	return results, nil
 }
 
 func (b *Backend) ZCount(key string, min, max float64) (int, error) {
@@ -531,44 +819,52 @@ func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
 }
 
 func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
-
-	s, _ := b.m[key].(*sortedSet)
-	if s == nil {
-		return nil, nil
+	if err := b.simulate("ZRangeByLex"); err != nil {
+		return nil, err
 	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
 
 	var results []string
+	b.zRangeByLex(key, min, max, limit, func(n *skiplistNode) {
+		results = append(results, n.value)
+	})
+	return results, nil
+}
 
-	sortKeyPrefix := string(floatSortKey(0.0))
+// zRangeByLex invokes f for up to limit nodes between min and max, in lexicographical order.
+func (b *Backend) zRangeByLex(key string, min, max string, limit int, f func(n *skiplistNode)) {
+	s, _ := b.lookup(key).(*sortedSet)
+	if s == nil {
+		return
+	}
+
+	sortKeyPrefix := string(sortkey.Float(0.0))
 
-	var next *immutable.OrderedMapElement
+	var next *skiplistNode
 	if min == "-" {
 		next = s.m.Min()
 	} else {
 		next = s.m.MinAfter(sortKeyPrefix + min[1:])
 		if min[0] == '[' {
 			if next == nil {
-				if x := s.m.Max(); x != nil && x.Key().(string)[len(sortKeyPrefix):] == min[1:] {
+				if x := s.m.Max(); x != nil && x.key[len(sortKeyPrefix):] == min[1:] {
 					next = x
 				}
-			} else if x := next.Prev(); x != nil && x.Key().(string)[len(sortKeyPrefix):] == min[1:] {
+			} else if x := next.Prev(); x != nil && x.key[len(sortKeyPrefix):] == min[1:] {
 				next = x
 			}
 		}
 	}
 
-	for (limit == 0 || len(results) < limit) && next != nil {
-		lex := next.Key().(string)[len(sortKeyPrefix):]
+	for n := 0; (limit == 0 || n < limit) && next != nil; n++ {
+		lex := next.key[len(sortKeyPrefix):]
 		if max != "+" && (lex > max[1:] || (max[0] == '(' && lex == max[1:])) {
 			break
 		}
-		results = append(results, next.Value().(string))
+		f(next)
 		next = next.Next()
 	}
-
-	return results, nil
 }
 
 func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
@@ -576,50 +872,249 @@ func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string
 }
 
 func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
-
-	s, _ := b.m[key].(*sortedSet)
-	if s == nil {
-		return nil, nil
+	if err := b.simulate("ZRevRangeByLex"); err != nil {
+		return nil, err
 	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
 
 	var results []string
+	b.zRevRangeByLex(key, min, max, limit, func(n *skiplistNode) {
+		results = append(results, n.value)
+	})
+	return results, nil
+}
 
-	sortKeyPrefix := string(floatSortKey(0.0))
+// zRevRangeByLex invokes f for up to limit nodes between min and max, in reverse lexicographical
+// order.
+func (b *Backend) zRevRangeByLex(key string, min, max string, limit int, f func(n *skiplistNode)) {
+	s, _ := b.lookup(key).(*sortedSet)
+	if s == nil {
+		return
+	}
 
-	var next *immutable.OrderedMapElement
+	sortKeyPrefix := string(sortkey.Float(0.0))
+
+	var next *skiplistNode
 	if max == "+" {
 		next = s.m.Max()
 	} else {
 		next = s.m.MaxBefore(sortKeyPrefix + max[1:])
 		if max[0] == '[' {
 			if next == nil {
-				if x := s.m.Min(); x != nil && x.Key().(string)[len(sortKeyPrefix):] == min[1:] {
+				if x := s.m.Min(); x != nil && x.key[len(sortKeyPrefix):] == min[1:] {
 					next = x
 				}
-			} else if x := next.Next(); x != nil && x.Key().(string)[len(sortKeyPrefix):] == max[1:] {
+			} else if x := next.Next(); x != nil && x.key[len(sortKeyPrefix):] == max[1:] {
 				next = x
 			}
 		}
 	}
 
-	for (limit == 0 || len(results) < limit) && next != nil {
-		lex := next.Key().(string)[len(sortKeyPrefix):]
+	for n := 0; (limit == 0 || n < limit) && next != nil; n++ {
+		lex := next.key[len(sortKeyPrefix):]
 		if min != "-" && (lex < min[1:] || (min[0] == '(' && lex == min[1:])) {
 			break
 		}
-		results = append(results, next.Value().(string))
+		f(next)
 		next = next.Prev()
 	}
-
-	return results, nil
 }
 
 func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
 	return b.ZRevRangeByLex(key, min, max, limit)
 }
 
+var _ keyvaluestore.SortedHashFieldRanger = &Backend{}
+
+func fieldScoredMember(n *skiplistNode) *keyvaluestore.FieldScoredMember {
+	return &keyvaluestore.FieldScoredMember{
+		Field: n.key[sortkey.FloatSize:],
+		Value: n.value,
+		Score: sortkey.ParseFloat(n.key),
+	}
+}
+
+func (b *Backend) ZHRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	if err := b.simulate("ZHRangeByScoreWithFields"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var results keyvaluestore.FieldScoredMembers
+	b.zRangeByScore(key, min, max, limit, func(n *skiplistNode) {
+		results = append(results, fieldScoredMember(n))
+	})
+	return results, nil
+}
+
+func (b *Backend) ZHRevRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	if err := b.simulate("ZHRevRangeByScoreWithFields"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var results keyvaluestore.FieldScoredMembers
+	b.zRevRangeByScore(key, min, max, limit, func(n *skiplistNode) {
+		results = append(results, fieldScoredMember(n))
+	})
+	return results, nil
+}
+
+func (b *Backend) ZHRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	if err := b.simulate("ZHRangeByLexWithFields"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var results keyvaluestore.FieldScoredMembers
+	b.zRangeByLex(key, min, max, limit, func(n *skiplistNode) {
+		results = append(results, fieldScoredMember(n))
+	})
+	return results, nil
+}
+
+func (b *Backend) ZHRevRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	if err := b.simulate("ZHRevRangeByLexWithFields"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var results keyvaluestore.FieldScoredMembers
+	b.zRevRangeByLex(key, min, max, limit, func(n *skiplistNode) {
+		results = append(results, fieldScoredMember(n))
+	})
+	return results, nil
+}
+
+var _ keyvaluestore.PageTokenRanger = &Backend{}
+
+func (b *Backend) ZRangeByScoreAfter(key string, after keyvaluestore.PageToken, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.simulate("ZRangeByScoreAfter"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var results keyvaluestore.ScoredMembers
+	b.zRangeAfter(key, after, max, limit, func(n *skiplistNode) {
+		results = append(results, &keyvaluestore.ScoredMember{
+			Score: sortkey.ParseFloat(n.key),
+			Value: n.value,
+		})
+	})
+	return results, nil
+}
+
+func (b *Backend) ZRevRangeByScoreAfter(key string, after keyvaluestore.PageToken, min float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if err := b.simulate("ZRevRangeByScoreAfter"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var results keyvaluestore.ScoredMembers
+	b.zRevRangeAfter(key, after, min, limit, func(n *skiplistNode) {
+		results = append(results, &keyvaluestore.ScoredMember{
+			Score: sortkey.ParseFloat(n.key),
+			Value: n.value,
+		})
+	})
+	return results, nil
+}
+
+func (b *Backend) ZHRangeByScoreWithFieldsAfter(key string, after keyvaluestore.PageToken, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	if err := b.simulate("ZHRangeByScoreWithFieldsAfter"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var results keyvaluestore.FieldScoredMembers
+	b.zRangeAfter(key, after, max, limit, func(n *skiplistNode) {
+		results = append(results, fieldScoredMember(n))
+	})
+	return results, nil
+}
+
+func (b *Backend) ZHRevRangeByScoreWithFieldsAfter(key string, after keyvaluestore.PageToken, min float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	if err := b.simulate("ZHRevRangeByScoreWithFieldsAfter"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var results keyvaluestore.FieldScoredMembers
+	b.zRevRangeAfter(key, after, min, limit, func(n *skiplistNode) {
+		results = append(results, fieldScoredMember(n))
+	})
+	return results, nil
+}
+
+// zRangeAfter invokes f for up to limit nodes after the token with scores up to max, in ascending
+// order.
+func (b *Backend) zRangeAfter(key string, after keyvaluestore.PageToken, max float64, limit int, f func(n *skiplistNode)) {
+	s, _ := b.lookup(key).(*sortedSet)
+	if s == nil {
+		return
+	}
+
+	maxSortKeyPrefix := sortkey.Float(max)
+	next := s.m.MinAfter(sortkey.Float(after.Score) + after.Member)
+	for n := 0; (limit == 0 || n < limit) && next != nil && next.key[:len(maxSortKeyPrefix)] <= maxSortKeyPrefix; n++ {
+		f(next)
+		next = next.Next()
+	}
+}
+
+// zRevRangeAfter invokes f for up to limit nodes after the token with scores down to min, in
+// descending order.
+func (b *Backend) zRevRangeAfter(key string, after keyvaluestore.PageToken, min float64, limit int, f func(n *skiplistNode)) {
+	s, _ := b.lookup(key).(*sortedSet)
+	if s == nil {
+		return
+	}
+
+	minSortKey := sortkey.Float(min)
+	next := s.m.MaxBefore(sortkey.Float(after.Score) + after.Member)
+	for n := 0; (limit == 0 || n < limit) && next != nil && next.key >= minSortKey; n++ {
+		f(next)
+		next = next.Prev()
+	}
+}
+
+func (b *Backend) Ping() error {
+	return b.simulate("Ping")
+}
+
+// Close stops any expiration sweepers and closes all subscriptions. The data is left intact.
+func (b *Backend) Close() error {
+	b.sweepersMutex.Lock()
+	for done := range b.sweepers {
+		close(done)
+	}
+	b.sweepers = nil
+	b.sweepersMutex.Unlock()
+
+	b.subscriptionsMutex.RLock()
+	var cancels []func()
+	for _, subs := range b.subscriptions {
+		for sub := range subs {
+			cancels = append(cancels, sub.cancel)
+		}
+	}
+	b.subscriptionsMutex.RUnlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+	return nil
+}
+
 func (b *Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
 	return b
 }
@@ -1,7 +1,13 @@
 package memorystore
 
 import (
+	"errors"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ccbrown/keyvaluestore"
 	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
@@ -12,3 +18,188 @@ func TestBackend(t *testing.T) {
 		return NewBackend()
 	})
 }
+
+func TestBackendParallel(t *testing.T) {
+	keyvaluestoretest.TestBackendWithOptions(t, func() keyvaluestore.Backend {
+		return NewBackend()
+	}, keyvaluestoretest.Options{
+		Parallel: true,
+	})
+}
+
+func TestBackendConcurrency(t *testing.T) {
+	keyvaluestoretest.TestBackendConcurrency(t, func() keyvaluestore.Backend {
+		return NewBackend()
+	})
+}
+
+func TestBackendWithMaxMemory(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		b := NewBackend()
+		b.MaxMemory = 1 << 30
+		return b
+	})
+}
+
+func BenchmarkBackend(b *testing.B) {
+	keyvaluestoretest.BenchmarkBackend(b, func() keyvaluestore.Backend {
+		return NewBackend()
+	})
+}
+
+func newBenchmarkBackend(b *testing.B) *Backend {
+	backend := NewBackend()
+	for i := 0; i < 1000; i++ {
+		if err := backend.Set("key"+strconv.Itoa(i), "value"); err != nil {
+			b.Fatal(err)
+		}
+		if err := backend.ZAdd("zset", i, float64(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return backend
+}
+
+func BenchmarkParallelGet(b *testing.B) {
+	backend := newBenchmarkBackend(b)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			backend.Get("key" + strconv.Itoa(i%1000))
+			i++
+		}
+	})
+}
+
+func BenchmarkParallelZRangeByScore(b *testing.B) {
+	backend := newBenchmarkBackend(b)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			backend.ZRangeByScore("zset", 100, 200, 10)
+		}
+	})
+}
+
+func BenchmarkParallelMixed(b *testing.B) {
+	backend := newBenchmarkBackend(b)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := "key" + strconv.Itoa(i%1000)
+			if i%10 == 0 {
+				backend.Set(key, "value")
+			} else {
+				backend.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+func TestNIncrByWrongType(t *testing.T) {
+	b := NewBackend()
+
+	require.NoError(t, b.Set("foo", "bar"))
+	_, err := b.NIncrBy("foo", 1)
+	assert.True(t, errors.Is(err, keyvaluestore.ErrWrongType))
+
+	require.NoError(t, b.SAdd("set", "a"))
+	_, err = b.NIncrBy("set", 1)
+	assert.True(t, errors.Is(err, keyvaluestore.ErrWrongType))
+}
+
+func TestAtomicWriteNIncrByValue(t *testing.T) {
+	b := NewBackend()
+
+	require.NoError(t, b.Set("foo", "10"))
+	tx := b.AtomicWrite()
+	incr := tx.NIncrBy("foo", 5)
+	ok, err := tx.Exec()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	v, ok := keyvaluestore.NIncrByValue(incr)
+	assert.True(t, ok)
+	assert.EqualValues(t, 15, v)
+}
+
+func TestPubSub(t *testing.T) {
+	keyvaluestoretest.TestPubSub(t, func() keyvaluestore.PubSub {
+		return NewBackend()
+	})
+}
+
+func TestObservableBackend(t *testing.T) {
+	keyvaluestoretest.TestObservableBackend(t, func() keyvaluestore.Backend {
+		return NewBackend()
+	})
+}
+
+func TestSnapshotBatch(t *testing.T) {
+	keyvaluestoretest.TestSnapshotBatch(t, func() keyvaluestore.Backend {
+		return NewBackend()
+	})
+}
+
+func TestBatchErrors(t *testing.T) {
+	newBackend := func() keyvaluestore.Backend {
+		b := NewBackend()
+		b.Faults = &Faults{
+			ErrorRates: map[string]float64{
+				"SAdd": 1,
+			},
+		}
+		return b
+	}
+	addFailure := func(b keyvaluestore.Backend, batch keyvaluestore.BatchOperation) keyvaluestore.ErrorResult {
+		return batch.SAdd("batch-errors-set", "a")
+	}
+	keyvaluestoretest.TestBatchErrors(t, newBackend, addFailure)
+
+	t.Run("Snapshot", func(t *testing.T) {
+		keyvaluestoretest.TestBatchErrors(t, func() keyvaluestore.Backend {
+			return snapshotBatchBackend{newBackend().(*Backend)}
+		}, addFailure)
+	})
+}
+
+// snapshotBatchBackend runs the conformance tests against snapshot batches.
+type snapshotBatchBackend struct {
+	*Backend
+}
+
+func (b snapshotBatchBackend) Batch() keyvaluestore.BatchOperation {
+	return b.SnapshotBatch()
+}
+
+func TestBackendWithSnapshotBatches(t *testing.T) {
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		return snapshotBatchBackend{NewBackend()}
+	})
+}
+
+func TestClose(t *testing.T) {
+	b := NewBackend()
+	require.NoError(t, b.Set("foo", "bar"))
+
+	ch, cancel, err := b.Subscribe("foo")
+	require.NoError(t, err)
+	stop := b.StartExpirationSweeper(time.Hour)
+
+	require.NoError(t, b.Close())
+
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	// Stopping or canceling after Close is a no-op.
+	stop()
+	cancel()
+
+	// The data is left intact.
+	v, err := b.Get("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", *v)
+}
@@ -0,0 +1,244 @@
+package memorystore
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// SnapshotBatchOperation is a batch whose operations are all executed while holding the backend's
+// lock, so its reads observe a single, consistent snapshot. Its reads are executed before its
+// writes.
+type SnapshotBatchOperation struct {
+	Backend *Backend
+
+	reads  []batchEntry
+	writes []batchEntry
+}
+
+type batchEntry struct {
+	operation string
+	err       *error
+
+	// f is invoked while the backend's lock is held.
+	f func() error
+}
+
+func (b *Backend) SnapshotBatch() keyvaluestore.BatchOperation {
+	return &SnapshotBatchOperation{
+		Backend: b,
+	}
+}
+
+var _ keyvaluestore.SnapshotBatcher = &Backend{}
+
+type getResult struct {
+	value *string
+	err   error
+}
+
+func (r *getResult) Result() (*string, error) {
+	return r.value, r.err
+}
+
+type errorResult struct {
+	err error
+}
+
+func (r *errorResult) Result() error {
+	return r.err
+}
+
+type sMembersResult struct {
+	value []string
+	err   error
+}
+
+func (r *sMembersResult) Result() ([]string, error) {
+	return r.value, r.err
+}
+
+type zScoreResult struct {
+	value *float64
+	err   error
+}
+
+func (r *zScoreResult) Result() (*float64, error) {
+	return r.value, r.err
+}
+
+type zRangeResult struct {
+	value []string
+	err   error
+}
+
+func (r *zRangeResult) Result() ([]string, error) {
+	return r.value, r.err
+}
+
+func (op *SnapshotBatchOperation) read(operation string, err *error, f func() error) {
+	op.reads = append(op.reads, batchEntry{
+		operation: operation,
+		err:       err,
+		f:         f,
+	})
+}
+
+func (op *SnapshotBatchOperation) write(operation string, f func() error) keyvaluestore.ErrorResult {
+	r := &errorResult{}
+	op.writes = append(op.writes, batchEntry{
+		operation: operation,
+		err:       &r.err,
+		f:         f,
+	})
+	return r
+}
+
+func (op *SnapshotBatchOperation) Get(key string) keyvaluestore.GetResult {
+	r := &getResult{}
+	op.read("Get", &r.err, func() error {
+		r.value = op.Backend.get(key)
+		return nil
+	})
+	return r
+}
+
+func (op *SnapshotBatchOperation) Delete(key string) keyvaluestore.ErrorResult {
+	return op.write("Delete", func() error {
+		op.Backend.delete(key)
+		return nil
+	})
+}
+
+func (op *SnapshotBatchOperation) Set(key string, value interface{}) keyvaluestore.ErrorResult {
+	return op.write("Set", func() error {
+		op.Backend.set(key, value)
+		return nil
+	})
+}
+
+func (op *SnapshotBatchOperation) SMembers(key string) keyvaluestore.SMembersResult {
+	r := &sMembersResult{}
+	op.read("SMembers", &r.err, func() error {
+		r.value = op.Backend.smembers(key)
+		return nil
+	})
+	return r
+}
+
+func (op *SnapshotBatchOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	return op.write("SAdd", func() error {
+		op.Backend.sadd(key, member, members...)
+		return nil
+	})
+}
+
+func (op *SnapshotBatchOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
+	return op.write("SRem", func() error {
+		return op.Backend.srem(key, member, members...)
+	})
+}
+
+func (op *SnapshotBatchOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.ErrorResult {
+	s := *keyvaluestore.ToString(member)
+	return op.write("ZHAdd", func() error {
+		_, err := op.Backend.zhadd(key, s, s, func(previousScore *float64) (float64, error) {
+			return score, nil
+		})
+		return err
+	})
+}
+
+func (op *SnapshotBatchOperation) ZRem(key string, member interface{}) keyvaluestore.ErrorResult {
+	s := *keyvaluestore.ToString(member)
+	return op.write("ZHRem", func() error {
+		return op.Backend.zhrem(key, s)
+	})
+}
+
+func (op *SnapshotBatchOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.ErrorResult {
+	return op.write("ZHMAdd", func() error {
+		return op.Backend.zhmadd(key, entries)
+	})
+}
+
+func (op *SnapshotBatchOperation) ZScore(key string, member interface{}) keyvaluestore.ZScoreResult {
+	r := &zScoreResult{}
+	op.read("ZScore", &r.err, func() error {
+		r.value = op.Backend.zscore(key, member)
+		return nil
+	})
+	return r
+}
+
+func (op *SnapshotBatchOperation) ZHRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	r := &zRangeResult{}
+	op.read("ZRangeByScore", &r.err, func() error {
+		op.Backend.zRangeByScore(key, min, max, limit, func(n *skiplistNode) {
+			r.value = append(r.value, n.value)
+		})
+		return nil
+	})
+	return r
+}
+
+func (op *SnapshotBatchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	r := &zRangeResult{}
+	op.read("ZRevRangeByScore", &r.err, func() error {
+		op.Backend.zRevRangeByScore(key, min, max, limit, func(n *skiplistNode) {
+			r.value = append(r.value, n.value)
+		})
+		return nil
+	})
+	return r
+}
+
+func (op *SnapshotBatchOperation) ZHRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	r := &zRangeResult{}
+	op.read("ZRangeByLex", &r.err, func() error {
+		op.Backend.zRangeByLex(key, min, max, limit, func(n *skiplistNode) {
+			r.value = append(r.value, n.value)
+		})
+		return nil
+	})
+	return r
+}
+
+func (op *SnapshotBatchOperation) ZHRevRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	r := &zRangeResult{}
+	op.read("ZRevRangeByLex", &r.err, func() error {
+		op.Backend.zRevRangeByLex(key, min, max, limit, func(n *skiplistNode) {
+			r.value = append(r.value, n.value)
+		})
+		return nil
+	})
+	return r
+}
+
+func (op *SnapshotBatchOperation) Len() int {
+	return len(op.reads) + len(op.writes)
+}
+
+func (op *SnapshotBatchOperation) Exec() error {
+	entries := append(append([]batchEntry(nil), op.reads...), op.writes...)
+
+	// Faults may introduce latency, so they're simulated before the lock is acquired.
+	for _, e := range entries {
+		*e.err = op.Backend.simulate(e.operation)
+	}
+
+	func() {
+		op.Backend.mutex.Lock()
+		defer op.Backend.mutex.Unlock()
+		for _, e := range entries {
+			if *e.err == nil {
+				*e.err = e.f()
+			}
+		}
+		op.Backend.evict()
+	}()
+
+	var errs []error
+	for _, e := range entries {
+		errs = append(errs, *e.err)
+	}
+	return keyvaluestore.JoinBatchErrors(errs...)
+}
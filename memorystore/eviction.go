@@ -0,0 +1,166 @@
+package memorystore
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/internal/sortkey"
+)
+
+type EvictionPolicy int
+
+const (
+	// EvictionPolicyLRU evicts the least recently used keys first.
+	EvictionPolicyLRU EvictionPolicy = iota
+
+	// EvictionPolicyLFU evicts the least frequently used keys first.
+	EvictionPolicyLFU
+)
+
+// Like Redis, we don't find the exact least recently or frequently used key. Instead, we sample a
+// few keys and evict the best candidate among them.
+const evictionSampleSize = 5
+
+type keyAccesses struct {
+	// These are updated atomically since reads only hold the read lock.
+	lastAccess int64
+	count      int64
+}
+
+// touch records an access for the eviction policy.
+func (b *Backend) touch(key string) {
+	if b.MaxMemory <= 0 {
+		return
+	}
+	if a := b.accesses[key]; a != nil {
+		atomic.StoreInt64(&a.lastAccess, atomic.AddInt64(&b.clock, 1))
+		atomic.AddInt64(&a.count, 1)
+	}
+}
+
+// setSize updates the approximate memory used by a key. It requires the write lock.
+func (b *Backend) setSize(key string, n int) {
+	if b.MaxMemory <= 0 {
+		return
+	}
+	b.usedMemory += n - b.sizes[key]
+	b.sizes[key] = n
+	if _, ok := b.accesses[key]; !ok {
+		b.accesses[key] = &keyAccesses{
+			lastAccess: atomic.AddInt64(&b.clock, 1),
+			count:      1,
+		}
+	}
+}
+
+func (b *Backend) addSize(key string, delta int) {
+	b.setSize(key, b.sizes[key]+delta)
+}
+
+// evict removes keys until the backend is within its memory budget. It requires the write lock.
+func (b *Backend) evict() {
+	evicted := 0
+	defer func() {
+		if evicted > 0 && b.Logger != nil {
+			b.Logger.Warn("memorystore evicted keys to stay under MaxMemory", "keys", evicted, "maxMemory", b.MaxMemory)
+		}
+	}()
+
+	for b.MaxMemory > 0 && b.usedMemory > b.MaxMemory {
+		victim := ""
+		best := int64(math.MaxInt64)
+		n := 0
+		for key, a := range b.accesses {
+			if b.isExpired(key) {
+				victim = key
+				break
+			}
+			var score int64
+			if b.EvictionPolicy == EvictionPolicyLFU {
+				score = atomic.LoadInt64(&a.count)
+			} else {
+				score = atomic.LoadInt64(&a.lastAccess)
+			}
+			if score < best {
+				victim = key
+				best = score
+			}
+			if n++; n >= evictionSampleSize {
+				break
+			}
+		}
+		if victim == "" {
+			return
+		}
+		b.remove(victim)
+		evicted++
+	}
+}
+
+// resetMemoryAccounting recomputes all of the eviction metadata from scratch. It requires the write
+// lock.
+func (b *Backend) resetMemoryAccounting() {
+	b.sizes = make(map[string]int)
+	b.usedMemory = 0
+	b.accesses = make(map[string]*keyAccesses)
+	for key, v := range b.m {
+		b.setSize(key, valueSize(key, v))
+	}
+	b.evict()
+}
+
+// Approximate overhead in bytes for each key and for the members of each type of collection.
+const (
+	keyOverhead             = 48
+	setMemberOverhead       = 16
+	hashFieldOverhead       = 32
+	sortedSetMemberOverhead = 64
+)
+
+func keySize(key string) int {
+	return len(key) + keyOverhead
+}
+
+func stringSize(key, value string) int {
+	return keySize(key) + len(value)
+}
+
+func setMemberSize(member string) int {
+	return len(member) + setMemberOverhead
+}
+
+func hashFieldSize(field, value string) int {
+	return len(field) + len(value) + hashFieldOverhead
+}
+
+func sortedSetMemberSize(field, member string) int {
+	// The field is stored twice: once in scoresByMember and once in the sort key.
+	return 2*len(field) + sortkey.FloatSize + len(member) + sortedSetMemberOverhead
+}
+
+func valueSize(key string, v interface{}) int {
+	switch v := v.(type) {
+	case map[string]struct{}:
+		n := keySize(key)
+		for member := range v {
+			n += setMemberSize(member)
+		}
+		return n
+	case map[string]string:
+		n := keySize(key)
+		for field, value := range v {
+			n += hashFieldSize(field, value)
+		}
+		return n
+	case *sortedSet:
+		n := keySize(key)
+		for field, score := range v.scoresByMember {
+			if member, ok := v.m.Get(sortkey.Float(score) + field); ok {
+				n += sortedSetMemberSize(field, member)
+			}
+		}
+		return n
+	}
+	return stringSize(key, *keyvaluestore.ToString(v))
+}
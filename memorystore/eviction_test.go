@@ -0,0 +1,87 @@
+package memorystore
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+func TestEviction(t *testing.T) {
+	value := strings.Repeat("x", 100)
+
+	t.Run("LRU", func(t *testing.T) {
+		var logs bytes.Buffer
+		b := NewBackend()
+		b.MaxMemory = 3 * stringSize("a", value)
+		b.Logger = keyvaluestore.StandardLogger(log.New(&logs, "", 0))
+
+		require.NoError(t, b.Set("a", value))
+		require.NoError(t, b.Set("b", value))
+		require.NoError(t, b.Set("c", value))
+		_, err := b.Get("a")
+		require.NoError(t, err)
+
+		assert.Empty(t, logs.String())
+		require.NoError(t, b.Set("d", value))
+		assert.Contains(t, logs.String(), "WARN memorystore evicted keys to stay under MaxMemory keys=1 ")
+
+		for key, expected := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+			v, err := b.Get(key)
+			require.NoError(t, err)
+			assert.Equal(t, expected, v != nil, key)
+		}
+	})
+
+	t.Run("LFU", func(t *testing.T) {
+		b := NewBackend()
+		b.MaxMemory = 3 * stringSize("a", value)
+		b.EvictionPolicy = EvictionPolicyLFU
+
+		require.NoError(t, b.Set("a", value))
+		require.NoError(t, b.Set("b", value))
+		require.NoError(t, b.Set("c", value))
+		for i := 0; i < 2; i++ {
+			_, err := b.Get("a")
+			require.NoError(t, err)
+			_, err = b.Get("c")
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, b.Set("a", value+value))
+
+		for key, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+			v, err := b.Get(key)
+			require.NoError(t, err)
+			assert.Equal(t, expected, v != nil, key)
+		}
+	})
+
+	t.Run("Collections", func(t *testing.T) {
+		b := NewBackend()
+		b.MaxMemory = 1000
+
+		require.NoError(t, b.SAdd("s", "a", "b"))
+		require.NoError(t, b.HSet("h", "a", "b"))
+		require.NoError(t, b.ZAdd("z", "a", 1.0))
+		used := b.usedMemory
+
+		require.NoError(t, b.SRem("s", "a", "b"))
+		require.NoError(t, b.HDel("h", "a"))
+		require.NoError(t, b.ZRem("z", "a"))
+		assert.True(t, b.usedMemory < used)
+
+		b.Restore(b.Snapshot())
+		assert.Equal(t, valueSize("z", b.m["z"]), b.usedMemory)
+
+		for i := 0; i < 100; i++ {
+			require.NoError(t, b.ZAdd("z", strings.Repeat("x", i), float64(i)))
+		}
+		assert.True(t, b.usedMemory <= b.MaxMemory)
+	})
+}
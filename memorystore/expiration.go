@@ -0,0 +1,125 @@
+package memorystore
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Now returns the current time according to the backend's clock, which is used for expirations.
+// It's the time of Clock (or the wall clock if Clock is nil) plus any time added via FastForward.
+func (b *Backend) Now() time.Time {
+	return keyvaluestore.Now(b.Clock).Add(time.Duration(atomic.LoadInt64(&b.timeOffset)))
+}
+
+// FastForward advances the backend's clock by the given duration, which immediately expires any keys
+// whose deadlines are passed. This allows expiration-dependent logic to be tested deterministically
+// without sleeping.
+func (b *Backend) FastForward(d time.Duration) {
+	atomic.AddInt64(&b.timeOffset, int64(d))
+}
+
+// Expire sets a timeout on the given key, after which it will be deleted. Like Redis, the timeout is
+// cleared when the key is deleted or overwritten via Set, but not when it's modified in place (e.g.
+// via NIncrBy, SAdd, HSet, or ZAdd). It returns false if the key doesn't exist.
+func (b *Backend) Expire(key string, ttl time.Duration) (bool, error) {
+	return b.ExpireAt(key, b.Now().Add(ttl))
+}
+
+// ExpireAt is like Expire, but takes an absolute deadline.
+func (b *Backend) ExpireAt(key string, deadline time.Time) (bool, error) {
+	if err := b.simulate("ExpireAt"); err != nil {
+		return false, err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.lookup(key) == nil {
+		return false, nil
+	}
+	b.expirations[key] = deadline
+	b.removeIfExpired(key)
+	return true, nil
+}
+
+// Persist removes the timeout from the given key. It returns false if the key doesn't exist or
+// doesn't have a timeout.
+func (b *Backend) Persist(key string) (bool, error) {
+	if err := b.simulate("Persist"); err != nil {
+		return false, err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.lookup(key) == nil {
+		return false, nil
+	} else if _, ok := b.expirations[key]; !ok {
+		return false, nil
+	}
+	delete(b.expirations, key)
+	return true, nil
+}
+
+// TTL returns the remaining time to live of the given key. It returns nil if the key doesn't exist
+// or doesn't have a timeout.
+func (b *Backend) TTL(key string) (*time.Duration, error) {
+	if err := b.simulate("TTL"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.lookup(key) == nil {
+		return nil, nil
+	} else if deadline, ok := b.expirations[key]; ok {
+		ttl := deadline.Sub(b.Now())
+		return &ttl, nil
+	}
+	return nil, nil
+}
+
+// SweepExpired removes all expired keys. Expired keys are never visible to readers, but they
+// aren't removed until they're written, so backends with many short-lived keys should sweep
+// periodically to reclaim memory. See StartExpirationSweeper.
+func (b *Backend) SweepExpired() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for key := range b.expirations {
+		b.removeIfExpired(key)
+	}
+}
+
+// StartExpirationSweeper invokes SweepExpired at the given interval in the background until the
+// returned function is invoked or the backend is closed.
+func (b *Backend) StartExpirationSweeper(interval time.Duration) func() {
+	done := make(chan struct{})
+	b.sweepersMutex.Lock()
+	if b.sweepers == nil {
+		b.sweepers = map[chan struct{}]struct{}{}
+	}
+	b.sweepers[done] = struct{}{}
+	b.sweepersMutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				b.SweepExpired()
+			}
+		}
+	}()
+	return func() {
+		b.sweepersMutex.Lock()
+		defer b.sweepersMutex.Unlock()
+		if _, ok := b.sweepers[done]; ok {
+			delete(b.sweepers, done)
+			close(done)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package memorystore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+func TestExpiration(t *testing.T) {
+	b := NewBackend()
+
+	ok, err := b.Expire("foo", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, b.Set("foo", "bar"))
+	ttl, err := b.TTL("foo")
+	require.NoError(t, err)
+	assert.Nil(t, ttl)
+
+	ok, err = b.Expire("foo", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ttl, err = b.TTL("foo")
+	require.NoError(t, err)
+	require.NotNil(t, ttl)
+	assert.True(t, *ttl > 59*time.Minute && *ttl <= time.Hour)
+
+	t.Run("ModifyInPlace", func(t *testing.T) {
+		require.NoError(t, b.SAdd("s", "a"))
+		ok, err := b.Expire("s", time.Hour)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		require.NoError(t, b.SAdd("s", "b"))
+		ttl, err := b.TTL("s")
+		require.NoError(t, err)
+		assert.NotNil(t, ttl)
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		require.NoError(t, b.Set("foo", "baz"))
+		ttl, err := b.TTL("foo")
+		require.NoError(t, err)
+		assert.Nil(t, ttl)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		require.NoError(t, b.ZAdd("z", "a", 0))
+		ok, err := b.Expire("z", time.Hour)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = b.RenameCollection("z", "z2")
+		require.NoError(t, err)
+		require.True(t, ok)
+		ttl, err := b.TTL("z2")
+		require.NoError(t, err)
+		assert.NotNil(t, ttl)
+	})
+
+	t.Run("Persist", func(t *testing.T) {
+		ok, err := b.Expire("foo", time.Hour)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = b.Persist("foo")
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = b.Persist("foo")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		require.NoError(t, b.HSet("h", "a", "b"))
+		ok, err := b.Expire("h", 0)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		v, err := b.HGet("h", "a")
+		require.NoError(t, err)
+		assert.Nil(t, v)
+
+		require.NoError(t, b.Set("foo", "bar"))
+		ok, err = b.Expire("foo", time.Millisecond)
+		require.NoError(t, err)
+		require.True(t, ok)
+		time.Sleep(10 * time.Millisecond)
+
+		didSet, err := b.SetNX("foo", "baz")
+		require.NoError(t, err)
+		assert.True(t, didSet)
+	})
+
+	t.Run("Sweeper", func(t *testing.T) {
+		require.NoError(t, b.Set("swept", "x"))
+		_, err := b.Expire("swept", time.Millisecond)
+		require.NoError(t, err)
+
+		stop := b.StartExpirationSweeper(time.Millisecond)
+		defer stop()
+
+		assert.Eventually(t, func() bool {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+			_, ok := b.m["swept"]
+			return !ok
+		}, time.Second, time.Millisecond)
+	})
+}
+
+func TestFastForward(t *testing.T) {
+	b := NewBackend()
+
+	require.NoError(t, b.Set("foo", "bar"))
+	ok, err := b.Expire("foo", time.Hour)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	b.FastForward(59 * time.Minute)
+	ttl, err := b.TTL("foo")
+	require.NoError(t, err)
+	require.NotNil(t, ttl)
+	assert.True(t, *ttl > 0 && *ttl <= time.Minute)
+
+	b.FastForward(time.Minute)
+	v, err := b.Get("foo")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestClock(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	b := NewBackend()
+	b.Clock = keyvaluestore.ClockFunc(func() time.Time {
+		return now
+	})
+
+	require.NoError(t, b.Set("foo", "bar"))
+	ok, err := b.Expire("foo", time.Hour)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	now = now.Add(59 * time.Minute)
+	ttl, err := b.TTL("foo")
+	require.NoError(t, err)
+	require.NotNil(t, ttl)
+	assert.Equal(t, time.Minute, *ttl)
+
+	b.FastForward(time.Minute)
+	assert.Equal(t, now.Add(time.Minute), b.Now())
+	v, err := b.Get("foo")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
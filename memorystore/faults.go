@@ -0,0 +1,85 @@
+package memorystore
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrSimulatedFault is returned by operations that fail due to Faults.ErrorRates.
+var ErrSimulatedFault = errors.New("simulated fault")
+
+// Faults can be used to make a backend misbehave so that tests can exercise error handling and
+// retry paths.
+//
+// Operations are identified by the name of the backend method that implements them. Methods that
+// are implemented in terms of others are identified by the underlying method's name. For example,
+// ZAdd is identified as "ZHAdd" and ZCount is identified as "ZRangeByScore". Atomic writes are
+// identified as "AtomicWrite".
+type Faults struct {
+	// Latency is added to every operation.
+	Latency time.Duration
+
+	// ErrorRates maps operation names to the probability that they fail with ErrSimulatedFault.
+	ErrorRates map[string]float64
+
+	// Rand is used to decide which operations fail. Give it a fixed seed to make failures
+	// deterministic. If nil, a randomly seeded source is used.
+	Rand *rand.Rand
+
+	// Hook, if non-nil, is invoked before each operation. If it returns an error, the operation
+	// fails with that error.
+	Hook func(operation string) error
+
+	// AtomicWriteConditionalFailures is the number of upcoming atomic writes that should fail as if
+	// their conditions hadn't passed. Every operation with a condition in those writes will report
+	// ConditionalFailed.
+	AtomicWriteConditionalFailures int
+
+	mutex sync.Mutex
+}
+
+func (f *Faults) simulate(operation string) error {
+	if f.Latency > 0 {
+		time.Sleep(f.Latency)
+	}
+
+	if f.Hook != nil {
+		if err := f.Hook(operation); err != nil {
+			return err
+		}
+	}
+
+	if rate := f.ErrorRates[operation]; rate > 0 {
+		f.mutex.Lock()
+		if f.Rand == nil {
+			f.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+		}
+		n := f.Rand.Float64()
+		f.mutex.Unlock()
+		if n < rate {
+			return ErrSimulatedFault
+		}
+	}
+
+	return nil
+}
+
+// takeAtomicWriteConditionalFailure returns true if the next atomic write should fail.
+func (f *Faults) takeAtomicWriteConditionalFailure() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.AtomicWriteConditionalFailures > 0 {
+		f.AtomicWriteConditionalFailures--
+		return true
+	}
+	return false
+}
+
+func (b *Backend) simulate(operation string) error {
+	if b.Faults == nil {
+		return nil
+	}
+	return b.Faults.simulate(operation)
+}
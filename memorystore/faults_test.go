@@ -0,0 +1,83 @@
+package memorystore
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaults(t *testing.T) {
+	t.Run("ErrorRates", func(t *testing.T) {
+		b := NewBackend()
+		b.Faults = &Faults{
+			ErrorRates: map[string]float64{
+				"Get": 1.0,
+			},
+			Rand: rand.New(rand.NewSource(0)),
+		}
+
+		require.NoError(t, b.Set("foo", "bar"))
+		_, err := b.Get("foo")
+		assert.Equal(t, ErrSimulatedFault, err)
+	})
+
+	t.Run("Hook", func(t *testing.T) {
+		b := NewBackend()
+		hookErr := errors.New("hook")
+		var operations []string
+		b.Faults = &Faults{
+			Hook: func(operation string) error {
+				operations = append(operations, operation)
+				if operation == "SAdd" {
+					return hookErr
+				}
+				return nil
+			},
+		}
+
+		require.NoError(t, b.Set("foo", "bar"))
+		assert.Equal(t, hookErr, b.SAdd("foo", "bar"))
+		assert.Equal(t, []string{"Set", "SAdd"}, operations)
+	})
+
+	t.Run("Latency", func(t *testing.T) {
+		b := NewBackend()
+		b.Faults = &Faults{
+			Latency: 10 * time.Millisecond,
+		}
+
+		start := time.Now()
+		require.NoError(t, b.Set("foo", "bar"))
+		assert.True(t, time.Since(start) >= 10*time.Millisecond)
+	})
+
+	t.Run("AtomicWriteConditionalFailures", func(t *testing.T) {
+		b := NewBackend()
+		b.Faults = &Faults{
+			AtomicWriteConditionalFailures: 1,
+		}
+
+		tx := b.AtomicWrite()
+		set := tx.Set("foo", "bar")
+		setNX := tx.SetNX("bar", "baz")
+		ok, err := tx.Exec()
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.False(t, set.ConditionalFailed())
+		assert.True(t, setNX.ConditionalFailed())
+
+		v, err := b.Get("foo")
+		require.NoError(t, err)
+		assert.Nil(t, v)
+
+		tx = b.AtomicWrite()
+		tx.SetNX("bar", "baz")
+		ok, err = tx.Exec()
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
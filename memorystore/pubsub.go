@@ -0,0 +1,70 @@
+package memorystore
+
+import (
+	"sync"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+var _ keyvaluestore.PubSub = (*Backend)(nil)
+
+type subscription struct {
+	ch     chan string
+	done   chan struct{}
+	cancel func()
+}
+
+// Publish implements keyvaluestore.Publisher. Messages are only delivered within the process. If a
+// subscriber isn't keeping up, Publish blocks until it catches up or unsubscribes.
+func (b *Backend) Publish(channel, message string) error {
+	if err := b.simulate("Publish"); err != nil {
+		return err
+	}
+	b.subscriptionsMutex.RLock()
+	defer b.subscriptionsMutex.RUnlock()
+	for sub := range b.subscriptions[channel] {
+		select {
+		case sub.ch <- message:
+		case <-sub.done:
+		}
+	}
+	return nil
+}
+
+// Subscribe implements keyvaluestore.Subscriber.
+func (b *Backend) Subscribe(channel string) (<-chan string, func(), error) {
+	if err := b.simulate("Subscribe"); err != nil {
+		return nil, nil, err
+	}
+	sub := &subscription{
+		ch:   make(chan string, 100),
+		done: make(chan struct{}),
+	}
+
+	b.subscriptionsMutex.Lock()
+	defer b.subscriptionsMutex.Unlock()
+	if b.subscriptions == nil {
+		b.subscriptions = map[string]map[*subscription]struct{}{}
+	}
+	if b.subscriptions[channel] == nil {
+		b.subscriptions[channel] = map[*subscription]struct{}{}
+	}
+	b.subscriptions[channel][sub] = struct{}{}
+
+	var once sync.Once
+	sub.cancel = func() {
+		once.Do(func() {
+			// Unblock any publishers before waiting for the lock.
+			close(sub.done)
+
+			b.subscriptionsMutex.Lock()
+			defer b.subscriptionsMutex.Unlock()
+			delete(b.subscriptions[channel], sub)
+			if len(b.subscriptions[channel]) == 0 {
+				delete(b.subscriptions, channel)
+			}
+			close(sub.ch)
+		})
+	}
+	return sub.ch, sub.cancel, nil
+}
@@ -0,0 +1,37 @@
+package memorystore
+
+import (
+	"fmt"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+var _ keyvaluestore.Renamer = &Backend{}
+
+// RenameCollection is atomic. Like Redis, the source's timeout, if any, is moved along with it.
+func (b *Backend) RenameCollection(src, dst string) (bool, error) {
+	if src == dst {
+		return false, fmt.Errorf("unable to rename %v to itself", src)
+	}
+	if err := b.simulate("RenameCollection"); err != nil {
+		return false, err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	v := b.lookup(src)
+	if v == nil {
+		return false, nil
+	}
+	deadline, hasDeadline := b.expirations[src]
+	size := b.sizes[src]
+	b.remove(src)
+	b.remove(dst)
+	b.m[dst] = v
+	if hasDeadline {
+		b.expirations[dst] = deadline
+	}
+	b.setSize(dst, size)
+	b.changed(dst)
+	return true, nil
+}
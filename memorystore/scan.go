@@ -0,0 +1,126 @@
+package memorystore
+
+import (
+	"sort"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/internal/sortkey"
+)
+
+var _ keyvaluestore.Scanner = &Backend{}
+var _ keyvaluestore.EntryGetter = &Backend{}
+
+// Scan returns entries in ascending key order. The cursor is the last key returned. Each call
+// sorts the backend's keys, so it's intended for tooling rather than hot paths.
+func (b *Backend) Scan(cursor string, limit int) ([]*keyvaluestore.Entry, string, error) {
+	if err := b.simulate("Scan"); err != nil {
+		return nil, "", err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return scan(b.m, cursor, limit, b.isExpired)
+}
+
+var _ keyvaluestore.SnapshotScanner = &Backend{}
+
+// ScanSnapshot copies the backend's unexpired contents while holding its lock and returns a scanner
+// for the copy. The copy requires as much memory as the backend's contents, but writes aren't
+// blocked while it's scanned.
+func (b *Backend) ScanSnapshot() (keyvaluestore.Scanner, error) {
+	if err := b.simulate("ScanSnapshot"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	m := make(map[string]interface{}, len(b.m))
+	for key, v := range b.m {
+		if !b.isExpired(key) {
+			m[key] = v
+		}
+	}
+	return snapshotScanner(copyValues(m)), nil
+}
+
+// snapshotScanner scans a copy of a backend's contents. Nothing else has access to the copy, so it
+// doesn't need to be locked.
+type snapshotScanner map[string]interface{}
+
+func (s snapshotScanner) Scan(cursor string, limit int) ([]*keyvaluestore.Entry, string, error) {
+	return scan(s, cursor, limit, func(string) bool {
+		return false
+	})
+}
+
+func scan(m map[string]interface{}, cursor string, limit int, isExpired func(key string) bool) ([]*keyvaluestore.Entry, string, error) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		if (cursor == "" || key > cursor) && !isExpired(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		cursor = keys[limit-1]
+	} else {
+		cursor = ""
+	}
+
+	entries := make([]*keyvaluestore.Entry, len(keys))
+	for i, key := range keys {
+		entries[i] = newEntry(key, m[key])
+	}
+	return entries, cursor, nil
+}
+
+func (b *Backend) GetEntry(key string) (*keyvaluestore.Entry, error) {
+	if err := b.simulate("GetEntry"); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.isExpired(key) {
+		return nil, nil
+	} else if v, ok := b.m[key]; ok {
+		return newEntry(key, v), nil
+	}
+	return nil, nil
+}
+
+func newEntry(key string, v interface{}) *keyvaluestore.Entry {
+	entry := &keyvaluestore.Entry{
+		Key: key,
+	}
+	switch v := v.(type) {
+	case map[string]struct{}:
+		entry.Type = keyvaluestore.EntryTypeSet
+		for member := range v {
+			entry.Members = append(entry.Members, member)
+		}
+		sort.Strings(entry.Members)
+	case map[string]string:
+		entry.Type = keyvaluestore.EntryTypeHash
+		entry.Fields = make(map[string]string, len(v))
+		for field, value := range v {
+			entry.Fields[field] = value
+		}
+	case *sortedSet:
+		entry.Type = keyvaluestore.EntryTypeSortedSet
+		for e := v.m.Min(); e != nil; e = e.Next() {
+			field := e.key[sortkey.FloatSize:]
+			entry.SortedSetMembers = append(entry.SortedSetMembers, keyvaluestore.SortedSetEntryMember{
+				Field: field,
+				Value: e.value,
+				Score: v.scoresByMember[field],
+			})
+		}
+	default:
+		entry.Type = keyvaluestore.EntryTypeString
+		entry.Value = *keyvaluestore.ToString(v)
+	}
+	return entry
+}
@@ -0,0 +1,89 @@
+package memorystore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+func TestScan(t *testing.T) {
+	b := NewBackend()
+	require.NoError(t, b.Set("string", "foo"))
+	require.NoError(t, b.SAdd("set", "b", "a"))
+	require.NoError(t, b.HSet("hash", "field", "value"))
+	require.NoError(t, b.ZAdd("zset", "bar", 2))
+	require.NoError(t, b.ZHAdd("zset", "foo", "baz", 1))
+
+	var entries []*keyvaluestore.Entry
+	cursor := ""
+	for {
+		page, next, err := b.Scan(cursor, 3)
+		require.NoError(t, err)
+		assert.True(t, len(page) <= 3)
+		entries = append(entries, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	assert.Equal(t, []*keyvaluestore.Entry{
+		{
+			Key:    "hash",
+			Type:   keyvaluestore.EntryTypeHash,
+			Fields: map[string]string{"field": "value"},
+		},
+		{
+			Key:     "set",
+			Type:    keyvaluestore.EntryTypeSet,
+			Members: []string{"a", "b"},
+		},
+		{
+			Key:   "string",
+			Type:  keyvaluestore.EntryTypeString,
+			Value: "foo",
+		},
+		{
+			Key:  "zset",
+			Type: keyvaluestore.EntryTypeSortedSet,
+			SortedSetMembers: []keyvaluestore.SortedSetEntryMember{
+				{Field: "foo", Value: "baz", Score: 1},
+				{Field: "bar", Value: "bar", Score: 2},
+			},
+		},
+	}, entries)
+}
+
+func TestScanSnapshot(t *testing.T) {
+	b := NewBackend()
+	require.NoError(t, b.Set("a", "foo"))
+	require.NoError(t, b.SAdd("b", "x"))
+	require.NoError(t, b.Set("expired", "foo"))
+	_, err := b.ExpireAt("expired", time.Now())
+	require.NoError(t, err)
+
+	scanner, err := b.ScanSnapshot()
+	require.NoError(t, err)
+
+	// Writes made after the snapshot aren't observed by its scans.
+	require.NoError(t, b.Set("a", "bar"))
+	require.NoError(t, b.SAdd("b", "y"))
+	require.NoError(t, b.Set("c", "baz"))
+
+	page, next, err := scanner.Scan("", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []*keyvaluestore.Entry{
+		{Key: "a", Type: keyvaluestore.EntryTypeString, Value: "foo"},
+	}, page)
+
+	page, next, err = scanner.Scan(next, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []*keyvaluestore.Entry{
+		{Key: "b", Type: keyvaluestore.EntryTypeSet, Members: []string{"x"}},
+	}, page)
+	assert.Empty(t, next)
+}
@@ -0,0 +1,198 @@
+package memorystore
+
+import (
+	"math/rand"
+)
+
+const (
+	skiplistMaxLevel = 32
+
+	// Each node has a 1 in skiplistBranching chance of being promoted to the next level.
+	skiplistBranching = 4
+)
+
+// skiplist is a mutable ordered map of strings, which sorted sets use to keep their members in
+// order. Unlike a persistent tree, writes modify it in place without allocating anything besides
+// the new node.
+type skiplist struct {
+	head   skiplistNode
+	tail   *skiplistNode
+	level  int
+	length int
+}
+
+type skiplistNode struct {
+	key   string
+	value string
+	prev  *skiplistNode
+	next  []*skiplistNode
+}
+
+func newSkiplist() *skiplist {
+	l := &skiplist{
+		level: 1,
+	}
+	l.head.next = make([]*skiplistNode, skiplistMaxLevel)
+	return l
+}
+
+// Next returns the node that follows n, or nil if n is the last node.
+func (n *skiplistNode) Next() *skiplistNode {
+	return n.next[0]
+}
+
+// Prev returns the node that precedes n, or nil if n is the first node.
+func (n *skiplistNode) Prev() *skiplistNode {
+	return n.prev
+}
+
+func randomSkiplistLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Intn(skiplistBranching) == 0 {
+		level++
+	}
+	return level
+}
+
+// findPredecessors returns, for each level, the last node whose key is less than the given key.
+func (l *skiplist) findPredecessors(key string, update *[skiplistMaxLevel]*skiplistNode) *skiplistNode {
+	x := &l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	return x
+}
+
+// Len returns the number of nodes in the list.
+func (l *skiplist) Len() int {
+	return l.length
+}
+
+// Get returns the value for the given key.
+func (l *skiplist) Get(key string) (string, bool) {
+	var update [skiplistMaxLevel]*skiplistNode
+	if x := l.findPredecessors(key, &update).next[0]; x != nil && x.key == key {
+		return x.value, true
+	}
+	return "", false
+}
+
+// Set sets the value for the given key, inserting a node if necessary.
+func (l *skiplist) Set(key, value string) {
+	var update [skiplistMaxLevel]*skiplistNode
+	x := l.findPredecessors(key, &update).next[0]
+	if x != nil && x.key == key {
+		x.value = value
+		return
+	}
+
+	level := randomSkiplistLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			update[i] = &l.head
+		}
+		l.level = level
+	}
+
+	n := &skiplistNode{
+		key:   key,
+		value: value,
+		next:  make([]*skiplistNode, level),
+	}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	if update[0] != &l.head {
+		n.prev = update[0]
+	}
+	if n.next[0] != nil {
+		n.next[0].prev = n
+	} else {
+		l.tail = n
+	}
+	l.length++
+}
+
+// Delete removes the node with the given key if it exists.
+func (l *skiplist) Delete(key string) {
+	var update [skiplistMaxLevel]*skiplistNode
+	x := l.findPredecessors(key, &update).next[0]
+	if x == nil || x.key != key {
+		return
+	}
+
+	for i := 0; i < len(x.next); i++ {
+		update[i].next[i] = x.next[i]
+	}
+	if x.next[0] != nil {
+		x.next[0].prev = x.prev
+	} else {
+		l.tail = x.prev
+	}
+	for l.level > 1 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+	l.length--
+}
+
+// Min returns the first node, or nil if the list is empty.
+func (l *skiplist) Min() *skiplistNode {
+	return l.head.next[0]
+}
+
+// Max returns the last node, or nil if the list is empty.
+func (l *skiplist) Max() *skiplistNode {
+	return l.tail
+}
+
+// MinAfter returns the first node whose key is greater than the given key.
+func (l *skiplist) MinAfter(key string) *skiplistNode {
+	x := &l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key <= key {
+			x = x.next[i]
+		}
+	}
+	return x.next[0]
+}
+
+// MaxBefore returns the last node whose key is less than the given key.
+func (l *skiplist) MaxBefore(key string) *skiplistNode {
+	var update [skiplistMaxLevel]*skiplistNode
+	if x := l.findPredecessors(key, &update); x != &l.head {
+		return x
+	}
+	return nil
+}
+
+// Clone returns a copy of the list with the same structure.
+func (l *skiplist) Clone() *skiplist {
+	ret := newSkiplist()
+	ret.level = l.level
+	ret.length = l.length
+
+	var tails [skiplistMaxLevel]*skiplistNode
+	for i := range tails {
+		tails[i] = &ret.head
+	}
+	var prev *skiplistNode
+	for x := l.Min(); x != nil; x = x.Next() {
+		n := &skiplistNode{
+			key:   x.key,
+			value: x.value,
+			prev:  prev,
+			next:  make([]*skiplistNode, len(x.next)),
+		}
+		for i := range n.next {
+			tails[i].next[i] = n
+			tails[i] = n
+		}
+		prev = n
+	}
+	ret.tail = prev
+	return ret
+}
@@ -0,0 +1,90 @@
+package memorystore
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func skiplistKeys(l *skiplist) []string {
+	var keys []string
+	for n := l.Min(); n != nil; n = n.Next() {
+		keys = append(keys, n.key)
+	}
+	return keys
+}
+
+func TestSkiplist(t *testing.T) {
+	l := newSkiplist()
+	expected := map[string]string{}
+
+	r := rand.New(rand.NewSource(0))
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(r.Intn(1000))
+		if r.Intn(3) == 0 {
+			l.Delete(key)
+			delete(expected, key)
+		} else {
+			l.Set(key, strconv.Itoa(i))
+			expected[key] = strconv.Itoa(i)
+		}
+	}
+
+	var keys []string
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	require.Equal(t, len(keys), l.Len())
+	assert.Equal(t, keys, skiplistKeys(l))
+
+	var reversed []string
+	for n := l.Max(); n != nil; n = n.Prev() {
+		reversed = append([]string{n.key}, reversed...)
+	}
+	assert.Equal(t, keys, reversed)
+
+	for key, value := range expected {
+		v, ok := l.Get(key)
+		assert.True(t, ok)
+		assert.Equal(t, value, v)
+	}
+	_, ok := l.Get("x")
+	assert.False(t, ok)
+
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(r.Intn(1000))
+		j := sort.SearchStrings(keys, key)
+
+		before := l.MaxBefore(key)
+		if j == 0 {
+			assert.Nil(t, before)
+		} else {
+			assert.Equal(t, keys[j-1], before.key)
+		}
+
+		after := l.MinAfter(key)
+		if j < len(keys) && keys[j] == key {
+			j++
+		}
+		if j == len(keys) {
+			assert.Nil(t, after)
+		} else {
+			assert.Equal(t, keys[j], after.key)
+		}
+	}
+
+	clone := l.Clone()
+	l.Set("x", "x")
+	l.Delete(keys[0])
+	assert.Equal(t, keys, skiplistKeys(clone))
+	assert.Equal(t, len(keys), clone.Len())
+	clone.Set("y", "y")
+	assert.Equal(t, "y", clone.Max().key)
+	assert.Equal(t, "x", l.Max().key)
+}
@@ -0,0 +1,78 @@
+package memorystore
+
+import (
+	"time"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// Snapshot is a point-in-time copy of a backend's contents. It's unaffected by subsequent writes to
+// the backend and can be restored any number of times.
+type Snapshot struct {
+	m           map[string]interface{}
+	expirations map[string]time.Time
+}
+
+// Snapshot captures the backend's current contents. This is useful for tests that want to reset a
+// backend to a known fixture without replaying all of the writes that created it.
+func (b *Backend) Snapshot() *Snapshot {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return &Snapshot{
+		m:           copyValues(b.m),
+		expirations: copyExpirations(b.expirations),
+	}
+}
+
+// Restore replaces the backend's contents with those of the given snapshot.
+func (b *Backend) Restore(s *Snapshot) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.m = copyValues(s.m)
+	b.expirations = copyExpirations(s.expirations)
+	b.resetMemoryAccounting()
+}
+
+func copyValues(m map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		switch v := v.(type) {
+		case map[string]struct{}:
+			s := make(map[string]struct{}, len(v))
+			for member := range v {
+				s[member] = struct{}{}
+			}
+			ret[k] = s
+		case map[string]string:
+			h := make(map[string]string, len(v))
+			for field, value := range v {
+				h[field] = value
+			}
+			ret[k] = h
+		case *sortedSet:
+			scoresByMember := make(map[string]float64, len(v.scoresByMember))
+			for member, score := range v.scoresByMember {
+				scoresByMember[member] = score
+			}
+			ret[k] = &sortedSet{
+				scoresByMember: scoresByMember,
+				m:              v.m.Clone(),
+			}
+		default:
+			// Values may be mutable (e.g. []byte), so we convert them to strings, which is how
+			// they're read anyways.
+			ret[k] = *keyvaluestore.ToString(v)
+		}
+	}
+	return ret
+}
+
+func copyExpirations(m map[string]time.Time) map[string]time.Time {
+	ret := make(map[string]time.Time, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
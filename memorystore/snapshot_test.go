@@ -0,0 +1,54 @@
+package memorystore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	b := NewBackend()
+
+	require.NoError(t, b.Set("foo", []byte("bar")))
+	require.NoError(t, b.SAdd("s", "a"))
+	require.NoError(t, b.HSet("h", "a", "b"))
+	require.NoError(t, b.ZAdd("z", "a", 1.0))
+
+	snapshot := b.Snapshot()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.Set("foo", "baz"))
+		require.NoError(t, b.Set("new", "x"))
+		require.NoError(t, b.SAdd("s", "b"))
+		require.NoError(t, b.HSet("h", "a", "c"))
+		require.NoError(t, b.ZAdd("z", "a", 2.0))
+		require.NoError(t, b.ZAdd("z", "b", 3.0))
+
+		b.Restore(snapshot)
+
+		v, err := b.Get("foo")
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		assert.Equal(t, "bar", *v)
+
+		v, err = b.Get("new")
+		require.NoError(t, err)
+		assert.Nil(t, v)
+
+		members, err := b.SMembers("s")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a"}, members)
+
+		v, err = b.HGet("h", "a")
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		assert.Equal(t, "b", *v)
+
+		scored, err := b.ZRangeByScoreWithScores("z", 0.0, 10.0, 0)
+		require.NoError(t, err)
+		require.Len(t, scored, 1)
+		assert.Equal(t, "a", scored[0].Value)
+		assert.Equal(t, 1.0, scored[0].Score)
+	}
+}
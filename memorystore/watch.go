@@ -0,0 +1,141 @@
+package memorystore
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+var _ keyvaluestore.ObservableBackend = (*Backend)(nil)
+
+type keyWatch struct {
+	key string
+	ch  chan struct{}
+}
+
+type prefixWatch struct {
+	prefix string
+	signal chan struct{}
+
+	mutex    sync.Mutex
+	pending  []string
+	isQueued map[string]struct{}
+}
+
+// add queues a changed key for delivery. It never blocks.
+func (w *prefixWatch) add(key string) {
+	w.mutex.Lock()
+	if _, ok := w.isQueued[key]; !ok {
+		w.isQueued[key] = struct{}{}
+		w.pending = append(w.pending, key)
+	}
+	w.mutex.Unlock()
+
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (w *prefixWatch) take() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	keys := w.pending
+	w.pending = nil
+	w.isQueued = map[string]struct{}{}
+	return keys
+}
+
+// changed notifies watchers that the key has changed. It may be invoked with the write lock held,
+// so it never blocks on the watchers' receivers.
+func (b *Backend) changed(key string) {
+	b.watchesMutex.RLock()
+	defer b.watchesMutex.RUnlock()
+	for w := range b.keyWatches {
+		if w.key == key {
+			select {
+			case w.ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+	for w := range b.prefixWatches {
+		if strings.HasPrefix(key, w.prefix) {
+			w.add(key)
+		}
+	}
+}
+
+// Watch implements keyvaluestore.ObservableBackend. Only changes made within the process are
+// observed.
+func (b *Backend) Watch(key string) (<-chan struct{}, func()) {
+	w := &keyWatch{
+		key: key,
+		ch:  make(chan struct{}, 1),
+	}
+
+	b.watchesMutex.Lock()
+	if b.keyWatches == nil {
+		b.keyWatches = map[*keyWatch]struct{}{}
+	}
+	b.keyWatches[w] = struct{}{}
+	b.watchesMutex.Unlock()
+
+	var once sync.Once
+	return w.ch, func() {
+		once.Do(func() {
+			b.watchesMutex.Lock()
+			defer b.watchesMutex.Unlock()
+			delete(b.keyWatches, w)
+			close(w.ch)
+		})
+	}
+}
+
+// WatchPrefix implements keyvaluestore.ObservableBackend. Only changes made within the process are
+// observed. Changed keys are queued until they're received, so writers are never blocked.
+func (b *Backend) WatchPrefix(prefix string) (<-chan string, func(), error) {
+	w := &prefixWatch{
+		prefix:   prefix,
+		signal:   make(chan struct{}, 1),
+		isQueued: map[string]struct{}{},
+	}
+
+	b.watchesMutex.Lock()
+	if b.prefixWatches == nil {
+		b.prefixWatches = map[*prefixWatch]struct{}{}
+	}
+	b.prefixWatches[w] = struct{}{}
+	b.watchesMutex.Unlock()
+
+	ch := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case <-w.signal:
+			case <-done:
+				return
+			}
+			for _, key := range w.take() {
+				select {
+				case ch <- key:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.watchesMutex.Lock()
+			delete(b.prefixWatches, w)
+			b.watchesMutex.Unlock()
+			close(done)
+		})
+	}, nil
+}
@@ -0,0 +1,34 @@
+package keyvaluestore
+
+// Middleware wraps a backend with additional behavior, such as key prefixing, caching, or metrics.
+// Packages that provide wrappers offer middlewares for them, e.g. keyvaluestorenamespace.Middleware.
+//
+// The wrapping backend's Unwrap method must return the backend it was given so that the whole
+// chain can be walked.
+type Middleware interface {
+	Wrap(b Backend) Backend
+}
+
+// MiddlewareFunc adapts a function to the Middleware interface.
+type MiddlewareFunc func(b Backend) Backend
+
+func (f MiddlewareFunc) Wrap(b Backend) Backend {
+	return f(b)
+}
+
+// Chain wraps the backend with the given middlewares. The first middleware is the outermost, so it
+// sees each operation first. For example, the following caches reads of the prefixed keys:
+//
+//	keyvaluestore.Chain(backend,
+//	    keyvaluestorecache.ReadCacheMiddleware(),
+//	    keyvaluestorenamespace.Middleware("myfeature:"),
+//	)
+//
+// Calling Unwrap on the result returns the backend wrapped by the second middleware, and so on
+// until the given backend is reached.
+func Chain(b Backend, middlewares ...Middleware) Backend {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		b = middlewares[i].Wrap(b)
+	}
+	return b
+}
@@ -0,0 +1,51 @@
+package keyvaluestore_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorecache"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorenamespace"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorestats"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestChain(t *testing.T) {
+	underlying := memorystore.NewBackend()
+	stats := &keyvaluestorestats.Stats{}
+	b := keyvaluestore.Chain(underlying,
+		keyvaluestorecache.ReadCacheMiddleware(),
+		keyvaluestorenamespace.Middleware("ns:"),
+		keyvaluestorestats.Middleware(stats),
+	)
+
+	require.NoError(t, b.Set("foo", "bar"))
+	for i := 0; i < 2; i++ {
+		v, err := b.Get("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", *v)
+	}
+
+	v, err := underlying.Get("ns:foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", *v)
+
+	// The second read is served by the cache, so only one reaches the stats.
+	assert.EqualValues(t, 1, stats.Operations()["Get"].Count)
+
+	// Unwrap walks through the chain in order.
+	var layers []keyvaluestore.Backend
+	for layer := b; layer != nil; layer = layer.Unwrap() {
+		layers = append(layers, layer)
+	}
+	require.Len(t, layers, 4)
+	assert.IsType(t, &keyvaluestorecache.ReadCache{}, layers[0])
+	assert.IsType(t, &keyvaluestorenamespace.Backend{}, layers[1])
+	assert.IsType(t, &keyvaluestorestats.Backend{}, layers[2])
+	assert.Equal(t, underlying, layers[3])
+
+	assert.Equal(t, underlying, keyvaluestore.Chain(underlying))
+}
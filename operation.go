@@ -0,0 +1,111 @@
+package keyvaluestore
+
+// Operation describes a method that operates on the key given by its first argument. Wrappers such
+// as caches, invalidators, and profilers can consult Operations instead of maintaining their own
+// lists of methods, and their tests can use it to verify that every method is handled. For
+// example, keyvaluestoretest.TestInvalidation verifies that a wrapper invalidates keys for every
+// write operation.
+type Operation struct {
+	// Name is the name of the method, e.g. "ZHAdd".
+	Name string
+
+	// Write is true if the operation may modify the key.
+	Write bool
+}
+
+// Operations describes every single-key method of Backend as well as those of the optional
+// interfaces in this package. New methods must be added here.
+var Operations = []Operation{
+	{Name: "Delete", Write: true},
+	{Name: "Get"},
+	{Name: "Set", Write: true},
+	{Name: "SetXX", Write: true},
+	{Name: "SetNX", Write: true},
+	{Name: "SetEQ", Write: true},
+	{Name: "NIncrBy", Write: true},
+	{Name: "SAdd", Write: true},
+	{Name: "SRem", Write: true},
+	{Name: "SMembers"},
+	{Name: "HSet", Write: true},
+	{Name: "HDel", Write: true},
+	{Name: "HGet"},
+	{Name: "HGetAll"},
+	{Name: "ZAdd", Write: true},
+	{Name: "ZScore"},
+	{Name: "ZRem", Write: true},
+	{Name: "ZIncrBy", Write: true},
+	{Name: "ZRangeByScore"},
+	{Name: "ZRangeByScoreWithScores"},
+	{Name: "ZRevRangeByScore"},
+	{Name: "ZRevRangeByScoreWithScores"},
+	{Name: "ZCount"},
+	{Name: "ZLexCount"},
+	{Name: "ZRangeByLex"},
+	{Name: "ZRevRangeByLex"},
+	{Name: "ZHAdd", Write: true},
+	{Name: "ZHMAdd", Write: true},
+	{Name: "ZHRem", Write: true},
+	{Name: "ZHRemEQ", Write: true},
+	{Name: "ZHRangeByScore"},
+	{Name: "ZHRangeByScoreWithScores"},
+	{Name: "ZHRevRangeByScore"},
+	{Name: "ZHRevRangeByScoreWithScores"},
+	{Name: "ZHRangeByLex"},
+	{Name: "ZHRevRangeByLex"},
+
+	// Expirer
+	{Name: "ExpireAt", Write: true},
+
+	// TTLGetter
+	{Name: "TTL"},
+
+	// Updater
+	{Name: "Update", Write: true},
+
+	// EntryGetter
+	{Name: "GetEntry"},
+
+	// SortedHashFieldRanger
+	{Name: "ZHRangeByScoreWithFields"},
+	{Name: "ZHRevRangeByScoreWithFields"},
+	{Name: "ZHRangeByLexWithFields"},
+	{Name: "ZHRevRangeByLexWithFields"},
+
+	// ScoreRanger
+	{Name: "ZCountRange"},
+	{Name: "ZRangeByScoreRange"},
+	{Name: "ZRangeByScoreRangeWithScores"},
+	{Name: "ZRevRangeByScoreRange"},
+	{Name: "ZRevRangeByScoreRangeWithScores"},
+	{Name: "ZHRangeByScoreRange"},
+	{Name: "ZHRangeByScoreRangeWithScores"},
+	{Name: "ZHRevRangeByScoreRange"},
+	{Name: "ZHRevRangeByScoreRangeWithScores"},
+
+	// PageTokenRanger
+	{Name: "ZRangeByScoreAfter"},
+	{Name: "ZRevRangeByScoreAfter"},
+	{Name: "ZHRangeByScoreWithFieldsAfter"},
+	{Name: "ZHRevRangeByScoreWithFieldsAfter"},
+}
+
+var operationsByName = func() map[string]Operation {
+	ret := make(map[string]Operation, len(Operations))
+	for _, op := range Operations {
+		ret[op.Name] = op
+	}
+	return ret
+}()
+
+// LookupOperation returns the operation with the given method name.
+func LookupOperation(name string) (Operation, bool) {
+	op, ok := operationsByName[name]
+	return op, ok
+}
+
+// IsWriteOperation returns true if the method with the given name may modify its key. Unknown
+// methods are assumed to be writes so that wrappers err on the side of invalidation.
+func IsWriteOperation(name string) bool {
+	op, ok := operationsByName[name]
+	return !ok || op.Write
+}
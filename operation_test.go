@@ -0,0 +1,41 @@
+package keyvaluestore
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperations(t *testing.T) {
+	interfaces := []reflect.Type{
+		reflect.TypeOf((*Backend)(nil)).Elem(),
+		reflect.TypeOf((*Expirer)(nil)).Elem(),
+		reflect.TypeOf((*TTLGetter)(nil)).Elem(),
+		reflect.TypeOf((*Updater)(nil)).Elem(),
+		reflect.TypeOf((*EntryGetter)(nil)).Elem(),
+		reflect.TypeOf((*SortedHashFieldRanger)(nil)).Elem(),
+		reflect.TypeOf((*ScoreRanger)(nil)).Elem(),
+		reflect.TypeOf((*PageTokenRanger)(nil)).Elem(),
+	}
+
+	methods := map[string]bool{}
+	for _, iface := range interfaces {
+		for i := 0; i < iface.NumMethod(); i++ {
+			m := iface.Method(i)
+			methods[m.Name] = true
+			if m.Type.NumIn() > 0 && m.Type.In(0).Kind() == reflect.String {
+				_, ok := LookupOperation(m.Name)
+				assert.True(t, ok, "%v.%v is missing from Operations", iface.Name(), m.Name)
+			}
+		}
+	}
+
+	for _, op := range Operations {
+		assert.True(t, methods[op.Name], "%v isn't a method of any interface", op.Name)
+	}
+
+	assert.True(t, IsWriteOperation("ZHRem"))
+	assert.False(t, IsWriteOperation("ZHRangeByLex"))
+	assert.True(t, IsWriteOperation("Unknown"))
+}
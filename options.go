@@ -0,0 +1,67 @@
+package keyvaluestore
+
+import "time"
+
+// Consistency is the read consistency requested via RequestOptions.
+type Consistency int
+
+const (
+	// DefaultConsistency leaves the backend's read consistency unchanged.
+	DefaultConsistency Consistency = iota
+
+	// EventualConsistency allows reads to return stale data, which may be cheaper or faster. It's
+	// equivalent to WithEventuallyConsistentReads.
+	EventualConsistency
+
+	// StrongConsistency requires reads to reflect all previously completed writes, even if the
+	// backend was previously configured for eventually consistent reads.
+	StrongConsistency
+)
+
+// RequestOptions modify how a backend performs requests. Zero values leave the backend's behavior
+// unchanged.
+type RequestOptions struct {
+	Consistency Consistency
+
+	// Timeout limits the time each operation may take. Backends that can't enforce timeouts on
+	// individual requests ignore it.
+	Timeout time.Duration
+
+	// Deadline limits the total time operations may take, including all of their internal
+	// requests, retries, and pagination, e.g. a batch's retries of unprocessed keys or a
+	// transaction's retries after conflicts. Unlike Timeout, the budget isn't renewed for each
+	// request, so it can be used to bound a batch or atomic write by a caller's SLA:
+	//
+	//	batch := keyvaluestore.WithOptions(backend, keyvaluestore.RequestOptions{
+	//		Deadline: time.Now().Add(100 * time.Millisecond),
+	//	}).Batch()
+	//
+	// Operations that exceed it fail with an error that matches context.DeadlineExceeded. Backends
+	// that can't enforce deadlines ignore it.
+	Deadline time.Time
+}
+
+// OptionsBackend is implemented by backends that support per-request options.
+type OptionsBackend interface {
+	// WithOptions returns a backend that applies the given options to all of its requests. The
+	// receiver is not modified.
+	WithOptions(opts RequestOptions) Backend
+}
+
+// WithOptions returns a backend that applies the given options to all of its requests. This makes
+// it cheap to scope options to individual calls:
+//
+//	v, err := keyvaluestore.WithOptions(backend, keyvaluestore.RequestOptions{
+//		Timeout: time.Second,
+//	}).Get("foo")
+//
+// If the backend doesn't implement OptionsBackend, eventual consistency is requested via
+// WithEventuallyConsistentReads and all other options are ignored.
+func WithOptions(b Backend, opts RequestOptions) Backend {
+	if ob, ok := b.(OptionsBackend); ok {
+		return ob.WithOptions(opts)
+	} else if opts.Consistency == EventualConsistency {
+		return b.WithEventuallyConsistentReads()
+	}
+	return b
+}
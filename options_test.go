@@ -0,0 +1,35 @@
+package keyvaluestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type consistencyRecordingBackend struct {
+	Backend
+	eventuallyConsistent bool
+}
+
+func (b consistencyRecordingBackend) WithEventuallyConsistentReads() Backend {
+	b.eventuallyConsistent = true
+	return &b
+}
+
+func TestWithOptions(t *testing.T) {
+	b := &consistencyRecordingBackend{}
+
+	t.Run("Fallback", func(t *testing.T) {
+		eventual := WithOptions(b, RequestOptions{
+			Consistency: EventualConsistency,
+		})
+		assert.True(t, eventual.(*consistencyRecordingBackend).eventuallyConsistent)
+		assert.False(t, b.eventuallyConsistent)
+
+		assert.Equal(t, b, WithOptions(b, RequestOptions{
+			Consistency: StrongConsistency,
+			Timeout:     time.Second,
+		}))
+	})
+}
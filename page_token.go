@@ -0,0 +1,220 @@
+package keyvaluestore
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// ErrInvalidPageToken is returned when parsing a page token that wasn't produced by
+// PageToken.String.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// PageToken is a position in a sorted set or sorted hash that a range can be continued from. Within
+// a sorted set, members with equal scores are ordered by member, and within a sorted hash they're
+// ordered by field, so a score and member (or field) identify a position exactly even when many
+// members share a score.
+//
+// Its string form is independent of the backend, so it can be handed to clients as an opaque cursor
+// and remains valid if the data is migrated to a different backend.
+type PageToken struct {
+	Score float64
+
+	// Member is the member for sorted sets or the field for sorted hashes.
+	Member string
+}
+
+// PageToken returns a token for the position immediately after the member. It should only be used
+// with sorted sets. For sorted hashes, use FieldScoredMember.PageToken.
+func (m *ScoredMember) PageToken() PageToken {
+	return PageToken{
+		Score:  m.Score,
+		Member: m.Value,
+	}
+}
+
+// PageToken returns a token for the position immediately after the member.
+func (m *FieldScoredMember) PageToken() PageToken {
+	return PageToken{
+		Score:  m.Score,
+		Member: m.Field,
+	}
+}
+
+// String encodes the token as URL-safe base64.
+func (t PageToken) String() string {
+	buf := make([]byte, 8+len(t.Member))
+	binary.BigEndian.PutUint64(buf, math.Float64bits(t.Score))
+	copy(buf[8:], t.Member)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// ParsePageToken parses a token produced by PageToken.String. If it's malformed, an error matching
+// ErrInvalidPageToken is returned.
+func ParsePageToken(s string) (PageToken, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(buf) < 8 {
+		return PageToken{}, ErrInvalidPageToken
+	}
+	score := math.Float64frombits(binary.BigEndian.Uint64(buf))
+	if math.IsNaN(score) {
+		return PageToken{}, ErrInvalidPageToken
+	}
+	return PageToken{
+		Score:  score,
+		Member: string(buf[8:]),
+	}, nil
+}
+
+// PageTokenRanger is implemented by backends that can natively continue ranges from a PageToken.
+// Backends that don't implement it can still be used with helpers such as ZRangeByScoreAfter.
+type PageTokenRanger interface {
+	// ZRangeByScoreAfter gets members (and their scores) of a sorted set that come after the token
+	// by ascending score, up to a maximum score of max.
+	ZRangeByScoreAfter(key string, after PageToken, max float64, limit int) (ScoredMembers, error)
+
+	// ZRevRangeByScoreAfter gets members (and their scores) of a sorted set that come after the
+	// token by descending score, down to a minimum score of min.
+	ZRevRangeByScoreAfter(key string, after PageToken, min float64, limit int) (ScoredMembers, error)
+
+	// ZHRangeByScoreWithFieldsAfter gets members (and their fields and scores) of a sorted hash that
+	// come after the token by ascending score, up to a maximum score of max.
+	ZHRangeByScoreWithFieldsAfter(key string, after PageToken, max float64, limit int) (FieldScoredMembers, error)
+
+	// ZHRevRangeByScoreWithFieldsAfter gets members (and their fields and scores) of a sorted hash
+	// that come after the token by descending score, down to a minimum score of min.
+	ZHRevRangeByScoreWithFieldsAfter(key string, after PageToken, min float64, limit int) (FieldScoredMembers, error)
+}
+
+// ZRangeByScoreAfter gets members (and their scores) of a sorted set that come after the token by
+// ascending score, up to a maximum score of max. The first page can be read with
+// ZRangeByScoreWithScores, and each subsequent page continues from the PageToken of the last member
+// of the previous one:
+//
+//	members, err := keyvaluestore.ZRangeByScoreAfter(backend, "timeline", after, math.Inf(1), 100)
+//	if len(members) > 0 {
+//		next = members[len(members)-1].PageToken().String()
+//	}
+//
+// If the backend doesn't implement PageTokenRanger, members with the token's score are read and
+// skipped until the token is passed. This is cheap unless a huge number of members share the score.
+func ZRangeByScoreAfter(b Backend, key string, after PageToken, max float64, limit int) (ScoredMembers, error) {
+	if r, ok := b.(PageTokenRanger); ok {
+		return r.ZRangeByScoreAfter(key, after, max, limit)
+	}
+	members, err := rangeAfter(after, limit, false, func(limit int) (FieldScoredMembers, error) {
+		members, err := b.ZRangeByScoreWithScores(key, after.Score, max, limit)
+		return sortedSetFieldScoredMembers(members), err
+	})
+	return scoredMembers(members), err
+}
+
+// ZRevRangeByScoreAfter is like ZRangeByScoreAfter, but by descending score, down to a minimum
+// score of min.
+func ZRevRangeByScoreAfter(b Backend, key string, after PageToken, min float64, limit int) (ScoredMembers, error) {
+	if r, ok := b.(PageTokenRanger); ok {
+		return r.ZRevRangeByScoreAfter(key, after, min, limit)
+	}
+	members, err := rangeAfter(after, limit, true, func(limit int) (FieldScoredMembers, error) {
+		members, err := b.ZRevRangeByScoreWithScores(key, min, after.Score, limit)
+		return sortedSetFieldScoredMembers(members), err
+	})
+	return scoredMembers(members), err
+}
+
+// ZHRangeByScoreWithFieldsAfter is like ZRangeByScoreAfter, but for sorted hashes. Tokens are
+// produced by FieldScoredMember.PageToken. If the backend implements neither PageTokenRanger nor
+// SortedHashFieldRanger, an error wrapping ErrNotSupported is returned.
+func ZHRangeByScoreWithFieldsAfter(b Backend, key string, after PageToken, max float64, limit int) (FieldScoredMembers, error) {
+	if r, ok := b.(PageTokenRanger); ok {
+		return r.ZHRangeByScoreWithFieldsAfter(key, after, max, limit)
+	}
+	r, err := sortedHashFieldRanger(b)
+	if err != nil {
+		return nil, err
+	}
+	return rangeAfter(after, limit, false, func(limit int) (FieldScoredMembers, error) {
+		return r.ZHRangeByScoreWithFields(key, after.Score, max, limit)
+	})
+}
+
+// ZHRevRangeByScoreWithFieldsAfter is like ZHRangeByScoreWithFieldsAfter, but by descending score,
+// down to a minimum score of min.
+func ZHRevRangeByScoreWithFieldsAfter(b Backend, key string, after PageToken, min float64, limit int) (FieldScoredMembers, error) {
+	if r, ok := b.(PageTokenRanger); ok {
+		return r.ZHRevRangeByScoreWithFieldsAfter(key, after, min, limit)
+	}
+	r, err := sortedHashFieldRanger(b)
+	if err != nil {
+		return nil, err
+	}
+	return rangeAfter(after, limit, true, func(limit int) (FieldScoredMembers, error) {
+		return r.ZHRevRangeByScoreWithFields(key, min, after.Score, limit)
+	})
+}
+
+// rangeAfter reads members via f, which returns up to limit members starting with the token's
+// score, and skips those that aren't after the token. If every member read is skipped, it reads
+// again with a larger limit.
+func rangeAfter(after PageToken, limit int, reverse bool, f func(limit int) (FieldScoredMembers, error)) (FieldScoredMembers, error) {
+	isAfter := func(m *FieldScoredMember) bool {
+		if m.Score != after.Score {
+			return true
+		} else if reverse {
+			return m.Field < after.Member
+		}
+		return m.Field > after.Member
+	}
+
+	readLimit := limit
+	for {
+		members, err := f(readLimit)
+		if err != nil {
+			return nil, err
+		}
+		skipped := 0
+		for skipped < len(members) && !isAfter(members[skipped]) {
+			skipped++
+		}
+		if readLimit <= 0 || len(members) < readLimit || len(members)-skipped >= limit {
+			members = members[skipped:]
+			if limit > 0 && len(members) > limit {
+				members = members[:limit]
+			}
+			return members, nil
+		}
+		if readLimit *= 2; readLimit < skipped+limit {
+			readLimit = skipped + limit
+		}
+	}
+}
+
+func sortedSetFieldScoredMembers(members ScoredMembers) FieldScoredMembers {
+	if members == nil {
+		return nil
+	}
+	ret := make(FieldScoredMembers, len(members))
+	for i, m := range members {
+		ret[i] = &FieldScoredMember{
+			Field: m.Value,
+			Value: m.Value,
+			Score: m.Score,
+		}
+	}
+	return ret
+}
+
+func scoredMembers(members FieldScoredMembers) ScoredMembers {
+	if members == nil {
+		return nil
+	}
+	ret := make(ScoredMembers, len(members))
+	for i, m := range members {
+		ret[i] = &ScoredMember{
+			Score: m.Score,
+			Value: m.Value,
+		}
+	}
+	return ret
+}
@@ -0,0 +1,58 @@
+package keyvaluestore
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageToken(t *testing.T) {
+	for _, token := range []PageToken{
+		{},
+		{Score: -1.5, Member: "foo"},
+		{Score: math.Inf(1), Member: "\x00bar"},
+	} {
+		parsed, err := ParsePageToken(token.String())
+		require.NoError(t, err)
+		assert.Equal(t, token, parsed)
+	}
+
+	for _, s := range []string{"", "AAAA", "not base64!", PageToken{Score: math.NaN()}.String()} {
+		_, err := ParsePageToken(s)
+		assert.True(t, errors.Is(err, ErrInvalidPageToken), s)
+	}
+}
+
+func TestRangeAfter(t *testing.T) {
+	var members FieldScoredMembers
+	for _, field := range []string{"a", "b", "c", "d", "e", "f"} {
+		members = append(members, &FieldScoredMember{Field: field, Score: 1})
+	}
+	members = append(members, &FieldScoredMember{Field: "a", Score: 2})
+
+	reads := 0
+	read := func(limit int) (FieldScoredMembers, error) {
+		reads++
+		if limit > 0 && limit < len(members) {
+			return members[:limit], nil
+		}
+		return members, nil
+	}
+
+	result, err := rangeAfter(PageToken{Score: 1, Member: "e"}, 2, false, read)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"f", "a"}, result.Fields())
+	assert.Equal(t, 3, reads)
+
+	result, err = rangeAfter(PageToken{Score: 1, Member: "b"}, 0, false, read)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "d", "e", "f", "a"}, result.Fields())
+
+	result, err = rangeAfter(PageToken{Score: 1, Member: "f"}, 2, false, read)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, result.Fields())
+	assert.Equal(t, 2.0, result[0].Score)
+}
@@ -0,0 +1,172 @@
+package keyvaluestore
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Profile describes a single request made by a backend to its underlying store.
+type Profile struct {
+	// Operation is the name of the underlying request, e.g. "GetItem" for DynamoDB or "get" for
+	// Redis. Names are backend-specific.
+	Operation string
+
+	// Key is the key that the request targets. It's empty if the request doesn't target a single
+	// key or the backend can't determine it.
+	Key string
+
+	Duration time.Duration
+	Err      error
+
+	// Commands contains the names of the commands in a pipelined request, such as a Redis
+	// pipeline.
+	Commands []string
+
+	// ReadCapacity and WriteCapacity are the capacity units consumed by the request, for stores
+	// such as DynamoDB that report them.
+	ReadCapacity  float64
+	WriteCapacity float64
+
+	// RequestBytes and ResponseBytes are the approximate sizes of the keys, values, fields, and
+	// members sent to and received from the store. Protocol overhead isn't included. ResponseItems
+	// is the number of elements returned by requests that return collections, such as the members
+	// of a sorted set range or the items of a DynamoDB query. Backends that can't determine them
+	// leave them zero.
+	RequestBytes  int
+	ResponseBytes int
+	ResponseItems int
+
+	// Retries is the number of times an operation was retried, e.g. due to contention. Backends
+	// that retry operations report them via profiles whose Operation is the name of the method
+	// that was retried, such as "ZIncrBy".
+	Retries int
+
+	// Hedges is the number of additional requests issued to hedge a slow or failed operation, e.g.
+	// by keyvaluestorehedge. Hedging wrappers report them via profiles whose Operation is the name
+	// of the method that was hedged.
+	Hedges int
+
+	// Conflicts is the number of times an operation failed with an AtomicWriteConflictError, e.g.
+	// because an atomic write conflicted with a concurrent one. The profile's Err is the conflict
+	// error.
+	Conflicts int
+
+	// SampleRate is the fraction of requests that are profiled if the profile was sampled, e.g. by
+	// SampledProfiler. It's zero if every request is profiled. Aggregators can divide by it to
+	// estimate totals.
+	SampleRate float64
+
+	// Metadata contains backend-specific information that doesn't have a dedicated field. For
+	// compatibility, it also contains the consumed capacity of DynamoDB requests and the commands of
+	// Redis pipelines.
+	Metadata map[string]interface{}
+}
+
+// Profiler receives profiles from backends. Any backend's WithProfiler method accepts a Profiler,
+// so a single metrics integration works regardless of the store behind the Backend interface.
+// Backends that don't make requests to an underlying store, such as memorystore, ignore it.
+type Profiler interface {
+	AddProfile(profile *Profile)
+}
+
+// Sampler is implemented by profilers that only want to receive a fraction of profiles. Backends
+// consult it before profiling each request so that unsampled requests incur almost no overhead.
+type Sampler interface {
+	// Sample returns true if the next request should be profiled.
+	Sample() bool
+}
+
+// ShouldProfile returns true unless the profiler is a Sampler that doesn't want the next request
+// profiled. Backends invoke it once per request before building a profile.
+func ShouldProfile(p Profiler) bool {
+	if s, ok := p.(Sampler); ok {
+		return s.Sample()
+	}
+	return true
+}
+
+// SampledProfiler forwards a fraction of profiles to another profiler, which allows high-QPS
+// services to keep instrumentation enabled at all times. Sampling is deterministic: with a rate of
+// 0.01, exactly one of every 100 requests is profiled.
+//
+// The sampling decision is made by Sample, which backends invoke via ShouldProfile. AddProfile
+// forwards every profile it's given, so callers that produce profiles themselves should also use
+// ShouldProfile.
+type SampledProfiler struct {
+	Profiler Profiler
+
+	// Rate is the fraction of requests to profile, between 0 and 1.
+	Rate float64
+
+	count uint64
+}
+
+var _ Profiler = (*SampledProfiler)(nil)
+var _ Sampler = (*SampledProfiler)(nil)
+
+func (p *SampledProfiler) Sample() bool {
+	if p.Rate >= 1 {
+		return true
+	} else if p.Rate <= 0 {
+		return false
+	}
+	n := atomic.AddUint64(&p.count, 1)
+	// Sample whenever n * Rate crosses an integer.
+	return math.Floor(float64(n)*p.Rate) != math.Floor(float64(n-1)*p.Rate)
+}
+
+func (p *SampledProfiler) AddProfile(profile *Profile) {
+	if p.Rate < 1 {
+		profile.SampleRate = p.Rate
+	}
+	p.Profiler.AddProfile(profile)
+}
+
+// BasicProfiler aggregates request counts and durations, along with the retries, hedges, and
+// conflicts that backends and wrappers report. It's safe for concurrent use.
+type BasicProfiler struct {
+	requestCount       int64
+	errorCount         int64
+	requestNanoseconds int64
+	retryCount         int64
+	hedgeCount         int64
+	conflictCount      int64
+}
+
+var _ Profiler = (*BasicProfiler)(nil)
+
+func (p *BasicProfiler) AddProfile(profile *Profile) {
+	atomic.AddInt64(&p.requestCount, 1)
+	if profile.Err != nil {
+		atomic.AddInt64(&p.errorCount, 1)
+	}
+	atomic.AddInt64(&p.requestNanoseconds, int64(profile.Duration/time.Nanosecond))
+	atomic.AddInt64(&p.retryCount, int64(profile.Retries))
+	atomic.AddInt64(&p.hedgeCount, int64(profile.Hedges))
+	atomic.AddInt64(&p.conflictCount, int64(profile.Conflicts))
+}
+
+func (p *BasicProfiler) RequestCount() int {
+	return int(atomic.LoadInt64(&p.requestCount))
+}
+
+func (p *BasicProfiler) ErrorCount() int {
+	return int(atomic.LoadInt64(&p.errorCount))
+}
+
+func (p *BasicProfiler) RequestDuration() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.requestNanoseconds)) * time.Nanosecond
+}
+
+func (p *BasicProfiler) RetryCount() int {
+	return int(atomic.LoadInt64(&p.retryCount))
+}
+
+func (p *BasicProfiler) HedgeCount() int {
+	return int(atomic.LoadInt64(&p.hedgeCount))
+}
+
+func (p *BasicProfiler) ConflictCount() int {
+	return int(atomic.LoadInt64(&p.conflictCount))
+}
@@ -0,0 +1,55 @@
+package keyvaluestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type profilesRecorder struct {
+	profiles []*Profile
+}
+
+func (r *profilesRecorder) AddProfile(profile *Profile) {
+	r.profiles = append(r.profiles, profile)
+}
+
+func TestSampledProfiler(t *testing.T) {
+	recorder := &profilesRecorder{}
+	p := &SampledProfiler{
+		Profiler: recorder,
+		Rate:     0.25,
+	}
+
+	for i := 0; i < 100; i++ {
+		if ShouldProfile(p) {
+			p.AddProfile(&Profile{Operation: "get"})
+		}
+	}
+	assert.Len(t, recorder.profiles, 25)
+	assert.Equal(t, 0.25, recorder.profiles[0].SampleRate)
+
+	p.Rate = 0
+	assert.False(t, ShouldProfile(p))
+
+	p.Rate = 1
+	assert.True(t, ShouldProfile(p))
+
+	assert.True(t, ShouldProfile(recorder))
+}
+
+func TestBasicProfiler(t *testing.T) {
+	p := &BasicProfiler{}
+	p.AddProfile(&Profile{Operation: "get", Duration: time.Second})
+	p.AddProfile(&Profile{Operation: "Get", Hedges: 1})
+	p.AddProfile(&Profile{Operation: "ZIncrBy", Retries: 2})
+	p.AddProfile(&Profile{Operation: "AtomicWrite", Conflicts: 1, Err: &AtomicWriteConflictError{}})
+
+	assert.Equal(t, 4, p.RequestCount())
+	assert.Equal(t, 1, p.ErrorCount())
+	assert.Equal(t, time.Second, p.RequestDuration())
+	assert.Equal(t, 2, p.RetryCount())
+	assert.Equal(t, 1, p.HedgeCount())
+	assert.Equal(t, 1, p.ConflictCount())
+}
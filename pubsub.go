@@ -0,0 +1,25 @@
+package keyvaluestore
+
+// Publisher is implemented by backends that can broadcast messages to other processes.
+type Publisher interface {
+	// Publish sends the message to everyone subscribed to the channel. Delivery is best-effort:
+	// only current subscribers receive the message, and it may be lost if the transport fails.
+	Publish(channel, message string) error
+}
+
+// Subscriber is implemented by backends that can receive messages broadcast via Publisher.
+type Subscriber interface {
+	// Subscribe returns a Go channel that receives the messages published to the given channel
+	// until the returned function is invoked, at which point the Go channel is closed. Messages
+	// published after Subscribe returns are guaranteed to be delivered if the transport doesn't
+	// fail.
+	Subscribe(channel string) (<-chan string, func(), error)
+}
+
+// PubSub is implemented by backends that can both publish and subscribe. memorystore.Backend and
+// redisstore.Backend implement it directly, and dynamodbstore.PubSub implements it via DynamoDB
+// Streams.
+type PubSub interface {
+	Publisher
+	Subscriber
+}
@@ -12,7 +12,16 @@ import (
 type AtomicWriteOperation struct {
 	Client *redis.Client
 
-	operations []*atomicWriteOperation
+	bucketing *KeyBucketing
+
+	operations       []*atomicWriteOperation
+	idempotencyToken string
+}
+
+// idempotencyTokenKey is the key used to remember a successful atomic write's idempotency token.
+// Applications shouldn't use keys with the "_idempotency:" prefix.
+func idempotencyTokenKey(token string) string {
+	return "_idempotency:" + token
 }
 
 type atomicWriteOperation struct {
@@ -21,6 +30,10 @@ type atomicWriteOperation struct {
 	write     string
 	args      []interface{}
 
+	// If returnsValue is true, write is an expression whose integer value is returned by Exec.
+	returnsValue bool
+	value        *int64
+
 	conditionPassed bool
 }
 
@@ -33,7 +46,29 @@ func (op *AtomicWriteOperation) write(wOp *atomicWriteOperation) keyvaluestore.A
 	return wOp
 }
 
+// bucketedWrite returns the operation for a plain string write to a bucketed key, or nil if the key
+// isn't bucketed. The bucket is @0, the key is @1, and the key as the bucket's field is $0, so the
+// given args begin at $1.
+func (op *AtomicWriteOperation) bucketedWrite(key, condition, write string, args ...interface{}) *atomicWriteOperation {
+	bucket := op.bucketing.bucket(key)
+	if bucket == "" {
+		return nil
+	}
+	return &atomicWriteOperation{
+		keys:      []string{bucket, key},
+		condition: condition,
+		write:     write,
+		args:      append([]interface{}{key}, args...),
+	}
+}
+
+// bucketedExists is the condition that a bucketed key exists as a plain string or any other type.
+const bucketedExists = "(redis.call('hexists', @0, $0) == 1 or redis.call('exists', @1) == 1)"
+
 func (op *AtomicWriteOperation) Set(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	if wOp := op.bucketedWrite(key, "true", "redis.call('del', @1)\nredis.call('hset', @0, $0, $1)", value); wOp != nil {
+		return op.write(wOp)
+	}
 	return op.write(&atomicWriteOperation{
 		keys:      []string{key},
 		condition: "true",
@@ -43,6 +78,9 @@ func (op *AtomicWriteOperation) Set(key string, value interface{}) keyvaluestore
 }
 
 func (op *AtomicWriteOperation) SetNX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	if wOp := op.bucketedWrite(key, "not "+bucketedExists, "redis.call('hset', @0, $0, $1)", value); wOp != nil {
+		return op.write(wOp)
+	}
 	return op.write(&atomicWriteOperation{
 		keys:      []string{key},
 		condition: "redis.call('exists', @0) == 0",
@@ -52,6 +90,9 @@ func (op *AtomicWriteOperation) SetNX(key string, value interface{}) keyvaluesto
 }
 
 func (op *AtomicWriteOperation) SetXX(key string, value interface{}) keyvaluestore.AtomicWriteResult {
+	if wOp := op.bucketedWrite(key, bucketedExists, "redis.call('del', @1)\nredis.call('hset', @0, $0, $1)", value); wOp != nil {
+		return op.write(wOp)
+	}
 	return op.write(&atomicWriteOperation{
 		keys:      []string{key},
 		condition: "redis.call('exists', @0) == 1",
@@ -61,6 +102,9 @@ func (op *AtomicWriteOperation) SetXX(key string, value interface{}) keyvaluesto
 }
 
 func (op *AtomicWriteOperation) SetEQ(key string, value, oldValue interface{}) keyvaluestore.AtomicWriteResult {
+	if wOp := op.bucketedWrite(key, "redis.call('hget', @0, $0) == $1", "redis.call('hset', @0, $0, $2)", oldValue, value); wOp != nil {
+		return op.write(wOp)
+	}
 	return op.write(&atomicWriteOperation{
 		keys:      []string{key},
 		condition: "redis.call('get', @0) == $0",
@@ -70,6 +114,9 @@ func (op *AtomicWriteOperation) SetEQ(key string, value, oldValue interface{}) k
 }
 
 func (op *AtomicWriteOperation) Delete(key string) keyvaluestore.AtomicWriteResult {
+	if wOp := op.bucketedWrite(key, "true", "redis.call('hdel', @0, $0)\nredis.call('del', @1)"); wOp != nil {
+		return op.write(wOp)
+	}
 	return op.write(&atomicWriteOperation{
 		keys:      []string{key},
 		condition: "true",
@@ -78,6 +125,9 @@ func (op *AtomicWriteOperation) Delete(key string) keyvaluestore.AtomicWriteResu
 }
 
 func (op *AtomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteResult {
+	if wOp := op.bucketedWrite(key, bucketedExists, "redis.call('hdel', @0, $0)\nredis.call('del', @1)"); wOp != nil {
+		return op.write(wOp)
+	}
 	return op.write(&atomicWriteOperation{
 		keys:      []string{key},
 		condition: "redis.call('exists', @0) == 1",
@@ -85,13 +135,30 @@ func (op *AtomicWriteOperation) DeleteXX(key string) keyvaluestore.AtomicWriteRe
 	})
 }
 
+type nincrByResult struct {
+	*atomicWriteOperation
+}
+
+func (r nincrByResult) Value() (int64, bool) {
+	if r.value == nil {
+		return 0, false
+	}
+	return *r.value, true
+}
+
 func (op *AtomicWriteOperation) NIncrBy(key string, n int64) keyvaluestore.AtomicWriteResult {
-	return op.write(&atomicWriteOperation{
-		keys:      []string{key},
-		condition: "true",
-		write:     "redis.call('incrby', @0, $0)",
-		args:      []interface{}{n},
-	})
+	wOp := op.bucketedWrite(key, "true", "redis.call('hincrby', @0, $0, $1)", n)
+	if wOp == nil {
+		wOp = &atomicWriteOperation{
+			keys:      []string{key},
+			condition: "true",
+			write:     "redis.call('incrby', @0, $0)",
+			args:      []interface{}{n},
+		}
+	}
+	wOp.returnsValue = true
+	op.write(wOp)
+	return nincrByResult{wOp}
 }
 
 func (op *AtomicWriteOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
@@ -112,6 +179,10 @@ func (op *AtomicWriteOperation) ZHAdd(key, field string, member interface{}, sco
 	})
 }
 
+func (op *AtomicWriteOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.AtomicWriteResult {
+	return keyvaluestore.ZHMAddEach(op, key, entries)
+}
+
 func (op *AtomicWriteOperation) ZAddNX(key string, member interface{}, score float64) keyvaluestore.AtomicWriteResult {
 	return op.write(&atomicWriteOperation{
 		keys:      []string{key},
@@ -121,6 +192,16 @@ func (op *AtomicWriteOperation) ZAddNX(key string, member interface{}, score flo
 	})
 }
 
+// Members added via ZAdd aren't in the hash, so the field itself is their member.
+func (op *AtomicWriteOperation) ZHSetEQ(key, field string, member, oldMember interface{}, score float64) keyvaluestore.AtomicWriteResult {
+	return op.write(&atomicWriteOperation{
+		keys:      []string{key, zhHashKey(key)},
+		condition: "(redis.call('hget', @1, $0) or (redis.call('zscore', @0, $0) and $0)) == $3",
+		write:     "redis.call('zadd', @0, $1, $0)\nredis.call('hset', @1, $0, $2)",
+		args:      []interface{}{field, score, member, oldMember},
+	})
+}
+
 func (op *AtomicWriteOperation) ZRem(key string, member interface{}) keyvaluestore.AtomicWriteResult {
 	return op.write(&atomicWriteOperation{
 		keys:      []string{key},
@@ -139,6 +220,15 @@ func (op *AtomicWriteOperation) ZHRem(key, field string) keyvaluestore.AtomicWri
 	})
 }
 
+func (op *AtomicWriteOperation) ZHRemEQ(key, field string, member interface{}) keyvaluestore.AtomicWriteResult {
+	return op.write(&atomicWriteOperation{
+		keys:      []string{key, zhHashKey(key)},
+		condition: "(redis.call('hget', @1, $0) or (redis.call('zscore', @0, $0) and $0)) == $1",
+		write:     "redis.call('zrem', @0, $0)\nredis.call('hdel', @1, $0)",
+		args:      []interface{}{field, member},
+	})
+}
+
 func (op *AtomicWriteOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.AtomicWriteResult {
 	placeholders := make([]string, 1+len(members))
 	for i := 0; i < len(placeholders); i++ {
@@ -223,9 +313,23 @@ func preprocessAtomicWriteExpression(in string, keysOffset, numKeys int, argsOff
 	return out
 }
 
-func (op *AtomicWriteOperation) Exec() (bool, error) {
+func (op *AtomicWriteOperation) WithIdempotencyToken(token string) keyvaluestore.AtomicWriteOperation {
+	op.idempotencyToken = token
+	return op
+}
+
+func (op *AtomicWriteOperation) Validate() error {
 	if len(op.operations) > keyvaluestore.MaxAtomicWriteOperations {
-		return false, fmt.Errorf("max operation count exceeded")
+		return fmt.Errorf("max operation count exceeded")
+	} else if len(op.idempotencyToken) > keyvaluestore.MaxIdempotencyTokenLength {
+		return fmt.Errorf("idempotency token too long")
+	}
+	return nil
+}
+
+func (op *AtomicWriteOperation) Exec() (bool, error) {
+	if err := op.Validate(); err != nil {
+		return false, err
 	}
 
 	var keys []string
@@ -236,8 +340,19 @@ func (op *AtomicWriteOperation) Exec() (bool, error) {
 	for i, op := range op.operations {
 		script = append(script, fmt.Sprintf("checks[%d] = %s", i+1, preprocessAtomicWriteExpression(op.condition, len(keys), len(op.keys), len(args), len(op.args))))
 		writeExpressions[i] = preprocessAtomicWriteExpression(op.write, len(keys), len(op.keys), len(args), len(op.args))
+		if op.returnsValue {
+			// Once the checks have passed, they're only used to confirm success, so the written
+			// values can be returned in their place.
+			writeExpressions[i] = fmt.Sprintf("checks[%d] = %s", i+1, writeExpressions[i])
+		}
 		keys = append(keys, op.keys...)
-		args = append(args, op.args...)
+		for _, arg := range op.args {
+			args = append(args, redisValue(arg))
+		}
+	}
+	if op.idempotencyToken != "" {
+		keys = append(keys, idempotencyTokenKey(op.idempotencyToken))
+		script = append(script, fmt.Sprintf("if redis.call('exists', KEYS[%d]) == 1 then return 'duplicate' end", len(keys)))
 	}
 	script = append(script,
 		"for i, v in ipairs(checks) do",
@@ -247,13 +362,23 @@ func (op *AtomicWriteOperation) Exec() (bool, error) {
 		"end",
 	)
 	script = append(script, writeExpressions...)
+	if op.idempotencyToken != "" {
+		script = append(script, fmt.Sprintf("redis.call('set', KEYS[%d], 1, 'px', %d)", len(keys), keyvaluestore.IdempotencyWindow.Milliseconds()))
+	}
 	script = append(script,
 		"return checks",
 	)
 
 	result, err := op.Client.Eval(strings.Join(script, "\n"), keys, args...).Result()
 	if err != nil {
-		return false, err
+		return false, redisError(err)
+	}
+
+	if result == "duplicate" {
+		for _, op := range op.operations {
+			op.conditionPassed = true
+		}
+		return true, nil
 	}
 
 	checks, ok := result.([]interface{})
@@ -271,5 +396,12 @@ func (op *AtomicWriteOperation) Exec() (bool, error) {
 			ret = false
 		}
 	}
+	if ret {
+		for i, check := range checks {
+			if v, ok := check.(int64); ok && op.operations[i].returnsValue {
+				op.operations[i].value = &v
+			}
+		}
+	}
 	return ret, nil
 }
@@ -1,9 +1,12 @@
 package redisstore
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/go-redis/redis"
 
@@ -12,73 +15,138 @@ import (
 
 type Backend struct {
 	Client *redis.Client
+
+	// If non-nil, Logger is warned about conditions such as scripts that have to be resent because
+	// the server no longer has them cached.
+	Logger keyvaluestore.Logger
+
+	// If non-nil, KeyBucketing stores plain string values in shared hashes to save memory. It must
+	// be set before the backend is used.
+	KeyBucketing *KeyBucketing
+
+	// profiler receives retries and conflicts, which aren't visible to the client's hooks.
+	profiler keyvaluestore.Profiler
 }
 
 func (b *Backend) Batch() keyvaluestore.BatchOperation {
 	return &BatchOperation{
-		b.Client.Pipeline(),
+		client:    b.Client,
+		bucketing: b.KeyBucketing,
 	}
 }
 
 func (b *Backend) AtomicWrite() keyvaluestore.AtomicWriteOperation {
 	return &AtomicWriteOperation{
-		Client: b.Client,
+		Client:    b.Client,
+		bucketing: b.KeyBucketing,
 	}
 }
 
 func (b *Backend) Delete(key string) (bool, error) {
+	if bucket := b.KeyBucketing.bucket(key); bucket != "" {
+		n, err := b.eval(bucketDeleteScript, []string{bucket, key}, key).Int64()
+		return n > 0, redisError(err)
+	}
 	result := b.Client.Del(key)
-	return result.Val() > 0, result.Err()
+	return result.Val() > 0, redisError(result.Err())
 }
 
 func (b *Backend) Get(key string) (*string, error) {
-	v, err := b.Client.Get(key).Result()
+	var cmd *redis.StringCmd
+	if bucket := b.KeyBucketing.bucket(key); bucket != "" {
+		cmd = b.Client.HGet(bucket, key)
+	} else {
+		cmd = b.Client.Get(key)
+	}
+	v, err := cmd.Result()
 	if err == redis.Nil {
 		return nil, nil
 	} else if err != nil {
-		return nil, err
+		return nil, redisError(err)
 	}
 	return &v, err
 }
 
+var _ keyvaluestore.MultiExister = &Backend{}
+
+// ExistsMulti pipelines an EXISTS command for each key. Bucketed keys also get an HEXISTS command.
+func (b *Backend) ExistsMulti(keys ...string) (map[string]bool, error) {
+	ret := make(map[string]bool, len(keys))
+	for start := 0; start < len(keys); start += maxPipelineSize {
+		end := start + maxPipelineSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		pipe := b.Client.Pipeline()
+		cmds := make([]*redis.IntCmd, end-start)
+		bucketCmds := make([]*redis.BoolCmd, end-start)
+		for i, key := range keys[start:end] {
+			cmds[i] = pipe.Exists(key)
+			if bucket := b.KeyBucketing.bucket(key); bucket != "" {
+				bucketCmds[i] = pipe.HExists(bucket, key)
+			}
+		}
+		if _, err := pipe.Exec(); err != nil {
+			return nil, redisError(err)
+		}
+		for i, cmd := range cmds {
+			ret[keys[start+i]] = cmd.Val() > 0 || (bucketCmds[i] != nil && bucketCmds[i].Val())
+		}
+	}
+	return ret, nil
+}
+
 func (b *Backend) Set(key string, value interface{}) error {
-	return b.Client.Set(key, value, 0).Err()
+	if bucket := b.KeyBucketing.bucket(key); bucket != "" {
+		return redisError(b.eval(bucketSetScript, []string{bucket, key}, key, redisValue(value)).Err())
+	}
+	return redisError(b.Client.Set(key, redisValue(value), 0).Err())
 }
 
 func (b *Backend) NIncrBy(key string, n int64) (int64, error) {
-	return b.Client.IncrBy(key, n).Result()
+	if bucket := b.KeyBucketing.bucket(key); bucket != "" {
+		v, err := b.Client.HIncrBy(bucket, key, n).Result()
+		return v, redisError(err)
+	}
+	v, err := b.Client.IncrBy(key, n).Result()
+	return v, redisError(err)
 }
 
 func (b *Backend) ZIncrBy(key string, member interface{}, n float64) (float64, error) {
 	s := *keyvaluestore.ToString(member)
-	return b.Client.ZIncrBy(key, n, s).Result()
+	v, err := b.Client.ZIncrBy(key, n, s).Result()
+	return v, redisError(err)
 }
 
 func (b *Backend) SAdd(key string, member interface{}, members ...interface{}) error {
-	return b.Client.SAdd(key, append([]interface{}{member}, members...)...).Err()
+	return redisError(b.Client.SAdd(key, redisValues(member, members...)...).Err())
 }
 
 func (b *Backend) SRem(key string, member interface{}, members ...interface{}) error {
-	return b.Client.SRem(key, append([]interface{}{member}, members...)...).Err()
+	return redisError(b.Client.SRem(key, redisValues(member, members...)...).Err())
 }
 
 func (b *Backend) SMembers(key string) ([]string, error) {
-	return b.Client.SMembers(key).Result()
+	v, err := b.Client.SMembers(key).Result()
+	if len(v) == 0 {
+		v = nil
+	}
+	return v, redisError(err)
 }
 
 func (b *Backend) HSet(key, field string, value interface{}, fields ...keyvaluestore.KeyValue) error {
 	m := make(map[string]interface{}, len(fields)+1)
-	m[field] = value
+	m[field] = redisValue(value)
 	for _, f := range fields {
-		m[f.Key] = f.Value
+		m[f.Key] = redisValue(f.Value)
 	}
-	return b.Client.HMSet(key, m).Err()
+	return redisError(b.Client.HMSet(key, m).Err())
 }
 
 func (b *Backend) HDel(key string, field string, fields ...string) error {
 	args := make([]string, 0, len(fields)+1)
 	args = append(append(args, field), fields...)
-	return b.Client.HDel(key, args...).Err()
+	return redisError(b.Client.HDel(key, args...).Err())
 }
 
 func (b *Backend) HGet(key, field string) (*string, error) {
@@ -86,24 +154,42 @@ func (b *Backend) HGet(key, field string) (*string, error) {
 	if err == redis.Nil {
 		return nil, nil
 	} else if err != nil {
-		return nil, err
+		return nil, redisError(err)
 	}
 	return &v, err
 }
 
 func (b *Backend) HGetAll(key string) (map[string]string, error) {
-	return b.Client.HGetAll(key).Result()
+	v, err := b.Client.HGetAll(key).Result()
+	if len(v) == 0 {
+		v = nil
+	}
+	return v, redisError(err)
 }
 
 func (b *Backend) SetNX(key string, value interface{}) (bool, error) {
-	return b.Client.SetNX(key, value, 0).Result()
+	if bucket := b.KeyBucketing.bucket(key); bucket != "" {
+		n, err := b.eval(bucketSetNXScript, []string{bucket, key}, key, redisValue(value)).Int64()
+		return n == 1, redisError(err)
+	}
+	v, err := b.Client.SetNX(key, redisValue(value), 0).Result()
+	return v, redisError(err)
 }
 
 func (b *Backend) SetXX(key string, value interface{}) (bool, error) {
-	return b.Client.SetXX(key, value, 0).Result()
+	if bucket := b.KeyBucketing.bucket(key); bucket != "" {
+		n, err := b.eval(bucketSetXXScript, []string{bucket, key}, key, redisValue(value)).Int64()
+		return n == 1, redisError(err)
+	}
+	v, err := b.Client.SetXX(key, redisValue(value), 0).Result()
+	return v, redisError(err)
 }
 
 func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	if bucket := b.KeyBucketing.bucket(key); bucket != "" {
+		n, err := b.eval(bucketSetEQScript, []string{bucket, key}, key, redisValue(value), *keyvaluestore.ToString(oldValue)).Int64()
+		return n == 1, redisError(err)
+	}
 	err := b.Client.Watch(func(tx *redis.Tx) error {
 		if before, err := b.Get(key); err != nil {
 			return err
@@ -112,21 +198,82 @@ func (b *Backend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
 		}
 
 		_, err := tx.TxPipelined(func(pipe redis.Pipeliner) error {
-			return pipe.Set(key, value, 0).Err()
+			return pipe.Set(key, redisValue(value), 0).Err()
 		})
 		return err
 	}, key)
 	if err == redis.TxFailedErr {
 		return false, nil
 	}
-	return err == nil, err
+	return err == nil, redisError(err)
+}
+
+// Update implements keyvaluestore.Updater using WATCH and MULTI. If the key is modified
+// concurrently, f is invoked again, up to keyvaluestore.MaxUpdateAttempts times. Bucketed keys
+// watch their entire bucket.
+func (b *Backend) Update(key string, f func(prev *string) (*string, error)) error {
+	bucket := b.KeyBucketing.bucket(key)
+	watched := key
+	if bucket != "" {
+		watched = bucket
+	}
+	for i := 0; i < keyvaluestore.MaxUpdateAttempts; i++ {
+		err := b.Client.Watch(func(tx *redis.Tx) error {
+			get := tx.Get
+			if bucket != "" {
+				get = func(key string) *redis.StringCmd {
+					return tx.HGet(bucket, key)
+				}
+			}
+			var prev *string
+			if v, err := get(key).Result(); err == nil {
+				prev = &v
+			} else if err != redis.Nil {
+				return err
+			}
+			next, err := f(prev)
+			if err != nil || next == nil {
+				return err
+			}
+			_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+				if bucket != "" {
+					return pipe.HSet(bucket, key, *next).Err()
+				}
+				return pipe.Set(key, *next, 0).Err()
+			})
+			return err
+		}, watched)
+		if err != redis.TxFailedErr {
+			b.profileContention("Update", key, i, 0, err)
+			return redisError(err)
+		}
+	}
+	conflict := &keyvaluestore.AtomicWriteConflictError{
+		Err: fmt.Errorf("unable to update %v after %v attempts", key, keyvaluestore.MaxUpdateAttempts),
+	}
+	b.profileContention("Update", key, keyvaluestore.MaxUpdateAttempts-1, 1, conflict)
+	return conflict
+}
+
+// profileContention reports retries and conflicts to the backend's profiler, if it has one.
+func (b *Backend) profileContention(operation, key string, retries, conflicts int, err error) {
+	if b.profiler == nil || (retries == 0 && conflicts == 0) || !keyvaluestore.ShouldProfile(b.profiler) {
+		return
+	}
+	b.profiler.AddProfile(&keyvaluestore.Profile{
+		Operation: operation,
+		Key:       key,
+		Err:       err,
+		Retries:   retries,
+		Conflicts: conflicts,
+	})
 }
 
 func (b *Backend) ZAdd(key string, member interface{}, score float64) error {
-	return b.Client.ZAdd(key, redis.Z{
-		Member: member,
+	return redisError(b.Client.ZAdd(key, redis.Z{
+		Member: redisValue(member),
 		Score:  score,
-	}).Err()
+	}).Err())
 }
 
 func zhHashKey(key string) string {
@@ -139,23 +286,51 @@ func (b *Backend) ZHAdd(key, field string, member interface{}, score float64) er
 			Member: field,
 			Score:  score,
 		}).Err()
-		pipe.HSet(zhHashKey(key), field, member).Err()
+		pipe.HSet(zhHashKey(key), field, redisValue(member)).Err()
+		return nil
+	})
+	return redisError(err)
+}
+
+func (b *Backend) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	_, err := b.Client.TxPipelined(func(pipe redis.Pipeliner) error {
+		zhmAdd(pipe, key, entries)
 		return nil
 	})
-	return err
+	return redisError(err)
+}
+
+// zhmAdd adds the commands for ZHMAdd to the pipeline. entries must not be empty.
+func zhmAdd(pipe redis.Pipeliner, key string, entries []keyvaluestore.ZHEntry) []RedisCmd {
+	members := make([]redis.Z, len(entries))
+	fields := make(map[string]interface{}, len(entries))
+	for i, entry := range entries {
+		members[i] = redis.Z{
+			Member: entry.Field,
+			Score:  entry.Score,
+		}
+		fields[entry.Field] = redisValue(entry.Member)
+	}
+	return []RedisCmd{
+		pipe.ZAdd(key, members...),
+		pipe.HMSet(zhHashKey(key), fields),
+	}
 }
 
 func (b *Backend) ZScore(key string, member interface{}) (*float64, error) {
 	if score, err := b.Client.ZScore(key, *keyvaluestore.ToString(member)).Result(); err == nil {
 		return &score, nil
 	} else if err != redis.Nil {
-		return nil, err
+		return nil, redisError(err)
 	}
 	return nil, nil
 }
 
 func (b *Backend) ZRem(key string, member interface{}) error {
-	return b.Client.ZRem(key, member).Err()
+	return redisError(b.Client.ZRem(key, redisValue(member)).Err())
 }
 
 func (b *Backend) ZHRem(key, field string) error {
@@ -164,52 +339,152 @@ func (b *Backend) ZHRem(key, field string) error {
 		pipe.HDel(zhHashKey(key), field).Err()
 		return nil
 	})
-	return err
+	return redisError(err)
+}
+
+// Members added via ZAdd aren't in the hash, so the field itself is their member.
+func (b *Backend) ZHRemEQ(key, field string, member interface{}) (bool, error) {
+	result, err := b.eval(`
+		local v = redis.call('hget', KEYS[2], ARGV[1]) or (redis.call('zscore', KEYS[1], ARGV[1]) and ARGV[1])
+		if v ~= ARGV[2] then return 0 end
+		redis.call('zrem', KEYS[1], ARGV[1])
+		redis.call('hdel', KEYS[2], ARGV[1])
+		return 1
+	`,
+		[]string{key, zhHashKey(key)},
+		field, *keyvaluestore.ToString(member),
+	).Result()
+	if err != nil {
+		return false, redisError(err)
+	}
+	return result.(int64) == 1, nil
+}
+
+// redisScoreBound formats a score as a min or max argument for commands such as ZRANGEBYSCORE.
+func redisScoreBound(score float64, exclusive bool) string {
+	s := strings.ToLower(strconv.FormatFloat(score, 'g', -1, 64))
+	if exclusive {
+		return "(" + s
+	}
+	return s
 }
 
 func (b *Backend) ZRangeByScore(key string, min, max float64, limit int) ([]string, error) {
-	members, err := b.ZRangeByScoreWithScores(key, min, max, limit)
-	return members.Values(), err
+	return b.ZRangeByScoreRange(key, keyvaluestore.ScoreRange{Min: min, Max: max}, limit)
 }
 
 func (b *Backend) ZHRangeByScore(key string, min, max float64, limit int) ([]string, error) {
-	members, err := b.ZHRangeByScoreWithScores(key, min, max, limit)
-	return members.Values(), err
+	return b.ZHRangeByScoreRange(key, keyvaluestore.ScoreRange{Min: min, Max: max}, limit)
 }
 
 func (b *Backend) ZRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.ZRangeByScoreRangeWithScores(key, keyvaluestore.ScoreRange{Min: min, Max: max}, limit)
+}
+
+func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.ZHRangeByScoreRangeWithScores(key, keyvaluestore.ScoreRange{Min: min, Max: max}, limit)
+}
+
+func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.ZRevRangeByScoreRange(key, keyvaluestore.ScoreRange{Min: min, Max: max}, limit)
+}
+
+func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
+	return b.ZHRevRangeByScoreRange(key, keyvaluestore.ScoreRange{Min: min, Max: max}, limit)
+}
+
+func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.ZRevRangeByScoreRangeWithScores(key, keyvaluestore.ScoreRange{Min: min, Max: max}, limit)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.ZHRevRangeByScoreRangeWithScores(key, keyvaluestore.ScoreRange{Min: min, Max: max}, limit)
+}
+
+func (b *Backend) ZCount(key string, min, max float64) (int, error) {
+	return b.ZCountRange(key, keyvaluestore.ScoreRange{Min: min, Max: max})
+}
+
+var _ keyvaluestore.ApproximateCounter = &Backend{}
+
+// ZCountApprox returns the exact count. Redis's ZCOUNT is O(log(n)) regardless of the size of the
+// range, so there's nothing to be gained by estimating.
+func (b *Backend) ZCountApprox(key string, min, max float64) (int, error) {
+	return b.ZCount(key, min, max)
+}
+
+var _ keyvaluestore.ScoreRanger = &Backend{}
+
+func (b *Backend) ZCountRange(key string, r keyvaluestore.ScoreRange) (int, error) {
+	n, err := b.Client.ZCount(key,
+		redisScoreBound(r.Min, r.MinExclusive),
+		redisScoreBound(r.Max, r.MaxExclusive),
+	).Result()
+	return int(n), redisError(err)
+}
+
+func (b *Backend) ZRangeByScoreRange(key string, r keyvaluestore.ScoreRange, limit int) ([]string, error) {
+	members, err := b.ZRangeByScoreRangeWithScores(key, r, limit)
+	return members.Values(), err
+}
+
+func (b *Backend) ZHRangeByScoreRange(key string, r keyvaluestore.ScoreRange, limit int) ([]string, error) {
+	members, err := b.ZHRangeByScoreRangeWithScores(key, r, limit)
+	return members.Values(), err
+}
+
+func (b *Backend) ZRangeByScoreRangeWithScores(key string, r keyvaluestore.ScoreRange, limit int) (keyvaluestore.ScoredMembers, error) {
 	results, err := b.Client.ZRangeByScoreWithScores(key, redis.ZRangeBy{
-		Min:   strings.ToLower(strconv.FormatFloat(min, 'g', -1, 64)),
-		Max:   strings.ToLower(strconv.FormatFloat(max, 'g', -1, 64)),
+		Min:   redisScoreBound(r.Min, r.MinExclusive),
+		Max:   redisScoreBound(r.Max, r.MaxExclusive),
 		Count: int64(limit),
 	}).Result()
 
 	if err != nil {
-		return nil, err
+		return nil, redisError(err)
 	}
 
-	members := make([]*keyvaluestore.ScoredMember, len(results))
+	return scoredMembers(results), nil
+}
 
-	for i, res := range results {
-		members[i] = &keyvaluestore.ScoredMember{
-			Score: res.Score,
-			Value: res.Member.(string),
-		}
-	}
+var _ keyvaluestore.MultiSortedSetRanger = &Backend{}
 
-	return members, nil
+// zunionKey is the temporary destination of ZUNIONSTORE for ZRangeByScoreMulti. It's written and
+// deleted within a single transaction, so it's never visible to other clients.
+const zunionKey = "__kvs_zunion"
+
+// ZRangeByScoreMulti uses ZUNIONSTORE to merge the sets on the server.
+func (b *Backend) ZRangeByScoreMulti(keys []string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	if len(keys) == 0 {
+		return keyvaluestore.ScoredMembers{}, nil
+	}
+	var cmd *redis.ZSliceCmd
+	_, err := b.Client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.ZUnionStore(zunionKey, redis.ZStore{Aggregate: "MIN"}, keys...)
+		cmd = pipe.ZRangeByScoreWithScores(zunionKey, redis.ZRangeBy{
+			Min:   redisScoreBound(min, false),
+			Max:   redisScoreBound(max, false),
+			Count: int64(limit),
+		})
+		pipe.Del(zunionKey)
+		return nil
+	})
+	if err != nil {
+		return nil, redisError(err)
+	}
+	return scoredMembers(cmd.Val()), nil
 }
 
-func (b *Backend) ZHRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
-	return b.zhRangeByScoreWithScores("zrangebyscore", key, min, max, limit)
+func (b *Backend) ZHRangeByScoreRangeWithScores(key string, r keyvaluestore.ScoreRange, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.zhRangeByScoreWithScores("zrangebyscore", key, redisScoreBound(r.Min, r.MinExclusive), redisScoreBound(r.Max, r.MaxExclusive), limit)
 }
 
-func (b *Backend) zhRangeByScoreWithScores(cmd, key string, start, end float64, limit int) (keyvaluestore.ScoredMembers, error) {
+func (b *Backend) zhRangeByScoreWithScores(cmd, key string, start, end string, limit int) (keyvaluestore.ScoredMembers, error) {
 	args := []interface{}{start, end, "WITHSCORES"}
 	if limit != 0 {
 		args = append(args, "LIMIT", 0, limit)
 	}
-	result, err := b.Client.Eval(`
+	result, err := b.eval(`
 		local m = redis.call('`+cmd+`', KEYS[1], unpack(ARGV))
 		if #m == 0 then return {} end
 		local f = {}
@@ -222,7 +497,7 @@ func (b *Backend) zhRangeByScoreWithScores(cmd, key string, start, end float64,
 		args...,
 	).Result()
 	if err != nil {
-		return nil, err
+		return nil, redisError(err)
 	}
 
 	results := result.([]interface{})
@@ -242,27 +517,35 @@ func (b *Backend) zhRangeByScoreWithScores(cmd, key string, start, end float64,
 	return members, nil
 }
 
-func (b *Backend) ZRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
-	members, err := b.ZRevRangeByScoreWithScores(key, min, max, limit)
+func (b *Backend) ZRevRangeByScoreRange(key string, r keyvaluestore.ScoreRange, limit int) ([]string, error) {
+	members, err := b.ZRevRangeByScoreRangeWithScores(key, r, limit)
 	return members.Values(), err
 }
 
-func (b *Backend) ZHRevRangeByScore(key string, min, max float64, limit int) ([]string, error) {
-	members, err := b.ZHRevRangeByScoreWithScores(key, min, max, limit)
+func (b *Backend) ZHRevRangeByScoreRange(key string, r keyvaluestore.ScoreRange, limit int) ([]string, error) {
+	members, err := b.ZHRevRangeByScoreRangeWithScores(key, r, limit)
 	return members.Values(), err
 }
 
-func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
+func (b *Backend) ZRevRangeByScoreRangeWithScores(key string, r keyvaluestore.ScoreRange, limit int) (keyvaluestore.ScoredMembers, error) {
 	results, err := b.Client.ZRevRangeByScoreWithScores(key, redis.ZRangeBy{
-		Min:   strings.ToLower(strconv.FormatFloat(min, 'g', -1, 64)),
-		Max:   strings.ToLower(strconv.FormatFloat(max, 'g', -1, 64)),
+		Min:   redisScoreBound(r.Min, r.MinExclusive),
+		Max:   redisScoreBound(r.Max, r.MaxExclusive),
 		Count: int64(limit),
 	}).Result()
 
 	if err != nil {
-		return nil, err
+		return nil, redisError(err)
 	}
 
+	return scoredMembers(results), nil
+}
+
+func (b *Backend) ZHRevRangeByScoreRangeWithScores(key string, r keyvaluestore.ScoreRange, limit int) (keyvaluestore.ScoredMembers, error) {
+	return b.zhRangeByScoreWithScores("zrevrangebyscore", key, redisScoreBound(r.Max, r.MaxExclusive), redisScoreBound(r.Min, r.MinExclusive), limit)
+}
+
+func scoredMembers(results []redis.Z) keyvaluestore.ScoredMembers {
 	members := make([]*keyvaluestore.ScoredMember, len(results))
 
 	for i, res := range results {
@@ -272,32 +555,21 @@ func (b *Backend) ZRevRangeByScoreWithScores(key string, min, max float64, limit
 		}
 	}
 
-	return members, nil
-}
-
-func (b *Backend) ZHRevRangeByScoreWithScores(key string, min, max float64, limit int) (keyvaluestore.ScoredMembers, error) {
-	return b.zhRangeByScoreWithScores("zrevrangebyscore", key, max, min, limit)
-}
-
-func (b *Backend) ZCount(key string, min, max float64) (int, error) {
-	n, err := b.Client.ZCount(key,
-		strings.ToLower(strconv.FormatFloat(min, 'g', -1, 64)),
-		strings.ToLower(strconv.FormatFloat(max, 'g', -1, 64)),
-	).Result()
-	return int(n), err
+	return members
 }
 
 func (b *Backend) ZLexCount(key string, min, max string) (int, error) {
 	n, err := b.Client.ZLexCount(key, min, max).Result()
-	return int(n), err
+	return int(n), redisError(err)
 }
 
 func (b *Backend) ZRangeByLex(key string, min, max string, limit int) ([]string, error) {
-	return b.Client.ZRangeByLex(key, redis.ZRangeBy{
+	v, err := b.Client.ZRangeByLex(key, redis.ZRangeBy{
 		Min:   min,
 		Max:   max,
 		Count: int64(limit),
 	}).Result()
+	return v, redisError(err)
 }
 
 func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string, error) {
@@ -305,11 +577,17 @@ func (b *Backend) ZHRangeByLex(key string, min, max string, limit int) ([]string
 }
 
 func (b *Backend) zhRangeByLex(cmd, key string, start, end string, limit int) ([]string, error) {
+	return zhRangeResult(zhRange(b.Client, cmd, key, start, end, limit).Result())
+}
+
+// zhRange evaluates the given range command without scores on a sorted hash, replacing its fields
+// with their values. It works with any Cmdable, so it can be used in pipelines.
+func zhRange(c redis.Cmdable, cmd, key string, start, end interface{}, limit int) *redis.Cmd {
 	args := []interface{}{start, end}
 	if limit != 0 {
 		args = append(args, "LIMIT", 0, limit)
 	}
-	result, err := b.Client.Eval(`
+	return c.Eval(`
 		local f = redis.call('`+cmd+`', KEYS[1], unpack(ARGV))
 		if #f == 0 then return {} end
 		for i,v in pairs(redis.call('hmget', KEYS[2], unpack(f))) do if v then f[i] = v end end
@@ -317,9 +595,12 @@ func (b *Backend) zhRangeByLex(cmd, key string, start, end string, limit int) ([
 	`,
 		[]string{key, zhHashKey(key)},
 		args...,
-	).Result()
+	)
+}
+
+func zhRangeResult(result interface{}, err error) ([]string, error) {
 	if err != nil {
-		return nil, err
+		return nil, redisError(err)
 	}
 	values := result.([]interface{})
 	ret := make([]string, len(values))
@@ -330,21 +611,114 @@ func (b *Backend) zhRangeByLex(cmd, key string, start, end string, limit int) ([
 }
 
 func (b *Backend) ZRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
-	return b.Client.ZRevRangeByLex(key, redis.ZRangeBy{
+	v, err := b.Client.ZRevRangeByLex(key, redis.ZRangeBy{
 		Min:   min,
 		Max:   max,
 		Count: int64(limit),
 	}).Result()
+	return v, redisError(err)
 }
 
 func (b *Backend) ZHRevRangeByLex(key string, min, max string, limit int) ([]string, error) {
 	return b.zhRangeByLex("zrevrangebylex", key, max, min, limit)
 }
 
+var _ keyvaluestore.SortedHashFieldRanger = &Backend{}
+
+func (b *Backend) ZHRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return b.zhRangeWithFields("zrangebyscore", key, min, max, limit, true)
+}
+
+func (b *Backend) ZHRevRangeByScoreWithFields(key string, min, max float64, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return b.zhRangeWithFields("zrevrangebyscore", key, max, min, limit, true)
+}
+
+func (b *Backend) ZHRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return b.zhRangeWithFields("zrangebylex", key, min, max, limit, false)
+}
+
+func (b *Backend) ZHRevRangeByLexWithFields(key string, min, max string, limit int) (keyvaluestore.FieldScoredMembers, error) {
+	return b.zhRangeWithFields("zrevrangebylex", key, max, min, limit, false)
+}
+
+// zhRangeWithFields runs the given range command and returns field, value, and score triples. Lex
+// range commands don't support WITHSCORES, so their scores are left as zero.
+func (b *Backend) zhRangeWithFields(cmd, key string, start, end interface{}, limit int, withScores bool) (keyvaluestore.FieldScoredMembers, error) {
+	args := []interface{}{start, end}
+	if withScores {
+		args = append(args, "WITHSCORES")
+	}
+	if limit != 0 {
+		args = append(args, "LIMIT", 0, limit)
+	}
+	stride := 1
+	if withScores {
+		stride = 2
+	}
+	result, err := b.eval(`
+		local m = redis.call('`+cmd+`', KEYS[1], unpack(ARGV))
+		if #m == 0 then return {} end
+		local stride = `+strconv.Itoa(stride)+`
+		local f = {}
+		for i=1,#m/stride do f[i]=m[(i-1)*stride+1] end
+		local v = redis.call('hmget', KEYS[2], unpack(f))
+		local ret = {}
+		for i=1,#f do
+			ret[#ret+1] = f[i]
+			ret[#ret+1] = v[i] or f[i]
+			ret[#ret+1] = stride == 2 and m[i*2] or '0'
+		end
+		return ret
+	`,
+		[]string{key, zhHashKey(key)},
+		args...,
+	).Result()
+	if err != nil {
+		return nil, redisError(err)
+	}
+
+	results := result.([]interface{})
+	members := make(keyvaluestore.FieldScoredMembers, len(results)/3)
+
+	for i := range members {
+		score, err := strconv.ParseFloat(results[i*3+2].(string), 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing score: %w", err)
+		}
+		members[i] = &keyvaluestore.FieldScoredMember{
+			Field: results[i*3].(string),
+			Value: results[i*3+1].(string),
+			Score: score,
+		}
+	}
+
+	return members, nil
+}
+
+func (b *Backend) Ping() error {
+	return redisError(b.Client.Ping().Err())
+}
+
+// Close closes the client, including for any backends derived from this one via WithProfiler.
+func (b *Backend) Close() error {
+	return redisError(b.Client.Close())
+}
+
 func (b *Backend) WithProfiler(profiler interface{}) keyvaluestore.Backend {
-	if p, ok := profiler.(Profiler); ok {
+	if p, ok := profiler.(keyvaluestore.Profiler); ok {
+		return &Backend{
+			Client: ProfileClient(b.Client, &unifiedProfiler{
+				profiler: p,
+			}),
+			Logger:       b.Logger,
+			KeyBucketing: b.KeyBucketing,
+			profiler:     p,
+		}
+	} else if p, ok := profiler.(Profiler); ok {
 		return &Backend{
-			Client: ProfileClient(b.Client, p),
+			Client:       ProfileClient(b.Client, p),
+			Logger:       b.Logger,
+			KeyBucketing: b.KeyBucketing,
 		}
 	}
 	return b
@@ -357,3 +731,107 @@ func (b *Backend) WithEventuallyConsistentReads() keyvaluestore.Backend {
 func (b *Backend) Unwrap() keyvaluestore.Backend {
 	return nil
 }
+
+var _ keyvaluestore.PubSub = (*Backend)(nil)
+
+// Publish implements keyvaluestore.Publisher using Redis pub/sub.
+func (b *Backend) Publish(channel, message string) error {
+	return redisError(b.Client.Publish(channel, message).Err())
+}
+
+// Subscribe implements keyvaluestore.Subscriber using Redis pub/sub. Each subscription uses its
+// own connection.
+func (b *Backend) Subscribe(channel string) (<-chan string, func(), error) {
+	pubsub := b.Client.Subscribe(channel)
+
+	// Wait for the subscription to be confirmed so that no subsequent messages are missed.
+	if _, err := pubsub.Receive(); err != nil {
+		pubsub.Close()
+		return nil, nil, redisError(err)
+	}
+
+	messages := pubsub.Channel()
+	ch := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(ch)
+		for msg := range messages {
+			select {
+			case ch <- msg.Payload:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			close(done)
+			pubsub.Close()
+		})
+	}, nil
+}
+
+// PFAdd implements keyvaluestorehyperloglog.NativeBackend.
+func (b *Backend) PFAdd(key string, element string, elements ...string) error {
+	args := make([]interface{}, 1+len(elements))
+	args[0] = element
+	for i, element := range elements {
+		args[i+1] = element
+	}
+	return redisError(b.Client.PFAdd(key, args...).Err())
+}
+
+// PFCount implements keyvaluestorehyperloglog.NativeBackend.
+func (b *Backend) PFCount(key string) (int64, error) {
+	n, err := b.Client.PFCount(key).Result()
+	return n, redisError(err)
+}
+
+// GeoAdd implements keyvaluestoregeo.NativeBackend.
+func (b *Backend) GeoAdd(key, member string, longitude, latitude float64) error {
+	return redisError(b.Client.GeoAdd(key, &redis.GeoLocation{
+		Name:      member,
+		Longitude: longitude,
+		Latitude:  latitude,
+	}).Err())
+}
+
+// GeoRadius implements keyvaluestoregeo.NativeBackend.
+func (b *Backend) GeoRadius(key string, longitude, latitude, radius float64, limit int) (keyvaluestore.ScoredMembers, error) {
+	locations, err := b.Client.GeoRadius(key, longitude, latitude, &redis.GeoRadiusQuery{
+		Radius:   radius,
+		Unit:     "m",
+		WithDist: true,
+		Count:    limit,
+		Sort:     "ASC",
+	}).Result()
+	if err != nil {
+		return nil, redisError(err)
+	}
+	members := make(keyvaluestore.ScoredMembers, len(locations))
+	for i, location := range locations {
+		members[i] = &keyvaluestore.ScoredMember{
+			Value: location.Name,
+			Score: location.Dist,
+		}
+	}
+	return members, nil
+}
+
+// eval runs a script via EVALSHA so that the script itself doesn't need to be sent with every
+// request. If the server doesn't have the script cached, e.g. because it was restarted or failed
+// over, it falls back to EVAL, which caches it.
+func (b *Backend) eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	sum := sha1.Sum([]byte(script))
+	sha := hex.EncodeToString(sum[:])
+	cmd := b.Client.EvalSha(sha, keys, args...)
+	if err := cmd.Err(); err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		if b.Logger != nil {
+			b.Logger.Warn("redis script not cached, falling back to EVAL", "sha", sha)
+		}
+		return b.Client.Eval(script, keys, args...)
+	}
+	return cmd
+}
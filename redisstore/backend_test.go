@@ -6,9 +6,13 @@ import (
 
 	"github.com/go-redis/redis"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoregeo"
+	"github.com/ccbrown/keyvaluestore/keyvaluestorehyperloglog"
 	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+	"github.com/ccbrown/keyvaluestore/memorystore"
 )
 
 func newRedisTestClient() (*redis.Client, error) {
@@ -40,10 +44,188 @@ func TestBackend(t *testing.T) {
 	} else if client == nil {
 		t.Skip("no redis server available")
 	}
-	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+	keyvaluestoretest.TestBackendWithOptions(t, func() keyvaluestore.Backend {
 		assert.NoError(t, client.FlushDB().Err())
 		return &Backend{
 			Client: client,
 		}
+	}, keyvaluestoretest.Options{
+		Parallel: true,
+	})
+}
+
+func TestBackendConcurrency(t *testing.T) {
+	client, err := newRedisTestClient()
+	if err != nil {
+		t.Fatal(err)
+	} else if client == nil {
+		t.Skip("no redis server available")
+	}
+	keyvaluestoretest.TestBackendConcurrency(t, func() keyvaluestore.Backend {
+		assert.NoError(t, client.FlushDB().Err())
+		return &Backend{
+			Client: client,
+		}
+	})
+}
+
+func TestPubSub(t *testing.T) {
+	client, err := newRedisTestClient()
+	if err != nil {
+		t.Fatal(err)
+	} else if client == nil {
+		t.Skip("no redis server available")
+	}
+	keyvaluestoretest.TestPubSub(t, func() keyvaluestore.PubSub {
+		return &Backend{
+			Client: client,
+		}
+	})
+}
+
+func TestObservableBackend(t *testing.T) {
+	client, err := newRedisTestClient()
+	if err != nil {
+		t.Fatal(err)
+	} else if client == nil {
+		t.Skip("no redis server available")
+	}
+	require.NoError(t, client.ConfigSet("notify-keyspace-events", "KA").Err())
+	keyvaluestoretest.TestObservableBackend(t, func() keyvaluestore.Backend {
+		return &Backend{
+			Client: client,
+		}
+	})
+}
+
+var _ keyvaluestorehyperloglog.NativeBackend = (*Backend)(nil)
+
+func TestHyperLogLog(t *testing.T) {
+	client, err := newRedisTestClient()
+	if err != nil {
+		t.Fatal(err)
+	} else if client == nil {
+		t.Skip("no redis server available")
+	}
+	assert.NoError(t, client.FlushDB().Err())
+	c := &keyvaluestorehyperloglog.Counter{
+		Backend: &Backend{
+			Client: client,
+		},
+	}
+	require.NoError(t, c.Add("visitors", "a", "b", "c"))
+	require.NoError(t, c.Add("visitors", "a"))
+	n, err := c.Count("visitors")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+}
+
+func TestBatchErrors(t *testing.T) {
+	client, err := newRedisTestClient()
+	if err != nil {
+		t.Fatal(err)
+	} else if client == nil {
+		t.Skip("no redis server available")
+	}
+	keyvaluestoretest.TestBatchErrors(t, func() keyvaluestore.Backend {
+		require.NoError(t, client.FlushDB().Err())
+		return &Backend{
+			Client: client,
+		}
+	}, func(b keyvaluestore.Backend, batch keyvaluestore.BatchOperation) keyvaluestore.ErrorResult {
+		require.NoError(t, b.Set("batch-errors-string", "x"))
+		return batch.SAdd("batch-errors-string", "a")
+	})
+}
+
+type testLogger struct {
+	warnings []string
+}
+
+func (l *testLogger) Warn(msg string, args ...interface{}) {
+	l.warnings = append(l.warnings, msg)
+}
+
+func TestScriptFallback(t *testing.T) {
+	client, err := newRedisTestClient()
+	if err != nil {
+		t.Fatal(err)
+	} else if client == nil {
+		t.Skip("no redis server available")
+	}
+	require.NoError(t, client.ScriptFlush().Err())
+	logger := &testLogger{}
+	b := &Backend{
+		Client: client,
+		Logger: logger,
+	}
+	require.NoError(t, b.ZHAdd("foo", "a", "x", 1))
+
+	// The first use of the script has to fall back to EVAL. After that, it's cached.
+	for i := 0; i < 2; i++ {
+		members, err := b.ZHRangeByScoreWithScores("foo", 0, 1, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"x"}, members.Values())
+		assert.Len(t, logger.warnings, 1)
+	}
+}
+
+var _ keyvaluestoregeo.NativeBackend = (*Backend)(nil)
+
+func TestGeo(t *testing.T) {
+	client, err := newRedisTestClient()
+	if err != nil {
+		t.Fatal(err)
+	} else if client == nil {
+		t.Skip("no redis server available")
+	}
+	assert.NoError(t, client.FlushDB().Err())
+	index := &keyvaluestoregeo.Index{
+		Backend: &Backend{
+			Client: client,
+		},
+		Key: "cities",
+	}
+	require.NoError(t, index.Add("paris", 2.3522, 48.8566))
+	require.NoError(t, index.Add("brussels", 4.3517, 50.8503))
+	require.NoError(t, index.Add("london", -0.1276, 51.5072))
+	require.NoError(t, index.Remove("london"))
+	results, err := index.SearchRadius(2.3522, 48.8566, 400000, 0)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "paris", results[0].Member)
+	assert.Equal(t, "brussels", results[1].Member)
+	assert.InDelta(t, 264000, results[1].Distance, 2000)
+}
+
+func TestBackendAgainstReference(t *testing.T) {
+	client, err := newRedisTestClient()
+	if err != nil {
+		t.Fatal(err)
+	} else if client == nil {
+		t.Skip("no redis server available")
+	}
+	keyvaluestoretest.TestBackendAgainstReference(t, func() keyvaluestore.Backend {
+		assert.NoError(t, client.FlushDB().Err())
+		return &Backend{
+			Client: client,
+		}
+	}, func() keyvaluestore.Backend {
+		return memorystore.NewBackend()
+	})
+}
+
+func BenchmarkBackend(b *testing.B) {
+	client, err := newRedisTestClient()
+	if err != nil {
+		b.Fatal(err)
+	} else if client == nil {
+		b.Skip("no redis server available")
+	}
+	keyvaluestoretest.BenchmarkBackend(b, func() keyvaluestore.Backend {
+		assert.NoError(b, client.FlushDB().Err())
+		return &Backend{
+			Client: client,
+		}
 	})
 }
@@ -1,13 +1,32 @@
 package redisstore
 
 import (
+	"sync"
+
 	"github.com/go-redis/redis"
 
 	"github.com/ccbrown/keyvaluestore"
 )
 
+// maxPipelineSize is the maximum number of commands sent in a single pipeline. Larger batches are
+// split into multiple pipelines so that neither the client nor the server has to buffer huge
+// requests or responses.
+const maxPipelineSize = 1000
+
 type BatchOperation struct {
-	pipe redis.Pipeliner
+	client    *redis.Client
+	bucketing *KeyBucketing
+	pipes     []redis.Pipeliner
+	n         int
+}
+
+// pipe returns the pipeline that the next command should be added to.
+func (op *BatchOperation) pipe() redis.Pipeliner {
+	if op.n%maxPipelineSize == 0 {
+		op.pipes = append(op.pipes, op.client.Pipeline())
+	}
+	op.n++
+	return op.pipes[len(op.pipes)-1]
 }
 
 type GetResult struct {
@@ -19,7 +38,7 @@ func (r *GetResult) Result() (*string, error) {
 	if err == redis.Nil {
 		return nil, nil
 	} else if err != nil {
-		return nil, err
+		return nil, redisError(err)
 	}
 	return &v, nil
 }
@@ -33,7 +52,9 @@ func (r *SMembersResult) Result() ([]string, error) {
 	if err == redis.Nil {
 		return nil, nil
 	} else if err != nil {
-		return nil, err
+		return nil, redisError(err)
+	} else if len(v) == 0 {
+		return nil, nil
 	}
 	return v, nil
 }
@@ -47,49 +68,64 @@ type ErrorResult struct {
 }
 
 func (r *ErrorResult) Result() error {
-	return r.RedisCmd.Err()
+	return redisError(r.RedisCmd.Err())
 }
 
 func (op *BatchOperation) Get(key string) keyvaluestore.GetResult {
+	if bucket := op.bucketing.bucket(key); bucket != "" {
+		return &GetResult{
+			op.pipe().HGet(bucket, key),
+		}
+	}
 	return &GetResult{
-		op.pipe.Get(key),
+		op.pipe().Get(key),
 	}
 }
 
 func (op *BatchOperation) Set(key string, value interface{}) keyvaluestore.ErrorResult {
+	if bucket := op.bucketing.bucket(key); bucket != "" {
+		return &ErrorResult{
+			op.pipe().Eval(bucketSetScript, []string{bucket, key}, key, redisValue(value)),
+		}
+	}
 	return &ErrorResult{
-		op.pipe.Set(key, value, 0),
+		op.pipe().Set(key, redisValue(value), 0),
 	}
 }
 
 func (op *BatchOperation) Delete(key string) keyvaluestore.ErrorResult {
+	if bucket := op.bucketing.bucket(key); bucket != "" {
+		return &ErrorResult{
+			op.pipe().Eval(bucketDeleteScript, []string{bucket, key}, key),
+		}
+	}
 	return &ErrorResult{
-		op.pipe.Del(key),
+		op.pipe().Del(key),
 	}
 }
 
 func (op *BatchOperation) SMembers(key string) keyvaluestore.SMembersResult {
 	return &SMembersResult{
-		op.pipe.SMembers(key),
+		op.pipe().SMembers(key),
 	}
 }
 
 func (op *BatchOperation) SAdd(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
 	return &ErrorResult{
-		op.pipe.SAdd(key, append([]interface{}{member}, members...)...),
+		op.pipe().SAdd(key, redisValues(member, members...)...),
 	}
 }
 
 func (op *BatchOperation) SRem(key string, member interface{}, members ...interface{}) keyvaluestore.ErrorResult {
 	return &ErrorResult{
-		op.pipe.SRem(key, append([]interface{}{member}, members...)...),
+		op.pipe().SRem(key, redisValues(member, members...)...),
 	}
 }
 
 func (op *BatchOperation) ZAdd(key string, member interface{}, score float64) keyvaluestore.ErrorResult {
 	return &ErrorResult{
-		op.pipe.ZAdd(key, redis.Z{
-			Member: member,
+		op.pipe().ZAdd(key, redis.Z{
+			Member: redisValue(member),
 			Score:  score,
 		}),
 	}
@@ -97,7 +133,29 @@ func (op *BatchOperation) ZAdd(key string, member interface{}, score float64) ke
 
 func (op *BatchOperation) ZRem(key string, member interface{}) keyvaluestore.ErrorResult {
 	return &ErrorResult{
-		op.pipe.ZRem(key, member),
+		op.pipe().ZRem(key, redisValue(member)),
+	}
+}
+
+type zhmAddResult struct {
+	cmds []RedisCmd
+}
+
+func (r *zhmAddResult) Result() error {
+	for _, cmd := range r.cmds {
+		if err := cmd.Err(); err != nil {
+			return redisError(err)
+		}
+	}
+	return nil
+}
+
+func (op *BatchOperation) ZHMAdd(key string, entries []keyvaluestore.ZHEntry) keyvaluestore.ErrorResult {
+	if len(entries) == 0 {
+		return &zhmAddResult{}
+	}
+	return &zhmAddResult{
+		cmds: zhmAdd(op.pipe(), key, entries),
 	}
 }
 
@@ -110,23 +168,84 @@ func (r *ZScoreResult) Result() (*float64, error) {
 	if err == redis.Nil {
 		return nil, nil
 	} else if err != nil {
-		return nil, err
+		return nil, redisError(err)
 	}
 	return &v, nil
 }
 
 func (op *BatchOperation) ZScore(key string, member interface{}) keyvaluestore.ZScoreResult {
 	return &ZScoreResult{
-		op.pipe.ZScore(key, *keyvaluestore.ToString(member)),
+		op.pipe().ZScore(key, *keyvaluestore.ToString(member)),
+	}
+}
+
+type ZRangeResult struct {
+	*redis.Cmd
+}
+
+func (r *ZRangeResult) Result() ([]string, error) {
+	return zhRangeResult(r.Cmd.Result())
+}
+
+func (op *BatchOperation) ZHRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return &ZRangeResult{
+		zhRange(op.pipe(), "zrangebyscore", key, redisScoreBound(min, false), redisScoreBound(max, false), limit),
+	}
+}
+
+func (op *BatchOperation) ZHRevRangeByScore(key string, min, max float64, limit int) keyvaluestore.ZRangeResult {
+	return &ZRangeResult{
+		zhRange(op.pipe(), "zrevrangebyscore", key, redisScoreBound(max, false), redisScoreBound(min, false), limit),
 	}
 }
 
+func (op *BatchOperation) ZHRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return &ZRangeResult{
+		zhRange(op.pipe(), "zrangebylex", key, min, max, limit),
+	}
+}
+
+func (op *BatchOperation) ZHRevRangeByLex(key string, min, max string, limit int) keyvaluestore.ZRangeResult {
+	return &ZRangeResult{
+		zhRange(op.pipe(), "zrevrangebylex", key, max, min, limit),
+	}
+}
+
+func (op *BatchOperation) Len() int {
+	return op.n
+}
+
 func (op *BatchOperation) Exec() error {
-	cmds, _ := op.pipe.Exec()
-	for _, cmd := range cmds {
-		if err := cmd.Err(); err != nil && err != redis.Nil {
-			return err
-		}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, keyvaluestore.MaxBatchConcurrency)
+
+	var errs []error
+	var errsMutex sync.Mutex
+
+	for _, pipe := range op.pipes {
+		pipe := pipe
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// Each command's error is available via its result, so we only need to collect them.
+			// If the pipeline itself fails, every command gets the same error, which only needs to
+			// be reported once.
+			cmds, _ := pipe.Exec()
+			var prev error
+			for _, cmd := range cmds {
+				if err := cmd.Err(); err != nil && err != redis.Nil && err != prev {
+					prev = err
+					errsMutex.Lock()
+					errs = append(errs, redisError(err))
+					errsMutex.Unlock()
+				}
+			}
+		}()
 	}
-	return nil
+
+	wg.Wait()
+	return keyvaluestore.JoinBatchErrors(errs...)
 }
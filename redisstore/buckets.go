@@ -0,0 +1,85 @@
+package redisstore
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// KeyBucketing configures a backend to store plain string values as fields of shared hashes, called
+// buckets, rather than as keys of their own. Redis encodes small hashes compactly as listpacks
+// (ziplists before Redis 7), which avoids the overhead of a top-level key per value. For hundreds
+// of millions of tiny values, this can reduce memory usage several times over.
+//
+// Each value's field is its key, and its bucket is chosen by hashing its key. Buckets only stay
+// compact while they're within the server's hash-max-listpack-entries and hash-max-listpack-value
+// limits (128 fields and 64 bytes by default), so Buckets should be at least the expected number of
+// values divided by 100 or so, and only keys with small values should be bucketed.
+//
+// Get, Set, Delete, SetNX, SetXX, SetEQ, NIncrBy, and Update behave as usual, as do their batch and
+// atomic write counterparts. Writes that must also consider keys of other types, such as Set
+// replacing a set, are made atomically via scripts. Sets, hashes, and sorted sets are never
+// bucketed. Some behavior differs for bucketed keys:
+//
+//   - Update watches the entire bucket, so concurrent updates to other keys in the bucket can
+//     cause retries.
+//   - Watch is notified of changes to any key in the bucket, and WatchPrefix doesn't report
+//     bucketed keys.
+//   - Values written before bucketing was enabled aren't moved into buckets, so they won't be
+//     visible. Bucketing should be enabled before any values are written, or Include should be
+//     used to limit it to new keys.
+type KeyBucketing struct {
+	// Buckets is the number of buckets that values are distributed among. It must not be changed
+	// once values have been written.
+	Buckets int
+
+	// If non-nil, only keys for which Include returns true are bucketed. Like Buckets, its result
+	// for any given key must not change once values have been written.
+	Include func(key string) bool
+}
+
+// bucketKeyPrefix begins the keys of buckets. Applications shouldn't use keys with this prefix.
+const bucketKeyPrefix = "__kvs_b:"
+
+// bucket returns the key of the bucket that stores the given key's value, or "" if the key isn't
+// bucketed.
+func (c *KeyBucketing) bucket(key string) string {
+	if c == nil || c.Buckets <= 0 || (c.Include != nil && !c.Include(key)) {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return bucketKeyPrefix + strconv.FormatUint(h.Sum64()%uint64(c.Buckets), 10)
+}
+
+// The following scripts implement the plain string operations for bucketed keys. KEYS[1] is the
+// bucket, KEYS[2] is the key, and ARGV[1] is the key as the bucket's field. Like their Redis
+// counterparts, they treat keys of any other type as existing values.
+
+const bucketSetScript = `
+	redis.call('del', KEYS[2])
+	redis.call('hset', KEYS[1], ARGV[1], ARGV[2])
+	return 1
+`
+
+const bucketDeleteScript = `
+	return redis.call('hdel', KEYS[1], ARGV[1]) + redis.call('del', KEYS[2])
+`
+
+const bucketSetNXScript = `
+	if redis.call('hexists', KEYS[1], ARGV[1]) == 1 or redis.call('exists', KEYS[2]) == 1 then return 0 end
+	redis.call('hset', KEYS[1], ARGV[1], ARGV[2])
+	return 1
+`
+
+const bucketSetXXScript = `
+	if redis.call('hexists', KEYS[1], ARGV[1]) == 0 and redis.call('exists', KEYS[2]) == 0 then return 0 end
+	redis.call('del', KEYS[2])
+	redis.call('hset', KEYS[1], ARGV[1], ARGV[2])
+	return 1
+`
+
+const bucketSetEQScript = `
+	if redis.call('hget', KEYS[1], ARGV[1]) ~= ARGV[3] then return 0 end
+	redis.call('hset', KEYS[1], ARGV[1], ARGV[2])
+	return 1
+`
@@ -0,0 +1,101 @@
+package redisstore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+)
+
+func TestKeyBucketing_Bucket(t *testing.T) {
+	var disabled *KeyBucketing
+	assert.Empty(t, disabled.bucket("foo"))
+
+	c := &KeyBucketing{
+		Buckets: 4,
+		Include: func(key string) bool {
+			return strings.HasPrefix(key, "tiny:")
+		},
+	}
+	assert.Empty(t, c.bucket("foo"))
+
+	buckets := map[string]struct{}{}
+	for _, key := range []string{"tiny:a", "tiny:b", "tiny:c", "tiny:d", "tiny:e", "tiny:f"} {
+		bucket := c.bucket(key)
+		assert.True(t, strings.HasPrefix(bucket, bucketKeyPrefix))
+		assert.Equal(t, bucket, c.bucket(key))
+		buckets[bucket] = struct{}{}
+	}
+	assert.True(t, len(buckets) > 1 && len(buckets) <= 4)
+}
+
+func newBucketedTestBackend(t *testing.T) *Backend {
+	client, err := newRedisTestClient()
+	if err != nil {
+		t.Fatal(err)
+	} else if client == nil {
+		t.Skip("no redis server available")
+	}
+	return &Backend{
+		Client: client,
+		KeyBucketing: &KeyBucketing{
+			Buckets: 16,
+		},
+	}
+}
+
+func TestBackendKeyBucketing(t *testing.T) {
+	b := newBucketedTestBackend(t)
+	keyvaluestoretest.TestBackend(t, func() keyvaluestore.Backend {
+		assert.NoError(t, b.Client.FlushDB().Err())
+		return b
+	})
+}
+
+func TestBackendKeyBucketing_Storage(t *testing.T) {
+	b := newBucketedTestBackend(t)
+	require.NoError(t, b.Client.FlushDB().Err())
+
+	require.NoError(t, b.Set("foo", "bar"))
+	n, err := b.Client.Exists("foo").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	v, err := b.Client.HGet(b.KeyBucketing.bucket("foo"), "foo").Result()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+
+	// Keys of other types aren't bucketed, but plain writes still replace them.
+	require.NoError(t, b.SAdd("set", "a"))
+	ok, err := b.SetNX("set", "x")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, b.Set("set", "x"))
+	members, err := b.SMembers("set")
+	require.NoError(t, err)
+	assert.Empty(t, members)
+
+	var entries []*keyvaluestore.Entry
+	for cursor := ""; ; {
+		page, next, err := b.Scan(cursor, 100)
+		require.NoError(t, err)
+		entries = append(entries, page...)
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	assert.ElementsMatch(t, []*keyvaluestore.Entry{
+		{Key: "foo", Type: keyvaluestore.EntryTypeString, Value: "bar"},
+		{Key: "set", Type: keyvaluestore.EntryTypeString, Value: "x"},
+	}, entries)
+
+	deleted, err := b.Delete("foo")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	exists, err := b.ExistsMulti("foo", "set")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"foo": false, "set": true}, exists)
+}
@@ -0,0 +1,125 @@
+package redisstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// DefaultCoalescingWindow is the window used by CoalesceClient if none is given.
+const DefaultCoalescingWindow = 100 * time.Microsecond
+
+// DefaultCoalescingMaxBatchSize is the maximum batch size used by CoalesceClient if none is given.
+const DefaultCoalescingMaxBatchSize = 100
+
+// CoalescingOptions configure CoalesceClient.
+type CoalescingOptions struct {
+	// Window is how long a command waits for others to join its pipeline before it's sent. If zero,
+	// DefaultCoalescingWindow is used.
+	Window time.Duration
+
+	// MaxBatchSize is the maximum number of commands in each pipeline. Once a pipeline is full, it's
+	// sent without waiting for the rest of the window. If zero, DefaultCoalescingMaxBatchSize is
+	// used.
+	MaxBatchSize int
+}
+
+// CoalesceClient returns a client that transparently batches commands issued concurrently by
+// different goroutines into shared pipelines. This reduces the number of round trips made by
+// services with many concurrent requests at the cost of up to one window of latency per command.
+//
+// Pipelines and transactions issued explicitly, e.g. by BatchOperation and AtomicWriteOperation,
+// are sent as-is. Commands that block, such as BLPOP, must not be issued via the returned client
+// since they would hold up every other command in their pipeline.
+func CoalesceClient(client *redis.Client, options CoalescingOptions) *redis.Client {
+	ret := client.WithContext(client.Context())
+	c := &coalescer{
+		client:       ret,
+		window:       options.Window,
+		maxBatchSize: options.MaxBatchSize,
+	}
+	if c.window == 0 {
+		c.window = DefaultCoalescingWindow
+	}
+	if c.maxBatchSize == 0 {
+		c.maxBatchSize = DefaultCoalescingMaxBatchSize
+	}
+	ret.WrapProcess(func(old func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		c.process = old
+		return c.Process
+	})
+	return ret
+}
+
+type coalescer struct {
+	client       *redis.Client
+	process      func(cmd redis.Cmder) error
+	window       time.Duration
+	maxBatchSize int
+
+	mutex   sync.Mutex
+	pending *coalescedBatch
+}
+
+type coalescedBatch struct {
+	cmds []redis.Cmder
+
+	// full is closed once the batch reaches the maximum size.
+	full chan struct{}
+
+	// done is closed once the batch has been sent.
+	done chan struct{}
+}
+
+// Process adds the command to the pending batch. The first command of each batch waits for the
+// window to elapse, then sends the batch on behalf of every command in it.
+func (c *coalescer) Process(cmd redis.Cmder) error {
+	c.mutex.Lock()
+	batch := c.pending
+	isLeader := batch == nil
+	if isLeader {
+		batch = &coalescedBatch{
+			full: make(chan struct{}),
+			done: make(chan struct{}),
+		}
+		c.pending = batch
+	}
+	batch.cmds = append(batch.cmds, cmd)
+	if len(batch.cmds) >= c.maxBatchSize {
+		c.pending = nil
+		close(batch.full)
+	}
+	c.mutex.Unlock()
+
+	if !isLeader {
+		<-batch.done
+		return cmd.Err()
+	}
+
+	timer := time.NewTimer(c.window)
+	select {
+	case <-timer.C:
+	case <-batch.full:
+		timer.Stop()
+	}
+
+	c.mutex.Lock()
+	if c.pending == batch {
+		c.pending = nil
+	}
+	c.mutex.Unlock()
+
+	// No more commands can be added to the batch at this point.
+	defer close(batch.done)
+	if len(batch.cmds) == 1 {
+		return c.process(cmd)
+	}
+	pipe := c.client.Pipeline()
+	for _, cmd := range batch.cmds {
+		pipe.Process(cmd)
+	}
+	// Each command's error is set individually, so the pipeline's error can be ignored.
+	pipe.Exec()
+	return cmd.Err()
+}
@@ -0,0 +1,69 @@
+package redisstore
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/keyvaluestoretest"
+)
+
+func TestCoalesceClient(t *testing.T) {
+	client, err := newRedisTestClient()
+	if err != nil {
+		t.Fatal(err)
+	} else if client == nil {
+		t.Skip("no redis server available")
+	}
+	coalesced := CoalesceClient(client, CoalescingOptions{})
+	keyvaluestoretest.TestBackendWithOptions(t, func() keyvaluestore.Backend {
+		assert.NoError(t, client.FlushDB().Err())
+		return &Backend{
+			Client: coalesced,
+		}
+	}, keyvaluestoretest.Options{
+		Parallel: true,
+	})
+}
+
+func TestCoalesceClientRoundTrips(t *testing.T) {
+	client, err := newRedisTestClient()
+	if err != nil {
+		t.Fatal(err)
+	} else if client == nil {
+		t.Skip("no redis server available")
+	}
+	assert.NoError(t, client.FlushDB().Err())
+
+	profiler := &BasicProfiler{}
+	b := &Backend{
+		Client: CoalesceClient(ProfileClient(client, profiler), CoalescingOptions{
+			MaxBatchSize: 10,
+		}),
+	}
+
+	const n = 100
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, b.Set("foo"+strconv.Itoa(i), i))
+			v, err := b.Get("foo" + strconv.Itoa(i))
+			if assert.NoError(t, err) && assert.NotNil(t, v) {
+				assert.Equal(t, strconv.Itoa(i), *v)
+			}
+			v, err = b.Get("missing" + strconv.Itoa(i))
+			assert.NoError(t, err)
+			assert.Nil(t, v)
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, 3*n, profiler.RedisCommandCount())
+	assert.True(t, profiler.RedisRoundTripCount() < 3*n)
+}
@@ -0,0 +1,72 @@
+package redisstore
+
+import (
+	"crypto/tls"
+
+	"github.com/go-redis/redis"
+)
+
+// Config configures a backend created via New. Any options not covered here can be set by
+// constructing the client directly.
+type Config struct {
+	// Addr is the host and port of the Redis server.
+	Addr string
+
+	// DB is the database to select after connecting.
+	DB int
+
+	// If non-nil, connections are made via TLS.
+	TLSConfig *tls.Config
+
+	// If Username is given, connections are authenticated as that user via Redis 6 ACLs. Otherwise
+	// if Password is given, connections are authenticated via the legacy AUTH command.
+	Username string
+	Password string
+
+	// PoolSize is the maximum number of connections to keep open. If zero, go-redis's default of 10
+	// connections per CPU is used.
+	PoolSize int
+
+	// MinIdleConns is the number of idle connections to keep open so that bursts of requests don't
+	// have to wait for new connections to be established.
+	MinIdleConns int
+
+	// If non-nil, plain string values are stored in shared hashes to save memory.
+	KeyBucketing *KeyBucketing
+}
+
+// New creates a backend with a new client. Connections are established lazily, so Ping can be
+// used to verify the configuration.
+func New(config Config) *Backend {
+	return &Backend{
+		Client:       redis.NewClient(config.options()),
+		KeyBucketing: config.KeyBucketing,
+	}
+}
+
+func (c Config) options() *redis.Options {
+	opts := &redis.Options{
+		Addr:         c.Addr,
+		DB:           c.DB,
+		TLSConfig:    c.TLSConfig,
+		Password:     c.Password,
+		PoolSize:     c.PoolSize,
+		MinIdleConns: c.MinIdleConns,
+	}
+	if c.Username != "" {
+		// The client only knows how to authenticate with a password, and it selects the database
+		// before invoking OnConnect, which would fail before we authenticate. So we take over both.
+		opts.Password = ""
+		opts.DB = 0
+		opts.OnConnect = func(conn *redis.Conn) error {
+			if err := conn.Do("auth", c.Username, c.Password).Err(); err != nil {
+				return err
+			}
+			if c.DB != 0 {
+				return conn.Select(c.DB).Err()
+			}
+			return nil
+		}
+	}
+	return opts
+}
@@ -0,0 +1,37 @@
+package redisstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigOptions(t *testing.T) {
+	t.Run("Password", func(t *testing.T) {
+		opts := Config{
+			Addr:         "127.0.0.1:6379",
+			DB:           1,
+			Password:     "secret",
+			PoolSize:     20,
+			MinIdleConns: 5,
+		}.options()
+		assert.Equal(t, "127.0.0.1:6379", opts.Addr)
+		assert.Equal(t, 1, opts.DB)
+		assert.Equal(t, "secret", opts.Password)
+		assert.Equal(t, 20, opts.PoolSize)
+		assert.Equal(t, 5, opts.MinIdleConns)
+		assert.Nil(t, opts.OnConnect)
+	})
+
+	t.Run("Username", func(t *testing.T) {
+		opts := Config{
+			Addr:     "127.0.0.1:6379",
+			DB:       1,
+			Username: "app",
+			Password: "secret",
+		}.options()
+		assert.Empty(t, opts.Password)
+		assert.Equal(t, 0, opts.DB)
+		assert.NotNil(t, opts.OnConnect)
+	})
+}
@@ -0,0 +1,45 @@
+package redisstore
+
+import (
+	"strings"
+
+	"github.com/go-redis/redis"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// redisErrorKinds maps fragments of Redis error replies to keyvaluestore error kinds. Redis doesn't
+// give us structured errors, so matching the replies is the best we can do. Fragments are matched
+// anywhere in the message since errors raised within scripts are prefixed with the script location.
+var redisErrorKinds = []struct {
+	Fragment string
+	Kind     error
+}{
+	{"WRONGTYPE", keyvaluestore.ErrWrongType},
+	{"value is not an integer", keyvaluestore.ErrWrongType},
+	{"value is not a valid float", keyvaluestore.ErrWrongType},
+	{"string exceeds maximum allowed size", keyvaluestore.ErrValueTooLarge},
+	{"invalid bulk length", keyvaluestore.ErrValueTooLarge},
+	{"unknown command", keyvaluestore.ErrNotSupported},
+	{"max number of clients reached", keyvaluestore.ErrThrottled},
+}
+
+// redisError translates an error returned by the Redis client into one of the keyvaluestore error
+// kinds if possible. Otherwise err is returned as-is.
+func redisError(err error) error {
+	if err == nil || err == redis.Nil {
+		return err
+	} else if _, ok := err.(*keyvaluestore.Error); ok {
+		return err
+	}
+	message := err.Error()
+	for _, k := range redisErrorKinds {
+		if strings.Contains(message, k.Fragment) {
+			return &keyvaluestore.Error{
+				Kind: k.Kind,
+				Err:  err,
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,32 @@
+package redisstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+func TestRedisError(t *testing.T) {
+	assert.NoError(t, redisError(nil))
+	assert.Equal(t, redis.Nil, redisError(redis.Nil))
+
+	for message, kind := range map[string]error{
+		"WRONGTYPE Operation against a key holding the wrong kind of value":                                           keyvaluestore.ErrWrongType,
+		"ERR Error running script: @user_script:1: WRONGTYPE Operation against a key holding the wrong kind of value": keyvaluestore.ErrWrongType,
+		"ERR value is not an integer or out of range":                                                                 keyvaluestore.ErrWrongType,
+		"ERR string exceeds maximum allowed size (512MB)":                                                             keyvaluestore.ErrValueTooLarge,
+		"ERR unknown command `ZRANGESTORE`, with args beginning with: ":                                               keyvaluestore.ErrNotSupported,
+		"ERR max number of clients reached":                                                                           keyvaluestore.ErrThrottled,
+	} {
+		err := redisError(errors.New(message))
+		assert.True(t, errors.Is(err, kind), message)
+		assert.Contains(t, err.Error(), message)
+	}
+
+	err := errors.New("dial tcp: connection refused")
+	assert.Equal(t, err, redisError(err))
+}
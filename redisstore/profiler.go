@@ -1,12 +1,18 @@
 package redisstore
 
 import (
+	"fmt"
 	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis"
+
+	"github.com/ccbrown/keyvaluestore"
 )
 
+// Profiler is the Redis-specific profiler interface.
+//
+// Deprecated: Pass a keyvaluestore.Profiler to WithProfiler instead.
 type Profiler interface {
 	AddRedisCommandProfile(cmd redis.Cmder, duration time.Duration)
 	AddRedisPipelineProfile(cmds []redis.Cmder, duration time.Duration)
@@ -44,10 +50,147 @@ func (p *BasicProfiler) RedisCommandDuration() time.Duration {
 	return time.Duration(atomic.LoadInt64(&p.redisCommandNanoseconds)) * time.Nanosecond
 }
 
+// unifiedProfiler adapts a keyvaluestore.Profiler to the Redis-specific interface.
+type unifiedProfiler struct {
+	profiler keyvaluestore.Profiler
+}
+
+func (p *unifiedProfiler) AddRedisCommandProfile(cmd redis.Cmder, duration time.Duration) {
+	profile := &keyvaluestore.Profile{
+		Operation: cmd.Name(),
+		Duration:  duration,
+		Err:       cmd.Err(),
+	}
+	profile.RequestBytes = requestBytes(cmd)
+	profile.ResponseBytes, profile.ResponseItems = responseSize(cmd)
+	if args := cmd.Args(); len(args) > 1 {
+		if key, ok := args[1].(string); ok {
+			profile.Key = key
+		}
+	}
+	p.profiler.AddProfile(profile)
+}
+
+func (p *unifiedProfiler) AddRedisPipelineProfile(cmds []redis.Cmder, duration time.Duration) {
+	profile := &keyvaluestore.Profile{
+		Operation: "pipeline",
+		Duration:  duration,
+	}
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+		if profile.Err == nil {
+			profile.Err = cmd.Err()
+		}
+		profile.RequestBytes += requestBytes(cmd)
+		responseBytes, responseItems := responseSize(cmd)
+		profile.ResponseBytes += responseBytes
+		profile.ResponseItems += responseItems
+	}
+	profile.Commands = names
+	profile.Metadata = map[string]interface{}{
+		"Commands": names,
+	}
+	p.profiler.AddProfile(profile)
+}
+
+// requestBytes returns the total size of a command's arguments, excluding its name.
+func requestBytes(cmd redis.Cmder) int {
+	args := cmd.Args()
+	if len(args) == 0 {
+		return 0
+	}
+	n := 0
+	for _, arg := range args[1:] {
+		n += valueBytes(arg)
+	}
+	return n
+}
+
+// responseSize returns the size of a command's result and the number of elements it contains if
+// it's a collection.
+func responseSize(cmd redis.Cmder) (int, int) {
+	if cmd.Err() != nil {
+		return 0, 0
+	}
+	switch cmd := cmd.(type) {
+	case *redis.StringCmd:
+		return len(cmd.Val()), 0
+	case *redis.StringSliceCmd:
+		n := 0
+		for _, s := range cmd.Val() {
+			n += len(s)
+		}
+		return n, len(cmd.Val())
+	case *redis.StringStringMapCmd:
+		n := 0
+		for k, v := range cmd.Val() {
+			n += len(k) + len(v)
+		}
+		return n, len(cmd.Val())
+	case *redis.ZSliceCmd:
+		n := 0
+		for _, z := range cmd.Val() {
+			// Scores are counted as 8-byte floats.
+			n += valueBytes(z.Member) + 8
+		}
+		return n, len(cmd.Val())
+	case *redis.SliceCmd:
+		n := 0
+		for _, v := range cmd.Val() {
+			n += valueBytes(v)
+		}
+		return n, len(cmd.Val())
+	case *redis.Cmd:
+		if values, ok := cmd.Val().([]interface{}); ok {
+			return valueBytes(values), len(values)
+		}
+		return valueBytes(cmd.Val()), 0
+	}
+	return 0, 0
+}
+
+func valueBytes(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case []interface{}:
+		n := 0
+		for _, v := range v {
+			n += valueBytes(v)
+		}
+		return n
+	}
+	return len(fmt.Sprint(v))
+}
+
+func (p *unifiedProfiler) sample() bool {
+	return keyvaluestore.ShouldProfile(p.profiler)
+}
+
+// sampler is implemented by profilers that may not want every command profiled.
+type sampler interface {
+	sample() bool
+}
+
+func shouldProfile(profiler Profiler) bool {
+	if s, ok := profiler.(sampler); ok {
+		return s.sample()
+	}
+	return true
+}
+
 func ProfileClient(client *redis.Client, profiler Profiler) *redis.Client {
 	ret := client.WithContext(client.Context())
 	ret.WrapProcess(func(old func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
 		return func(cmd redis.Cmder) error {
+			if !shouldProfile(profiler) {
+				return old(cmd)
+			}
 			start := time.Now()
 			err := old(cmd)
 			profiler.AddRedisCommandProfile(cmd, time.Since(start))
@@ -56,6 +199,9 @@ func ProfileClient(client *redis.Client, profiler Profiler) *redis.Client {
 	})
 	ret.WrapProcessPipeline(func(old func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
 		return func(cmds []redis.Cmder) error {
+			if !shouldProfile(profiler) {
+				return old(cmds)
+			}
 			start := time.Now()
 			err := old(cmds)
 			profiler.AddRedisPipelineProfile(cmds, time.Since(start))
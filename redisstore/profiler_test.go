@@ -2,9 +2,13 @@ package redisstore
 
 import (
 	"testing"
+	"time"
 
+	"github.com/go-redis/redis"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
 )
 
 func TestProfiler(t *testing.T) {
@@ -81,3 +85,35 @@ func TestProfiler_Batch(t *testing.T) {
 	assert.True(t, profiler.RedisCommandCount() > 0)
 	assert.True(t, profiler.RedisCommandDuration() > 0)
 }
+
+type profilesRecorder struct {
+	profiles []*keyvaluestore.Profile
+}
+
+func (r *profilesRecorder) AddProfile(profile *keyvaluestore.Profile) {
+	r.profiles = append(r.profiles, profile)
+}
+
+func TestUnifiedProfilerPayloadSizes(t *testing.T) {
+	recorder := &profilesRecorder{}
+	p := &unifiedProfiler{
+		profiler: recorder,
+	}
+
+	p.AddRedisCommandProfile(redis.NewStatusCmd("set", "foo", "barbaz"), time.Millisecond)
+	require.Len(t, recorder.profiles, 1)
+	assert.Equal(t, "foo", recorder.profiles[0].Key)
+	assert.Equal(t, 9, recorder.profiles[0].RequestBytes)
+	assert.Equal(t, 0, recorder.profiles[0].ResponseBytes)
+
+	p.AddRedisPipelineProfile([]redis.Cmder{
+		redis.NewStringResult("barbaz", nil),
+		redis.NewZSliceCmdResult([]redis.Z{{Member: "a", Score: 1}, {Member: "bc", Score: 2}}, nil),
+		redis.NewStringSliceResult([]string{"x", "yz"}, nil),
+		redis.NewCmdResult([]interface{}{"abc", int64(10)}, nil),
+		redis.NewStringResult("", redis.Nil),
+	}, time.Millisecond)
+	require.Len(t, recorder.profiles, 2)
+	assert.Equal(t, 6+(1+8)+(2+8)+3+(3+2), recorder.profiles[1].ResponseBytes)
+	assert.Equal(t, 2+2+2, recorder.profiles[1].ResponseItems)
+}
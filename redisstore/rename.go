@@ -0,0 +1,30 @@
+package redisstore
+
+import (
+	"fmt"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+var _ keyvaluestore.Renamer = &Backend{}
+
+// RenameCollection is implemented via RENAME in a script, so it's atomic and the source's timeout,
+// if any, is moved along with it. A sorted hash's member hash is renamed along with its sorted set.
+func (b *Backend) RenameCollection(src, dst string) (bool, error) {
+	if src == dst {
+		return false, fmt.Errorf("unable to rename %v to itself", src)
+	}
+	result, err := b.eval(`
+		if redis.call('exists', KEYS[1]) == 0 then return 0 end
+		redis.call('rename', KEYS[1], KEYS[3])
+		redis.call('del', KEYS[4])
+		if redis.call('exists', KEYS[2]) == 1 then redis.call('rename', KEYS[2], KEYS[4]) end
+		return 1
+	`,
+		[]string{src, zhHashKey(src), dst, zhHashKey(dst)},
+	).Result()
+	if err != nil {
+		return false, redisError(err)
+	}
+	return result.(int64) == 1, nil
+}
@@ -0,0 +1,162 @@
+package redisstore
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+var _ keyvaluestore.Scanner = &Backend{}
+var _ keyvaluestore.EntryGetter = &Backend{}
+
+// Scan is implemented via Redis's SCAN command, so the cursor is Redis's cursor and limit is only
+// a hint. Keys may be returned more than once if they're modified during the scan. Each bucket of
+// a backend with KeyBucketing is returned as the values it contains.
+func (b *Backend) Scan(cursor string, limit int) ([]*keyvaluestore.Entry, string, error) {
+	var redisCursor uint64
+	if cursor != "" {
+		n, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %v", cursor)
+		}
+		redisCursor = n
+	}
+
+	keys, redisCursor, err := b.Client.Scan(redisCursor, "", int64(limit)).Result()
+	if err != nil {
+		return nil, "", redisError(err)
+	}
+
+	var entries []*keyvaluestore.Entry
+	for _, key := range keys {
+		if strings.HasPrefix(key, zhHashKey("")) {
+			continue
+		} else if strings.HasPrefix(key, bucketKeyPrefix) {
+			bucketEntries, err := b.bucketEntries(key)
+			if err != nil {
+				return nil, "", err
+			}
+			entries = append(entries, bucketEntries...)
+			continue
+		}
+		entry, err := b.GetEntry(key)
+		if err != nil {
+			return nil, "", err
+		} else if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+
+	if redisCursor == 0 {
+		return entries, "", nil
+	}
+	return entries, strconv.FormatUint(redisCursor, 10), nil
+}
+
+// bucketEntries returns the values in a bucket as string entries, ordered by key.
+func (b *Backend) bucketEntries(bucket string) ([]*keyvaluestore.Entry, error) {
+	fields, err := b.Client.HGetAll(bucket).Result()
+	if err != nil {
+		return nil, redisError(err)
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entries := make([]*keyvaluestore.Entry, len(keys))
+	for i, key := range keys {
+		entries[i] = &keyvaluestore.Entry{
+			Key:   key,
+			Type:  keyvaluestore.EntryTypeString,
+			Value: fields[key],
+		}
+	}
+	return entries, nil
+}
+
+func (b *Backend) GetEntry(key string) (*keyvaluestore.Entry, error) {
+	if bucket := b.KeyBucketing.bucket(key); bucket != "" {
+		if v, err := b.Client.HGet(bucket, key).Result(); err == nil {
+			return &keyvaluestore.Entry{
+				Key:   key,
+				Type:  keyvaluestore.EntryTypeString,
+				Value: v,
+			}, nil
+		} else if err != redis.Nil {
+			return nil, redisError(err)
+		}
+	}
+
+	t, err := b.Client.Type(key).Result()
+	if err != nil {
+		return nil, redisError(err)
+	}
+
+	entry := &keyvaluestore.Entry{
+		Key: key,
+	}
+	switch t {
+	case "none":
+		return nil, nil
+	case "string":
+		v, err := b.Client.Get(key).Result()
+		if err == redis.Nil {
+			return nil, nil
+		} else if err != nil {
+			return nil, redisError(err)
+		}
+		entry.Type = keyvaluestore.EntryTypeString
+		entry.Value = v
+	case "set":
+		members, err := b.Client.SMembers(key).Result()
+		if err != nil {
+			return nil, redisError(err)
+		}
+		sort.Strings(members)
+		entry.Type = keyvaluestore.EntryTypeSet
+		entry.Members = members
+	case "hash":
+		fields, err := b.Client.HGetAll(key).Result()
+		if err != nil {
+			return nil, redisError(err)
+		}
+		entry.Type = keyvaluestore.EntryTypeHash
+		entry.Fields = fields
+	case "zset":
+		var membersCmd *redis.ZSliceCmd
+		var valuesCmd *redis.StringStringMapCmd
+		if _, err := b.Client.TxPipelined(func(pipe redis.Pipeliner) error {
+			membersCmd = pipe.ZRangeWithScores(key, 0, -1)
+			valuesCmd = pipe.HGetAll(zhHashKey(key))
+			return nil
+		}); err != nil {
+			return nil, redisError(err)
+		}
+		members, values := membersCmd.Val(), valuesCmd.Val()
+		entry.Type = keyvaluestore.EntryTypeSortedSet
+		for _, member := range members {
+			field := member.Member.(string)
+			value, ok := values[field]
+			if !ok {
+				value = field
+			}
+			entry.SortedSetMembers = append(entry.SortedSetMembers, keyvaluestore.SortedSetEntryMember{
+				Field: field,
+				Value: value,
+				Score: member.Score,
+			})
+		}
+	default:
+		return nil, &keyvaluestore.Error{
+			Kind: keyvaluestore.ErrNotSupported,
+			Err:  fmt.Errorf("unsupported type for key %v: %v", key, t),
+		}
+	}
+	return entry, nil
+}
@@ -0,0 +1,24 @@
+package redisstore
+
+import (
+	"github.com/ccbrown/keyvaluestore"
+)
+
+// redisValue converts a value to its canonical encoding before it's passed to the client. The
+// client natively supports most types with the same encodings, but not all of them.
+func redisValue(v interface{}) interface{} {
+	if s := keyvaluestore.ToString(v); s != nil {
+		return *s
+	}
+	// Let the client return an error for unsupported values.
+	return v
+}
+
+func redisValues(v interface{}, vs ...interface{}) []interface{} {
+	ret := make([]interface{}, 0, len(vs)+1)
+	ret = append(ret, redisValue(v))
+	for _, v := range vs {
+		ret = append(ret, redisValue(v))
+	}
+	return ret
+}
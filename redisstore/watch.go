@@ -0,0 +1,110 @@
+package redisstore
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis"
+
+	"github.com/ccbrown/keyvaluestore"
+)
+
+var _ keyvaluestore.ObservableBackend = (*Backend)(nil)
+
+// keyspaceChannelPrefix returns the prefix of the channels that keyspace notifications for the
+// client's database are published to.
+func (b *Backend) keyspaceChannelPrefix() string {
+	return fmt.Sprintf("__keyspace@%d__:", b.Client.Options().DB)
+}
+
+// escapeGlob escapes the characters that are special in Redis glob-style patterns.
+func escapeGlob(s string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// watch sends the keys of the notifications received by the subscription to f until the returned
+// function is invoked, at which point onClose is invoked. The client re-establishes the
+// subscription on its own after connection failures.
+func (b *Backend) watch(pubsub *redis.PubSub, f func(key string, done <-chan struct{}), onClose func()) func() {
+	done := make(chan struct{})
+	messages := pubsub.Channel()
+	prefix := b.keyspaceChannelPrefix()
+	go func() {
+		defer onClose()
+		for msg := range messages {
+			f(strings.TrimPrefix(msg.Channel, prefix), done)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			pubsub.Close()
+		})
+	}
+}
+
+// Watch implements keyvaluestore.ObservableBackend using keyspace notifications, which must be
+// enabled on the server, e.g. via "notify-keyspace-events KA". Each watch uses its own connection.
+// Bucketed keys are notified of changes to any key in their bucket.
+func (b *Backend) Watch(key string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	notify := func(string, <-chan struct{}) {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+
+	channels := []string{b.keyspaceChannelPrefix() + key}
+	if bucket := b.KeyBucketing.bucket(key); bucket != "" {
+		channels = append(channels, b.keyspaceChannelPrefix()+bucket)
+	}
+	pubsub := b.Client.Subscribe(channels...)
+
+	// Wait for the subscriptions to be confirmed so that no subsequent changes are missed. If that
+	// fails, changes may have been missed, so the receiver is notified.
+	for range channels {
+		if _, err := pubsub.Receive(); err != nil {
+			notify("", nil)
+			break
+		}
+	}
+
+	return ch, b.watch(pubsub, notify, func() {
+		close(ch)
+	})
+}
+
+// WatchPrefix implements keyvaluestore.ObservableBackend using keyspace notifications, which must
+// be enabled on the server, e.g. via "notify-keyspace-events KA". Each watch uses its own
+// connection. Changes to bucketed keys aren't reported.
+func (b *Backend) WatchPrefix(prefix string) (<-chan string, func(), error) {
+	pubsub := b.Client.PSubscribe(escapeGlob(b.keyspaceChannelPrefix()+prefix) + "*")
+
+	// Wait for the subscription to be confirmed so that no subsequent changes are missed.
+	if _, err := pubsub.Receive(); err != nil {
+		pubsub.Close()
+		return nil, nil, redisError(err)
+	}
+
+	ch := make(chan string)
+	return ch, b.watch(pubsub, func(key string, done <-chan struct{}) {
+		select {
+		case ch <- key:
+		case <-done:
+		}
+	}, func() {
+		close(ch)
+	}), nil
+}
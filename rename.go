@@ -0,0 +1,26 @@
+package keyvaluestore
+
+import "fmt"
+
+// Renamer is implemented by backends that can move everything stored at a key to another key. It's
+// intended for sorted sets, sorted hashes, and hashes, whose members can't otherwise be moved
+// without reading and rewriting them, but any value can be renamed.
+//
+// A common use is cutting over to a rebuilt index: the new index is built under a temporary key and
+// then renamed to the key that readers use.
+type Renamer interface {
+	// RenameCollection moves the value at src to dst, replacing anything already at dst. It returns
+	// false if src doesn't exist, in which case dst is left unmodified. Implementations document
+	// whether the rename is atomic. src and dst must be different.
+	RenameCollection(src, dst string) (bool, error)
+}
+
+// RenameCollection moves the value at src to dst. If the backend doesn't implement Renamer, an error
+// wrapping ErrNotSupported is returned.
+func RenameCollection(b Backend, src, dst string) (bool, error) {
+	r, ok := b.(Renamer)
+	if !ok {
+		return false, fmt.Errorf("backend does not support renaming: %T: %w", b, ErrNotSupported)
+	}
+	return r.RenameCollection(src, dst)
+}
@@ -0,0 +1,71 @@
+package keyvaluestore
+
+// EntryType identifies the type of value stored at a key.
+type EntryType string
+
+const (
+	EntryTypeString    EntryType = "string"
+	EntryTypeSet       EntryType = "set"
+	EntryTypeHash      EntryType = "hash"
+	EntryTypeSortedSet EntryType = "sortedset"
+)
+
+// SortedSetEntryMember is a member of a sorted set or sorted hash. For members added via ZAdd, the
+// field and value are the same.
+type SortedSetEntryMember struct {
+	Field string  `json:"field"`
+	Value string  `json:"value"`
+	Score float64 `json:"score"`
+}
+
+// Entry is the complete contents of a single key.
+type Entry struct {
+	Key  string    `json:"key"`
+	Type EntryType `json:"type"`
+
+	// Value is set for strings.
+	Value string `json:"value,omitempty"`
+
+	// Members is set for sets.
+	Members []string `json:"members,omitempty"`
+
+	// Fields is set for hashes.
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// SortedSetMembers is set for sorted sets and sorted hashes, in ascending order.
+	SortedSetMembers []SortedSetEntryMember `json:"sortedSetMembers,omitempty"`
+}
+
+// Scanner is implemented by backends that can enumerate their contents.
+type Scanner interface {
+	// Scan returns approximately limit entries along with a cursor that can be passed to a subsequent call
+	// to continue the scan. An empty cursor begins a new scan, and an empty cursor is returned once
+	// the scan is complete. Cursors are opaque, but they remain valid across processes so that
+	// scans of large datasets can be resumed. Keys modified during a scan may or may not be
+	// returned, and some backends may return a key more than once.
+	Scan(cursor string, limit int) ([]*Entry, string, error)
+}
+
+// SegmentedScanner is implemented by backends whose scans can be divided into segments that are
+// scanned concurrently, such as DynamoDB. Each key belongs to exactly one segment.
+type SegmentedScanner interface {
+	// ScanSegment is like Scan, but only returns the entries of the given segment, which must be
+	// less than totalSegments. Cursors are only valid for the segment and total that produced them.
+	ScanSegment(segment, totalSegments int, cursor string, limit int) ([]*Entry, string, error)
+}
+
+// SnapshotScanner is implemented by backends that can scan their contents as of a single point in
+// time, such as the memory backend.
+type SnapshotScanner interface {
+	// ScanSnapshot returns a scanner whose scans all observe the backend's contents at the time
+	// ScanSnapshot was invoked, regardless of how long they take. Its cursors are only valid for
+	// the returned scanner.
+	ScanSnapshot() (Scanner, error)
+}
+
+// EntryGetter is implemented by backends that can read the complete contents of a key regardless
+// of its type.
+type EntryGetter interface {
+	// GetEntry returns nil if the key doesn't exist.
+	GetEntry(key string) (*Entry, error)
+}
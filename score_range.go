@@ -0,0 +1,164 @@
+package keyvaluestore
+
+import "math"
+
+// ScoreRange is a range of sorted set scores. Unlike the min and max arguments of methods such as
+// ZRangeByScore, its bounds can be exclusive.
+type ScoreRange struct {
+	Min          float64
+	Max          float64
+	MinExclusive bool
+	MaxExclusive bool
+}
+
+// Inclusive returns the inclusive bounds equivalent to the range. Because scores are 64-bit floats,
+// an exclusive bound is equivalent to an inclusive bound on the adjacent representable value. If no
+// score can be within the range, ok is false.
+func (r ScoreRange) Inclusive() (min, max float64, ok bool) {
+	min, max = r.Min, r.Max
+	if r.MinExclusive {
+		if min == math.Inf(1) {
+			return 0, 0, false
+		}
+		min = math.Nextafter(min, math.Inf(1))
+	}
+	if r.MaxExclusive {
+		if max == math.Inf(-1) {
+			return 0, 0, false
+		}
+		max = math.Nextafter(max, math.Inf(-1))
+	}
+	return min, max, min <= max
+}
+
+// ScoreRanger is implemented by backends that natively support score ranges with exclusive bounds.
+// Backends that don't implement it can still be used with ScoreRanges via helpers such as
+// ZRangeByScoreRange. The methods are otherwise identical to their counterparts in Backend.
+type ScoreRanger interface {
+	ZCountRange(key string, r ScoreRange) (int, error)
+
+	ZRangeByScoreRange(key string, r ScoreRange, limit int) ([]string, error)
+	ZRangeByScoreRangeWithScores(key string, r ScoreRange, limit int) (ScoredMembers, error)
+	ZRevRangeByScoreRange(key string, r ScoreRange, limit int) ([]string, error)
+	ZRevRangeByScoreRangeWithScores(key string, r ScoreRange, limit int) (ScoredMembers, error)
+
+	ZHRangeByScoreRange(key string, r ScoreRange, limit int) ([]string, error)
+	ZHRangeByScoreRangeWithScores(key string, r ScoreRange, limit int) (ScoredMembers, error)
+	ZHRevRangeByScoreRange(key string, r ScoreRange, limit int) ([]string, error)
+	ZHRevRangeByScoreRangeWithScores(key string, r ScoreRange, limit int) (ScoredMembers, error)
+}
+
+// ZCountRange gets the number of members of a sorted set with scores within the range.
+func ZCountRange(b Backend, key string, r ScoreRange) (int, error) {
+	if sr, ok := b.(ScoreRanger); ok {
+		return sr.ZCountRange(key, r)
+	}
+	min, max, ok := r.Inclusive()
+	if !ok {
+		return 0, nil
+	}
+	return b.ZCount(key, min, max)
+}
+
+// ZRangeByScoreRange gets members of a sorted set with scores within the range by ascending score.
+func ZRangeByScoreRange(b Backend, key string, r ScoreRange, limit int) ([]string, error) {
+	if sr, ok := b.(ScoreRanger); ok {
+		return sr.ZRangeByScoreRange(key, r, limit)
+	}
+	min, max, ok := r.Inclusive()
+	if !ok {
+		return nil, nil
+	}
+	return b.ZRangeByScore(key, min, max, limit)
+}
+
+// ZRangeByScoreRangeWithScores gets members (and their scores) of a sorted set with scores within
+// the range by ascending score.
+func ZRangeByScoreRangeWithScores(b Backend, key string, r ScoreRange, limit int) (ScoredMembers, error) {
+	if sr, ok := b.(ScoreRanger); ok {
+		return sr.ZRangeByScoreRangeWithScores(key, r, limit)
+	}
+	min, max, ok := r.Inclusive()
+	if !ok {
+		return nil, nil
+	}
+	return b.ZRangeByScoreWithScores(key, min, max, limit)
+}
+
+// ZRevRangeByScoreRange gets members of a sorted set with scores within the range by descending
+// score.
+func ZRevRangeByScoreRange(b Backend, key string, r ScoreRange, limit int) ([]string, error) {
+	if sr, ok := b.(ScoreRanger); ok {
+		return sr.ZRevRangeByScoreRange(key, r, limit)
+	}
+	min, max, ok := r.Inclusive()
+	if !ok {
+		return nil, nil
+	}
+	return b.ZRevRangeByScore(key, min, max, limit)
+}
+
+// ZRevRangeByScoreRangeWithScores gets members (and their scores) of a sorted set with scores
+// within the range by descending score.
+func ZRevRangeByScoreRangeWithScores(b Backend, key string, r ScoreRange, limit int) (ScoredMembers, error) {
+	if sr, ok := b.(ScoreRanger); ok {
+		return sr.ZRevRangeByScoreRangeWithScores(key, r, limit)
+	}
+	min, max, ok := r.Inclusive()
+	if !ok {
+		return nil, nil
+	}
+	return b.ZRevRangeByScoreWithScores(key, min, max, limit)
+}
+
+// ZHRangeByScoreRange gets members of a sorted hash with scores within the range by ascending
+// score.
+func ZHRangeByScoreRange(b Backend, key string, r ScoreRange, limit int) ([]string, error) {
+	if sr, ok := b.(ScoreRanger); ok {
+		return sr.ZHRangeByScoreRange(key, r, limit)
+	}
+	min, max, ok := r.Inclusive()
+	if !ok {
+		return nil, nil
+	}
+	return b.ZHRangeByScore(key, min, max, limit)
+}
+
+// ZHRangeByScoreRangeWithScores gets members (and their scores) of a sorted hash with scores
+// within the range by ascending score.
+func ZHRangeByScoreRangeWithScores(b Backend, key string, r ScoreRange, limit int) (ScoredMembers, error) {
+	if sr, ok := b.(ScoreRanger); ok {
+		return sr.ZHRangeByScoreRangeWithScores(key, r, limit)
+	}
+	min, max, ok := r.Inclusive()
+	if !ok {
+		return nil, nil
+	}
+	return b.ZHRangeByScoreWithScores(key, min, max, limit)
+}
+
+// ZHRevRangeByScoreRange gets members of a sorted hash with scores within the range by descending
+// score.
+func ZHRevRangeByScoreRange(b Backend, key string, r ScoreRange, limit int) ([]string, error) {
+	if sr, ok := b.(ScoreRanger); ok {
+		return sr.ZHRevRangeByScoreRange(key, r, limit)
+	}
+	min, max, ok := r.Inclusive()
+	if !ok {
+		return nil, nil
+	}
+	return b.ZHRevRangeByScore(key, min, max, limit)
+}
+
+// ZHRevRangeByScoreRangeWithScores gets members (and their scores) of a sorted hash with scores
+// within the range by descending score.
+func ZHRevRangeByScoreRangeWithScores(b Backend, key string, r ScoreRange, limit int) (ScoredMembers, error) {
+	if sr, ok := b.(ScoreRanger); ok {
+		return sr.ZHRevRangeByScoreRangeWithScores(key, r, limit)
+	}
+	min, max, ok := r.Inclusive()
+	if !ok {
+		return nil, nil
+	}
+	return b.ZHRevRangeByScoreWithScores(key, min, max, limit)
+}
@@ -0,0 +1,29 @@
+package keyvaluestore
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScoreRange_Inclusive(t *testing.T) {
+	min, max, ok := ScoreRange{Min: 1, Max: 2}.Inclusive()
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, min)
+	assert.Equal(t, 2.0, max)
+
+	min, max, ok = ScoreRange{Min: 1, Max: 2, MinExclusive: true, MaxExclusive: true}.Inclusive()
+	assert.True(t, ok)
+	assert.True(t, min > 1 && min < 1.000001)
+	assert.True(t, max < 2 && max > 1.999999)
+
+	_, _, ok = ScoreRange{Min: 1, Max: 1, MaxExclusive: true}.Inclusive()
+	assert.False(t, ok)
+
+	_, _, ok = ScoreRange{Min: math.Inf(1), Max: math.Inf(1), MinExclusive: true}.Inclusive()
+	assert.False(t, ok)
+
+	_, _, ok = ScoreRange{Min: math.Inf(-1), Max: math.Inf(-1), MaxExclusive: true}.Inclusive()
+	assert.False(t, ok)
+}
@@ -0,0 +1,110 @@
+package keyvaluestore
+
+import (
+	"encoding"
+	"encoding/json"
+)
+
+// Serializer converts values to and from the bytes stored by backends. Serializers can be composed,
+// e.g. via TransformedSerializer, so that helpers don't need to hard-code their encodings.
+type Serializer interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// JSONSerializer encodes values as JSON. It's the serializer used by SetJSON and GetJSON.
+var JSONSerializer Serializer = jsonSerializer{}
+
+// TransformedSerializer applies a reversible transformation such as compression or encryption to the
+// output of another serializer.
+type TransformedSerializer struct {
+	Serializer Serializer
+
+	// Transform is applied to the output of Serializer.Marshal.
+	Transform func([]byte) ([]byte, error)
+
+	// Reverse undoes Transform before Serializer.Unmarshal is invoked.
+	Reverse func([]byte) ([]byte, error)
+}
+
+func (s *TransformedSerializer) Marshal(v interface{}) ([]byte, error) {
+	data, err := s.Serializer.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return s.Transform(data)
+}
+
+func (s *TransformedSerializer) Unmarshal(data []byte, v interface{}) error {
+	data, err := s.Reverse(data)
+	if err != nil {
+		return err
+	}
+	return s.Serializer.Unmarshal(data, v)
+}
+
+// SerializationError happens when a value can't be marshaled or unmarshaled by SetSerialized or
+// GetSerialized. Errors returned by the backend itself are passed through unwrapped.
+type SerializationError struct {
+	Key string
+	Err error
+}
+
+func (e *SerializationError) Error() string {
+	return "serialization error for key " + e.Key + ": " + e.Err.Error()
+}
+
+func (e *SerializationError) Unwrap() error {
+	return e.Err
+}
+
+type serializedValue struct {
+	serializer Serializer
+	value      interface{}
+}
+
+func (v *serializedValue) MarshalBinary() ([]byte, error) {
+	return v.serializer.Marshal(v.value)
+}
+
+// Serialized returns a value that's marshaled by the serializer when it's written. It can be passed
+// anywhere a backend accepts a value, including atomic writes and batches. Backends can't report
+// marshaling errors, so values that might fail to marshal should be written via SetSerialized.
+func Serialized(s Serializer, v interface{}) encoding.BinaryMarshaler {
+	return &serializedValue{
+		serializer: s,
+		value:      v,
+	}
+}
+
+// SetSerialized marshals v with the serializer and sets the key to the result.
+func SetSerialized(b Backend, s Serializer, key string, v interface{}) error {
+	buf, err := s.Marshal(v)
+	if err != nil {
+		return &SerializationError{Key: key, Err: err}
+	}
+	return b.Set(key, buf)
+}
+
+// GetSerialized gets the key and unmarshals its value into v with the serializer. If the key doesn't
+// exist, false is returned and v is left untouched.
+func GetSerialized(b Backend, s Serializer, key string, v interface{}) (bool, error) {
+	data, err := b.Get(key)
+	if err != nil || data == nil {
+		return false, err
+	}
+	if err := s.Unmarshal([]byte(*data), v); err != nil {
+		return false, &SerializationError{Key: key, Err: err}
+	}
+	return true, nil
+}
@@ -0,0 +1,77 @@
+package keyvaluestore_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ccbrown/keyvaluestore"
+	"github.com/ccbrown/keyvaluestore/memorystore"
+)
+
+func TestSerializer(t *testing.T) {
+	type object struct {
+		Name  string
+		Count int
+	}
+
+	base64Serializer := &keyvaluestore.TransformedSerializer{
+		Serializer: keyvaluestore.JSONSerializer,
+		Transform: func(data []byte) ([]byte, error) {
+			return []byte(base64.StdEncoding.EncodeToString(data)), nil
+		},
+		Reverse: func(data []byte) ([]byte, error) {
+			return base64.StdEncoding.DecodeString(string(data))
+		},
+	}
+
+	b := memorystore.NewBackend()
+	require.NoError(t, keyvaluestore.SetSerialized(b, base64Serializer, "foo", object{Name: "foo", Count: 2}))
+
+	raw, err := b.Get("foo")
+	require.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte(`{"Name":"foo","Count":2}`)), *raw)
+
+	var v object
+	ok, err := keyvaluestore.GetSerialized(b, base64Serializer, "foo", &v)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, object{Name: "foo", Count: 2}, v)
+
+	t.Run("Serialized", func(t *testing.T) {
+		tx := b.AtomicWrite()
+		tx.Set("bar", keyvaluestore.Serialized(base64Serializer, object{Name: "bar"}))
+		_, err := tx.Exec()
+		require.NoError(t, err)
+
+		var v object
+		ok, err := keyvaluestore.GetSerialized(b, base64Serializer, "bar", &v)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, object{Name: "bar"}, v)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		v := object{Name: "unchanged"}
+		ok, err := keyvaluestore.GetSerialized(b, base64Serializer, "missing", &v)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, "unchanged", v.Name)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		require.NoError(t, b.Set("invalid", "!"))
+		ok, err := keyvaluestore.GetSerialized(b, base64Serializer, "invalid", &v)
+		assert.False(t, ok)
+		var serializationErr *keyvaluestore.SerializationError
+		require.True(t, errors.As(err, &serializationErr))
+		assert.Equal(t, "invalid", serializationErr.Key)
+
+		err = keyvaluestore.SetSerialized(b, keyvaluestore.JSONSerializer, "foo", func() {})
+		require.True(t, errors.As(err, &serializationErr))
+		assert.Equal(t, "foo", serializationErr.Key)
+	})
+}
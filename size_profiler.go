@@ -0,0 +1,176 @@
+package keyvaluestore
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+)
+
+// DefaultSizeProfilerMaxKeys is the number of keys whose sizes SizeProfiler tracks if no other
+// limit is given.
+const DefaultSizeProfilerMaxKeys = 1000
+
+// sizeHistogramBuckets is enough buckets for payloads up to 2GB.
+const sizeHistogramBuckets = 32
+
+// SizeHistogram counts payload sizes in power-of-two buckets.
+type SizeHistogram struct {
+	Count      int64
+	TotalBytes int64
+	MaxBytes   int
+
+	// Buckets[i] is the number of payloads that were at least 2^(i-1) bytes but less than 2^i
+	// bytes. Buckets[0] is the number of empty payloads, and the last bucket also counts anything
+	// larger.
+	Buckets [sizeHistogramBuckets]int64
+}
+
+func (h *SizeHistogram) add(size int) {
+	h.Count++
+	h.TotalBytes += int64(size)
+	if size > h.MaxBytes {
+		h.MaxBytes = size
+	}
+	i := bits.Len(uint(size))
+	if i >= sizeHistogramBuckets {
+		i = sizeHistogramBuckets - 1
+	}
+	h.Buckets[i]++
+}
+
+// KeySize is the largest payload seen for a key.
+type KeySize struct {
+	Key   string
+	Bytes int
+	Items int
+}
+
+// SizeProfiler aggregates the payload sizes reported by backends, which makes it possible to watch
+// keys grow toward backend limits, such as DynamoDB's 400KB item limit, and to alert before writes
+// start failing. A payload's size is the sum of its profile's RequestBytes and ResponseBytes.
+//
+// It keeps a histogram per operation and the largest payload seen for each key. If it's given a
+// sampled profiler's profiles, the counts are of sampled requests only. It's safe for concurrent
+// use.
+type SizeProfiler struct {
+	// If given, OnThresholdExceeded is invoked for each profile whose payload is at least
+	// ByteThreshold bytes or whose ResponseItems is at least ItemThreshold. Zero thresholds are
+	// ignored.
+	ByteThreshold       int
+	ItemThreshold       int
+	OnThresholdExceeded func(profile *Profile)
+
+	// MaxKeys limits the number of keys that are tracked. Once the limit is reached, the key with
+	// the smallest payload is forgotten to make room for larger ones. If zero,
+	// DefaultSizeProfilerMaxKeys is used.
+	MaxKeys int
+
+	mutex      sync.Mutex
+	operations map[string]*SizeHistogram
+	keys       map[string]*KeySize
+}
+
+var _ Profiler = (*SizeProfiler)(nil)
+
+func (p *SizeProfiler) AddProfile(profile *Profile) {
+	size := profile.RequestBytes + profile.ResponseBytes
+
+	p.mutex.Lock()
+	if p.operations == nil {
+		p.operations = map[string]*SizeHistogram{}
+	}
+	h, ok := p.operations[profile.Operation]
+	if !ok {
+		h = &SizeHistogram{}
+		p.operations[profile.Operation] = h
+	}
+	h.add(size)
+	if profile.Key != "" {
+		p.addKey(profile.Key, size, profile.ResponseItems)
+	}
+	p.mutex.Unlock()
+
+	if p.OnThresholdExceeded != nil && ((p.ByteThreshold > 0 && size >= p.ByteThreshold) || (p.ItemThreshold > 0 && profile.ResponseItems >= p.ItemThreshold)) {
+		p.OnThresholdExceeded(profile)
+	}
+}
+
+func (p *SizeProfiler) addKey(key string, size, items int) {
+	if p.keys == nil {
+		p.keys = map[string]*KeySize{}
+	}
+	if k, ok := p.keys[key]; ok {
+		if size > k.Bytes {
+			k.Bytes = size
+		}
+		if items > k.Items {
+			k.Items = items
+		}
+		return
+	}
+
+	maxKeys := p.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = DefaultSizeProfilerMaxKeys
+	}
+	if len(p.keys) >= maxKeys {
+		var smallest *KeySize
+		for _, k := range p.keys {
+			if smallest == nil || k.Bytes < smallest.Bytes {
+				smallest = k
+			}
+		}
+		if smallest.Bytes >= size {
+			return
+		}
+		delete(p.keys, smallest.Key)
+	}
+	p.keys[key] = &KeySize{
+		Key:   key,
+		Bytes: size,
+		Items: items,
+	}
+}
+
+// Histogram returns the histogram for the given operation, e.g. "GetItem" for DynamoDB or "get"
+// for Redis.
+func (p *SizeProfiler) Histogram(operation string) SizeHistogram {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if h, ok := p.operations[operation]; ok {
+		return *h
+	}
+	return SizeHistogram{}
+}
+
+// Histograms returns the histograms for every operation that has been profiled.
+func (p *SizeProfiler) Histograms() map[string]SizeHistogram {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ret := make(map[string]SizeHistogram, len(p.operations))
+	for operation, h := range p.operations {
+		ret[operation] = *h
+	}
+	return ret
+}
+
+// Largest returns up to n of the keys with the largest payloads, largest first.
+func (p *SizeProfiler) Largest(n int) []KeySize {
+	p.mutex.Lock()
+	ret := make([]KeySize, 0, len(p.keys))
+	for _, k := range p.keys {
+		ret = append(ret, *k)
+	}
+	p.mutex.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Bytes != ret[j].Bytes {
+			return ret[i].Bytes > ret[j].Bytes
+		}
+		return ret[i].Key < ret[j].Key
+	})
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
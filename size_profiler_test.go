@@ -0,0 +1,48 @@
+package keyvaluestore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeProfiler(t *testing.T) {
+	var exceeded []*Profile
+	p := &SizeProfiler{
+		ByteThreshold: 1000,
+		ItemThreshold: 100,
+		OnThresholdExceeded: func(profile *Profile) {
+			exceeded = append(exceeded, profile)
+		},
+		MaxKeys: 2,
+	}
+
+	p.AddProfile(&Profile{Operation: "get", Key: "a", RequestBytes: 1, ResponseBytes: 10})
+	p.AddProfile(&Profile{Operation: "get", Key: "a", RequestBytes: 1, ResponseBytes: 2})
+	p.AddProfile(&Profile{Operation: "get", Key: "b", RequestBytes: 1})
+	p.AddProfile(&Profile{Operation: "set", Key: "c", RequestBytes: 2000})
+	p.AddProfile(&Profile{Operation: "zrange", Key: "d", ResponseBytes: 5, ResponseItems: 100})
+
+	h := p.Histogram("get")
+	assert.EqualValues(t, 3, h.Count)
+	assert.EqualValues(t, 15, h.TotalBytes)
+	assert.Equal(t, 11, h.MaxBytes)
+	assert.EqualValues(t, 1, h.Buckets[1])
+	assert.EqualValues(t, 1, h.Buckets[2])
+	assert.EqualValues(t, 1, h.Buckets[4])
+
+	assert.Len(t, p.Histograms(), 3)
+	assert.Equal(t, SizeHistogram{}, p.Histogram("del"))
+
+	// Only two keys are tracked, so the smallest ones were forgotten.
+	assert.Equal(t, []KeySize{
+		{Key: "c", Bytes: 2000},
+		{Key: "a", Bytes: 11},
+	}, p.Largest(10))
+	assert.Equal(t, []KeySize{{Key: "c", Bytes: 2000}}, p.Largest(1))
+
+	require.Len(t, exceeded, 2)
+	assert.Equal(t, "c", exceeded[0].Key)
+	assert.Equal(t, "d", exceeded[1].Key)
+}
@@ -0,0 +1,91 @@
+package keyvaluestore
+
+import "fmt"
+
+// FieldScoredMember is a member of a sorted hash along with its field. For members added via
+// ZAdd, the field and value are the same.
+type FieldScoredMember struct {
+	Field string
+	Value string
+	Score float64
+}
+
+type FieldScoredMembers []*FieldScoredMember
+
+func (m FieldScoredMembers) Fields() []string {
+	result := make([]string, len(m))
+
+	for i, member := range m {
+		result[i] = member.Field
+	}
+
+	return result
+}
+
+func (m FieldScoredMembers) Values() []string {
+	result := make([]string, len(m))
+
+	for i, member := range m {
+		result[i] = member.Value
+	}
+
+	return result
+}
+
+// SortedHashFieldRanger is implemented by backends that can return sorted hash members along with
+// their fields. The methods are otherwise identical to their counterparts in Backend.
+type SortedHashFieldRanger interface {
+	ZHRangeByScoreWithFields(key string, min, max float64, limit int) (FieldScoredMembers, error)
+	ZHRevRangeByScoreWithFields(key string, min, max float64, limit int) (FieldScoredMembers, error)
+
+	// Lex ranges require all members to have a zero score, so the returned scores are always zero.
+	ZHRangeByLexWithFields(key string, min, max string, limit int) (FieldScoredMembers, error)
+	ZHRevRangeByLexWithFields(key string, min, max string, limit int) (FieldScoredMembers, error)
+}
+
+func sortedHashFieldRanger(b Backend) (SortedHashFieldRanger, error) {
+	if r, ok := b.(SortedHashFieldRanger); ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("backend does not support sorted hash fields: %T: %w", b, ErrNotSupported)
+}
+
+// ZHRangeByScoreWithFields gets members of a sorted hash, along with their fields and scores, by
+// ascending score. If the backend doesn't implement SortedHashFieldRanger, an error wrapping
+// ErrNotSupported is returned.
+func ZHRangeByScoreWithFields(b Backend, key string, min, max float64, limit int) (FieldScoredMembers, error) {
+	r, err := sortedHashFieldRanger(b)
+	if err != nil {
+		return nil, err
+	}
+	return r.ZHRangeByScoreWithFields(key, min, max, limit)
+}
+
+// ZHRevRangeByScoreWithFields is like ZHRangeByScoreWithFields, but by descending score.
+func ZHRevRangeByScoreWithFields(b Backend, key string, min, max float64, limit int) (FieldScoredMembers, error) {
+	r, err := sortedHashFieldRanger(b)
+	if err != nil {
+		return nil, err
+	}
+	return r.ZHRevRangeByScoreWithFields(key, min, max, limit)
+}
+
+// ZHRangeByLexWithFields gets members of a sorted hash, along with their fields, by their fields'
+// lexicographical order. If the backend doesn't implement SortedHashFieldRanger, an error wrapping
+// ErrNotSupported is returned.
+func ZHRangeByLexWithFields(b Backend, key string, min, max string, limit int) (FieldScoredMembers, error) {
+	r, err := sortedHashFieldRanger(b)
+	if err != nil {
+		return nil, err
+	}
+	return r.ZHRangeByLexWithFields(key, min, max, limit)
+}
+
+// ZHRevRangeByLexWithFields is like ZHRangeByLexWithFields, but in reverse lexicographical order.
+func ZHRevRangeByLexWithFields(b Backend, key string, min, max string, limit int) (FieldScoredMembers, error) {
+	r, err := sortedHashFieldRanger(b)
+	if err != nil {
+		return nil, err
+	}
+	return r.ZHRevRangeByLexWithFields(key, min, max, limit)
+}
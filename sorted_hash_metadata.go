@@ -0,0 +1,145 @@
+package keyvaluestore
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// metadataMemberPrefix marks sorted hash members that carry metadata. It can't appear at the
+// beginning of valid UTF-8, so it won't be confused with ordinary text members.
+const metadataMemberPrefix = "\xff\x00kvsmd"
+
+// MetadataScoredMember is a member of a sorted hash along with the metadata it was added with via
+// ZHAddWithMetadata.
+type MetadataScoredMember struct {
+	Value    string
+	Score    float64
+	Metadata map[string]string
+}
+
+type MetadataScoredMembers []*MetadataScoredMember
+
+func (m MetadataScoredMembers) Values() []string {
+	result := make([]string, len(m))
+
+	for i, member := range m {
+		result[i] = member.Value
+	}
+
+	return result
+}
+
+type metadataMember struct {
+	member   interface{}
+	metadata map[string]string
+}
+
+func (m *metadataMember) MarshalBinary() ([]byte, error) {
+	value := ToString(m.member)
+	if value == nil {
+		return nil, errors.New("unsupported member type")
+	}
+
+	keys := make([]string, 0, len(m.metadata))
+	for k := range m.metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := []byte(metadataMemberPrefix)
+	buf = appendLengthPrefixed(buf, *value)
+	for _, k := range keys {
+		buf = appendLengthPrefixed(buf, k)
+		buf = appendLengthPrefixed(buf, m.metadata[k])
+	}
+	return buf, nil
+}
+
+func appendLengthPrefixed(buf []byte, s string) []byte {
+	var n [binary.MaxVarintLen64]byte
+	buf = append(buf, n[:binary.PutUvarint(n[:], uint64(len(s)))]...)
+	return append(buf, s...)
+}
+
+func readLengthPrefixed(s string) (string, string, bool) {
+	n, size := binary.Uvarint([]byte(s))
+	if size <= 0 || n > uint64(len(s)-size) {
+		return "", "", false
+	}
+	return s[size : size+int(n)], s[size+int(n):], true
+}
+
+// WithMetadata returns a sorted hash member that carries a small metadata map, such as flags or an
+// expiration time. It can be passed to ZHAdd anywhere, including atomic writes and batches, and
+// the metadata can be retrieved via range queries such as ZHRangeByScoreWithMetadata without any
+// additional requests. The metadata is stored alongside the member, so it counts towards any size
+// limits imposed by the backend.
+//
+// Members with metadata should only be read via the metadata helpers. Other methods return their
+// encoded form.
+func WithMetadata(member interface{}, metadata map[string]string) encoding.BinaryMarshaler {
+	return &metadataMember{
+		member:   member,
+		metadata: metadata,
+	}
+}
+
+// ParseMetadataMember splits a member returned by a sorted hash range query into its value and
+// metadata. Members that were added without metadata are returned as-is with nil metadata.
+func ParseMetadataMember(s string) (string, map[string]string) {
+	if !strings.HasPrefix(s, metadataMemberPrefix) {
+		return s, nil
+	}
+	rest := s[len(metadataMemberPrefix):]
+	value, rest, ok := readLengthPrefixed(rest)
+	if !ok {
+		return s, nil
+	}
+	metadata := map[string]string{}
+	for rest != "" {
+		var k, v string
+		if k, rest, ok = readLengthPrefixed(rest); !ok {
+			return s, nil
+		} else if v, rest, ok = readLengthPrefixed(rest); !ok {
+			return s, nil
+		}
+		metadata[k] = v
+	}
+	return value, metadata
+}
+
+// ZHAddWithMetadata adds a member along with metadata to a sorted hash. See WithMetadata.
+func ZHAddWithMetadata(b Backend, key, field string, member interface{}, metadata map[string]string, score float64) error {
+	return b.ZHAdd(key, field, WithMetadata(member, metadata), score)
+}
+
+func metadataScoredMembers(members ScoredMembers, err error) (MetadataScoredMembers, error) {
+	if err != nil {
+		return nil, err
+	}
+	ret := make(MetadataScoredMembers, len(members))
+	for i, member := range members {
+		value, metadata := ParseMetadataMember(member.Value)
+		ret[i] = &MetadataScoredMember{
+			Value:    value,
+			Score:    member.Score,
+			Metadata: metadata,
+		}
+	}
+	return ret, nil
+}
+
+// ZHRangeByScoreWithMetadata gets members of a sorted hash, along with their scores and metadata,
+// by ascending score.
+func ZHRangeByScoreWithMetadata(b Backend, key string, min, max float64, limit int) (MetadataScoredMembers, error) {
+	return metadataScoredMembers(b.ZHRangeByScoreWithScores(key, min, max, limit))
+}
+
+// ZHRevRangeByScoreWithMetadata gets members of a sorted hash, along with their scores and
+// metadata, by descending score.
+func ZHRevRangeByScoreWithMetadata(b Backend, key string, min, max float64, limit int) (MetadataScoredMembers, error) {
+	return metadataScoredMembers(b.ZHRevRangeByScoreWithScores(key, min, max, limit))
+}
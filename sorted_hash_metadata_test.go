@@ -0,0 +1,37 @@
+package keyvaluestore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMetadataMember(t *testing.T) {
+	b, err := WithMetadata("foo", map[string]string{"b": "2", "a": "\x00\xff"}).MarshalBinary()
+	require.NoError(t, err)
+
+	value, metadata := ParseMetadataMember(string(b))
+	assert.Equal(t, "foo", value)
+	assert.Equal(t, map[string]string{"a": "\x00\xff", "b": "2"}, metadata)
+
+	// Encodings are deterministic so that they can be used for conditionals.
+	b2, err := WithMetadata("foo", map[string]string{"a": "\x00\xff", "b": "2"}).MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, b, b2)
+
+	b, err = WithMetadata(1, nil).MarshalBinary()
+	require.NoError(t, err)
+	value, metadata = ParseMetadataMember(string(b))
+	assert.Equal(t, "1", value)
+	assert.Empty(t, metadata)
+
+	value, metadata = ParseMetadataMember("foo")
+	assert.Equal(t, "foo", value)
+	assert.Nil(t, metadata)
+
+	truncated := metadataMemberPrefix + "\x05foo"
+	value, metadata = ParseMetadataMember(truncated)
+	assert.Equal(t, truncated, value)
+	assert.Nil(t, metadata)
+}
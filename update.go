@@ -0,0 +1,52 @@
+package keyvaluestore
+
+import "fmt"
+
+// Updater is implemented by backends that can natively perform an atomic read-modify-write of a
+// string value, e.g. via transactions.
+type Updater interface {
+	// Update invokes f with the key's current value and sets the key to the value f returns. If f
+	// returns nil, the key is left unmodified. f may be invoked more than once if the update has
+	// to be retried, and it must not use the backend.
+	Update(key string, f func(prev *string) (*string, error)) error
+}
+
+// MaxUpdateAttempts is the number of times Update will try to apply an update before giving up due
+// to contention.
+const MaxUpdateAttempts = 10
+
+// Update atomically modifies the key's string value. If the backend implements Updater, its
+// implementation is used. Otherwise the update is performed optimistically using Get, SetNX, and
+// SetEQ. If the update can't be applied due to contention, an AtomicWriteConflictError is
+// returned.
+//
+// Since the optimistic implementation compares values, f should produce a value that differs from
+// the previous one (e.g. by including a timestamp) if other writers may set the key back to a
+// previous value.
+func Update(b Backend, key string, f func(prev *string) (*string, error)) error {
+	if u, ok := b.(Updater); ok {
+		return u.Update(key, f)
+	}
+	for i := 0; i < MaxUpdateAttempts; i++ {
+		prev, err := b.Get(key)
+		if err != nil {
+			return err
+		}
+		next, err := f(prev)
+		if err != nil || next == nil {
+			return err
+		}
+		var ok bool
+		if prev == nil {
+			ok, err = b.SetNX(key, *next)
+		} else {
+			ok, err = b.SetEQ(key, *next, *prev)
+		}
+		if err != nil || ok {
+			return err
+		}
+	}
+	return &AtomicWriteConflictError{
+		Err: fmt.Errorf("unable to update %v after %v attempts", key, MaxUpdateAttempts),
+	}
+}
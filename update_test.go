@@ -0,0 +1,94 @@
+package keyvaluestore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stringBackend implements just enough of Backend for optimistic updates. If interfere is set, it's
+// invoked before each conditional write.
+type stringBackend struct {
+	Backend
+	values    map[string]string
+	interfere func()
+}
+
+func (b *stringBackend) Get(key string) (*string, error) {
+	if v, ok := b.values[key]; ok {
+		return &v, nil
+	}
+	return nil, nil
+}
+
+func (b *stringBackend) SetNX(key string, value interface{}) (bool, error) {
+	if b.interfere != nil {
+		b.interfere()
+	}
+	if _, ok := b.values[key]; ok {
+		return false, nil
+	}
+	b.values[key] = *ToString(value)
+	return true, nil
+}
+
+func (b *stringBackend) SetEQ(key string, value, oldValue interface{}) (bool, error) {
+	if b.interfere != nil {
+		b.interfere()
+	}
+	if v, ok := b.values[key]; !ok || v != *ToString(oldValue) {
+		return false, nil
+	}
+	b.values[key] = *ToString(value)
+	return true, nil
+}
+
+func appendX(prev *string) (*string, error) {
+	next := "x"
+	if prev != nil {
+		next = *prev + "x"
+	}
+	return &next, nil
+}
+
+func TestUpdate(t *testing.T) {
+	t.Run("Optimistic", func(t *testing.T) {
+		b := &stringBackend{
+			values: map[string]string{},
+		}
+		require.NoError(t, Update(b, "foo", appendX))
+		require.NoError(t, Update(b, "foo", appendX))
+		assert.Equal(t, "xx", b.values["foo"])
+
+		require.NoError(t, Update(b, "foo", func(prev *string) (*string, error) {
+			return nil, nil
+		}))
+		assert.Equal(t, "xx", b.values["foo"])
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		b := &stringBackend{
+			values: map[string]string{},
+		}
+		interference := 3
+		b.interfere = func() {
+			if interference > 0 {
+				interference--
+				b.values["foo"] += "y"
+			}
+		}
+		require.NoError(t, Update(b, "foo", appendX))
+		assert.Equal(t, "yyyx", b.values["foo"])
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		b := &stringBackend{
+			values: map[string]string{},
+		}
+		b.interfere = func() {
+			b.values["foo"] += "y"
+		}
+		assert.True(t, IsAtomicWriteConflict(Update(b, "foo", appendX)))
+	})
+}
@@ -0,0 +1,21 @@
+package keyvaluestore
+
+// ObservableBackend is implemented by backends that can notify of changes to keys, including changes
+// made by other processes if the backend is shared. It allows reactive components to respond to
+// changes without polling. memorystore.Backend, redisstore.Backend, and foundationdbstore.Backend
+// implement it.
+type ObservableBackend interface {
+	// Watch notifies the returned channel whenever the key changes until the returned function is
+	// invoked, at which point the channel is closed.
+	//
+	// Notifications are coalesced: if several changes happen before the receiver gets around to
+	// reading from the channel, it's only notified once. Notifications may also be spurious, so
+	// receivers should re-read the key rather than assume that it changed.
+	Watch(key string) (<-chan struct{}, func())
+
+	// WatchPrefix sends each key that changes and begins with the given prefix to the returned
+	// channel until the returned function is invoked, at which point the channel is closed. Like
+	// Watch, notifications may be coalesced or spurious. If the backend can't watch prefixes, an
+	// error matching ErrNotSupported is returned.
+	WatchPrefix(prefix string) (<-chan string, func(), error)
+}
@@ -0,0 +1,107 @@
+package keyvaluestore
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// MultiSortedSetRanger is implemented by backends that can read the union of several sorted sets
+// more efficiently than by reading each of them. Backends that don't implement it can still be
+// used with ZRangeByScoreMulti.
+type MultiSortedSetRanger interface {
+	// ZRangeByScoreMulti gets members (and their scores) of the union of the given sorted sets by
+	// ascending score. Members in multiple sets are returned once, with their lowest score.
+	ZRangeByScoreMulti(keys []string, min, max float64, limit int) (ScoredMembers, error)
+}
+
+// ZRangeByScoreMulti gets members (and their scores) of the union of the given sorted sets by
+// ascending score, which is useful for things like reading a feed that's fanned out across many
+// keys. Members in multiple sets are returned once, with their lowest score. Members with equal
+// scores are ordered lexicographically.
+//
+// If the backend doesn't implement MultiSortedSetRanger, up to limit members are read from each
+// set, with up to MaxBatchConcurrency reads at a time, and the results are merged.
+func ZRangeByScoreMulti(b Backend, keys []string, min, max float64, limit int) (ScoredMembers, error) {
+	if r, ok := b.(MultiSortedSetRanger); ok {
+		return r.ZRangeByScoreMulti(keys, min, max, limit)
+	}
+
+	results := make([]ScoredMembers, len(keys))
+	errs := make([]error, len(keys))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, MaxBatchConcurrency)
+
+	for i, key := range keys {
+		i, key := i, key
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i], errs[i] = b.ZRangeByScoreWithScores(key, min, max, limit)
+		}()
+	}
+
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return MergeScoredMembers(limit, results...), nil
+}
+
+// MergeScoredMembers merges sets of members that are each sorted by ascending score, returning up
+// to limit members. As with the range methods, a limit of zero or less means no limit. Members in
+// multiple sets are returned once, with their lowest score.
+func MergeScoredMembers(limit int, sets ...ScoredMembers) ScoredMembers {
+	h := make(scoredMembersHeap, 0, len(sets))
+	for _, set := range sets {
+		if len(set) > 0 {
+			h = append(h, set)
+		}
+	}
+	heap.Init(&h)
+
+	ret := ScoredMembers{}
+	seen := map[string]struct{}{}
+	for len(h) > 0 && (limit <= 0 || len(ret) < limit) {
+		member := h[0][0]
+		if len(h[0]) > 1 {
+			h[0] = h[0][1:]
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+		if _, ok := seen[member.Value]; ok {
+			continue
+		}
+		seen[member.Value] = struct{}{}
+		ret = append(ret, member)
+	}
+	return ret
+}
+
+// scoredMembersHeap is a min-heap of non-empty sorted sets, ordered by their first members.
+type scoredMembersHeap []ScoredMembers
+
+func (h scoredMembersHeap) Len() int { return len(h) }
+
+func (h scoredMembersHeap) Less(i, j int) bool {
+	a, b := h[i][0], h[j][0]
+	return a.Score < b.Score || (a.Score == b.Score && a.Value < b.Value)
+}
+
+func (h scoredMembersHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *scoredMembersHeap) Push(x interface{}) { *h = append(*h, x.(ScoredMembers)) }
+
+func (h *scoredMembersHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,19 @@
+package keyvaluestore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeScoredMembers(t *testing.T) {
+	a := ScoredMembers{{Value: "a", Score: 1}, {Value: "c", Score: 2}, {Value: "dup", Score: 4}}
+	b := ScoredMembers{{Value: "b", Score: 2}, {Value: "dup", Score: 3}}
+
+	merged := MergeScoredMembers(0, a, b, nil)
+	assert.Equal(t, []string{"a", "b", "c", "dup"}, merged.Values())
+	assert.Equal(t, []float64{1, 2, 2, 3}, merged.Scores())
+
+	assert.Equal(t, []string{"a", "b"}, MergeScoredMembers(2, a, b).Values())
+	assert.Empty(t, MergeScoredMembers(0))
+}